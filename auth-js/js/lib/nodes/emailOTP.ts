@@ -120,6 +120,11 @@ export function simulatePaste(input: OTPInput, value: string): void {
   input.dispatchEvent(pasteEvent);
 } 
 
+// The magic link page has no otp input, only the resend countdown
+export function initEmailMagicLink(): void {
+  initResendCountdown();
+}
+
 function initResendCountdown(): void {
   const resendButton = document.getElementById('resend-otp-button') as HTMLButtonElement;
   
@@ -1,4 +1,4 @@
-import { initEmailOTP } from './lib/nodes/emailOTP.js'
+import { initEmailOTP, initEmailMagicLink } from './lib/nodes/emailOTP.js'
 import { initPasswordOrSocialLogin } from './lib/nodes/passwordOrSocialLogin.js'
 import { initHcaptcha } from './lib/nodes/hcaptcha.js'
 import { initVerifyPasskey } from './lib/nodes/verifyPasskey.js'
@@ -11,6 +11,8 @@ import { initTranslator } from './lib/translator.js'
 
 const nodeHandlers = {
     'emailOTP': initEmailOTP,
+    'smsOTP': initEmailOTP,
+    'emailMagicLink': initEmailMagicLink,
     'passwordOrSocialLogin': initPasswordOrSocialLogin,
     'hcaptcha': initHcaptcha,
     'verifyPasskey': initVerifyPasskey,
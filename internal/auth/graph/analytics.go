@@ -0,0 +1,66 @@
+package graph
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// recordFlowEvent reports the progress of the run to the analytics of the realm if there are any
+func recordFlowEvent(services *model.Repositories, state *model.AuthenticationSession, event *model.FlowEvent) {
+	if services == nil || services.Analytics == nil {
+		return
+	}
+	services.Analytics.RecordFlowEvent(state, event)
+}
+
+// recordPrompt reports a node that prompts the user and starts the step time. A node that prompted in the last
+// entry of the history only renders its prompts again, e.g. after a reload of the page, and is not reported.
+func recordPrompt(services *model.Repositories, state *model.AuthenticationSession, node *model.GraphNode) {
+	prefix := node.Name + ":prompted:"
+	if strings.HasPrefix(state.GetLatestHistory(), prefix) {
+		return
+	}
+
+	first := true
+	for _, entry := range state.History {
+		if strings.HasPrefix(entry, prefix) {
+			first = false
+			break
+		}
+	}
+
+	state.PromptedAt = time.Now()
+	recordFlowEvent(services, state, &model.FlowEvent{
+		Type:     model.FlowEventPrompted,
+		Node:     node.Name,
+		Previous: lastPromptedNode(state),
+		First:    first,
+	})
+}
+
+// recordSubmission reports the inputs of the node that prompted in the last entry of the history
+func recordSubmission(services *model.Repositories, state *model.AuthenticationSession, node *model.GraphNode) {
+	if state.PromptedAt.IsZero() || !strings.HasPrefix(state.GetLatestHistory(), node.Name+":prompted:") {
+		return
+	}
+
+	recordFlowEvent(services, state, &model.FlowEvent{
+		Type:     model.FlowEventSubmitted,
+		Node:     node.Name,
+		Duration: time.Since(state.PromptedAt),
+	})
+	state.PromptedAt = time.Time{}
+}
+
+// lastPromptedNode returns the node at which the run waited last, or an empty string if no node prompted yet
+func lastPromptedNode(state *model.AuthenticationSession) string {
+	for i := len(state.History) - 1; i >= 0; i-- {
+		parts := strings.SplitN(state.History[i], ":", 3)
+		if len(parts) == 3 && parts[1] == "prompted" {
+			return parts[0]
+		}
+	}
+	return ""
+}
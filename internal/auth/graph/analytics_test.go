@@ -0,0 +1,60 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingAnalytics struct {
+	events []model.FlowEvent
+}
+
+func (r *recordingAnalytics) RecordFlowEvent(state *model.AuthenticationSession, event *model.FlowEvent) {
+	recorded := *event
+	recorded.Duration = 0
+	r.events = append(r.events, recorded)
+}
+
+func TestRun_RecordsFlowEvents(t *testing.T) {
+	flow := newNavigationTestFlow()
+	analytics := &recordingAnalytics{}
+	services := &model.Repositories{Analytics: analytics}
+
+	state, err := Run(flow, InitFlow(flow), nil, services)
+	require.NoError(t, err)
+	assert.False(t, state.PromptedAt.IsZero())
+
+	// Rendering the prompts again is not a new step
+	state, err = Run(flow, state, nil, services)
+	require.NoError(t, err)
+
+	state, err = Run(flow, state, map[string]string{"username": "alice"}, services)
+	require.NoError(t, err)
+
+	state, err = Back(flow, state, services)
+	require.NoError(t, err)
+
+	state, err = Run(flow, state, map[string]string{"username": "bob"}, services)
+	require.NoError(t, err)
+	state, err = Run(flow, state, map[string]string{"email": "bob@example.com"}, services)
+	require.NoError(t, err)
+	_, err = Run(flow, state, map[string]string{"password": "secret"}, services)
+	require.NoError(t, err)
+
+	assert.Equal(t, []model.FlowEvent{
+		{Type: model.FlowEventStarted},
+		{Type: model.FlowEventPrompted, Node: "askUsername", First: true},
+		{Type: model.FlowEventSubmitted, Node: "askUsername"},
+		{Type: model.FlowEventPrompted, Node: "askEmail", Previous: "askUsername", First: true},
+		{Type: model.FlowEventPrompted, Node: "askUsername", Previous: "askEmail"},
+		{Type: model.FlowEventSubmitted, Node: "askUsername"},
+		{Type: model.FlowEventPrompted, Node: "askEmail", Previous: "askUsername"},
+		{Type: model.FlowEventSubmitted, Node: "askEmail"},
+		{Type: model.FlowEventPrompted, Node: "askPassword", Previous: "askEmail", First: true},
+		{Type: model.FlowEventSubmitted, Node: "askPassword"},
+		{Type: model.FlowEventFinished, Node: "end", Previous: "askPassword"},
+	}, analytics.events)
+}
@@ -1,9 +1,14 @@
 package graph
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"runtime/debug"
+	"slices"
+	"time"
 
 	"github.com/Identityplane/GoAM/internal/logger"
 	"github.com/Identityplane/GoAM/pkg/model"
@@ -14,6 +19,9 @@ var log = logger.GetGoamLogger()
 
 const MAX_HISTORY_SIZE = 100
 
+// MAX_STEPS is the maximum number of nodes that are executed in one request
+const MAX_STEPS = 100
+
 type Engine struct {
 	Flow *model.FlowDefinition
 }
@@ -40,10 +48,10 @@ func InitFlow(flow *model.FlowDefinition) *model.AuthenticationSession {
 	}
 }
 
-// Run processes one step of the flow and returns either
-// returns the state also in case of an error to allow for debugging
-// - flow state when graph is requesting prompt or is finished
-// - error if any internal error occurred
+// Run processes the flow until it needs input from the user or reaches a result node and returns
+// the state, which is also returned in case of an error to allow for debugging.
+// Errors of nodes are handled by the error transition of the node or the on_error node of the flow,
+// an error is only returned if the flow does not handle it or the flow itself is invalid.
 func Run(flow *model.FlowDefinition, state *model.AuthenticationSession, inputs map[string]string, services *model.Repositories) (*model.AuthenticationSession, error) {
 
 	// Check if state is present and valid
@@ -51,11 +59,6 @@ func Run(flow *model.FlowDefinition, state *model.AuthenticationSession, inputs
 		return nil, errors.New("invalid flow state")
 	}
 
-	// Check if history size limit is reached
-	if len(state.History) > MAX_HISTORY_SIZE {
-		return state, errors.New("history size limit reached")
-	}
-
 	// If the flow is nil we return an error
 	if flow == nil {
 		return state, errors.New("invalid flow")
@@ -66,45 +69,68 @@ func Run(flow *model.FlowDefinition, state *model.AuthenticationSession, inputs
 		state.Current = flow.Start
 	}
 
-	// Check if node for current state exists in flow
-	node, ok := flow.Nodes[state.Current]
-	if !ok {
-		return state, fmt.Errorf("node '%s' not found in flow", state.Current)
+	if len(state.History) == 0 {
+		recordFlowEvent(services, state, &model.FlowEvent{Type: model.FlowEventStarted})
 	}
 
-	// Update the current node type
-	state.CurrentType = node.Use
+	// Each iteration executes one node, the steps are bounded so that a loop of logic nodes cannot block the request
+	for step := 0; ; step++ {
 
-	// Load node definition from node name
-	def := GetNodeDefinitionByName(node.Use)
-	if def == nil {
-		return state, fmt.Errorf("node definition for '%s' not found", node.Use)
-	}
+		// Check if history size limit is reached
+		if len(state.History) > MAX_HISTORY_SIZE {
+			return state, errors.New("history size limit reached")
+		}
 
-	var nodeResult *model.NodeResult
-	var err error
+		if step >= MAX_STEPS {
+			return state, fmt.Errorf("step limit of %d reached at node '%s'", MAX_STEPS, state.Current)
+		}
 
-	// Process node by type
-	switch def.Type {
-	case model.NodeTypeInit:
-		nodeResult, err = ProcessInitTypeNode(state, node, def, inputs, services)
+		// Check if node for current state exists in flow
+		node, ok := flow.Nodes[state.Current]
+		if !ok {
+			return state, fmt.Errorf("node '%s' not found in flow", state.Current)
+		}
 
-	case model.NodeTypeLogic:
-		nodeResult, err = ProcessLogicTypeNode(state, node, def, inputs, services)
+		// Update the current node type
+		state.CurrentType = node.Use
 
-	case model.NodeTypeQuery:
-		nodeResult, err = ProcessQueryTypeNode(state, node, def, inputs, services)
+		// Load node definition from node name
+		def := GetNodeDefinitionByName(node.Use)
+		if def == nil {
+			return state, fmt.Errorf("node definition for '%s' not found", node.Use)
+		}
 
-	case model.NodeTypeResult:
-		nodeResult, err = ProcessResultTypeNode(state, node, def, inputs, services)
+		// A result node of a child flow does not end the session, the subflow node continues the parent flow
+		if def.Type == model.NodeTypeResult && returnToSubflowNode(state, node) {
+			inputs = nil
+			continue
+		}
 
-	case model.NodeTypeQueryWithLogic:
-		nodeResult, err = ProcessQueryWithLogicTypeNode(state, node, def, inputs, services)
+		done, err := runStep(flow, state, node, def, inputs, services)
+		if err != nil && !handleNodeError(flow, state, node, err) {
+			return state, err
+		}
 
-	default:
-		return state, fmt.Errorf("unsupported node type: %s", def.Type)
+		if done {
+			return state, nil
+		}
+
+		// Clear inputs as next node does not expect any inputs
+		inputs = nil
+	}
+}
+
+// runStep executes a node and moves the state to the next node. It returns true if the flow waits for
+// the user or has reached a result node.
+func runStep(flow *model.FlowDefinition, state *model.AuthenticationSession, node *model.GraphNode, def *model.NodeDefinition, inputs map[string]string, services *model.Repositories) (bool, error) {
+
+	// Required options can be set in the realm or server settings, so they are only known when the node runs
+	if err := CheckRequiredConfig(node, def); err != nil {
+		return false, model.NewInternalError(model.ErrorCodeInvalidConfig, err)
 	}
 
+	nodeResult, err := executeNode(state, node, def, inputs, services)
+
 	userid := ""
 	if state.User != nil {
 		userid = state.User.ID
@@ -119,23 +145,33 @@ func Run(flow *model.FlowDefinition, state *model.AuthenticationSession, inputs
 			Str("node_type", string(def.Type)).
 			Str("user_id", userid).
 			Msg("error processing node")
-		return state, err
+		return false, err
 	}
 
 	// End the graph if the node is a result node
 	if def.Type == model.NodeTypeResult {
 
-		return state, nil
+		recordFlowEvent(services, state, &model.FlowEvent{
+			Type:     model.FlowEventFinished,
+			Node:     node.Name,
+			Previous: lastPromptedNode(state),
+			Success:  state.Result != nil && state.Result.Authenticated,
+		})
+		return true, nil
+	}
+
+	if nodeResult == nil {
+		return false, model.NewInternalError(model.ErrorCodeInvalidResult, fmt.Errorf("node '%s' returned neither prompts nor condition", node.Name))
 	}
 
 	// if there are prompt in the result we update the state and return
 	if nodeResult.Prompts != nil {
 
-		// turn the nodeResult.Prompts into a strong for logging
-		promptsString, err := json.Marshal(nodeResult.Prompts)
+		// turn the nodeResult.Prompts into a strong for logging, prompts might contain secrets e.g. during totp enrollment
+		promptsString, err := json.Marshal(model.RedactSensitiveValues(nodeResult.Prompts))
 		if err != nil {
 			log.Debug().Err(err).Msg("error marshalling prompts")
-			return nil, err
+			return false, err
 		}
 
 		// log the node name, type and prompts
@@ -144,73 +180,229 @@ func Run(flow *model.FlowDefinition, state *model.AuthenticationSession, inputs
 			Str("node_type", string(def.Type)).
 			Str("prompts", string(promptsString)).
 			Msg("node resulted in prompts")
+		recordPrompt(services, state, node)
 		state.History = append(state.History, fmt.Sprintf("%s:prompted:%s", node.Name, promptsString))
 
 		// Update prompts in string and return
 		state.Prompts = nodeResult.Prompts
-		return state, nil
+		recordStep(state)
+		return true, nil
+	}
+
+	if nodeResult.Condition == "" {
+		return false, model.NewInternalError(model.ErrorCodeInvalidResult, fmt.Errorf("node '%s' returned neither prompts nor condition", node.Name))
+	}
+
+	// The node is done so the secrets it consumed are not needed anymore
+	for _, key := range def.SensitiveContext {
+		delete(state.Context, key)
+	}
+
+	// log the node name and condition
+	recordSubmission(services, state, node)
+	condition := nodeResult.Condition
+	state.History = append(state.History, fmt.Sprintf("%s:%s", node.Name, condition))
+
+	// Check if resulting condition is valid as defined in the node Definition
+	if !contains(def.ResultStatesFor(node), condition) {
+		return false, model.NewInternalError(model.ErrorCodeInvalidResult, fmt.Errorf("invalid condition '%s' returned by node '%s'", condition, node.Name))
+	}
+
+	// Clear prompts if no prompts are present
+	state.Prompts = nil
+
+	// The user cannot go back to earlier steps once the flow took a transition that cannot be reversed
+	if !contains(node.Reversible, condition) {
+		state.Steps = nil
+	}
+
+	// lookup transition in graph, result states without their own transition use the default transition
+	nextNodeName, ok := node.Next[condition]
+	if !ok {
+		nextNodeName, ok = node.Next[NextDefault]
+	}
+	if ok {
+		state.Current = nextNodeName
+
+		log.Debug().Str("node_name", node.Name).Str("condition", condition).Str("flow_id", state.FlowId).Msg("node transition")
+		return false, nil
 	}
-	if nodeResult.Condition != "" {
 
-		// log the node name and condition
-		condition := nodeResult.Condition
-		state.History = append(state.History, fmt.Sprintf("%s:%s", node.Name, condition))
+	log.Debug().Str("node_name", node.Name).Str("condition", condition).Str("flow_id", state.FlowId).Msg("node transition")
 
-		// Check if resulting condition is valid as defined in the node Definition
-		valid := false
-		for _, c := range def.PossibleResultStates {
-			if c == condition {
-				valid = true
-				break
-			}
+	// If we have no next node defined we search for an failureResult node
+	// TODO we should log that
+	for nodeName, node := range flow.Nodes {
+		if node.Use == "failureResult" {
+
+			// Overwrite the current node with the failureResult node
+			state.Error = &[]string{"Invalid node transition"}[0]
+			state.Current = nodeName
+			state.CurrentType = model.NODE_ERROR
+			return false, nil
 		}
-		if !valid {
-			return nil, fmt.Errorf("invalid condition '%s' returned by node '%s'", condition, node.Name)
+	}
+
+	return false, model.NewInternalError(model.ErrorCodeMissingTransition, fmt.Errorf("no next node and no failureResult node defined for condition '%s'", condition))
+}
+
+// executeNode runs the node according to its type. A panic of the node is returned as internal error.
+// Nodes with a timeout run on a copy of the session, which is discarded if the node does not finish in time, and
+// with services that stop working after the timeout.
+func executeNode(state *model.AuthenticationSession, node *model.GraphNode, def *model.NodeDefinition, inputs map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+
+	if node.Timeout == "" {
+		return processNode(state, node, def, inputs, services)
+	}
+
+	timeout, err := time.ParseDuration(node.Timeout)
+	if err != nil || timeout <= 0 {
+		return nil, model.NewInternalError(model.ErrorCodeInvalidConfig, fmt.Errorf("invalid timeout '%s' of node '%s'", node.Timeout, node.Name))
+	}
+
+	type outcome struct {
+		result *model.NodeResult
+		err    error
+	}
+
+	// The services of the node are canceled with the context, so a node that is still running after its timeout
+	// cannot change users, send messages or call external services anymore
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	working := cloneSession(state)
+	finished := make(chan outcome, 1)
+	go func() {
+		result, err := processNode(working, node, def, inputs, services.WithContext(ctx))
+		finished <- outcome{result: result, err: err}
+	}()
+
+	select {
+	case outcome := <-finished:
+		*state = *working
+		return outcome.result, outcome.err
+	case <-ctx.Done():
+		return nil, model.NewTransientError(model.ErrorCodeTimeout, fmt.Errorf("node '%s' did not finish within %s", node.Name, timeout))
+	}
+}
+
+func processNode(state *model.AuthenticationSession, node *model.GraphNode, def *model.NodeDefinition, inputs map[string]string, services *model.Repositories) (result *model.NodeResult, err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().Str("node", node.Name).Str("node_type", node.Use).Interface("panic", r).Str("stack", string(debug.Stack())).Msg("node panicked")
+			result, err = nil, model.NewInternalError(model.ErrorCodePanic, fmt.Errorf("node '%s' panicked: %v", node.Name, r))
 		}
+	}()
+
+	// Process node by type
+	switch def.Type {
+	case model.NodeTypeInit:
+		return ProcessInitTypeNode(state, node, def, inputs, services)
+
+	case model.NodeTypeLogic:
+		return ProcessLogicTypeNode(state, node, def, inputs, services)
 
-		// Clear prompts if no prompts are present
-		state.Prompts = nil
+	case model.NodeTypeQuery:
+		return ProcessQueryTypeNode(state, node, def, inputs, services)
 
-		// lookup transition in graph
-		if nextNodeName, ok := node.Next[condition]; ok {
-			state.Current = nextNodeName
+	case model.NodeTypeResult:
+		return ProcessResultTypeNode(state, node, def, inputs, services)
 
-			log.Debug().Str("node_name", node.Name).Str("condition", condition).Str("flow_id", state.FlowId).Msg("node transition")
-		} else {
+	case model.NodeTypeQueryWithLogic:
+		return ProcessQueryWithLogicTypeNode(state, node, def, inputs, services)
 
-			log.Debug().Str("node_name", node.Name).Str("condition", condition).Str("flow_id", state.FlowId).Msg("node transition")
+	default:
+		return nil, model.NewInternalError(model.ErrorCodeInvalidConfig, fmt.Errorf("unsupported node type: %s", def.Type))
+	}
+}
 
-			// If we have no next node defined we search for an failureResult node
-			// TODO we should log that
-			foundFailureResult := false
+// handleNodeError records the error on the session and moves the flow to the error transition of the node or
+// the on_error node of the flow. It returns false if the flow does not handle the error.
+func handleNodeError(flow *model.FlowDefinition, state *model.AuthenticationSession, node *model.GraphNode, err error) bool {
 
-			// Go through all nodes until we find one of type failureResult
-			for nodeName, node := range flow.Nodes {
-				if node.Use == "failureResult" {
+	nodeError := model.ClassifyError(err)
 
-					// Overwrite the current node with the failureResult node
-					state.Error = &[]string{"Invalid node transition"}[0]
-					state.Current = nodeName
-					state.CurrentType = model.NODE_ERROR
-					foundFailureResult = true
-					break
-				}
-			}
+	state.LastError = &model.FlowError{
+		Node:  node.Name,
+		Code:  nodeError.Code,
+		Class: nodeError.Class,
+		Time:  time.Now(),
+	}
+	if nodeError.Class == model.ErrorClassUser {
+		state.LastError.Message = nodeError.Message
+	}
 
-			if !foundFailureResult {
-				return nil, fmt.Errorf("no next node and no failureResult node defined for condition '%s'", condition)
-			}
+	target, ok := node.Next[NextError]
+	if !ok {
+		// An error of the on_error node itself is not handled again, the flow would loop otherwise
+		if flow.OnError == "" || flow.OnError == node.Name {
+			return false
 		}
+		target = flow.OnError
+	}
 
-		// Clear inputs as next node does not expect any inputs
-		inputs = nil
+	if _, exists := flow.Nodes[target]; !exists {
+		return false
+	}
+
+	log.Warn().
+		Err(err).
+		Str("node", node.Name).
+		Str("error_code", nodeError.Code).
+		Str("error_class", string(nodeError.Class)).
+		Str("flow_id", state.FlowId).
+		Str("next_node", target).
+		Msg("node error handled by the flow")
+
+	// The on_error node belongs to the main flow, so running subflows are left
+	if !ok && len(state.Subflows) > 0 {
+		state.Context = state.Subflows[0].Context
+		state.Subflows = nil
+	}
+
+	if state.LastError.Message != "" {
+		state.Error = &state.LastError.Message
+	}
 
-		// recursively call run with the new state
-		return Run(flow, state, inputs, services)
+	state.Prompts = nil
+	state.Steps = nil
+	state.History = append(state.History, fmt.Sprintf("%s:%s:%s", node.Name, NextError, nodeError.Code))
+	state.Current = target
+
+	return true
+}
+
+// cloneSession copies the parts of the session that nodes change, so that a node that is still running
+// after its timeout cannot change the session of the flow
+func cloneSession(state *model.AuthenticationSession) *model.AuthenticationSession {
+	cloned := *state
+	cloned.Context = maps.Clone(state.Context)
+	cloned.Prompts = maps.Clone(state.Prompts)
+	cloned.History = slices.Clone(state.History)
+	cloned.Subflows = slices.Clone(state.Subflows)
+
+	if state.User != nil {
+		user := *state.User
+		user.UserAttributes = nil
+		for _, attribute := range state.User.UserAttributes {
+			user.UserAttributes = append(user.UserAttributes, attribute.Clone())
+		}
+		cloned.User = &user
 	}
 
-	// throw an error if no condition or prompts are present
-	panic(fmt.Sprintf("node '%s' returned neither prompts nor condition", node.Name))
+	return &cloned
+}
+
+// CheckRequiredConfig returns an error if a required option of the config schema has no value
+func CheckRequiredConfig(node *model.GraphNode, def *model.NodeDefinition) error {
+	for _, option := range sortedOptionNames(def.ConfigSchema) {
+		schema := def.ConfigSchema[option]
+		if schema.Required && schema.Default == "" && node.CustomConfig[option] == "" {
+			return fmt.Errorf("node '%s' is missing the required config option '%s'", node.Name, option)
+		}
+	}
+	return nil
 }
 
 // ProcessQueryTypeNode processes a query node
@@ -296,8 +488,8 @@ func ProcessLogicTypeNode(state *model.AuthenticationSession, node *model.GraphN
 		return nil, err
 	}
 	// Check if result is valid
-	if result.Condition == "" {
-		return nil, fmt.Errorf("logic node '%s' must return a condition", node.Name)
+	if result == nil || result.Condition == "" {
+		return nil, model.NewInternalError(model.ErrorCodeInvalidResult, fmt.Errorf("logic node '%s' must return a condition", node.Name))
 	}
 
 	return result, nil
@@ -315,7 +507,9 @@ func ProcessQueryWithLogicTypeNode(state *model.AuthenticationSession, node *mod
 	}
 
 	// check if the result is a prompt or a condition
-	if result.Prompts != nil {
+	if result == nil {
+		return nil, model.NewInternalError(model.ErrorCodeInvalidResult, fmt.Errorf("query node '%s' must return a prompt or a condition", node.Name))
+	} else if result.Prompts != nil {
 
 		return result, nil
 	} else if result.Condition != "" {
@@ -324,5 +518,5 @@ func ProcessQueryWithLogicTypeNode(state *model.AuthenticationSession, node *mod
 	}
 
 	// if no result is returned, return an error
-	return nil, fmt.Errorf("query node '%s' must return a prompt or a condition", node.Name)
+	return nil, model.NewInternalError(model.ErrorCodeInvalidResult, fmt.Errorf("query node '%s' must return a prompt or a condition", node.Name))
 }
@@ -1,7 +1,9 @@
 package graph
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/Identityplane/GoAM/internal/auth/repository"
 	"github.com/Identityplane/GoAM/internal/lib"
@@ -9,6 +11,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRun_SimpleFlow(t *testing.T) {
@@ -87,3 +90,295 @@ func TestRun_SimpleFlow(t *testing.T) {
 	// Verify that the mock expectations were met
 	mockUserRepo.AssertExpectations(t)
 }
+
+func TestRun_DefaultTransition(t *testing.T) {
+	flow := &model.FlowDefinition{
+		Description: "default_transition",
+		Start:       "init",
+		Nodes: map[string]*model.GraphNode{
+			"init": {
+				Name: "init",
+				Use:  "init",
+				Next: map[string]string{
+					NextDefault: "askUsername",
+				},
+			},
+			"askUsername": {
+				Name: "askUsername",
+				Use:  "askUsername",
+				Next: map[string]string{
+					"submitted": "askUsername",
+				},
+			},
+		},
+	}
+
+	state := InitFlow(flow)
+	result, err := Run(flow, state, nil, &model.Repositories{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "askUsername", result.Current)
+	assert.Contains(t, result.History, "init:start")
+}
+
+func TestRun_WipesSensitiveContext(t *testing.T) {
+
+	// Setup mock repositories with a user named "alice"
+	mockUserRepo := repository.NewMockUserRepository()
+	mockRepos := &model.Repositories{
+		UserRepo: mockUserRepo,
+	}
+
+	hash, err := lib.HashPassword("correct-password")
+	assert.NoError(t, err)
+
+	testUser := &model.User{
+		ID:     "test-user-123",
+		Tenant: "acme",
+		Realm:  "customers",
+		Status: "active",
+	}
+	testUser.AddAttribute(&model.UserAttribute{
+		Type:  model.AttributeTypeUsername,
+		Index: lib.StringPtr("alice"),
+		Value: model.UsernameAttributeValue{PreferredUsername: "alice"},
+	})
+	testUser.AddAttribute(&model.UserAttribute{
+		Type:  model.AttributeTypePassword,
+		Value: model.PasswordAttributeValue{PasswordHash: hash},
+	})
+	mockUserRepo.On("GetByAttributeIndex", mock.Anything, model.AttributeTypeUsername, "alice").Return(testUser, nil)
+	mockUserRepo.On("UpdateUserAttribute", mock.Anything, mock.Anything).Return(nil)
+
+	flow := &model.FlowDefinition{
+		Description: "password_flow",
+		Start:       "init",
+		Nodes: map[string]*model.GraphNode{
+			"init": {
+				Name: "init",
+				Use:  "init",
+				Next: map[string]string{
+					"start": "askUsernamePassword",
+				},
+			},
+			"askUsernamePassword": {
+				Name: "askUsernamePassword",
+				Use:  "askUsernamePassword",
+				Next: map[string]string{
+					"submitted": "validatePassword",
+				},
+			},
+			"validatePassword": {
+				Name: "validatePassword",
+				Use:  "validatePassword",
+				Next: map[string]string{
+					"success": "done",
+					"fail":    "askUsernamePassword",
+				},
+			},
+			"done": {
+				Name: "done",
+				Use:  "successResult",
+			},
+		},
+	}
+
+	state := InitFlow(flow)
+	_, err = Run(flow, state, nil, mockRepos)
+	assert.NoError(t, err)
+
+	// A wrong password is wiped as well
+	result, err := Run(flow, state, map[string]string{"username": "alice", "password": "wrong-password"}, mockRepos)
+	assert.NoError(t, err)
+	assert.Equal(t, "askUsernamePassword", result.Current)
+	assert.NotContains(t, result.Context, "password")
+	assert.Equal(t, "alice", result.Context["username"])
+
+	result, err = Run(flow, state, map[string]string{"username": "alice", "password": "correct-password"}, mockRepos)
+	assert.NoError(t, err)
+	assert.NotNil(t, result.Result)
+	assert.NotContains(t, result.Context, "password")
+}
+
+// unreliableNode fails in the way that is configured in its mode
+var unreliableNode = &model.NodeDefinition{
+	Name:                 "unreliable",
+	Type:                 model.NodeTypeLogic,
+	PossibleResultStates: []string{"done"},
+	ConfigSchema: map[string]model.ConfigOption{
+		"mode": {Type: model.ConfigOptionEnum, Values: []string{"ok", "panic", "error", "user_error", "slow", "slow_email", "nothing"}, Default: "ok"},
+	},
+	Run: func(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+		switch node.CustomConfig["mode"] {
+		case "panic":
+			var user *model.User
+			_ = user.ID
+		case "error":
+			return nil, errors.New("connection refused")
+		case "user_error":
+			return nil, model.NewUserError("account_locked", "Your account is locked")
+		case "slow":
+			time.Sleep(200 * time.Millisecond)
+			state.Context["slow"] = "done"
+		case "slow_email":
+			time.Sleep(200 * time.Millisecond)
+			if err := services.EmailSender.SendEmail(&model.SendEmailParams{Template: "notification"}); err != nil {
+				return nil, err
+			}
+		case "nothing":
+			return &model.NodeResult{}, nil
+		}
+		return &model.NodeResult{Condition: "done"}, nil
+	},
+}
+
+func registerUnreliableNode(t *testing.T) {
+	require.NoError(t, RegisterNodeDefinition(unreliableNode, nil))
+	t.Cleanup(func() { UnregisterNodeDefinition(unreliableNode.Name) })
+}
+
+// newErrorTestFlow returns a flow that runs the unreliable node with the mode and ends in the failureResult node "end"
+func newErrorTestFlow(t *testing.T, mode string) *model.FlowDefinition {
+	registerUnreliableNode(t)
+
+	return &model.FlowDefinition{
+		Start: "init",
+		Nodes: map[string]*model.GraphNode{
+			"init":    {Name: "init", Use: "init", Next: map[string]string{"start": "call"}},
+			"call":    {Name: "call", Use: "unreliable", Next: map[string]string{"done": "end"}, CustomConfig: map[string]string{"mode": mode}},
+			"end":     {Name: "end", Use: "failureResult"},
+			"handler": {Name: "handler", Use: "failureResult"},
+		},
+	}
+}
+
+func TestRun_NodeErrorWithoutHandler(t *testing.T) {
+	tests := []struct {
+		mode string
+		code string
+	}{
+		{"panic", model.ErrorCodePanic},
+		{"nothing", model.ErrorCodeInvalidResult},
+		{"error", model.ErrorCodeInternal},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			flow := newErrorTestFlow(t, test.mode)
+
+			state, err := Run(flow, InitFlow(flow), nil, &model.Repositories{})
+			require.Error(t, err)
+			require.NotNil(t, state)
+			assert.Equal(t, "call", state.Current)
+			require.NotNil(t, state.LastError)
+			assert.Equal(t, "call", state.LastError.Node)
+			assert.Equal(t, test.code, state.LastError.Code)
+			assert.Equal(t, model.ErrorClassInternal, state.LastError.Class)
+			assert.Empty(t, state.LastError.Message)
+		})
+	}
+}
+
+func TestRun_ErrorTransition(t *testing.T) {
+	flow := newErrorTestFlow(t, "panic")
+	flow.Nodes["call"].Next[NextError] = "handler"
+
+	state, err := Run(flow, InitFlow(flow), nil, &model.Repositories{})
+	require.NoError(t, err)
+	assert.Equal(t, "handler", state.Current)
+	assert.Contains(t, state.History, "call:error:panic")
+	assert.Equal(t, model.ErrorCodePanic, state.LastError.Code)
+
+	// Internal details are not shown to the user
+	assert.Nil(t, state.Error)
+}
+
+func TestRun_OnError(t *testing.T) {
+	flow := newErrorTestFlow(t, "user_error")
+	flow.OnError = "handler"
+
+	state, err := Run(flow, InitFlow(flow), nil, &model.Repositories{})
+	require.NoError(t, err)
+	assert.Equal(t, "handler", state.Current)
+	assert.Equal(t, model.ErrorClassUser, state.LastError.Class)
+	assert.Equal(t, "account_locked", state.LastError.Code)
+	require.NotNil(t, state.Error)
+	assert.Equal(t, "Your account is locked", *state.Error)
+
+	// The error transition of the node takes precedence
+	flow.Nodes["call"].Next[NextError] = "end"
+	state, err = Run(flow, InitFlow(flow), nil, &model.Repositories{})
+	require.NoError(t, err)
+	assert.Equal(t, "end", state.Current)
+}
+
+func TestRun_NodeTimeout(t *testing.T) {
+	flow := newErrorTestFlow(t, "slow")
+	flow.Nodes["call"].Timeout = "20ms"
+	flow.Nodes["call"].Next[NextError] = "handler"
+
+	state, err := Run(flow, InitFlow(flow), nil, &model.Repositories{})
+	require.NoError(t, err)
+	assert.Equal(t, "handler", state.Current)
+	assert.Equal(t, model.ErrorCodeTimeout, state.LastError.Code)
+	assert.Equal(t, model.ErrorClassTransient, state.LastError.Class)
+
+	// The node keeps running but cannot change the session anymore
+	time.Sleep(250 * time.Millisecond)
+	assert.NotContains(t, state.Context, "slow")
+
+	// A node that finishes in time changes the session
+	flow.Nodes["call"].Timeout = "1s"
+	state, err = Run(flow, InitFlow(flow), nil, &model.Repositories{})
+	require.NoError(t, err)
+	assert.Equal(t, "end", state.Current)
+	assert.Equal(t, "done", state.Context["slow"])
+}
+
+func TestRun_NodeTimeoutCancelsServices(t *testing.T) {
+	flow := newErrorTestFlow(t, "slow_email")
+	flow.Nodes["call"].Timeout = "20ms"
+	flow.Nodes["call"].Next[NextError] = "handler"
+
+	emailSender := repository.NewMockEmailSender()
+	state, err := Run(flow, InitFlow(flow), nil, &model.Repositories{EmailSender: emailSender})
+	require.NoError(t, err)
+	assert.Equal(t, "handler", state.Current)
+
+	// The node keeps running but its services stopped working with the timeout
+	time.Sleep(250 * time.Millisecond)
+	emailSender.AssertNotCalled(t, "SendEmail", mock.Anything)
+}
+
+func TestCloneSession_CopiesUserAttributes(t *testing.T) {
+	state := &model.AuthenticationSession{
+		Context: map[string]string{},
+		User: &model.User{
+			UserAttributes: []*model.UserAttribute{
+				{ID: "1", Type: model.AttributeTypeRecoveryCodes, Value: &model.RecoveryCodesAttributeValue{Codes: []model.RecoveryCode{{Hash: "a"}}}},
+			},
+		},
+	}
+
+	cloned := cloneSession(state)
+	cloned.User.UserAttributes[0].Value.(*model.RecoveryCodesAttributeValue).Codes[0].Hash = "changed"
+	cloned.User.UserAttributes[0].Type = "changed"
+
+	assert.Equal(t, "a", state.User.UserAttributes[0].Value.(*model.RecoveryCodesAttributeValue).Codes[0].Hash)
+	assert.Equal(t, model.AttributeTypeRecoveryCodes, state.User.UserAttributes[0].Type)
+}
+
+func TestRun_StepLimit(t *testing.T) {
+	flow := &model.FlowDefinition{
+		Start: "init",
+		Nodes: map[string]*model.GraphNode{
+			"init": {Name: "init", Use: "init", Next: map[string]string{"start": "ping"}},
+			"ping": {Name: "ping", Use: "setVariable", Next: map[string]string{"done": "pong"}, CustomConfig: map[string]string{"key": "ball", "value": "ping"}},
+			"pong": {Name: "pong", Use: "setVariable", Next: map[string]string{"done": "ping"}, CustomConfig: map[string]string{"key": "ball", "value": "pong"}},
+		},
+	}
+
+	state, err := Run(flow, InitFlow(flow), nil, &model.Repositories{})
+	assert.ErrorContains(t, err, "step limit")
+	require.NotNil(t, state)
+}
@@ -1,44 +1,536 @@
 package graph
 
 import (
-	"errors"
 	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_system"
 	"github.com/Identityplane/GoAM/pkg/model"
 )
 
-// ValidateFlowDefinition checks for basic structural integrity of the flow
+// NextDefault is the key of a node's Next map that is used for all result states without an explicit transition
+const NextDefault = "default"
+
+// NextError is the key of a node's Next map that is used when the node fails
+const NextError = "error"
+
+// FlowIssueSeverity describes whether a flow with the issue can be executed
+type FlowIssueSeverity string
+
+const (
+	// FlowIssueError marks a flow that is broken and must not be saved
+	FlowIssueError FlowIssueSeverity = "error"
+	// FlowIssueWarning marks a flow that runs but likely does not behave as intended
+	FlowIssueWarning FlowIssueSeverity = "warning"
+)
+
+// FlowIssue is a single finding of the flow validation.
+// Node, Field and Key point to the location in the flow definition, e.g. the node "askPassword",
+// the field "next" and the key "submitted". Node is empty for issues that concern the flow as a whole.
+type FlowIssue struct {
+	Node     string
+	Field    string
+	Key      string
+	Message  string
+	Severity FlowIssueSeverity
+	Strict   bool // the error is only enforced in strict mode, flows that were valid before the lint checks still load
+}
+
+func (i FlowIssue) Error() string {
+	return i.Message
+}
+
+// IsError reports whether the issue makes the flow invalid. Errors of the lint checks are only enforced in strict
+// mode, otherwise they are reported as warnings so that existing flows keep loading.
+func (i FlowIssue) IsError(strict bool) bool {
+	return i.Severity == FlowIssueError && (strict || !i.Strict)
+}
+
+// ValidateFlowDefinition checks the flow for the structural errors that make it impossible to run and returns the
+// first one. Errors of the lint checks are not enforced, use ValidateFlowDefinitionStrict for them.
 func ValidateFlowDefinition(def *model.FlowDefinition) error {
+	return validateFlowDefinition(def, false)
+}
 
-	// Check if start node is in map
-	_, ok := def.Nodes[def.Start]
-	if !ok {
-		return fmt.Errorf("start node '%s' not found in nodes", def.Start)
+// ValidateFlowDefinitionStrict checks the flow for all errors including those of the lint checks and returns the first one
+func ValidateFlowDefinitionStrict(def *model.FlowDefinition) error {
+	return validateFlowDefinition(def, true)
+}
+
+func validateFlowDefinition(def *model.FlowDefinition, strict bool) error {
+	for _, issue := range LintFlowDefinition(def) {
+		if issue.IsError(strict) {
+			return issue
+		}
 	}
+	return nil
+}
+
+// LintFlowDefinition runs a static analysis of the flow graph and returns all errors and warnings found.
+// Issues are ordered by node name so the result is stable between runs.
+func LintFlowDefinition(def *model.FlowDefinition) []FlowIssue {
+	l := &flowLinter{def: def}
 
-	// Check start node is of type 'init'
-	if def.Start == "" {
-		return errors.New("flow start node is not defined")
+	if def == nil {
+		l.addError("", "", "", "flow definition is empty")
+		return l.issues
 	}
-	if def.Nodes[def.Start] == nil {
-		return fmt.Errorf("start node '%s' is missing from the graph", def.Start)
+
+	l.checkStart()
+	l.checkOnError()
+
+	for _, name := range sortedNodeNames(def.Nodes) {
+		l.checkNode(name, def.Nodes[name])
 	}
-	if nodeDef := def.Nodes[def.Start]; nodeDef.Use != "init" {
-		return fmt.Errorf("start node '%s' must be of type 'init'", def.Start)
+
+	// The graph checks need a valid start node and targets that exist
+	if l.hasErrors() {
+		return l.issues
 	}
 
-	// Check non-terminal nodes have a Next map
-	for name, node := range def.Nodes {
-		nodeType := model.NodeTypeInit
-		if def := GetNodeDefinitionByName(node.Use); def != nil {
-			nodeType = def.Type
-		} else if node.Use == "successResult" || node.Use == "failureResult" {
-			nodeType = model.NodeTypeResult
+	l.checkReachability()
+	l.checkCycles()
+	l.checkRequiredContext()
+
+	return l.issues
+}
+
+type flowLinter struct {
+	def    *model.FlowDefinition
+	issues []FlowIssue
+}
+
+func (l *flowLinter) addError(node, field, key, format string, args ...interface{}) {
+	l.issues = append(l.issues, FlowIssue{Node: node, Field: field, Key: key, Message: fmt.Sprintf(format, args...), Severity: FlowIssueError})
+}
+
+// addStrictError adds an error of the lint checks, which is only enforced in strict mode
+func (l *flowLinter) addStrictError(node, field, key, format string, args ...interface{}) {
+	l.issues = append(l.issues, FlowIssue{Node: node, Field: field, Key: key, Message: fmt.Sprintf(format, args...), Severity: FlowIssueError, Strict: true})
+}
+
+func (l *flowLinter) addWarning(node, field, key, format string, args ...interface{}) {
+	l.issues = append(l.issues, FlowIssue{Node: node, Field: field, Key: key, Message: fmt.Sprintf(format, args...), Severity: FlowIssueWarning})
+}
+
+func (l *flowLinter) hasErrors() bool {
+	for _, issue := range l.issues {
+		if issue.Severity == FlowIssueError {
+			return true
 		}
+	}
+	return false
+}
+
+func (l *flowLinter) checkStart() {
+	start, ok := l.def.Nodes[l.def.Start]
+	if !ok || start == nil {
+		l.addError("", "start", "", "start node '%s' not found in nodes", l.def.Start)
+		return
+	}
+
+	if start.Use != "init" {
+		l.addError(l.def.Start, "use", "", "start node '%s' must be of type 'init'", l.def.Start)
+	}
+}
+
+// checkOnError checks the node that handles the errors of nodes without an error transition
+func (l *flowLinter) checkOnError() {
+	if l.def.OnError == "" {
+		return
+	}
+
+	if _, ok := l.def.Nodes[l.def.OnError]; !ok {
+		l.addStrictError("", "on_error", "", "on_error node '%s' not found in nodes", l.def.OnError)
+	}
+}
+
+func (l *flowLinter) checkNode(name string, node *model.GraphNode) {
+	if node == nil {
+		l.addError(name, "", "", "node '%s' is empty", name)
+		return
+	}
 
-		if nodeType != model.NodeTypeResult && node.Next == nil {
-			return fmt.Errorf("node '%s' must define a 'Next' map", name)
+	nodeDef := GetNodeDefinitionByName(node.Use)
+	if nodeDef == nil {
+		l.addStrictError(name, "use", "", "node '%s' uses unknown node type '%s'", name, node.Use)
+		return
+	}
+
+	// Unknown config options are most likely typos, the node would silently run with its defaults
+	for _, key := range sortedKeys(node.CustomConfig) {
+		if !isKnownConfigOption(nodeDef, node, key) {
+			l.addStrictError(name, "custom_config", key, "node '%s' has unknown custom_config option '%s'%s", name, key, optionsHint(nodeDef.ConfigOptionNames()))
 		}
 	}
-	return nil
+
+	l.checkConfigSchema(name, node, nodeDef)
+
+	if node.Timeout != "" {
+		if timeout, err := time.ParseDuration(node.Timeout); err != nil || timeout <= 0 {
+			l.addStrictError(name, "timeout", "", "node '%s' has an invalid timeout '%s', expected a duration like '5s'", name, node.Timeout)
+		}
+	}
+
+	if nodeDef.ValidateConfig != nil {
+		if err := nodeDef.ValidateConfig(node); err != nil {
+			l.addStrictError(name, "custom_config", "", "node '%s' has an invalid configuration: %v", name, err)
+		}
+	}
+
+	if nodeDef.Type == model.NodeTypeResult {
+		// Result nodes can fail too, e.g. when the user cannot be stored, so only the error transition is used
+		ignored := len(node.Next)
+		if target, ok := node.Next[NextError]; ok {
+			l.checkTarget(name, NextError, target)
+			ignored--
+		}
+		if ignored > 0 {
+			l.addWarning(name, "next", "", "result node '%s' ends the flow, its 'next' transitions are ignored", name)
+		}
+		return
+	}
+
+	if node.Next == nil {
+		l.addError(name, "", "", "node '%s' must define a 'Next' map", name)
+		return
+	}
+
+	resultStates := nodeDef.ResultStatesFor(node)
+
+	for _, state := range node.Reversible {
+		if !contains(resultStates, state) {
+			l.addStrictError(name, "reversible", state, "node '%s' declares '%s' as reversible but '%s' never returns it%s", name, state, node.Use, optionsHint(resultStates))
+		}
+	}
+
+	for _, state := range sortedKeys(node.Next) {
+		if state != NextDefault && state != NextError && !contains(resultStates, state) {
+			l.addStrictError(name, "next", state, "node '%s' has a transition for '%s' but '%s' never returns it%s", name, state, node.Use, optionsHint(resultStates))
+		}
+
+		l.checkTarget(name, state, node.Next[state])
+	}
+
+	// Result states without a transition fall back to the failureResult node at runtime, if there is one
+	if _, ok := node.Next[NextDefault]; ok {
+		return
+	}
+	hasFailureResult := l.hasFailureResultNode()
+	for _, state := range resultStates {
+		if _, ok := node.Next[state]; ok {
+			continue
+		}
+		if hasFailureResult {
+			l.addWarning(name, "next", "", "result state '%s' of node '%s' is not wired and ends in the failureResult node", state, name)
+		} else {
+			l.addStrictError(name, "next", "", "result state '%s' of node '%s' is not wired and the flow has no failureResult node", state, name)
+		}
+	}
+}
+
+func (l *flowLinter) checkTarget(name, state, target string) {
+	if _, ok := l.def.Nodes[target]; !ok {
+		l.addStrictError(name, "next", state, "transition '%s' of node '%s' points to unknown node '%s'", state, name, target)
+	}
+}
+
+// templateConfigOptions are rendered by the shared page components for every node
+var templateConfigOptions = map[string]string{
+	"title":   "Title of the page",
+	"message": "Message shown on the page",
+	"footer":  "Footer of the page",
+}
+
+// isKnownConfigOption checks if the key is a config option of the node, with or without the node's config prefix
+func isKnownConfigOption(nodeDef *model.NodeDefinition, node *model.GraphNode, key string) bool {
+	if _, ok := templateConfigOptions[key]; ok {
+		return true
+	}
+	if nodeDef.HasConfigOption(key) {
+		return true
+	}
+	if option, ok := strings.CutPrefix(key, node.ConfigPrefix); ok && node.ConfigPrefix != "" {
+		return nodeDef.HasConfigOption(option)
+	}
+	return false
+}
+
+// checkConfigSchema checks the values of the typed config options. Required options may have a default,
+// secret options are expected in the realm or server settings and are only checked when the flow is executed.
+func (l *flowLinter) checkConfigSchema(name string, node *model.GraphNode, nodeDef *model.NodeDefinition) {
+	for _, option := range sortedOptionNames(nodeDef.ConfigSchema) {
+		schema := nodeDef.ConfigSchema[option]
+		key, value := configValue(node, option)
+
+		if value == "" {
+			if schema.Required && schema.Default == "" && !schema.Secret {
+				l.addStrictError(name, "custom_config", option, "node '%s' requires the custom_config option '%s'", name, option)
+			}
+			continue
+		}
+
+		if err := schema.ValidateValue(value); err != nil {
+			l.addStrictError(name, "custom_config", key, "custom_config option '%s' of node '%s' is invalid: %v", key, name, err)
+		}
+		if schema.Secret {
+			l.addWarning(name, "custom_config", key, "custom_config option '%s' of node '%s' is a secret and should be set in the realm or server settings instead of the flow", key, name)
+		}
+	}
+}
+
+// configValue returns the key and the value of a config option in the flow, nodes with a config prefix
+// read the prefixed key when the flow is executed
+func configValue(node *model.GraphNode, option string) (string, string) {
+	key := node.ConfigPrefix + option
+	return key, node.CustomConfig[key]
+}
+
+func (l *flowLinter) hasFailureResultNode() bool {
+	for _, node := range l.def.Nodes {
+		if node != nil && node.Use == "failureResult" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReachability warns about nodes that can never be reached from the start node or the on_error node
+func (l *flowLinter) checkReachability() {
+	reachable := l.reachableFrom(l.def.Start)
+	if l.def.OnError != "" {
+		maps.Copy(reachable, l.reachableFrom(l.def.OnError))
+	}
+
+	for _, name := range sortedNodeNames(l.def.Nodes) {
+		if !reachable[name] {
+			l.addWarning(name, "", "", "node '%s' is not reachable from the start node", name)
+		}
+	}
+}
+
+func (l *flowLinter) reachableFrom(start string) map[string]bool {
+	reachable := map[string]bool{start: true}
+	queue := []string{start}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, target := range l.def.Nodes[current].Next {
+			if !reachable[target] {
+				reachable[target] = true
+				queue = append(queue, target)
+			}
+		}
+	}
+
+	return reachable
+}
+
+// checkCycles finds loops that never ask the user for input. Such a loop runs until the history limit is reached.
+func (l *flowLinter) checkCycles() {
+	for _, component := range l.stronglyConnectedComponents() {
+
+		// A single node is only a cycle if it points to itself
+		if len(component) == 1 && !l.pointsTo(component[0], component[0]) {
+			continue
+		}
+
+		interactive := false
+		for _, name := range component {
+			nodeType := GetNodeDefinitionByName(l.def.Nodes[name].Use).Type
+			if nodeType == model.NodeTypeQuery || nodeType == model.NodeTypeQueryWithLogic {
+				interactive = true
+				break
+			}
+		}
+
+		if !interactive {
+			sort.Strings(component)
+			l.addStrictError(component[0], "next", "", "nodes %s form a cycle without any user interaction", quoteAll(component))
+		}
+	}
+}
+
+func (l *flowLinter) pointsTo(from, to string) bool {
+	for _, target := range l.def.Nodes[from].Next {
+		if target == to {
+			return true
+		}
+	}
+	return false
+}
+
+// stronglyConnectedComponents returns the strongly connected components of the flow graph using Tarjan's algorithm
+func (l *flowLinter) stronglyConnectedComponents() [][]string {
+	index := map[string]int{}
+	lowLink := map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	var components [][]string
+
+	var visit func(name string)
+	visit = func(name string) {
+		index[name] = len(index)
+		lowLink[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+
+		for _, state := range sortedKeys(l.def.Nodes[name].Next) {
+			target := l.def.Nodes[name].Next[state]
+			if _, visited := index[target]; !visited {
+				visit(target)
+				lowLink[name] = min(lowLink[name], lowLink[target])
+			} else if onStack[target] {
+				lowLink[name] = min(lowLink[name], index[target])
+			}
+		}
+
+		if lowLink[name] == index[name] {
+			var component []string
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == name {
+					break
+				}
+			}
+			components = append(components, component)
+		}
+	}
+
+	for _, name := range sortedNodeNames(l.def.Nodes) {
+		if _, visited := index[name]; !visited {
+			visit(name)
+		}
+	}
+
+	return components
+}
+
+// checkRequiredContext warns if a node requires context that no node before it can produce.
+// The node metadata does not say whether a value is optional, so this is only a warning.
+func (l *flowLinter) checkRequiredContext() {
+	predecessors := map[string][]string{}
+	for name, node := range l.def.Nodes {
+		for _, target := range node.Next {
+			predecessors[target] = append(predecessors[target], name)
+		}
+	}
+
+	for _, name := range sortedNodeNames(l.def.Nodes) {
+		nodeDef := GetNodeDefinitionByName(l.def.Nodes[name].Use)
+
+		available := map[string]bool{}
+		for upstream := range l.upstreamOf(name, predecessors) {
+			for _, key := range producedContext(l.def.Nodes[upstream]) {
+				available[key] = true
+			}
+		}
+
+		for _, key := range nodeDef.RequiredContext {
+			if key == "" || sessionUserContext[key] {
+				continue
+			}
+			if !available[key] {
+				l.addWarning(name, "use", "", "node '%s' requires '%s' in the context but no node before it sets it", name, key)
+			}
+		}
+	}
+}
+
+// sessionUserContext are requirements on the user of the session. Many nodes load the user as a side effect
+// without declaring it, so they cannot be checked statically.
+var sessionUserContext = map[string]bool{
+	"user":    true,
+	"user_id": true,
+}
+
+// upstreamOf returns all nodes from which the given node can be reached
+func (l *flowLinter) upstreamOf(name string, predecessors map[string][]string) map[string]bool {
+	upstream := map[string]bool{}
+	queue := append([]string{}, predecessors[name]...)
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if upstream[current] {
+			continue
+		}
+		upstream[current] = true
+		queue = append(queue, predecessors[current]...)
+	}
+
+	return upstream
+}
+
+// producedContext returns the context keys a node can set, including the answers to its prompts
+func producedContext(node *model.GraphNode) []string {
+	nodeDef := GetNodeDefinitionByName(node.Use)
+
+	keys := append([]string{}, nodeDef.OutputContext...)
+	for prompt := range nodeDef.PossiblePrompts {
+		keys = append(keys, prompt)
+	}
+
+	// setVariable writes the configured key
+	if key, ok := node.CustomConfig["key"]; ok && node.Use == "setVariable" {
+		keys = append(keys, key)
+	}
+
+	// subflow copies the mapped outputs of the child flow
+	if node.Use == node_system.SubflowNode.Name {
+		keys = append(keys, node_system.SubflowOutputKeys(node)...)
+	}
+
+	return keys
+}
+
+func sortedNodeNames(nodes map[string]*model.GraphNode) []string {
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + v + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func optionsHint(options []string) string {
+	if len(options) == 0 {
+		return ", it has none"
+	}
+	return ", expected one of " + quoteAll(options)
 }
@@ -1,11 +1,13 @@
 package graph
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/Identityplane/GoAM/pkg/model"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestEngine_ValidMinimalFlow(t *testing.T) {
@@ -91,3 +93,221 @@ func TestEngine_MissingNextOnLogicNode(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "must define a 'Next' map")
 }
+
+func TestLint_StrictErrorsAreOnlyEnforcedInStrictMode(t *testing.T) {
+	flow := lintFlow("createUser", map[string]*model.GraphNode{
+		"createUser": {Name: "createUser", Use: "createUser", Next: map[string]string{"fail": "missing", "success": "end"}},
+		"end":        {Name: "end", Use: "successResult"},
+	})
+
+	// Flows that were valid before the lint checks still load
+	assert.NoError(t, ValidateFlowDefinition(flow))
+	assert.Error(t, ValidateFlowDefinitionStrict(flow))
+
+	issue := findIssue(LintFlowDefinition(flow), "createUser", "never returns it")
+	require.NotNil(t, issue)
+	assert.True(t, issue.Strict)
+	assert.False(t, issue.IsError(false))
+	assert.True(t, issue.IsError(true))
+}
+
+// lintFlow builds a flow with an init node that starts at the given node
+func lintFlow(start string, nodes map[string]*model.GraphNode) *model.FlowDefinition {
+	nodes["init"] = &model.GraphNode{Name: "init", Use: "init", Next: map[string]string{"start": start}}
+	return &model.FlowDefinition{Start: "init", Nodes: nodes}
+}
+
+func findIssue(issues []FlowIssue, node string, messagePart string) *FlowIssue {
+	for i := range issues {
+		if issues[i].Node == node && strings.Contains(issues[i].Message, messagePart) {
+			return &issues[i]
+		}
+	}
+	return nil
+}
+
+func TestLint_UnknownResultStateAndTarget(t *testing.T) {
+	flow := lintFlow("askUsername", map[string]*model.GraphNode{
+		"askUsername": {Name: "askUsername", Use: "askUsername", Next: map[string]string{"submitted": "missing", "success": "end"}},
+		"end":         {Name: "end", Use: "successResult"},
+	})
+
+	issues := LintFlowDefinition(flow)
+
+	issue := findIssue(issues, "askUsername", "never returns it")
+	require.NotNil(t, issue)
+	assert.Equal(t, FlowIssueError, issue.Severity)
+	assert.Equal(t, "next", issue.Field)
+	assert.Equal(t, "success", issue.Key)
+
+	issue = findIssue(issues, "askUsername", "unknown node 'missing'")
+	require.NotNil(t, issue)
+	assert.Equal(t, "submitted", issue.Key)
+}
+
+func TestLint_UnwiredResultStates(t *testing.T) {
+	nodes := map[string]*model.GraphNode{
+		"checkUsername": {Name: "checkUsername", Use: "checkUsernameAvailable", Next: map[string]string{"available": "end"}},
+		"end":           {Name: "end", Use: "successResult"},
+	}
+
+	// Without a failureResult node the flow fails at runtime
+	issue := findIssue(LintFlowDefinition(lintFlow("checkUsername", nodes)), "checkUsername", "'taken'")
+	require.NotNil(t, issue)
+	assert.Equal(t, FlowIssueError, issue.Severity)
+
+	// With a failureResult node the state ends there
+	nodes["failed"] = &model.GraphNode{Name: "failed", Use: "failureResult"}
+	issue = findIssue(LintFlowDefinition(lintFlow("checkUsername", nodes)), "checkUsername", "'taken'")
+	require.NotNil(t, issue)
+	assert.Equal(t, FlowIssueWarning, issue.Severity)
+
+	// An explicit default covers all states
+	nodes["checkUsername"].Next[NextDefault] = "failed"
+	assert.Nil(t, findIssue(LintFlowDefinition(lintFlow("checkUsername", nodes)), "checkUsername", "'taken'"))
+}
+
+func TestLint_ErrorHandling(t *testing.T) {
+	nodes := map[string]*model.GraphNode{
+		"askUsername": {Name: "askUsername", Use: "askUsername", Next: map[string]string{"submitted": "end", NextError: "failed"}, Timeout: "5s"},
+		"end":         {Name: "end", Use: "successResult", Next: map[string]string{NextError: "failed"}},
+		"failed":      {Name: "failed", Use: "failureResult"},
+		"onError":     {Name: "onError", Use: "failureResult"},
+	}
+	flow := lintFlow("askUsername", nodes)
+	flow.OnError = "onError"
+
+	// Error transitions are allowed on all nodes and the on_error node is reachable
+	assert.Empty(t, LintFlowDefinition(flow))
+
+	nodes["askUsername"].Timeout = "5 seconds"
+	nodes["end"].Next[NextError] = "unknown"
+	flow.OnError = "missing"
+	issues := LintFlowDefinition(flow)
+	assert.NotNil(t, findIssue(issues, "askUsername", "invalid timeout '5 seconds'"))
+	assert.NotNil(t, findIssue(issues, "end", "points to unknown node 'unknown'"))
+	assert.NotNil(t, findIssue(issues, "", "on_error node 'missing' not found"))
+}
+
+func TestLint_UnknownUseAndCustomConfig(t *testing.T) {
+	flow := lintFlow("askUsername", map[string]*model.GraphNode{
+		"askUsername": {
+			Name:         "askUsername",
+			Use:          "askUsername",
+			Next:         map[string]string{"submitted": "telegram"},
+			CustomConfig: map[string]string{"title": "Welcome", "showRegisterLink": "true", "titel": "typo"},
+		},
+		"telegram": {
+			Name:         "telegram",
+			Use:          "telegramLogin",
+			ConfigPrefix: "tg_",
+			Next:         map[string]string{"existing-user": "end", "new-user": "end", "failure": "unknown"},
+			CustomConfig: map[string]string{"tg_telegram_bottoken": "token"},
+		},
+		"unknown": {Name: "unknown", Use: "doesNotExist", Next: map[string]string{}},
+		"end":     {Name: "end", Use: "successResult"},
+	})
+
+	issues := LintFlowDefinition(flow)
+
+	issue := findIssue(issues, "askUsername", "custom_config option")
+	require.NotNil(t, issue)
+	assert.Equal(t, "titel", issue.Key)
+	assert.Nil(t, findIssue(issues, "telegram", "custom_config option"))
+
+	issue = findIssue(issues, "unknown", "unknown node type 'doesNotExist'")
+	require.NotNil(t, issue)
+	assert.Equal(t, FlowIssueError, issue.Severity)
+	assert.Equal(t, "use", issue.Field)
+}
+
+func TestLint_UnreachableNodesAndMissingContext(t *testing.T) {
+	flow := lintFlow("checkUsername", map[string]*model.GraphNode{
+		"checkUsername": {Name: "checkUsername", Use: "checkUsernameAvailable", Next: map[string]string{"available": "end", "taken": "end"}},
+		"askUsername":   {Name: "askUsername", Use: "askUsername", Next: map[string]string{"submitted": "end"}},
+		"end":           {Name: "end", Use: "successResult"},
+	})
+
+	issues := LintFlowDefinition(flow)
+	assert.NoError(t, ValidateFlowDefinitionStrict(flow))
+
+	issue := findIssue(issues, "askUsername", "not reachable")
+	require.NotNil(t, issue)
+	assert.Equal(t, FlowIssueWarning, issue.Severity)
+
+	issue = findIssue(issues, "checkUsername", "requires 'username'")
+	require.NotNil(t, issue)
+	assert.Equal(t, FlowIssueWarning, issue.Severity)
+
+	// Once the username is asked first the requirement is met
+	flow.Nodes["init"].Next["start"] = "askUsername"
+	flow.Nodes["askUsername"].Next["submitted"] = "checkUsername"
+	issues = LintFlowDefinition(flow)
+	assert.Nil(t, findIssue(issues, "checkUsername", "requires 'username'"))
+	assert.Nil(t, findIssue(issues, "askUsername", "not reachable"))
+}
+
+func TestLint_Cycles(t *testing.T) {
+	flow := lintFlow("first", map[string]*model.GraphNode{
+		"first":  {Name: "first", Use: "setVariable", Next: map[string]string{"done": "second"}, CustomConfig: map[string]string{"key": "a", "value": "b"}},
+		"second": {Name: "second", Use: "setVariable", Next: map[string]string{"done": "first"}, CustomConfig: map[string]string{"key": "a", "value": "b"}},
+	})
+
+	err := ValidateFlowDefinitionStrict(flow)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cycle without any user interaction")
+
+	// A cycle that asks the user is a retry loop
+	flow = lintFlow("askPassword", map[string]*model.GraphNode{
+		"askPassword": {Name: "askPassword", Use: "askPassword", Next: map[string]string{"submitted": "setVar"}},
+		"setVar":      {Name: "setVar", Use: "setVariable", Next: map[string]string{"done": "askPassword"}, CustomConfig: map[string]string{"key": "a", "value": "b"}},
+	})
+	assert.NoError(t, ValidateFlowDefinitionStrict(flow))
+}
+
+func TestLint_ConditionOutcomes(t *testing.T) {
+	flow := lintFlow("route", map[string]*model.GraphNode{
+		"route": {
+			Name: "route",
+			Use:  "condition",
+			Next: map[string]string{"internal": "end", "default": "end"},
+			CustomConfig: map[string]string{
+				"outcomes": "internal: ipInRange(request.ip, \"10.0.0.0/8\")\nmfa: \"mfa\" in oauth2.acr_values",
+			},
+		},
+		"end": {Name: "end", Use: "successResult"},
+	})
+
+	// The outcomes of the config are the result states of the node
+	issues := LintFlowDefinition(flow)
+	assert.NoError(t, ValidateFlowDefinitionStrict(flow))
+	assert.Nil(t, findIssue(issues, "route", "never returns it"))
+
+	flow.Nodes["route"].Next["external"] = "end"
+	issue := findIssue(LintFlowDefinition(flow), "route", "never returns it")
+	require.NotNil(t, issue)
+	assert.Equal(t, "external", issue.Key)
+	delete(flow.Nodes["route"].Next, "external")
+
+	// Expressions are parsed when the flow is validated
+	flow.Nodes["route"].CustomConfig["outcomes"] = "internal: request.ip =="
+	issue = findIssue(LintFlowDefinition(flow), "route", "invalid configuration")
+	require.NotNil(t, issue)
+	assert.Equal(t, FlowIssueError, issue.Severity)
+	assert.Equal(t, "custom_config", issue.Field)
+
+	// Conditions must be boolean
+	flow.Nodes["route"].CustomConfig["outcomes"] = "internal: request.ip"
+	assert.NotNil(t, findIssue(LintFlowDefinition(flow), "route", "invalid configuration"))
+}
+
+func TestLint_SetVariableExpression(t *testing.T) {
+	flow := lintFlow("setVar", map[string]*model.GraphNode{
+		"setVar": {Name: "setVar", Use: "setVariable", Next: map[string]string{"done": "end"}, CustomConfig: map[string]string{"key": "a", "expression": "lower(context.email)"}},
+		"end":    {Name: "end", Use: "successResult"},
+	})
+	assert.NoError(t, ValidateFlowDefinitionStrict(flow))
+
+	flow.Nodes["setVar"].CustomConfig["expression"] = "unknownFunction(context.email)"
+	assert.Error(t, ValidateFlowDefinitionStrict(flow))
+}
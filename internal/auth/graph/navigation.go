@@ -0,0 +1,125 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// ErrStepNotAvailable is returned if the session cannot return to the requested step, e.g. because a transition
+// since then cannot be reversed
+var ErrStepNotAvailable = errors.New("step is not available")
+
+// CanGoBack returns true if the user can return to the node that prompted before the current node
+func CanGoBack(state *model.AuthenticationSession) bool {
+	return state != nil && state.Result == nil && len(state.Steps) > 1 && waitsForInput(state)
+}
+
+// Back returns to the node that prompted the user before the current node and prompts again with the context
+// that the node had when it prompted
+func Back(flow *model.FlowDefinition, state *model.AuthenticationSession, services *model.Repositories) (*model.AuthenticationSession, error) {
+	if !CanGoBack(state) {
+		return state, ErrStepNotAvailable
+	}
+
+	return returnToStep(flow, state, len(state.Steps)-2, "back", services)
+}
+
+// Restart prompts the current node again with the context that it had when it prompted first
+func Restart(flow *model.FlowDefinition, state *model.AuthenticationSession, services *model.Repositories) (*model.AuthenticationSession, error) {
+	if state == nil || state.Result != nil || !waitsForInput(state) {
+		return state, ErrStepNotAvailable
+	}
+
+	return returnToStep(flow, state, len(state.Steps)-1, "restart", services)
+}
+
+// BackTo returns to an earlier node that prompted the user, e.g. when the user navigates back in the browser
+func BackTo(flow *model.FlowDefinition, state *model.AuthenticationSession, node string, services *model.Repositories) (*model.AuthenticationSession, error) {
+	if !CanGoBackTo(state, node) {
+		return state, ErrStepNotAvailable
+	}
+	index := stepIndex(state, node)
+
+	return returnToStep(flow, state, index, "back", services)
+}
+
+// CanGoBackTo returns true if the user can return to an earlier node that prompted them
+func CanGoBackTo(state *model.AuthenticationSession, node string) bool {
+	return state != nil && state.Result == nil && waitsForInput(state) && stepIndex(state, node) >= 0
+}
+
+// stepIndex returns the index of the latest step of the node before the current step, or -1 if there is none
+func stepIndex(state *model.AuthenticationSession, node string) int {
+	for i := len(state.Steps) - 2; i >= 0; i-- {
+		if state.Steps[i].Node == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// waitsForInput checks that the session is at the node of its last step, steps can only be changed between requests
+func waitsForInput(state *model.AuthenticationSession) bool {
+	return len(state.Steps) > 0 && state.Steps[len(state.Steps)-1].Node == state.Current
+}
+
+func returnToStep(flow *model.FlowDefinition, state *model.AuthenticationSession, index int, action string, services *model.Repositories) (*model.AuthenticationSession, error) {
+	step := state.Steps[index]
+
+	if flow == nil || flow.Nodes[step.Node] == nil {
+		return state, ErrStepNotAvailable
+	}
+
+	// The user is loaded again if a node since then replaced it
+	if step.UserID == "" {
+		state.User = nil
+	} else if state.User == nil || state.User.ID != step.UserID {
+		if services == nil || services.UserRepo == nil {
+			return state, fmt.Errorf("cannot restore user of step '%s': no user repository", step.Node)
+		}
+		user, err := services.UserRepo.GetByID(context.Background(), step.UserID)
+		if err != nil {
+			return state, fmt.Errorf("cannot restore user of step '%s': %w", step.Node, err)
+		}
+		state.User = user
+	}
+
+	state.History = append(state.History, fmt.Sprintf("%s:%s:%s", state.Current, action, step.Node))
+
+	// The node prompts again and records the step anew
+	state.Steps = state.Steps[:index]
+	state.Current = step.Node
+	state.Context = maps.Clone(step.Context)
+	state.Subflows = cloneSubflowFrames(step.Subflows)
+	state.Prompts = nil
+	state.Error = nil
+
+	return Run(flow, state, nil, services)
+}
+
+// recordStep saves a snapshot of the session when a node prompts the user. A node that prompts again, e.g. after
+// a wrong password, keeps the step of its first prompt.
+func recordStep(state *model.AuthenticationSession) {
+	if waitsForInput(state) {
+		return
+	}
+
+	state.Steps = append(state.Steps, state.Snapshot())
+}
+
+func cloneSubflowFrames(frames []model.SubflowFrame) []model.SubflowFrame {
+	if frames == nil {
+		return nil
+	}
+
+	cloned := make([]model.SubflowFrame, len(frames))
+	for i, frame := range frames {
+		frame.Context = maps.Clone(frame.Context)
+		cloned[i] = frame
+	}
+	return cloned
+}
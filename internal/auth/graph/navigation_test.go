@@ -0,0 +1,139 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newNavigationTestFlow asks for the username and then for the email. Going back from the email to the username
+// is allowed, once the email is submitted the flow cannot go back anymore.
+func newNavigationTestFlow() *model.FlowDefinition {
+	return &model.FlowDefinition{
+		Start: "init",
+		Nodes: map[string]*model.GraphNode{
+			"init":        {Name: "init", Use: "init", Next: map[string]string{"start": "askUsername"}},
+			"askUsername": {Name: "askUsername", Use: "askUsername", Next: map[string]string{"submitted": "setSource"}, Reversible: []string{"submitted"}},
+			"setSource":   {Name: "setSource", Use: "setVariable", Next: map[string]string{"done": "askEmail"}, CustomConfig: map[string]string{"key": "source", "value": "web"}, Reversible: []string{"done"}},
+			"askEmail":    {Name: "askEmail", Use: "askEmail", Next: map[string]string{"submitted": "askPassword"}},
+			"askPassword": {Name: "askPassword", Use: "askPassword", Next: map[string]string{"submitted": "end"}},
+			"end":         {Name: "end", Use: "failureResult"},
+		},
+	}
+}
+
+func TestBack(t *testing.T) {
+	flow := newNavigationTestFlow()
+	services := &model.Repositories{}
+
+	state, err := Run(flow, InitFlow(flow), nil, services)
+	require.NoError(t, err)
+	assert.False(t, CanGoBack(state))
+
+	state, err = Run(flow, state, map[string]string{"username": "alice"}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "askEmail", state.Current)
+	assert.Equal(t, "web", state.Context["source"])
+	assert.True(t, CanGoBack(state))
+
+	// The username node prompts again with the context it had before
+	state, err = Back(flow, state, services)
+	require.NoError(t, err)
+	assert.Equal(t, "askUsername", state.Current)
+	assert.Equal(t, map[string]string{"username": "text"}, state.Prompts)
+	assert.Empty(t, state.Context)
+	assert.Contains(t, state.History, "askEmail:back:askUsername")
+	assert.False(t, CanGoBack(state))
+
+	_, err = Back(flow, state, services)
+	assert.ErrorIs(t, err, ErrStepNotAvailable)
+
+	// A different username can be entered
+	state, err = Run(flow, state, map[string]string{"username": "bob"}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "askEmail", state.Current)
+	assert.Equal(t, "bob", state.Context["username"])
+
+	// Submitting the email cannot be reversed
+	state, err = Run(flow, state, map[string]string{"email": "bob@example.com"}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "askPassword", state.Current)
+	assert.False(t, CanGoBack(state))
+	assert.False(t, CanGoBackTo(state, "askUsername"))
+
+	_, err = BackTo(flow, state, "askUsername", services)
+	assert.ErrorIs(t, err, ErrStepNotAvailable)
+}
+
+func TestBackTo(t *testing.T) {
+	flow := newNavigationTestFlow()
+	flow.Nodes["askEmail"].Reversible = []string{"submitted"}
+	services := &model.Repositories{}
+
+	state, err := Run(flow, InitFlow(flow), nil, services)
+	require.NoError(t, err)
+	state, err = Run(flow, state, map[string]string{"username": "alice"}, services)
+	require.NoError(t, err)
+	state, err = Run(flow, state, map[string]string{"email": "alice@example.com"}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "askPassword", state.Current)
+	require.Len(t, state.Steps, 3)
+
+	// Returning to the email keeps the username
+	assert.True(t, CanGoBackTo(state, "askEmail"))
+	assert.False(t, CanGoBackTo(state, "askPassword"))
+	state, err = BackTo(flow, state, "askEmail", services)
+	require.NoError(t, err)
+	assert.Equal(t, "askEmail", state.Current)
+	assert.Equal(t, "alice", state.Context["username"])
+	assert.NotContains(t, state.Context, "email")
+	assert.Len(t, state.Steps, 2)
+}
+
+func TestRestart(t *testing.T) {
+	flow := newNavigationTestFlow()
+	services := &model.Repositories{}
+
+	state, err := Run(flow, InitFlow(flow), nil, services)
+	require.NoError(t, err)
+
+	state, err = Restart(flow, state, services)
+	require.NoError(t, err)
+	assert.Equal(t, "askUsername", state.Current)
+	assert.Contains(t, state.History, "askUsername:restart:askUsername")
+	assert.Len(t, state.Steps, 1)
+}
+
+func TestSteps_WithoutSecrets(t *testing.T) {
+	flow := newNavigationTestFlow()
+	services := &model.Repositories{}
+
+	state, err := Run(flow, InitFlow(flow), nil, services)
+	require.NoError(t, err)
+
+	// Secrets in the context are not part of the step and are not restored
+	state.Context["email_otp"] = "123456"
+	state.Context["password"] = "secret"
+	state.Context["username"] = "alice"
+	state.Steps = nil
+	state, err = Run(flow, state, nil, services)
+	require.NoError(t, err)
+	require.Len(t, state.Steps, 1)
+	assert.Equal(t, map[string]string{"username": "alice"}, state.Steps[0].Context)
+
+	state, err = Restart(flow, state, services)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "alice"}, state.Context)
+}
+
+func TestLint_Reversible(t *testing.T) {
+	flow := newNavigationTestFlow()
+	assert.Empty(t, LintFlowDefinition(flow))
+
+	flow.Nodes["askEmail"].Reversible = []string{"sent"}
+	issue := findIssue(LintFlowDefinition(flow), "askEmail", "declares 'sent' as reversible")
+	require.NotNil(t, issue)
+	assert.Equal(t, FlowIssueError, issue.Severity)
+}
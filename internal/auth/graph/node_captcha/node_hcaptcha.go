@@ -5,13 +5,14 @@ import (
 	"errors"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/Identityplane/GoAM/pkg/model"
 )
 
 // HCaptchaVerifier defines the interface for hCaptcha verification
 type HCaptchaVerifier interface {
-	Verify(response, sitekey, secret string) bool
+	Verify(client model.HTTPClient, response, sitekey, secret string) bool
 }
 
 // DefaultHCaptchaVerifier implements HCaptchaVerifier using the hCaptcha API
@@ -61,15 +62,19 @@ func RunHcaptchaNode(state *model.AuthenticationSession, node *model.GraphNode,
 		return model.NewNodeResultWithPrompts(map[string]string{"hcaptcha": "text"})
 	}
 
+	if services.HTTPClient == nil {
+		return model.NewNodeResultWithError(errors.New("no http client available"))
+	}
+
 	// Verify hcaptcha response
-	if !hcaptchaVerifier.Verify(response, hcaptchaSitekey, hcaptchaSecret) {
+	if !hcaptchaVerifier.Verify(services.HTTPClient, response, hcaptchaSitekey, hcaptchaSecret) {
 		return model.NewNodeResultWithCondition("failure")
 	}
 
 	return model.NewNodeResultWithCondition("success")
 }
 
-func (v *DefaultHCaptchaVerifier) Verify(response, sitekey, secret string) bool {
+func (v *DefaultHCaptchaVerifier) Verify(client model.HTTPClient, response, sitekey, secret string) bool {
 	// Create form data
 	formData := url.Values{}
 	formData.Set("secret", secret)
@@ -77,7 +82,13 @@ func (v *DefaultHCaptchaVerifier) Verify(response, sitekey, secret string) bool
 	formData.Set("sitekey", sitekey)
 
 	// Make POST request to hCaptcha verification endpoint
-	resp, err := http.PostForm("https://api.hcaptcha.com/siteverify", formData)
+	req, err := http.NewRequest(http.MethodPost, "https://api.hcaptcha.com/siteverify", strings.NewReader(formData.Encode()))
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return false
 	}
@@ -1,6 +1,7 @@
 package node_captcha
 
 import (
+	"net/http"
 	"testing"
 
 	"github.com/Identityplane/GoAM/pkg/model"
@@ -11,13 +12,13 @@ type MockHCaptchaVerifier struct {
 	shouldVerify bool
 }
 
-func (m *MockHCaptchaVerifier) Verify(response, sitekey, secret string) bool {
+func (m *MockHCaptchaVerifier) Verify(client model.HTTPClient, response, sitekey, secret string) bool {
 	return m.shouldVerify
 }
 
 func TestRunHcaptchaNode(t *testing.T) {
 	// Create mock services
-	services := &model.Repositories{}
+	services := &model.Repositories{HTTPClient: http.DefaultClient}
 
 	// Create test cases
 	tests := []struct {
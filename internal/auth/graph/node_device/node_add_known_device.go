@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
@@ -123,20 +124,22 @@ func initSessions(device *model.DeviceAttributeValue, now time.Time, state *mode
 		}
 	}
 
+	// If the flow verified the user with more factors, e.g. a password and a TOTP code, the sessions start at that level
+	var methods []string
+	if state.User != nil {
+		if level, err := strconv.Atoi(string(state.AuthLevel(state.User.ID))); err == nil && level > loa {
+			loa = level
+		}
+		if state.AuthMethodsUserID == state.User.ID {
+			methods = slices.Clone(state.AuthMethods)
+		}
+	}
+
 	mappings := getLoaToExpiryMapping()
 
-	// We always init the LOA0 session
+	// We always init the LOA0 session, the sessions LOA1 and LOA2 are started up to the loa
 	device.SessionLoa0 = *attributes.InitSession(now, mappings[0])
-
-	// We init the LOA1 session if the loa is 1 or 2
-	if loa >= 1 && len(mappings) > 1 {
-		device.SessionLoa1 = attributes.InitSession(now, mappings[1])
-	}
-
-	// We init the LOA2 session if the loa is 2
-	if loa >= 2 && len(mappings) > 2 {
-		device.SessionLoa2 = attributes.InitSession(now, mappings[2])
-	}
+	device.RaiseLoa(now, loa, methods, mappings)
 
 	return nil
 }
@@ -615,3 +615,44 @@ func TestIsKnownDeviceNodeRefreshExpiry(t *testing.T) {
 
 	mockUserRepo.AssertExpectations(t)
 }
+
+func TestAddKnownDeviceNodeStartsSessionsOfAuthLevel(t *testing.T) {
+	mockUserRepo := repository.NewMockUserRepository()
+	services := &model.Repositories{
+		UserRepo: mockUserRepo,
+	}
+
+	testUser := &model.User{
+		ID:     uuid.NewString(),
+		Status: "active",
+	}
+
+	// The flow verified a password and a TOTP code
+	state := &model.AuthenticationSession{
+		User:              testUser,
+		Context:           map[string]string{},
+		AuthMethods:       []string{model.AuthMethodPassword, model.AuthMethodOtp},
+		AuthMethodsUserID: testUser.ID,
+		HttpAuthContext: &model.HttpAuthContext{
+			RequestHeaders:            map[string]string{},
+			RequestCookies:            map[string]string{},
+			AdditionalResponseCookies: make(map[string]http.Cookie),
+		},
+	}
+
+	var created *model.UserAttribute
+	mockUserRepo.On("CreateUserAttribute", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		created = args.Get(1).(*model.UserAttribute)
+	}).Return(nil)
+
+	result, err := RunAddKnownDeviceNode(state, &model.GraphNode{}, map[string]string{}, services)
+	assert.NoError(t, err)
+	assert.Equal(t, "success", result.Condition)
+
+	device := created.Value.(model.DeviceAttributeValue)
+	assert.Equal(t, 2, device.CurrentLoa(time.Now()))
+	if assert.NotNil(t, device.SessionLoa1) && assert.NotNil(t, device.SessionLoa2) {
+		assert.Equal(t, []string{"pwd", "otp"}, device.SessionLoa1.AuthMethods)
+		assert.Equal(t, []string{"pwd", "otp"}, device.SessionLoa2.AuthMethods)
+	}
+}
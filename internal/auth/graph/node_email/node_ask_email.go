@@ -14,4 +14,7 @@ var AskEmailNode = &model.NodeDefinition{
 		"email": "email",
 	},
 	PossibleResultStates: []string{"submitted"},
+	CustomConfigOptions: map[string]string{
+		"showRegisterLink": "if set then show a link to the registration",
+	},
 }
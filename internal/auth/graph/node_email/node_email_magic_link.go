@@ -0,0 +1,272 @@
+package node_email
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_utils"
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	MAGIC_LINK_PARAM = "magic_link" // Query parameter that carries the token of the magic link
+
+	MAGIC_LINK_OPTION_VALIDITY     = "link_validity_seconds"
+	MAGIC_LINK_OPTION_CROSS_DEVICE = "cross_device"
+
+	MAGIC_LINK_CROSS_DEVICE_DENY    = "deny"    // The link must be opened on the device where the login was started
+	MAGIC_LINK_CROSS_DEVICE_APPROVE = "approve" // The link can be opened on another device to approve the login on the original device
+
+	MSG_INVALID_MAGIC_LINK = "The link is invalid or has expired"
+
+	magicLinkSecretKey = "magic_link_secret"
+)
+
+var (
+	ErrInvalidMagicLink = errors.New("invalid magic link")
+	ErrExpiredMagicLink = errors.New("magic link expired")
+)
+
+var EmailMagicLinkNode = &model.NodeDefinition{
+	Name:                 "emailMagicLink",
+	PrettyName:           "Email Magic Link",
+	Description:          "Sends a single-use, short-lived login link via email and waits until it is opened. Opening the link on the same device continues the login. Depending on the cross device policy the link can also be opened on another device to approve the login on the original device. Results are the same as for the email OTP node, so it can replace it in existing flows.",
+	Category:             "Multi-Factor Authentication",
+	Type:                 model.NodeTypeQueryWithLogic,
+	RequiredContext:      []string{"email"},
+	PossiblePrompts:      map[string]string{MAGIC_LINK_PARAM: "text", "option": "resend", "email": "email"},
+	OutputContext:        []string{"email_verified"},
+	SensitiveContext:     []string{magicLinkSecretKey},
+	PossibleResultStates: []string{CONDITION_SUCCESS_REGISTERED_EMAIL, CONDITION_SUCCESS_NEW_EMAIL_FOR_USER, CONDITION_SUCCESS_UNKNOW_EMAIL},
+	CustomConfigOptions: map[string]string{
+		EMAIL_OTP_OPTION_MAX_ATTEMPTS:  "No link is sent if the email is locked or has this number of failed otp attempts (default: 10)",
+		EMAIL_OTP_OPTION_INIT_USER:     "If true, the node will initialize the user if no user is found in the context. Default false",
+		EMAIL_RESEND_IN_SECONDS:        "The number of seconds to wait before resending the link. Default 30",
+		MAGIC_LINK_OPTION_VALIDITY:     "The number of seconds the link is valid. Default 600",
+		MAGIC_LINK_OPTION_CROSS_DEVICE: "Policy if the link is opened on another device: 'deny' or 'approve'. Default deny",
+	},
+	Run: RunEmailMagicLinkNode,
+}
+
+func RunEmailMagicLinkNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+
+	email, user, err := getEmailAddress(state, services)
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+
+	if email == "" {
+		return model.NewNodeResultWithError(errors.New("email must be provided before running this node"))
+	}
+
+	maxAttempts, err := node_utils.IntOption(node, EMAIL_OTP_OPTION_MAX_ATTEMPTS, 10)
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+	resendInSeconds, err := node_utils.IntOption(node, EMAIL_RESEND_IN_SECONDS, 30)
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+	validity, err := node_utils.IntOption(node, MAGIC_LINK_OPTION_VALIDITY, 600)
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+
+	// The link was opened on another device and the login was approved there. The approval is stored apart from the
+	// session, consuming it makes sure it is only used once.
+	if secret := state.Context[magicLinkSecretKey]; secret != "" && services.MagicLinks != nil {
+
+		approved, err := services.MagicLinks.ConsumeMagicLinkApproval(context.Background(), state.SessionIdHash, MagicLinkID(secret))
+		if err != nil {
+			return model.NewNodeResultWithError(err)
+		}
+
+		if approved {
+			delete(state.Context, magicLinkSecretKey)
+			return completeEmailVerification(email, user, node, state, services)
+		}
+	}
+
+	// The link was opened on this device
+	if token := input[MAGIC_LINK_PARAM]; token != "" {
+
+		if err := consumeMagicLink(state, token); err != nil {
+			log.Debug().Err(err).Msg("magic link rejected")
+			state.Context["message"] = MSG_INVALID_MAGIC_LINK
+			return magicLinkPrompt(email, state)
+		}
+
+		return completeEmailVerification(email, user, node, state, services)
+	}
+
+	if state.Context[magicLinkSecretKey] == "" {
+
+		err := sendMagicLink(email, user, services, maxAttempts, state, resendInSeconds, validity)
+		if err != nil {
+			return model.NewNodeResultWithError(err)
+		}
+	} else if input["option"] == "resend" {
+
+		resendAt, err := time.Parse(time.RFC3339, state.Context["resend_at"])
+		if err != nil || time.Now().After(resendAt) {
+
+			err := sendMagicLink(email, user, services, maxAttempts, state, resendInSeconds, validity)
+			if err != nil {
+				return model.NewNodeResultWithError(err)
+			}
+			state.Context["message"] = ""
+		} else {
+			state.Context["message"] = MSG_RESEND_TOO_SOON
+		}
+	}
+
+	// Wait until the link is opened
+	return magicLinkPrompt(email, state)
+}
+
+// MagicLinkSessionHash returns the hash of the authentication session the magic link was issued for
+func MagicLinkSessionHash(token string) (string, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", ErrInvalidMagicLink
+	}
+
+	return parts[0], nil
+}
+
+// VerifyMagicLink verifies a magic link that was opened on another device without changing the session. It returns
+// the id of the link and when it expires, the approval is recorded with them through the MagicLinkRepository and the
+// node completes the next time it runs on the original device.
+func VerifyMagicLink(state *model.AuthenticationSession, token string) (string, time.Time, error) {
+
+	expiresAt, err := verifyMagicLink(state, token)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return MagicLinkID(state.Context[magicLinkSecretKey]), expiresAt, nil
+}
+
+// MagicLinkID identifies the link that was sent with the secret, a new link gets a new id
+func MagicLinkID(secret string) string {
+	return lib.HashString(secret)
+}
+
+// sendMagicLink creates a new link and sends it to the email address. A new secret is generated for every link
+// so that only the latest link can be used.
+func sendMagicLink(email string, user *model.User, services *model.Repositories, maxFailedAttempts int, state *model.AuthenticationSession, resendInSeconds int, validity int) error {
+
+	secret, err := lib.GenerateRandomBytes(32)
+	if err != nil {
+		return err
+	}
+	state.Context[magicLinkSecretKey] = hex.EncodeToString(secret)
+
+	resendAt := time.Now().Add(time.Duration(resendInSeconds) * time.Second)
+	state.Context["resend_at"] = resendAt.Format(time.RFC3339)
+
+	locked, err := isEmailLocked(user, maxFailedAttempts)
+	if err != nil {
+		return err
+	}
+	if locked {
+		// Silently return but log the attempt
+		log.Info().Msgf("Sending email magic link failed. Email locked or max failed attempts reached")
+		return nil
+	}
+
+	expiresAt := time.Now().Add(time.Duration(validity) * time.Second)
+	token := signMagicLink(state.Context[magicLinkSecretKey], state.SessionIdHash, expiresAt)
+	link := state.LoginUriBase + "/" + state.Current + "?" + MAGIC_LINK_PARAM + "=" + url.QueryEscape(token)
+
+	emailParams := &model.SendEmailParams{
+		Template: "email-magic-link",
+		To: []model.EmailAddress{
+			{Email: email},
+		},
+		Params: map[string]any{
+			"link":               link,
+			"expires_in_minutes": int(math.Ceil(float64(validity) / 60)),
+		},
+	}
+
+	return services.EmailSender.SendEmail(emailParams)
+}
+
+// signMagicLink creates the token of the link. It contains the session it was issued for, the expiry and a
+// signature with the secret that only exists in the session.
+func signMagicLink(secret string, sessionIdHash string, expiresAt time.Time) string {
+
+	payload := sessionIdHash + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// consumeMagicLink verifies the token against the session and removes the secret so that the link is single-use
+func consumeMagicLink(state *model.AuthenticationSession, token string) error {
+
+	if _, err := verifyMagicLink(state, token); err != nil {
+		return err
+	}
+
+	delete(state.Context, magicLinkSecretKey)
+	return nil
+}
+
+// verifyMagicLink verifies the token against the secret of the session and returns when the link expires
+func verifyMagicLink(state *model.AuthenticationSession, token string) (time.Time, error) {
+
+	secret := state.Context[magicLinkSecretKey]
+	if secret == "" {
+		return time.Time{}, ErrInvalidMagicLink
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != state.SessionIdHash {
+		return time.Time{}, ErrInvalidMagicLink
+	}
+
+	expiresAtUnix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, ErrInvalidMagicLink
+	}
+	expiresAt := time.Unix(expiresAtUnix, 0)
+
+	expected := signMagicLink(secret, state.SessionIdHash, expiresAt)
+	if !hmac.Equal([]byte(expected), []byte(token)) {
+		return time.Time{}, ErrInvalidMagicLink
+	}
+
+	if time.Now().After(expiresAt) {
+		return time.Time{}, ErrExpiredMagicLink
+	}
+
+	return expiresAt, nil
+}
+
+func magicLinkPrompt(email string, state *model.AuthenticationSession) (*model.NodeResult, error) {
+
+	resendAt, err := time.Parse(time.RFC3339, state.Context["resend_at"])
+	if err != nil {
+		resendAt = time.Now()
+	}
+
+	secondToResend := int(math.Max(0, time.Until(resendAt).Seconds()))
+
+	return model.NewNodeResultWithPrompts(map[string]string{MAGIC_LINK_PARAM: "waiting", "email": email, "resend_in_seconds": strconv.Itoa(secondToResend)})
+}
@@ -0,0 +1,190 @@
+package node_email
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/auth/repository"
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newMagicLinkTest(t *testing.T) (*model.AuthenticationSession, *model.Repositories, *repository.MockEmailSender, *[]*model.SendEmailParams) {
+	mockUserRepo := repository.NewMockUserRepository()
+	mockEmailSender := repository.NewMockEmailSender()
+	services := &model.Repositories{
+		UserRepo:    mockUserRepo,
+		EmailSender: mockEmailSender,
+		MagicLinks:  new(repository.MockMagicLinkRepository),
+	}
+
+	user := &model.User{ID: "123"}
+	user.AddAttribute(&model.UserAttribute{
+		Type:  model.AttributeTypeEmail,
+		Index: lib.StringPtr("alice@example.com"),
+		Value: model.EmailAttributeValue{Email: "alice@example.com"},
+	})
+
+	session := &model.AuthenticationSession{
+		SessionIdHash: lib.HashString("session-id"),
+		Current:       "magicLink",
+		LoginUriBase:  "https://example.com/acme/customers/auth/login",
+		Context:       map[string]string{"email": "alice@example.com"},
+		User:          user,
+	}
+
+	sent := []*model.SendEmailParams{}
+	mockEmailSender.On("SendEmail", mock.AnythingOfType("*model.SendEmailParams")).Run(func(args mock.Arguments) {
+		sent = append(sent, args.Get(0).(*model.SendEmailParams))
+	}).Return(nil)
+	mockUserRepo.On("UpdateUserAttribute", mock.Anything, mock.Anything).Return(nil)
+
+	return session, services, mockEmailSender, &sent
+}
+
+// tokenFromEmail extracts the token from the link in the email
+func tokenFromEmail(t *testing.T, email *model.SendEmailParams) string {
+	link, err := url.Parse(email.Params["link"].(string))
+	require.NoError(t, err)
+	return link.Query().Get(MAGIC_LINK_PARAM)
+}
+
+func TestEmailMagicLink_SameDevice(t *testing.T) {
+	session, services, _, sent := newMagicLinkTest(t)
+	node := &model.GraphNode{CustomConfig: map[string]string{}}
+
+	result, err := RunEmailMagicLinkNode(session, node, map[string]string{}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "waiting", result.Prompts[MAGIC_LINK_PARAM])
+	assert.Equal(t, "alice@example.com", result.Prompts["email"])
+
+	require.Len(t, *sent, 1)
+	email := (*sent)[0]
+	assert.Equal(t, "email-magic-link", email.Template)
+	assert.Equal(t, 10, email.Params["expires_in_minutes"])
+	assert.True(t, strings.HasPrefix(email.Params["link"].(string), "https://example.com/acme/customers/auth/login/magicLink?magic_link="))
+
+	token := tokenFromEmail(t, email)
+	sessionIdHash, err := MagicLinkSessionHash(token)
+	require.NoError(t, err)
+	assert.Equal(t, session.SessionIdHash, sessionIdHash)
+
+	// Waiting without the link shows the prompt again
+	result, err = RunEmailMagicLinkNode(session, node, map[string]string{}, services)
+	require.NoError(t, err)
+	assert.NotNil(t, result.Prompts)
+
+	// A tampered link is rejected
+	result, err = RunEmailMagicLinkNode(session, node, map[string]string{MAGIC_LINK_PARAM: token + "x"}, services)
+	require.NoError(t, err)
+	assert.NotNil(t, result.Prompts)
+	assert.Equal(t, MSG_INVALID_MAGIC_LINK, session.Context["message"])
+
+	result, err = RunEmailMagicLinkNode(session, node, map[string]string{MAGIC_LINK_PARAM: token}, services)
+	require.NoError(t, err)
+	assert.Equal(t, CONDITION_SUCCESS_REGISTERED_EMAIL, result.Condition)
+
+	emailValue, _, err := model.GetAttribute[model.EmailAttributeValue](session.User, model.AttributeTypeEmail)
+	require.NoError(t, err)
+	assert.True(t, emailValue.Verified)
+
+	// The link is single-use
+	assert.ErrorIs(t, consumeMagicLink(session, token), ErrInvalidMagicLink)
+}
+
+func TestEmailMagicLink_ApproveFromOtherDevice(t *testing.T) {
+	session, services, _, sent := newMagicLinkTest(t)
+	node := &model.GraphNode{CustomConfig: map[string]string{MAGIC_LINK_OPTION_CROSS_DEVICE: MAGIC_LINK_CROSS_DEVICE_APPROVE}}
+
+	_, err := RunEmailMagicLinkNode(session, node, map[string]string{}, services)
+	require.NoError(t, err)
+	token := tokenFromEmail(t, (*sent)[0])
+
+	// Without an approval the original device keeps waiting
+	result, err := RunEmailMagicLinkNode(session, node, map[string]string{}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "waiting", result.Prompts[MAGIC_LINK_PARAM])
+
+	// Verifying the link on the other device does not change the session
+	linkID, expiresAt, err := VerifyMagicLink(session, token)
+	require.NoError(t, err)
+	assert.Equal(t, MagicLinkID(session.Context[magicLinkSecretKey]), linkID)
+
+	_, _, err = VerifyMagicLink(session, token+"x")
+	assert.ErrorIs(t, err, ErrInvalidMagicLink)
+
+	// The link can only be approved once
+	approved, err := services.MagicLinks.ApproveMagicLink(context.Background(), session.SessionIdHash, linkID, expiresAt)
+	require.NoError(t, err)
+	assert.True(t, approved)
+
+	approved, err = services.MagicLinks.ApproveMagicLink(context.Background(), session.SessionIdHash, linkID, expiresAt)
+	require.NoError(t, err)
+	assert.False(t, approved)
+
+	// The original device continues once the login was approved
+	result, err = RunEmailMagicLinkNode(session, node, map[string]string{}, services)
+	require.NoError(t, err)
+	assert.Equal(t, CONDITION_SUCCESS_REGISTERED_EMAIL, result.Condition)
+
+	// The link cannot be used anymore
+	_, _, err = VerifyMagicLink(session, token)
+	assert.ErrorIs(t, err, ErrInvalidMagicLink)
+}
+
+func TestEmailMagicLink_ApprovalOfPreviousLinkIsIgnored(t *testing.T) {
+	session, services, _, sent := newMagicLinkTest(t)
+	node := &model.GraphNode{CustomConfig: map[string]string{MAGIC_LINK_OPTION_CROSS_DEVICE: MAGIC_LINK_CROSS_DEVICE_APPROVE, EMAIL_RESEND_IN_SECONDS: "0"}}
+
+	_, err := RunEmailMagicLinkNode(session, node, map[string]string{}, services)
+	require.NoError(t, err)
+	linkID, expiresAt, err := VerifyMagicLink(session, tokenFromEmail(t, (*sent)[0]))
+	require.NoError(t, err)
+
+	// A new link replaces the approved one
+	_, err = RunEmailMagicLinkNode(session, node, map[string]string{"option": "resend"}, services)
+	require.NoError(t, err)
+
+	_, err = services.MagicLinks.ApproveMagicLink(context.Background(), session.SessionIdHash, linkID, expiresAt)
+	require.NoError(t, err)
+
+	result, err := RunEmailMagicLinkNode(session, node, map[string]string{}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "waiting", result.Prompts[MAGIC_LINK_PARAM])
+}
+
+func TestEmailMagicLink_Expired(t *testing.T) {
+	session, _, _, _ := newMagicLinkTest(t)
+	session.Context[magicLinkSecretKey] = "secret"
+
+	token := signMagicLink("secret", session.SessionIdHash, time.Now().Add(-time.Second))
+	assert.ErrorIs(t, consumeMagicLink(session, token), ErrExpiredMagicLink)
+
+	// Links of other sessions are rejected
+	token = signMagicLink("secret", lib.HashString("other-session"), time.Now().Add(time.Minute))
+	assert.ErrorIs(t, consumeMagicLink(session, token), ErrInvalidMagicLink)
+}
+
+func TestEmailMagicLink_ResendInvalidatesPreviousLink(t *testing.T) {
+	session, services, _, sent := newMagicLinkTest(t)
+	node := &model.GraphNode{CustomConfig: map[string]string{EMAIL_RESEND_IN_SECONDS: "0"}}
+
+	_, err := RunEmailMagicLinkNode(session, node, map[string]string{}, services)
+	require.NoError(t, err)
+
+	_, err = RunEmailMagicLinkNode(session, node, map[string]string{"option": "resend"}, services)
+	require.NoError(t, err)
+	require.Len(t, *sent, 2)
+
+	first := tokenFromEmail(t, (*sent)[0])
+	second := tokenFromEmail(t, (*sent)[1])
+
+	assert.ErrorIs(t, consumeMagicLink(session, first), ErrInvalidMagicLink)
+	assert.NoError(t, consumeMagicLink(session, second))
+}
@@ -38,6 +38,7 @@ var EmailOTPNode = &model.NodeDefinition{
 	RequiredContext:      []string{"email"},
 	PossiblePrompts:      map[string]string{"otp": "number", "option": "resend", "email": "email"},
 	OutputContext:        []string{"emailOTP", "email_verified"},
+	SensitiveContext:     []string{"email_otp"},
 	PossibleResultStates: []string{CONDITION_SUCCESS_REGISTERED_EMAIL, CONDITION_SUCCESS_NEW_EMAIL_FOR_USER, CONDITION_SUCCESS_UNKNOW_EMAIL},
 	CustomConfigOptions: map[string]string{
 		EMAIL_OTP_OPTION_MAX_ATTEMPTS: "Maximum number of failed attempts before locking the user (default: 10)",
@@ -119,52 +120,56 @@ func RunEmailOTPNode(state *model.AuthenticationSession, node *model.GraphNode,
 
 		// We ask again for the OTP but dont send a new email
 		return otpPrompt(email, state)
-	} else {
+	}
 
-		if user != nil {
+	return completeEmailVerification(email, user, node, state, services)
+}
 
-			if user.HasEmailAddress(email) {
+// completeEmailVerification registers the verified email and returns the result condition depending on
+// whether the email belongs to the user in the context
+func completeEmailVerification(email string, user *model.User, node *model.GraphNode, state *model.AuthenticationSession, services *model.Repositories) (*model.NodeResult, error) {
 
-				// If the email is registered to the user we register the verification
-				err := registerSucessfullVerification(email, user, services)
-				if err != nil {
-					return model.NewNodeResultWithError(err)
-				}
+	if user != nil {
 
-				return model.NewNodeResultWithCondition(CONDITION_SUCCESS_REGISTERED_EMAIL)
-			} else {
+		if user.HasEmailAddress(email) {
 
-				return model.NewNodeResultWithCondition(CONDITION_SUCCESS_NEW_EMAIL_FOR_USER)
+			// If the email is registered to the user we register the verification
+			err := registerSucessfullVerification(email, user, services)
+			if err != nil {
+				return model.NewNodeResultWithError(err)
 			}
 
-		} else {
+			// The code or the magic link was a one-time password sent to the mailbox of the user
+			state.AddAuthMethod(model.AuthMethodOtp)
+			return model.NewNodeResultWithCondition(CONDITION_SUCCESS_REGISTERED_EMAIL)
+		}
 
-			if node.CustomConfig[EMAIL_OTP_OPTION_INIT_USER] == "true" {
-				user, err := services.UserRepo.NewUserModel(state)
-				if err != nil {
-					return model.NewNodeResultWithError(err)
-				}
-
-				// add a new email attribute with the verified email
-				now := time.Now()
-				emailAttribute := &model.UserAttribute{
-					Type:  model.AttributeTypeEmail,
-					Index: lib.StringPtr(email),
-					Value: model.EmailAttributeValue{
-						Email:      email,
-						Verified:   true,
-						VerifiedAt: &now,
-					},
-				}
-				user.AddAttribute(emailAttribute)
-
-				state.User = user
-			}
+		return model.NewNodeResultWithCondition(CONDITION_SUCCESS_NEW_EMAIL_FOR_USER)
+	}
+
+	if node.CustomConfig[EMAIL_OTP_OPTION_INIT_USER] == "true" {
+		user, err := services.UserRepo.NewUserModel(state)
+		if err != nil {
+			return model.NewNodeResultWithError(err)
+		}
 
-			return model.NewNodeResultWithCondition(CONDITION_SUCCESS_UNKNOW_EMAIL)
+		// add a new email attribute with the verified email
+		now := time.Now()
+		emailAttribute := &model.UserAttribute{
+			Type:  model.AttributeTypeEmail,
+			Index: lib.StringPtr(email),
+			Value: model.EmailAttributeValue{
+				Email:      email,
+				Verified:   true,
+				VerifiedAt: &now,
+			},
 		}
+		user.AddAttribute(emailAttribute)
 
+		state.User = user
 	}
+
+	return model.NewNodeResultWithCondition(CONDITION_SUCCESS_UNKNOW_EMAIL)
 }
 
 // generateOTP generates a random 6 digit OTP
@@ -183,19 +188,14 @@ func generateOTP() string {
 // sendEmailOTP sends an email with the OTP to the email address
 func sendEmailOTP(email string, otp string, user *model.User, services *model.Repositories, maxFailedAttempts int, state *model.AuthenticationSession, resendInSeconds int) error {
 
-	if user != nil {
-		// Check if the email attribute is locked or the maximum number of failed attempts is reached
-		emailValue, _, err := model.GetAttribute[model.EmailAttributeValue](user, model.AttributeTypeEmail)
-		if err != nil {
-			return err
-		}
-
-		// If the user has a email attribute we check the otp locked and failed attempts
-		if emailValue != nil && (emailValue.OtpLocked || emailValue.OtpFailedAttempts >= maxFailedAttempts) {
-			// Silently return but log the attempt
-			log.Info().Msgf("Sending email OTP failed. Email locked or max failed attempts reached")
-			return nil
-		}
+	locked, err := isEmailLocked(user, maxFailedAttempts)
+	if err != nil {
+		return err
+	}
+	if locked {
+		// Silently return but log the attempt
+		log.Info().Msgf("Sending email OTP failed. Email locked or max failed attempts reached")
+		return nil
 	}
 
 	emailParams := &model.SendEmailParams{
@@ -216,6 +216,21 @@ func sendEmailOTP(email string, otp string, user *model.User, services *model.Re
 	return nil
 }
 
+// isEmailLocked checks if the email attribute of the user is locked or the maximum number of failed attempts is reached
+func isEmailLocked(user *model.User, maxFailedAttempts int) (bool, error) {
+
+	if user == nil {
+		return false, nil
+	}
+
+	emailValue, _, err := model.GetAttribute[model.EmailAttributeValue](user, model.AttributeTypeEmail)
+	if err != nil {
+		return false, err
+	}
+
+	return emailValue != nil && (emailValue.OtpLocked || emailValue.OtpFailedAttempts >= maxFailedAttempts), nil
+}
+
 func getEmailAddress(state *model.AuthenticationSession, services *model.Repositories) (string, *model.User, error) {
 	// First we need to identiy the email address. For that we load the email from context
 	// or with second priority from the user attributes
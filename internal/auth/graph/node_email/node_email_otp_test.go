@@ -219,6 +219,7 @@ func TestEmailOTP_UserWithEmailInContext(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 	assert.Equal(t, CONDITION_SUCCESS_REGISTERED_EMAIL, result.Condition)
+	assert.Equal(t, []string{model.AuthMethodOtp}, session.AuthMethods)
 
 	// Verify the user has the email address in the attributes
 	emailAttr, _, err := model.GetAttribute[model.EmailAttributeValue](session.User, model.AttributeTypeEmail)
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+
+	"github.com/Identityplane/GoAM/pkg/model"
 )
 
 const (
@@ -63,7 +65,7 @@ type githubAccessTokenResponse struct {
 	Scope        string `json:"scope"`
 }
 
-func getGithubAccessToken(code, clientID, clientSecret string) (*githubAccessTokenResponse, error) {
+func getGithubAccessToken(client model.HTTPClient, code, clientID, clientSecret string) (*githubAccessTokenResponse, error) {
 	// Set us the request body as JSON
 	requestBodyMap := map[string]string{
 		"client_id":     clientID,
@@ -85,10 +87,11 @@ func getGithubAccessToken(code, clientID, clientSecret string) (*githubAccessTok
 	req.Header.Set("Accept", "application/json")
 
 	// Get the response
-	resp, resperr := http.DefaultClient.Do(req)
+	resp, resperr := client.Do(req)
 	if resperr != nil {
 		return nil, resperr
 	}
+	defer resp.Body.Close()
 
 	// Response body converted to stringified JSON
 	respbody, _ := io.ReadAll(resp.Body)
@@ -102,7 +105,7 @@ func getGithubAccessToken(code, clientID, clientSecret string) (*githubAccessTok
 	return &ghresp, nil
 }
 
-func getGithubData(accessToken string) (*GitHubUser, error) {
+func getGithubData(client model.HTTPClient, accessToken string) (*GitHubUser, error) {
 	// Get request to a set URL
 	req, reqerr := http.NewRequest(
 		"GET",
@@ -118,10 +121,11 @@ func getGithubData(accessToken string) (*GitHubUser, error) {
 	req.Header.Set("Authorization", authorizationHeaderValue)
 
 	// Make the request
-	resp, resperr := http.DefaultClient.Do(req)
+	resp, resperr := client.Do(req)
 	if resperr != nil {
 		return nil, resperr
 	}
+	defer resp.Body.Close()
 
 	// Read the response as a byte slice
 	respbody, _ := io.ReadAll(resp.Body)
@@ -67,8 +67,12 @@ func RunGithubLoginNode(state *model.AuthenticationSession, node *model.GraphNod
 		})
 	}
 
+	if services.HTTPClient == nil {
+		return model.NewNodeResultWithError(fmt.Errorf("no http client available"))
+	}
+
 	// Get the access token from Github
-	githubResponse, err := getGithubAccessToken(code, githubClientID, githubClientSecret)
+	githubResponse, err := getGithubAccessToken(services.HTTPClient, code, githubClientID, githubClientSecret)
 	if err != nil {
 		log := logger.GetGoamLogger()
 		log.Debug().Err(err).Msg("failed to get github access token")
@@ -83,7 +87,7 @@ func RunGithubLoginNode(state *model.AuthenticationSession, node *model.GraphNod
 	}
 
 	// Get the user data from Github
-	githubData, err := getGithubData(githubResponse.AccessToken)
+	githubData, err := getGithubData(services.HTTPClient, githubResponse.AccessToken)
 	if err != nil {
 		log := logger.GetGoamLogger()
 		log.Debug().Err(err).Msg("failed to get github user data")
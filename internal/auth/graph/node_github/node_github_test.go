@@ -34,7 +34,8 @@ func TestGithubLogin_NewUserCreate(t *testing.T) {
 	// Create mock repository
 	mockUserRepo := repository.NewMockUserRepository()
 	services := &model.Repositories{
-		UserRepo: mockUserRepo,
+		UserRepo:   mockUserRepo,
+		HTTPClient: repository.NewHTTPClient(true),
 	}
 
 	// Create test node
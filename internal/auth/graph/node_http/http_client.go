@@ -0,0 +1,114 @@
+package node_http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/logger"
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+var log = logger.GetGoamLogger()
+
+// maxResponseSize limits how much of a response is read, nodes only need small JSON documents
+const maxResponseSize = 1 << 20
+
+// renderedRequest is a request whose templates have been evaluated
+type renderedRequest struct {
+	method  string
+	url     string
+	headers http.Header
+	body    string
+}
+
+type httpResponse struct {
+	status int
+	body   []byte
+}
+
+// host returns the host of the request for logging, the url itself can contain personal data
+func (r *renderedRequest) host() string {
+	parsed, err := url.Parse(r.url)
+	if err != nil {
+		return ""
+	}
+	return parsed.Host
+}
+
+// hostname returns the lower case host of the request without the port
+func (r *renderedRequest) hostname() string {
+	parsed, err := url.Parse(r.url)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// send executes the request and retries it if it fails or the response status is 429 or 5xx. If all attempts
+// return such a status the last response is returned.
+func send(client model.HTTPClient, request *renderedRequest, cfg *httpRequestConfig) (*httpResponse, error) {
+
+	delay := cfg.retryDelay
+
+	for attempt := 0; ; attempt++ {
+		response, err := sendOnce(client, request, cfg.timeout)
+
+		if attempt >= cfg.retries || (err == nil && !isRetryableStatus(response.status)) {
+			return response, err
+		}
+
+		log.Debug().Err(err).Str("host", request.host()).Int("attempt", attempt+1).Msg("retrying http request")
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func sendOnce(client model.HTTPClient, request *renderedRequest, timeout time.Duration) (*httpResponse, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var body io.Reader
+	if request.body != "" {
+		body = strings.NewReader(request.body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, request.method, request.url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = request.headers.Clone()
+
+	if request.body != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(responseBody) > maxResponseSize {
+		return nil, fmt.Errorf("response is larger than %d bytes", maxResponseSize)
+	}
+
+	log.Debug().Str("method", request.method).Str("host", request.host()).Int("status", resp.StatusCode).Dur("duration", time.Since(start)).Msg("http request")
+
+	return &httpResponse{status: resp.StatusCode, body: responseBody}, nil
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
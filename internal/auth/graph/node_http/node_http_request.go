@@ -0,0 +1,564 @@
+package node_http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_utils"
+	"github.com/Identityplane/GoAM/internal/lib/expression"
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+const (
+	HTTP_OPTION_METHOD            = "method"
+	HTTP_OPTION_URL               = "url"
+	HTTP_OPTION_HEADERS           = "headers"
+	HTTP_OPTION_BODY              = "body"
+	HTTP_OPTION_BODY_ENCODING     = "body_encoding"
+	HTTP_OPTION_TIMEOUT_MS        = "timeout_ms"
+	HTTP_OPTION_RETRIES           = "retries"
+	HTTP_OPTION_RETRY_DELAY_MS    = "retry_delay_ms"
+	HTTP_OPTION_RESPONSE_MAPPING  = "response_mapping"
+	HTTP_OPTION_STATUS_CONDITIONS = "status_conditions"
+
+	// HTTP_CONDITION_ERROR is returned if the request failed or the status code is not mapped to a condition
+	HTTP_CONDITION_ERROR = "error"
+
+	// HTTP_STATUS_CONTEXT_KEY is set to the status code of the response
+	HTTP_STATUS_CONTEXT_KEY = "http_status"
+
+	// HTTP_SETTING_ALLOWED_HOSTS is the realm setting with the hosts the node may call, separated by commas. An entry
+	// such as *.example.com allows all subdomains.
+	HTTP_SETTING_ALLOWED_HOSTS = "http_request_allowed_hosts"
+
+	// Encodings of the values inserted into the body
+	HTTP_BODY_ENCODING_JSON = "json" // escaped for a JSON string, e.g. {"name": "{{ context.name }}"}
+	HTTP_BODY_ENCODING_FORM = "form" // url encoded, e.g. name={{ context.name }}
+	HTTP_BODY_ENCODING_NONE = "none" // inserted as they are
+
+	defaultTimeoutMs       = 5000
+	defaultRetryDelayMs    = 200
+	maxRetries             = 5
+	defaultStatusCondition = "success: 200-299"
+)
+
+var (
+	placeholderPattern   = regexp.MustCompile(`(?s)\{\{(.*?)\}\}`)
+	conditionNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+	secretCallPattern    = regexp.MustCompile(`\bsecret\s*\(`)
+)
+
+var HttpRequestNode = &model.NodeDefinition{
+	Name:                 "httpRequest",
+	PrettyName:           "HTTP Request",
+	Description:          "Calls an external api, e.g. a CRM or a fraud detection service. The url, headers and body are templates with {{ expression }} placeholders that can read the context and the user, the headers and the body can also read the secrets of the realm. Only the hosts allowed in the realm settings can be called. Fields of a JSON response can be copied to the context and the status code of the response decides the result of the node.",
+	Category:             "Integrations",
+	Type:                 model.NodeTypeLogic,
+	RequiredContext:      []string{},
+	OutputContext:        []string{HTTP_STATUS_CONTEXT_KEY},
+	PossibleResultStates: []string{HTTP_CONDITION_ERROR},
+	CustomConfigOptions: map[string]string{
+		HTTP_OPTION_METHOD:            "HTTP method. Default GET",
+		HTTP_OPTION_URL:               "URL template, e.g. 'https://crm.example.com/customers?email={{ context.email }}'. Placeholder values are url encoded (required)",
+		HTTP_OPTION_HEADERS:           "One header per line as 'Name: template', e.g. 'Authorization: Bearer {{ secret(\"crm_api_key\") }}'",
+		HTTP_OPTION_BODY:              "Body template, e.g. '{\"email\": \"{{ context.email }}\"}'",
+		HTTP_OPTION_BODY_ENCODING:     "How values are inserted into the body: 'json' escapes them for JSON strings, 'form' url encodes them, 'none' inserts them as they are. Default json",
+		HTTP_OPTION_TIMEOUT_MS:        "Timeout of a single attempt in milliseconds. Default 5000",
+		HTTP_OPTION_RETRIES:           "Number of retries if the request fails or the response status is 429 or 5xx. Default 0, at most 5",
+		HTTP_OPTION_RETRY_DELAY_MS:    "Delay before the first retry in milliseconds, it doubles with every retry. Default 200",
+		HTTP_OPTION_RESPONSE_MAPPING:  "Fields of the JSON response that are copied to the context, one per line as 'context_key: path', e.g. 'risk_score: data.risk.score'",
+		HTTP_OPTION_STATUS_CONDITIONS: "Result conditions by status code, one per line as 'condition: codes', e.g. 'found: 200' or 'blocked: 403, 451' or 'ok: 200-299'. Default 'success: 200-299'",
+	},
+	Run:            RunHttpRequestNode,
+	ResultStates:   httpRequestResultStates,
+	ValidateConfig: validateHttpRequestConfig,
+}
+
+// statusCondition maps a range of status codes to a result condition
+type statusCondition struct {
+	name     string
+	from, to int
+}
+
+// httpRequestConfig is the parsed custom config of the node
+type httpRequestConfig struct {
+	method           string
+	url              string
+	headers          [][2]string
+	body             string
+	bodyEncoding     string
+	timeout          time.Duration
+	retries          int
+	retryDelay       time.Duration
+	responseMapping  map[string]string
+	statusConditions []statusCondition
+}
+
+func RunHttpRequestNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+
+	cfg, err := parseHttpRequestConfig(node)
+	if err != nil {
+		return nil, err
+	}
+
+	if services.HTTPClient == nil {
+		return model.NewNodeResultWithError(model.NewInternalError(model.ErrorCodeInvalidConfig, fmt.Errorf("no http client is configured")))
+	}
+
+	request, err := renderRequest(cfg, state, services.Secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	// Requests are only sent to the hosts the realm allows, the client additionally refuses private addresses
+	if err := checkAllowedHost(request, services.Settings); err != nil {
+		return model.NewNodeResultWithError(model.NewInternalError(model.ErrorCodeInvalidConfig, err))
+	}
+
+	response, err := send(services.HTTPClient, request, cfg)
+	if err != nil {
+		log.Info().Err(err).Str("node", node.Name).Str("host", request.host()).Msg("http request failed")
+		return model.NewNodeResultWithCondition(HTTP_CONDITION_ERROR)
+	}
+
+	state.Context[HTTP_STATUS_CONTEXT_KEY] = strconv.Itoa(response.status)
+
+	// Error responses often have no JSON body, the fields are then not set and the status decides the result
+	if len(cfg.responseMapping) > 0 {
+		if err := mapResponse(state, response.body, cfg.responseMapping); err != nil {
+			log.Debug().Err(err).Str("node", node.Name).Int("status", response.status).Msg("cannot map http response")
+		}
+	}
+
+	return model.NewNodeResultWithCondition(conditionForStatus(cfg.statusConditions, response.status))
+}
+
+// renderRequest evaluates the templates of the url, the headers and the body. Secrets are only available in the
+// headers and the body, urls end up in logs of proxies and servers.
+func renderRequest(cfg *httpRequestConfig, state *model.AuthenticationSession, secrets model.SecretStore) (*renderedRequest, error) {
+
+	env := expression.NewEnvironment(state, time.Now())
+	secretEnv := env.WithSecrets(secrets)
+
+	target, err := renderTemplate(cfg.url, env, escapeUrlValue)
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+
+	request := &renderedRequest{method: cfg.method, url: target, headers: http.Header{}}
+
+	for _, header := range cfg.headers {
+		value, err := renderTemplate(header[1], secretEnv, escapeHeaderValue)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", header[0], err)
+		}
+		request.headers.Add(header[0], value)
+	}
+
+	if cfg.body != "" {
+		request.body, err = renderTemplate(cfg.body, secretEnv, bodyEscapes[cfg.bodyEncoding])
+		if err != nil {
+			return nil, fmt.Errorf("body: %w", err)
+		}
+
+		if cfg.bodyEncoding == HTTP_BODY_ENCODING_FORM && request.headers.Get("Content-Type") == "" {
+			request.headers.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+
+	return request, nil
+}
+
+// checkAllowedHost checks the host of the url against the allowed hosts of the realm
+func checkAllowedHost(request *renderedRequest, settings model.SettingsReader) error {
+
+	host := request.hostname()
+
+	allowed := ""
+	if settings != nil {
+		allowed, _ = settings.GetSetting(HTTP_SETTING_ALLOWED_HOSTS)
+	}
+	if strings.TrimSpace(allowed) == "" {
+		return fmt.Errorf("the realm setting %s is not set, no host can be called", HTTP_SETTING_ALLOWED_HOSTS)
+	}
+
+	// Wildcards only apply to host names, ip addresses must be listed
+	isIP := net.ParseIP(host) != nil
+
+	for _, entry := range strings.Split(allowed, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+
+		if suffix, ok := strings.CutPrefix(entry, "*."); ok {
+			if !isIP && strings.HasSuffix(host, "."+suffix) {
+				return nil
+			}
+		} else if entry != "" && host == entry {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("host %s is not allowed by the realm setting %s", host, HTTP_SETTING_ALLOWED_HOSTS)
+}
+
+// renderTemplate replaces the {{ expression }} placeholders of the template with their values
+func renderTemplate(template string, env *expression.Environment, escape func(string) string) (string, error) {
+
+	var renderErr error
+	result := placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		if renderErr != nil {
+			return ""
+		}
+
+		source := strings.TrimSpace(placeholderPattern.FindStringSubmatch(placeholder)[1])
+		value, err := expression.EvalString(source, env)
+		if err != nil {
+			renderErr = err
+			return ""
+		}
+
+		if escape != nil {
+			return escape(value)
+		}
+		return value
+	})
+
+	return result, renderErr
+}
+
+// escapeUrlValue encodes a value so that it can be used in the path as well as in the query of the url
+func escapeUrlValue(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+// escapeHeaderValue removes line breaks so that a value cannot add headers
+func escapeHeaderValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+// escapeJSONValue escapes a value for a JSON string, the quotes around the placeholder are part of the template
+func escapeJSONValue(value string) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded[1 : len(encoded)-1])
+}
+
+var bodyEscapes = map[string]func(string) string{
+	HTTP_BODY_ENCODING_JSON: escapeJSONValue,
+	HTTP_BODY_ENCODING_FORM: url.QueryEscape,
+	HTTP_BODY_ENCODING_NONE: nil,
+}
+
+// mapResponse copies the fields of the JSON response into the context, fields that are missing are not set
+func mapResponse(state *model.AuthenticationSession, body []byte, mapping map[string]string) error {
+
+	var document any
+	if err := json.Unmarshal(body, &document); err != nil {
+		return fmt.Errorf("response is not JSON: %w", err)
+	}
+
+	for key, path := range mapping {
+		value, ok := lookupPath(document, path)
+		if !ok {
+			continue
+		}
+		state.Context[key] = jsonValueToString(value)
+	}
+
+	return nil
+}
+
+// lookupPath resolves a dotted path such as data.items.0.id in a JSON document
+func lookupPath(document any, path string) (any, bool) {
+
+	current := document
+	for _, segment := range strings.Split(path, ".") {
+		switch v := current.(type) {
+		case map[string]any:
+			value, ok := v[segment]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			current = v[index]
+		default:
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+func jsonValueToString(value any) string {
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		// Objects and arrays are stored as JSON
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+func conditionForStatus(conditions []statusCondition, status int) string {
+
+	for _, condition := range conditions {
+		if status >= condition.from && status <= condition.to {
+			return condition.name
+		}
+	}
+
+	return HTTP_CONDITION_ERROR
+}
+
+func httpRequestResultStates(node *model.GraphNode) []string {
+
+	states := []string{}
+
+	// Invalid conditions are reported by the validation
+	conditions, _ := parseStatusConditions(node.CustomConfig[HTTP_OPTION_STATUS_CONDITIONS])
+	for _, condition := range conditions {
+		if !slices.Contains(states, condition.name) {
+			states = append(states, condition.name)
+		}
+	}
+
+	return append(states, HTTP_CONDITION_ERROR)
+}
+
+func validateHttpRequestConfig(node *model.GraphNode) error {
+
+	cfg, err := parseHttpRequestConfig(node)
+	if err != nil {
+		return err
+	}
+
+	for _, match := range placeholderPattern.FindAllStringSubmatch(cfg.url, -1) {
+		if secretCallPattern.MatchString(match[1]) {
+			return fmt.Errorf("secrets can only be used in the headers and the body")
+		}
+	}
+
+	templates := []string{cfg.url, cfg.body}
+	for _, header := range cfg.headers {
+		templates = append(templates, header[1])
+	}
+
+	for _, template := range templates {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(template, -1) {
+			if _, err := expression.Compile(strings.TrimSpace(match[1]), expression.KindValue); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseHttpRequestConfig(node *model.GraphNode) (*httpRequestConfig, error) {
+
+	cfg := &httpRequestConfig{
+		method: strings.ToUpper(strings.TrimSpace(node.CustomConfig[HTTP_OPTION_METHOD])),
+		url:    strings.TrimSpace(node.CustomConfig[HTTP_OPTION_URL]),
+		body:   node.CustomConfig[HTTP_OPTION_BODY],
+
+		bodyEncoding: strings.ToLower(strings.TrimSpace(node.CustomConfig[HTTP_OPTION_BODY_ENCODING])),
+	}
+
+	if cfg.bodyEncoding == "" {
+		cfg.bodyEncoding = HTTP_BODY_ENCODING_JSON
+	}
+	if _, ok := bodyEscapes[cfg.bodyEncoding]; !ok {
+		return nil, fmt.Errorf("unsupported %s '%s'", HTTP_OPTION_BODY_ENCODING, cfg.bodyEncoding)
+	}
+
+	if cfg.method == "" {
+		cfg.method = http.MethodGet
+	}
+	switch cfg.method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead:
+	default:
+		return nil, fmt.Errorf("unsupported method '%s'", cfg.method)
+	}
+
+	if err := validateUrlTemplate(cfg.url); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if cfg.headers, err = parseHeaders(node.CustomConfig[HTTP_OPTION_HEADERS]); err != nil {
+		return nil, err
+	}
+
+	timeoutMs, err := node_utils.IntOption(node, HTTP_OPTION_TIMEOUT_MS, defaultTimeoutMs)
+	if err != nil || timeoutMs <= 0 {
+		return nil, fmt.Errorf("%s must be a positive number", HTTP_OPTION_TIMEOUT_MS)
+	}
+	cfg.timeout = time.Duration(timeoutMs) * time.Millisecond
+
+	cfg.retries, err = node_utils.IntOption(node, HTTP_OPTION_RETRIES, 0)
+	if err != nil || cfg.retries < 0 || cfg.retries > maxRetries {
+		return nil, fmt.Errorf("%s must be between 0 and %d", HTTP_OPTION_RETRIES, maxRetries)
+	}
+
+	retryDelayMs, err := node_utils.IntOption(node, HTTP_OPTION_RETRY_DELAY_MS, defaultRetryDelayMs)
+	if err != nil || retryDelayMs < 0 {
+		return nil, fmt.Errorf("%s must not be negative", HTTP_OPTION_RETRY_DELAY_MS)
+	}
+	cfg.retryDelay = time.Duration(retryDelayMs) * time.Millisecond
+
+	if cfg.responseMapping, err = parseResponseMapping(node.CustomConfig[HTTP_OPTION_RESPONSE_MAPPING]); err != nil {
+		return nil, err
+	}
+
+	if cfg.statusConditions, err = parseStatusConditions(node.CustomConfig[HTTP_OPTION_STATUS_CONDITIONS]); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// validateUrlTemplate checks that the url is absolute and that scheme and host are not built from placeholders,
+// otherwise values from the user could redirect the request to another server
+func validateUrlTemplate(template string) error {
+
+	if template == "" {
+		return fmt.Errorf("%s is not set", HTTP_OPTION_URL)
+	}
+
+	scheme, rest, ok := strings.Cut(template, "://")
+	if !ok || (scheme != "http" && scheme != "https") {
+		return fmt.Errorf("url must start with http:// or https://")
+	}
+
+	host, _, _ := strings.Cut(rest, "/")
+	if host == "" || strings.Contains(host, "{{") {
+		return fmt.Errorf("the host of the url must not contain placeholders")
+	}
+
+	return nil
+}
+
+func parseHeaders(config string) ([][2]string, error) {
+
+	var headers [][2]string
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " {}") {
+			return nil, fmt.Errorf("header '%s' must have the form 'Name: value'", line)
+		}
+
+		headers = append(headers, [2]string{name, strings.TrimSpace(value)})
+	}
+
+	return headers, nil
+}
+
+func parseResponseMapping(config string) (map[string]string, error) {
+
+	mapping := map[string]string{}
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		key, path, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		path = strings.TrimSpace(path)
+		if !ok || key == "" || path == "" {
+			return nil, fmt.Errorf("response mapping '%s' must have the form 'context_key: path'", line)
+		}
+		if model.IsSensitiveContextKey(key) {
+			return nil, fmt.Errorf("response mapping cannot set '%s'", key)
+		}
+
+		mapping[key] = path
+	}
+
+	return mapping, nil
+}
+
+func parseStatusConditions(config string) ([]statusCondition, error) {
+
+	if strings.TrimSpace(config) == "" {
+		config = defaultStatusCondition
+	}
+
+	var conditions []statusCondition
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		name, codes, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || strings.TrimSpace(codes) == "" {
+			return nil, fmt.Errorf("status condition '%s' must have the form 'condition: codes'", line)
+		}
+		if !conditionNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid condition name '%s'", name)
+		}
+		if name == HTTP_CONDITION_ERROR {
+			return nil, fmt.Errorf("condition '%s' is reserved for failed requests", name)
+		}
+
+		for _, code := range strings.Split(codes, ",") {
+			from, to, err := parseStatusRange(strings.TrimSpace(code))
+			if err != nil {
+				return nil, fmt.Errorf("status condition '%s': %w", name, err)
+			}
+			conditions = append(conditions, statusCondition{name: name, from: from, to: to})
+		}
+	}
+
+	return conditions, nil
+}
+
+// parseStatusRange parses a status code such as 404 or a range such as 200-299
+func parseStatusRange(code string) (int, int, error) {
+
+	fromValue, toValue, isRange := strings.Cut(code, "-")
+	if !isRange {
+		toValue = fromValue
+	}
+
+	from, err := strconv.Atoi(strings.TrimSpace(fromValue))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid status code '%s'", code)
+	}
+	to, err := strconv.Atoi(strings.TrimSpace(toValue))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid status code '%s'", code)
+	}
+	if from < 100 || to > 599 || from > to {
+		return 0, 0, fmt.Errorf("invalid status code '%s'", code)
+	}
+
+	return from, to, nil
+}
@@ -0,0 +1,386 @@
+package node_http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/auth/repository"
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHttpRequestTest() (*model.AuthenticationSession, *model.Repositories) {
+	user := &model.User{ID: "user-1", Status: "active"}
+	user.AddAttribute(&model.UserAttribute{
+		Type:  model.AttributeTypeEmail,
+		Index: lib.StringPtr("alice@example.com"),
+		Value: model.EmailAttributeValue{Email: "alice@example.com", Verified: true},
+	})
+
+	state := &model.AuthenticationSession{
+		Context: map[string]string{"username": "alice smith/admin"},
+		User:    user,
+	}
+
+	services := &model.Repositories{
+		Secrets:    repository.NewSecretStore("acme", "customers", map[string]string{"acme/customers/crm_api_key": "key-1", "acme/other/crm_api_key": "key-2"}),
+		HTTPClient: repository.NewHTTPClient(true),
+		Settings:   repository.NewSettingsReader(map[string]string{HTTP_SETTING_ALLOWED_HOSTS: "127.0.0.1, crm.example.com"}, nil),
+	}
+
+	return state, services
+}
+
+func TestHttpRequest_GetWithResponseMapping(t *testing.T) {
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"customer": {"id": "c-42", "tier": "gold", "score": 0.75, "vip": true, "tags": ["a", "b"]}}`))
+	}))
+	defer server.Close()
+
+	state, services := newHttpRequestTest()
+	node := &model.GraphNode{Name: "crm", CustomConfig: map[string]string{
+		HTTP_OPTION_URL:              server.URL + "/customers/{{ context.username }}?email={{ user.email }}",
+		HTTP_OPTION_HEADERS:          "Authorization: Bearer {{ secret(\"crm_api_key\") }}\nX-Static: static",
+		HTTP_OPTION_RESPONSE_MAPPING: "customer_id: customer.id\nrisk_score: customer.score\nvip: customer.vip\nfirst_tag: customer.tags.0\ntags: customer.tags\nmissing: customer.unknown",
+	}}
+
+	result, err := RunHttpRequestNode(state, node, nil, services)
+	require.NoError(t, err)
+	assert.Equal(t, "success", result.Condition)
+
+	require.NotNil(t, received)
+	assert.Equal(t, http.MethodGet, received.Method)
+	assert.Equal(t, "/customers/alice%20smith%2Fadmin", received.URL.EscapedPath())
+	assert.Equal(t, "alice@example.com", received.URL.Query().Get("email"))
+	assert.Equal(t, "Bearer key-1", received.Header.Get("Authorization"))
+	assert.Equal(t, "static", received.Header.Get("X-Static"))
+
+	assert.Equal(t, "200", state.Context[HTTP_STATUS_CONTEXT_KEY])
+	assert.Equal(t, "c-42", state.Context["customer_id"])
+	assert.Equal(t, "0.75", state.Context["risk_score"])
+	assert.Equal(t, "true", state.Context["vip"])
+	assert.Equal(t, "a", state.Context["first_tag"])
+	assert.Equal(t, `["a","b"]`, state.Context["tags"])
+	assert.NotContains(t, state.Context, "missing")
+}
+
+func TestHttpRequest_PostAndStatusConditions(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	state, services := newHttpRequestTest()
+	node := &model.GraphNode{Name: "fraud", CustomConfig: map[string]string{
+		HTTP_OPTION_METHOD:            "post",
+		HTTP_OPTION_URL:               server.URL + "/check",
+		HTTP_OPTION_BODY:              `{"username": "{{ context.username }}", "user_id": "{{ user.id }}"}`,
+		HTTP_OPTION_STATUS_CONDITIONS: "allow: 200-299\nunknown: 404, 410",
+		HTTP_OPTION_RESPONSE_MAPPING:  "decision: decision",
+	}}
+
+	result, err := RunHttpRequestNode(state, node, nil, services)
+	require.NoError(t, err)
+	assert.Equal(t, "unknown", result.Condition)
+	assert.JSONEq(t, `{"username": "alice smith/admin", "user_id": "user-1"}`, body)
+	assert.Equal(t, "404", state.Context[HTTP_STATUS_CONTEXT_KEY])
+	assert.NotContains(t, state.Context, "decision")
+
+	assert.Equal(t, []string{"allow", "unknown", "error"}, HttpRequestNode.ResultStatesFor(node))
+}
+
+func TestHttpRequest_Retries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	state, services := newHttpRequestTest()
+	node := &model.GraphNode{Name: "crm", CustomConfig: map[string]string{
+		HTTP_OPTION_URL:            server.URL,
+		HTTP_OPTION_RETRIES:        "2",
+		HTTP_OPTION_RETRY_DELAY_MS: "1",
+	}}
+
+	result, err := RunHttpRequestNode(state, node, nil, services)
+	require.NoError(t, err)
+	assert.Equal(t, "success", result.Condition)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// Without retries the unmapped status is an error
+	calls.Store(0)
+	node.CustomConfig[HTTP_OPTION_RETRIES] = "0"
+
+	result, err = RunHttpRequestNode(state, node, nil, services)
+	require.NoError(t, err)
+	assert.Equal(t, HTTP_CONDITION_ERROR, result.Condition)
+	assert.Equal(t, "503", state.Context[HTTP_STATUS_CONTEXT_KEY])
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestHttpRequest_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	state, services := newHttpRequestTest()
+	node := &model.GraphNode{Name: "crm", CustomConfig: map[string]string{
+		HTTP_OPTION_URL:        server.URL,
+		HTTP_OPTION_TIMEOUT_MS: "20",
+	}}
+
+	start := time.Now()
+	result, err := RunHttpRequestNode(state, node, nil, services)
+	require.NoError(t, err)
+	assert.Equal(t, HTTP_CONDITION_ERROR, result.Condition)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.NotContains(t, state.Context, HTTP_STATUS_CONTEXT_KEY)
+}
+
+func TestHttpRequest_UnknownSecret(t *testing.T) {
+	state, services := newHttpRequestTest()
+	node := &model.GraphNode{Name: "crm", CustomConfig: map[string]string{
+		HTTP_OPTION_URL:     "https://crm.example.com/",
+		HTTP_OPTION_HEADERS: "Authorization: Bearer {{ secret(\"unknown\") }}",
+	}}
+
+	_, err := RunHttpRequestNode(state, node, nil, services)
+	assert.ErrorContains(t, err, "secret 'unknown' is not configured")
+}
+
+func TestHttpRequest_BodyEncoding(t *testing.T) {
+	var body, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		contentType = r.Header.Get("Content-Type")
+	}))
+	defer server.Close()
+
+	state, services := newHttpRequestTest()
+	state.Context["name"] = `Mallory", "role": "admin`
+	node := &model.GraphNode{Name: "crm", CustomConfig: map[string]string{
+		HTTP_OPTION_METHOD: "POST",
+		HTTP_OPTION_URL:    server.URL,
+		HTTP_OPTION_BODY:   `{"name": "{{ context.name }}", "key": "{{ secret("crm_api_key") }}"}`,
+	}}
+
+	// Values cannot break out of the JSON string by default
+	_, err := RunHttpRequestNode(state, node, nil, services)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name": "Mallory\", \"role\": \"admin", "key": "key-1"}`, body)
+	assert.Equal(t, "application/json", contentType)
+
+	node.CustomConfig[HTTP_OPTION_BODY_ENCODING] = HTTP_BODY_ENCODING_FORM
+	node.CustomConfig[HTTP_OPTION_BODY] = "name={{ context.name }}"
+	_, err = RunHttpRequestNode(state, node, nil, services)
+	require.NoError(t, err)
+	assert.Equal(t, "name=Mallory%22%2C+%22role%22%3A+%22admin", body)
+	assert.Equal(t, "application/x-www-form-urlencoded", contentType)
+
+	node.CustomConfig[HTTP_OPTION_BODY_ENCODING] = HTTP_BODY_ENCODING_NONE
+	node.CustomConfig[HTTP_OPTION_BODY] = `{"name": {{ toJSON(context.name) }}}`
+	_, err = RunHttpRequestNode(state, node, nil, services)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name": "Mallory\", \"role\": \"admin"}`, body)
+}
+
+func TestHttpRequest_SecretsAreScopedToTheRealm(t *testing.T) {
+	state, services := newHttpRequestTest()
+
+	// Secrets of other realms and unscoped settings are not visible
+	services.Secrets = repository.NewSecretStore("acme", "other", map[string]string{"acme/customers/crm_api_key": "key-1", "crm_api_key": "global"})
+	node := &model.GraphNode{Name: "crm", CustomConfig: map[string]string{
+		HTTP_OPTION_URL:     "https://crm.example.com/",
+		HTTP_OPTION_HEADERS: "Authorization: Bearer {{ secret(\"crm_api_key\") }}",
+	}}
+
+	_, err := RunHttpRequestNode(state, node, nil, services)
+	assert.ErrorContains(t, err, "secret 'crm_api_key' is not configured")
+
+	// The url cannot contain secrets
+	node.CustomConfig[HTTP_OPTION_URL] = "https://crm.example.com/?key={{ secret(\"crm_api_key\") }}"
+	assert.ErrorContains(t, validateHttpRequestConfig(node), "secrets can only be used in the headers and the body")
+
+	services.Secrets = repository.NewSecretStore("acme", "customers", map[string]string{"acme/customers/crm_api_key": "key-1"})
+	_, err = RunHttpRequestNode(state, node, nil, services)
+	assert.ErrorContains(t, err, "secret 'crm_api_key' is not available here")
+}
+
+func TestHttpRequest_SecretKeysAreUnambiguous(t *testing.T) {
+	settings := map[string]string{
+		"a/b_c/x":  "secret-of-b_c",
+		"a/b/c_x":  "secret-of-b",
+		"a/b/c/x":  "nested",
+		"A/b/c_x":  "other-tenant",
+		"a_b_c_x":  "old-format",
+		"a/b/":     "empty-name",
+		"a/b/CRM":  "upper",
+		"a/b_c/yz": "only-b_c",
+	}
+
+	secrets := repository.NewSecretStore("a", "b_c", settings)
+	value, ok := secrets.GetSecret("x")
+	assert.True(t, ok)
+	assert.Equal(t, "secret-of-b_c", value)
+	_, ok = secrets.GetSecret("c_x")
+	assert.False(t, ok)
+
+	// The realm b of the same tenant does not see the secrets of b_c, and the other way round
+	secrets = repository.NewSecretStore("a", "b", settings)
+	value, ok = secrets.GetSecret("c_x")
+	assert.True(t, ok)
+	assert.Equal(t, "secret-of-b", value)
+	value, ok = secrets.GetSecret("c/x")
+	assert.True(t, ok)
+	assert.Equal(t, "nested", value)
+	for _, name := range []string{"x", "yz", "b_c/x", "", "crm"} {
+		_, ok = secrets.GetSecret(name)
+		assert.False(t, ok, name)
+	}
+
+	// Keys are matched case-sensitively
+	_, ok = repository.NewSecretStore("A", "B", settings).GetSecret("c_x")
+	assert.False(t, ok)
+	value, ok = repository.NewSecretStore("A", "b", settings).GetSecret("c_x")
+	assert.True(t, ok)
+	assert.Equal(t, "other-tenant", value)
+}
+
+func TestHttpRequest_AllowedHosts(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer server.Close()
+
+	state, services := newHttpRequestTest()
+	node := &model.GraphNode{Name: "crm", CustomConfig: map[string]string{HTTP_OPTION_URL: server.URL}}
+
+	tests := []struct {
+		name    string
+		allowed string
+		err     string
+	}{
+		{"not configured", "", "is not set"},
+		{"other host", "crm.example.com", "host 127.0.0.1 is not allowed"},
+		{"subdomain wildcard does not match", "*.0.0.1", "host 127.0.0.1 is not allowed"},
+		{"allowed", "crm.example.com,127.0.0.1", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls.Store(0)
+			services.Settings = repository.NewSettingsReader(map[string]string{HTTP_SETTING_ALLOWED_HOSTS: test.allowed}, nil)
+
+			result, err := RunHttpRequestNode(state, node, nil, services)
+
+			if test.err == "" {
+				require.NoError(t, err)
+				assert.Equal(t, "success", result.Condition)
+				assert.Equal(t, int32(1), calls.Load())
+			} else {
+				assert.ErrorContains(t, err, test.err)
+				assert.Equal(t, int32(0), calls.Load())
+			}
+		})
+	}
+
+	assert.NoError(t, checkAllowedHost(&renderedRequest{url: "https://api.crm.example.com/v1"}, repository.NewSettingsReader(map[string]string{HTTP_SETTING_ALLOWED_HOSTS: "*.example.com"}, nil)))
+	assert.Error(t, checkAllowedHost(&renderedRequest{url: "https://example.com.evil.org/v1"}, repository.NewSettingsReader(map[string]string{HTTP_SETTING_ALLOWED_HOSTS: "*.example.com"}, nil)))
+}
+
+func TestHttpRequest_PrivateNetworksAreDenied(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer server.Close()
+
+	// The host is allowed but the client of the realm refuses loopback addresses
+	state, services := newHttpRequestTest()
+	services.HTTPClient = repository.NewHTTPClient(false)
+	node := &model.GraphNode{Name: "crm", CustomConfig: map[string]string{HTTP_OPTION_URL: server.URL}}
+
+	result, err := RunHttpRequestNode(state, node, nil, services)
+	require.NoError(t, err)
+	assert.Equal(t, HTTP_CONDITION_ERROR, result.Condition)
+	assert.Equal(t, int32(0), calls.Load())
+}
+
+func TestHttpRequest_RedirectsToOtherHostsAreNotFollowed(t *testing.T) {
+	var calls atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer target.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(target.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+	}))
+	defer server.Close()
+
+	state, services := newHttpRequestTest()
+	node := &model.GraphNode{Name: "crm", CustomConfig: map[string]string{HTTP_OPTION_URL: server.URL}}
+
+	result, err := RunHttpRequestNode(state, node, nil, services)
+	require.NoError(t, err)
+	assert.Equal(t, HTTP_CONDITION_ERROR, result.Condition)
+	assert.Equal(t, "302", state.Context[HTTP_STATUS_CONTEXT_KEY])
+	assert.Equal(t, int32(0), calls.Load())
+}
+
+func TestHttpRequest_ValidateConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]string
+		err    string
+	}{
+		{"valid", map[string]string{HTTP_OPTION_URL: "https://crm.example.com/{{ user.id }}"}, ""},
+		{"missing url", map[string]string{}, "url is not set"},
+		{"relative url", map[string]string{HTTP_OPTION_URL: "/customers"}, "http:// or https://"},
+		{"placeholder in host", map[string]string{HTTP_OPTION_URL: "https://{{ context.host }}/customers"}, "host of the url"},
+		{"invalid method", map[string]string{HTTP_OPTION_URL: "https://crm.example.com", HTTP_OPTION_METHOD: "TRACE"}, "unsupported method"},
+		{"invalid expression", map[string]string{HTTP_OPTION_URL: "https://crm.example.com", HTTP_OPTION_BODY: "{{ context. }}"}, "invalid expression"},
+		{"invalid header", map[string]string{HTTP_OPTION_URL: "https://crm.example.com", HTTP_OPTION_HEADERS: "no header"}, "must have the form"},
+		{"too many retries", map[string]string{HTTP_OPTION_URL: "https://crm.example.com", HTTP_OPTION_RETRIES: "10"}, "retries must be between"},
+		{"reserved condition", map[string]string{HTTP_OPTION_URL: "https://crm.example.com", HTTP_OPTION_STATUS_CONDITIONS: "error: 500"}, "reserved"},
+		{"invalid status", map[string]string{HTTP_OPTION_URL: "https://crm.example.com", HTTP_OPTION_STATUS_CONDITIONS: "ok: 299-200"}, "invalid status code"},
+		{"sensitive mapping", map[string]string{HTTP_OPTION_URL: "https://crm.example.com", HTTP_OPTION_RESPONSE_MAPPING: "password: data.password"}, "cannot set 'password'"},
+		{"invalid body encoding", map[string]string{HTTP_OPTION_URL: "https://crm.example.com", HTTP_OPTION_BODY_ENCODING: "xml"}, "unsupported body_encoding"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateHttpRequestConfig(&model.GraphNode{CustomConfig: test.config})
+			if test.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package node_ldap
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Identityplane/GoAM/internal/lib/ldap"
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+const (
+	CONDITION_LDAP_SUCCESS = "success"
+	CONDITION_LDAP_FAIL    = "fail"
+
+	// ERROR_CODE_DIRECTORY_UNAVAILABLE is the code of the transient error if the directory cannot be reached
+	ERROR_CODE_DIRECTORY_UNAVAILABLE = "directory_unavailable"
+)
+
+// LdapBindNode authenticates the username and password of the context against an LDAP directory such as OpenLDAP
+// or Active Directory. The service account searches the user and the node binds as the user with the password.
+// The local user is created or updated just in time with the mapped attributes of the directory entry.
+//
+// LDAP Details:
+// ldap:// connections are upgraded with StartTLS unless it is disabled, the certificate of the server must be
+// trusted. Empty passwords are rejected as servers treat them as unauthenticated binds.
+var LdapBindNode = &model.NodeDefinition{
+	Name:                 "ldapBind",
+	PrettyName:           "LDAP Login",
+	Description:          "Authenticates the username and password with an LDAP directory and creates or updates the local user just in time.",
+	Category:             "LDAP",
+	Type:                 model.NodeTypeLogic,
+	RequiredContext:      []string{"username", "password"},
+	OutputContext:        []string{"ldap_dn"},
+	SensitiveContext:     []string{"password"},
+	PossibleResultStates: []string{CONDITION_LDAP_SUCCESS, CONDITION_LDAP_FAIL},
+	DirectConnections:    true,
+	ConfigSchema: map[string]model.ConfigOption{
+		ldap.SettingUrl:               {Description: "URL of the directory, e.g. ldap://ldap.example.com:389 or ldaps://ldap.example.com:636. Usually set in the realm settings"},
+		ldap.SettingStartTLS:          {Description: "Upgrade ldap:// connections with StartTLS", Type: model.ConfigOptionBool, Default: ldap.DefaultStartTLS},
+		ldap.SettingCaCertificate:     {Description: "PEM encoded certificates that are trusted for TLS, the system certificates are used if empty"},
+		ldap.SettingBindDn:            {Description: "DN of the service account that searches the users, the search is anonymous if empty"},
+		ldap.SettingBindPassword:      {Description: "Password of the service account", Secret: true},
+		ldap.SettingBaseDn:            {Description: "Base DN of the user search, e.g. ou=people,dc=example,dc=com. Usually set in the realm settings"},
+		ldap.SettingUserFilter:        {Description: "Filter of the user search, it is combined with the username", Default: ldap.DefaultUserFilter},
+		ldap.SettingUsernameAttribute: {Description: "Attribute the username is matched with, e.g. sAMAccountName for Active Directory", Default: ldap.DefaultUsernameAttribute},
+		ldap.SettingIdAttribute:       {Description: "Attribute with the unique id of the entry, e.g. objectGUID for Active Directory", Default: ldap.DefaultIdAttribute},
+		ldap.SettingAttributeMapping:  {Description: "Directory attributes that are copied to the user, one per line as 'attribute: field', e.g. 'mail: email'", Default: ldap.DefaultAttributeMapping},
+		ldap.SettingLinkBy:            {Description: "Existing local users an entry is linked to if it has no user yet", Type: model.ConfigOptionEnum, Values: []string{ldap.LinkByNone, ldap.LinkByUsername, ldap.LinkByEmail}, Default: ldap.DefaultLinkBy},
+		ldap.SettingTimeout:           {Description: "Timeout of the connection and of each request", Type: model.ConfigOptionDuration, Default: ldap.DefaultTimeout},
+	},
+	Run: RunLdapBindNode,
+}
+
+func RunLdapBindNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+
+	cfg, err := ldap.ParseConfig(func(name string) string { return node.CustomConfig[name] })
+	if err != nil {
+		return model.NewNodeResultWithError(model.NewInternalError(model.ErrorCodeInvalidConfig, err))
+	}
+
+	directory, err := ldap.Connect(cfg)
+	if err != nil {
+		return model.NewNodeResultWithError(model.NewTransientError(ERROR_CODE_DIRECTORY_UNAVAILABLE, err))
+	}
+	defer directory.Close()
+
+	entry, err := directory.Authenticate(state.Context["username"], state.Context["password"])
+	if errors.Is(err, ldap.ErrInvalidCredentials) {
+		state.Error = stringPtr("Invalid username or password")
+		return model.NewNodeResultWithCondition(CONDITION_LDAP_FAIL)
+	}
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+
+	// Groups are imported by the sync job, the login only updates the attributes
+	user, _, err := ldap.Provision(context.Background(), services.UserRepo, cfg, entry, nil, func() (*model.User, error) {
+		return services.UserRepo.NewUserModel(state)
+	})
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+
+	state.User = user
+	state.Context["ldap_dn"] = entry.DN
+	state.AddAuthMethod(model.AuthMethodPassword)
+
+	return model.NewNodeResultWithCondition(CONDITION_LDAP_SUCCESS)
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,119 @@
+package node_ldap
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Identityplane/GoAM/internal/auth/repository"
+	"github.com/Identityplane/GoAM/internal/lib/ldap"
+	"github.com/Identityplane/GoAM/internal/lib/ldap/ldaptest"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLdapBind(t *testing.T) {
+	server := ldaptest.NewServer(t)
+	server.AddEntry("cn=goam,ou=services,dc=example,dc=com", "service-secret", map[string][]string{"cn": {"goam"}})
+	server.AddEntry("uid=jane,ou=people,dc=example,dc=com", "jane-secret", map[string][]string{
+		"objectClass": {"inetOrgPerson", "person"},
+		"uid":         {"jane"},
+		"entryUUID":   {"7b1e4f0c-8f55-4d42-a3c5-3c1f3d5e9a10"},
+		"mail":        {"jane@example.com"},
+		"cn":          {"Jane Doe"},
+	})
+
+	repo, err := repository.NewTestUserRepository("acme", "staff")
+	require.NoError(t, err)
+	defer repo.Close()
+	services := &model.Repositories{UserRepo: repo}
+
+	node := &model.GraphNode{
+		Name: "ldapBind",
+		Use:  "ldapBind",
+		CustomConfig: map[string]string{
+			ldap.SettingUrl:           server.URL,
+			ldap.SettingCaCertificate: server.CertificatePEM(),
+			ldap.SettingBindDn:        "cn=goam,ou=services,dc=example,dc=com",
+			ldap.SettingBindPassword:  "service-secret",
+			ldap.SettingBaseDn:        "dc=example,dc=com",
+		},
+	}
+
+	login := func(username, password string) (*model.AuthenticationSession, *model.NodeResult, error) {
+		state := &model.AuthenticationSession{Context: map[string]string{"username": username, "password": password}}
+		result, err := RunLdapBindNode(state, node, nil, services)
+		return state, result, err
+	}
+
+	var userId string
+
+	t.Run("first login creates the user", func(t *testing.T) {
+		state, result, err := login("jane", "jane-secret")
+		require.NoError(t, err)
+		assert.Equal(t, CONDITION_LDAP_SUCCESS, result.Condition)
+		assert.Equal(t, "uid=jane,ou=people,dc=example,dc=com", state.Context["ldap_dn"])
+		require.NotNil(t, state.User)
+		userId = state.User.ID
+
+		stored, err := repo.GetByAttributeIndex(context.Background(), model.AttributeTypeLdap, "7b1e4f0c-8f55-4d42-a3c5-3c1f3d5e9a10")
+		require.NoError(t, err)
+		require.NotNil(t, stored)
+		assert.Equal(t, userId, stored.ID)
+		assert.Equal(t, "jane@example.com", stored.GetEmailAddress())
+	})
+
+	t.Run("next login loads the user", func(t *testing.T) {
+		state, result, err := login("jane", "jane-secret")
+		require.NoError(t, err)
+		assert.Equal(t, CONDITION_LDAP_SUCCESS, result.Condition)
+		assert.Equal(t, userId, state.User.ID)
+		assert.Equal(t, []string{model.AuthMethodPassword}, state.AuthMethods)
+	})
+
+	t.Run("changed attributes are updated", func(t *testing.T) {
+		server.AddEntry("uid=jane,ou=people,dc=example,dc=com", "jane-secret", map[string][]string{
+			"objectClass": {"inetOrgPerson", "person"},
+			"uid":         {"jane"},
+			"entryUUID":   {"7b1e4f0c-8f55-4d42-a3c5-3c1f3d5e9a10"},
+			"mail":        {"jane.doe@example.com"},
+			"cn":          {"Jane Doe"},
+		})
+
+		state, result, err := login("jane", "jane-secret")
+		require.NoError(t, err)
+		assert.Equal(t, CONDITION_LDAP_SUCCESS, result.Condition)
+
+		stored, err := repo.GetByID(context.Background(), state.User.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "jane.doe@example.com", stored.GetEmailAddress())
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		state, result, err := login("jane", "wrong")
+		require.NoError(t, err)
+		assert.Equal(t, CONDITION_LDAP_FAIL, result.Condition)
+		assert.Nil(t, state.User)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		_, result, err := login("john", "secret")
+		require.NoError(t, err)
+		assert.Equal(t, CONDITION_LDAP_FAIL, result.Condition)
+	})
+
+	t.Run("directory unavailable", func(t *testing.T) {
+		unavailable := &model.GraphNode{Name: "ldapBind", Use: "ldapBind", CustomConfig: map[string]string{
+			ldap.SettingUrl:    "ldap://127.0.0.1:1",
+			ldap.SettingBaseDn: "dc=example,dc=com",
+		}}
+		state := &model.AuthenticationSession{Context: map[string]string{"username": "jane", "password": "jane-secret"}}
+
+		_, err := RunLdapBindNode(state, unavailable, nil, services)
+		var nodeError *model.NodeError
+		require.True(t, errors.As(err, &nodeError))
+		assert.Equal(t, model.ErrorClassTransient, nodeError.Class)
+		assert.Equal(t, ERROR_CODE_DIRECTORY_UNAVAILABLE, nodeError.Code)
+	})
+}
@@ -53,6 +53,7 @@ var GenericOIDCLoginNode = &model.NodeDefinition{
 	},
 	OutputContext:        []string{"oidcLoginResult"},
 	PossibleResultStates: []string{CONDITION_OIDC_FAILURE, CONDITION_OIDC_NEW_USER, CONDITION_OIDC_EXISTING_USER},
+	DirectConnections:    true,
 	PossiblePrompts: map[string]string{
 		"__redirect": "The redirect url to the OIDC provider",
 		"code":       "The code from the OIDC provider",
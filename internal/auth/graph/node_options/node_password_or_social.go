@@ -18,19 +18,24 @@ var PasswordOrSocialLoginNode = &model.NodeDefinition{
 	OutputContext:        []string{"username", "password"},
 	PossibleResultStates: []string{"password", "forgotPassword", "passkey", "social1", "social2", "social3", "register"},
 	CustomConfigOptions: map[string]string{
-		"showRegistrationLink": "if 'true' then show registration link, otherwise hide it",
-		"useUsername":          "if 'true' then show username input, otherwise hide it",
-		"useEmail":             "if 'true' then show email input, otherwise will as for username as input",
-		"usePassword":          "if 'true' then show password input, otherwise hide it",
-		"usePasskeys":          "if 'true' then show passkeys input (including discovery), otherwise hide it",
-		"showForgotPassword":   "if 'true' then show forgot password input, otherwise hide it",
-		"disableSubmit":        "if 'true' then hide submit button, otherwise show it",
-		"disablePasskeyBtn":    "if 'true' then hide passkey button, otherwise show it",
-		"social1":              "If set shows the login button for the social login provider 1 with the specified provider name.",
-		"social2":              "If set shows the login button for the social login provider 2 with the specified provider name.",
-		"social3":              "If set shows the login button for the social login provider 3 with the specified provider name.",
-		"title":                "Title of the login form",
-		"message":              "Message of the login form",
+		"showRegistrationLink":  "if 'true' then show registration link, otherwise hide it",
+		"useUsername":           "if 'true' then show username input, otherwise hide it",
+		"useEmail":              "if 'true' then show email input, otherwise will as for username as input",
+		"usePassword":           "if 'true' then show password input, otherwise hide it",
+		"usePasskeys":           "if 'true' then show passkeys input (including discovery), otherwise hide it",
+		"showForgotPassword":    "if 'true' then show forgot password input, otherwise hide it",
+		"disableSubmit":         "if 'true' then hide submit button, otherwise show it",
+		"disablePasskeyBtn":     "if 'true' then hide passkey button, otherwise show it",
+		"social1":               "If set shows the login button for the social login provider 1 with the specified provider name.",
+		"social2":               "If set shows the login button for the social login provider 2 with the specified provider name.",
+		"social3":               "If set shows the login button for the social login provider 3 with the specified provider name.",
+		"title":                 "Title of the login form",
+		"message":               "Message of the login form",
+		"disableDivider":        "if 'true' then hide the divider between the login form and the social login buttons",
+		"or-continue-with-text": "Text of the divider between the login form and the social login buttons",
+		"submit-btn-text":       "Text of the submit button",
+		"passkey-btn-text":      "Text of the passkey button",
+		"register-btn-text":     "Text of the registration link",
 	},
 	Run: RunPasswordOrSocialLoginNode,
 }
@@ -135,7 +135,7 @@ func ProcessPasskeyLogin(state *model.AuthenticationSession, node *model.GraphNo
 	}
 
 	// Validate the passkey login
-	_, err = webAuth.ValidateLogin(userCredentials, session, parsedCredential)
+	credential, err := webAuth.ValidateLogin(userCredentials, session, parsedCredential)
 	if err != nil {
 		return "failure", fmt.Errorf("passkey login failed: %w", err)
 	}
@@ -149,8 +149,13 @@ func ProcessPasskeyLogin(state *model.AuthenticationSession, node *model.GraphNo
 		return "failure", fmt.Errorf("failed to update passkey attribute: %w", err)
 	}
 
-	// Set the user in the state
+	// Set the user in the state, passkeys that can be synced are not bound to the hardware of a device
 	state.User = user
+	if credential.Flags.BackupEligible {
+		state.AddAuthMethod(model.AuthMethodSoftwareKey)
+	} else {
+		state.AddAuthMethod(model.AuthMethodHardwareKey)
+	}
 
 	log.Debug().Str("user_id", user.ID).Msg("user successfully verified via passkey")
 	return "success", nil
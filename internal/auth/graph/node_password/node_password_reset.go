@@ -0,0 +1,275 @@
+package node_password
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_utils"
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	RESET_TOKEN_PARAM = "reset_token" // Query parameter that carries the token of the reset link
+
+	RESET_OPTION_CHANNEL              = "channel"
+	RESET_OPTION_TOKEN_LIFETIME       = "token_lifetime_seconds"
+	RESET_OPTION_MAX_PER_IDENTIFIER   = "max_requests_per_identifier"
+	RESET_OPTION_MAX_PER_IP           = "max_requests_per_ip"
+	RESET_OPTION_RATE_LIMIT_WINDOW    = "rate_limit_window_seconds"
+	RESET_OPTION_LINK_URI             = "link_uri"
+	RESET_OPTION_SMS_MESSAGE          = "message"
+	RESET_OPTION_DEFAULT_COUNTRY_CODE = "default_country_code"
+
+	DEFAULT_RESET_SMS_MESSAGE = "Reset your password: {{link}}"
+
+	MSG_INVALID_RESET_TOKEN = "The password reset link is invalid or has expired"
+)
+
+var RequestPasswordResetNode = &model.NodeDefinition{
+	Name:                 "requestPasswordReset",
+	PrettyName:           "Request Password Reset",
+	Description:          "Sends a single-use password reset link to context['email'] or context['phone'] depending on the channel. The result is always 'sent', regardless of whether a user exists or the request was rate limited, so the node cannot be used to find out which accounts exist.",
+	Category:             "User Management",
+	Type:                 model.NodeTypeLogic,
+	RequiredContext:      []string{},
+	OutputContext:        []string{},
+	PossibleResultStates: []string{"sent"},
+	CustomConfigOptions: map[string]string{
+		RESET_OPTION_CHANNEL:              "How the link is delivered: 'email' uses context['email'], 'sms' uses context['phone']. Default email",
+		RESET_OPTION_TOKEN_LIFETIME:       "The number of seconds the link is valid. Default 900",
+		RESET_OPTION_MAX_PER_IDENTIFIER:   "Maximum number of reset requests per email address or phone number within the rate limit window. Default 3",
+		RESET_OPTION_MAX_PER_IP:           "Maximum number of reset requests per client ip within the rate limit window. Default 10",
+		RESET_OPTION_RATE_LIMIT_WINDOW:    "The rate limit window in seconds. Default 3600",
+		RESET_OPTION_LINK_URI:             "The uri of the flow that verifies the token, the token is added as reset_token query parameter. Default is the current flow",
+		RESET_OPTION_SMS_MESSAGE:          "Text of the SMS, {{link}} is replaced by the link. Default: " + DEFAULT_RESET_SMS_MESSAGE,
+		RESET_OPTION_DEFAULT_COUNTRY_CODE: "Country calling code for phone numbers in the context without one, e.g. 41",
+	},
+	Run: RunRequestPasswordResetNode,
+}
+
+var VerifyPasswordResetTokenNode = &model.NodeDefinition{
+	Name:                 "verifyPasswordResetToken",
+	PrettyName:           "Verify Password Reset Token",
+	Description:          "Verifies the token of a password reset link and loads the user it was issued for. The token is taken from the reset_token query parameter of the link or can be entered by the user. Opening the link asks the user to confirm, the token is only used with the confirmation so that links prefetched by email scanners stay valid. A token can only be used once.",
+	Category:             "User Management",
+	Type:                 model.NodeTypeQueryWithLogic,
+	RequiredContext:      []string{},
+	PossiblePrompts:      map[string]string{RESET_TOKEN_PARAM: "text"},
+	OutputContext:        []string{"user"},
+	PossibleResultStates: []string{"valid", "invalid"},
+	Run:                  RunVerifyPasswordResetTokenNode,
+}
+
+func RunRequestPasswordResetNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+
+	if services.PasswordResetRepo == nil {
+		return model.NewNodeResultWithError(errors.New("password reset is not configured"))
+	}
+
+	channel := node.CustomConfig[RESET_OPTION_CHANNEL]
+	if channel == "" {
+		channel = model.PasswordResetChannelEmail
+	}
+
+	lifetime, err := node_utils.IntOption(node, RESET_OPTION_TOKEN_LIFETIME, 900)
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+	maxPerIdentifier, err := node_utils.IntOption(node, RESET_OPTION_MAX_PER_IDENTIFIER, 3)
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+	maxPerIP, err := node_utils.IntOption(node, RESET_OPTION_MAX_PER_IP, 10)
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+	window, err := node_utils.IntOption(node, RESET_OPTION_RATE_LIMIT_WINDOW, 3600)
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+
+	identifier, attributeType, err := resetIdentifier(state, node, channel)
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+
+	requestIP := ""
+	if state.HttpAuthContext != nil {
+		requestIP = state.HttpAuthContext.RequestIP
+	}
+
+	ctx := context.Background()
+	since := time.Now().Add(-time.Duration(window) * time.Second)
+
+	byIdentifier, byIP, err := services.PasswordResetRepo.CountResetRequests(ctx, identifier, requestIP, since)
+	if err != nil {
+		return model.NewNodeResultWithError(fmt.Errorf("failed to count password reset requests: %w", err))
+	}
+
+	// Rate limited requests look the same as successful ones to the client
+	if byIdentifier >= maxPerIdentifier || (requestIP != "" && byIP >= maxPerIP) {
+		log.Info().Str("request_ip", requestIP).Msg("password reset request rate limited")
+		return model.NewNodeResultWithCondition("sent")
+	}
+
+	// The user is not added to the session, the reset flow must only continue with a verified token
+	user, err := services.UserRepo.GetByAttributeIndex(ctx, attributeType, identifier)
+	if err != nil {
+		return model.NewNodeResultWithError(fmt.Errorf("failed to load user: %w", err))
+	}
+
+	// Requests for unknown users are recorded as well so that they count towards the rate limits
+	request := &model.PasswordResetRequest{
+		Identifier: identifier,
+		RequestIP:  requestIP,
+		Channel:    channel,
+		Lifetime:   time.Duration(lifetime) * time.Second,
+	}
+	if user != nil {
+		request.UserID = user.ID
+	}
+
+	token, err := services.PasswordResetRepo.CreateResetToken(ctx, request)
+	if err != nil {
+		return model.NewNodeResultWithError(fmt.Errorf("failed to create password reset token: %w", err))
+	}
+
+	if user == nil {
+		log.Debug().Msg("password reset requested for unknown user")
+		return model.NewNodeResultWithCondition("sent")
+	}
+
+	linkUri := node.CustomConfig[RESET_OPTION_LINK_URI]
+	if linkUri == "" {
+		linkUri = state.LoginUriBase
+	}
+	link := linkUri + "?" + RESET_TOKEN_PARAM + "=" + url.QueryEscape(token)
+
+	// The link is sent in the background so that neither the response time nor an error of the sender reveal
+	// that the account exists
+	go func() {
+		if err := sendResetLink(identifier, channel, link, lifetime, node, services); err != nil {
+			log.Error().Err(err).Msg("failed to send password reset link")
+		}
+	}()
+
+	return model.NewNodeResultWithCondition("sent")
+}
+
+func RunVerifyPasswordResetTokenNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+
+	if services.PasswordResetRepo == nil {
+		return model.NewNodeResultWithError(errors.New("password reset is not configured"))
+	}
+
+	// The token is either part of the link that started the flow or entered by the user
+	token := input[RESET_TOKEN_PARAM]
+	if token == "" && state.HttpAuthContext != nil {
+		token = state.HttpAuthContext.RequestQuery[RESET_TOKEN_PARAM]
+	}
+
+	if token == "" {
+		return model.NewNodeResultWithPrompts(map[string]string{RESET_TOKEN_PARAM: "text"})
+	}
+
+	// Opening the link only shows a confirmation, email scanners that prefetch links must not use up the token.
+	// The token is used once the user confirms with a POST.
+	if state.HttpAuthContext != nil && state.HttpAuthContext.RequestMethod == http.MethodGet {
+		return model.NewNodeResultWithPrompts(map[string]string{RESET_TOKEN_PARAM: "confirm"})
+	}
+
+	ctx := context.Background()
+
+	resetToken, err := services.PasswordResetRepo.ConsumeResetToken(ctx, token)
+	if err != nil {
+		return model.NewNodeResultWithError(fmt.Errorf("failed to verify password reset token: %w", err))
+	}
+
+	if resetToken == nil {
+		state.Context["message"] = MSG_INVALID_RESET_TOKEN
+		return model.NewNodeResultWithCondition("invalid")
+	}
+
+	user, err := services.UserRepo.GetByID(ctx, resetToken.UserID)
+	if err != nil {
+		return model.NewNodeResultWithError(fmt.Errorf("failed to load user: %w", err))
+	}
+
+	// The user was deleted after the link was sent
+	if user == nil {
+		state.Context["message"] = MSG_INVALID_RESET_TOKEN
+		return model.NewNodeResultWithCondition("invalid")
+	}
+
+	state.User = user
+	return model.NewNodeResultWithCondition("valid")
+}
+
+// resetIdentifier returns the email address or phone number for the channel and the attribute type to look up the user
+func resetIdentifier(state *model.AuthenticationSession, node *model.GraphNode, channel string) (string, string, error) {
+
+	switch channel {
+	case model.PasswordResetChannelEmail:
+		email := strings.TrimSpace(state.Context["email"])
+		if email == "" {
+			return "", "", errors.New("email must be provided before running this node")
+		}
+		return email, model.AttributeTypeEmail, nil
+
+	case model.PasswordResetChannelSMS:
+		if state.Context["phone"] == "" {
+			return "", "", errors.New("phone must be provided before running this node")
+		}
+		phone, err := lib.NormalizePhoneNumber(state.Context["phone"], node.CustomConfig[RESET_OPTION_DEFAULT_COUNTRY_CODE])
+		if err != nil {
+			return "", "", err
+		}
+		return phone, model.AttributeTypePhone, nil
+
+	default:
+		return "", "", fmt.Errorf("unsupported password reset channel %s", channel)
+	}
+}
+
+func sendResetLink(identifier string, channel string, link string, lifetime int, node *model.GraphNode, services *model.Repositories) error {
+
+	if channel == model.PasswordResetChannelSMS {
+
+		if services.SMSSender == nil {
+			return errors.New("no sms sender configured")
+		}
+
+		message := DEFAULT_RESET_SMS_MESSAGE
+		if node.CustomConfig[RESET_OPTION_SMS_MESSAGE] != "" {
+			message = node.CustomConfig[RESET_OPTION_SMS_MESSAGE]
+		}
+
+		return services.SMSSender.SendSMS(&model.SendSMSParams{
+			Template: "sms-password-reset",
+			To:       identifier,
+			Message:  strings.ReplaceAll(message, "{{link}}", link),
+			Params: map[string]any{
+				"link": link,
+			},
+		})
+	}
+
+	return services.EmailSender.SendEmail(&model.SendEmailParams{
+		Template: "password-reset",
+		To: []model.EmailAddress{
+			{Email: identifier},
+		},
+		Params: map[string]any{
+			"link":               link,
+			"expires_in_minutes": int(math.Ceil(float64(lifetime) / 60)),
+		},
+	})
+}
@@ -0,0 +1,203 @@
+package node_password
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/auth/repository"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/Identityplane/GoAM/pkg/model/attributes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newPasswordResetTest() (*model.Repositories, *repository.MockUserRepository, *repository.MockPasswordResetRepository, *repository.MockEmailSender) {
+	mockUserRepo := repository.NewMockUserRepository()
+	mockResetRepo := repository.NewMockPasswordResetRepository()
+	mockEmailSender := repository.NewMockEmailSender()
+
+	return &model.Repositories{
+		UserRepo:          mockUserRepo,
+		PasswordResetRepo: mockResetRepo,
+		EmailSender:       mockEmailSender,
+	}, mockUserRepo, mockResetRepo, mockEmailSender
+}
+
+func newResetSession() *model.AuthenticationSession {
+	return &model.AuthenticationSession{
+		LoginUriBase:    "https://example.com/acme/customers/auth/reset",
+		Context:         map[string]string{"email": "alice@example.com"},
+		HttpAuthContext: &model.HttpAuthContext{RequestIP: "10.0.0.1"},
+	}
+}
+
+func TestRequestPasswordReset_KnownUser(t *testing.T) {
+	services, userRepo, resetRepo, emailSender := newPasswordResetTest()
+	session := newResetSession()
+
+	userRepo.On("GetByAttributeIndex", mock.Anything, model.AttributeTypeEmail, "alice@example.com").Return(&model.User{ID: "user-1"}, nil)
+	resetRepo.On("CountResetRequests", mock.Anything, "alice@example.com", "10.0.0.1", mock.Anything).Return(0, 0, nil)
+	resetRepo.On("CreateResetToken", mock.Anything, mock.MatchedBy(func(r *model.PasswordResetRequest) bool {
+		return r.UserID == "user-1" && r.RequestIP == "10.0.0.1" && r.Lifetime == 15*time.Minute
+	})).Return("secret-token", nil)
+
+	emails := make(chan *model.SendEmailParams, 1)
+	emailSender.On("SendEmail", mock.Anything).Run(func(args mock.Arguments) {
+		emails <- args.Get(0).(*model.SendEmailParams)
+	}).Return(nil)
+
+	result, err := RunRequestPasswordResetNode(session, &model.GraphNode{CustomConfig: map[string]string{}}, map[string]string{}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "sent", result.Condition)
+	assert.Nil(t, session.User)
+
+	// The link is sent in the background
+	var sent *model.SendEmailParams
+	select {
+	case sent = <-emails:
+	case <-time.After(time.Second):
+		t.Fatal("no email was sent")
+	}
+	assert.Equal(t, "password-reset", sent.Template)
+	assert.Equal(t, "https://example.com/acme/customers/auth/reset?reset_token=secret-token", sent.Params["link"])
+	assert.Equal(t, 15, sent.Params["expires_in_minutes"])
+}
+
+func TestRequestPasswordReset_UnknownUserIsIndistinguishable(t *testing.T) {
+	services, userRepo, resetRepo, emailSender := newPasswordResetTest()
+	session := newResetSession()
+
+	userRepo.On("GetByAttributeIndex", mock.Anything, model.AttributeTypeEmail, "alice@example.com").Return(nil, nil)
+	resetRepo.On("CountResetRequests", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(0, 0, nil)
+	resetRepo.On("CreateResetToken", mock.Anything, mock.MatchedBy(func(r *model.PasswordResetRequest) bool {
+		return r.UserID == ""
+	})).Return("never-sent", nil)
+
+	result, err := RunRequestPasswordResetNode(session, &model.GraphNode{CustomConfig: map[string]string{}}, map[string]string{}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "sent", result.Condition)
+
+	// The request is recorded for the rate limit but nothing is sent
+	resetRepo.AssertCalled(t, "CreateResetToken", mock.Anything, mock.Anything)
+	emailSender.AssertNotCalled(t, "SendEmail", mock.Anything)
+}
+
+func TestRequestPasswordReset_SenderErrorIsNotReported(t *testing.T) {
+	services, userRepo, resetRepo, emailSender := newPasswordResetTest()
+	session := newResetSession()
+
+	userRepo.On("GetByAttributeIndex", mock.Anything, model.AttributeTypeEmail, "alice@example.com").Return(&model.User{ID: "user-1"}, nil)
+	resetRepo.On("CountResetRequests", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(0, 0, nil)
+	resetRepo.On("CreateResetToken", mock.Anything, mock.Anything).Return("secret-token", nil)
+
+	attempted := make(chan struct{})
+	emailSender.On("SendEmail", mock.Anything).Run(func(args mock.Arguments) {
+		close(attempted)
+	}).Return(errors.New("smtp server unavailable"))
+
+	// Existing users get the same result as unknown ones even if the email cannot be sent
+	result, err := RunRequestPasswordResetNode(session, &model.GraphNode{CustomConfig: map[string]string{}}, map[string]string{}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "sent", result.Condition)
+
+	select {
+	case <-attempted:
+	case <-time.After(time.Second):
+		t.Fatal("the email was not sent")
+	}
+}
+
+func TestRequestPasswordReset_RateLimited(t *testing.T) {
+	services, _, resetRepo, emailSender := newPasswordResetTest()
+	session := newResetSession()
+	node := &model.GraphNode{CustomConfig: map[string]string{RESET_OPTION_MAX_PER_IP: "5"}}
+
+	resetRepo.On("CountResetRequests", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(0, 5, nil)
+
+	result, err := RunRequestPasswordResetNode(session, node, map[string]string{}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "sent", result.Condition)
+
+	resetRepo.AssertNotCalled(t, "CreateResetToken", mock.Anything, mock.Anything)
+	emailSender.AssertNotCalled(t, "SendEmail", mock.Anything)
+}
+
+func TestVerifyPasswordResetToken(t *testing.T) {
+	services, userRepo, resetRepo, _ := newPasswordResetTest()
+	user := &model.User{ID: "user-1"}
+
+	resetRepo.On("ConsumeResetToken", mock.Anything, "valid-token").Return(&model.PasswordResetToken{UserID: "user-1"}, nil).Once()
+	resetRepo.On("ConsumeResetToken", mock.Anything, mock.Anything).Return(nil, nil)
+	userRepo.On("GetByID", mock.Anything, "user-1").Return(user, nil)
+
+	node := &model.GraphNode{CustomConfig: map[string]string{}}
+
+	// Without a token the user is asked for it
+	session := &model.AuthenticationSession{Context: map[string]string{}, HttpAuthContext: &model.HttpAuthContext{}}
+	result, err := RunVerifyPasswordResetTokenNode(session, node, map[string]string{}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "text", result.Prompts[RESET_TOKEN_PARAM])
+
+	// Opening the link asks for a confirmation, the token is not used yet
+	session.HttpAuthContext.RequestMethod = http.MethodGet
+	session.HttpAuthContext.RequestQuery = map[string]string{RESET_TOKEN_PARAM: "valid-token"}
+	result, err = RunVerifyPasswordResetTokenNode(session, node, map[string]string{}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "confirm", result.Prompts[RESET_TOKEN_PARAM])
+	assert.Nil(t, session.User)
+	resetRepo.AssertNotCalled(t, "ConsumeResetToken", mock.Anything, mock.Anything)
+
+	// The confirmation uses the token
+	session.HttpAuthContext = &model.HttpAuthContext{RequestMethod: http.MethodPost}
+	result, err = RunVerifyPasswordResetTokenNode(session, node, map[string]string{RESET_TOKEN_PARAM: "valid-token"}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "valid", result.Condition)
+	assert.Equal(t, user, session.User)
+
+	// Tokens are single-use
+	session = &model.AuthenticationSession{Context: map[string]string{}}
+	result, err = RunVerifyPasswordResetTokenNode(session, node, map[string]string{RESET_TOKEN_PARAM: "valid-token"}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "invalid", result.Condition)
+	assert.Nil(t, session.User)
+	assert.Equal(t, MSG_INVALID_RESET_TOKEN, session.Context["message"])
+}
+
+func TestUpdatePasswordNode_RevokeSessions(t *testing.T) {
+	services, userRepo, resetRepo, _ := newPasswordResetTest()
+	now := time.Now()
+
+	user := &model.User{ID: "user-1"}
+	user.AddAttribute(&model.UserAttribute{
+		Type: model.AttributeTypeDevice,
+		Value: model.DeviceAttributeValue{
+			DeviceID:    "device-1",
+			SessionLoa0: *attributes.InitSession(now, attributes.DEFAULT_LOA_TO_EXPIRY_MAPPINGS[0]),
+			SessionLoa1: attributes.InitSession(now, attributes.DEFAULT_LOA_TO_EXPIRY_MAPPINGS[1]),
+			SessionLoa2: attributes.InitSession(now, attributes.DEFAULT_LOA_TO_EXPIRY_MAPPINGS[2]),
+		},
+	})
+
+	resetRepo.On("RevokeClientSessions", mock.Anything, "user-1").Return(2, nil)
+	userRepo.On("Update", mock.Anything, user).Return(nil)
+
+	session := &model.AuthenticationSession{Context: map[string]string{}, User: user}
+	node := &model.GraphNode{CustomConfig: map[string]string{UPDATE_PASSWORD_OPTION_REVOKE_SESSIONS: "true"}}
+
+	result, err := RunUpdatePasswordNode(session, node, map[string]string{"password": "newSecurePassword123!"}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "success", result.Condition)
+
+	device, _, err := model.GetAttribute[model.DeviceAttributeValue](user, model.AttributeTypeDevice)
+	require.NoError(t, err)
+	assert.Equal(t, "device-1", device.DeviceID)
+	assert.Nil(t, device.SessionLoa1)
+	assert.Nil(t, device.SessionLoa2)
+	assert.False(t, device.SessionLoa0.SessionExpiry.IsZero())
+
+	resetRepo.AssertExpectations(t)
+	userRepo.AssertExpectations(t)
+}
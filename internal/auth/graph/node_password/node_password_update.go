@@ -8,8 +8,11 @@ import (
 
 	"github.com/Identityplane/GoAM/internal/lib"
 	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/rs/zerolog/log"
 )
 
+const UPDATE_PASSWORD_OPTION_REVOKE_SESSIONS = "revoke_sessions"
+
 var UpdatePasswordNode = &model.NodeDefinition{
 	Name:                 "updatePassword",
 	PrettyName:           "Update Password",
@@ -18,8 +21,12 @@ var UpdatePasswordNode = &model.NodeDefinition{
 	Type:                 model.NodeTypeLogic,
 	RequiredContext:      []string{"user"},
 	OutputContext:        []string{}, // or we may skip outputs if conditions imply it
+	SensitiveContext:     []string{"password"},
 	PossibleResultStates: []string{"success", "fail"},
-	Run:                  RunUpdatePasswordNode,
+	CustomConfigOptions: map[string]string{
+		UPDATE_PASSWORD_OPTION_REVOKE_SESSIONS: "If true, all access and refresh tokens and the logged in device sessions of the user are revoked, e.g. after a password reset. Default false",
+	},
+	Run: RunUpdatePasswordNode,
 }
 
 func RunUpdatePasswordNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
@@ -81,6 +88,13 @@ func RunUpdatePasswordNode(state *model.AuthenticationSession, node *model.Graph
 		state.User.AddAttribute(passwordAttr)
 	}
 
+	if node.CustomConfig[UPDATE_PASSWORD_OPTION_REVOKE_SESSIONS] == "true" {
+		err = revokeUserSessions(state.User, services)
+		if err != nil {
+			return model.NewNodeResultWithError(err)
+		}
+	}
+
 	// Update the user in the database
 	err = services.UserRepo.Update(context.Background(), state.User)
 	if err != nil {
@@ -89,3 +103,31 @@ func RunUpdatePasswordNode(state *model.AuthenticationSession, node *model.Graph
 
 	return model.NewNodeResultWithCondition("success")
 }
+
+// revokeUserSessions deletes the client sessions of the user and logs out all devices. The devices stay known,
+// only the LOA1 and LOA2 sessions are removed. The device changes are saved together with the password.
+func revokeUserSessions(user *model.User, services *model.Repositories) error {
+
+	if services.PasswordResetRepo == nil {
+		return errors.New("cannot revoke sessions, password reset is not configured")
+	}
+
+	revoked, err := services.PasswordResetRepo.RevokeClientSessions(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke client sessions: %w", err)
+	}
+
+	devices, attributes, err := model.GetAttributes[model.DeviceAttributeValue](user, model.AttributeTypeDevice)
+	if err != nil {
+		return fmt.Errorf("failed to load devices: %w", err)
+	}
+
+	for i := range devices {
+		devices[i].SessionLoa1 = nil
+		devices[i].SessionLoa2 = nil
+		attributes[i].Value = devices[i]
+	}
+
+	log.Info().Str("user_id", user.ID).Int("client_sessions", revoked).Int("devices", len(devices)).Msg("revoked sessions after password update")
+	return nil
+}
@@ -19,6 +19,7 @@ var ValidateUsernamePasswordNode = &model.NodeDefinition{
 	Type:                 model.NodeTypeLogic,
 	RequiredContext:      []string{"user", "password"},
 	OutputContext:        []string{"auth_result"}, // or we may skip outputs if conditions imply it
+	SensitiveContext:     []string{"password"},
 	PossibleResultStates: []string{"success", "fail", "locked", "noPassword"},
 	CustomConfigOptions: map[string]string{
 		"max_failed_password_attempts": "Maximum number of failed password attempts before locking the user (default: 10)",
@@ -127,6 +128,7 @@ func RunValidateUsernamePasswordNode(state *model.AuthenticationSession, node *m
 
 	state.User = user
 	state.Context["auth_result"] = "success"
+	state.AddAuthMethod(model.AuthMethodPassword)
 
 	return model.NewNodeResultWithCondition("success")
 }
@@ -0,0 +1,47 @@
+package node_phone
+
+import (
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+const (
+	PHONE_OPTION_DEFAULT_COUNTRY_CODE = "default_country_code"
+
+	MSG_INVALID_PHONE = "Invalid phone number"
+)
+
+var AskPhoneNode = &model.NodeDefinition{
+	Name:            "askPhone",
+	PrettyName:      "Ask for Phone Number",
+	Description:     "Prompts the user to enter their phone number. The number is normalized to E.164 format, e.g. +41791234567",
+	Category:        "User Input",
+	Type:            model.NodeTypeQueryWithLogic,
+	RequiredContext: []string{},
+	OutputContext:   []string{"phone"},
+	PossiblePrompts: map[string]string{
+		"phone": "tel",
+	},
+	PossibleResultStates: []string{"submitted"},
+	CustomConfigOptions: map[string]string{
+		PHONE_OPTION_DEFAULT_COUNTRY_CODE: "Country calling code for numbers entered without one, e.g. 41. If not set the user must enter the number with the country code",
+	},
+	Run: RunAskPhoneNode,
+}
+
+func RunAskPhoneNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+
+	if input["phone"] == "" {
+		return model.NewNodeResultWithPrompts(map[string]string{"phone": "tel"})
+	}
+
+	phone, err := lib.NormalizePhoneNumber(input["phone"], node.CustomConfig[PHONE_OPTION_DEFAULT_COUNTRY_CODE])
+	if err != nil {
+		errMsg := MSG_INVALID_PHONE
+		state.Error = &errMsg
+		return model.NewNodeResultWithPrompts(map[string]string{"phone": "tel"})
+	}
+
+	state.Context["phone"] = phone
+	return model.NewNodeResultWithCondition("submitted")
+}
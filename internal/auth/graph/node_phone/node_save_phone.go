@@ -0,0 +1,96 @@
+package node_phone
+
+import (
+	"context"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_utils"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/google/uuid"
+)
+
+var SavePhoneNode = &model.NodeDefinition{
+	Name:                 "savePhone",
+	PrettyName:           "Save Phone Number",
+	Description:          "Saves the phone number to the user's attributes. The number is marked as verified if it was verified with an SMS OTP before",
+	Category:             "Phone",
+	Type:                 model.NodeTypeLogic,
+	RequiredContext:      []string{"phone"},
+	OutputContext:        []string{"phone"},
+	PossibleResultStates: []string{"success", "phone_taken"},
+	Run:                  RunSavePhoneNode,
+}
+
+func RunSavePhoneNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+
+	user, err := node_utils.LoadUserFromContext(state, services)
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+
+	phone := state.Context["phone"]
+
+	// Check if there is already a user that has this phone number but is a different user
+	otherUser, err := services.UserRepo.GetByAttributeIndex(context.Background(), model.AttributeTypePhone, phone)
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+
+	if otherUser != nil && otherUser.ID != user.ID {
+		errorMsg := "Phone number already in use"
+		state.Error = &errorMsg
+		return model.NewNodeResultWithCondition("phone_taken")
+	}
+
+	// Update the existing phone attribute or create a new one
+	existing, attribute, err := model.GetAttribute[model.PhoneAttributeValue](user, model.AttributeTypePhone)
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+
+	if attribute != nil {
+		// Merge into the existing value so that the OTP lock and the failed attempts are kept
+		value := *existing
+		if value.Phone != phone {
+			value.Verified = false
+			value.VerifiedAt = nil
+		}
+		value.Phone = phone
+		markPhoneVerified(state, &value)
+
+		attribute.Value = &value
+		attribute.Index = &phone
+
+		if err := services.UserRepo.UpdateUserAttribute(context.Background(), attribute); err != nil {
+			return model.NewNodeResultWithError(err)
+		}
+
+		return model.NewNodeResultWithCondition("success")
+	}
+
+	newPhoneValue := &model.PhoneAttributeValue{Phone: phone}
+	markPhoneVerified(state, newPhoneValue)
+
+	attribute = &model.UserAttribute{
+		ID:    uuid.NewString(),
+		Type:  model.AttributeTypePhone,
+		Value: newPhoneValue,
+		Index: &phone,
+	}
+	user.AddAttribute(attribute)
+
+	if err := services.UserRepo.CreateUserAttribute(context.Background(), attribute); err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+
+	return model.NewNodeResultWithCondition("success")
+}
+
+// markPhoneVerified marks the phone number as verified if it was verified with an SMS OTP in this flow
+func markPhoneVerified(state *model.AuthenticationSession, value *model.PhoneAttributeValue) {
+	if state.Context["phone_verified"] == "true" {
+		now := time.Now()
+		value.Verified = true
+		value.VerifiedAt = &now
+	}
+}
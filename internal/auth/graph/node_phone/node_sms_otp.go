@@ -0,0 +1,344 @@
+package node_phone
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_utils"
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+const (
+	SMS_OTP_OPTION_MAX_ATTEMPTS = "max_attempts"
+	SMS_OTP_OPTION_INIT_USER    = "init_user"
+	SMS_OTP_OPTION_MESSAGE      = "message"
+	SMS_RESEND_IN_SECONDS       = "resend_in_seconds"
+
+	MSG_INVALID_OTP     = "Invalid OTP"
+	MSG_RESEND_TOO_SOON = "You cannot resent the OTP yet"
+	MSG_OTP_LOCKED      = "Too many failed attempts"
+
+	DEFAULT_SMS_OTP_MESSAGE = "Your verification code is {{otp}}"
+
+	CONDITION_SUCCESS_REGISTERED_PHONE   = "success-registered-phone"   // The phone number belongs to the user and was verified
+	CONDITION_SUCCESS_NEW_PHONE_FOR_USER = "success-new-phone-for-user" // The phone number is not yet linked to the user
+	CONDITION_SUCCESS_UNKNOWN_PHONE      = "success-unknown-phone"      // There was no user found that has this phone number
+	CONDITION_LOCKED                     = "locked"                     // The maximum number of failed attempts was reached
+)
+
+var SMSOTPNode = &model.NodeDefinition{
+	Name:                 "smsOTP",
+	PrettyName:           "SMS OTP Verification",
+	Description:          "Sends a one-time password via SMS and verifies the user's response. If this phone number belongs to a user we increase the failed attempts counter and lock the phone number once the maximum is reached. If no user is found there is no limit to the number of attempts. In that case the node should be behind a captcha or similar.",
+	Category:             "Multi-Factor Authentication",
+	Type:                 model.NodeTypeQueryWithLogic,
+	RequiredContext:      []string{"phone"},
+	PossiblePrompts:      map[string]string{"otp": "number", "option": "resend", "phone": "tel"},
+	OutputContext:        []string{"phone_verified"},
+	SensitiveContext:     []string{"sms_otp"},
+	PossibleResultStates: []string{CONDITION_SUCCESS_REGISTERED_PHONE, CONDITION_SUCCESS_NEW_PHONE_FOR_USER, CONDITION_SUCCESS_UNKNOWN_PHONE, CONDITION_LOCKED},
+	CustomConfigOptions: map[string]string{
+		SMS_OTP_OPTION_MAX_ATTEMPTS:       "Maximum number of failed attempts before locking the phone number of the user (default: 10)",
+		SMS_OTP_OPTION_INIT_USER:          "If true, the node will initialize the user if no user is found in the context. Default false",
+		SMS_OTP_OPTION_MESSAGE:            "Text of the SMS, {{otp}} is replaced by the code. Default: " + DEFAULT_SMS_OTP_MESSAGE,
+		SMS_RESEND_IN_SECONDS:             "The number of seconds to wait before resending the OTP. Default 30",
+		PHONE_OPTION_DEFAULT_COUNTRY_CODE: "Country calling code for phone numbers in the context without one, e.g. 41",
+	},
+	Run: RunSMSOTPNode,
+}
+
+func RunSMSOTPNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+
+	// Get the phone number that we are using for this node
+	phone, user, err := getPhoneNumber(state, node, services)
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+
+	// If we don't have a phone number we fail
+	if phone == "" {
+		return model.NewNodeResultWithError(errors.New("phone must be provided before running this node"))
+	}
+
+	// Max attempts for the OTP
+	maxAttempts := 10
+	if v, ok := node.CustomConfig[SMS_OTP_OPTION_MAX_ATTEMPTS]; ok {
+		maxAttempts, err = strconv.Atoi(v)
+		if err != nil || maxAttempts <= 0 {
+			return model.NewNodeResultWithError(model.NewInternalError(model.ErrorCodeInvalidConfig, fmt.Errorf("invalid %s '%s' of node '%s'", SMS_OTP_OPTION_MAX_ATTEMPTS, v, node.Name)))
+		}
+	}
+	resendInSeconds := 30
+	if node.CustomConfig[SMS_RESEND_IN_SECONDS] != "" {
+		resendInSeconds, err = strconv.Atoi(node.CustomConfig[SMS_RESEND_IN_SECONDS])
+		if err != nil {
+			return model.NewNodeResultWithError(model.NewInternalError(model.ErrorCodeInvalidConfig, fmt.Errorf("invalid %s '%s' of node '%s'", SMS_RESEND_IN_SECONDS, node.CustomConfig[SMS_RESEND_IN_SECONDS], node.Name)))
+		}
+	}
+
+	// A locked phone number cannot be used until an administrator unlocks it
+	if isPhoneLocked(phone, user, maxAttempts) {
+		errMsg := MSG_OTP_LOCKED
+		state.Error = &errMsg
+		return model.NewNodeResultWithCondition(CONDITION_LOCKED)
+	}
+
+	// OTP challenge stored on the server
+	otpChallenge := state.Context["sms_otp"]
+
+	// If we have no OTP challenge we generate a new one
+	if otpChallenge == "" {
+
+		otpChallenge = generateOTP()
+		if err := sendSMSOTP(phone, otpChallenge, node, services, state, resendInSeconds); err != nil {
+			return model.NewNodeResultWithError(err)
+		}
+		state.Context["sms_otp"] = otpChallenge
+
+		return otpPrompt(phone, state)
+	} else if input["option"] == "resend" {
+
+		resendAt, err := time.Parse(time.RFC3339, state.Context["sms_resend_at"])
+
+		if err != nil || time.Now().After(resendAt) {
+
+			if err := sendSMSOTP(phone, otpChallenge, node, services, state, resendInSeconds); err != nil {
+				return model.NewNodeResultWithError(err)
+			}
+			state.Context["message"] = ""
+		} else {
+			state.Context["message"] = MSG_RESEND_TOO_SOON
+		}
+
+		return otpPrompt(phone, state)
+	} else if input["otp"] == "" {
+		return otpPrompt(phone, state)
+	}
+
+	// If we have an otp we verify it
+	if input["otp"] != otpChallenge {
+
+		state.Context["message"] = MSG_INVALID_OTP
+		locked, err := increaseOTPFailedAttempts(phone, user, maxAttempts, services)
+		if err != nil {
+			return model.NewNodeResultWithError(err)
+		}
+
+		if locked {
+			errMsg := MSG_OTP_LOCKED
+			state.Error = &errMsg
+			return model.NewNodeResultWithCondition(CONDITION_LOCKED)
+		}
+
+		// We ask again for the OTP but dont send a new sms
+		return otpPrompt(phone, state)
+	}
+
+	state.Context["message"] = ""
+	state.Context["phone_verified"] = "true"
+
+	if user != nil {
+
+		if hasPhoneNumber(user, phone) {
+
+			// If the phone number is registered to the user we register the verification
+			if err := registerSuccessfulVerification(phone, user, services); err != nil {
+				return model.NewNodeResultWithError(err)
+			}
+
+			state.AddAuthMethod(model.AuthMethodSms)
+			return model.NewNodeResultWithCondition(CONDITION_SUCCESS_REGISTERED_PHONE)
+		}
+
+		return model.NewNodeResultWithCondition(CONDITION_SUCCESS_NEW_PHONE_FOR_USER)
+	}
+
+	if node.CustomConfig[SMS_OTP_OPTION_INIT_USER] == "true" {
+		user, err := services.UserRepo.NewUserModel(state)
+		if err != nil {
+			return model.NewNodeResultWithError(err)
+		}
+
+		// add a new phone attribute with the verified phone number
+		now := time.Now()
+		user.AddAttribute(&model.UserAttribute{
+			Type:  model.AttributeTypePhone,
+			Index: lib.StringPtr(phone),
+			Value: model.PhoneAttributeValue{
+				Phone:      phone,
+				Verified:   true,
+				VerifiedAt: &now,
+			},
+		})
+
+		state.User = user
+	}
+
+	return model.NewNodeResultWithCondition(CONDITION_SUCCESS_UNKNOWN_PHONE)
+}
+
+// generateOTP generates a random 6 digit OTP
+func generateOTP() string {
+
+	otp, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%06d", otp)
+}
+
+// sendSMSOTP sends an sms with the OTP to the phone number
+func sendSMSOTP(phone string, otp string, node *model.GraphNode, services *model.Repositories, state *model.AuthenticationSession, resendInSeconds int) error {
+
+	if services.SMSSender == nil {
+		return errors.New("no sms sender configured")
+	}
+
+	message := DEFAULT_SMS_OTP_MESSAGE
+	if node.CustomConfig[SMS_OTP_OPTION_MESSAGE] != "" {
+		message = node.CustomConfig[SMS_OTP_OPTION_MESSAGE]
+	}
+
+	resendAt := time.Now().Add(time.Duration(resendInSeconds) * time.Second)
+	state.Context["sms_resend_at"] = resendAt.Format(time.RFC3339)
+
+	return services.SMSSender.SendSMS(&model.SendSMSParams{
+		Template: "sms-otp",
+		To:       phone,
+		Message:  strings.ReplaceAll(message, "{{otp}}", otp),
+		Params: map[string]any{
+			"otp": otp,
+		},
+	})
+}
+
+// getPhoneNumber loads the phone number from the context or with second priority from the user attributes
+func getPhoneNumber(state *model.AuthenticationSession, node *model.GraphNode, services *model.Repositories) (string, *model.User, error) {
+
+	// Try to load the user from the context, if we have a user we count the failed attempts
+	user, err := node_utils.TryLoadUserFromContext(state, services)
+	if err != nil {
+		return "", nil, err
+	}
+
+	phone := state.Context["phone"]
+	if phone != "" {
+		phone, err = lib.NormalizePhoneNumber(phone, node.CustomConfig[PHONE_OPTION_DEFAULT_COUNTRY_CODE])
+		if err != nil {
+			return "", nil, err
+		}
+		return phone, user, nil
+	}
+
+	if user != nil {
+		phoneValue, _, err := model.GetAttribute[model.PhoneAttributeValue](user, model.AttributeTypePhone)
+		if err != nil {
+			return "", nil, errors.New("could not load phone from user attributes")
+		}
+		if phoneValue != nil {
+			phone = phoneValue.Phone
+		}
+	}
+
+	return phone, user, nil
+}
+
+// getPhoneAttribute returns the phone attribute of the user with the given phone number
+func getPhoneAttribute(phone string, user *model.User) (*model.PhoneAttributeValue, *model.UserAttribute, error) {
+
+	if user == nil {
+		return nil, nil, nil
+	}
+
+	values, attributes, err := model.GetAttributes[model.PhoneAttributeValue](user, model.AttributeTypePhone)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range values {
+		if values[i].Phone == phone {
+			return &values[i], attributes[i], nil
+		}
+	}
+
+	return nil, nil, nil
+}
+
+func hasPhoneNumber(user *model.User, phone string) bool {
+	value, _, err := getPhoneAttribute(phone, user)
+	return err == nil && value != nil
+}
+
+func isPhoneLocked(phone string, user *model.User, maxAttempts int) bool {
+	value, _, err := getPhoneAttribute(phone, user)
+	if err != nil || value == nil {
+		return false
+	}
+	return value.OtpLocked || value.OtpFailedAttempts >= maxAttempts
+}
+
+// increaseOTPFailedAttempts increases the failed attempts of the phone attribute and locks it once the
+// maximum is reached. Returns true if the phone number is locked.
+func increaseOTPFailedAttempts(phone string, user *model.User, maxAttempts int, services *model.Repositories) (bool, error) {
+
+	value, attribute, err := getPhoneAttribute(phone, user)
+	if err != nil || value == nil {
+		// Phone numbers that do not belong to a user are not counted
+		return false, err
+	}
+
+	value.OtpFailedAttempts++
+	if value.OtpFailedAttempts >= maxAttempts {
+		value.OtpLocked = true
+	}
+	attribute.Value = *value
+
+	if err := services.UserRepo.UpdateUserAttribute(context.Background(), attribute); err != nil {
+		return false, err
+	}
+
+	return value.OtpLocked, nil
+}
+
+// registerSuccessfulVerification marks the phone number as verified and resets the failed attempts
+func registerSuccessfulVerification(phone string, user *model.User, services *model.Repositories) error {
+
+	value, attribute, err := getPhoneAttribute(phone, user)
+	if err != nil || value == nil {
+		return err
+	}
+
+	value.OtpFailedAttempts = 0
+	value.OtpLocked = false
+
+	if !value.Verified {
+		now := time.Now()
+		value.Verified = true
+		value.VerifiedAt = &now
+	}
+
+	attribute.Value = *value
+	return services.UserRepo.UpdateUserAttribute(context.Background(), attribute)
+}
+
+func otpPrompt(phone string, state *model.AuthenticationSession) (*model.NodeResult, error) {
+
+	// Check how long the user needs to wait until they can request to resent the otp
+	resendAt, err := time.Parse(time.RFC3339, state.Context["sms_resend_at"])
+	if err != nil {
+		resendAt = time.Now()
+	}
+
+	secondToResend := int(math.Max(0, time.Until(resendAt).Seconds()))
+
+	return model.NewNodeResultWithPrompts(map[string]string{"otp": "number", "phone": phone, "resend_in_seconds": strconv.Itoa(secondToResend)})
+}
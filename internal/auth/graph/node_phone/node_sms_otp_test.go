@@ -0,0 +1,243 @@
+package node_phone
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/internal/auth/repository"
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestUserWithPhone(phone model.PhoneAttributeValue) *model.User {
+	user := &model.User{ID: "123", Tenant: "acme", Realm: "customers"}
+	user.AddAttribute(&model.UserAttribute{
+		ID:    "phone-1",
+		Type:  model.AttributeTypePhone,
+		Index: lib.StringPtr(phone.Phone),
+		Value: phone,
+	})
+	return user
+}
+
+func TestAskPhone_NormalizesNumber(t *testing.T) {
+	node := &model.GraphNode{CustomConfig: map[string]string{PHONE_OPTION_DEFAULT_COUNTRY_CODE: "41"}}
+	session := &model.AuthenticationSession{Context: map[string]string{}}
+
+	result, err := RunAskPhoneNode(session, node, map[string]string{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "tel", result.Prompts["phone"])
+
+	result, err = RunAskPhoneNode(session, node, map[string]string{"phone": "not a number"}, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, result.Prompts)
+	assert.Equal(t, MSG_INVALID_PHONE, *session.Error)
+
+	result, err = RunAskPhoneNode(session, node, map[string]string{"phone": "079 123 45 67"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "submitted", result.Condition)
+	assert.Equal(t, "+41791234567", session.Context["phone"])
+}
+
+func TestSMSOTP_RegisteredPhone(t *testing.T) {
+	mockUserRepo := repository.NewMockUserRepository()
+	mockSMSSender := repository.NewMockSMSSender()
+	services := &model.Repositories{
+		UserRepo:  mockUserRepo,
+		SMSSender: mockSMSSender,
+	}
+
+	node := &model.GraphNode{CustomConfig: map[string]string{}}
+	session := &model.AuthenticationSession{
+		Context: map[string]string{"phone": "+41791234567"},
+		User:    newTestUserWithPhone(model.PhoneAttributeValue{Phone: "+41791234567", OtpFailedAttempts: 2}),
+	}
+
+	var sent *model.SendSMSParams
+	mockSMSSender.On("SendSMS", mock.AnythingOfType("*model.SendSMSParams")).Run(func(args mock.Arguments) {
+		sent = args.Get(0).(*model.SendSMSParams)
+	}).Return(nil).Once()
+	mockUserRepo.On("UpdateUserAttribute", mock.Anything, mock.Anything).Return(nil)
+
+	// Initial request sends the otp
+	result, err := RunSMSOTPNode(session, node, map[string]string{}, services)
+	require.NoError(t, err)
+	assert.Equal(t, "number", result.Prompts["otp"])
+	assert.Equal(t, "+41791234567", result.Prompts["phone"])
+	assert.NotEqual(t, "0", result.Prompts["resend_in_seconds"])
+
+	otp := session.Context["sms_otp"]
+	require.Len(t, otp, 6)
+	require.NotNil(t, sent)
+	assert.Equal(t, "+41791234567", sent.To)
+	assert.Equal(t, "Your verification code is "+otp, sent.Message)
+
+	// Resending is not possible before the timer expired
+	result, err = RunSMSOTPNode(session, node, map[string]string{"option": "resend"}, services)
+	require.NoError(t, err)
+	assert.NotNil(t, result.Prompts)
+	assert.Equal(t, MSG_RESEND_TOO_SOON, session.Context["message"])
+
+	// Correct otp verifies the phone and resets the failed attempts
+	result, err = RunSMSOTPNode(session, node, map[string]string{"otp": otp}, services)
+	require.NoError(t, err)
+	assert.Equal(t, CONDITION_SUCCESS_REGISTERED_PHONE, result.Condition)
+	assert.Equal(t, "true", session.Context["phone_verified"])
+	assert.Equal(t, []string{model.AuthMethodSms}, session.AuthMethods)
+
+	phone, _, err := model.GetAttribute[model.PhoneAttributeValue](session.User, model.AttributeTypePhone)
+	require.NoError(t, err)
+	assert.True(t, phone.Verified)
+	assert.NotNil(t, phone.VerifiedAt)
+	assert.Equal(t, 0, phone.OtpFailedAttempts)
+
+	mockSMSSender.AssertExpectations(t)
+}
+
+func TestSMSOTP_LocksAfterMaxAttempts(t *testing.T) {
+	mockUserRepo := repository.NewMockUserRepository()
+	mockSMSSender := repository.NewMockSMSSender()
+	services := &model.Repositories{
+		UserRepo:  mockUserRepo,
+		SMSSender: mockSMSSender,
+	}
+
+	node := &model.GraphNode{CustomConfig: map[string]string{SMS_OTP_OPTION_MAX_ATTEMPTS: "2"}}
+	session := &model.AuthenticationSession{
+		Context: map[string]string{"phone": "+41791234567"},
+		User:    newTestUserWithPhone(model.PhoneAttributeValue{Phone: "+41791234567"}),
+	}
+
+	mockSMSSender.On("SendSMS", mock.Anything).Return(nil).Once()
+	mockUserRepo.On("UpdateUserAttribute", mock.Anything, mock.Anything).Return(nil)
+
+	_, err := RunSMSOTPNode(session, node, map[string]string{}, services)
+	require.NoError(t, err)
+
+	result, err := RunSMSOTPNode(session, node, map[string]string{"otp": "wrong"}, services)
+	require.NoError(t, err)
+	assert.NotNil(t, result.Prompts)
+	assert.Equal(t, MSG_INVALID_OTP, session.Context["message"])
+
+	result, err = RunSMSOTPNode(session, node, map[string]string{"otp": "wrong"}, services)
+	require.NoError(t, err)
+	assert.Equal(t, CONDITION_LOCKED, result.Condition)
+
+	phone, _, err := model.GetAttribute[model.PhoneAttributeValue](session.User, model.AttributeTypePhone)
+	require.NoError(t, err)
+	assert.True(t, phone.OtpLocked)
+	assert.Equal(t, 2, phone.OtpFailedAttempts)
+
+	// Even the correct otp is rejected once the phone number is locked
+	result, err = RunSMSOTPNode(session, node, map[string]string{"otp": session.Context["sms_otp"]}, services)
+	require.NoError(t, err)
+	assert.Equal(t, CONDITION_LOCKED, result.Condition)
+}
+
+func TestSMSOTP_InvalidMaxAttempts(t *testing.T) {
+	node := &model.GraphNode{Name: "sms", CustomConfig: map[string]string{SMS_OTP_OPTION_MAX_ATTEMPTS: "ten"}}
+	session := &model.AuthenticationSession{
+		Context: map[string]string{"phone": "+41791234567"},
+		User:    newTestUserWithPhone(model.PhoneAttributeValue{Phone: "+41791234567"}),
+	}
+
+	// An invalid value must not disable the limit
+	_, err := RunSMSOTPNode(session, node, map[string]string{}, &model.Repositories{})
+	assert.ErrorContains(t, err, "invalid "+SMS_OTP_OPTION_MAX_ATTEMPTS)
+}
+
+func TestSMSOTP_UnknownPhoneInitUser(t *testing.T) {
+	mockUserRepo := repository.NewMockUserRepository()
+	mockSMSSender := repository.NewMockSMSSender()
+	services := &model.Repositories{
+		UserRepo:  mockUserRepo,
+		SMSSender: mockSMSSender,
+	}
+
+	node := &model.GraphNode{CustomConfig: map[string]string{
+		SMS_OTP_OPTION_INIT_USER:          "true",
+		PHONE_OPTION_DEFAULT_COUNTRY_CODE: "41",
+	}}
+	session := &model.AuthenticationSession{Context: map[string]string{"phone": "079 123 45 67"}}
+
+	mockUserRepo.On("GetByAttributeIndex", mock.Anything, model.AttributeTypePhone, "079 123 45 67").Return(nil, nil)
+	mockUserRepo.On("NewUserModel", mock.Anything).Return(&model.User{ID: "new-user"}, nil)
+	mockSMSSender.On("SendSMS", mock.MatchedBy(func(sms *model.SendSMSParams) bool {
+		return sms.To == "+41791234567"
+	})).Return(nil)
+
+	_, err := RunSMSOTPNode(session, node, map[string]string{}, services)
+	require.NoError(t, err)
+
+	// Wrong attempts are not counted without a user
+	_, err = RunSMSOTPNode(session, node, map[string]string{"otp": "wrong"}, services)
+	require.NoError(t, err)
+	mockUserRepo.AssertNotCalled(t, "UpdateUserAttribute", mock.Anything, mock.Anything)
+
+	result, err := RunSMSOTPNode(session, node, map[string]string{"otp": session.Context["sms_otp"]}, services)
+	require.NoError(t, err)
+	assert.Equal(t, CONDITION_SUCCESS_UNKNOWN_PHONE, result.Condition)
+
+	require.NotNil(t, session.User)
+	phone, _, err := model.GetAttribute[model.PhoneAttributeValue](session.User, model.AttributeTypePhone)
+	require.NoError(t, err)
+	assert.Equal(t, "+41791234567", phone.Phone)
+	assert.True(t, phone.Verified)
+}
+
+func TestSavePhone(t *testing.T) {
+	mockUserRepo := repository.NewMockUserRepository()
+	services := &model.Repositories{UserRepo: mockUserRepo}
+
+	user := &model.User{ID: "123", Tenant: "acme", Realm: "customers"}
+	session := &model.AuthenticationSession{
+		Context: map[string]string{"phone": "+41791234567", "phone_verified": "true"},
+		User:    user,
+	}
+
+	mockUserRepo.On("GetByAttributeIndex", mock.Anything, model.AttributeTypePhone, "+41791234567").Return(nil, nil).Once()
+	mockUserRepo.On("CreateUserAttribute", mock.Anything, mock.Anything).Return(nil)
+
+	result, err := RunSavePhoneNode(session, &model.GraphNode{}, nil, services)
+	require.NoError(t, err)
+	assert.Equal(t, "success", result.Condition)
+
+	phone, attribute, err := model.GetAttribute[model.PhoneAttributeValue](user, model.AttributeTypePhone)
+	require.NoError(t, err)
+	assert.Equal(t, "+41791234567", phone.Phone)
+	assert.True(t, phone.Verified)
+	assert.Equal(t, "acme", attribute.Tenant)
+
+	// The phone number of another user cannot be taken over
+	mockUserRepo.On("GetByAttributeIndex", mock.Anything, model.AttributeTypePhone, "+41791234567").Return(&model.User{ID: "other"}, nil)
+	result, err = RunSavePhoneNode(session, &model.GraphNode{}, nil, services)
+	require.NoError(t, err)
+	assert.Equal(t, "phone_taken", result.Condition)
+}
+
+func TestSavePhone_KeepsOtpLock(t *testing.T) {
+	mockUserRepo := repository.NewMockUserRepository()
+	services := &model.Repositories{UserRepo: mockUserRepo}
+
+	user := newTestUserWithPhone(model.PhoneAttributeValue{Phone: "+41791234567", OtpFailedAttempts: 3, OtpLocked: true})
+	session := &model.AuthenticationSession{
+		Context: map[string]string{"phone": "+41797654321"},
+		User:    user,
+	}
+
+	mockUserRepo.On("GetByAttributeIndex", mock.Anything, model.AttributeTypePhone, "+41797654321").Return(nil, nil)
+	mockUserRepo.On("UpdateUserAttribute", mock.Anything, mock.Anything).Return(nil)
+
+	result, err := RunSavePhoneNode(session, &model.GraphNode{}, nil, services)
+	require.NoError(t, err)
+	assert.Equal(t, "success", result.Condition)
+
+	phone, _, err := model.GetAttribute[model.PhoneAttributeValue](user, model.AttributeTypePhone)
+	require.NoError(t, err)
+	assert.Equal(t, "+41797654321", phone.Phone)
+	assert.False(t, phone.Verified)
+	assert.True(t, phone.OtpLocked)
+	assert.Equal(t, 3, phone.OtpFailedAttempts)
+}
@@ -0,0 +1,107 @@
+package node_recovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+var RecoveryCodesCreateNode = &model.NodeDefinition{
+	Name:            "createRecoveryCodes",
+	PrettyName:      "Create Recovery Codes",
+	Description:     "Generates single use recovery codes and displays them once, existing codes of the user are replaced. User must already be in the context",
+	Category:        "MFA",
+	Type:            model.NodeTypeQueryWithLogic,
+	RequiredContext: []string{"user"},
+	PossiblePrompts: map[string]string{
+		"recoveryCodes": "string",
+		"confirmation":  "boolean",
+	},
+	OutputContext:    []string{},
+	SensitiveContext: []string{"recovery_codes"},
+	CustomConfigOptions: map[string]string{
+		"count":        "Number of codes that are generated (default: 10)",
+		"skipSaveUser": "If true, the user will not be saved to the database after the codes are created and only the context will be updated",
+		"message":      "The message displayed above the codes",
+		"button_text":  "The text of the button",
+	},
+	PossibleResultStates: []string{model.ResultStateSuccess},
+	Run:                  RunRecoveryCodesCreateNode,
+}
+
+func RunRecoveryCodesCreateNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+
+	// This node needs a user in the context
+	if state.User == nil {
+		return nil, errors.New("user not found in context - create recovery codes needs a user in the context")
+	}
+
+	// The codes are only saved once the user confirmed that they wrote them down
+	if input["confirmation"] != "true" || state.Context["recovery_codes"] == "" {
+
+		count := DEFAULT_RECOVERY_CODE_COUNT
+		if node.CustomConfig["count"] != "" {
+			var err error
+			count, err = strconv.Atoi(node.CustomConfig["count"])
+			if err != nil || count <= 0 {
+				return nil, fmt.Errorf("invalid recovery code count '%s'", node.CustomConfig["count"])
+			}
+		}
+
+		// Keep the codes if the user submits the page without confirming, so the codes they wrote down stay valid
+		if state.Context["recovery_codes"] == "" {
+			codes, err := generateRecoveryCodes(count)
+			if err != nil {
+				return nil, err
+			}
+			state.Context["recovery_codes"] = strings.Join(codes, "\n")
+		}
+
+		return model.NewNodeResultWithPrompts(map[string]string{
+			"recoveryCodes": state.Context["recovery_codes"],
+			"confirmation":  "boolean",
+		})
+	}
+
+	// Hash the codes, they are only displayed once and cannot be shown again
+	now := time.Now()
+	value := model.RecoveryCodesAttributeValue{CreatedAt: now}
+	for _, code := range strings.Fields(state.Context["recovery_codes"]) {
+		normalized := normalizeRecoveryCode(code)
+		hash, err := lib.HashPassword(normalized)
+		if err != nil {
+			return nil, err
+		}
+		value.Codes = append(value.Codes, model.RecoveryCode{ID: recoveryCodeID(normalized), Hash: hash})
+	}
+
+	// Replace the existing codes of the user
+	_, attribute, err := model.GetAttribute[model.RecoveryCodesAttributeValue](state.User, model.AttributeTypeRecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+	if attribute != nil {
+		attribute.Value = value
+	} else {
+		state.User.AddAttribute(&model.UserAttribute{
+			Type:  model.AttributeTypeRecoveryCodes,
+			Value: value,
+		})
+	}
+
+	// If we are saving the user we need to save it to the database
+	if node.CustomConfig["skipSaveUser"] != "true" {
+		err := services.UserRepo.CreateOrUpdate(context.Background(), state.User)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return model.NewNodeResultWithCondition(model.ResultStateSuccess)
+}
@@ -0,0 +1,73 @@
+package node_recovery
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_utils"
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+const (
+	// CONDITION_RECOVERY_CODES_LOW is returned if the user has codes left, but not more than low_threshold
+	CONDITION_RECOVERY_CODES_LOW = "low"
+
+	DEFAULT_LOW_THRESHOLD = 3
+)
+
+var HasRecoveryCodesNode = &model.NodeDefinition{
+	Name:                 "hasRecoveryCodes",
+	PrettyName:           "Has Recovery Codes",
+	Description:          "Checks how many unused recovery codes the user has, e.g. to ask them to generate new codes when they run low",
+	Category:             "MFA",
+	Type:                 model.NodeTypeLogic,
+	RequiredContext:      []string{"user"},
+	OutputContext:        []string{CONTEXT_RECOVERY_CODES_REMAINING},
+	PossibleResultStates: []string{model.ResultStateNo, CONDITION_RECOVERY_CODES_LOW, model.ResultStateYes},
+	CustomConfigOptions: map[string]string{
+		"low_threshold": "The user is routed to low if they have this many codes left or less (default: 3)",
+	},
+	Run: RunHasRecoveryCodesNode,
+}
+
+func RunHasRecoveryCodesNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+
+	// Try to load user from context
+	user, err := node_utils.TryLoadUserFromContext(state, services)
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+
+	// If we have no user we return an error
+	if user == nil {
+		return model.NewNodeResultWithError(errors.New("user not found in context"))
+	}
+
+	lowThreshold := DEFAULT_LOW_THRESHOLD
+	if node.CustomConfig["low_threshold"] != "" {
+		lowThreshold, err = strconv.Atoi(node.CustomConfig["low_threshold"])
+		if err != nil {
+			return model.NewNodeResultWithError(err)
+		}
+	}
+
+	value, _, err := model.GetAttribute[model.RecoveryCodesAttributeValue](user, model.AttributeTypeRecoveryCodes)
+	if err != nil {
+		return model.NewNodeResultWithError(err)
+	}
+
+	remaining := 0
+	if value != nil && !value.Locked {
+		remaining = value.Remaining()
+	}
+	state.Context[CONTEXT_RECOVERY_CODES_REMAINING] = strconv.Itoa(remaining)
+
+	switch {
+	case remaining == 0:
+		return model.NewNodeResultWithCondition(model.ResultStateNo)
+	case remaining <= lowThreshold:
+		return model.NewNodeResultWithCondition(CONDITION_RECOVERY_CODES_LOW)
+	default:
+		return model.NewNodeResultWithCondition(model.ResultStateYes)
+	}
+}
@@ -0,0 +1,159 @@
+package node_recovery
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/auth/repository"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := repository.NewTestUserRepository("acme", "customers")
+	require.NoError(t, err)
+	defer repo.Close()
+	services := &model.Repositories{UserRepo: repo}
+
+	user := &model.User{ID: uuid.NewString(), Tenant: "acme", Realm: "customers", Status: "active", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	require.NoError(t, repo.Create(ctx, user))
+
+	session := &model.AuthenticationSession{User: user, Context: map[string]string{}}
+	hasNode := &model.GraphNode{CustomConfig: map[string]string{"low_threshold": "1"}}
+
+	// The user has no codes yet
+	result, err := RunHasRecoveryCodesNode(session, hasNode, nil, services)
+	require.NoError(t, err)
+	assert.Equal(t, model.ResultStateNo, result.Condition)
+
+	// The codes are displayed and only saved once the user confirms
+	createNode := &model.GraphNode{CustomConfig: map[string]string{"count": "4"}}
+	result, err = RunRecoveryCodesCreateNode(session, createNode, nil, services)
+	require.NoError(t, err)
+	codes := strings.Fields(result.Prompts["recoveryCodes"])
+	require.Len(t, codes, 4)
+	assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, codes[0])
+
+	// Reloading the page shows the same codes
+	result, err = RunRecoveryCodesCreateNode(session, createNode, map[string]string{}, services)
+	require.NoError(t, err)
+	assert.Equal(t, codes, strings.Fields(result.Prompts["recoveryCodes"]))
+
+	result, err = RunRecoveryCodesCreateNode(session, createNode, map[string]string{"confirmation": "true"}, services)
+	require.NoError(t, err)
+	assert.Equal(t, model.ResultStateSuccess, result.Condition)
+
+	stored, err := repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	value, _, err := model.GetAttribute[model.RecoveryCodesAttributeValue](stored, model.AttributeTypeRecoveryCodes)
+	require.NoError(t, err)
+	require.NotNil(t, value)
+	require.Len(t, value.Codes, 4)
+	assert.NotContains(t, value.Codes[0].Hash, codes[0], "codes are stored hashed")
+	assert.Equal(t, codes[0][:2], value.Codes[0].ID, "codes are stored with their first characters")
+
+	verifyNode := &model.GraphNode{CustomConfig: map[string]string{"max_failed_attempts": "3"}}
+	verify := func(code string) string {
+		session := &model.AuthenticationSession{User: stored, Context: map[string]string{}}
+		result, err := RunRecoveryCodeVerifyNode(session, verifyNode, map[string]string{"recoveryCode": code}, services)
+		require.NoError(t, err)
+		return result.Condition
+	}
+
+	t.Run("prompts for a code", func(t *testing.T) {
+		session := &model.AuthenticationSession{User: stored, Context: map[string]string{}}
+		result, err := RunRecoveryCodeVerifyNode(session, verifyNode, map[string]string{}, services)
+		require.NoError(t, err)
+		assert.Contains(t, result.Prompts, "recoveryCode")
+	})
+
+	t.Run("valid code counts as second factor", func(t *testing.T) {
+		session := &model.AuthenticationSession{User: stored, Context: map[string]string{}}
+		session.AddAuthMethod(model.AuthMethodPassword)
+
+		// Codes are accepted in upper case and without the separator
+		code := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+		result, err := RunRecoveryCodeVerifyNode(session, verifyNode, map[string]string{"recoveryCode": code}, services)
+		require.NoError(t, err)
+		assert.Equal(t, model.ResultStateSuccess, result.Condition)
+		assert.Equal(t, "3", session.Context[CONTEXT_RECOVERY_CODES_REMAINING])
+		assert.Equal(t, model.AuthLevel2FA, session.AuthLevel(stored.ID))
+	})
+
+	t.Run("used code is rejected", func(t *testing.T) {
+		assert.Equal(t, model.ResultStateFailure, verify(codes[0]))
+	})
+
+	t.Run("code used by another session is rejected", func(t *testing.T) {
+		stale, err := repo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.ResultStateSuccess, verify(codes[1]))
+
+		session := &model.AuthenticationSession{User: stale, Context: map[string]string{}}
+		result, err := RunRecoveryCodeVerifyNode(session, verifyNode, map[string]string{"recoveryCode": codes[1]}, services)
+		require.NoError(t, err)
+		assert.Equal(t, model.ResultStateFailure, result.Condition)
+
+		// A valid code resets the failed attempts
+		assert.Equal(t, model.ResultStateSuccess, verify(codes[3]))
+	})
+
+	t.Run("concurrent change fails", func(t *testing.T) {
+		session := &model.AuthenticationSession{User: stored, Context: map[string]string{}}
+		racing := &model.Repositories{UserRepo: &racingUserRepository{UserRepository: repo}}
+		_, err := RunRecoveryCodeVerifyNode(session, verifyNode, map[string]string{"recoveryCode": codes[2]}, racing)
+		assert.Error(t, err)
+		assert.Empty(t, session.AuthMethods)
+	})
+
+	t.Run("low on codes", func(t *testing.T) {
+		result, err := RunHasRecoveryCodesNode(&model.AuthenticationSession{User: stored, Context: map[string]string{}}, hasNode, nil, services)
+		require.NoError(t, err)
+		assert.Equal(t, CONDITION_RECOVERY_CODES_LOW, result.Condition)
+	})
+
+	t.Run("locked after failed attempts", func(t *testing.T) {
+		assert.Equal(t, model.ResultStateFailure, verify("wrong"))
+		assert.Equal(t, model.ResultStateFailure, verify("wrong"))
+		assert.Equal(t, model.ResultStateFailure, verify("wrong"))
+		assert.Equal(t, model.ResultStateLocked, verify(codes[2]))
+
+		reloaded, err := repo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		value, _, err := model.GetAttribute[model.RecoveryCodesAttributeValue](reloaded, model.AttributeTypeRecoveryCodes)
+		require.NoError(t, err)
+		assert.True(t, value.Locked)
+		assert.Equal(t, 1, value.Remaining())
+	})
+}
+
+// racingUserRepository changes the recovery codes after they were read, like a concurrent session would
+type racingUserRepository struct {
+	model.UserRepository
+}
+
+func (r *racingUserRepository) GetByID(ctx context.Context, id string) (*model.User, error) {
+	user, err := r.UserRepository.GetByID(ctx, id)
+	if err != nil || user == nil {
+		return user, err
+	}
+
+	concurrent, err := r.UserRepository.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	_, attribute, err := model.GetAttribute[model.RecoveryCodesAttributeValue](concurrent, model.AttributeTypeRecoveryCodes)
+	if err != nil || attribute == nil {
+		return user, err
+	}
+
+	// SQLite stores updated_at with millisecond precision
+	time.Sleep(5 * time.Millisecond)
+	return user, r.UserRepository.UpdateUserAttribute(ctx, attribute)
+}
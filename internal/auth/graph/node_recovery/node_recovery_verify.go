@@ -0,0 +1,148 @@
+package node_recovery
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+var RecoveryCodeVerifyNode = &model.NodeDefinition{
+	Name:            "verifyRecoveryCode",
+	PrettyName:      "Verify Recovery Code",
+	Description:     "Verifies a recovery code as second factor, each code can only be used once",
+	Category:        "MFA",
+	Type:            model.NodeTypeQueryWithLogic,
+	RequiredContext: []string{"user"},
+	PossiblePrompts: map[string]string{
+		"recoveryCode": "string",
+	},
+	OutputContext:        []string{CONTEXT_RECOVERY_CODES_REMAINING},
+	PossibleResultStates: []string{model.ResultStateSuccess, model.ResultStateFailure, model.ResultStateLocked, model.ResultStateNotFound},
+	CustomConfigOptions: map[string]string{
+		"max_failed_attempts": "Maximum number of failed attempts before locking the recovery codes (default: 10)",
+	},
+	Run: RunRecoveryCodeVerifyNode,
+}
+
+const (
+	DEFAULT_MAX_FAILED_ATTEMPTS = 10
+)
+
+func RunRecoveryCodeVerifyNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+
+	// This node needs a user in the context
+	if state.User == nil {
+		return nil, errors.New("user not found in context - verify recovery code needs a user in the context")
+	}
+
+	// Get the max failed attempts
+	maxFailedAttempts := DEFAULT_MAX_FAILED_ATTEMPTS
+	if node.CustomConfig["max_failed_attempts"] != "" {
+		var err error
+		maxFailedAttempts, err = strconv.Atoi(node.CustomConfig["max_failed_attempts"])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	value, sessionAttribute, err := model.GetAttribute[model.RecoveryCodesAttributeValue](state.User, model.AttributeTypeRecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the user has no codes left there is nothing to verify
+	if value == nil || value.Remaining() == 0 {
+		return model.NewNodeResultWithCondition(model.ResultStateNotFound)
+	}
+
+	if value.Locked {
+		return model.NewNodeResultWithCondition(model.ResultStateLocked)
+	}
+
+	// If we have no input we ask for a code
+	if input["recoveryCode"] == "" {
+		return model.NewNodeResultWithPrompts(map[string]string{
+			"recoveryCode": "string",
+		})
+	}
+
+	// Another session may have used a code or locked the codes since the user was loaded, so we verify the code
+	// against the stored codes
+	ctx := context.Background()
+	user, err := services.UserRepo.GetByID(ctx, state.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("user not found - verify recovery code needs a stored user")
+	}
+
+	value, attribute, err := model.GetAttribute[model.RecoveryCodesAttributeValue](user, model.AttributeTypeRecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil || value.Remaining() == 0 {
+		return model.NewNodeResultWithCondition(model.ResultStateNotFound)
+	}
+	if value.Locked {
+		return model.NewNodeResultWithCondition(model.ResultStateLocked)
+	}
+	lastUpdatedAt := attribute.UpdatedAt
+
+	// Compare the code with the unused code that has its identifier, used codes are never accepted again. Codes
+	// without identifier were created before identifiers were stored and are always compared.
+	code := normalizeRecoveryCode(input["recoveryCode"])
+	id := recoveryCodeID(code)
+	matched := false
+	for i := range value.Codes {
+		if value.Codes[i].UsedAt != nil || (value.Codes[i].ID != "" && value.Codes[i].ID != id) {
+			continue
+		}
+		if lib.ComparePassword(code, value.Codes[i].Hash) == nil {
+			now := time.Now()
+			value.Codes[i].UsedAt = &now
+			matched = true
+			break
+		}
+	}
+
+	if matched {
+		value.FailedAttempts = 0
+	} else {
+		value.FailedAttempts++
+		if value.FailedAttempts >= maxFailedAttempts {
+			value.Locked = true
+		}
+	}
+
+	// The codes are only saved if no other session changed them since they were read, otherwise two sessions could
+	// both accept the same code
+	attribute.Value = *value
+	updated, err := services.UserRepo.UpdateUserAttributeIfUnchanged(ctx, attribute, lastUpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, errors.New("recovery codes were changed by another session")
+	}
+
+	// Keep the user of the session up to date, so that saving it later does not restore used codes
+	if sessionAttribute != nil {
+		sessionAttribute.Value = *value
+		sessionAttribute.UpdatedAt = attribute.UpdatedAt
+	}
+
+	if !matched {
+		errorMessage := "Invalid Code"
+		state.Error = &errorMessage
+		return model.NewNodeResultWithCondition(model.ResultStateFailure)
+	}
+
+	state.Context[CONTEXT_RECOVERY_CODES_REMAINING] = strconv.Itoa(value.Remaining())
+	state.AddAuthMethod(model.AuthMethodRecoveryCode)
+	return model.NewNodeResultWithCondition(model.ResultStateSuccess)
+}
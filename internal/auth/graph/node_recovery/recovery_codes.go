@@ -0,0 +1,59 @@
+package node_recovery
+
+import (
+	"encoding/base32"
+	"strings"
+
+	"github.com/Identityplane/GoAM/internal/lib"
+)
+
+const (
+	// DEFAULT_RECOVERY_CODE_COUNT is the number of codes that are generated at once
+	DEFAULT_RECOVERY_CODE_COUNT = 10
+
+	// recoveryCodeLength is the number of characters of a code, 10 base32 characters have 50 bits of entropy
+	recoveryCodeLength = 10
+
+	// recoveryCodeIDLength is the number of characters of a code that are stored in clear to find its hash, the
+	// remaining 8 characters still have 40 bits of entropy
+	recoveryCodeIDLength = 2
+
+	// CONTEXT_RECOVERY_CODES_REMAINING holds the number of unused codes after a has or verify node
+	CONTEXT_RECOVERY_CODES_REMAINING = "recovery_codes_remaining"
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns count random codes formatted as 'xxxxx-xxxxx'
+func generateRecoveryCodes(count int) ([]string, error) {
+	codes := make([]string, 0, count)
+
+	for range count {
+		bytes, err := lib.GenerateRandomBytes(recoveryCodeLength * 5 / 8)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(bytes))
+		codes = append(codes, code[:recoveryCodeLength/2]+"-"+code[recoveryCodeLength/2:])
+	}
+
+	return codes, nil
+}
+
+// recoveryCodeID returns the identifier of a normalized code
+func recoveryCodeID(code string) string {
+	if len(code) < recoveryCodeIDLength {
+		return code
+	}
+	return code[:recoveryCodeIDLength]
+}
+
+// normalizeRecoveryCode removes the separator and whitespace a user might enter and ignores the case
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+}
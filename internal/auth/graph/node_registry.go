@@ -0,0 +1,194 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+var (
+	// nodeDefinitions holds the built-in and the custom nodes, it is read for every step of a flow
+	// while extensions can register nodes at any time, so access is guarded by the mutex
+	nodeDefinitions      = copyNodeDefinitions(builtinNodeDefinitions)
+	customNodeTemplates  = map[string]string{}
+	nodeDefinitionsMutex sync.RWMutex
+
+	nodeNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+)
+
+var ErrNodeAlreadyRegistered = errors.New("node is already registered")
+
+var ErrBuiltinNode = errors.New("built-in nodes cannot be unregistered")
+
+// GetNodeDefinitionByName returns the definition of the node or nil if there is none
+func GetNodeDefinitionByName(name string) *model.NodeDefinition {
+	nodeDefinitionsMutex.RLock()
+	defer nodeDefinitionsMutex.RUnlock()
+
+	return nodeDefinitions[name]
+}
+
+// ListNodeDefinitions returns all registered nodes sorted by name
+func ListNodeDefinitions() []*model.NodeDefinition {
+	nodeDefinitionsMutex.RLock()
+	defer nodeDefinitionsMutex.RUnlock()
+
+	defs := make([]*model.NodeDefinition, 0, len(nodeDefinitions))
+	for _, def := range nodeDefinitions {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+
+	return defs
+}
+
+// RegisterNodeDefinition adds a custom node. The template of the node is read from '<name>.html' in the
+// templates, nodes that prompt the user without a template need a template override. Built-in nodes and nodes
+// that are already registered cannot be replaced.
+func RegisterNodeDefinition(def *model.NodeDefinition, templates fs.FS) error {
+	if err := ValidateNodeDefinition(def); err != nil {
+		return err
+	}
+
+	nodeTemplate, err := LoadNodeTemplate(def, templates)
+	if err != nil {
+		return err
+	}
+
+	nodeDefinitionsMutex.Lock()
+	defer nodeDefinitionsMutex.Unlock()
+
+	if IsBuiltinNode(def.Name) {
+		return fmt.Errorf("%w: '%s' is a built-in node", ErrNodeAlreadyRegistered, def.Name)
+	}
+	if _, ok := nodeDefinitions[def.Name]; ok {
+		return fmt.Errorf("%w: '%s'", ErrNodeAlreadyRegistered, def.Name)
+	}
+
+	nodeDefinitions[def.Name] = def
+	if nodeTemplate != "" {
+		customNodeTemplates[def.Name] = nodeTemplate
+	}
+
+	log.Info().Str("node", def.Name).Msg("registered custom node")
+
+	return nil
+}
+
+// UnregisterNodeDefinition removes a custom node, flows that use it cannot be executed anymore
+func UnregisterNodeDefinition(name string) error {
+	if IsBuiltinNode(name) {
+		return fmt.Errorf("%w: '%s'", ErrBuiltinNode, name)
+	}
+
+	nodeDefinitionsMutex.Lock()
+	defer nodeDefinitionsMutex.Unlock()
+
+	delete(nodeDefinitions, name)
+	delete(customNodeTemplates, name)
+	return nil
+}
+
+// LoadNodeTemplate reads and parses the template '<name>.html' of a node. Nodes that prompt the user can be
+// registered without a template, they are rendered with a template override.
+func LoadNodeTemplate(def *model.NodeDefinition, templates fs.FS) (string, error) {
+	nodeTemplate := ""
+	if templates != nil {
+		content, err := fs.ReadFile(templates, def.Name+".html")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to read template of node '%s': %w", def.Name, err)
+		}
+		nodeTemplate = string(content)
+	}
+
+	if nodeTemplate != "" {
+		if _, err := template.New(def.Name).Parse(nodeTemplate); err != nil {
+			return "", fmt.Errorf("invalid template of node '%s': %w", def.Name, err)
+		}
+	} else if def.Type == model.NodeTypeQuery || def.Type == model.NodeTypeQueryWithLogic {
+		log.Warn().Str("node", def.Name).Msgf("node prompts the user but has no template '%s.html', it needs a template override", def.Name)
+	}
+
+	return nodeTemplate, nil
+}
+
+// IsBuiltinNode checks if the node ships with GoAM
+func IsBuiltinNode(name string) bool {
+	_, ok := builtinNodeDefinitions[name]
+	return ok
+}
+
+// GetCustomNodeTemplate returns the template that was registered with a custom node
+func GetCustomNodeTemplate(name string) (string, bool) {
+	nodeDefinitionsMutex.RLock()
+	defer nodeDefinitionsMutex.RUnlock()
+
+	nodeTemplate, ok := customNodeTemplates[name]
+	return nodeTemplate, ok
+}
+
+// ValidateNodeDefinition checks that a node definition can be executed by the graph engine
+func ValidateNodeDefinition(def *model.NodeDefinition) error {
+	if def == nil {
+		return errors.New("node definition is nil")
+	}
+
+	if !nodeNamePattern.MatchString(def.Name) {
+		return fmt.Errorf("invalid node name '%s', it must start with a letter and contain only letters, digits, '_' and '-'", def.Name)
+	}
+
+	switch def.Type {
+	case model.NodeTypeQuery:
+		if len(def.PossiblePrompts) == 0 {
+			return fmt.Errorf("query node '%s' has no prompts", def.Name)
+		}
+		if !contains(def.PossibleResultStates, "submitted") {
+			return fmt.Errorf("query node '%s' must have the result state 'submitted'", def.Name)
+		}
+	case model.NodeTypeInit, model.NodeTypeLogic, model.NodeTypeQueryWithLogic, model.NodeTypeResult:
+		if def.Run == nil {
+			return fmt.Errorf("%s node '%s' has no run function", def.Type, def.Name)
+		}
+	default:
+		return fmt.Errorf("node '%s' has unsupported type '%s'", def.Name, def.Type)
+	}
+
+	if def.Type != model.NodeTypeResult && len(def.PossibleResultStates) == 0 && def.ResultStates == nil {
+		return fmt.Errorf("node '%s' has no result states", def.Name)
+	}
+
+	for _, name := range sortedOptionNames(def.ConfigSchema) {
+		option := def.ConfigSchema[name]
+		if option.Type == model.ConfigOptionEnum && len(option.Values) == 0 {
+			return fmt.Errorf("config option '%s' of node '%s' is an enum without values", name, def.Name)
+		}
+		if err := option.ValidateValue(option.Default); err != nil {
+			return fmt.Errorf("invalid default of config option '%s' of node '%s': %w", name, def.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func copyNodeDefinitions(defs map[string]*model.NodeDefinition) map[string]*model.NodeDefinition {
+	copied := make(map[string]*model.NodeDefinition, len(defs))
+	for name, def := range defs {
+		copied[name] = def
+	}
+	return copied
+}
+
+func sortedOptionNames(options map[string]model.ConfigOption) []string {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
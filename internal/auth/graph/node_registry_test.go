@@ -0,0 +1,199 @@
+package graph
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCustomNode returns a logic node with a typed config schema that returns the configured mode as condition
+func newCustomNode(name string) *model.NodeDefinition {
+	return &model.NodeDefinition{
+		Name:                 name,
+		Type:                 model.NodeTypeLogic,
+		PossibleResultStates: []string{"strict", "lenient"},
+		ConfigSchema: map[string]model.ConfigOption{
+			"mode":    {Description: "Mode of the check", Type: model.ConfigOptionEnum, Values: []string{"strict", "lenient"}, Default: "strict"},
+			"limit":   {Description: "Maximum number of attempts", Type: model.ConfigOptionInt, Required: true},
+			"api_key": {Description: "Api key of the service", Required: true, Secret: true},
+		},
+		Run: func(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+			return &model.NodeResult{Condition: node.CustomConfig["mode"]}, nil
+		},
+	}
+}
+
+func TestRegisterNodeDefinition(t *testing.T) {
+	def := newCustomNode("customCheck")
+	require.NoError(t, RegisterNodeDefinition(def, nil))
+	defer UnregisterNodeDefinition(def.Name)
+
+	assert.Same(t, def, GetNodeDefinitionByName("customCheck"))
+	assert.Contains(t, ListNodeDefinitions(), def)
+
+	// Nodes cannot be replaced
+	assert.ErrorIs(t, RegisterNodeDefinition(newCustomNode("customCheck"), nil), ErrNodeAlreadyRegistered)
+	assert.ErrorIs(t, RegisterNodeDefinition(newCustomNode("askUsername"), nil), ErrNodeAlreadyRegistered)
+	assert.NotSame(t, def, GetNodeDefinitionByName("askUsername"))
+
+	require.NoError(t, UnregisterNodeDefinition(def.Name))
+	assert.Nil(t, GetNodeDefinitionByName("customCheck"))
+
+	// Built-in nodes cannot be removed
+	assert.ErrorIs(t, UnregisterNodeDefinition("askUsername"), ErrBuiltinNode)
+	assert.NotNil(t, GetNodeDefinitionByName("askUsername"))
+}
+
+func TestRegisterNodeDefinition_Templates(t *testing.T) {
+	def := &model.NodeDefinition{
+		Name:                 "askFavoriteColor",
+		Type:                 model.NodeTypeQuery,
+		PossiblePrompts:      map[string]string{"color": "text"},
+		PossibleResultStates: []string{"submitted"},
+	}
+
+	// A node that prompts the user can be registered without a template, it needs a template override then
+	require.NoError(t, RegisterNodeDefinition(def, nil))
+	_, ok := GetCustomNodeTemplate("askFavoriteColor")
+	assert.False(t, ok)
+	require.NoError(t, UnregisterNodeDefinition(def.Name))
+
+	assert.ErrorContains(t, RegisterNodeDefinition(def, fstest.MapFS{"askFavoriteColor.html": {Data: []byte("{{ if }}")}}), "invalid template")
+
+	templates := fstest.MapFS{"askFavoriteColor.html": {Data: []byte(`{{ define "content" }}<input name="color">{{ end }}`)}}
+	require.NoError(t, RegisterNodeDefinition(def, templates))
+	defer UnregisterNodeDefinition(def.Name)
+
+	nodeTemplate, ok := GetCustomNodeTemplate("askFavoriteColor")
+	assert.True(t, ok)
+	assert.Contains(t, nodeTemplate, `name="color"`)
+}
+
+func TestValidateNodeDefinition(t *testing.T) {
+
+	// All built-in nodes are valid
+	for name, def := range builtinNodeDefinitions {
+		assert.NoError(t, ValidateNodeDefinition(def), name)
+		assert.Equal(t, name, def.Name)
+	}
+
+	tests := []struct {
+		name   string
+		change func(def *model.NodeDefinition)
+		err    string
+	}{
+		{"nil run", func(def *model.NodeDefinition) { def.Run = nil }, "has no run function"},
+		{"invalid name", func(def *model.NodeDefinition) { def.Name = "custom.check" }, "invalid node name"},
+		{"unknown type", func(def *model.NodeDefinition) { def.Type = "magic" }, "unsupported type"},
+		{"no result states", func(def *model.NodeDefinition) { def.PossibleResultStates = nil }, "no result states"},
+		{"invalid default", func(def *model.NodeDefinition) {
+			def.ConfigSchema["limit"] = model.ConfigOption{Type: model.ConfigOptionInt, Default: "many"}
+		}, "invalid default of config option 'limit'"},
+		{"enum without values", func(def *model.NodeDefinition) {
+			def.ConfigSchema["mode"] = model.ConfigOption{Type: model.ConfigOptionEnum}
+		}, "enum without values"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			def := newCustomNode("customCheck")
+			test.change(def)
+			assert.ErrorContains(t, ValidateNodeDefinition(def), test.err)
+		})
+	}
+}
+
+func TestRegisterNodeDefinition_Concurrent(t *testing.T) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("concurrentNode%d", i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, RegisterNodeDefinition(newCustomNode(name), nil))
+		}()
+		go func() {
+			defer wg.Done()
+			GetNodeDefinitionByName("askUsername")
+			ListNodeDefinitions()
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("concurrentNode%d", i)
+		assert.NotNil(t, GetNodeDefinitionByName(name))
+		UnregisterNodeDefinition(name)
+	}
+}
+
+func TestLint_ConfigSchema(t *testing.T) {
+	require.NoError(t, RegisterNodeDefinition(newCustomNode("customCheck"), nil))
+	defer UnregisterNodeDefinition("customCheck")
+
+	nodes := map[string]*model.GraphNode{
+		"check": {
+			Name:         "check",
+			Use:          "customCheck",
+			Next:         map[string]string{"strict": "end", "lenient": "end"},
+			CustomConfig: map[string]string{"limit": "3"},
+		},
+		"end": {Name: "end", Use: "successResult"},
+	}
+
+	// The mode has a default and the secret api key is set in the realm settings
+	assert.Empty(t, LintFlowDefinition(lintFlow("check", nodes)))
+
+	// Required options without a default must be set in the flow
+	delete(nodes["check"].CustomConfig, "limit")
+	issue := findIssue(LintFlowDefinition(lintFlow("check", nodes)), "check", "requires the custom_config option 'limit'")
+	require.NotNil(t, issue)
+	assert.Equal(t, FlowIssueError, issue.Severity)
+
+	// Values must match the type of the option
+	nodes["check"].CustomConfig = map[string]string{"limit": "three", "mode": "relaxed"}
+	issues := LintFlowDefinition(lintFlow("check", nodes))
+	assert.NotNil(t, findIssue(issues, "check", "'three' is not an integer"))
+	assert.NotNil(t, findIssue(issues, "check", "'relaxed' is not one of strict, lenient"))
+
+	// Secrets do not belong into the flow
+	nodes["check"].CustomConfig = map[string]string{"limit": "3", "api_key": "key"}
+	issue = findIssue(LintFlowDefinition(lintFlow("check", nodes)), "check", "is a secret")
+	require.NotNil(t, issue)
+	assert.Equal(t, FlowIssueWarning, issue.Severity)
+
+	// Options of the schema are known options
+	nodes["check"].CustomConfig = map[string]string{"limit": "3", "modus": "strict"}
+	issue = findIssue(LintFlowDefinition(lintFlow("check", nodes)), "check", "unknown custom_config option 'modus'")
+	require.NotNil(t, issue)
+	assert.Contains(t, issue.Message, "mode")
+}
+
+func TestRun_RequiredConfig(t *testing.T) {
+	require.NoError(t, RegisterNodeDefinition(newCustomNode("customCheck"), nil))
+	defer UnregisterNodeDefinition("customCheck")
+
+	flow := &model.FlowDefinition{
+		Start: "init",
+		Nodes: map[string]*model.GraphNode{
+			"init":  {Name: "init", Use: "init", Next: map[string]string{"start": "check"}},
+			"check": {Name: "check", Use: "customCheck", Next: map[string]string{"strict": "end", "lenient": "end"}, CustomConfig: map[string]string{"limit": "3", "mode": "lenient"}},
+			"end":   {Name: "end", Use: "failureResult"},
+		},
+	}
+
+	// The api key is neither set in the flow nor in the settings
+	_, err := Run(flow, InitFlow(flow), nil, &model.Repositories{})
+	assert.ErrorContains(t, err, "missing the required config option 'api_key'")
+
+	flow.Nodes["check"].CustomConfig["api_key"] = "key"
+	state, err := Run(flow, InitFlow(flow), nil, &model.Repositories{})
+	require.NoError(t, err)
+	assert.Contains(t, state.History, "check:lenient")
+}
@@ -0,0 +1,252 @@
+package node_saml
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/internal/lib/saml"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/Identityplane/GoAM/pkg/model/attributes"
+)
+
+const (
+	CONFIG_IDP_ENTITY_ID   = "idp_entity_id"
+	CONFIG_IDP_SSO_URL     = "idp_sso_url"
+	CONFIG_IDP_CERTIFICATE = "idp_certificate"
+	CONFIG_SP_ENTITY_ID    = "sp_entity_id"
+	CONFIG_ACS_URL         = "acs_url"
+	CONFIG_NAME_ID_FORMAT  = "name_id_format"
+
+	CONDITION_SAML_FAILURE       = "saml_failure"
+	CONDITION_SAML_NEW_USER      = "saml_new_user"
+	CONDITION_SAML_EXISTING_USER = "saml_existing_user"
+)
+
+// SamlLoginNode logs in a user with a federated SAML 2.0 identity provider like ADFS or Shibboleth, GoAM acts as the
+// service provider. The node sends an AuthnRequest with the HTTP-Redirect binding and the identity provider posts the
+// response to the assertion consumer service of the realm, which passes it on to the node.
+// If successful the node creates a saml attribute for the user and also looks up if the user already exists
+//
+// SAML Details:
+// The response or the assertion must be signed with the configured certificate of the identity provider, the
+// certificate in the response itself is not trusted. Each AuthnRequest can only be answered once and each assertion
+// can only be used once until it expires, the used assertions are remembered in the cache of the realm.
+// AuthnRequests are not signed and encrypted assertions are not supported.
+var SamlLoginNode = &model.NodeDefinition{
+	Name:            "samlLogin",
+	PrettyName:      "SAML Login",
+	Description:     "Logs in a user using a federated SAML 2.0 identity provider.",
+	Category:        "SAML",
+	Type:            model.NodeTypeQueryWithLogic,
+	RequiredContext: []string{},
+	CustomConfigOptions: map[string]string{
+		CONFIG_IDP_ENTITY_ID:   "The entity id of the SAML identity provider",
+		CONFIG_IDP_SSO_URL:     "The single sign-on URL of the identity provider for the HTTP-Redirect binding",
+		CONFIG_IDP_CERTIFICATE: "The signing certificate of the identity provider, PEM or base64 encoded",
+		CONFIG_SP_ENTITY_ID:    "The entity id of GoAM as service provider",
+		CONFIG_ACS_URL:         "The assertion consumer service URL, defaults to the /saml/acs endpoint of the realm",
+		CONFIG_NAME_ID_FORMAT:  "The NameID format that is requested from the identity provider",
+	},
+	OutputContext:        []string{"saml_error"},
+	PossibleResultStates: []string{CONDITION_SAML_FAILURE, CONDITION_SAML_NEW_USER, CONDITION_SAML_EXISTING_USER},
+	PossiblePrompts: map[string]string{
+		"__redirect":   "The redirect url to the SAML identity provider",
+		"SAMLResponse": "The response from the SAML identity provider",
+		"RelayState":   "The relay state from the SAML identity provider",
+	},
+	Run: RunSamlLoginNode,
+}
+
+func RunSamlLoginNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+
+	ctx := context.Background()
+
+	for _, key := range []string{CONFIG_IDP_ENTITY_ID, CONFIG_IDP_SSO_URL, CONFIG_IDP_CERTIFICATE, CONFIG_SP_ENTITY_ID} {
+		if node.CustomConfig[key] == "" {
+			return nil, fmt.Errorf("%s is required", key)
+		}
+	}
+
+	acsUrl := getAcsUrl(node, state)
+	if acsUrl == "" {
+		return nil, fmt.Errorf("acs url is required")
+	}
+
+	// if we have a response in the input we validate it
+	if input["SAMLResponse"] != "" {
+		samlAttributeValue, err := finishSamlLogin(state, node, input, acsUrl, services)
+		if err != nil {
+			state.Context["saml_error"] = err.Error()
+			return model.NewNodeResultWithCondition(CONDITION_SAML_FAILURE)
+		}
+		return initUserAndFinish(ctx, state, samlAttributeValue, services)
+	}
+
+	// otherwise we send the user to the identity provider
+	return performSamlLogin(state, node, acsUrl)
+}
+
+func performSamlLogin(state *model.AuthenticationSession, node *model.GraphNode, acsUrl string) (*model.NodeResult, error) {
+
+	requestId, err := saml.NewID()
+	if err != nil {
+		return nil, err
+	}
+
+	// Remember the request, the response must answer it
+	relayState := lib.GenerateSecureSessionID()
+	state.Context["saml_request_id"] = requestId
+	state.Context["saml_relay_state"] = relayState
+	state.Context["saml_acs_url"] = acsUrl
+
+	ssoUrl := node.CustomConfig[CONFIG_IDP_SSO_URL]
+	request := saml.BuildAuthnRequest(requestId, node.CustomConfig[CONFIG_SP_ENTITY_ID], ssoUrl, acsUrl, node.CustomConfig[CONFIG_NAME_ID_FORMAT], time.Now())
+	samlRequest, err := saml.EncodeRedirectRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("SAMLRequest", samlRequest)
+	query.Set("RelayState", relayState)
+
+	separator := "?"
+	if strings.Contains(ssoUrl, "?") {
+		separator = "&"
+	}
+
+	// return the redirect
+	return model.NewNodeResultWithPrompts(map[string]string{
+		"__redirect": ssoUrl + separator + query.Encode(),
+	})
+}
+
+func finishSamlLogin(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, acsUrl string, services *model.Repositories) (*attributes.SamlAttributeValue, error) {
+
+	// The request can only be answered once
+	requestId := state.Context["saml_request_id"]
+	relayState := state.Context["saml_relay_state"]
+	delete(state.Context, "saml_request_id")
+	delete(state.Context, "saml_relay_state")
+
+	if requestId == "" {
+		return nil, fmt.Errorf("no pending saml request")
+	}
+
+	// Check if the relay state is valid
+	if input["RelayState"] != relayState {
+		return nil, fmt.Errorf("invalid relay state")
+	}
+
+	// Use the same acs url as in the request
+	if state.Context["saml_acs_url"] != "" {
+		acsUrl = state.Context["saml_acs_url"]
+	}
+
+	certificate, err := saml.ParseIdpCertificate(node.CustomConfig[CONFIG_IDP_CERTIFICATE])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse idp certificate: %w", err)
+	}
+
+	assertion, err := saml.ValidateResponse(input["SAMLResponse"], &saml.ResponseValidation{
+		IdpEntityId: node.CustomConfig[CONFIG_IDP_ENTITY_ID],
+		Certificate: certificate,
+		SpEntityId:  node.CustomConfig[CONFIG_SP_ENTITY_ID],
+		AcsUrl:      acsUrl,
+		RequestId:   requestId,
+		Now:         time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid saml response: %w", err)
+	}
+
+	if err := consumeAssertion(services.Cache, assertion); err != nil {
+		return nil, err
+	}
+
+	return &attributes.SamlAttributeValue{
+		IdpEntityId:  assertion.Issuer,
+		NameId:       assertion.NameId,
+		NameIdFormat: assertion.NameIdFormat,
+		SessionIndex: assertion.SessionIndex,
+		Attributes:   assertion.Attributes,
+	}, nil
+}
+
+// consumeAssertion remembers the assertion until it expires, so that an assertion that was used in another session
+// is rejected. The check and the update are not atomic and without redis the cache is local to the instance, two
+// instances or two parallel requests could still accept the same assertion.
+func consumeAssertion(cache model.Cache, assertion *saml.Assertion) error {
+
+	if cache == nil {
+		return fmt.Errorf("the cache is required to detect replayed assertions")
+	}
+
+	key := "saml_assertion/" + assertion.Issuer + "/" + assertion.ID
+	if _, ok := cache.Get(key); ok {
+		return fmt.Errorf("assertion %s was already used", assertion.ID)
+	}
+
+	if err := cache.Set(key, assertion.ExpiresAt.UTC().Format(time.RFC3339), time.Until(assertion.ExpiresAt)); err != nil {
+		return fmt.Errorf("failed to remember assertion: %w", err)
+	}
+
+	return nil
+}
+
+func initUserAndFinish(ctx context.Context, state *model.AuthenticationSession, samlAttributeValue *attributes.SamlAttributeValue, services *model.Repositories) (*model.NodeResult, error) {
+
+	// Transient NameIDs change with every login and cannot identify a user
+	if samlAttributeValue.NameIdFormat == saml.NameIdFormatTransient {
+		state.Context["saml_error"] = "transient NameIDs are not supported"
+		return model.NewNodeResultWithCondition(CONDITION_SAML_FAILURE)
+	}
+
+	// Check if we already have a user with the same saml attribute value
+	index := samlAttributeValue.GetIndex()
+	user, err := services.UserRepo.GetByAttributeIndex(ctx, model.AttributeTypeSaml, index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by index: %w", err)
+	}
+
+	// If the user is not known we init a new user in the context and add the saml attribute
+	if user == nil {
+		user, err = services.UserRepo.NewUserModel(state)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+		user.AddAttribute(&model.UserAttribute{
+			Index: &index,
+			Type:  model.AttributeTypeSaml,
+			Value: samlAttributeValue,
+		})
+
+		state.User = user
+		return model.NewNodeResultWithCondition(CONDITION_SAML_NEW_USER)
+	}
+
+	// Like the OIDC login the existing user is not updated with the attributes of the assertion
+	state.User = user
+	return model.NewNodeResultWithCondition(CONDITION_SAML_EXISTING_USER)
+}
+
+// getAcsUrl returns the assertion consumer service URL, by default the one of the realm the flow runs in
+func getAcsUrl(node *model.GraphNode, state *model.AuthenticationSession) string {
+
+	// If we have an acs url in the custom config we use that
+	acsUrl := node.CustomConfig[CONFIG_ACS_URL]
+	if acsUrl != "" {
+		return acsUrl
+	}
+
+	// Otherwise the login uri base is <realm base url>/auth/<route>
+	index := strings.LastIndex(state.LoginUriBase, "/auth/")
+	if index < 0 {
+		return ""
+	}
+	return state.LoginUriBase[:index] + "/saml/acs"
+}
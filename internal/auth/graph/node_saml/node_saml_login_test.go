@@ -0,0 +1,189 @@
+package node_saml
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/auth/repository"
+	"github.com/Identityplane/GoAM/internal/lib/saml"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIdpEntityId = "https://idp.example.com/adfs/services/trust"
+	testSpEntityId  = "https://login.example.com/acme/customers/sp"
+	testAcsUrl      = "http://localhost:8080/acme/customers/saml/acs"
+)
+
+// newTestIdp generates the signing key of an identity provider and returns it with its base64 encoded certificate
+func newTestIdp(t *testing.T) (*saml.SigningKey, string) {
+	privateJWK, _, err := saml.GenerateSigningKey(uuid.NewString(), "idp.example.com")
+	require.NoError(t, err)
+	key, err := saml.ParseSigningKey(privateJWK)
+	require.NoError(t, err)
+
+	return key, base64.StdEncoding.EncodeToString(key.Certificate.Raw)
+}
+
+// startLogin runs the node without input and returns the AuthnRequest and the relay state of the redirect
+func startLogin(t *testing.T, session *model.AuthenticationSession, node *model.GraphNode, services *model.Repositories) (*saml.AuthnRequest, string) {
+	result, err := RunSamlLoginNode(session, node, map[string]string{}, services)
+	require.NoError(t, err)
+
+	redirect, err := url.Parse(result.Prompts["__redirect"])
+	require.NoError(t, err)
+	assert.Equal(t, "idp.example.com", redirect.Host)
+	assert.Equal(t, "customer", redirect.Query().Get("tenant"), "query of the sso url is kept")
+
+	request, err := saml.DecodeRedirectRequest(redirect.Query().Get("SAMLRequest"))
+	require.NoError(t, err)
+
+	return request, redirect.Query().Get("RelayState")
+}
+
+func respond(t *testing.T, key *saml.SigningKey, request *saml.AuthnRequest, nameId string) string {
+	now := time.Now()
+	response, err := saml.BuildResponse(&saml.Response{
+		Issuer:       testIdpEntityId,
+		Destination:  request.AssertionConsumerServiceURL,
+		InResponseTo: request.ID,
+		Audience:     request.Issuer,
+		NameId:       nameId,
+		NameIdFormat: saml.NameIdFormatPersistent,
+		SessionIndex: "_session1",
+		AuthnInstant: now,
+		IssueInstant: now,
+		Lifetime:     5 * time.Minute,
+		Attributes:   map[string][]string{"mail": {"jane@example.com"}},
+	}, key)
+	require.NoError(t, err)
+
+	return base64.StdEncoding.EncodeToString([]byte(response))
+}
+
+func TestSamlLogin(t *testing.T) {
+	key, certificate := newTestIdp(t)
+
+	mockUserRepo := repository.NewMockUserRepository()
+	services := &model.Repositories{
+		UserRepo: mockUserRepo,
+		Cache:    new(repository.MockCache),
+	}
+
+	node := &model.GraphNode{
+		CustomConfig: map[string]string{
+			CONFIG_IDP_ENTITY_ID:   testIdpEntityId,
+			CONFIG_IDP_SSO_URL:     "https://idp.example.com/adfs/ls?tenant=customer",
+			CONFIG_IDP_CERTIFICATE: certificate,
+			CONFIG_SP_ENTITY_ID:    testSpEntityId,
+			CONFIG_NAME_ID_FORMAT:  saml.NameIdFormatPersistent,
+		},
+	}
+
+	session := &model.AuthenticationSession{
+		LoginUriBase: "http://localhost:8080/acme/customers/auth/login",
+		Context:      make(map[string]string),
+	}
+
+	t.Run("Initial state - should return redirect URL", func(t *testing.T) {
+		request, relayState := startLogin(t, session, node, services)
+
+		assert.Equal(t, testSpEntityId, request.Issuer)
+		assert.Equal(t, testAcsUrl, request.AssertionConsumerServiceURL)
+		assert.Equal(t, saml.NameIdFormatPersistent, request.NameIdFormat())
+		assert.Equal(t, request.ID, session.Context["saml_request_id"])
+		assert.NotEmpty(t, relayState)
+	})
+
+	t.Run("With response - new user", func(t *testing.T) {
+		request, relayState := startLogin(t, session, node, services)
+		index := testIdpEntityId + "/jane"
+
+		mockUserRepo.ExpectedCalls = nil
+		mockUserRepo.On("GetByAttributeIndex", mock.Anything, model.AttributeTypeSaml, index).Return(nil, nil)
+		mockUserRepo.On("NewUserModel", session).Return(&model.User{ID: uuid.NewString()}, nil)
+
+		result, err := RunSamlLoginNode(session, node, map[string]string{"SAMLResponse": respond(t, key, request, "jane"), "RelayState": relayState}, services)
+		require.NoError(t, err)
+		assert.Equal(t, CONDITION_SAML_NEW_USER, result.Condition)
+
+		require.Len(t, session.User.UserAttributes, 1)
+		attribute := session.User.UserAttributes[0]
+		assert.Equal(t, model.AttributeTypeSaml, attribute.Type)
+		assert.Equal(t, index, *attribute.Index)
+
+		value, ok := attribute.Value.(*model.SamlAttributeValue)
+		require.True(t, ok)
+		assert.Equal(t, "jane", value.NameId)
+		assert.Equal(t, "_session1", value.SessionIndex)
+		assert.Equal(t, []string{"jane@example.com"}, value.Attributes["mail"])
+	})
+
+	t.Run("With response - existing user", func(t *testing.T) {
+		request, relayState := startLogin(t, session, node, services)
+		existingUser := &model.User{ID: uuid.NewString()}
+
+		mockUserRepo.ExpectedCalls = nil
+		mockUserRepo.On("GetByAttributeIndex", mock.Anything, model.AttributeTypeSaml, testIdpEntityId+"/jane").Return(existingUser, nil)
+
+		result, err := RunSamlLoginNode(session, node, map[string]string{"SAMLResponse": respond(t, key, request, "jane"), "RelayState": relayState}, services)
+		require.NoError(t, err)
+		assert.Equal(t, CONDITION_SAML_EXISTING_USER, result.Condition)
+		assert.Equal(t, existingUser, session.User)
+	})
+
+	t.Run("With response - replayed", func(t *testing.T) {
+		request, relayState := startLogin(t, session, node, services)
+		response := respond(t, key, request, "jane")
+
+		_, err := RunSamlLoginNode(session, node, map[string]string{"SAMLResponse": response, "RelayState": relayState}, services)
+		require.NoError(t, err)
+
+		result, err := RunSamlLoginNode(session, node, map[string]string{"SAMLResponse": response, "RelayState": relayState}, services)
+		require.NoError(t, err)
+		assert.Equal(t, CONDITION_SAML_FAILURE, result.Condition)
+	})
+
+	t.Run("With response - replayed in a copy of the session", func(t *testing.T) {
+		request, relayState := startLogin(t, session, node, services)
+		response := respond(t, key, request, "jane")
+
+		copied := &model.AuthenticationSession{LoginUriBase: session.LoginUriBase, Context: map[string]string{}}
+		for name, value := range session.Context {
+			copied.Context[name] = value
+		}
+
+		_, err := RunSamlLoginNode(session, node, map[string]string{"SAMLResponse": response, "RelayState": relayState}, services)
+		require.NoError(t, err)
+
+		result, err := RunSamlLoginNode(copied, node, map[string]string{"SAMLResponse": response, "RelayState": relayState}, services)
+		require.NoError(t, err)
+		assert.Equal(t, CONDITION_SAML_FAILURE, result.Condition)
+		assert.Contains(t, copied.Context["saml_error"], "was already used")
+	})
+
+	t.Run("With response - invalid relay state", func(t *testing.T) {
+		request, _ := startLogin(t, session, node, services)
+
+		result, err := RunSamlLoginNode(session, node, map[string]string{"SAMLResponse": respond(t, key, request, "jane"), "RelayState": "other"}, services)
+		require.NoError(t, err)
+		assert.Equal(t, CONDITION_SAML_FAILURE, result.Condition)
+		assert.Equal(t, "invalid relay state", session.Context["saml_error"])
+	})
+
+	t.Run("With response - signed by other identity provider", func(t *testing.T) {
+		otherKey, _ := newTestIdp(t)
+		request, relayState := startLogin(t, session, node, services)
+
+		result, err := RunSamlLoginNode(session, node, map[string]string{"SAMLResponse": respond(t, otherKey, request, "jane"), "RelayState": relayState}, services)
+		require.NoError(t, err)
+		assert.Equal(t, CONDITION_SAML_FAILURE, result.Condition)
+		assert.Contains(t, session.Context["saml_error"], "invalid signature")
+	})
+}
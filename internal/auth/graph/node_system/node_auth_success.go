@@ -41,6 +41,7 @@ func RunAuthSuccessNode(state *model.AuthenticationSession, node *model.GraphNod
 	state.Result = &model.FlowResult{
 		UserID:        user.ID,
 		Authenticated: true,
+		AuthLevel:     state.AuthLevel(user.ID),
 	}
 
 	return &model.NodeResult{
@@ -0,0 +1,164 @@
+package node_system
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/lib/expression"
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+const (
+	CONDITION_OPTION_OUTCOMES = "outcomes"
+	CONDITION_OPTION_TIMEZONE = "timezone"
+
+	// CONDITION_NO_MATCH is returned if none of the outcomes matches
+	CONDITION_NO_MATCH = "default"
+)
+
+var outcomeNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+var ConditionNode = &model.NodeDefinition{
+	Name:                 "condition",
+	PrettyName:           "Condition",
+	Description:          "Routes the flow by evaluating expressions over the context, the user, the request, the OAuth2 request and the time. The outcomes are checked in the configured order and the first one that is true is returned, 'default' if none matches.",
+	Category:             "Flow Control",
+	Type:                 model.NodeTypeLogic,
+	RequiredContext:      []string{},
+	OutputContext:        []string{},
+	PossibleResultStates: []string{CONDITION_NO_MATCH},
+	CustomConfigOptions: map[string]string{
+		CONDITION_OPTION_OUTCOMES: "One outcome per line as 'name: expression', e.g. 'internal: ipInRange(request.ip, \"10.0.0.0/8\")' (required)",
+		CONDITION_OPTION_TIMEZONE: "Timezone of the time variables, e.g. Europe/Zurich. Default UTC",
+	},
+	Run:            RunConditionNode,
+	ResultStates:   conditionResultStates,
+	ValidateConfig: validateConditionConfig,
+}
+
+// conditionOutcome is a named expression of a condition node
+type conditionOutcome struct {
+	name       string
+	expression string
+}
+
+func RunConditionNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+
+	outcomes, err := parseOutcomes(node.CustomConfig[CONDITION_OPTION_OUTCOMES])
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := newExpressionEnvironment(state, node)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, outcome := range outcomes {
+		matches, err := expression.EvalBool(outcome.expression, env)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			return model.NewNodeResultWithCondition(outcome.name)
+		}
+	}
+
+	return model.NewNodeResultWithCondition(CONDITION_NO_MATCH)
+}
+
+// parseOutcomes parses the outcomes option, the order of the lines is the order of evaluation
+func parseOutcomes(config string) ([]conditionOutcome, error) {
+
+	var outcomes []conditionOutcome
+	seen := map[string]bool{}
+
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		name, source, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		source = strings.TrimSpace(source)
+
+		if !ok || source == "" {
+			return nil, fmt.Errorf("outcome '%s' must have the form 'name: expression'", line)
+		}
+		if !outcomeNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid outcome name '%s'", name)
+		}
+		if name == CONDITION_NO_MATCH {
+			return nil, fmt.Errorf("outcome '%s' is reserved for when no outcome matches", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("outcome '%s' is defined more than once", name)
+		}
+		seen[name] = true
+
+		outcomes = append(outcomes, conditionOutcome{name: name, expression: source})
+	}
+
+	if len(outcomes) == 0 {
+		return nil, fmt.Errorf("%s is not set", CONDITION_OPTION_OUTCOMES)
+	}
+
+	return outcomes, nil
+}
+
+func conditionResultStates(node *model.GraphNode) []string {
+
+	states := []string{}
+
+	// Invalid outcomes are reported by the validation
+	outcomes, _ := parseOutcomes(node.CustomConfig[CONDITION_OPTION_OUTCOMES])
+	for _, outcome := range outcomes {
+		states = append(states, outcome.name)
+	}
+
+	return append(states, CONDITION_NO_MATCH)
+}
+
+func validateConditionConfig(node *model.GraphNode) error {
+
+	outcomes, err := parseOutcomes(node.CustomConfig[CONDITION_OPTION_OUTCOMES])
+	if err != nil {
+		return err
+	}
+
+	for _, outcome := range outcomes {
+		if _, err := expression.Compile(outcome.expression, expression.KindBool); err != nil {
+			return err
+		}
+	}
+
+	_, err = loadTimezone(node)
+	return err
+}
+
+// newExpressionEnvironment creates the environment for the expressions of the node
+func newExpressionEnvironment(state *model.AuthenticationSession, node *model.GraphNode) (*expression.Environment, error) {
+
+	location, err := loadTimezone(node)
+	if err != nil {
+		return nil, err
+	}
+
+	return expression.NewEnvironment(state, time.Now().In(location)), nil
+}
+
+func loadTimezone(node *model.GraphNode) (*time.Location, error) {
+
+	if node.CustomConfig[CONDITION_OPTION_TIMEZONE] == "" {
+		return time.UTC, nil
+	}
+
+	location, err := time.LoadLocation(node.CustomConfig[CONDITION_OPTION_TIMEZONE])
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %w", err)
+	}
+	return location, nil
+}
@@ -0,0 +1,75 @@
+package node_system
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionNode_FirstMatchingOutcome(t *testing.T) {
+	node := &model.GraphNode{CustomConfig: map[string]string{
+		CONDITION_OPTION_OUTCOMES: `
+			internal: ipInRange(request.ip, "10.0.0.0/8")
+			admin: context.role == "admin"
+		`,
+	}}
+
+	assert.Equal(t, []string{"internal", "admin", CONDITION_NO_MATCH}, ConditionNode.ResultStatesFor(node))
+
+	state := &model.AuthenticationSession{
+		Context:         map[string]string{"role": "admin"},
+		HttpAuthContext: &model.HttpAuthContext{RequestIP: "10.0.0.1"},
+	}
+
+	result, err := RunConditionNode(state, node, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "internal", result.Condition)
+
+	state.HttpAuthContext.RequestIP = "203.0.113.1"
+	result, err = RunConditionNode(state, node, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", result.Condition)
+
+	state.Context["role"] = "user"
+	result, err = RunConditionNode(state, node, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, CONDITION_NO_MATCH, result.Condition)
+}
+
+func TestConditionNode_InvalidConfig(t *testing.T) {
+	tests := map[string]string{
+		"missing outcomes":  "",
+		"missing separator": "internal",
+		"reserved name":     "default: true",
+		"duplicate name":    "a: true\na: false",
+		"invalid name":      "a b: true",
+		"not a condition":   "a: context.role",
+	}
+
+	for name, outcomes := range tests {
+		t.Run(name, func(t *testing.T) {
+			node := &model.GraphNode{CustomConfig: map[string]string{CONDITION_OPTION_OUTCOMES: outcomes}}
+			assert.Error(t, validateConditionConfig(node))
+		})
+	}
+
+	node := &model.GraphNode{CustomConfig: map[string]string{CONDITION_OPTION_OUTCOMES: "a: true", CONDITION_OPTION_TIMEZONE: "Mars/Olympus"}}
+	assert.Error(t, validateConditionConfig(node))
+}
+
+func TestSetVariableNode_Expression(t *testing.T) {
+	node := &model.GraphNode{CustomConfig: map[string]string{"key": "email", "expression": "trim(lower(context.email))"}}
+	state := &model.AuthenticationSession{Context: map[string]string{"email": " Alice@Example.com "}}
+
+	require.NoError(t, validateSetVariableConfig(node))
+
+	result, err := RunSetVariableNode(state, node, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "done", result.Condition)
+	assert.Equal(t, "alice@example.com", state.Context["email"])
+
+	node.CustomConfig["value"] = "static"
+	assert.Error(t, validateSetVariableConfig(node))
+}
@@ -3,23 +3,27 @@ package node_system
 import (
 	"fmt"
 
+	"github.com/Identityplane/GoAM/internal/lib/expression"
 	"github.com/Identityplane/GoAM/pkg/model"
 )
 
 var SetVariableNode = &model.NodeDefinition{
 	Name:                 "setVariable",
 	PrettyName:           "Set Variable",
-	Description:          "Sets a variable in the flow context with a specified key and value",
+	Description:          "Sets a variable in the flow context with a specified key and value. Instead of a static value the result of an expression can be set.",
 	Category:             "Flow Control",
 	Type:                 model.NodeTypeLogic,
 	RequiredContext:      []string{},
 	OutputContext:        []string{},
 	PossibleResultStates: []string{"done"},
 	CustomConfigOptions: map[string]string{
-		"key":   "The key to set in the context (required)",
-		"value": "The value to set for the key in the context (required)",
+		"key":                     "The key to set in the context (required)",
+		"value":                   "The value to set for the key in the context (required unless expression is set)",
+		"expression":              "An expression whose result is set for the key, e.g. 'lower(context.email)'",
+		CONDITION_OPTION_TIMEZONE: "Timezone of the time variables in the expression, e.g. Europe/Zurich. Default UTC",
 	},
-	Run: RunSetVariableNode,
+	Run:            RunSetVariableNode,
+	ValidateConfig: validateSetVariableConfig,
 }
 
 func RunSetVariableNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
@@ -29,15 +33,52 @@ func RunSetVariableNode(state *model.AuthenticationSession, node *model.GraphNod
 		return nil, fmt.Errorf("key is not set")
 	}
 
+	key := node.CustomConfig["key"]
+
+	// computed value
+	if source := node.CustomConfig["expression"]; source != "" {
+
+		env, err := newExpressionEnvironment(state, node)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := expression.EvalString(source, env)
+		if err != nil {
+			return nil, err
+		}
+
+		state.Context[key] = value
+		return model.NewNodeResultWithCondition("done")
+	}
+
 	// check if value is set
 	if node.CustomConfig["value"] == "" {
 		return nil, fmt.Errorf("value is not set")
 	}
 
-	key := node.CustomConfig["key"]
 	value := node.CustomConfig["value"]
 
 	state.Context[key] = value
 
 	return model.NewNodeResultWithCondition("done")
 }
+
+func validateSetVariableConfig(node *model.GraphNode) error {
+
+	source := node.CustomConfig["expression"]
+	if source == "" {
+		return nil
+	}
+
+	if node.CustomConfig["value"] != "" {
+		return fmt.Errorf("value and expression cannot be set both")
+	}
+
+	if _, err := expression.Compile(source, expression.KindValue); err != nil {
+		return err
+	}
+
+	_, err := loadTimezone(node)
+	return err
+}
@@ -0,0 +1,171 @@
+package node_system
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+const (
+	SUBFLOW_OPTION_FLOW    = "flow"
+	SUBFLOW_OPTION_INPUTS  = "inputs"
+	SUBFLOW_OPTION_OUTPUTS = "outputs"
+
+	SUBFLOW_SUCCESS = "success" // The child flow reached a successResult node
+	SUBFLOW_FAILURE = "failure" // The child flow reached a failureResult node
+
+	// SUBFLOW_ENTER is the transition into the start node of the child flow, it is added when the flow is loaded for execution
+	SUBFLOW_ENTER = "enter"
+
+	// SUBFLOW_NAMESPACE_SEPARATOR separates the name of the subflow node from the names of the child flow's nodes
+	SUBFLOW_NAMESPACE_SEPARATOR = "."
+)
+
+var SubflowNode = &model.NodeDefinition{
+	Name:                 "subflow",
+	PrettyName:           "Subflow",
+	Description:          "Runs another flow of the same realm as part of this flow, e.g. a shared MFA or registration step. The child flow has its own context, only the mapped inputs are passed to it and only the mapped outputs are copied back. The user is shared. The node returns 'success' or 'failure' depending on the result node the child flow reaches.",
+	Category:             "Flow Control",
+	Type:                 model.NodeTypeLogic,
+	RequiredContext:      []string{},
+	OutputContext:        []string{},
+	PossibleResultStates: []string{SUBFLOW_SUCCESS, SUBFLOW_FAILURE},
+	CustomConfigOptions: map[string]string{
+		SUBFLOW_OPTION_FLOW:    "Id of the flow to run (required)",
+		SUBFLOW_OPTION_INPUTS:  "Context values passed to the child flow, one per line as 'child_key: parent_key' or just 'key' if the name is the same",
+		SUBFLOW_OPTION_OUTPUTS: "Context values copied back from the child flow, one per line as 'parent_key: child_key' or just 'key' if the name is the same",
+	},
+	Run:            RunSubflowNode,
+	ResultStates:   subflowResultStates,
+	ValidateConfig: validateSubflowConfig,
+}
+
+func RunSubflowNode(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+
+	// The child flow has finished and returned to this node
+	if frame := state.CurrentSubflow(); frame != nil && frame.Node == node.Name && frame.Result != "" {
+		return returnFromSubflow(state, node)
+	}
+
+	if _, ok := node.Next[SUBFLOW_ENTER]; !ok {
+		return nil, fmt.Errorf("subflow node '%s' was not expanded, the flow must be loaded for execution", node.Name)
+	}
+
+	inputs, err := parseSubflowMapping(node.CustomConfig[SUBFLOW_OPTION_INPUTS])
+	if err != nil {
+		return nil, err
+	}
+
+	childContext := make(map[string]string)
+	for target, source := range inputs {
+		if value, ok := state.Context[source]; ok {
+			childContext[target] = value
+		}
+	}
+
+	state.Subflows = append(state.Subflows, model.SubflowFrame{Node: node.Name, Context: state.Context})
+	state.Context = childContext
+
+	return model.NewNodeResultWithCondition(SUBFLOW_ENTER)
+}
+
+// returnFromSubflow restores the context of the parent flow and copies the outputs of the child flow into it
+func returnFromSubflow(state *model.AuthenticationSession, node *model.GraphNode) (*model.NodeResult, error) {
+
+	outputs, err := parseSubflowMapping(node.CustomConfig[SUBFLOW_OPTION_OUTPUTS])
+	if err != nil {
+		return nil, err
+	}
+
+	frame := *state.CurrentSubflow()
+	state.Subflows = state.Subflows[:len(state.Subflows)-1]
+
+	childContext := state.Context
+	state.Context = frame.Context
+	if state.Context == nil {
+		state.Context = make(map[string]string)
+	}
+
+	for target, source := range outputs {
+		if value, ok := childContext[source]; ok {
+			state.Context[target] = value
+		}
+	}
+
+	return model.NewNodeResultWithCondition(frame.Result)
+}
+
+// parseSubflowMapping parses an inputs or outputs option into a map of target key to source key
+func parseSubflowMapping(config string) (map[string]string, error) {
+
+	mapping := map[string]string{}
+
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		target, source, ok := strings.Cut(line, ":")
+		target = strings.TrimSpace(target)
+		source = strings.TrimSpace(source)
+		if !ok {
+			source = target
+		}
+
+		if target == "" || source == "" {
+			return nil, fmt.Errorf("mapping '%s' must have the form 'target: source' or 'key'", line)
+		}
+		if _, exists := mapping[target]; exists {
+			return nil, fmt.Errorf("key '%s' is mapped more than once", target)
+		}
+
+		mapping[target] = source
+	}
+
+	return mapping, nil
+}
+
+// SubflowOutputKeys returns the context keys the subflow node sets in the parent flow
+func SubflowOutputKeys(node *model.GraphNode) []string {
+
+	// Invalid mappings are reported by the validation
+	outputs, _ := parseSubflowMapping(node.CustomConfig[SUBFLOW_OPTION_OUTPUTS])
+
+	keys := make([]string, 0, len(outputs))
+	for target := range outputs {
+		keys = append(keys, target)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// subflowResultStates adds the transition into the child flow once the node has been expanded
+func subflowResultStates(node *model.GraphNode) []string {
+
+	if _, ok := node.Next[SUBFLOW_ENTER]; ok {
+		return []string{SUBFLOW_SUCCESS, SUBFLOW_FAILURE, SUBFLOW_ENTER}
+	}
+
+	return []string{SUBFLOW_SUCCESS, SUBFLOW_FAILURE}
+}
+
+func validateSubflowConfig(node *model.GraphNode) error {
+
+	if node.CustomConfig[SUBFLOW_OPTION_FLOW] == "" {
+		return fmt.Errorf("%s is not set", SUBFLOW_OPTION_FLOW)
+	}
+
+	if _, err := parseSubflowMapping(node.CustomConfig[SUBFLOW_OPTION_INPUTS]); err != nil {
+		return fmt.Errorf("%s: %w", SUBFLOW_OPTION_INPUTS, err)
+	}
+
+	if _, err := parseSubflowMapping(node.CustomConfig[SUBFLOW_OPTION_OUTPUTS]); err != nil {
+		return fmt.Errorf("%s: %w", SUBFLOW_OPTION_OUTPUTS, err)
+	}
+
+	return nil
+}
@@ -23,7 +23,8 @@ var TOTPCreateNode = &model.NodeDefinition{
 	PossiblePrompts: map[string]string{
 		"totpVerification": "string",
 	},
-	OutputContext: []string{""},
+	OutputContext:    []string{""},
+	SensitiveContext: []string{"totpSecret", "totpImageUrl"},
 	CustomConfigOptions: map[string]string{
 		"totpIssuer":   "The name of the issuer displayed in the TOTP QR code",
 		"skipSaveUser": "If true, the user will not be saved to the database after the TOTP is created and only the context will be updated",
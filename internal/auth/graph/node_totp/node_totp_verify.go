@@ -124,6 +124,7 @@ func RunTOTPVerifyNode(state *model.AuthenticationSession, node *model.GraphNode
 			}
 		}
 
+		state.AddAuthMethod(model.AuthMethodOtp)
 		return model.NewNodeResultWithCondition(model.ResultStateSuccess)
 	}
 }
@@ -21,6 +21,7 @@ var CreateUserNode = &model.NodeDefinition{
 		"skipSaveUser":        "If set to 'true' the user will not be saved to the database after creation and only the context will be updated",
 	},
 	OutputContext:        []string{"user_id"},
+	SensitiveContext:     []string{"password"},
 	PossibleResultStates: []string{"success", "existing"},
 	Run:                  RunCreateUserNode,
 }
@@ -14,4 +14,7 @@ var AskUsernameNode = &model.NodeDefinition{
 		"username": "text",
 	},
 	PossibleResultStates: []string{"submitted"},
+	CustomConfigOptions: map[string]string{
+		"showRegisterLink": "if set then show a link to the registration",
+	},
 }
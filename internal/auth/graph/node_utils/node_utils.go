@@ -3,6 +3,8 @@ package node_utils
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strconv"
 
 	"github.com/Identityplane/GoAM/pkg/model"
 )
@@ -112,3 +114,17 @@ func TryLoadUserFromContext(state *model.AuthenticationSession, services *model.
 
 	return user, nil
 }
+
+// IntOption returns the custom config option of the node as number, or the default value if the option is not set
+func IntOption(node *model.GraphNode, option string, defaultValue int) (int, error) {
+
+	if node.CustomConfig[option] == "" {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.Atoi(node.CustomConfig[option])
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", option, err)
+	}
+	return value, nil
+}
@@ -33,6 +33,8 @@ var YubicoCreateNode = &model.NodeDefinition{
 		CONFIG_YUBICO_CLIENT_ID:    "The Client ID of the Yubikey API",
 		CONFIG_YUBICO_API_KEY:      "The API Key of the Yubikey API",
 		CONFIG_CHECK_YUBICO_UNIQUE: "If true, the node will check if another user already has this yubikey registered. This is needed to sign-in with the yubikey as primary method.",
+		"label":                    "Label of the OTP input",
+		"button_text":              "Text of the submit button",
 	},
 	PossibleResultStates: []string{
 		model.ResultStateSuccess,
@@ -77,7 +79,7 @@ func RunYubicoCreateNode(state *model.AuthenticationSession, node *model.GraphNo
 	}
 
 	// Create the verifier instance
-	verifier := getYubikeyVerifier(apiUrl, clientId, apiKey)
+	verifier := getYubikeyVerifier(apiUrl, clientId, apiKey, services.HTTPClient)
 
 	// Verify the OTP
 	publicId, valid, err := verifier.VerifyYubicoOtp(input["yubikeyOtpVerification"])
@@ -94,7 +94,7 @@ func TestYubicoCreateHasVerifyFlow(t *testing.T) {
 
 	// Override the getYubikeyVerifier function for testing
 	originalGetYubikeyVerifier := getYubikeyVerifier
-	getYubikeyVerifier = func(apiUrl, clientId, apiKey string) *YubicoVerifier {
+	getYubikeyVerifier = func(apiUrl, clientId, apiKey string, client model.HTTPClient) *YubicoVerifier {
 		return &YubicoVerifier{
 			apiUrl:    apiUrl,
 			clientId:  clientId,
@@ -328,7 +328,7 @@ func TestYubicoVerifyNodeWithNoYubikey(t *testing.T) {
 	}
 
 	originalGetYubikeyVerifier := getYubikeyVerifier
-	getYubikeyVerifier = func(apiUrl, clientId, apiKey string) *YubicoVerifier {
+	getYubikeyVerifier = func(apiUrl, clientId, apiKey string, client model.HTTPClient) *YubicoVerifier {
 		return &YubicoVerifier{
 			apiUrl:    apiUrl,
 			clientId:  clientId,
@@ -394,7 +394,7 @@ func TestYubicoVerifyNodeWithInternalError(t *testing.T) {
 	}
 
 	originalGetYubikeyVerifier := getYubikeyVerifier
-	getYubikeyVerifier = func(apiUrl, clientId, apiKey string) *YubicoVerifier {
+	getYubikeyVerifier = func(apiUrl, clientId, apiKey string, client model.HTTPClient) *YubicoVerifier {
 		return &YubicoVerifier{
 			apiUrl:    apiUrl,
 			clientId:  clientId,
@@ -464,7 +464,7 @@ func TestYubicoCreateNodeWithUniqueCheck(t *testing.T) {
 
 	// Override the getYubikeyVerifier function for testing
 	originalGetYubikeyVerifier := getYubikeyVerifier
-	getYubikeyVerifier = func(apiUrl, clientId, apiKey string) *YubicoVerifier {
+	getYubikeyVerifier = func(apiUrl, clientId, apiKey string, client model.HTTPClient) *YubicoVerifier {
 		return &YubicoVerifier{
 			apiUrl:    apiUrl,
 			clientId:  clientId,
@@ -571,7 +571,7 @@ func TestYubicoVerifyNodeWithLockedYubikey(t *testing.T) {
 	}
 
 	originalGetYubikeyVerifier := getYubikeyVerifier
-	getYubikeyVerifier = func(apiUrl, clientId, apiKey string) *YubicoVerifier {
+	getYubikeyVerifier = func(apiUrl, clientId, apiKey string, client model.HTTPClient) *YubicoVerifier {
 		return &YubicoVerifier{
 			apiUrl:    apiUrl,
 			clientId:  clientId,
@@ -643,7 +643,7 @@ func TestYubicoCreateVerifyFlowWithLockedYubikey(t *testing.T) {
 
 	// Override the getYubikeyVerifier function for testing
 	originalGetYubikeyVerifier := getYubikeyVerifier
-	getYubikeyVerifier = func(apiUrl, clientId, apiKey string) *YubicoVerifier {
+	getYubikeyVerifier = func(apiUrl, clientId, apiKey string, client model.HTTPClient) *YubicoVerifier {
 		return &YubicoVerifier{
 			apiUrl:    apiUrl,
 			clientId:  clientId,
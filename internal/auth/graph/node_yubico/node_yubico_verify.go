@@ -30,6 +30,8 @@ var YubicoVerifyNode = &model.NodeDefinition{
 		CONFIG_YUBICO_API_KEY:      "The API Key of the Yubikey API",
 		CONFIG_CHECK_YUBICO_UNIQUE: "If true, the node will check if another user already has this yubikey registered. This is needed to sign-in with the yubikey as primary method.",
 		CONFIG_YUBICO_CREATE_USER:  "If true, the node will create a user if the user is not found in the context. This is only allowed if yubikey-checkunique is true.",
+		"label":                    "Label of the OTP input",
+		"button_text":              "Text of the submit button",
 	},
 	PossibleResultStates: []string{
 		model.ResultStateSuccess,
@@ -80,7 +82,7 @@ func RunYubicoVerifyNode(state *model.AuthenticationSession, node *model.GraphNo
 	}
 
 	// Create the verifier instance
-	verifier := getYubikeyVerifier(apiUrl, clientId, apiKey)
+	verifier := getYubikeyVerifier(apiUrl, clientId, apiKey, services.HTTPClient)
 
 	// Verify the OTP
 	publicId, valid, err := verifier.VerifyYubicoOtp(input["yubikeyOtpVerification"])
@@ -133,6 +135,7 @@ func RunYubicoVerifyNode(state *model.AuthenticationSession, node *model.GraphNo
 				return model.NewNodeResultWithCondition(model.ResultStateLocked)
 			}
 
+			state.AddAuthMethod(model.AuthMethodOtp)
 			return model.NewNodeResultWithCondition(model.ResultStateSuccess)
 		}
 	}
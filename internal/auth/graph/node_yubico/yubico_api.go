@@ -11,9 +11,9 @@ import (
 	"net/url"
 	"sort"
 	"strings"
-	"time"
 
 	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/pkg/model"
 )
 
 const (
@@ -49,9 +49,9 @@ type YubicoVerifier struct {
 	yubicoApi yubicoApiInterface
 }
 
-// NewHttpYubicoVerifier creates a new YubicoVerifier instance using a http client
-func NewHttpYubicoVerifier(apiUrl, clientId, apiKey string) *YubicoVerifier {
-	return NewYubicoVerifier(apiUrl, clientId, apiKey, newYubicoHttpClient(apiUrl, clientId, apiKey))
+// NewHttpYubicoVerifier creates a new YubicoVerifier instance that sends the requests with the http client
+func NewHttpYubicoVerifier(apiUrl, clientId, apiKey string, client model.HTTPClient) *YubicoVerifier {
+	return NewYubicoVerifier(apiUrl, clientId, apiKey, newYubicoHttpClient(apiUrl, clientId, apiKey, client))
 }
 
 // NewYubicoVerifier creates a new YubicoVerifier instance
@@ -66,8 +66,8 @@ func NewYubicoVerifier(apiUrl, clientId, apiKey string, yubicoApi yubicoApiInter
 
 // getYubikeyVerifier is a function that returns a YubicoVerifier instance
 // For testing this can be overwritten with a mock implementation
-var getYubikeyVerifier = func(apiUrl, clientId, apiKey string) *YubicoVerifier {
-	return NewHttpYubicoVerifier(apiUrl, clientId, apiKey)
+var getYubikeyVerifier = func(apiUrl, clientId, apiKey string, client model.HTTPClient) *YubicoVerifier {
+	return NewHttpYubicoVerifier(apiUrl, clientId, apiKey, client)
 }
 
 // VerifyYubicoOtp verifies an OTP and returns the public ID, success status, and any internal error
@@ -219,23 +219,25 @@ type yubicoHttpClient struct {
 	apiUrl   string
 	clientId string
 	apiKey   string
-	client   *http.Client
+	client   model.HTTPClient
 }
 
 // newYubicoHttpClient creates a new HTTP client for Yubico API
-func newYubicoHttpClient(apiUrl, clientId, apiKey string) *yubicoHttpClient {
+func newYubicoHttpClient(apiUrl, clientId, apiKey string, client model.HTTPClient) *yubicoHttpClient {
 	return &yubicoHttpClient{
 		apiUrl:   apiUrl,
 		clientId: clientId,
 		apiKey:   apiKey,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		client:   client,
 	}
 }
 
 // Verify implements the YubicoApiInterface by making an HTTP request to the Yubico API
 func (c *yubicoHttpClient) Verify(id, otp, nonce string) (YubicoApiResponse, error) {
+	if c.client == nil {
+		return YubicoApiResponse{}, fmt.Errorf("no http client available")
+	}
+
 	// Build query parameters
 	params := url.Values{}
 	params.Set("id", id)
@@ -247,7 +249,12 @@ func (c *yubicoHttpClient) Verify(id, otp, nonce string) (YubicoApiResponse, err
 	requestURL := c.apiUrl + "?" + params.Encode()
 
 	// Make the HTTP request
-	resp, err := c.client.Get(requestURL)
+	req, err := http.NewRequest(http.MethodGet, requestURL, nil)
+	if err != nil {
+		return YubicoApiResponse{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
 	if err != nil {
 		return YubicoApiResponse{}, fmt.Errorf("HTTP request failed: %w", err)
 	}
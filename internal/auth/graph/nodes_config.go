@@ -6,10 +6,15 @@ import (
 	"github.com/Identityplane/GoAM/internal/auth/graph/node_email"
 	"github.com/Identityplane/GoAM/internal/auth/graph/node_forms"
 	"github.com/Identityplane/GoAM/internal/auth/graph/node_github"
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_http"
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_ldap"
 	"github.com/Identityplane/GoAM/internal/auth/graph/node_oidc"
 	"github.com/Identityplane/GoAM/internal/auth/graph/node_options"
 	"github.com/Identityplane/GoAM/internal/auth/graph/node_passkeys"
 	"github.com/Identityplane/GoAM/internal/auth/graph/node_password"
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_phone"
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_recovery"
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_saml"
 	"github.com/Identityplane/GoAM/internal/auth/graph/node_system"
 	"github.com/Identityplane/GoAM/internal/auth/graph/node_telegram"
 	"github.com/Identityplane/GoAM/internal/auth/graph/node_totp"
@@ -19,7 +24,8 @@ import (
 	"github.com/Identityplane/GoAM/pkg/model"
 )
 
-var NodeDefinitions = map[string]*model.NodeDefinition{
+// builtinNodeDefinitions are the nodes that ship with GoAM, custom nodes are added with RegisterNodeDefinition
+var builtinNodeDefinitions = map[string]*model.NodeDefinition{
 
 	// System
 	node_system.InitNode.Name:          node_system.InitNode,
@@ -27,6 +33,8 @@ var NodeDefinitions = map[string]*model.NodeDefinition{
 	node_system.FailureResultNode.Name: node_system.FailureResultNode,
 	node_system.SetVariableNode.Name:   node_system.SetVariableNode,
 	node_system.DebugNode.Name:         node_system.DebugNode,
+	node_system.ConditionNode.Name:     node_system.ConditionNode,
+	node_system.SubflowNode.Name:       node_system.SubflowNode,
 
 	// User Management
 	node_user.CreateUserNode.Name: node_user.CreateUserNode,
@@ -45,6 +53,8 @@ var NodeDefinitions = map[string]*model.NodeDefinition{
 	node_password.ValidateUsernamePasswordNode.Name: node_password.ValidateUsernamePasswordNode,
 	node_password.AskUsernamePasswordNode.Name:      node_password.AskUsernamePasswordNode,
 	node_password.AskEmailPasswordNode.Name:         node_password.AskEmailPasswordNode,
+	node_password.RequestPasswordResetNode.Name:     node_password.RequestPasswordResetNode,
+	node_password.VerifyPasswordResetTokenNode.Name: node_password.VerifyPasswordResetTokenNode,
 
 	// Forms
 	node_forms.MessageConfirmationNode.Name: node_forms.MessageConfirmationNode,
@@ -63,9 +73,15 @@ var NodeDefinitions = map[string]*model.NodeDefinition{
 	node_email.AskEmailNode.Name:            node_email.AskEmailNode,
 	node_email.CheckEmailAvailableNode.Name: node_email.CheckEmailAvailableNode,
 	node_email.EmailOTPNode.Name:            node_email.EmailOTPNode,
+	node_email.EmailMagicLinkNode.Name:      node_email.EmailMagicLinkNode,
 	node_email.HasEmailNode.Name:            node_email.HasEmailNode,
 	node_email.SaveEmailNode.Name:           node_email.SaveEmailNode,
 
+	// Phone
+	node_phone.AskPhoneNode.Name:  node_phone.AskPhoneNode,
+	node_phone.SMSOTPNode.Name:    node_phone.SMSOTPNode,
+	node_phone.SavePhoneNode.Name: node_phone.SavePhoneNode,
+
 	// TOTP
 	node_totp.TOTPCreateNode.Name: node_totp.TOTPCreateNode,
 	node_totp.TOTPVerifyNode.Name: node_totp.TOTPVerifyNode,
@@ -76,6 +92,11 @@ var NodeDefinitions = map[string]*model.NodeDefinition{
 	node_yubico.YubicoVerifyNode.Name: node_yubico.YubicoVerifyNode,
 	node_yubico.HasYubicoNode.Name:    node_yubico.HasYubicoNode,
 
+	// Recovery Codes
+	node_recovery.RecoveryCodesCreateNode.Name: node_recovery.RecoveryCodesCreateNode,
+	node_recovery.RecoveryCodeVerifyNode.Name:  node_recovery.RecoveryCodeVerifyNode,
+	node_recovery.HasRecoveryCodesNode.Name:    node_recovery.HasRecoveryCodesNode,
+
 	// Captcha
 	node_captcha.HcaptchaNode.Name: node_captcha.HcaptchaNode,
 
@@ -91,11 +112,13 @@ var NodeDefinitions = map[string]*model.NodeDefinition{
 
 	// OIDC
 	node_oidc.GenericOIDCLoginNode.Name: node_oidc.GenericOIDCLoginNode,
-}
 
-func GetNodeDefinitionByName(name string) *model.NodeDefinition {
-	if def, ok := NodeDefinitions[name]; ok {
-		return def
-	}
-	return nil
+	// SAML
+	node_saml.SamlLoginNode.Name: node_saml.SamlLoginNode,
+
+	// LDAP
+	node_ldap.LdapBindNode.Name: node_ldap.LdapBindNode,
+
+	// Integrations
+	node_http.HttpRequestNode.Name: node_http.HttpRequestNode,
 }
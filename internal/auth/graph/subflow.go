@@ -0,0 +1,173 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_system"
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// SubflowLoader returns the definition of a flow of the same realm, or nil if there is no flow with the id
+type SubflowLoader func(flowId string) (*model.FlowDefinition, error)
+
+// ExpandSubflows returns a copy of the flow in which the nodes of all child flows are added under the namespace of
+// their subflow node, e.g. the node "verifyTOTP" of the child flow run by the subflow node "mfa" becomes "mfa.verifyTOTP".
+// The nodes of the child flow can then be executed and rendered like any other node of the flow. Child flows that
+// contain subflow nodes themselves are expanded as well, a flow that includes itself is an error.
+func ExpandSubflows(flowId string, def *model.FlowDefinition, load SubflowLoader) (*model.FlowDefinition, error) {
+	return expandSubflows([]string{flowId}, def, load)
+}
+
+func expandSubflows(path []string, def *model.FlowDefinition, load SubflowLoader) (*model.FlowDefinition, error) {
+
+	expanded := &model.FlowDefinition{
+		Description: def.Description,
+		Start:       def.Start,
+		OnError:     def.OnError,
+		Nodes:       make(map[string]*model.GraphNode, len(def.Nodes)),
+	}
+
+	for _, name := range sortedNodeNames(def.Nodes) {
+		node := copyGraphNode(def.Nodes[name])
+		expanded.Nodes[name] = node
+
+		if node == nil || node.Use != node_system.SubflowNode.Name {
+			continue
+		}
+
+		childId := node.CustomConfig[node_system.SUBFLOW_OPTION_FLOW]
+		if contains(path, childId) {
+			return nil, recursiveSubflowIssue(name, path, childId)
+		}
+
+		child, err := load(childId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load flow '%s' of subflow node '%s': %w", childId, name, err)
+		}
+		if child == nil {
+			return nil, fmt.Errorf("subflow node '%s' references unknown flow '%s'", name, childId)
+		}
+
+		child, err = expandSubflows(append(path[:len(path):len(path)], childId), child, load)
+		if err != nil {
+			return nil, err
+		}
+
+		// The frame of the running subflow refers to the node by the name it has in the flow
+		node.Name = name
+
+		prefix := name + node_system.SUBFLOW_NAMESPACE_SEPARATOR
+		for childName, childNode := range child.Nodes {
+			if _, exists := def.Nodes[prefix+childName]; exists {
+				return nil, fmt.Errorf("node '%s' of flow '%s' conflicts with a node of the parent flow", prefix+childName, childId)
+			}
+
+			namespaced := copyGraphNode(childNode)
+			namespaced.Name = prefix + childName
+			for condition, target := range namespaced.Next {
+				namespaced.Next[condition] = prefix + target
+			}
+
+			// The on_error node of the child flow handles the errors of its nodes, the on_error node of the
+			// parent flow is only used if the child flow has none
+			if _, ok := namespaced.Next[NextError]; !ok && child.OnError != "" && childName != child.OnError {
+				namespaced.Next[NextError] = prefix + child.OnError
+			}
+			expanded.Nodes[prefix+childName] = namespaced
+		}
+
+		node.Next[node_system.SUBFLOW_ENTER] = prefix + child.Start
+	}
+
+	return expanded, nil
+}
+
+// CheckSubflowIncludes returns an error if the flow includes itself, either directly or through the subflows of
+// other flows. Flows that do not exist yet are skipped, they are checked once they are created. The error points to
+// the subflow node of the flow through which it includes itself.
+func CheckSubflowIncludes(flowId string, def *model.FlowDefinition, load SubflowLoader) error {
+	return checkSubflowIncludes([]string{flowId}, def, load, "")
+}
+
+func checkSubflowIncludes(path []string, def *model.FlowDefinition, load SubflowLoader, root string) error {
+
+	for _, name := range sortedNodeNames(def.Nodes) {
+		node := def.Nodes[name]
+		if node == nil || node.Use != node_system.SubflowNode.Name {
+			continue
+		}
+
+		issueNode := root
+		if issueNode == "" {
+			issueNode = name
+		}
+
+		childId := node.CustomConfig[node_system.SUBFLOW_OPTION_FLOW]
+		if contains(path, childId) {
+			return recursiveSubflowIssue(issueNode, path, childId)
+		}
+
+		child, err := load(childId)
+		if err != nil {
+			return err
+		}
+		if child == nil {
+			continue
+		}
+
+		if err := checkSubflowIncludes(append(path[:len(path):len(path)], childId), child, load, issueNode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func recursiveSubflowIssue(node string, path []string, childId string) FlowIssue {
+	return FlowIssue{
+		Node:     node,
+		Field:    "custom_config",
+		Key:      node_system.SUBFLOW_OPTION_FLOW,
+		Message:  fmt.Sprintf("subflow node '%s' includes flow '%s' recursively: %s", node, childId, strings.Join(append(path, childId), " -> ")),
+		Severity: FlowIssueError,
+	}
+}
+
+// returnToSubflowNode ends the running subflow when its child flow reaches a result node. Instead of finishing the
+// session the flow continues at the subflow node, which returns the result of the child flow to the parent flow.
+func returnToSubflowNode(state *model.AuthenticationSession, node *model.GraphNode) bool {
+
+	frame := state.CurrentSubflow()
+	if frame == nil || !strings.HasPrefix(node.Name, frame.Node+node_system.SUBFLOW_NAMESPACE_SEPARATOR) {
+		return false
+	}
+
+	frame.Result = node_system.SUBFLOW_FAILURE
+	if node.Use == model.NODE_SUCCESS_RESULT {
+		frame.Result = node_system.SUBFLOW_SUCCESS
+	}
+
+	state.History = append(state.History, node.Name)
+	state.Current = frame.Node
+
+	return true
+}
+
+func copyGraphNode(node *model.GraphNode) *model.GraphNode {
+	if node == nil {
+		return nil
+	}
+
+	copied := *node
+	copied.Next = make(map[string]string, len(node.Next))
+	for condition, target := range node.Next {
+		copied.Next[condition] = target
+	}
+	copied.CustomConfig = make(map[string]string, len(node.CustomConfig))
+	for key, value := range node.CustomConfig {
+		copied.CustomConfig[key] = value
+	}
+
+	return &copied
+}
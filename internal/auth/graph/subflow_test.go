@@ -0,0 +1,247 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSubflowTestFlows returns a parent flow that runs the child flow "verify" with the subflow node "mfa".
+// The child asks for the username again and succeeds if it matches the one passed from the parent.
+func newSubflowTestFlows() (*model.FlowDefinition, map[string]*model.FlowDefinition) {
+	parent := &model.FlowDefinition{
+		Start: "init",
+		Nodes: map[string]*model.GraphNode{
+			"init":    {Name: "init", Use: "init", Next: map[string]string{"start": "setUser"}},
+			"setUser": {Name: "setUser", Use: "setVariable", Next: map[string]string{"done": "mfa"}, CustomConfig: map[string]string{"key": "username", "value": "bob"}},
+			"mfa": {
+				Name: "mfa",
+				Use:  "subflow",
+				Next: map[string]string{"success": "verified", "failure": "rejected"},
+				CustomConfig: map[string]string{
+					"flow":    "verify",
+					"inputs":  "expected: username",
+					"outputs": "verified_by: method",
+				},
+			},
+			"verified": {Name: "verified", Use: "failureResult"},
+			"rejected": {Name: "rejected", Use: "failureResult"},
+		},
+	}
+
+	child := &model.FlowDefinition{
+		Start: "init",
+		Nodes: map[string]*model.GraphNode{
+			"init":        {Name: "init", Use: "init", Next: map[string]string{"start": "askUsername"}},
+			"askUsername": {Name: "askUsername", Use: "askUsername", Next: map[string]string{"submitted": "check"}},
+			"check": {
+				Name:         "check",
+				Use:          "condition",
+				Next:         map[string]string{"match": "setMethod", "default": "failureResult"},
+				CustomConfig: map[string]string{"outcomes": "match: context.username == context.expected"},
+			},
+			"setMethod":     {Name: "setMethod", Use: "setVariable", Next: map[string]string{"done": "successResult"}, CustomConfig: map[string]string{"key": "method", "value": "username"}},
+			"successResult": {Name: "successResult", Use: "successResult"},
+			"failureResult": {Name: "failureResult", Use: "failureResult"},
+		},
+	}
+
+	return parent, map[string]*model.FlowDefinition{"verify": child}
+}
+
+func loaderFor(flows map[string]*model.FlowDefinition) SubflowLoader {
+	return func(flowId string) (*model.FlowDefinition, error) {
+		return flows[flowId], nil
+	}
+}
+
+func TestExpandSubflows_NamespacesChildNodes(t *testing.T) {
+	parent, flows := newSubflowTestFlows()
+
+	expanded, err := ExpandSubflows("login", parent, loaderFor(flows))
+	require.NoError(t, err)
+
+	require.Contains(t, expanded.Nodes, "mfa.askUsername")
+	assert.Equal(t, "mfa.askUsername", expanded.Nodes["mfa.askUsername"].Name)
+	assert.Equal(t, "mfa.check", expanded.Nodes["mfa.askUsername"].Next["submitted"])
+	assert.Equal(t, "mfa.init", expanded.Nodes["mfa"].Next["enter"])
+
+	// The loaded definitions are not changed
+	assert.NotContains(t, parent.Nodes, "mfa.askUsername")
+	assert.NotContains(t, parent.Nodes["mfa"].Next, "enter")
+	assert.Equal(t, "check", flows["verify"].Nodes["askUsername"].Next["submitted"])
+}
+
+func TestRun_Subflow(t *testing.T) {
+	parent, flows := newSubflowTestFlows()
+	flow, err := ExpandSubflows("login", parent, loaderFor(flows))
+	require.NoError(t, err)
+
+	t.Run("success maps the outputs", func(t *testing.T) {
+		state := InitFlow(flow)
+
+		state, err := Run(flow, state, nil, &model.Repositories{})
+		require.NoError(t, err)
+		assert.Equal(t, "mfa.askUsername", state.Current)
+		require.NotNil(t, state.CurrentSubflow())
+
+		// The child only sees the mapped inputs
+		assert.Equal(t, map[string]string{"expected": "bob"}, state.Context)
+
+		state, err = Run(flow, state, map[string]string{"username": "bob"}, &model.Repositories{})
+		require.NoError(t, err)
+		assert.Equal(t, "verified", state.Current)
+		assert.Empty(t, state.Subflows)
+
+		// The parent context is restored and only the outputs are copied back
+		assert.Equal(t, map[string]string{"username": "bob", "verified_by": "username"}, state.Context)
+		assert.Contains(t, state.History, "mfa.successResult")
+		assert.Contains(t, state.History, "mfa:success")
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		state := InitFlow(flow)
+
+		state, err := Run(flow, state, nil, &model.Repositories{})
+		require.NoError(t, err)
+
+		state, err = Run(flow, state, map[string]string{"username": "mallory"}, &model.Repositories{})
+		require.NoError(t, err)
+		assert.Equal(t, "rejected", state.Current)
+		assert.Equal(t, map[string]string{"username": "bob"}, state.Context)
+	})
+}
+
+func TestRun_NestedSubflow(t *testing.T) {
+	parent, flows := newSubflowTestFlows()
+
+	// The child flow is wrapped by another flow that passes the values through
+	flows["wrapper"] = &model.FlowDefinition{
+		Start: "init",
+		Nodes: map[string]*model.GraphNode{
+			"init":          {Name: "init", Use: "init", Next: map[string]string{"start": "inner"}},
+			"inner":         {Name: "inner", Use: "subflow", Next: map[string]string{"success": "successResult", "failure": "failureResult"}, CustomConfig: map[string]string{"flow": "verify", "inputs": "expected", "outputs": "method"}},
+			"successResult": {Name: "successResult", Use: "successResult"},
+			"failureResult": {Name: "failureResult", Use: "failureResult"},
+		},
+	}
+	parent.Nodes["mfa"].CustomConfig["flow"] = "wrapper"
+
+	flow, err := ExpandSubflows("login", parent, loaderFor(flows))
+	require.NoError(t, err)
+
+	state, err := Run(flow, InitFlow(flow), nil, &model.Repositories{})
+	require.NoError(t, err)
+	assert.Equal(t, "mfa.inner.askUsername", state.Current)
+	assert.Len(t, state.Subflows, 2)
+
+	state, err = Run(flow, state, map[string]string{"username": "bob"}, &model.Repositories{})
+	require.NoError(t, err)
+	assert.Equal(t, "verified", state.Current)
+	assert.Equal(t, "username", state.Context["verified_by"])
+}
+
+func TestRun_SubflowErrors(t *testing.T) {
+	registerUnreliableNode(t)
+
+	parent, flows := newSubflowTestFlows()
+	parent.Nodes["handler"] = &model.GraphNode{Name: "handler", Use: "failureResult"}
+	flows["verify"].Nodes["askUsername"].Next["submitted"] = "call"
+	flows["verify"].Nodes["call"] = &model.GraphNode{Name: "call", Use: "unreliable", Next: map[string]string{"done": "successResult"}, CustomConfig: map[string]string{"mode": "error"}}
+
+	t.Run("on_error of the child flow", func(t *testing.T) {
+		flows["verify"].OnError = "failureResult"
+		defer func() { flows["verify"].OnError = "" }()
+
+		flow, err := ExpandSubflows("login", parent, loaderFor(flows))
+		require.NoError(t, err)
+		assert.Equal(t, "mfa.failureResult", flow.Nodes["mfa.call"].Next[NextError])
+		assert.NotContains(t, flow.Nodes["mfa.failureResult"].Next, NextError)
+
+		state, err := Run(flow, InitFlow(flow), nil, &model.Repositories{})
+		require.NoError(t, err)
+		state, err = Run(flow, state, map[string]string{"username": "bob"}, &model.Repositories{})
+		require.NoError(t, err)
+
+		// The child flow fails, so the parent continues with the failure transition of the subflow node
+		assert.Equal(t, "rejected", state.Current)
+		assert.Equal(t, "mfa.call", state.LastError.Node)
+	})
+
+	t.Run("on_error of the parent flow", func(t *testing.T) {
+		parent.OnError = "handler"
+		defer func() { parent.OnError = "" }()
+
+		flow, err := ExpandSubflows("login", parent, loaderFor(flows))
+		require.NoError(t, err)
+
+		state, err := Run(flow, InitFlow(flow), nil, &model.Repositories{})
+		require.NoError(t, err)
+		state, err = Run(flow, state, map[string]string{"username": "bob"}, &model.Repositories{})
+		require.NoError(t, err)
+
+		// The running subflow is left and the context of the parent is restored
+		assert.Equal(t, "handler", state.Current)
+		assert.Empty(t, state.Subflows)
+		assert.Equal(t, map[string]string{"username": "bob"}, state.Context)
+	})
+}
+
+func TestSubflows_RecursiveInclude(t *testing.T) {
+	parent, flows := newSubflowTestFlows()
+
+	// verify includes login which includes verify
+	flows["verify"].Nodes["loop"] = &model.GraphNode{Name: "loop", Use: "subflow", Next: map[string]string{}, CustomConfig: map[string]string{"flow": "login"}}
+	flows["login"] = parent
+
+	_, err := ExpandSubflows("login", parent, loaderFor(flows))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "login -> verify -> login")
+
+	err = CheckSubflowIncludes("login", parent, loaderFor(flows))
+	var issue FlowIssue
+	require.ErrorAs(t, err, &issue)
+	assert.Equal(t, "mfa", issue.Node)
+	assert.Equal(t, "flow", issue.Key)
+
+	// A flow that includes itself directly
+	parent.Nodes["mfa"].CustomConfig["flow"] = "login"
+	assert.Error(t, CheckSubflowIncludes("login", parent, loaderFor(flows)))
+}
+
+func TestSubflows_UnknownFlow(t *testing.T) {
+	parent, _ := newSubflowTestFlows()
+	flows := map[string]*model.FlowDefinition{}
+
+	// The flow may be created later, so saving is allowed but it cannot be executed
+	assert.NoError(t, CheckSubflowIncludes("login", parent, loaderFor(flows)))
+
+	_, err := ExpandSubflows("login", parent, loaderFor(flows))
+	assert.ErrorContains(t, err, "unknown flow 'verify'")
+
+	// Without expansion the node cannot run
+	state, err := Run(parent, InitFlow(parent), nil, &model.Repositories{})
+	assert.ErrorContains(t, err, "was not expanded")
+	assert.Empty(t, state.Subflows)
+}
+
+func TestLint_Subflow(t *testing.T) {
+	parent, _ := newSubflowTestFlows()
+
+	// The outputs of the subflow are available to the nodes after it
+	parent.Nodes["verified"] = &model.GraphNode{Name: "verified", Use: "setVariable", Next: map[string]string{"done": "rejected"}, CustomConfig: map[string]string{"key": "method", "expression": "context.verified_by"}}
+	assert.NoError(t, ValidateFlowDefinitionStrict(parent))
+	assert.Nil(t, findIssue(LintFlowDefinition(parent), "mfa", "never returns it"))
+
+	parent.Nodes["mfa"].CustomConfig["flow"] = ""
+	issue := findIssue(LintFlowDefinition(parent), "mfa", "invalid configuration")
+	require.NotNil(t, issue)
+	assert.Contains(t, issue.Message, "flow is not set")
+
+	parent.Nodes["mfa"].CustomConfig["flow"] = "verify"
+	parent.Nodes["mfa"].CustomConfig["outputs"] = "a: b\na: c"
+	assert.NotNil(t, findIssue(LintFlowDefinition(parent), "mfa", "invalid configuration"))
+}
@@ -2,50 +2,147 @@ package visual
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/Identityplane/GoAM/internal/auth/graph"
 	"github.com/Identityplane/GoAM/pkg/model"
 )
 
+// Graph is the node and edge model of a flow, which is rendered as DOT or Mermaid or returned as JSON to editors
+type Graph struct {
+	Description string   `json:"description"`
+	Start       string   `json:"start"`
+	OnError     string   `json:"on_error,omitempty"`
+	Nodes       []Node   `json:"nodes"`
+	Edges       []Edge   `json:"edges"`
+	Traffic     *Traffic `json:"traffic,omitempty"` // set if the graph has a traffic overlay
+}
+
+// Node is a node of the flow
+type Node struct {
+	ID    string         `json:"id"` // key of the node in the flow
+	Name  string         `json:"name"`
+	Use   string         `json:"use"`
+	Type  model.NodeType `json:"type,omitempty"` // empty if the node definition was not found
+	Stats *NodeStats     `json:"stats,omitempty"`
+}
+
+// Edge is a transition from a node to the next node for a condition
+type Edge struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Condition string `json:"condition"`
+	Count     *int   `json:"count,omitempty"` // number of transitions if the graph has a traffic overlay
+}
+
+// BuildGraph returns the nodes and edges of the flow in a stable order. If traffic is not nil, the nodes and edges
+// are annotated with it.
+func BuildGraph(flow *model.FlowDefinition, traffic *Traffic) *Graph {
+	g := &Graph{
+		Description: flow.Description,
+		Start:       flow.Start,
+		OnError:     flow.OnError,
+		Nodes:       []Node{},
+		Edges:       []Edge{},
+		Traffic:     traffic,
+	}
+
+	for _, id := range sortedIds(flow) {
+		node := flow.Nodes[id]
+
+		n := Node{ID: id, Name: node.Name, Use: node.Use}
+		if def := graph.GetNodeDefinitionByName(node.Use); def != nil {
+			n.Type = def.Type
+		}
+		if traffic != nil {
+			n.Stats = traffic.Nodes[id]
+			if n.Stats == nil {
+				n.Stats = &NodeStats{}
+			}
+		}
+		g.Nodes = append(g.Nodes, n)
+
+		conditions := make([]string, 0, len(node.Next))
+		for condition := range node.Next {
+			conditions = append(conditions, condition)
+		}
+		slices.Sort(conditions)
+
+		for _, condition := range conditions {
+			edge := Edge{From: id, To: node.Next[condition], Condition: condition}
+			if traffic != nil {
+				count := traffic.Transitions[id][condition]
+				edge.Count = &count
+			}
+			g.Edges = append(g.Edges, edge)
+		}
+	}
+
+	return g
+}
+
 // RenderDOTGraph generates a Graphviz DOT representation of a flow.
 func RenderDOTGraph(flow *model.FlowDefinition) (string, error) {
+	return RenderDOT(BuildGraph(flow, nil)), nil
+}
+
+// RenderDOT generates a Graphviz DOT representation of the graph, with the traffic in the labels if it has any
+func RenderDOT(g *Graph) string {
 	var b strings.Builder
 	b.WriteString("digraph Flow {\n")
 	b.WriteString(`  rankdir=LR;` + "\n")
-	b.WriteString(fmt.Sprintf(`  label="%s"; labelloc=top; fontsize=20;`+"\n", flow.Description))
+	b.WriteString(fmt.Sprintf(`  label="%s"; labelloc=top; fontsize=20;`+"\n", dotEscape(g.Description)))
 
-	for name, node := range flow.Nodes {
-		def := graph.GetNodeDefinitionByName(node.Use)
+	for _, node := range g.Nodes {
 		style := `shape=box`
-		label := ""
+		label := fmt.Sprintf("%s\\n[%s]", dotEscape(node.Name), dotEscape(node.Use))
 
-		if def == nil {
+		switch node.Type {
+		case "":
 			style = `shape=ellipse, style=filled, fillcolor=lightred`
-			label = fmt.Sprintf("%s\n[%s] (not found)", node.Name, node.Use)
-		} else {
-
-			switch def.Type {
-			case model.NodeTypeInit:
-				style = `shape=diamond, style=filled, fillcolor=lightgreen`
-			case model.NodeTypeLogic:
-				style = `shape=ellipse, style=filled, fillcolor=lightyellow`
-			case model.NodeTypeQuery:
-				style = `shape=rect, style=filled, fillcolor=lightblue`
-			case model.NodeTypeResult:
-				style = `shape=doublecircle, style=filled, fillcolor=lightgray`
-			}
+			label += " (not found)"
+		case model.NodeTypeInit:
+			style = `shape=diamond, style=filled, fillcolor=lightgreen`
+		case model.NodeTypeLogic:
+			style = `shape=ellipse, style=filled, fillcolor=lightyellow`
+		case model.NodeTypeQuery:
+			style = `shape=rect, style=filled, fillcolor=lightblue`
+		case model.NodeTypeResult:
+			style = `shape=doublecircle, style=filled, fillcolor=lightgray`
+		}
 
-			label = fmt.Sprintf("%s\n[%s]", node.Name, node.Use)
+		if node.Stats != nil {
+			label += "\\n" + statsLabel(node.Stats)
 		}
 
-		b.WriteString(fmt.Sprintf(`  "%s" [label="%s", %s];`+"\n", name, label, style))
+		b.WriteString(fmt.Sprintf(`  "%s" [label="%s", %s];`+"\n", dotEscape(node.ID), label, style))
+	}
 
-		for cond, next := range node.Next {
-			b.WriteString(fmt.Sprintf(`  "%s" -> "%s" [label="%s"];`+"\n", name, next, cond))
-		}
+	for _, edge := range g.Edges {
+		b.WriteString(fmt.Sprintf(`  "%s" -> "%s" [label="%s"];`+"\n", dotEscape(edge.From), dotEscape(edge.To), dotEscape(edgeLabel(edge))))
 	}
 
 	b.WriteString("}\n")
-	return b.String(), nil
+	return b.String()
+}
+
+// statsLabel describes the traffic of a node, e.g. "12 runs, 8% errors, 3 waiting"
+func statsLabel(stats *NodeStats) string {
+	label := fmt.Sprintf("%d runs, %.0f%% errors", stats.Executions, stats.ErrorRate*100)
+	if stats.Waiting > 0 {
+		label += fmt.Sprintf(", %d waiting", stats.Waiting)
+	}
+	return label
+}
+
+func edgeLabel(edge Edge) string {
+	if edge.Count == nil {
+		return edge.Condition
+	}
+	return fmt.Sprintf("%s (%d)", edge.Condition, *edge.Count)
+}
+
+func dotEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, `\"`)
 }
@@ -0,0 +1,118 @@
+package visual
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newVisualTestFlow() *model.FlowDefinition {
+	return &model.FlowDefinition{
+		Description: "Login",
+		Start:       "init",
+		Nodes: map[string]*model.GraphNode{
+			"init":                {Name: "init", Use: "init", Next: map[string]string{"start": "askUsernamePassword"}},
+			"askUsernamePassword": {Name: "askUsernamePassword", Use: "askUsernamePassword", Next: map[string]string{"submitted": "validatePassword"}},
+			"validatePassword":    {Name: "validatePassword", Use: "validatePassword", Next: map[string]string{"success": "done", "fail": "askUsernamePassword", "error": "failed"}},
+			"done":                {Name: "successResult", Use: "successResult"},
+			"failed":              {Name: "failureResult", Use: "failureResult"},
+		},
+	}
+}
+
+func TestBuildGraph(t *testing.T) {
+	g := BuildGraph(newVisualTestFlow(), nil)
+
+	require.Len(t, g.Nodes, 5)
+	assert.Equal(t, "askUsernamePassword", g.Nodes[0].ID)
+	assert.Equal(t, model.NodeTypeQuery, g.Nodes[0].Type)
+	assert.Equal(t, Node{ID: "done", Name: "successResult", Use: "successResult", Type: model.NodeTypeResult}, g.Nodes[1])
+
+	assert.Equal(t, []Edge{
+		{From: "askUsernamePassword", To: "validatePassword", Condition: "submitted"},
+		{From: "init", To: "askUsernamePassword", Condition: "start"},
+		{From: "validatePassword", To: "failed", Condition: "error"},
+		{From: "validatePassword", To: "askUsernamePassword", Condition: "fail"},
+		{From: "validatePassword", To: "done", Condition: "success"},
+	}, g.Edges)
+
+	// Without traffic the JSON has no stats
+	data, err := json.Marshal(g)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "stats")
+	assert.NotContains(t, string(data), "count")
+}
+
+func TestAggregateTraffic(t *testing.T) {
+	flow := newVisualTestFlow()
+	since := time.Now().Add(-time.Hour)
+
+	sessions := []*model.AuthenticationSession{
+		// Wrong password, then success
+		{Current: "done", Result: &model.FlowResult{Authenticated: true}, History: []string{
+			"init:start", `askUsernamePassword:prompted:{"username":"text"}`, "askUsernamePassword:submitted", "validatePassword:fail",
+			`askUsernamePassword:prompted:{"username":"text"}`, "askUsernamePassword:submitted", "validatePassword:success", "successResult",
+		}},
+		// The password check failed
+		{Current: "failed", Result: &model.FlowResult{}, History: []string{
+			"init:start", "askUsernamePassword:submitted", "validatePassword:error:timeout", "failureResult",
+		}},
+		// Dropped off at the prompt, navigation and nodes of older versions are skipped
+		{Current: "askUsernamePassword", History: []string{
+			"init:start", `askUsernamePassword:prompted:{"username":"text"}`, "askUsernamePassword:back:askUsernamePassword", "removedNode:done",
+		}},
+	}
+
+	traffic := AggregateTraffic(flow, sessions, since)
+	assert.Equal(t, 3, traffic.Sessions)
+	assert.Equal(t, since, traffic.Since)
+
+	assert.Equal(t, &NodeStats{Executions: 3, Waiting: 1}, traffic.Nodes["askUsernamePassword"])
+	assert.Equal(t, &NodeStats{Executions: 3, Errors: 1, ErrorRate: 1.0 / 3}, traffic.Nodes["validatePassword"])
+	assert.Equal(t, &NodeStats{Executions: 1}, traffic.Nodes["done"])
+	assert.Equal(t, map[string]int{"fail": 1, "success": 1, "error": 1}, traffic.Transitions["validatePassword"])
+	assert.NotContains(t, traffic.Nodes, "removedNode")
+
+	g := BuildGraph(flow, traffic)
+	for _, edge := range g.Edges {
+		require.NotNil(t, edge.Count)
+		if edge.From == "init" {
+			assert.Equal(t, 3, *edge.Count)
+		}
+	}
+	for _, node := range g.Nodes {
+		require.NotNil(t, node.Stats, node.ID)
+	}
+
+	dot := RenderDOT(g)
+	assert.Contains(t, dot, `"validatePassword" [label="validatePassword\n[validatePassword]\n3 runs, 33% errors"`)
+	assert.Contains(t, dot, `"askUsernamePassword" -> "validatePassword" [label="submitted (3)"];`)
+	assert.Contains(t, dot, `3 runs, 0% errors, 1 waiting`)
+}
+
+func TestRenderMermaid(t *testing.T) {
+	flow := newVisualTestFlow()
+	flow.Nodes["init"].Next["unknown"] = "missing"
+	flow.Nodes["custom"] = &model.GraphNode{Name: `say "hi"`, Use: "notRegistered"}
+
+	mermaid := RenderMermaid(BuildGraph(flow, nil))
+
+	assert.Contains(t, mermaid, "flowchart LR\n")
+	assert.Contains(t, mermaid, `  n0["askUsernamePassword<br/>[askUsernamePassword]"]`)
+	assert.Contains(t, mermaid, `  n1[/"say #quot;hi#quot;<br/>[notRegistered] (not found)"/]`)
+	assert.Contains(t, mermaid, `  n2(("successResult<br/>[successResult]"))`)
+	assert.Contains(t, mermaid, `  n4{"init<br/>[init]"}`)
+	assert.Contains(t, mermaid, `  n5(["validatePassword<br/>[validatePassword]"])`)
+	assert.Contains(t, mermaid, `  n0 -->|"submitted"| n5`)
+	assert.Contains(t, mermaid, `  n6[/"missing (not found)"/]`)
+	assert.Contains(t, mermaid, `  n4 -->|"unknown"| n6`)
+
+	traffic := AggregateTraffic(flow, []*model.AuthenticationSession{{Current: "askUsernamePassword", History: []string{"init:start"}}}, time.Now())
+	mermaid = RenderMermaid(BuildGraph(flow, traffic))
+	assert.Contains(t, mermaid, `  n4 -->|"start (1)"| n0`)
+	assert.Contains(t, mermaid, `<br/>0 runs, 0% errors, 1 waiting"]`)
+}
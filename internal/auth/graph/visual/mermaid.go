@@ -0,0 +1,64 @@
+package visual
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// RenderMermaid generates a Mermaid flowchart of the graph, with the traffic in the labels if it has any. Node
+// ids of flows can contain characters that Mermaid does not accept, so the nodes are numbered in the chart.
+func RenderMermaid(g *Graph) string {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+
+	ids := make(map[string]string, len(g.Nodes))
+	for i, node := range g.Nodes {
+		ids[node.ID] = fmt.Sprintf("n%d", i)
+	}
+
+	for _, node := range g.Nodes {
+		label := fmt.Sprintf("%s<br/>[%s]", mermaidEscape(node.Name), mermaidEscape(node.Use))
+		if node.Type == "" {
+			label += " (not found)"
+		}
+		if node.Stats != nil {
+			label += "<br/>" + statsLabel(node.Stats)
+		}
+
+		// Shapes follow the DOT rendering: init is a diamond, logic a stadium, query a box and result a circle
+		open, end := `["`, `"]`
+		switch node.Type {
+		case "":
+			open, end = `[/"`, `"/]`
+		case model.NodeTypeInit:
+			open, end = `{"`, `"}`
+		case model.NodeTypeLogic, model.NodeTypeQueryWithLogic:
+			open, end = `(["`, `"])`
+		case model.NodeTypeResult:
+			open, end = `(("`, `"))`
+		}
+
+		b.WriteString(fmt.Sprintf("  %s%s%s%s\n", ids[node.ID], open, label, end))
+	}
+
+	for _, edge := range g.Edges {
+		to, ok := ids[edge.To]
+		if !ok {
+			// The target is not a node of the flow, it is shown like a node that was not found
+			to = fmt.Sprintf("n%d", len(ids))
+			ids[edge.To] = to
+			b.WriteString(fmt.Sprintf("  %s[/\"%s (not found)\"/]\n", to, mermaidEscape(edge.To)))
+		}
+
+		b.WriteString(fmt.Sprintf("  %s -->|\"%s\"| %s\n", ids[edge.From], mermaidEscape(edgeLabel(edge)), to))
+	}
+
+	return b.String()
+}
+
+// mermaidEscape replaces the characters that end a quoted label with their entity codes
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
@@ -0,0 +1,117 @@
+package visual
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/auth/graph"
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// Traffic is how often the nodes and transitions of a flow were executed, aggregated from the history of sessions
+type Traffic struct {
+	Since       time.Time                 `json:"since"`
+	Sessions    int                       `json:"sessions"`
+	Nodes       map[string]*NodeStats     `json:"-"` // by node id
+	Transitions map[string]map[string]int `json:"-"` // by node id and condition
+}
+
+// NodeStats are the executions of a node
+type NodeStats struct {
+	Executions int     `json:"executions"`
+	Errors     int     `json:"errors"`
+	ErrorRate  float64 `json:"error_rate"`
+	Waiting    int     `json:"waiting"` // sessions without result that stopped at the node, e.g. because the user dropped off
+}
+
+// AggregateTraffic counts the executions of the nodes of the flow from the history of the sessions. The history
+// refers to nodes by their name, which is mapped back to the id of the node in the flow. Entries of nodes that
+// are not part of the flow, e.g. of sessions of an older version, are skipped.
+func AggregateTraffic(flow *model.FlowDefinition, sessions []*model.AuthenticationSession, since time.Time) *Traffic {
+	traffic := &Traffic{
+		Since:       since,
+		Nodes:       map[string]*NodeStats{},
+		Transitions: map[string]map[string]int{},
+	}
+
+	ids := nodeIdsByName(flow)
+	stats := func(id string) *NodeStats {
+		if traffic.Nodes[id] == nil {
+			traffic.Nodes[id] = &NodeStats{}
+		}
+		return traffic.Nodes[id]
+	}
+	transition := func(id, condition string) {
+		if traffic.Transitions[id] == nil {
+			traffic.Transitions[id] = map[string]int{}
+		}
+		traffic.Transitions[id][condition]++
+	}
+
+	for _, session := range sessions {
+		traffic.Sessions++
+
+		for _, entry := range session.History {
+			parts := strings.SplitN(entry, ":", 3)
+			id, ok := ids[parts[0]]
+			if !ok {
+				continue
+			}
+
+			switch {
+			case len(parts) == 1:
+				// A result node, which has no transition
+				stats(id).Executions++
+			case parts[1] == "prompted":
+				// The node is counted when it continues
+			case len(parts) == 3 && parts[1] == graph.NextError:
+				stats(id).Executions++
+				stats(id).Errors++
+				transition(id, graph.NextError)
+			case len(parts) == 3:
+				// The user navigated back or restarted a step, see graph.Back
+			default:
+				stats(id).Executions++
+				transition(id, parts[1])
+			}
+		}
+
+		if session.Result == nil && flow.Nodes[session.Current] != nil {
+			stats(session.Current).Waiting++
+		}
+	}
+
+	for _, nodeStats := range traffic.Nodes {
+		if nodeStats.Executions > 0 {
+			nodeStats.ErrorRate = float64(nodeStats.Errors) / float64(nodeStats.Executions)
+		}
+	}
+
+	return traffic
+}
+
+// nodeIdsByName maps the names of the nodes to their ids. If several nodes have the same name, the node whose id
+// is the name is preferred, otherwise the first id in order.
+func nodeIdsByName(flow *model.FlowDefinition) map[string]string {
+	ids := make(map[string]string, len(flow.Nodes))
+	for _, id := range sortedIds(flow) {
+		node := flow.Nodes[id]
+		if _, exists := ids[node.Name]; !exists || id == node.Name {
+			ids[node.Name] = id
+		}
+	}
+	return ids
+}
+
+// sortedIds returns the ids of the nodes of the flow in order, so that the output does not change between requests
+func sortedIds(flow *model.FlowDefinition) []string {
+	ids := make([]string, 0, len(flow.Nodes))
+	for id, node := range flow.Nodes {
+		if node != nil {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Identityplane/GoAM/internal/logger"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/rs/zerolog"
+)
+
+type AuditLoggerImpl struct {
+	log zerolog.Logger
+}
+
+// NewAuditLogger creates an audit logger that writes the events of a realm to the log with the field audit=true,
+// so that they can be separated from the other log messages
+func NewAuditLogger(tenant, realm string) model.AuditLogger {
+	return &AuditLoggerImpl{
+		log: logger.GetGoamLogger().With().Bool("audit", true).Str("tenant", tenant).Str("realm", realm).Logger(),
+	}
+}
+
+func (a *AuditLoggerImpl) LogEvent(ctx context.Context, event *model.AuditEvent) {
+
+	entry := a.log.Info().Str("event", event.Type)
+	if event.UserID != "" {
+		entry = entry.Str("user_id", event.UserID)
+	}
+	if len(event.Details) > 0 {
+		entry = entry.Interface("details", event.Details)
+	}
+
+	entry.Msg("audit event")
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	services "github.com/Identityplane/GoAM/pkg/services"
+)
+
+type CacheImpl struct {
+	prefix       string
+	cacheService services.CacheService
+}
+
+// NewCache creates a cache for the nodes of a realm, the keys are prefixed so that realms cannot read each others values
+func NewCache(tenant, realm string, cacheService services.CacheService) model.Cache {
+	return &CacheImpl{
+		prefix:       fmt.Sprintf("node/%s/%s/", tenant, realm),
+		cacheService: cacheService,
+	}
+}
+
+func (c *CacheImpl) Get(key string) (any, bool) {
+	return c.cacheService.Get(c.prefix + key)
+}
+
+func (c *CacheImpl) Set(key string, value any, ttl time.Duration) error {
+	return c.cacheService.Cache(c.prefix+key, value, ttl, 1)
+}
+
+func (c *CacheImpl) Delete(key string) error {
+	return c.cacheService.Invalidate(c.prefix + key)
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"sync"
+	"time"
+)
+
+// MockCache keeps the values of the nodes in memory
+type MockCache struct {
+	mu      sync.Mutex
+	values  map[string]any
+	expires map[string]time.Time
+}
+
+func (m *MockCache) Get(key string) (any, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.values[key]
+	if !ok || time.Now().After(m.expires[key]) {
+		return nil, false
+	}
+	return value, true
+}
+
+func (m *MockCache) Set(key string, value any, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.values == nil {
+		m.values = map[string]any{}
+		m.expires = map[string]time.Time{}
+	}
+
+	m.values[key] = value
+	m.expires[key] = time.Now().Add(ttl)
+	return nil
+}
+
+func (m *MockCache) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.values, key)
+	delete(m.expires, key)
+	return nil
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"github.com/Identityplane/GoAM/pkg/model"
+	services "github.com/Identityplane/GoAM/pkg/services"
+)
+
+type FlowAnalyticsImpl struct {
+	tenant           string
+	realm            string
+	analyticsService services.FlowAnalyticsService
+}
+
+// NewFlowAnalytics creates the analytics of a realm that the flow engine reports the progress of runs to
+func NewFlowAnalytics(tenant, realm string, analyticsService services.FlowAnalyticsService) model.FlowAnalytics {
+	return &FlowAnalyticsImpl{
+		tenant:           tenant,
+		realm:            realm,
+		analyticsService: analyticsService,
+	}
+}
+
+func (a *FlowAnalyticsImpl) RecordFlowEvent(state *model.AuthenticationSession, event *model.FlowEvent) {
+	a.analyticsService.RecordFlowEvent(a.tenant, a.realm, state, event)
+}
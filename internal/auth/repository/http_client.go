@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// DefaultHTTPClientTimeout applies to requests whose context has no earlier deadline
+const DefaultHTTPClientTimeout = 10 * time.Second
+
+// ErrNonPublicAddress is returned for connections to addresses that are not reachable from the internet
+var ErrNonPublicAddress = errors.New("connections to non-public addresses are not allowed")
+
+var (
+	sharedHTTPClient = newHTTPClient(nil)
+	publicHTTPClient = newHTTPClient(denyNonPublicAddresses)
+)
+
+// NewHTTPClient returns the http client for the nodes, it is shared by all realms to reuse connections. Unless private
+// networks are allowed the client refuses to connect to loopback, private, link-local and other non-public addresses,
+// so that flows cannot reach internal services or the metadata endpoints of cloud providers. The address is checked
+// after the host name was resolved, so it also applies to redirects and to host names that resolve to such addresses.
+func NewHTTPClient(allowPrivateNetworks bool) model.HTTPClient {
+	if allowPrivateNetworks {
+		return sharedHTTPClient
+	}
+	return publicHTTPClient
+}
+
+func newHTTPClient(control func(ctx context.Context, network, address string, c syscall.RawConn) error) *http.Client {
+
+	dialer := &net.Dialer{
+		Timeout:        DefaultHTTPClientTimeout,
+		KeepAlive:      30 * time.Second,
+		ControlContext: control,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // a proxy would connect on behalf of the client and bypass the address check
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:       DefaultHTTPClientTimeout,
+		Transport:     transport,
+		CheckRedirect: sameHostRedirects,
+	}
+}
+
+// sameHostRedirects only follows redirects to the host of the original request, nodes check the host they call
+// before they send the request and a redirect must not lead somewhere else
+func sameHostRedirects(req *http.Request, via []*http.Request) error {
+
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Host != via[0].URL.Host {
+		return http.ErrUseLastResponse
+	}
+
+	return nil
+}
+
+func denyNonPublicAddresses(ctx context.Context, network, address string, c syscall.RawConn) error {
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !IsPublicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrNonPublicAddress, host)
+	}
+
+	return nil
+}
+
+// IsPublicIP checks if the ip is a global unicast address outside of the private, shared and link-local ranges
+func IsPublicIP(ip net.IP) bool {
+
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// nonPublicNetworks are ranges that IsGlobalUnicast and IsPrivate do not cover
+var nonPublicNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // this network
+		"100.64.0.0/10", // carrier-grade NAT
+		"192.0.0.0/24",  // IETF protocol assignments
+		"198.18.0.0/15", // benchmarking
+		"240.0.0.0/4",   // reserved
+		"64:ff9b::/96",  // NAT64, can embed private IPv4 addresses
+		"2001:db8::/32", // documentation
+	} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
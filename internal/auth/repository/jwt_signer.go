@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"github.com/Identityplane/GoAM/pkg/model"
+	services "github.com/Identityplane/GoAM/pkg/services"
+)
+
+type JWTSignerImpl struct {
+	tenant     string
+	realm      string
+	jwtService services.JWTService
+}
+
+func NewJWTSigner(tenant, realm string, jwtService services.JWTService) model.JWTSigner {
+	return &JWTSignerImpl{
+		tenant:     tenant,
+		realm:      realm,
+		jwtService: jwtService,
+	}
+}
+
+func (j *JWTSignerImpl) SignJWT(claims map[string]any) (string, error) {
+	return j.jwtService.SignJWT(j.tenant, j.realm, claims)
+}
+
+func (j *JWTSignerImpl) PublicKeys() (string, error) {
+	return j.jwtService.LoadPublicKeys(j.tenant, j.realm)
+}
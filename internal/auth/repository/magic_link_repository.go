@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	services "github.com/Identityplane/GoAM/pkg/services"
+)
+
+type MagicLinkRepositoryImpl struct {
+	tenant          string
+	realm           string
+	sessionsService services.SessionsService
+}
+
+// NewMagicLinkRepository creates the repository of magic link approvals of a realm
+func NewMagicLinkRepository(tenant, realm string, sessionsService services.SessionsService) model.MagicLinkRepository {
+	return &MagicLinkRepositoryImpl{
+		tenant:          tenant,
+		realm:           realm,
+		sessionsService: sessionsService,
+	}
+}
+
+func (r *MagicLinkRepositoryImpl) ApproveMagicLink(ctx context.Context, sessionIdHash, linkID string, expiresAt time.Time) (bool, error) {
+	return r.sessionsService.ApproveMagicLink(ctx, r.tenant, r.realm, sessionIdHash, linkID, expiresAt)
+}
+
+func (r *MagicLinkRepositoryImpl) ConsumeMagicLinkApproval(ctx context.Context, sessionIdHash, linkID string) (bool, error) {
+	return r.sessionsService.ConsumeMagicLinkApproval(ctx, r.tenant, r.realm, sessionIdHash, linkID)
+}
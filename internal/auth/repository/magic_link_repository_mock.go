@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MockMagicLinkRepository keeps the approvals of magic links in memory
+type MockMagicLinkRepository struct {
+	mu        sync.Mutex
+	approvals map[string]time.Time
+}
+
+func (m *MockMagicLinkRepository) ApproveMagicLink(ctx context.Context, sessionIdHash, linkID string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.approvals == nil {
+		m.approvals = map[string]time.Time{}
+	}
+
+	key := sessionIdHash + ":" + linkID
+	if _, ok := m.approvals[key]; ok {
+		return false, nil
+	}
+	m.approvals[key] = expiresAt
+	return true, nil
+}
+
+func (m *MockMagicLinkRepository) ConsumeMagicLinkApproval(ctx context.Context, sessionIdHash, linkID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := sessionIdHash + ":" + linkID
+	expiresAt, ok := m.approvals[key]
+	if !ok {
+		return false, nil
+	}
+	delete(m.approvals, key)
+	return time.Now().Before(expiresAt), nil
+}
@@ -5,8 +5,12 @@ import "github.com/Identityplane/GoAM/pkg/model"
 // NewMockRepositories creates a new Repositories struct with mock implementations
 func NewMockRepositories() *model.Repositories {
 	return &model.Repositories{
-		UserRepo:    new(MockUserRepository),
-		EmailSender: new(MockEmailSender),
+		UserRepo:          new(MockUserRepository),
+		EmailSender:       new(MockEmailSender),
+		SMSSender:         new(MockSMSSender),
+		PasswordResetRepo: new(MockPasswordResetRepository),
+		MagicLinks:        new(MockMagicLinkRepository),
+		Cache:             new(MockCache),
 	}
 }
 
@@ -18,7 +22,11 @@ func NewTestRepositories(tenant, realm string) (*model.Repositories, error) {
 	}
 
 	return &model.Repositories{
-		UserRepo:    userRepo,
-		EmailSender: new(MockEmailSender),
+		UserRepo:          userRepo,
+		EmailSender:       new(MockEmailSender),
+		SMSSender:         new(MockSMSSender),
+		PasswordResetRepo: new(MockPasswordResetRepository),
+		MagicLinks:        new(MockMagicLinkRepository),
+		Cache:             new(MockCache),
 	}, nil
 }
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	services "github.com/Identityplane/GoAM/pkg/services"
+)
+
+type PasswordResetRepositoryImpl struct {
+	tenant               string
+	realm                string
+	passwordResetService services.PasswordResetService
+	sessionsService      services.SessionsService
+}
+
+func NewPasswordResetRepository(tenant, realm string, passwordResetService services.PasswordResetService, sessionsService services.SessionsService) model.PasswordResetRepository {
+	return &PasswordResetRepositoryImpl{
+		tenant:               tenant,
+		realm:                realm,
+		passwordResetService: passwordResetService,
+		sessionsService:      sessionsService,
+	}
+}
+
+func (r *PasswordResetRepositoryImpl) CreateResetToken(ctx context.Context, request *model.PasswordResetRequest) (string, error) {
+	return r.passwordResetService.CreateResetToken(ctx, r.tenant, r.realm, request)
+}
+
+func (r *PasswordResetRepositoryImpl) CountResetRequests(ctx context.Context, identifier, requestIP string, since time.Time) (int, int, error) {
+	return r.passwordResetService.CountResetRequests(ctx, r.tenant, r.realm, identifier, requestIP, since)
+}
+
+func (r *PasswordResetRepositoryImpl) ConsumeResetToken(ctx context.Context, token string) (*model.PasswordResetToken, error) {
+	return r.passwordResetService.ConsumeResetToken(ctx, r.tenant, r.realm, token)
+}
+
+func (r *PasswordResetRepositoryImpl) RevokeClientSessions(ctx context.Context, userID string) (int, error) {
+	return r.sessionsService.RevokeUserClientSessions(ctx, r.tenant, r.realm, userID)
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockPasswordResetRepository implements PasswordResetRepository for testing
+type MockPasswordResetRepository struct {
+	mock.Mock
+}
+
+func (m *MockPasswordResetRepository) CreateResetToken(ctx context.Context, request *model.PasswordResetRequest) (string, error) {
+	args := m.Called(ctx, request)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockPasswordResetRepository) CountResetRequests(ctx context.Context, identifier, requestIP string, since time.Time) (int, int, error) {
+	args := m.Called(ctx, identifier, requestIP, since)
+	return args.Int(0), args.Int(1), args.Error(2)
+}
+
+func (m *MockPasswordResetRepository) ConsumeResetToken(ctx context.Context, token string) (*model.PasswordResetToken, error) {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.PasswordResetToken), args.Error(1)
+}
+
+func (m *MockPasswordResetRepository) RevokeClientSessions(ctx context.Context, userID string) (int, error) {
+	args := m.Called(ctx, userID)
+	return args.Int(0), args.Error(1)
+}
+
+// NewMockPasswordResetRepository creates a new mock password reset repository
+func NewMockPasswordResetRepository() *MockPasswordResetRepository {
+	return new(MockPasswordResetRepository)
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+type SecretStoreImpl struct {
+	secrets map[string]string
+}
+
+// NewSecretStore creates the secret store of a realm from the extension settings of the server. A realm only sees the
+// settings whose key is <tenant>/<realm>/<name>, e.g. acme/customers/crm_api_key is the secret crm_api_key of the realm
+// acme/customers. Tenant and realm names are path segments and cannot contain a slash, so a key belongs to exactly one
+// realm. Keys are matched exactly.
+func NewSecretStore(tenant, realm string, settings map[string]string) model.SecretStore {
+
+	secrets := make(map[string]string)
+	for key, value := range settings {
+		parts := strings.SplitN(key, "/", 3)
+		if len(parts) == 3 && parts[0] == tenant && parts[1] == realm && parts[2] != "" {
+			secrets[parts[2]] = value
+		}
+	}
+
+	return &SecretStoreImpl{
+		secrets: secrets,
+	}
+}
+
+func (s *SecretStoreImpl) GetSecret(name string) (string, bool) {
+
+	secret, ok := s.secrets[name]
+	return secret, ok
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+type SettingsReaderImpl struct {
+	realmSettings  map[string]string
+	serverSettings map[string]string
+}
+
+// NewSettingsReader creates a reader for the realm settings that falls back to the node settings of the server,
+// the same order in which the custom config of nodes is resolved
+func NewSettingsReader(realmSettings, serverSettings map[string]string) model.SettingsReader {
+	return &SettingsReaderImpl{
+		realmSettings:  realmSettings,
+		serverSettings: serverSettings,
+	}
+}
+
+func (s *SettingsReaderImpl) GetSetting(name string) (string, bool) {
+
+	if value, ok := s.realmSettings[name]; ok && value != "" {
+		return value, true
+	}
+
+	if value, ok := s.serverSettings[name]; ok && value != "" {
+		return value, true
+	}
+
+	return "", false
+}
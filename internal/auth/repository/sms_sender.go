@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"github.com/Identityplane/GoAM/pkg/model"
+	services "github.com/Identityplane/GoAM/pkg/services"
+)
+
+type SMSSenderImpl struct {
+	tenant     string
+	realm      string
+	smsService services.SMSService
+}
+
+func NewSMSSender(tenant, realm string, smsService services.SMSService) model.SMSSender {
+	return &SMSSenderImpl{
+		tenant:     tenant,
+		realm:      realm,
+		smsService: smsService,
+	}
+}
+
+func (s *SMSSenderImpl) SendSMS(sms *model.SendSMSParams) error {
+
+	return s.smsService.SendSMS(s.tenant, s.realm, sms)
+}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockSMSSender implements SMSSender for testing
+type MockSMSSender struct {
+	mock.Mock
+}
+
+func (m *MockSMSSender) SendSMS(sms *model.SendSMSParams) error {
+	args := m.Called(sms)
+	return args.Error(0)
+}
+
+// NewMockSMSSender creates a new mock sms sender
+func NewMockSMSSender() *MockSMSSender {
+	return new(MockSMSSender)
+}
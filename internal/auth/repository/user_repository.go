@@ -141,6 +141,18 @@ func (r *UserRepositoryImpl) UpdateUserAttribute(ctx context.Context, attribute
 	return err
 }
 
+func (r *UserRepositoryImpl) UpdateUserAttributeIfUnchanged(ctx context.Context, attribute *model.UserAttribute, lastUpdatedAt time.Time) (bool, error) {
+
+	// Ensure the tenant and realm are set to the repository values
+	attribute.Tenant = r.tenant
+	attribute.Realm = r.realm
+
+	updated, err := r.attributesDB.UpdateUserAttributeIfUnchanged(ctx, attribute, lastUpdatedAt)
+	log.Debug().Str("attributeType", attribute.Type).Str("userID", attribute.UserID).Bool("updated", updated).Err(err).Msgf("UpdateUserAttributeIfUnchanged")
+
+	return updated, err
+}
+
 func (r *UserRepositoryImpl) DeleteUserAttribute(ctx context.Context, attributeID string) error {
 
 	err := r.attributesDB.DeleteUserAttribute(ctx, r.tenant, r.realm, attributeID)
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/Identityplane/GoAM/internal/db/sqlite_adapter"
 	"github.com/Identityplane/GoAM/pkg/model"
@@ -61,6 +62,11 @@ func (m *MockUserRepository) UpdateUserAttribute(ctx context.Context, attribute
 	return args.Error(0)
 }
 
+func (m *MockUserRepository) UpdateUserAttributeIfUnchanged(ctx context.Context, attribute *model.UserAttribute, lastUpdatedAt time.Time) (bool, error) {
+	args := m.Called(ctx, attribute, lastUpdatedAt)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockUserRepository) DeleteUserAttribute(ctx context.Context, attributeID string) error {
 	args := m.Called(ctx, attributeID)
 	return args.Error(0)
@@ -33,6 +33,7 @@ func InitConfiguration(settings *server_settings.GoamServerSettings) {
 	log.Debug().
 		Str("realm_configuration_folder", settings.RealmConfigurationFolder).
 		Bool("infrastructure_as_code_mode", settings.InfrastructureAsCodeMode).
+		Bool("strict_flow_validation", settings.StrictFlowValidation).
 		Bool("unsafe_disable_admin_authz_check", settings.UnsafeDisableAdminAuth).
 		Int("number_of_proxies", settings.ForwardingProxies).
 		Bool("enable_request_timing", settings.EnableRequestTiming).
@@ -72,8 +72,8 @@ func (p *PostgresApplicationDB) CreateApplication(ctx context.Context, app model
 			description, allowed_scopes, allowed_grants, allowed_authentication_flows,
 			access_token_lifetime, refresh_token_lifetime, id_token_lifetime,
 			access_token_type, access_token_algorithm, access_token_mapping,
-			id_token_algorithm, id_token_mapping, redirect_uris, settings, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)
+			id_token_algorithm, id_token_mapping, redirect_uris, application_type, settings, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23)
 	`,
 		app.Tenant,
 		app.Realm,
@@ -94,6 +94,7 @@ func (p *PostgresApplicationDB) CreateApplication(ctx context.Context, app model
 		app.IdTokenAlgorithm,
 		idTokenMappingJSON,
 		redirectUrisJSON,
+		app.Type,
 		settingsJSON,
 		now,
 		now,
@@ -119,7 +120,7 @@ func (p *PostgresApplicationDB) GetApplication(ctx context.Context, tenant, real
 		       description, allowed_scopes, allowed_grants, allowed_authentication_flows,
 		       access_token_lifetime, refresh_token_lifetime, id_token_lifetime,
 		       access_token_type, access_token_algorithm, access_token_mapping,
-		       id_token_algorithm, id_token_mapping, redirect_uris, settings, created_at, updated_at
+		       id_token_algorithm, id_token_mapping, redirect_uris, application_type, settings, created_at, updated_at
 		FROM applications
 		WHERE tenant = $1 AND realm = $2 AND client_id = $3
 	`
@@ -214,9 +215,10 @@ func (p *PostgresApplicationDB) UpdateApplication(ctx context.Context, app *mode
 			id_token_algorithm = $14,
 			id_token_mapping = $15,
 			redirect_uris = $16,
-			settings = $17,
-			updated_at = $18
-		WHERE tenant = $19 AND realm = $20 AND client_id = $21
+			application_type = $17,
+			settings = $18,
+			updated_at = $19
+		WHERE tenant = $20 AND realm = $21 AND client_id = $22
 	`,
 		app.ClientSecret,
 		app.Confidential,
@@ -234,6 +236,7 @@ func (p *PostgresApplicationDB) UpdateApplication(ctx context.Context, app *mode
 		app.IdTokenAlgorithm,
 		idTokenMappingJSON,
 		redirectUrisJSON,
+		app.Type,
 		settingsJSON,
 		now,
 		app.Tenant,
@@ -252,7 +255,7 @@ func (p *PostgresApplicationDB) ListApplications(ctx context.Context, tenant, re
 		       description, allowed_scopes, allowed_grants, allowed_authentication_flows,
 		       access_token_lifetime, refresh_token_lifetime, id_token_lifetime,
 		       access_token_type, access_token_algorithm, access_token_mapping,
-		       id_token_algorithm, id_token_mapping, redirect_uris, settings, created_at, updated_at
+		       id_token_algorithm, id_token_mapping, redirect_uris, application_type, settings, created_at, updated_at
 		FROM applications
 		WHERE tenant = $1 AND realm = $2
 	`
@@ -303,7 +306,7 @@ func (p *PostgresApplicationDB) ListAllApplications(ctx context.Context) ([]mode
 		       description, allowed_scopes, allowed_grants, allowed_authentication_flows,
 		       access_token_lifetime, refresh_token_lifetime, id_token_lifetime,
 		       access_token_type, access_token_algorithm, access_token_mapping,
-		       id_token_algorithm, id_token_mapping, redirect_uris, settings, created_at, updated_at
+		       id_token_algorithm, id_token_mapping, redirect_uris, application_type, settings, created_at, updated_at
 		FROM applications
 	`
 
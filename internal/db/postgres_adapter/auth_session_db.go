@@ -3,6 +3,7 @@ package postgres_adapter
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/Identityplane/GoAM/pkg/db"
 	"github.com/Identityplane/GoAM/pkg/model"
@@ -49,14 +50,16 @@ func (s *PostgresAuthSessionDB) CreateOrUpdateAuthSession(ctx context.Context, s
 				run_id = $1,
 				created_at = $2,
 				expires_at = $3,
-				session_information = $4
-			WHERE tenant = $5 AND realm = $6 AND session_id_hash = $7
+				session_information = $4,
+				flow_id = $5
+			WHERE tenant = $6 AND realm = $7 AND session_id_hash = $8
 		`
 		_, err = s.db.Exec(ctx, query,
 			session.RunID,
 			session.CreatedAt,
 			session.ExpiresAt,
 			session.SessionInformation,
+			session.FlowID,
 			session.Tenant,
 			session.Realm,
 			session.SessionIDHash,
@@ -69,8 +72,8 @@ func (s *PostgresAuthSessionDB) CreateOrUpdateAuthSession(ctx context.Context, s
 		query := `
 			INSERT INTO auth_sessions (
 				tenant, realm, run_id, session_id_hash,
-				created_at, expires_at, session_information
-			) VALUES ($1, $2, $3, $4, $5, $6, $7)
+				created_at, expires_at, session_information, flow_id
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		`
 		_, err = s.db.Exec(ctx, query,
 			session.Tenant,
@@ -80,6 +83,7 @@ func (s *PostgresAuthSessionDB) CreateOrUpdateAuthSession(ctx context.Context, s
 			session.CreatedAt,
 			session.ExpiresAt,
 			session.SessionInformation,
+			session.FlowID,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to create auth session: %w", err)
@@ -92,7 +96,7 @@ func (s *PostgresAuthSessionDB) CreateOrUpdateAuthSession(ctx context.Context, s
 func (s *PostgresAuthSessionDB) GetAuthSessionByID(ctx context.Context, tenant, realm, runID string) (*model.PersistentAuthSession, error) {
 	query := `
 		SELECT tenant, realm, run_id, session_id_hash,
-		       created_at, expires_at, session_information
+		       created_at, expires_at, session_information, flow_id
 		FROM auth_sessions
 		WHERE tenant = $1 AND realm = $2 AND run_id = $3
 	`
@@ -106,6 +110,7 @@ func (s *PostgresAuthSessionDB) GetAuthSessionByID(ctx context.Context, tenant,
 		&session.CreatedAt,
 		&session.ExpiresAt,
 		&session.SessionInformation,
+		&session.FlowID,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -120,7 +125,7 @@ func (s *PostgresAuthSessionDB) GetAuthSessionByID(ctx context.Context, tenant,
 func (s *PostgresAuthSessionDB) GetAuthSessionByHash(ctx context.Context, tenant, realm, sessionIDHash string) (*model.PersistentAuthSession, error) {
 	query := `
 		SELECT tenant, realm, run_id, session_id_hash,
-		       created_at, expires_at, session_information
+		       created_at, expires_at, session_information, flow_id
 		FROM auth_sessions
 		WHERE tenant = $1 AND realm = $2 AND session_id_hash = $3
 	`
@@ -134,6 +139,7 @@ func (s *PostgresAuthSessionDB) GetAuthSessionByHash(ctx context.Context, tenant
 		&session.CreatedAt,
 		&session.ExpiresAt,
 		&session.SessionInformation,
+		&session.FlowID,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -148,7 +154,7 @@ func (s *PostgresAuthSessionDB) GetAuthSessionByHash(ctx context.Context, tenant
 func (s *PostgresAuthSessionDB) ListAuthSessions(ctx context.Context, tenant, realm string) ([]model.PersistentAuthSession, error) {
 	query := `
 		SELECT tenant, realm, run_id, session_id_hash,
-		       created_at, expires_at, session_information
+		       created_at, expires_at, session_information, flow_id
 		FROM auth_sessions
 		WHERE tenant = $1 AND realm = $2
 	`
@@ -170,6 +176,7 @@ func (s *PostgresAuthSessionDB) ListAuthSessions(ctx context.Context, tenant, re
 			&session.CreatedAt,
 			&session.ExpiresAt,
 			&session.SessionInformation,
+			&session.FlowID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan auth session: %w", err)
@@ -181,10 +188,49 @@ func (s *PostgresAuthSessionDB) ListAuthSessions(ctx context.Context, tenant, re
 	return sessions, nil
 }
 
+func (s *PostgresAuthSessionDB) ListAuthSessionsByFlow(ctx context.Context, tenant, realm, flowID string, since time.Time, limit int) ([]model.PersistentAuthSession, error) {
+	query := `
+		SELECT tenant, realm, run_id, session_id_hash,
+		       created_at, expires_at, session_information, flow_id
+		FROM auth_sessions
+		WHERE tenant = $1 AND realm = $2 AND flow_id = $3 AND created_at >= $4
+		ORDER BY created_at DESC
+		LIMIT $5
+	`
+
+	rows, err := s.db.Query(ctx, query, tenant, realm, flowID, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list auth sessions of flow: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []model.PersistentAuthSession
+	for rows.Next() {
+		var session model.PersistentAuthSession
+		err := rows.Scan(
+			&session.Tenant,
+			&session.Realm,
+			&session.RunID,
+			&session.SessionIDHash,
+			&session.CreatedAt,
+			&session.ExpiresAt,
+			&session.SessionInformation,
+			&session.FlowID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan auth session: %w", err)
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
 func (s *PostgresAuthSessionDB) ListAllAuthSessions(ctx context.Context, tenant string) ([]model.PersistentAuthSession, error) {
 	query := `
 		SELECT tenant, realm, run_id, session_id_hash,
-		       created_at, expires_at, session_information
+		       created_at, expires_at, session_information, flow_id
 		FROM auth_sessions
 		WHERE tenant = $1
 	`
@@ -206,6 +252,7 @@ func (s *PostgresAuthSessionDB) ListAllAuthSessions(ctx context.Context, tenant
 			&session.CreatedAt,
 			&session.ExpiresAt,
 			&session.SessionInformation,
+			&session.FlowID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan auth session: %w", err)
@@ -231,16 +278,49 @@ func (s *PostgresAuthSessionDB) DeleteAuthSession(ctx context.Context, tenant, r
 	return nil
 }
 
-func (s *PostgresAuthSessionDB) DeleteExpiredAuthSessions(ctx context.Context, tenant, realm string) error {
+func (s *PostgresAuthSessionDB) DeleteExpiredAuthSessions(ctx context.Context, tenant, realm string) (int, error) {
 	query := `
 		DELETE FROM auth_sessions
 		WHERE tenant = $1 AND realm = $2 AND expires_at < NOW()
 	`
 
-	_, err := s.db.Exec(ctx, query, tenant, realm)
+	tag, err := s.db.Exec(ctx, query, tenant, realm)
 	if err != nil {
-		return fmt.Errorf("failed to delete expired auth sessions: %w", err)
+		return 0, fmt.Errorf("failed to delete expired auth sessions: %w", err)
 	}
 
-	return nil
+	approvals, err := s.db.Exec(ctx, `
+		DELETE FROM magic_link_approvals
+		WHERE tenant = $1 AND realm = $2 AND expires_at < NOW()
+	`, tenant, realm)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired magic link approvals: %w", err)
+	}
+
+	return int(tag.RowsAffected() + approvals.RowsAffected()), nil
+}
+
+func (s *PostgresAuthSessionDB) SaveMagicLinkApproval(ctx context.Context, tenant, realm, sessionIDHash, linkID string, expiresAt time.Time) (bool, error) {
+	tag, err := s.db.Exec(ctx, `
+		INSERT INTO magic_link_approvals (tenant, realm, session_id_hash, link_id, approved_at, expires_at)
+		VALUES ($1, $2, $3, $4, NOW(), $5)
+		ON CONFLICT (tenant, realm, session_id_hash, link_id) DO NOTHING
+	`, tenant, realm, sessionIDHash, linkID, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to save magic link approval: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (s *PostgresAuthSessionDB) ConsumeMagicLinkApproval(ctx context.Context, tenant, realm, sessionIDHash, linkID string) (bool, error) {
+	tag, err := s.db.Exec(ctx, `
+		DELETE FROM magic_link_approvals
+		WHERE tenant = $1 AND realm = $2 AND session_id_hash = $3 AND link_id = $4 AND expires_at > NOW()
+	`, tenant, realm, sessionIDHash, linkID)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume magic link approval: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
 }
@@ -457,16 +457,16 @@ func (s *PostgresClientSessionDB) DeleteClientSession(ctx context.Context, tenan
 	return nil
 }
 
-func (s *PostgresClientSessionDB) DeleteExpiredClientSessions(ctx context.Context, tenant, realm string) error {
+func (s *PostgresClientSessionDB) DeleteExpiredClientSessions(ctx context.Context, tenant, realm string) (int, error) {
 	query := `
 		DELETE FROM client_sessions
 		WHERE tenant = $1 AND realm = $2 AND expire < NOW()
 	`
 
-	_, err := s.db.Exec(ctx, query, tenant, realm)
+	tag, err := s.db.Exec(ctx, query, tenant, realm)
 	if err != nil {
-		return fmt.Errorf("failed to delete expired client sessions: %w", err)
+		return 0, fmt.Errorf("failed to delete expired client sessions: %w", err)
 	}
 
-	return nil
+	return int(tag.RowsAffected()), nil
 }
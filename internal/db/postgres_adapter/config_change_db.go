@@ -0,0 +1,136 @@
+package postgres_adapter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// configChangeChannel is the LISTEN/NOTIFY channel on which new config change versions are announced
+const configChangeChannel = "goam_config_changes"
+
+// PostgresConfigChangeDB implements the ConfigChangeDB interface using PostgreSQL
+type PostgresConfigChangeDB struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresConfigChangeDB creates a new PostgresConfigChangeDB instance
+func NewPostgresConfigChangeDB(db *pgxpool.Pool) (*PostgresConfigChangeDB, error) {
+	// Check if the connection works and config_changes table exists by executing a query
+	_, err := db.Exec(context.Background(), `
+		SELECT 1 FROM config_changes LIMIT 1
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if config_changes table exists: %w", err)
+	}
+
+	return &PostgresConfigChangeDB{db: db}, nil
+}
+
+// CreateConfigChange inserts the change and notifies all listeners within the same transaction,
+// so the notification is only delivered once the change is visible
+func (p *PostgresConfigChangeDB) CreateConfigChange(ctx context.Context, change *model.ConfigChange) error {
+	now := time.Now()
+
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO config_changes (tenant, realm, entity_type, entity_id, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING version
+	`,
+		change.Tenant,
+		change.Realm,
+		change.EntityType,
+		change.EntityId,
+		now,
+	).Scan(&change.Version)
+	if err != nil {
+		return fmt.Errorf("failed to create config change: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `SELECT pg_notify($1, $2)`, configChangeChannel, strconv.FormatInt(change.Version, 10))
+	if err != nil {
+		return fmt.Errorf("failed to notify config change: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit config change: %w", err)
+	}
+
+	change.CreatedAt = now
+	return nil
+}
+
+func (p *PostgresConfigChangeDB) ListConfigChangesSince(ctx context.Context, version int64) ([]model.ConfigChange, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT version, tenant, realm, entity_type, entity_id, created_at
+		FROM config_changes
+		WHERE version > $1
+		ORDER BY version
+	`, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list config changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[model.ConfigChange])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect config changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+func (p *PostgresConfigChangeDB) GetLatestConfigVersion(ctx context.Context) (int64, error) {
+	var version int64
+
+	err := p.db.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM config_changes`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest config version: %w", err)
+	}
+
+	return version, nil
+}
+
+// WatchConfigChanges holds a dedicated connection from the pool and uses LISTEN to wait for notifications
+func (p *PostgresConfigChangeDB) WatchConfigChanges(ctx context.Context, notify func()) error {
+
+	conn, err := p.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, "LISTEN "+configChangeChannel)
+	if err != nil {
+		return fmt.Errorf("failed to listen for config changes: %w", err)
+	}
+
+	// Catch up on changes that were made before the listener was registered
+	notify()
+
+	for {
+		_, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			// The connection is still subscribed and its state is unknown, so it must not go back into the pool
+			conn.Hijack().Close(context.Background())
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to wait for config change notification: %w", err)
+		}
+
+		notify()
+	}
+}
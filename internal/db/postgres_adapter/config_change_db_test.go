@@ -0,0 +1,20 @@
+package postgres_adapter
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresConfigChangeDB(t *testing.T) {
+	conn, err := setupTestDB(t)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	configChangeDB, err := NewPostgresConfigChangeDB(conn)
+	require.NoError(t, err)
+
+	db.TemplateTestConfigChangeDB(t, configChangeDB)
+}
@@ -36,8 +36,8 @@ func (p *PostgresFlowDB) CreateFlow(ctx context.Context, flow model.Flow) error
 	_, err := p.db.Exec(ctx, `
 		INSERT INTO flows (
 			tenant, realm, id, route, active, debug_allowed, definition_yaml,
-			created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			active_version, variants, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`,
 		flow.Tenant,
 		flow.Realm,
@@ -46,6 +46,8 @@ func (p *PostgresFlowDB) CreateFlow(ctx context.Context, flow model.Flow) error
 		flow.Active,
 		flow.DebugAllowed,
 		flow.DefinitionYaml,
+		flow.ActiveVersion,
+		flow.Variants,
 		now,
 		now,
 	)
@@ -107,13 +109,17 @@ func (p *PostgresFlowDB) UpdateFlow(ctx context.Context, flow *model.Flow) error
 			active = $2,
 			debug_allowed = $3,
 			definition_yaml = $4,
-			updated_at = $5
-		WHERE tenant = $6 AND realm = $7 AND id = $8
+			active_version = $5,
+			variants = $6,
+			updated_at = $7
+		WHERE tenant = $8 AND realm = $9 AND id = $10
 	`,
 		flow.Route,
 		flow.Active,
 		flow.DebugAllowed,
 		flow.DefinitionYaml,
+		flow.ActiveVersion,
+		flow.Variants,
 		now,
 		flow.Tenant,
 		flow.Realm,
@@ -0,0 +1,93 @@
+package postgres_adapter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresFlowStatsDB implements the FlowStatsDB interface using PostgreSQL
+type PostgresFlowStatsDB struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresFlowStatsDB creates a new PostgresFlowStatsDB instance
+func NewPostgresFlowStatsDB(db *pgxpool.Pool) (*PostgresFlowStatsDB, error) {
+	// Check if the connection works and flow_stats table exists by executing a query
+	_, err := db.Exec(context.Background(), `
+		SELECT 1 FROM flow_stats LIMIT 1
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if flow_stats table exists: %w", err)
+	}
+
+	return &PostgresFlowStatsDB{db: db}, nil
+}
+
+func (p *PostgresFlowStatsDB) IncrementFlowStats(ctx context.Context, stats []*model.FlowStat) error {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, stat := range stats {
+		batch.Queue(`
+			INSERT INTO flow_stats (tenant, realm, flow_id, client_id, bucket, node, metric, value)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (tenant, realm, flow_id, client_id, bucket, node, metric) DO UPDATE SET value = flow_stats.value + EXCLUDED.value
+		`, stat.Tenant, stat.Realm, stat.FlowId, stat.ClientId, stat.Bucket, stat.Node, stat.Metric, stat.Value)
+	}
+
+	// A batch is sent as one implicit transaction
+	if err := p.db.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to increment flow stats: %w", err)
+	}
+
+	return nil
+}
+
+func (p *PostgresFlowStatsDB) ListFlowStats(ctx context.Context, tenant, realm string, filter model.FlowStatsFilter) ([]*model.FlowStat, error) {
+	conditions := []string{"tenant = $1", "realm = $2"}
+	args := []any{tenant, realm}
+
+	addCondition := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.FlowId != "" {
+		addCondition("flow_id = $%d", filter.FlowId)
+	}
+	if filter.ClientId != "" {
+		addCondition("client_id = $%d", filter.ClientId)
+	}
+	if !filter.From.IsZero() {
+		addCondition("bucket >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("bucket < $%d", filter.To)
+	}
+
+	rows, err := p.db.Query(ctx, `
+		SELECT tenant, realm, flow_id, client_id, bucket, node, metric, value
+		FROM flow_stats
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY bucket, flow_id, client_id, node, metric
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list flow stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByNameLax[model.FlowStat])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan flow stats: %w", err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,20 @@
+package postgres_adapter
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresFlowStatsDB(t *testing.T) {
+	conn, err := setupTestDB(t)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	flowStatsDB, err := NewPostgresFlowStatsDB(conn)
+	require.NoError(t, err)
+
+	db.TemplateTestFlowStatsDB(t, flowStatsDB)
+}
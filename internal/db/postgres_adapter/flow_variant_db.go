@@ -0,0 +1,182 @@
+package postgres_adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresFlowVariantDB implements the FlowVariantDB interface using PostgreSQL
+type PostgresFlowVariantDB struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresFlowVariantDB creates a new PostgresFlowVariantDB instance
+func NewPostgresFlowVariantDB(db *pgxpool.Pool) (*PostgresFlowVariantDB, error) {
+	// Check if the connection works and the flow variant tables exist by executing a query
+	_, err := db.Exec(context.Background(), `
+		SELECT 1 FROM flow_variant_assignments LIMIT 1
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if flow_variant_assignments table exists: %w", err)
+	}
+
+	_, err = db.Exec(context.Background(), `
+		SELECT 1 FROM flow_variant_sessions LIMIT 1
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if flow_variant_sessions table exists: %w", err)
+	}
+
+	return &PostgresFlowVariantDB{db: db}, nil
+}
+
+func (p *PostgresFlowVariantDB) GetFlowVariantAssignment(ctx context.Context, tenant, realm, flowId, stickyKey string) (*model.FlowVariantAssignment, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT tenant, realm, flow_id, sticky_key, variant, created_at
+		FROM flow_variant_assignments
+		WHERE tenant = $1 AND realm = $2 AND flow_id = $3 AND sticky_key = $4
+	`, tenant, realm, flowId, stickyKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignment, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByNameLax[model.FlowVariantAssignment])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil // not found
+		}
+		return nil, err
+	}
+
+	return assignment, nil
+}
+
+func (p *PostgresFlowVariantDB) SaveFlowVariantAssignment(ctx context.Context, assignment *model.FlowVariantAssignment) error {
+	assignment.CreatedAt = time.Now()
+
+	_, err := p.db.Exec(ctx, `
+		INSERT INTO flow_variant_assignments (tenant, realm, flow_id, sticky_key, variant, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant, realm, flow_id, sticky_key) DO UPDATE SET variant = EXCLUDED.variant, created_at = EXCLUDED.created_at
+	`,
+		assignment.Tenant,
+		assignment.Realm,
+		assignment.FlowId,
+		assignment.StickyKey,
+		assignment.Variant,
+		assignment.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save flow variant assignment: %w", err)
+	}
+
+	return nil
+}
+
+func (p *PostgresFlowVariantDB) CreateFlowVariantSession(ctx context.Context, session *model.FlowVariantSession) error {
+	session.CreatedAt = time.Now()
+	session.Result = ""
+	session.FinishedAt = nil
+
+	_, err := p.db.Exec(ctx, `
+		INSERT INTO flow_variant_sessions (tenant, realm, flow_id, run_id, variant, version, result, created_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`,
+		session.Tenant,
+		session.Realm,
+		session.FlowId,
+		session.RunID,
+		session.Variant,
+		session.Version,
+		session.Result,
+		session.CreatedAt,
+		session.FinishedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create flow variant session: %w", err)
+	}
+
+	return nil
+}
+
+func (p *PostgresFlowVariantDB) GetFlowVariantSession(ctx context.Context, tenant, realm, runId string) (*model.FlowVariantSession, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT tenant, realm, flow_id, run_id, variant, version, result, created_at, finished_at
+		FROM flow_variant_sessions
+		WHERE tenant = $1 AND realm = $2 AND run_id = $3
+	`, tenant, realm, runId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	session, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByNameLax[model.FlowVariantSession])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil // not found
+		}
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (p *PostgresFlowVariantDB) FinishFlowVariantSession(ctx context.Context, tenant, realm, runId, result string) (bool, error) {
+	tag, err := p.db.Exec(ctx, `
+		UPDATE flow_variant_sessions SET result = $1, finished_at = $2
+		WHERE tenant = $3 AND realm = $4 AND run_id = $5 AND result = ''
+	`, result, time.Now(), tenant, realm, runId)
+	if err != nil {
+		return false, fmt.Errorf("failed to finish flow variant session: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (p *PostgresFlowVariantDB) CountFlowVariantSessions(ctx context.Context, tenant, realm, flowId string) ([]model.FlowVariantCount, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT variant,
+			COUNT(*) AS started,
+			COUNT(*) FILTER (WHERE result = $1) AS succeeded,
+			COUNT(*) FILTER (WHERE result = $2) AS failed
+		FROM flow_variant_sessions
+		WHERE tenant = $3 AND realm = $4 AND flow_id = $5
+		GROUP BY variant
+		ORDER BY variant
+	`, model.FlowVariantResultSucceeded, model.FlowVariantResultFailed, tenant, realm, flowId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count flow variant sessions: %w", err)
+	}
+	defer rows.Close()
+
+	counts, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[model.FlowVariantCount])
+	if err != nil {
+		return nil, fmt.Errorf("failed to count flow variant sessions: %w", err)
+	}
+
+	return counts, nil
+}
+
+func (p *PostgresFlowVariantDB) DeleteFlowVariants(ctx context.Context, tenant, realm, flowId string) error {
+	_, err := p.db.Exec(ctx, `
+		DELETE FROM flow_variant_assignments
+		WHERE tenant = $1 AND realm = $2 AND flow_id = $3
+	`, tenant, realm, flowId)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Exec(ctx, `
+		DELETE FROM flow_variant_sessions
+		WHERE tenant = $1 AND realm = $2 AND flow_id = $3
+	`, tenant, realm, flowId)
+	return err
+}
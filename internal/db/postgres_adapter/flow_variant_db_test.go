@@ -0,0 +1,20 @@
+package postgres_adapter
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresFlowVariantDB(t *testing.T) {
+	conn, err := setupTestDB(t)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	flowVariantDB, err := NewPostgresFlowVariantDB(conn)
+	require.NoError(t, err)
+
+	db.TemplateTestFlowVariantDB(t, flowVariantDB)
+}
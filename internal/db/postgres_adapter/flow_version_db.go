@@ -0,0 +1,167 @@
+package postgres_adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresFlowVersionDB implements the FlowVersionDB interface using PostgreSQL
+type PostgresFlowVersionDB struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresFlowVersionDB creates a new PostgresFlowVersionDB instance
+func NewPostgresFlowVersionDB(db *pgxpool.Pool) (*PostgresFlowVersionDB, error) {
+	// Check if the connection works and flow_versions table exists by executing a query
+	_, err := db.Exec(context.Background(), `
+		SELECT 1 FROM flow_versions LIMIT 1
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if flow_versions table exists: %w", err)
+	}
+
+	return &PostgresFlowVersionDB{db: db}, nil
+}
+
+func (p *PostgresFlowVersionDB) CreateFlowVersion(ctx context.Context, version *model.FlowVersion) error {
+	version.CreatedAt = time.Now()
+
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(MAX(version), 0) + 1 FROM flow_versions
+		WHERE tenant = $1 AND realm = $2 AND flow_id = $3
+	`, version.Tenant, version.Realm, version.FlowId).Scan(&version.Version)
+	if err != nil {
+		return fmt.Errorf("failed to determine next flow version: %w", err)
+	}
+
+	// Concurrent inserts of the same version fail on the primary key instead of overwriting each other
+	_, err = tx.Exec(ctx, `
+		INSERT INTO flow_versions (tenant, realm, flow_id, version, definition_yaml, comment, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`,
+		version.Tenant,
+		version.Realm,
+		version.FlowId,
+		version.Version,
+		version.DefinitionYaml,
+		version.Comment,
+		version.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create flow version: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (p *PostgresFlowVersionDB) GetFlowVersion(ctx context.Context, tenant, realm, flowId string, version int) (*model.FlowVersion, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT tenant, realm, flow_id, version, definition_yaml, comment, created_at
+		FROM flow_versions
+		WHERE tenant = $1 AND realm = $2 AND flow_id = $3 AND version = $4
+	`, tenant, realm, flowId, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flowVersion, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByNameLax[model.FlowVersion])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil // not found
+		}
+		return nil, err
+	}
+
+	return flowVersion, nil
+}
+
+func (p *PostgresFlowVersionDB) ListFlowVersions(ctx context.Context, tenant, realm, flowId string) ([]model.FlowVersion, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT tenant, realm, flow_id, version, definition_yaml, comment, created_at
+		FROM flow_versions
+		WHERE tenant = $1 AND realm = $2 AND flow_id = $3
+		ORDER BY version DESC
+	`, tenant, realm, flowId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[model.FlowVersion])
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func (p *PostgresFlowVersionDB) DeleteFlowVersions(ctx context.Context, tenant, realm, flowId string) error {
+	_, err := p.db.Exec(ctx, `
+		DELETE FROM flow_versions
+		WHERE tenant = $1 AND realm = $2 AND flow_id = $3
+	`, tenant, realm, flowId)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Exec(ctx, `
+		DELETE FROM flow_publications
+		WHERE tenant = $1 AND realm = $2 AND flow_id = $3
+	`, tenant, realm, flowId)
+	return err
+}
+
+func (p *PostgresFlowVersionDB) CreateFlowPublication(ctx context.Context, publication *model.FlowPublication) error {
+	publication.PublishedAt = time.Now()
+
+	_, err := p.db.Exec(ctx, `
+		INSERT INTO flow_publications (tenant, realm, flow_id, version, previous_version, published_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`,
+		publication.Tenant,
+		publication.Realm,
+		publication.FlowId,
+		publication.Version,
+		publication.PreviousVersion,
+		publication.PublishedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create flow publication: %w", err)
+	}
+
+	return nil
+}
+
+func (p *PostgresFlowVersionDB) ListFlowPublications(ctx context.Context, tenant, realm, flowId string) ([]model.FlowPublication, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT tenant, realm, flow_id, version, previous_version, published_at
+		FROM flow_publications
+		WHERE tenant = $1 AND realm = $2 AND flow_id = $3
+		ORDER BY id DESC
+	`, tenant, realm, flowId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	publications, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[model.FlowPublication])
+	if err != nil {
+		return nil, err
+	}
+
+	return publications, nil
+}
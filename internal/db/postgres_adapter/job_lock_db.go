@@ -0,0 +1,49 @@
+package postgres_adapter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresJobLockDB implements the JobLockDB interface using PostgreSQL advisory locks, so that no two replicas
+// run a job at the same time. The lock is only held while the job runs, there is no elected leader.
+type PostgresJobLockDB struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresJobLockDB creates a new PostgresJobLockDB instance
+func NewPostgresJobLockDB(db *pgxpool.Pool) (*PostgresJobLockDB, error) {
+	return &PostgresJobLockDB{db: db}, nil
+}
+
+// RunWithLock takes a session level advisory lock on a dedicated connection. The lock is released
+// explicitly after fn returns, or by the database if the connection is lost.
+func (p *PostgresJobLockDB) RunWithLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	conn, err := p.db.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var acquired bool
+	err = conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, name).Scan(&acquired)
+	if err != nil {
+		return false, fmt.Errorf("failed to take job lock %s: %w", name, err)
+	}
+	if !acquired {
+		return false, nil
+	}
+
+	defer func() {
+		// Use a fresh context so the lock is released even if ctx was cancelled
+		_, unlockErr := conn.Exec(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, name)
+		if unlockErr != nil {
+			// Closing the connection makes the database drop all of its locks
+			conn.Conn().Close(context.Background())
+		}
+	}()
+
+	return true, fn(ctx)
+}
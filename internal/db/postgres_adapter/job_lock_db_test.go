@@ -0,0 +1,20 @@
+package postgres_adapter
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresJobLockDB(t *testing.T) {
+	conn, err := setupTestDB(t)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	jobLockDB, err := NewPostgresJobLockDB(conn)
+	require.NoError(t, err)
+
+	db.TemplateTestJobLockDB(t, jobLockDB)
+}
@@ -0,0 +1,10 @@
+-- migrations/012_create_config_changes.up.sql
+
+CREATE TABLE IF NOT EXISTS config_changes (
+    version BIGSERIAL PRIMARY KEY,
+    tenant VARCHAR(255) NOT NULL,
+    realm VARCHAR(255) NOT NULL,
+    entity_type VARCHAR(255) NOT NULL,
+    entity_id VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
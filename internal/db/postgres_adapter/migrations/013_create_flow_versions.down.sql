@@ -0,0 +1,4 @@
+-- migrations/013_create_flow_versions.down.sql
+
+DROP TABLE IF EXISTS flow_versions;
+ALTER TABLE flows DROP COLUMN active_version;
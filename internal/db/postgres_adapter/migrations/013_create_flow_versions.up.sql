@@ -0,0 +1,14 @@
+-- migrations/013_create_flow_versions.up.sql
+
+CREATE TABLE IF NOT EXISTS flow_versions (
+    tenant VARCHAR(255) NOT NULL,
+    realm VARCHAR(255) NOT NULL,
+    flow_id VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    definition_yaml TEXT NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant, realm, flow_id, version)
+);
+
+ALTER TABLE flows ADD COLUMN IF NOT EXISTS active_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- migrations/014_add_variants_to_flows.down.sql
+
+ALTER TABLE flows DROP COLUMN variants;
@@ -0,0 +1,4 @@
+-- migrations/014_add_variants_to_flows.up.sql
+
+-- Weighted rollout between flow versions as json, empty if the flow has no variants
+ALTER TABLE flows ADD COLUMN IF NOT EXISTS variants TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,20 @@
+-- migrations/015_create_password_reset_tokens.up.sql
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id VARCHAR(255) NOT NULL,
+    tenant VARCHAR(255) NOT NULL,
+    realm VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL DEFAULT '',
+    identifier_hash VARCHAR(255) NOT NULL DEFAULT '',
+    request_ip VARCHAR(255) NOT NULL DEFAULT '',
+    channel VARCHAR(50) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (tenant, realm, id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_reset_tokens_hash ON password_reset_tokens(tenant, realm, token_hash);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_identifier ON password_reset_tokens(tenant, realm, identifier_hash, created_at);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_ip ON password_reset_tokens(tenant, realm, request_ip, created_at);
@@ -0,0 +1,3 @@
+-- migrations/016_create_flow_stats.down.sql
+
+DROP TABLE IF EXISTS flow_stats;
@@ -0,0 +1,15 @@
+-- migrations/016_create_flow_stats.up.sql
+
+CREATE TABLE IF NOT EXISTS flow_stats (
+    tenant VARCHAR(255) NOT NULL,
+    realm VARCHAR(255) NOT NULL,
+    flow_id VARCHAR(255) NOT NULL,
+    client_id VARCHAR(255) NOT NULL DEFAULT '',
+    bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+    node VARCHAR(255) NOT NULL DEFAULT '',
+    metric VARCHAR(50) NOT NULL,
+    value BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant, realm, flow_id, client_id, bucket, node, metric)
+);
+
+CREATE INDEX IF NOT EXISTS idx_flow_stats_bucket ON flow_stats(tenant, realm, bucket);
@@ -0,0 +1,3 @@
+-- migrations/017_add_application_type_to_applications.down.sql
+
+ALTER TABLE applications DROP COLUMN application_type;
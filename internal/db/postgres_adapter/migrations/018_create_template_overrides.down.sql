@@ -0,0 +1,3 @@
+-- migrations/018_create_template_overrides.down.sql
+
+DROP TABLE IF EXISTS template_overrides;
@@ -0,0 +1,11 @@
+-- migrations/018_create_template_overrides.up.sql
+
+CREATE TABLE IF NOT EXISTS template_overrides (
+    tenant VARCHAR(255) NOT NULL,
+    realm VARCHAR(255) NOT NULL,
+    flow_id VARCHAR(255) NOT NULL,
+    node_name VARCHAR(255) NOT NULL,
+    template TEXT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (tenant, realm, flow_id, node_name)
+);
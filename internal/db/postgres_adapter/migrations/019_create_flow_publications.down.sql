@@ -0,0 +1,3 @@
+-- migrations/019_create_flow_publications.down.sql
+
+DROP TABLE IF EXISTS flow_publications;
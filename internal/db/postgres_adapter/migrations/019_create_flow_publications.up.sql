@@ -0,0 +1,13 @@
+-- migrations/019_create_flow_publications.up.sql
+
+CREATE TABLE IF NOT EXISTS flow_publications (
+    id BIGSERIAL PRIMARY KEY,
+    tenant VARCHAR(255) NOT NULL,
+    realm VARCHAR(255) NOT NULL,
+    flow_id VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    previous_version INTEGER NOT NULL DEFAULT 0,
+    published_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_flow_publications_flow ON flow_publications(tenant, realm, flow_id, id);
@@ -0,0 +1,4 @@
+-- migrations/020_create_flow_variants.down.sql
+
+DROP TABLE IF EXISTS flow_variant_sessions;
+DROP TABLE IF EXISTS flow_variant_assignments;
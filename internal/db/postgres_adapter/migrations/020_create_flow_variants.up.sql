@@ -0,0 +1,28 @@
+-- migrations/020_create_flow_variants.up.sql
+
+-- Variant a device was assigned to the first time it started a flow
+CREATE TABLE IF NOT EXISTS flow_variant_assignments (
+    tenant VARCHAR(255) NOT NULL,
+    realm VARCHAR(255) NOT NULL,
+    flow_id VARCHAR(255) NOT NULL,
+    sticky_key VARCHAR(255) NOT NULL,
+    variant VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (tenant, realm, flow_id, sticky_key)
+);
+
+-- Audit record of every session that ran on a variant and its result
+CREATE TABLE IF NOT EXISTS flow_variant_sessions (
+    tenant VARCHAR(255) NOT NULL,
+    realm VARCHAR(255) NOT NULL,
+    flow_id VARCHAR(255) NOT NULL,
+    run_id VARCHAR(255) NOT NULL,
+    variant VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    result VARCHAR(32) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (tenant, realm, run_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_flow_variant_sessions_flow ON flow_variant_sessions(tenant, realm, flow_id, variant);
@@ -0,0 +1,3 @@
+-- migrations/021_create_magic_link_approvals.down.sql
+
+DROP TABLE IF EXISTS magic_link_approvals;
@@ -0,0 +1,11 @@
+-- migrations/021_create_magic_link_approvals.up.sql
+
+CREATE TABLE IF NOT EXISTS magic_link_approvals (
+    tenant VARCHAR(255) NOT NULL,
+    realm VARCHAR(255) NOT NULL,
+    session_id_hash VARCHAR(255) NOT NULL,
+    link_id VARCHAR(255) NOT NULL,
+    approved_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (tenant, realm, session_id_hash, link_id)
+);
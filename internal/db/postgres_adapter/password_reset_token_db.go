@@ -0,0 +1,131 @@
+package postgres_adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresPasswordResetTokenDB implements the PasswordResetTokenDB interface using PostgreSQL
+type PostgresPasswordResetTokenDB struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresPasswordResetTokenDB creates a new PostgresPasswordResetTokenDB instance
+func NewPostgresPasswordResetTokenDB(db *pgxpool.Pool) (*PostgresPasswordResetTokenDB, error) {
+	// Check if the connection works and password_reset_tokens table exists by executing a query
+	_, err := db.Exec(context.Background(), `
+		SELECT 1 FROM password_reset_tokens LIMIT 1
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if password_reset_tokens table exists: %w", err)
+	}
+
+	return &PostgresPasswordResetTokenDB{db: db}, nil
+}
+
+func (p *PostgresPasswordResetTokenDB) CreatePasswordResetToken(ctx context.Context, token *model.PasswordResetToken) error {
+	token.CreatedAt = time.Now()
+
+	_, err := p.db.Exec(ctx, `
+		INSERT INTO password_reset_tokens (id, tenant, realm, token_hash, user_id, identifier_hash, request_ip, channel, created_at, expires_at, used_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`,
+		token.ID,
+		token.Tenant,
+		token.Realm,
+		token.TokenHash,
+		token.UserID,
+		token.IdentifierHash,
+		token.RequestIP,
+		token.Channel,
+		token.CreatedAt,
+		token.ExpiresAt,
+		token.UsedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+
+	return nil
+}
+
+func (p *PostgresPasswordResetTokenDB) GetPasswordResetTokenByHash(ctx context.Context, tenant, realm, tokenHash string) (*model.PasswordResetToken, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT id, tenant, realm, token_hash, user_id, identifier_hash, request_ip, channel, created_at, expires_at, used_at
+		FROM password_reset_tokens
+		WHERE tenant = $1 AND realm = $2 AND token_hash = $3
+	`, tenant, realm, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	token, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByNameLax[model.PasswordResetToken])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil // not found
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (p *PostgresPasswordResetTokenDB) MarkPasswordResetTokenUsed(ctx context.Context, tenant, realm, tokenHash string, usedAt time.Time) (bool, error) {
+	result, err := p.db.Exec(ctx, `
+		UPDATE password_reset_tokens SET used_at = $1
+		WHERE tenant = $2 AND realm = $3 AND token_hash = $4 AND used_at IS NULL
+	`, usedAt, tenant, realm, tokenHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark password reset token as used: %w", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+func (p *PostgresPasswordResetTokenDB) CountPasswordResetTokensByIdentifier(ctx context.Context, tenant, realm, identifierHash string, since time.Time) (int, error) {
+	var count int
+
+	err := p.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM password_reset_tokens
+		WHERE tenant = $1 AND realm = $2 AND identifier_hash = $3 AND created_at >= $4
+	`, tenant, realm, identifierHash, since).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count password reset tokens: %w", err)
+	}
+
+	return count, nil
+}
+
+func (p *PostgresPasswordResetTokenDB) CountPasswordResetTokensByIP(ctx context.Context, tenant, realm, requestIP string, since time.Time) (int, error) {
+	var count int
+
+	err := p.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM password_reset_tokens
+		WHERE tenant = $1 AND realm = $2 AND request_ip = $3 AND created_at >= $4
+	`, tenant, realm, requestIP, since).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count password reset tokens: %w", err)
+	}
+
+	return count, nil
+}
+
+func (p *PostgresPasswordResetTokenDB) DeleteExpiredPasswordResetTokens(ctx context.Context, tenant, realm string, before time.Time) (int, error) {
+	result, err := p.db.Exec(ctx, `
+		DELETE FROM password_reset_tokens
+		WHERE tenant = $1 AND realm = $2 AND expires_at < $3
+	`, tenant, realm, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired password reset tokens: %w", err)
+	}
+
+	return int(result.RowsAffected()), nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Identityplane/GoAM/pkg/kms"
 	"github.com/Identityplane/GoAM/pkg/model"
 
 	"github.com/jackc/pgx/v5"
@@ -29,6 +30,11 @@ func NewPostgresSigningKeysDB(db *pgxpool.Pool) (*PostgresSigningKeysDB, error)
 }
 
 func (s *PostgresSigningKeysDB) CreateSigningKey(ctx context.Context, key model.SigningKey) error {
+	key, err := kms.EncryptSigningKey(ctx, key)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		INSERT INTO signing_keys (
 			tenant, realm, kid, active, algorithm, implementation,
@@ -43,7 +49,7 @@ func (s *PostgresSigningKeysDB) CreateSigningKey(ctx context.Context, key model.
 		disabledStr = nil
 	}
 
-	_, err := s.db.Exec(ctx, query,
+	_, err = s.db.Exec(ctx, query,
 		key.Tenant,
 		key.Realm,
 		key.Kid,
@@ -96,6 +102,10 @@ func (s *PostgresSigningKeysDB) GetSigningKey(ctx context.Context, tenant, realm
 	key.Created = created
 	key.Disabled = disabled
 
+	if err := kms.DecryptSigningKey(ctx, &key); err != nil {
+		return nil, err
+	}
+
 	return &key, nil
 }
 
@@ -138,6 +148,10 @@ func (s *PostgresSigningKeysDB) ListSigningKeys(ctx context.Context, tenant, rea
 		key.Created = created
 		key.Disabled = disabled
 
+		if err := kms.DecryptSigningKey(ctx, &key); err != nil {
+			return nil, err
+		}
+
 		keys = append(keys, key)
 	}
 
@@ -183,6 +197,10 @@ func (s *PostgresSigningKeysDB) ListActiveSigningKeys(ctx context.Context, tenan
 		key.Created = created
 		key.Disabled = disabled
 
+		if err := kms.DecryptSigningKey(ctx, &key); err != nil {
+			return nil, err
+		}
+
 		keys = append(keys, key)
 	}
 
@@ -227,11 +245,16 @@ func (s *PostgresSigningKeysDB) UpdateSigningKey(ctx context.Context, key *model
 		disabledStr = nil
 	}
 
+	encrypted, err := kms.EncryptSigningKey(ctx, *key)
+	if err != nil {
+		return err
+	}
+
 	result, err := s.db.Exec(ctx, query,
 		key.Active,
 		key.Algorithm,
-		key.Implementation,
-		key.SigningKeyMaterial,
+		encrypted.Implementation,
+		encrypted.SigningKeyMaterial,
 		key.PublicKeyJWK,
 		key.Created.Format(time.RFC3339),
 		disabledStr,
@@ -0,0 +1,106 @@
+package postgres_adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresTemplateOverrideDB implements the TemplateOverrideDB interface using PostgreSQL
+type PostgresTemplateOverrideDB struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresTemplateOverrideDB creates a new PostgresTemplateOverrideDB instance
+func NewPostgresTemplateOverrideDB(db *pgxpool.Pool) (*PostgresTemplateOverrideDB, error) {
+	// Check if the connection works and template_overrides table exists by executing a query
+	_, err := db.Exec(context.Background(), `
+		SELECT 1 FROM template_overrides LIMIT 1
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if template_overrides table exists: %w", err)
+	}
+
+	return &PostgresTemplateOverrideDB{db: db}, nil
+}
+
+func (p *PostgresTemplateOverrideDB) UpsertTemplateOverride(ctx context.Context, override *model.TemplateOverride) error {
+	override.UpdatedAt = time.Now()
+
+	_, err := p.db.Exec(ctx, `
+		INSERT INTO template_overrides (tenant, realm, flow_id, node_name, template, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant, realm, flow_id, node_name) DO UPDATE SET template = EXCLUDED.template, updated_at = EXCLUDED.updated_at
+	`,
+		override.Tenant,
+		override.Realm,
+		override.FlowId,
+		override.NodeName,
+		override.Template,
+		override.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upsert template override: %w", err)
+	}
+
+	return nil
+}
+
+func (p *PostgresTemplateOverrideDB) GetTemplateOverride(ctx context.Context, tenant, realm, flowId, nodeName string) (*model.TemplateOverride, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT tenant, realm, flow_id, node_name, template, updated_at
+		FROM template_overrides
+		WHERE tenant = $1 AND realm = $2 AND flow_id = $3 AND node_name = $4
+	`, tenant, realm, flowId, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	override, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByNameLax[model.TemplateOverride])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil // not found
+		}
+		return nil, err
+	}
+
+	return override, nil
+}
+
+func (p *PostgresTemplateOverrideDB) ListTemplateOverrides(ctx context.Context) ([]model.TemplateOverride, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT tenant, realm, flow_id, node_name, template, updated_at
+		FROM template_overrides
+		ORDER BY tenant, realm, flow_id, node_name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list template overrides: %w", err)
+	}
+	defer rows.Close()
+
+	overrides, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[model.TemplateOverride])
+	if err != nil {
+		return nil, fmt.Errorf("failed to list template overrides: %w", err)
+	}
+
+	return overrides, nil
+}
+
+func (p *PostgresTemplateOverrideDB) DeleteTemplateOverride(ctx context.Context, tenant, realm, flowId, nodeName string) (bool, error) {
+	result, err := p.db.Exec(ctx, `
+		DELETE FROM template_overrides
+		WHERE tenant = $1 AND realm = $2 AND flow_id = $3 AND node_name = $4
+	`, tenant, realm, flowId, nodeName)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete template override: %w", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
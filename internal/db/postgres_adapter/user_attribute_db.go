@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/Identityplane/GoAM/internal/logger"
+	"github.com/Identityplane/GoAM/pkg/kms"
 	"github.com/Identityplane/GoAM/pkg/model"
 
 	"github.com/google/uuid"
@@ -43,7 +44,7 @@ func (p *PostgresUserAttributeDB) CreateUserAttribute(ctx context.Context, attri
 	attribute.UpdatedAt = now
 
 	// Convert value to JSONB - PostgreSQL will handle the JSON conversion natively
-	valueJSONB, err := json.Marshal(attribute.Value)
+	valueJSONB, err := kms.EncryptAttributeValue(ctx, &attribute)
 	if err != nil {
 		return fmt.Errorf("failed to marshal attribute value: %w", err)
 	}
@@ -87,7 +88,38 @@ func (p *PostgresUserAttributeDB) ListUserAttributes(ctx context.Context, tenant
 	// Initialize with empty slice instead of nil slice
 	attributes := make([]*model.UserAttribute, 0)
 	for rows.Next() {
-		attr, err := p.scanUserAttributeFromRow(rows)
+		attr, err := p.scanUserAttributeFromRow(ctx, rows)
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, attr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attributes, nil
+}
+
+func (p *PostgresUserAttributeDB) ListUserAttributesByType(ctx context.Context, tenant, realm, attributeType, afterID string, limit int) ([]*model.UserAttribute, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT id, user_id, tenant, realm, index_value, type, value,
+		       created_at, updated_at
+		FROM user_attributes 
+		WHERE tenant = $1 AND realm = $2 AND type = $3 AND id > $4
+		ORDER BY id
+		LIMIT $5
+	`, tenant, realm, attributeType, afterID, limit)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attributes := make([]*model.UserAttribute, 0)
+	for rows.Next() {
+		attr, err := p.scanUserAttributeFromRow(ctx, rows)
 		if err != nil {
 			return nil, err
 		}
@@ -109,14 +141,14 @@ func (p *PostgresUserAttributeDB) GetUserAttributeByID(ctx context.Context, tena
 		WHERE tenant = $1 AND realm = $2 AND id = $3
 	`, tenant, realm, attributeID)
 
-	return p.scanUserAttributeFromRow(row)
+	return p.scanUserAttributeFromRow(ctx, row)
 }
 
 func (p *PostgresUserAttributeDB) UpdateUserAttribute(ctx context.Context, attribute *model.UserAttribute) error {
 	attribute.UpdatedAt = time.Now()
 
 	// Convert value to JSONB
-	valueJSONB, err := json.Marshal(attribute.Value)
+	valueJSONB, err := kms.EncryptAttributeValue(ctx, attribute)
 	if err != nil {
 		return fmt.Errorf("failed to marshal attribute value: %w", err)
 	}
@@ -150,6 +182,43 @@ func (p *PostgresUserAttributeDB) UpdateUserAttribute(ctx context.Context, attri
 	return nil
 }
 
+func (p *PostgresUserAttributeDB) UpdateUserAttributeIfUnchanged(ctx context.Context, attribute *model.UserAttribute, lastUpdatedAt time.Time) (bool, error) {
+	// Postgres stores microseconds, truncate so that the returned attribute matches the stored one
+	updatedAt := time.Now().Truncate(time.Microsecond)
+
+	valueJSONB, err := kms.EncryptAttributeValue(ctx, attribute)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal attribute value: %w", err)
+	}
+
+	result, err := p.db.Exec(ctx, `
+		UPDATE user_attributes SET
+			index_value = $1,
+			type = $2,
+			value = $3,
+			updated_at = $4
+		WHERE tenant = $5 AND realm = $6 AND id = $7 AND updated_at = $8
+	`,
+		attribute.Index,
+		attribute.Type,
+		valueJSONB,
+		updatedAt,
+		attribute.Tenant,
+		attribute.Realm,
+		attribute.ID,
+		lastUpdatedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.RowsAffected() != 1 {
+		return false, nil
+	}
+
+	attribute.UpdatedAt = updatedAt
+	return true, nil
+}
+
 func (p *PostgresUserAttributeDB) DeleteUserAttribute(ctx context.Context, tenant, realm, attributeID string) error {
 	query := `
 		DELETE FROM user_attributes 
@@ -259,6 +328,12 @@ func (p *PostgresUserAttributeDB) GetUserWithAttributes(ctx context.Context, ten
 		if err := json.Unmarshal(userAttributesJSONB, &attributes); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal user attributes: %w", err)
 		}
+		for _, attribute := range attributes {
+			attribute.Value, err = kms.DecryptAttributeValue(ctx, attribute, attribute.Value)
+			if err != nil {
+				return nil, err
+			}
+		}
 		user.UserAttributes = attributes
 	} else {
 		user.UserAttributes = []*model.UserAttribute{}
@@ -338,6 +413,12 @@ func (p *PostgresUserAttributeDB) GetUserByAttributeIndexWithAttributes(ctx cont
 		if err := json.Unmarshal(userAttributesJSONB, &attributes); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal user attributes: %w", err)
 		}
+		for _, attribute := range attributes {
+			attribute.Value, err = kms.DecryptAttributeValue(ctx, attribute, attribute.Value)
+			if err != nil {
+				return nil, err
+			}
+		}
 		user.UserAttributes = attributes
 	} else {
 		user.UserAttributes = []*model.UserAttribute{}
@@ -422,7 +503,7 @@ func (p *PostgresUserAttributeDB) CreateUserWithAttributes(ctx context.Context,
 		attribute.UpdatedAt = now
 
 		// Convert value to JSONB - PostgreSQL will handle the JSON conversion natively
-		valueJSONB, err := json.Marshal(attribute.Value)
+		valueJSONB, err := kms.EncryptAttributeValue(ctx, attribute)
 		if err != nil {
 			return fmt.Errorf("failed to marshal attribute value: %w", err)
 		}
@@ -536,7 +617,7 @@ func (p *PostgresUserAttributeDB) UpdateUserWithAttributes(ctx context.Context,
 		if err == pgx.ErrNoRows {
 			// Attribute doesn't exist - create it
 			// Convert value to JSONB
-			valueJSONB, err := json.Marshal(attribute.Value)
+			valueJSONB, err := kms.EncryptAttributeValue(ctx, attribute)
 			if err != nil {
 				return fmt.Errorf("failed to marshal attribute value: %w", err)
 			}
@@ -601,7 +682,10 @@ func (p *PostgresUserAttributeDB) UpdateUserWithAttributes(ctx context.Context,
 			if existingValue != "" && existingValue != "null" {
 				var rawValue interface{}
 				if err := json.Unmarshal([]byte(existingValue), &rawValue); err == nil {
-					existingAttribute.Value = rawValue
+					existingAttribute.Value, err = kms.DecryptAttributeValue(ctx, existingAttribute, rawValue)
+					if err != nil {
+						return err
+					}
 				}
 			}
 
@@ -612,7 +696,7 @@ func (p *PostgresUserAttributeDB) UpdateUserWithAttributes(ctx context.Context,
 
 			// Something changed - update it using NOW() for the timestamp
 			// Convert value to JSONB
-			valueJSONB, err := json.Marshal(attribute.Value)
+			valueJSONB, err := kms.EncryptAttributeValue(ctx, attribute)
 			if err != nil {
 				return fmt.Errorf("failed to marshal attribute value: %w", err)
 			}
@@ -653,7 +737,7 @@ func (p *PostgresUserAttributeDB) UpdateUserWithAttributes(ctx context.Context,
 }
 
 // scanUserAttributeFromRow scans a user attribute from a database row
-func (p *PostgresUserAttributeDB) scanUserAttributeFromRow(scanner interface{}) (*model.UserAttribute, error) {
+func (p *PostgresUserAttributeDB) scanUserAttributeFromRow(ctx context.Context, scanner interface{}) (*model.UserAttribute, error) {
 	var attribute model.UserAttribute
 	var valueJSONB []byte
 	var createdAt, updatedAt time.Time
@@ -707,7 +791,11 @@ func (p *PostgresUserAttributeDB) scanUserAttributeFromRow(scanner interface{})
 		if err := json.Unmarshal(valueJSONB, &rawValue); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal attribute value: %w", err)
 		}
-		attribute.Value = rawValue
+
+		attribute.Value, err = kms.DecryptAttributeValue(ctx, &attribute, rawValue)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &attribute, nil
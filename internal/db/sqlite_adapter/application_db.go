@@ -91,13 +91,13 @@ func (s *SQLiteApplicationDB) CreateApplication(ctx context.Context, app model.A
 			description, allowed_scopes, allowed_grants, allowed_authentication_flows,
 			access_token_lifetime, refresh_token_lifetime, id_token_lifetime,
 			access_token_type, access_token_algorithm, access_token_mapping,
-			id_token_algorithm, id_token_mapping, redirect_uris, settings, created_at, updated_at
+			id_token_algorithm, id_token_mapping, redirect_uris, application_type, settings, created_at, updated_at
 		) VALUES (
 			:tenant, :realm, :client_id, :client_secret, :confidential, :consent_required,
 			:description, :allowed_scopes, :allowed_grants, :allowed_authentication_flows,
 			:access_token_lifetime, :refresh_token_lifetime, :id_token_lifetime,
 			:access_token_type, :access_token_algorithm, :access_token_mapping,
-			:id_token_algorithm, :id_token_mapping, :redirect_uris, :settings, :created_at, :updated_at
+			:id_token_algorithm, :id_token_mapping, :redirect_uris, :application_type, :settings, :created_at, :updated_at
 		)
 	`
 
@@ -133,7 +133,7 @@ func (s *SQLiteApplicationDB) GetApplication(ctx context.Context, tenant, realm,
 		       description, allowed_scopes, allowed_grants, allowed_authentication_flows,
 		       access_token_lifetime, refresh_token_lifetime, id_token_lifetime,
 		       access_token_type, access_token_algorithm, access_token_mapping,
-		       id_token_algorithm, id_token_mapping, redirect_uris, settings, created_at, updated_at
+		       id_token_algorithm, id_token_mapping, redirect_uris, application_type, settings, created_at, updated_at
 		FROM applications 
 		WHERE tenant = ? AND realm = ? AND client_id = ?
 	`
@@ -233,6 +233,7 @@ func (s *SQLiteApplicationDB) UpdateApplication(ctx context.Context, app *model.
 			id_token_algorithm = :id_token_algorithm,
 			id_token_mapping = :id_token_mapping,
 			redirect_uris = :redirect_uris,
+			application_type = :application_type,
 			settings = :settings,
 			updated_at = :updated_at
 		WHERE tenant = :tenant AND realm = :realm AND client_id = :client_id
@@ -271,7 +272,7 @@ func (s *SQLiteApplicationDB) ListApplications(ctx context.Context, tenant, real
 		       description, allowed_scopes, allowed_grants, allowed_authentication_flows,
 		       access_token_lifetime, refresh_token_lifetime, id_token_lifetime,
 		       access_token_type, access_token_algorithm, access_token_mapping,
-		       id_token_algorithm, id_token_mapping, redirect_uris, settings, created_at, updated_at
+		       id_token_algorithm, id_token_mapping, redirect_uris, application_type, settings, created_at, updated_at
 		FROM applications 
 		WHERE tenant = ? AND realm = ?
 	`
@@ -323,7 +324,7 @@ func (s *SQLiteApplicationDB) ListAllApplications(ctx context.Context) ([]model.
 		       description, allowed_scopes, allowed_grants, allowed_authentication_flows,
 		       access_token_lifetime, refresh_token_lifetime, id_token_lifetime,
 		       access_token_type, access_token_algorithm, access_token_mapping,
-		       id_token_algorithm, id_token_mapping, redirect_uris, settings, created_at, updated_at
+		       id_token_algorithm, id_token_mapping, redirect_uris, application_type, settings, created_at, updated_at
 		FROM applications
 	`
 
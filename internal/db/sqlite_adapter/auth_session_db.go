@@ -48,7 +48,8 @@ func (s *SQLiteAuthSessionDB) CreateOrUpdateAuthSession(ctx context.Context, ses
 				run_id = ?,
 				created_at = ?,
 				expires_at = ?,
-				session_information = ?
+				session_information = ?,
+				flow_id = ?
 			WHERE tenant = ? AND realm = ? AND session_id_hash = ?
 		`
 		_, err = s.db.ExecContext(ctx, query,
@@ -56,6 +57,7 @@ func (s *SQLiteAuthSessionDB) CreateOrUpdateAuthSession(ctx context.Context, ses
 			session.CreatedAt.Format(time.RFC3339),
 			session.ExpiresAt.Format(time.RFC3339),
 			session.SessionInformation,
+			session.FlowID,
 			session.Tenant,
 			session.Realm,
 			session.SessionIDHash,
@@ -68,8 +70,8 @@ func (s *SQLiteAuthSessionDB) CreateOrUpdateAuthSession(ctx context.Context, ses
 		query := `
 			INSERT INTO auth_sessions (
 				tenant, realm, run_id, session_id_hash,
-				created_at, expires_at, session_information
-			) VALUES (?, ?, ?, ?, ?, ?, ?)
+				created_at, expires_at, session_information, flow_id
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 		`
 		_, err = s.db.ExecContext(ctx, query,
 			session.Tenant,
@@ -79,6 +81,7 @@ func (s *SQLiteAuthSessionDB) CreateOrUpdateAuthSession(ctx context.Context, ses
 			session.CreatedAt.Format(time.RFC3339),
 			session.ExpiresAt.Format(time.RFC3339),
 			session.SessionInformation,
+			session.FlowID,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to create auth session: %w", err)
@@ -91,7 +94,7 @@ func (s *SQLiteAuthSessionDB) CreateOrUpdateAuthSession(ctx context.Context, ses
 func (s *SQLiteAuthSessionDB) GetAuthSessionByID(ctx context.Context, tenant, realm, runID string) (*model.PersistentAuthSession, error) {
 	query := `
 		SELECT tenant, realm, run_id, session_id_hash,
-		       created_at, expires_at, session_information
+		       created_at, expires_at, session_information, flow_id
 		FROM auth_sessions
 		WHERE tenant = ? AND realm = ? AND run_id = ?
 	`
@@ -107,6 +110,7 @@ func (s *SQLiteAuthSessionDB) GetAuthSessionByID(ctx context.Context, tenant, re
 		&createdAtStr,
 		&expiresAtStr,
 		&session.SessionInformation,
+		&session.FlowID,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -129,7 +133,7 @@ func (s *SQLiteAuthSessionDB) GetAuthSessionByID(ctx context.Context, tenant, re
 func (s *SQLiteAuthSessionDB) GetAuthSessionByHash(ctx context.Context, tenant, realm, sessionIDHash string) (*model.PersistentAuthSession, error) {
 	query := `
 		SELECT tenant, realm, run_id, session_id_hash,
-		       created_at, expires_at, session_information
+		       created_at, expires_at, session_information, flow_id
 		FROM auth_sessions
 		WHERE tenant = ? AND realm = ? AND session_id_hash = ?
 	`
@@ -145,6 +149,7 @@ func (s *SQLiteAuthSessionDB) GetAuthSessionByHash(ctx context.Context, tenant,
 		&createdAtStr,
 		&expiresAtStr,
 		&session.SessionInformation,
+		&session.FlowID,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -167,7 +172,7 @@ func (s *SQLiteAuthSessionDB) GetAuthSessionByHash(ctx context.Context, tenant,
 func (s *SQLiteAuthSessionDB) ListAuthSessions(ctx context.Context, tenant, realm string) ([]model.PersistentAuthSession, error) {
 	query := `
 		SELECT tenant, realm, run_id, session_id_hash,
-		       created_at, expires_at, session_information
+		       created_at, expires_at, session_information, flow_id
 		FROM auth_sessions
 		WHERE tenant = ? AND realm = ?
 	`
@@ -191,6 +196,7 @@ func (s *SQLiteAuthSessionDB) ListAuthSessions(ctx context.Context, tenant, real
 			&createdAtStr,
 			&expiresAtStr,
 			&session.SessionInformation,
+			&session.FlowID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan auth session: %w", err)
@@ -210,10 +216,60 @@ func (s *SQLiteAuthSessionDB) ListAuthSessions(ctx context.Context, tenant, real
 	return sessions, nil
 }
 
+func (s *SQLiteAuthSessionDB) ListAuthSessionsByFlow(ctx context.Context, tenant, realm, flowID string, since time.Time, limit int) ([]model.PersistentAuthSession, error) {
+	// The timestamps are stored with the offset of the server, datetime converts them to UTC for the comparison
+	query := `
+		SELECT tenant, realm, run_id, session_id_hash,
+		       created_at, expires_at, session_information, flow_id
+		FROM auth_sessions
+		WHERE tenant = ? AND realm = ? AND flow_id = ? AND datetime(created_at) >= datetime(?)
+		ORDER BY datetime(created_at) DESC
+		LIMIT ?
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, tenant, realm, flowID, since.Format(time.RFC3339), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list auth sessions of flow: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []model.PersistentAuthSession
+	for rows.Next() {
+		var session model.PersistentAuthSession
+		var createdAtStr, expiresAtStr string
+
+		err := rows.Scan(
+			&session.Tenant,
+			&session.Realm,
+			&session.RunID,
+			&session.SessionIDHash,
+			&createdAtStr,
+			&expiresAtStr,
+			&session.SessionInformation,
+			&session.FlowID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan auth session: %w", err)
+		}
+
+		// Parse timestamps
+		createdAt, _ := time.Parse(time.RFC3339, createdAtStr)
+		expiresAt, _ := time.Parse(time.RFC3339, expiresAtStr)
+
+		// Convert to local time to match PostgreSQL behavior
+		session.CreatedAt = createdAt.Local()
+		session.ExpiresAt = expiresAt.Local()
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
 func (s *SQLiteAuthSessionDB) ListAllAuthSessions(ctx context.Context, tenant string) ([]model.PersistentAuthSession, error) {
 	query := `
 		SELECT tenant, realm, run_id, session_id_hash,
-		       created_at, expires_at, session_information
+		       created_at, expires_at, session_information, flow_id
 		FROM auth_sessions
 		WHERE tenant = ?
 	`
@@ -237,6 +293,7 @@ func (s *SQLiteAuthSessionDB) ListAllAuthSessions(ctx context.Context, tenant st
 			&createdAtStr,
 			&expiresAtStr,
 			&session.SessionInformation,
+			&session.FlowID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan auth session: %w", err)
@@ -270,16 +327,70 @@ func (s *SQLiteAuthSessionDB) DeleteAuthSession(ctx context.Context, tenant, rea
 	return nil
 }
 
-func (s *SQLiteAuthSessionDB) DeleteExpiredAuthSessions(ctx context.Context, tenant, realm string) error {
+func (s *SQLiteAuthSessionDB) DeleteExpiredAuthSessions(ctx context.Context, tenant, realm string) (int, error) {
 	query := `
 		DELETE FROM auth_sessions
 		WHERE tenant = ? AND realm = ? AND expires_at < ?
 	`
 
-	_, err := s.db.ExecContext(ctx, query, tenant, realm, time.Now().Format(time.RFC3339))
+	result, err := s.db.ExecContext(ctx, query, tenant, realm, time.Now().Format(time.RFC3339))
 	if err != nil {
-		return fmt.Errorf("failed to delete expired auth sessions: %w", err)
+		return 0, fmt.Errorf("failed to delete expired auth sessions: %w", err)
 	}
 
-	return nil
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	result, err = s.db.ExecContext(ctx, `
+		DELETE FROM magic_link_approvals
+		WHERE tenant = ? AND realm = ? AND expires_at < ?
+	`, tenant, realm, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired magic link approvals: %w", err)
+	}
+
+	approvals, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return int(deleted + approvals), nil
+}
+
+func (s *SQLiteAuthSessionDB) SaveMagicLinkApproval(ctx context.Context, tenant, realm, sessionIDHash, linkID string, expiresAt time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO magic_link_approvals (tenant, realm, session_id_hash, link_id, approved_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (tenant, realm, session_id_hash, link_id) DO NOTHING
+	`, tenant, realm, sessionIDHash, linkID,
+		time.Now().UTC().Format(time.RFC3339), expiresAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, fmt.Errorf("failed to save magic link approval: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (s *SQLiteAuthSessionDB) ConsumeMagicLinkApproval(ctx context.Context, tenant, realm, sessionIDHash, linkID string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM magic_link_approvals
+		WHERE tenant = ? AND realm = ? AND session_id_hash = ? AND link_id = ? AND expires_at > ?
+	`, tenant, realm, sessionIDHash, linkID, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, fmt.Errorf("failed to consume magic link approval: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
 }
@@ -502,16 +502,21 @@ func (s *SQLiteClientSessionDB) DeleteClientSession(ctx context.Context, tenant,
 	return nil
 }
 
-func (s *SQLiteClientSessionDB) DeleteExpiredClientSessions(ctx context.Context, tenant, realm string) error {
+func (s *SQLiteClientSessionDB) DeleteExpiredClientSessions(ctx context.Context, tenant, realm string) (int, error) {
 	query := `
 		DELETE FROM client_sessions
 		WHERE tenant = ? AND realm = ? AND expire < ?
 	`
 
-	_, err := s.db.ExecContext(ctx, query, tenant, realm, time.Now().Format(time.RFC3339))
+	result, err := s.db.ExecContext(ctx, query, tenant, realm, time.Now().Format(time.RFC3339))
 	if err != nil {
-		return fmt.Errorf("failed to delete expired client sessions: %w", err)
+		return 0, fmt.Errorf("failed to delete expired client sessions: %w", err)
 	}
 
-	return nil
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return int(deleted), nil
 }
@@ -0,0 +1,113 @@
+package sqlite_adapter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// configChangePollInterval is how often the change log is polled as SQLite has no notification mechanism
+var configChangePollInterval = 1 * time.Second
+
+// SQLiteConfigChangeDB implements the ConfigChangeDB interface using SQLite
+type SQLiteConfigChangeDB struct {
+	db *sqlx.DB
+}
+
+// NewConfigChangeDB creates a new SQLiteConfigChangeDB instance
+func NewConfigChangeDB(db *sql.DB) (*SQLiteConfigChangeDB, error) {
+	sqlxDB := sqlx.NewDb(db, "sqlite3")
+
+	// Check if the connection works and config_changes table exists by executing a query
+	_, err := sqlxDB.Exec(`SELECT 1 FROM config_changes LIMIT 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if config_changes table exists: %w", err)
+	}
+
+	return &SQLiteConfigChangeDB{db: sqlxDB}, nil
+}
+
+func (s *SQLiteConfigChangeDB) CreateConfigChange(ctx context.Context, change *model.ConfigChange) error {
+	change.CreatedAt = time.Now()
+
+	result, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO config_changes (tenant, realm, entity_type, entity_id, created_at)
+		VALUES (:tenant, :realm, :entity_type, :entity_id, :created_at)
+	`, change)
+	if err != nil {
+		return fmt.Errorf("failed to create config change: %w", err)
+	}
+
+	change.Version, err = result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get config change version: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteConfigChangeDB) ListConfigChangesSince(ctx context.Context, version int64) ([]model.ConfigChange, error) {
+	var changes []model.ConfigChange
+
+	err := s.db.SelectContext(ctx, &changes, `
+		SELECT version, tenant, realm, entity_type, entity_id, created_at
+		FROM config_changes
+		WHERE version > ?
+		ORDER BY version
+	`, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list config changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+func (s *SQLiteConfigChangeDB) GetLatestConfigVersion(ctx context.Context) (int64, error) {
+	var version int64
+
+	err := s.db.GetContext(ctx, &version, `SELECT COALESCE(MAX(version), 0) FROM config_changes`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest config version: %w", err)
+	}
+
+	return version, nil
+}
+
+// WatchConfigChanges polls the latest version and notifies whenever it changed since the last poll
+func (s *SQLiteConfigChangeDB) WatchConfigChanges(ctx context.Context, notify func()) error {
+
+	lastVersion, err := s.GetLatestConfigVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(configChangePollInterval)
+	defer ticker.Stop()
+
+	// Catch up on changes that were made before the watch started
+	notify()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			version, err := s.GetLatestConfigVersion(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+
+			if version != lastVersion {
+				lastVersion = version
+				notify()
+			}
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package sqlite_adapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigChangeDB(t *testing.T) {
+	sqldb := setupTestDB(t)
+	configChangeDB, err := NewConfigChangeDB(sqldb)
+	require.NoError(t, err)
+
+	configChangePollInterval = 50 * time.Millisecond
+
+	db.TemplateTestConfigChangeDB(t, configChangeDB)
+}
@@ -0,0 +1,67 @@
+package sqlite_adapter
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/kms"
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptionAtRest(t *testing.T) {
+	ctx := context.Background()
+	sqldb := setupTestDB(t)
+
+	provider, err := kms.NewLocalKeyProvider("test:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))))
+	require.NoError(t, err)
+	kms.SetKeyProvider(provider)
+	t.Cleanup(func() { kms.SetKeyProvider(nil) })
+
+	t.Run("signing keys", func(t *testing.T) {
+		signingKeyDB, err := NewSigningKeyDB(sqldb)
+		require.NoError(t, err)
+
+		err = signingKeyDB.CreateSigningKey(ctx, model.SigningKey{
+			Tenant: "acme", Realm: "customers", Kid: "kid-1", Active: true, Algorithm: "EC256",
+			Implementation: kms.PlainImplementation, SigningKeyMaterial: "private-key", PublicKeyJWK: "{}", Created: time.Now(),
+		})
+		require.NoError(t, err)
+
+		var stored string
+		require.NoError(t, sqldb.QueryRow(`SELECT signing_key_material FROM signing_keys WHERE kid = 'kid-1'`).Scan(&stored))
+		assert.True(t, kms.IsEncrypted(stored))
+
+		key, err := signingKeyDB.GetSigningKey(ctx, "acme", "customers", "kid-1")
+		require.NoError(t, err)
+		assert.Equal(t, "private-key", key.SigningKeyMaterial)
+		assert.Equal(t, kms.LocalKeyProviderName, key.Implementation)
+	})
+
+	t.Run("sensitive attribute fields", func(t *testing.T) {
+		attributeDB, err := NewUserAttributeDB(sqldb)
+		require.NoError(t, err)
+
+		user := &model.User{ID: "user-1", Tenant: "acme", Realm: "customers", Status: "active"}
+		user.AddAttribute(&model.UserAttribute{
+			Type:  model.AttributeTypeTOTP,
+			Value: model.TOTPAttributeValue{SecretKey: "JBSWY3DPEHPK3PXP"},
+		})
+		require.NoError(t, attributeDB.CreateUserWithAttributes(ctx, user))
+
+		var stored string
+		require.NoError(t, sqldb.QueryRow(`SELECT value FROM user_attributes WHERE user_id = 'user-1'`).Scan(&stored))
+		assert.NotContains(t, stored, "JBSWY3DPEHPK3PXP")
+
+		loaded, err := attributeDB.GetUserWithAttributes(ctx, "acme", "customers", "user-1")
+		require.NoError(t, err)
+		totp, _, err := model.GetAttribute[model.TOTPAttributeValue](loaded, model.AttributeTypeTOTP)
+		require.NoError(t, err)
+		assert.Equal(t, "JBSWY3DPEHPK3PXP", totp.SecretKey)
+	})
+}
@@ -38,10 +38,10 @@ func (s *SQLiteFlowDB) CreateFlow(ctx context.Context, flow model.Flow) error {
 	_, err := s.db.NamedExecContext(ctx, `
 		INSERT INTO flows (
 			tenant, realm, id, route, active, debug_allowed, definition_yaml,
-			created_at, updated_at
+			active_version, variants, created_at, updated_at
 		) VALUES (
 			:tenant, :realm, :id, :route, :active, :debug_allowed, :definition_yaml,
-			:created_at, :updated_at
+			:active_version, :variants, :created_at, :updated_at
 		)
 	`, flow)
 
@@ -96,6 +96,8 @@ func (s *SQLiteFlowDB) UpdateFlow(ctx context.Context, flow *model.Flow) error {
 			active = :active,
 			debug_allowed = :debug_allowed,
 			definition_yaml = :definition_yaml,
+			active_version = :active_version,
+			variants = :variants,
 			updated_at = :updated_at
 		WHERE tenant = :tenant AND realm = :realm AND id = :id
 	`, flow)
@@ -0,0 +1,90 @@
+package sqlite_adapter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLiteFlowStatsDB implements the FlowStatsDB interface using SQLite.
+// Buckets are stored in UTC so that they can be compared in queries.
+type SQLiteFlowStatsDB struct {
+	db *sqlx.DB
+}
+
+// NewFlowStatsDB creates a new SQLiteFlowStatsDB instance
+func NewFlowStatsDB(db *sql.DB) (*SQLiteFlowStatsDB, error) {
+	sqlxDB := sqlx.NewDb(db, "sqlite3")
+
+	// Check if the connection works and flow_stats table exists by executing a query
+	_, err := sqlxDB.Exec(`SELECT 1 FROM flow_stats LIMIT 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if flow_stats table exists: %w", err)
+	}
+
+	return &SQLiteFlowStatsDB{db: sqlxDB}, nil
+}
+
+func (s *SQLiteFlowStatsDB) IncrementFlowStats(ctx context.Context, stats []*model.FlowStat) error {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, stat := range stats {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO flow_stats (tenant, realm, flow_id, client_id, bucket, node, metric, value)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (tenant, realm, flow_id, client_id, bucket, node, metric) DO UPDATE SET value = value + excluded.value
+		`, stat.Tenant, stat.Realm, stat.FlowId, stat.ClientId, stat.Bucket.UTC(), stat.Node, stat.Metric, stat.Value)
+		if err != nil {
+			return fmt.Errorf("failed to increment flow stats: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteFlowStatsDB) ListFlowStats(ctx context.Context, tenant, realm string, filter model.FlowStatsFilter) ([]*model.FlowStat, error) {
+	conditions := []string{"tenant = ?", "realm = ?"}
+	args := []any{tenant, realm}
+
+	if filter.FlowId != "" {
+		conditions = append(conditions, "flow_id = ?")
+		args = append(args, filter.FlowId)
+	}
+	if filter.ClientId != "" {
+		conditions = append(conditions, "client_id = ?")
+		args = append(args, filter.ClientId)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "bucket >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "bucket < ?")
+		args = append(args, filter.To.UTC())
+	}
+
+	stats := []*model.FlowStat{}
+	err := s.db.SelectContext(ctx, &stats, `
+		SELECT tenant, realm, flow_id, client_id, bucket, node, metric, value
+		FROM flow_stats
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY bucket, flow_id, client_id, node, metric
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list flow stats: %w", err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,17 @@
+package sqlite_adapter
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowStatsDB(t *testing.T) {
+	sqldb := setupTestDB(t)
+	flowStatsDB, err := NewFlowStatsDB(sqldb)
+	require.NoError(t, err)
+
+	db.TemplateTestFlowStatsDB(t, flowStatsDB)
+}
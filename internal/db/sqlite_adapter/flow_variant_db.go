@@ -0,0 +1,155 @@
+package sqlite_adapter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLiteFlowVariantDB implements the FlowVariantDB interface using SQLite
+type SQLiteFlowVariantDB struct {
+	db *sqlx.DB
+}
+
+// NewFlowVariantDB creates a new SQLiteFlowVariantDB instance
+func NewFlowVariantDB(db *sql.DB) (*SQLiteFlowVariantDB, error) {
+	sqlxDB := sqlx.NewDb(db, "sqlite3")
+
+	// Check if the connection works and the flow variant tables exist by executing a query
+	_, err := sqlxDB.Exec(`SELECT 1 FROM flow_variant_assignments LIMIT 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if flow_variant_assignments table exists: %w", err)
+	}
+
+	_, err = sqlxDB.Exec(`SELECT 1 FROM flow_variant_sessions LIMIT 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if flow_variant_sessions table exists: %w", err)
+	}
+
+	return &SQLiteFlowVariantDB{db: sqlxDB}, nil
+}
+
+func (s *SQLiteFlowVariantDB) GetFlowVariantAssignment(ctx context.Context, tenant, realm, flowId, stickyKey string) (*model.FlowVariantAssignment, error) {
+	var assignment model.FlowVariantAssignment
+
+	err := s.db.GetContext(ctx, &assignment, `
+		SELECT tenant, realm, flow_id, sticky_key, variant, created_at
+		FROM flow_variant_assignments
+		WHERE tenant = ? AND realm = ? AND flow_id = ? AND sticky_key = ?
+	`, tenant, realm, flowId, stickyKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // not found
+		}
+		return nil, fmt.Errorf("failed to get flow variant assignment: %w", err)
+	}
+
+	return &assignment, nil
+}
+
+func (s *SQLiteFlowVariantDB) SaveFlowVariantAssignment(ctx context.Context, assignment *model.FlowVariantAssignment) error {
+	assignment.CreatedAt = time.Now().UTC()
+
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO flow_variant_assignments (tenant, realm, flow_id, sticky_key, variant, created_at)
+		VALUES (:tenant, :realm, :flow_id, :sticky_key, :variant, :created_at)
+		ON CONFLICT (tenant, realm, flow_id, sticky_key) DO UPDATE SET variant = excluded.variant, created_at = excluded.created_at
+	`, assignment)
+	if err != nil {
+		return fmt.Errorf("failed to save flow variant assignment: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteFlowVariantDB) CreateFlowVariantSession(ctx context.Context, session *model.FlowVariantSession) error {
+	session.CreatedAt = time.Now().UTC()
+	session.Result = ""
+	session.FinishedAt = nil
+
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO flow_variant_sessions (tenant, realm, flow_id, run_id, variant, version, result, created_at, finished_at)
+		VALUES (:tenant, :realm, :flow_id, :run_id, :variant, :version, :result, :created_at, :finished_at)
+	`, session)
+	if err != nil {
+		return fmt.Errorf("failed to create flow variant session: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteFlowVariantDB) GetFlowVariantSession(ctx context.Context, tenant, realm, runId string) (*model.FlowVariantSession, error) {
+	var session model.FlowVariantSession
+
+	err := s.db.GetContext(ctx, &session, `
+		SELECT tenant, realm, flow_id, run_id, variant, version, result, created_at, finished_at
+		FROM flow_variant_sessions
+		WHERE tenant = ? AND realm = ? AND run_id = ?
+	`, tenant, realm, runId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // not found
+		}
+		return nil, fmt.Errorf("failed to get flow variant session: %w", err)
+	}
+
+	return &session, nil
+}
+
+func (s *SQLiteFlowVariantDB) FinishFlowVariantSession(ctx context.Context, tenant, realm, runId, result string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE flow_variant_sessions SET result = ?, finished_at = ?
+		WHERE tenant = ? AND realm = ? AND run_id = ? AND result = ''
+	`, result, time.Now().UTC(), tenant, realm, runId)
+	if err != nil {
+		return false, fmt.Errorf("failed to finish flow variant session: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (s *SQLiteFlowVariantDB) CountFlowVariantSessions(ctx context.Context, tenant, realm, flowId string) ([]model.FlowVariantCount, error) {
+	counts := []model.FlowVariantCount{}
+
+	err := s.db.SelectContext(ctx, &counts, `
+		SELECT variant,
+			COUNT(*) AS started,
+			COALESCE(SUM(CASE WHEN result = ? THEN 1 ELSE 0 END), 0) AS succeeded,
+			COALESCE(SUM(CASE WHEN result = ? THEN 1 ELSE 0 END), 0) AS failed
+		FROM flow_variant_sessions
+		WHERE tenant = ? AND realm = ? AND flow_id = ?
+		GROUP BY variant
+		ORDER BY variant
+	`, model.FlowVariantResultSucceeded, model.FlowVariantResultFailed, tenant, realm, flowId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count flow variant sessions: %w", err)
+	}
+
+	return counts, nil
+}
+
+func (s *SQLiteFlowVariantDB) DeleteFlowVariants(ctx context.Context, tenant, realm, flowId string) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM flow_variant_assignments
+		WHERE tenant = ? AND realm = ? AND flow_id = ?
+	`, tenant, realm, flowId)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		DELETE FROM flow_variant_sessions
+		WHERE tenant = ? AND realm = ? AND flow_id = ?
+	`, tenant, realm, flowId)
+	return err
+}
@@ -0,0 +1,17 @@
+package sqlite_adapter
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowVariantDB(t *testing.T) {
+	sqldb := setupTestDB(t)
+	flowVariantDB, err := NewFlowVariantDB(sqldb)
+	require.NoError(t, err)
+
+	db.TemplateTestFlowVariantDB(t, flowVariantDB)
+}
@@ -0,0 +1,127 @@
+package sqlite_adapter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLiteFlowVersionDB implements the FlowVersionDB interface using SQLite
+type SQLiteFlowVersionDB struct {
+	db *sqlx.DB
+}
+
+// NewFlowVersionDB creates a new SQLiteFlowVersionDB instance
+func NewFlowVersionDB(db *sql.DB) (*SQLiteFlowVersionDB, error) {
+	sqlxDB := sqlx.NewDb(db, "sqlite3")
+
+	// Check if the connection works and flow_versions table exists by executing a query
+	_, err := sqlxDB.Exec(`SELECT 1 FROM flow_versions LIMIT 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if flow_versions table exists: %w", err)
+	}
+
+	return &SQLiteFlowVersionDB{db: sqlxDB}, nil
+}
+
+func (s *SQLiteFlowVersionDB) CreateFlowVersion(ctx context.Context, version *model.FlowVersion) error {
+	version.CreatedAt = time.Now()
+
+	// The next version number is determined within the insert, concurrent inserts for the same
+	// version fail on the primary key instead of overwriting each other
+	err := s.db.QueryRowxContext(ctx, `
+		INSERT INTO flow_versions (tenant, realm, flow_id, version, definition_yaml, comment, created_at)
+		SELECT ?, ?, ?, COALESCE(MAX(version), 0) + 1, ?, ?, ?
+		FROM flow_versions
+		WHERE tenant = ? AND realm = ? AND flow_id = ?
+		RETURNING version
+	`,
+		version.Tenant, version.Realm, version.FlowId,
+		version.DefinitionYaml, version.Comment, version.CreatedAt,
+		version.Tenant, version.Realm, version.FlowId,
+	).Scan(&version.Version)
+	if err != nil {
+		return fmt.Errorf("failed to create flow version: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteFlowVersionDB) GetFlowVersion(ctx context.Context, tenant, realm, flowId string, version int) (*model.FlowVersion, error) {
+	var flowVersion model.FlowVersion
+
+	err := s.db.GetContext(ctx, &flowVersion, `
+		SELECT tenant, realm, flow_id, version, definition_yaml, comment, created_at
+		FROM flow_versions
+		WHERE tenant = ? AND realm = ? AND flow_id = ? AND version = ?
+	`, tenant, realm, flowId, version)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // not found
+		}
+		return nil, err
+	}
+
+	return &flowVersion, nil
+}
+
+func (s *SQLiteFlowVersionDB) ListFlowVersions(ctx context.Context, tenant, realm, flowId string) ([]model.FlowVersion, error) {
+	var versions []model.FlowVersion
+
+	err := s.db.SelectContext(ctx, &versions, `
+		SELECT tenant, realm, flow_id, version, definition_yaml, comment, created_at
+		FROM flow_versions
+		WHERE tenant = ? AND realm = ? AND flow_id = ?
+		ORDER BY version DESC
+	`, tenant, realm, flowId)
+
+	return versions, err
+}
+
+func (s *SQLiteFlowVersionDB) DeleteFlowVersions(ctx context.Context, tenant, realm, flowId string) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM flow_versions
+		WHERE tenant = ? AND realm = ? AND flow_id = ?
+	`, tenant, realm, flowId)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		DELETE FROM flow_publications
+		WHERE tenant = ? AND realm = ? AND flow_id = ?
+	`, tenant, realm, flowId)
+	return err
+}
+
+func (s *SQLiteFlowVersionDB) CreateFlowPublication(ctx context.Context, publication *model.FlowPublication) error {
+	publication.PublishedAt = time.Now()
+
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO flow_publications (tenant, realm, flow_id, version, previous_version, published_at)
+		VALUES (:tenant, :realm, :flow_id, :version, :previous_version, :published_at)
+	`, publication)
+	if err != nil {
+		return fmt.Errorf("failed to create flow publication: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteFlowVersionDB) ListFlowPublications(ctx context.Context, tenant, realm, flowId string) ([]model.FlowPublication, error) {
+	var publications []model.FlowPublication
+
+	err := s.db.SelectContext(ctx, &publications, `
+		SELECT tenant, realm, flow_id, version, previous_version, published_at
+		FROM flow_publications
+		WHERE tenant = ? AND realm = ? AND flow_id = ?
+		ORDER BY id DESC
+	`, tenant, realm, flowId)
+
+	return publications, err
+}
@@ -0,0 +1,17 @@
+package sqlite_adapter
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowVersionDB(t *testing.T) {
+	sqldb := setupTestDB(t)
+	flowVersionDB, err := NewFlowVersionDB(sqldb)
+	require.NoError(t, err)
+
+	db.TemplateTestFlowVersionDB(t, flowVersionDB)
+}
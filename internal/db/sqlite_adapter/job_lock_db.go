@@ -0,0 +1,37 @@
+package sqlite_adapter
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// SQLiteJobLockDB implements the JobLockDB interface for SQLite. As a SQLite database is only
+// used by a single instance the locks are kept in memory.
+type SQLiteJobLockDB struct {
+	mu    sync.Mutex
+	locks map[string]bool
+}
+
+// NewJobLockDB creates a new SQLiteJobLockDB instance
+func NewJobLockDB(db *sql.DB) (*SQLiteJobLockDB, error) {
+	return &SQLiteJobLockDB{locks: map[string]bool{}}, nil
+}
+
+func (s *SQLiteJobLockDB) RunWithLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	s.mu.Lock()
+	if s.locks[name] {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.locks[name] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.locks, name)
+		s.mu.Unlock()
+	}()
+
+	return true, fn(ctx)
+}
@@ -0,0 +1,17 @@
+package sqlite_adapter
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobLockDB(t *testing.T) {
+	sqldb := setupTestDB(t)
+	jobLockDB, err := NewJobLockDB(sqldb)
+	require.NoError(t, err)
+
+	db.TemplateTestJobLockDB(t, jobLockDB)
+}
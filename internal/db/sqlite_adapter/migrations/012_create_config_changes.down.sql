@@ -0,0 +1,3 @@
+-- migrations/012_create_config_changes.down.sql
+
+DROP TABLE IF EXISTS config_changes;
@@ -0,0 +1,10 @@
+-- migrations/012_create_config_changes.up.sql
+
+CREATE TABLE IF NOT EXISTS config_changes (
+    version INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT NOT NULL,
+    realm TEXT NOT NULL,
+    entity_type TEXT NOT NULL,
+    entity_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
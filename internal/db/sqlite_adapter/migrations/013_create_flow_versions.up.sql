@@ -0,0 +1,14 @@
+-- migrations/013_create_flow_versions.up.sql
+
+CREATE TABLE IF NOT EXISTS flow_versions (
+    tenant TEXT NOT NULL,
+    realm TEXT NOT NULL,
+    flow_id TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    definition_yaml TEXT NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (tenant, realm, flow_id, version)
+);
+
+ALTER TABLE flows ADD COLUMN active_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- migrations/015_create_password_reset_tokens.down.sql
+
+DROP TABLE IF EXISTS password_reset_tokens;
@@ -0,0 +1,20 @@
+-- migrations/015_create_password_reset_tokens.up.sql
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id TEXT NOT NULL,
+    tenant TEXT NOT NULL,
+    realm TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    user_id TEXT NOT NULL DEFAULT '',
+    identifier_hash TEXT NOT NULL DEFAULT '',
+    request_ip TEXT NOT NULL DEFAULT '',
+    channel TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    PRIMARY KEY (tenant, realm, id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_reset_tokens_hash ON password_reset_tokens(tenant, realm, token_hash);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_identifier ON password_reset_tokens(tenant, realm, identifier_hash, created_at);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_ip ON password_reset_tokens(tenant, realm, request_ip, created_at);
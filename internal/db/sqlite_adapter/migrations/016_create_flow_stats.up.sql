@@ -0,0 +1,15 @@
+-- migrations/016_create_flow_stats.up.sql
+
+CREATE TABLE IF NOT EXISTS flow_stats (
+    tenant TEXT NOT NULL,
+    realm TEXT NOT NULL,
+    flow_id TEXT NOT NULL,
+    client_id TEXT NOT NULL DEFAULT '',
+    bucket TIMESTAMP NOT NULL,
+    node TEXT NOT NULL DEFAULT '',
+    metric TEXT NOT NULL,
+    value INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant, realm, flow_id, client_id, bucket, node, metric)
+);
+
+CREATE INDEX IF NOT EXISTS idx_flow_stats_bucket ON flow_stats(tenant, realm, bucket);
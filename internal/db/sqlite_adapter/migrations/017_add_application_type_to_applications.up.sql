@@ -0,0 +1,4 @@
+-- migrations/017_add_application_type_to_applications.up.sql
+
+-- Protocol of the application, existing applications are oauth2 clients
+ALTER TABLE applications ADD COLUMN application_type TEXT NOT NULL DEFAULT 'oauth2';
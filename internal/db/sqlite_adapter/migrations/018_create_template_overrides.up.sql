@@ -0,0 +1,11 @@
+-- migrations/018_create_template_overrides.up.sql
+
+CREATE TABLE IF NOT EXISTS template_overrides (
+    tenant TEXT NOT NULL,
+    realm TEXT NOT NULL,
+    flow_id TEXT NOT NULL,
+    node_name TEXT NOT NULL,
+    template TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (tenant, realm, flow_id, node_name)
+);
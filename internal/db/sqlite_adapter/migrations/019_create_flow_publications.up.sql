@@ -0,0 +1,13 @@
+-- migrations/019_create_flow_publications.up.sql
+
+CREATE TABLE IF NOT EXISTS flow_publications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT NOT NULL,
+    realm TEXT NOT NULL,
+    flow_id TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    previous_version INTEGER NOT NULL DEFAULT 0,
+    published_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_flow_publications_flow ON flow_publications(tenant, realm, flow_id, id);
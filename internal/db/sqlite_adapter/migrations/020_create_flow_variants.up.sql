@@ -0,0 +1,28 @@
+-- migrations/020_create_flow_variants.up.sql
+
+-- Variant a device was assigned to the first time it started a flow
+CREATE TABLE IF NOT EXISTS flow_variant_assignments (
+    tenant TEXT NOT NULL,
+    realm TEXT NOT NULL,
+    flow_id TEXT NOT NULL,
+    sticky_key TEXT NOT NULL,
+    variant TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (tenant, realm, flow_id, sticky_key)
+);
+
+-- Audit record of every session that ran on a variant and its result
+CREATE TABLE IF NOT EXISTS flow_variant_sessions (
+    tenant TEXT NOT NULL,
+    realm TEXT NOT NULL,
+    flow_id TEXT NOT NULL,
+    run_id TEXT NOT NULL,
+    variant TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    result TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP,
+    PRIMARY KEY (tenant, realm, run_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_flow_variant_sessions_flow ON flow_variant_sessions(tenant, realm, flow_id, variant);
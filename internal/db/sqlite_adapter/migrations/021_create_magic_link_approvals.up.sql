@@ -0,0 +1,11 @@
+-- migrations/021_create_magic_link_approvals.up.sql
+
+CREATE TABLE IF NOT EXISTS magic_link_approvals (
+    tenant TEXT NOT NULL,
+    realm TEXT NOT NULL,
+    session_id_hash TEXT NOT NULL,
+    link_id TEXT NOT NULL,
+    approved_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (tenant, realm, session_id_hash, link_id)
+);
@@ -0,0 +1,5 @@
+-- migrations/022_add_flow_id_to_auth_sessions.down.sql
+
+DROP INDEX IF EXISTS idx_auth_sessions_flow;
+
+ALTER TABLE auth_sessions DROP COLUMN flow_id;
@@ -0,0 +1,7 @@
+-- migrations/022_add_flow_id_to_auth_sessions.up.sql
+
+-- Flow of the session, so that the sessions of a flow can be listed without reading all sessions of the realm.
+-- Sessions saved before the migration have an empty flow id until they are saved again.
+ALTER TABLE auth_sessions ADD COLUMN flow_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_auth_sessions_flow ON auth_sessions(tenant, realm, flow_id, created_at);
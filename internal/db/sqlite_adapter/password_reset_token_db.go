@@ -0,0 +1,126 @@
+package sqlite_adapter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLitePasswordResetTokenDB implements the PasswordResetTokenDB interface using SQLite.
+// Timestamps are stored in UTC so that they can be compared in queries.
+type SQLitePasswordResetTokenDB struct {
+	db *sqlx.DB
+}
+
+// NewPasswordResetTokenDB creates a new SQLitePasswordResetTokenDB instance
+func NewPasswordResetTokenDB(db *sql.DB) (*SQLitePasswordResetTokenDB, error) {
+	sqlxDB := sqlx.NewDb(db, "sqlite3")
+
+	// Check if the connection works and password_reset_tokens table exists by executing a query
+	_, err := sqlxDB.Exec(`SELECT 1 FROM password_reset_tokens LIMIT 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if password_reset_tokens table exists: %w", err)
+	}
+
+	return &SQLitePasswordResetTokenDB{db: sqlxDB}, nil
+}
+
+func (s *SQLitePasswordResetTokenDB) CreatePasswordResetToken(ctx context.Context, token *model.PasswordResetToken) error {
+	token.CreatedAt = time.Now().UTC()
+	token.ExpiresAt = token.ExpiresAt.UTC()
+
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO password_reset_tokens (id, tenant, realm, token_hash, user_id, identifier_hash, request_ip, channel, created_at, expires_at, used_at)
+		VALUES (:id, :tenant, :realm, :token_hash, :user_id, :identifier_hash, :request_ip, :channel, :created_at, :expires_at, :used_at)
+	`, token)
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLitePasswordResetTokenDB) GetPasswordResetTokenByHash(ctx context.Context, tenant, realm, tokenHash string) (*model.PasswordResetToken, error) {
+	var token model.PasswordResetToken
+
+	err := s.db.GetContext(ctx, &token, `
+		SELECT id, tenant, realm, token_hash, user_id, identifier_hash, request_ip, channel, created_at, expires_at, used_at
+		FROM password_reset_tokens
+		WHERE tenant = ? AND realm = ? AND token_hash = ?
+	`, tenant, realm, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // not found
+		}
+		return nil, fmt.Errorf("failed to get password reset token: %w", err)
+	}
+
+	return &token, nil
+}
+
+func (s *SQLitePasswordResetTokenDB) MarkPasswordResetTokenUsed(ctx context.Context, tenant, realm, tokenHash string, usedAt time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE password_reset_tokens SET used_at = ?
+		WHERE tenant = ? AND realm = ? AND token_hash = ? AND used_at IS NULL
+	`, usedAt.UTC(), tenant, realm, tokenHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark password reset token as used: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (s *SQLitePasswordResetTokenDB) CountPasswordResetTokensByIdentifier(ctx context.Context, tenant, realm, identifierHash string, since time.Time) (int, error) {
+	var count int
+
+	err := s.db.GetContext(ctx, &count, `
+		SELECT COUNT(*) FROM password_reset_tokens
+		WHERE tenant = ? AND realm = ? AND identifier_hash = ? AND created_at >= ?
+	`, tenant, realm, identifierHash, since.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to count password reset tokens: %w", err)
+	}
+
+	return count, nil
+}
+
+func (s *SQLitePasswordResetTokenDB) CountPasswordResetTokensByIP(ctx context.Context, tenant, realm, requestIP string, since time.Time) (int, error) {
+	var count int
+
+	err := s.db.GetContext(ctx, &count, `
+		SELECT COUNT(*) FROM password_reset_tokens
+		WHERE tenant = ? AND realm = ? AND request_ip = ? AND created_at >= ?
+	`, tenant, realm, requestIP, since.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to count password reset tokens: %w", err)
+	}
+
+	return count, nil
+}
+
+func (s *SQLitePasswordResetTokenDB) DeleteExpiredPasswordResetTokens(ctx context.Context, tenant, realm string, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM password_reset_tokens
+		WHERE tenant = ? AND realm = ? AND expires_at < ?
+	`, tenant, realm, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired password reset tokens: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(affected), nil
+}
@@ -0,0 +1,17 @@
+package sqlite_adapter
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordResetTokenDB(t *testing.T) {
+	sqldb := setupTestDB(t)
+	passwordResetTokenDB, err := NewPasswordResetTokenDB(sqldb)
+	require.NoError(t, err)
+
+	db.TemplateTestPasswordResetTokenDB(t, passwordResetTokenDB)
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/Identityplane/GoAM/internal/logger"
+	"github.com/Identityplane/GoAM/pkg/kms"
 	"github.com/Identityplane/GoAM/pkg/model"
 )
 
@@ -28,6 +29,11 @@ func NewSigningKeyDB(db *sql.DB) (*SQLiteSigningKeyDB, error) {
 }
 
 func (s *SQLiteSigningKeyDB) CreateSigningKey(ctx context.Context, key model.SigningKey) error {
+	key, err := kms.EncryptSigningKey(ctx, key)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		INSERT INTO signing_keys (
 			tenant, realm, kid, active, algorithm, implementation,
@@ -35,7 +41,7 @@ func (s *SQLiteSigningKeyDB) CreateSigningKey(ctx context.Context, key model.Sig
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := s.db.ExecContext(ctx, query,
+	_, err = s.db.ExecContext(ctx, query,
 		key.Tenant, key.Realm, key.Kid, key.Active, key.Algorithm,
 		key.Implementation, key.SigningKeyMaterial, key.PublicKeyJWK,
 		key.Created,
@@ -73,6 +79,10 @@ func (s *SQLiteSigningKeyDB) GetSigningKey(ctx context.Context, tenant, realm, k
 		key.Disabled = &disabled.Time
 	}
 
+	if err := kms.DecryptSigningKey(ctx, &key); err != nil {
+		return nil, err
+	}
+
 	return &key, nil
 }
 
@@ -84,9 +94,14 @@ func (s *SQLiteSigningKeyDB) UpdateSigningKey(ctx context.Context, key *model.Si
 		WHERE tenant = ? AND realm = ? AND kid = ?
 	`
 
+	encrypted, err := kms.EncryptSigningKey(ctx, *key)
+	if err != nil {
+		return err
+	}
+
 	result, err := s.db.ExecContext(ctx, query,
-		key.Active, key.Algorithm, key.Implementation,
-		key.SigningKeyMaterial, key.PublicKeyJWK,
+		key.Active, key.Algorithm, encrypted.Implementation,
+		encrypted.SigningKeyMaterial, key.PublicKeyJWK,
 		key.Tenant, key.Realm, key.Kid,
 	)
 	if err != nil {
@@ -135,6 +150,10 @@ func (s *SQLiteSigningKeyDB) ListSigningKeys(ctx context.Context, tenant, realm
 			key.Disabled = &disabled.Time
 		}
 
+		if err := kms.DecryptSigningKey(ctx, &key); err != nil {
+			return nil, err
+		}
+
 		keys = append(keys, key)
 	}
 
@@ -176,6 +195,10 @@ func (s *SQLiteSigningKeyDB) ListActiveSigningKeys(ctx context.Context, tenant,
 			key.Disabled = &disabled.Time
 		}
 
+		if err := kms.DecryptSigningKey(ctx, &key); err != nil {
+			return nil, err
+		}
+
 		keys = append(keys, key)
 	}
 
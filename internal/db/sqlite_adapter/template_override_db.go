@@ -0,0 +1,95 @@
+package sqlite_adapter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLiteTemplateOverrideDB implements the TemplateOverrideDB interface using SQLite
+type SQLiteTemplateOverrideDB struct {
+	db *sqlx.DB
+}
+
+// NewTemplateOverrideDB creates a new SQLiteTemplateOverrideDB instance
+func NewTemplateOverrideDB(db *sql.DB) (*SQLiteTemplateOverrideDB, error) {
+	sqlxDB := sqlx.NewDb(db, "sqlite3")
+
+	// Check if the connection works and template_overrides table exists by executing a query
+	_, err := sqlxDB.Exec(`SELECT 1 FROM template_overrides LIMIT 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if template_overrides table exists: %w", err)
+	}
+
+	return &SQLiteTemplateOverrideDB{db: sqlxDB}, nil
+}
+
+func (s *SQLiteTemplateOverrideDB) UpsertTemplateOverride(ctx context.Context, override *model.TemplateOverride) error {
+	override.UpdatedAt = time.Now().UTC()
+
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO template_overrides (tenant, realm, flow_id, node_name, template, updated_at)
+		VALUES (:tenant, :realm, :flow_id, :node_name, :template, :updated_at)
+		ON CONFLICT (tenant, realm, flow_id, node_name) DO UPDATE SET template = excluded.template, updated_at = excluded.updated_at
+	`, override)
+	if err != nil {
+		return fmt.Errorf("failed to upsert template override: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteTemplateOverrideDB) GetTemplateOverride(ctx context.Context, tenant, realm, flowId, nodeName string) (*model.TemplateOverride, error) {
+	var override model.TemplateOverride
+
+	err := s.db.GetContext(ctx, &override, `
+		SELECT tenant, realm, flow_id, node_name, template, updated_at
+		FROM template_overrides
+		WHERE tenant = ? AND realm = ? AND flow_id = ? AND node_name = ?
+	`, tenant, realm, flowId, nodeName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // not found
+		}
+		return nil, fmt.Errorf("failed to get template override: %w", err)
+	}
+
+	return &override, nil
+}
+
+func (s *SQLiteTemplateOverrideDB) ListTemplateOverrides(ctx context.Context) ([]model.TemplateOverride, error) {
+	overrides := []model.TemplateOverride{}
+
+	err := s.db.SelectContext(ctx, &overrides, `
+		SELECT tenant, realm, flow_id, node_name, template, updated_at
+		FROM template_overrides
+		ORDER BY tenant, realm, flow_id, node_name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list template overrides: %w", err)
+	}
+
+	return overrides, nil
+}
+
+func (s *SQLiteTemplateOverrideDB) DeleteTemplateOverride(ctx context.Context, tenant, realm, flowId, nodeName string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM template_overrides
+		WHERE tenant = ? AND realm = ? AND flow_id = ? AND node_name = ?
+	`, tenant, realm, flowId, nodeName)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete template override: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
@@ -0,0 +1,17 @@
+package sqlite_adapter
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateOverrideDB(t *testing.T) {
+	sqldb := setupTestDB(t)
+	templateOverrideDB, err := NewTemplateOverrideDB(sqldb)
+	require.NoError(t, err)
+
+	db.TemplateTestTemplateOverrideDB(t, templateOverrideDB)
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/Identityplane/GoAM/internal/logger"
+	"github.com/Identityplane/GoAM/pkg/kms"
 	"github.com/Identityplane/GoAM/pkg/model"
 
 	"github.com/google/uuid"
@@ -42,7 +43,7 @@ func (s *SQLiteUserAttributeDB) CreateUserAttribute(ctx context.Context, attribu
 	attribute.UpdatedAt = now
 
 	// Convert JSON value to string
-	valueJSON, err := json.Marshal(attribute.Value)
+	valueJSON, err := kms.EncryptAttributeValue(ctx, &attribute)
 	if err != nil {
 		return fmt.Errorf("failed to marshal attribute value: %w", err)
 	}
@@ -61,7 +62,7 @@ func (s *SQLiteUserAttributeDB) CreateUserAttribute(ctx context.Context, attribu
 		attribute.Type,
 		string(valueJSON),
 		attribute.CreatedAt.Format(time.RFC3339),
-		attribute.UpdatedAt.Format(time.RFC3339),
+		attribute.UpdatedAt.Format(time.RFC3339Nano),
 	)
 
 	if err != nil {
@@ -86,7 +87,38 @@ func (s *SQLiteUserAttributeDB) ListUserAttributes(ctx context.Context, tenant,
 	// Initialize with empty slice instead of nil slice
 	attributes := make([]*model.UserAttribute, 0)
 	for rows.Next() {
-		attr, err := s.scanUserAttributeFromRow(rows)
+		attr, err := s.scanUserAttributeFromRow(ctx, rows)
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, attr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attributes, nil
+}
+
+func (s *SQLiteUserAttributeDB) ListUserAttributesByType(ctx context.Context, tenant, realm, attributeType, afterID string, limit int) ([]*model.UserAttribute, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, tenant, realm, index_value, type, value,
+		       created_at, updated_at
+		FROM user_attributes 
+		WHERE tenant = ? AND realm = ? AND type = ? AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`, tenant, realm, attributeType, afterID, limit)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attributes := make([]*model.UserAttribute, 0)
+	for rows.Next() {
+		attr, err := s.scanUserAttributeFromRow(ctx, rows)
 		if err != nil {
 			return nil, err
 		}
@@ -108,14 +140,14 @@ func (s *SQLiteUserAttributeDB) GetUserAttributeByID(ctx context.Context, tenant
 		WHERE tenant = ? AND realm = ? AND id = ?
 	`, tenant, realm, attributeID)
 
-	return s.scanUserAttributeFromRow(row)
+	return s.scanUserAttributeFromRow(ctx, row)
 }
 
 func (s *SQLiteUserAttributeDB) UpdateUserAttribute(ctx context.Context, attribute *model.UserAttribute) error {
 	attribute.UpdatedAt = time.Now()
 
 	// Convert JSON value to string
-	valueJSON, err := json.Marshal(attribute.Value)
+	valueJSON, err := kms.EncryptAttributeValue(ctx, attribute)
 	if err != nil {
 		return fmt.Errorf("failed to marshal attribute value: %w", err)
 	}
@@ -131,7 +163,7 @@ func (s *SQLiteUserAttributeDB) UpdateUserAttribute(ctx context.Context, attribu
 		attribute.Index,
 		attribute.Type,
 		string(valueJSON),
-		attribute.UpdatedAt.Format(time.RFC3339),
+		attribute.UpdatedAt.Format(time.RFC3339Nano),
 		attribute.Tenant,
 		attribute.Realm,
 		attribute.ID,
@@ -153,6 +185,48 @@ func (s *SQLiteUserAttributeDB) UpdateUserAttribute(ctx context.Context, attribu
 	return nil
 }
 
+func (s *SQLiteUserAttributeDB) UpdateUserAttributeIfUnchanged(ctx context.Context, attribute *model.UserAttribute, lastUpdatedAt time.Time) (bool, error) {
+	updatedAt := time.Now()
+
+	valueJSON, err := kms.EncryptAttributeValue(ctx, attribute)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal attribute value: %w", err)
+	}
+
+	// Compare the instants as the stored time may have been written with a different offset
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE user_attributes SET
+			index_value = ?,
+			type = ?,
+			value = ?,
+			updated_at = ?
+		WHERE tenant = ? AND realm = ? AND id = ? AND julianday(updated_at) = julianday(?)
+	`,
+		attribute.Index,
+		attribute.Type,
+		string(valueJSON),
+		updatedAt.Format(time.RFC3339Nano),
+		attribute.Tenant,
+		attribute.Realm,
+		attribute.ID,
+		lastUpdatedAt.Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected != 1 {
+		return false, nil
+	}
+
+	attribute.UpdatedAt = updatedAt
+	return true, nil
+}
+
 func (s *SQLiteUserAttributeDB) DeleteUserAttribute(ctx context.Context, tenant, realm, attributeID string) error {
 	query := `
 		DELETE FROM user_attributes 
@@ -331,7 +405,7 @@ func (s *SQLiteUserAttributeDB) CreateUserWithAttributes(ctx context.Context, us
 		attribute.UpdatedAt = now
 
 		// Convert JSON value to string
-		valueJSON, err := json.Marshal(attribute.Value)
+		valueJSON, err := kms.EncryptAttributeValue(ctx, attribute)
 		if err != nil {
 			return fmt.Errorf("failed to marshal attribute value: %w", err)
 		}
@@ -351,7 +425,7 @@ func (s *SQLiteUserAttributeDB) CreateUserWithAttributes(ctx context.Context, us
 			attribute.Type,
 			string(valueJSON),
 			attribute.CreatedAt.Format(time.RFC3339),
-			attribute.UpdatedAt.Format(time.RFC3339),
+			attribute.UpdatedAt.Format(time.RFC3339Nano),
 		)
 
 		if err != nil {
@@ -464,7 +538,7 @@ func (s *SQLiteUserAttributeDB) UpdateUserWithAttributes(ctx context.Context, us
 			attribute.UpdatedAt = time.Now()
 
 			// Convert JSON value to string
-			valueJSON, err := json.Marshal(attribute.Value)
+			valueJSON, err := kms.EncryptAttributeValue(ctx, attribute)
 			if err != nil {
 				return fmt.Errorf("failed to marshal attribute value: %w", err)
 			}
@@ -484,7 +558,7 @@ func (s *SQLiteUserAttributeDB) UpdateUserWithAttributes(ctx context.Context, us
 				attribute.Type,
 				string(valueJSON),
 				attribute.CreatedAt.Format(time.RFC3339),
-				attribute.UpdatedAt.Format(time.RFC3339),
+				attribute.UpdatedAt.Format(time.RFC3339Nano),
 			)
 
 			if err != nil {
@@ -546,7 +620,10 @@ func (s *SQLiteUserAttributeDB) UpdateUserWithAttributes(ctx context.Context, us
 			if existingValue != "" && existingValue != "null" {
 				var rawValue interface{}
 				if err := json.Unmarshal([]byte(existingValue), &rawValue); err == nil {
-					existingAttribute.Value = rawValue
+					existingAttribute.Value, err = kms.DecryptAttributeValue(ctx, existingAttribute, rawValue)
+					if err != nil {
+						return err
+					}
 				}
 			}
 
@@ -560,7 +637,7 @@ func (s *SQLiteUserAttributeDB) UpdateUserWithAttributes(ctx context.Context, us
 			attribute.UpdatedAt = time.Now()
 
 			// Convert JSON value to string for the update
-			valueJSON, err := json.Marshal(attribute.Value)
+			valueJSON, err := kms.EncryptAttributeValue(ctx, attribute)
 			if err != nil {
 				return fmt.Errorf("failed to marshal attribute value: %w", err)
 			}
@@ -576,7 +653,7 @@ func (s *SQLiteUserAttributeDB) UpdateUserWithAttributes(ctx context.Context, us
 				attribute.Index,
 				attribute.Type,
 				string(valueJSON),
-				attribute.UpdatedAt.Format(time.RFC3339),
+				attribute.UpdatedAt.Format(time.RFC3339Nano),
 				attribute.Tenant,
 				attribute.Realm,
 				attribute.ID,
@@ -605,7 +682,7 @@ func (s *SQLiteUserAttributeDB) UpdateUserWithAttributes(ctx context.Context, us
 }
 
 // scanUserAttributeFromRow scans a user attribute from a database row
-func (s *SQLiteUserAttributeDB) scanUserAttributeFromRow(scanner interface{}) (*model.UserAttribute, error) {
+func (s *SQLiteUserAttributeDB) scanUserAttributeFromRow(ctx context.Context, scanner interface{}) (*model.UserAttribute, error) {
 	var attribute model.UserAttribute
 	var valueJSON string
 	var createdAt, updatedAt string
@@ -667,7 +744,11 @@ func (s *SQLiteUserAttributeDB) scanUserAttributeFromRow(scanner interface{}) (*
 		if err := json.Unmarshal([]byte(valueJSON), &rawValue); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal attribute value: %w", err)
 		}
-		attribute.Value = rawValue
+
+		attribute.Value, err = kms.DecryptAttributeValue(ctx, &attribute, rawValue)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &attribute, nil
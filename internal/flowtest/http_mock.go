@@ -0,0 +1,91 @@
+package flowtest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// HTTPMock is the response of an external service to the requests that match the method and the url. The query of
+// the request is ignored, a url that ends with * matches all urls that start with the rest of it.
+type HTTPMock struct {
+	Method  string            `yaml:"method" json:"method,omitempty"` // any method if empty
+	URL     string            `yaml:"url" json:"url"`
+	Status  int               `yaml:"status" json:"status,omitempty"` // default is 200
+	Headers map[string]string `yaml:"headers" json:"headers,omitempty"`
+	Body    string            `yaml:"body" json:"body,omitempty"`
+}
+
+func (m *HTTPMock) matches(req *http.Request) bool {
+	if m.Method != "" && !strings.EqualFold(m.Method, req.Method) {
+		return false
+	}
+
+	url := *req.URL
+	url.RawQuery = ""
+	url.Fragment = ""
+
+	if prefix, ok := strings.CutSuffix(m.URL, "*"); ok {
+		return strings.HasPrefix(url.String(), prefix)
+	}
+	return url.String() == m.URL
+}
+
+// mockHTTPClient answers the requests of the nodes with the mocks of the suite, so that flow tests never call
+// external services. Requests without a mock fail and are reported as failure of the test.
+type mockHTTPClient struct {
+	mocks []HTTPMock
+
+	mu        sync.Mutex
+	unmatched []string
+}
+
+func (c *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	for _, mock := range c.mocks {
+		if !mock.matches(req) {
+			continue
+		}
+
+		status := mock.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		header := http.Header{}
+		for name, value := range mock.Headers {
+			header.Set(name, value)
+		}
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+			StatusCode:    status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(mock.Body)),
+			ContentLength: int64(len(mock.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	request := req.Method + " " + req.URL.Redacted()
+	c.mu.Lock()
+	c.unmatched = append(c.unmatched, request)
+	c.mu.Unlock()
+
+	return nil, fmt.Errorf("flow tests cannot call external services, the suite has no http mock for %s", request)
+}
+
+// Unmatched returns the requests that had no mock
+func (c *mockHTTPClient) Unmatched() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.unmatched...)
+}
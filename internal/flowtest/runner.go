@@ -0,0 +1,326 @@
+package flowtest
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Identityplane/GoAM/internal/auth/graph"
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/Identityplane/GoAM/pkg/nodetest"
+)
+
+// Tenant and realm of the users of the tests
+const (
+	testTenant = "flowtest"
+	testRealm  = "flowtest"
+)
+
+// placeholderPattern matches ${email.otp} and ${sms.otp} in the inputs of a step
+var placeholderPattern = regexp.MustCompile(`\$\{(email|sms)\.([A-Za-z0-9_]+)\}`)
+
+// SuiteResult is the outcome of all tests of a suite
+type SuiteResult struct {
+	Name   string       `json:"name"`
+	Passed bool         `json:"passed"`
+	Tests  []TestResult `json:"tests"`
+}
+
+// TestResult is the outcome of a single test
+type TestResult struct {
+	Name     string   `json:"name"`
+	Passed   bool     `json:"passed"`
+	Failures []string `json:"failures,omitempty"`
+	Path     []string `json:"path"` // nodes the flow passed, to debug failed tests
+}
+
+// Failed returns the number of failed tests
+func (r *SuiteResult) Failed() int {
+	failed := 0
+	for _, test := range r.Tests {
+		if !test.Passed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Run runs the tests of the suite against the flow. Subflows must already be expanded. Each test starts with
+// new repositories that contain the users of the suite, emails and sms are recorded instead of sent and http
+// requests are answered by the mocks of the suite. Flows with nodes that connect to external services without
+// the repositories are not run, as the tests would call the real services.
+func Run(flow *model.FlowDefinition, suite *Suite) *SuiteResult {
+	result := &SuiteResult{Name: suite.Name, Passed: true, Tests: []TestResult{}}
+
+	refused := directConnectionNodes(flow)
+
+	for _, test := range suite.Tests {
+		var testResult TestResult
+		if len(refused) > 0 {
+			testResult = TestResult{Name: test.Name, Path: []string{}, Failures: refused}
+		} else {
+			testResult = runTest(flow, suite, test)
+		}
+		if !testResult.Passed {
+			result.Passed = false
+		}
+		result.Tests = append(result.Tests, testResult)
+	}
+
+	return result
+}
+
+func runTest(flow *model.FlowDefinition, suite *Suite, test TestCase) TestResult {
+	result := TestResult{Name: test.Name, Path: []string{}}
+	fail := func(format string, args ...any) {
+		result.Failures = append(result.Failures, fmt.Sprintf(format, args...))
+	}
+
+	repos, recorder, closeRepos, err := nodetest.NewRecordingRepositories(testTenant, testRealm)
+	if err != nil {
+		fail("failed to create repositories: %v", err)
+		return result
+	}
+	defer closeRepos()
+
+	maps.Copy(recorder.Secrets, suite.Secrets)
+	maps.Copy(recorder.Settings, suite.Settings)
+
+	httpClient := &mockHTTPClient{mocks: suite.HTTP}
+	repos.HTTPClient = httpClient
+
+	if err := createUsers(repos.UserRepo, suite.Users); err != nil {
+		fail("%v", err)
+		return result
+	}
+
+	state := graph.InitFlow(flow)
+	maps.Copy(state.Context, test.Context)
+
+	state, err = graph.Run(flow, state, nil, repos)
+
+	for i, step := range test.Steps {
+		if err != nil {
+			break
+		}
+
+		if state.Result != nil {
+			fail("step %d: the flow already finished at node '%s'", i+1, state.Current)
+			break
+		}
+
+		if step.Node != "" && step.Node != state.Current {
+			fail("step %d: expected the flow to wait at node '%s' but it waits at '%s'", i+1, step.Node, state.Current)
+			break
+		}
+
+		if step.Prompts != nil {
+			prompts := slices.Sorted(maps.Keys(state.Prompts))
+			expected := slices.Sorted(slices.Values(step.Prompts))
+			if !slices.Equal(prompts, expected) {
+				fail("step %d: expected the prompts %v but got %v", i+1, expected, prompts)
+			}
+		}
+
+		switch step.Action {
+		case ActionBack:
+			state, err = graph.Back(flow, state, repos)
+		case ActionRestart:
+			state, err = graph.Restart(flow, state, repos)
+		default:
+			state, err = graph.Run(flow, state, resolveInputs(step.Inputs, recorder), repos)
+		}
+	}
+
+	result.Path = nodePath(state)
+
+	// An error the flow did not handle only passes the test if the test expects it
+	if err != nil && (test.Expect.Error == "" || state.LastError == nil || state.LastError.Code != test.Expect.Error) {
+		fail("the flow returned an error: %v", err)
+	}
+
+	for _, request := range httpClient.Unmatched() {
+		fail("the flow sent a request without http mock: %s", request)
+	}
+
+	checkExpectation(state, test.Expect, recorder, fail)
+
+	result.Passed = len(result.Failures) == 0
+	return result
+}
+
+func checkExpectation(state *model.AuthenticationSession, expect Expectation, recorder *nodetest.Recorder, fail func(string, ...any)) {
+	if expect.Path != nil && !slices.Equal(expect.Path, nodePath(state)) {
+		fail("expected the path %s but got %s", strings.Join(expect.Path, " > "), strings.Join(nodePath(state), " > "))
+	}
+
+	if expect.Node != "" && expect.Node != state.Current {
+		fail("expected the flow to end at node '%s' but it is at '%s'", expect.Node, state.Current)
+	}
+
+	if expect.Result != "" {
+		switch {
+		case state.Result == nil:
+			fail("expected the result '%s' but the flow did not finish", expect.Result)
+		case state.Result.Authenticated && expect.Result != ResultSuccess:
+			fail("expected the result '%s' but got '%s'", expect.Result, ResultSuccess)
+		case !state.Result.Authenticated && expect.Result != ResultFailure:
+			fail("expected the result '%s' but got '%s'", expect.Result, ResultFailure)
+		}
+	}
+
+	if expect.User != "" {
+		userID := ""
+		if state.User != nil {
+			userID = state.User.ID
+		}
+		if userID != expect.User {
+			fail("expected the user '%s' but got '%s'", expect.User, userID)
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(expect.Context)) {
+		expected := expect.Context[key]
+		value, ok := state.Context[key]
+		switch {
+		case expected == nil && ok:
+			fail("expected the context key '%s' to be unset but it is '%s'", key, value)
+		case expected != nil && !ok:
+			fail("expected the context key '%s' to be '%s' but it is not set", key, *expected)
+		case expected != nil && value != *expected:
+			fail("expected the context key '%s' to be '%s' but it is '%s'", key, *expected, value)
+		}
+	}
+
+	if expect.Error != "" {
+		if state.LastError == nil {
+			fail("expected the error '%s' but no node failed", expect.Error)
+		} else if state.LastError.Code != expect.Error {
+			fail("expected the error '%s' but got '%s'", expect.Error, state.LastError.Code)
+		}
+	}
+
+	if expect.Emails != nil && *expect.Emails != len(recorder.Emails) {
+		fail("expected %d emails but %d were sent", *expect.Emails, len(recorder.Emails))
+	}
+
+	if expect.SMS != nil && *expect.SMS != len(recorder.SMS) {
+		fail("expected %d sms but %d were sent", *expect.SMS, len(recorder.SMS))
+	}
+}
+
+// directConnectionNodes returns a failure for each node of the flow that connects to external services without
+// the repositories
+func directConnectionNodes(flow *model.FlowDefinition) []string {
+	var failures []string
+	for _, name := range slices.Sorted(maps.Keys(flow.Nodes)) {
+		node := flow.Nodes[name]
+		if def := graph.GetNodeDefinitionByName(node.Use); def != nil && def.DirectConnections {
+			failures = append(failures, fmt.Sprintf("node '%s' cannot run in flow tests, %s connects to external services that cannot be mocked", name, node.Use))
+		}
+	}
+	return failures
+}
+
+// nodePath returns the nodes the flow passed from its history, a node that prompted and then continued is
+// listed once
+func nodePath(state *model.AuthenticationSession) []string {
+	path := []string{}
+	add := func(node string) {
+		if len(path) == 0 || path[len(path)-1] != node {
+			path = append(path, node)
+		}
+	}
+
+	for _, entry := range state.History {
+		node, _, _ := strings.Cut(entry, ":")
+		add(node)
+	}
+
+	// The node that waits for input or failed last is not in the history yet
+	if state.Result == nil && state.Current != "" {
+		add(state.Current)
+	}
+
+	return path
+}
+
+// resolveInputs replaces the placeholders of the inputs with the params of the last email or sms
+func resolveInputs(inputs map[string]string, recorder *nodetest.Recorder) map[string]string {
+	resolved := make(map[string]string, len(inputs))
+	for key, value := range inputs {
+		resolved[key] = placeholderPattern.ReplaceAllStringFunc(value, func(placeholder string) string {
+			match := placeholderPattern.FindStringSubmatch(placeholder)
+
+			var params map[string]any
+			if match[1] == "email" && len(recorder.Emails) > 0 {
+				params = recorder.Emails[len(recorder.Emails)-1].Params
+			}
+			if match[1] == "sms" && len(recorder.SMS) > 0 {
+				params = recorder.SMS[len(recorder.SMS)-1].Params
+			}
+
+			if value, ok := params[match[2]]; ok {
+				return fmt.Sprint(value)
+			}
+			return ""
+		})
+	}
+	return resolved
+}
+
+func createUsers(userRepo model.UserRepository, fixtures []UserFixture) error {
+	for _, fixture := range fixtures {
+		status := fixture.Status
+		if status == "" {
+			status = "active"
+		}
+
+		user := &model.User{ID: fixture.ID, Status: status}
+
+		if fixture.Username != "" {
+			user.AddAttribute(&model.UserAttribute{
+				Type:  model.AttributeTypeUsername,
+				Index: lib.StringPtr(fixture.Username),
+				Value: model.UsernameAttributeValue{PreferredUsername: fixture.Username},
+			})
+		}
+
+		if fixture.Email != "" {
+			user.AddAttribute(&model.UserAttribute{
+				Type:  model.AttributeTypeEmail,
+				Index: lib.StringPtr(fixture.Email),
+				Value: model.EmailAttributeValue{Email: fixture.Email, Verified: fixture.EmailVerified},
+			})
+		}
+
+		if fixture.Phone != "" {
+			user.AddAttribute(&model.UserAttribute{
+				Type:  model.AttributeTypePhone,
+				Index: lib.StringPtr(fixture.Phone),
+				Value: model.PhoneAttributeValue{Phone: fixture.Phone, Verified: fixture.PhoneVerified},
+			})
+		}
+
+		if fixture.Password != "" {
+			hash, err := lib.HashPassword(fixture.Password)
+			if err != nil {
+				return fmt.Errorf("failed to hash the password of user '%s': %w", fixture.ID, err)
+			}
+			user.AddAttribute(&model.UserAttribute{
+				Type:  model.AttributeTypePassword,
+				Value: model.PasswordAttributeValue{PasswordHash: hash},
+			})
+		}
+
+		if err := userRepo.Create(context.Background(), user); err != nil {
+			return fmt.Errorf("failed to create user '%s': %w", fixture.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,367 @@
+package flowtest
+
+import (
+	"testing"
+
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const loginFlow = `
+description: Login with username and password
+start: init
+nodes:
+  init:
+    name: init
+    use: init
+    next:
+      start: askUsernamePassword
+  askUsernamePassword:
+    name: askUsernamePassword
+    use: askUsernamePassword
+    next:
+      submitted: validatePassword
+  validatePassword:
+    name: validatePassword
+    use: validatePassword
+    custom_config:
+      max_failed_password_attempts: "2"
+    next:
+      success: successResult
+      fail: askUsernamePassword
+      locked: failureResult
+      noPassword: failureResult
+  failureResult:
+    name: failureResult
+    use: failureResult
+  successResult:
+    name: successResult
+    use: successResult
+
+tests:
+  - name: valid password
+    steps:
+      - node: askUsernamePassword
+        prompts: [username, password]
+        inputs: {username: alice, password: secret}
+    expect:
+      path: [init, askUsernamePassword, validatePassword, successResult]
+      result: success
+      user: user-1
+      context:
+        username: alice
+        password: null
+  - name: locked after two wrong passwords
+    steps:
+      - inputs: {username: alice, password: wrong}
+      - node: askUsernamePassword
+        inputs: {username: alice, password: wrong}
+    expect:
+      node: failureResult
+      result: failure
+      emails: 0
+`
+
+const suiteUsers = `
+name: login
+users:
+  - id: user-1
+    username: alice
+    email: alice@example.com
+    password: secret
+`
+
+func loadLoginSuite(t *testing.T) *Suite {
+	t.Helper()
+
+	suite, err := LoadSuite(loginFlow)
+	require.NoError(t, err)
+
+	users, err := LoadSuite(suiteUsers)
+	require.NoError(t, err)
+	suite.Name = users.Name
+	suite.Users = users.Users
+
+	return suite
+}
+
+func TestRun_FlowWithTests(t *testing.T) {
+	flow, err := lib.LoadFlowDefinitonFromString(loginFlow)
+	require.NoError(t, err)
+	suite := loadLoginSuite(t)
+	require.Len(t, suite.Tests, 2)
+
+	result := Run(flow, suite)
+	for _, test := range result.Tests {
+		assert.Empty(t, test.Failures, test.Name)
+	}
+	assert.True(t, result.Passed)
+	assert.Equal(t, 0, result.Failed())
+}
+
+func TestRun_Failures(t *testing.T) {
+	flow, err := lib.LoadFlowDefinitonFromString(loginFlow)
+	require.NoError(t, err)
+	suite := loadLoginSuite(t)
+
+	suite.Tests[0].Expect.Result = ResultFailure
+	suite.Tests[0].Expect.Path = []string{"init", "successResult"}
+	suite.Tests[1].Steps[1].Node = "validatePassword"
+
+	result := Run(flow, suite)
+	assert.False(t, result.Passed)
+	assert.Equal(t, 2, result.Failed())
+
+	assert.Equal(t, []string{
+		"expected the path init > successResult but got init > askUsernamePassword > validatePassword > successResult",
+		"expected the result 'failure' but got 'success'",
+	}, result.Tests[0].Failures)
+
+	assert.Contains(t, result.Tests[1].Failures, "step 2: expected the flow to wait at node 'validatePassword' but it waits at 'askUsernamePassword'")
+	assert.Equal(t, []string{"init", "askUsernamePassword", "validatePassword", "askUsernamePassword"}, result.Tests[1].Path)
+}
+
+func TestRun_EmailPlaceholder(t *testing.T) {
+	flow, err := lib.LoadFlowDefinitonFromString(`
+start: init
+nodes:
+  init:
+    name: init
+    use: init
+    next:
+      start: askEmail
+  askEmail:
+    name: askEmail
+    use: askEmail
+    next:
+      submitted: emailOTP
+  emailOTP:
+    name: emailOTP
+    use: emailOTP
+    next:
+      success-registered-email: successResult
+      success-new-email-for-user: failureResult
+      success-unkown-email: failureResult
+  failureResult:
+    name: failureResult
+    use: failureResult
+  successResult:
+    name: successResult
+    use: successResult
+`)
+	require.NoError(t, err)
+
+	suite, err := LoadSuite(`
+name: email otp
+users:
+  - id: user-1
+    email: alice@example.com
+tests:
+  - name: otp from the email
+    steps:
+      - inputs: {email: alice@example.com}
+      - node: emailOTP
+        prompts: [email, otp, resend_in_seconds]
+        inputs: {otp: "${email.otp}"}
+    expect:
+      result: success
+      user: user-1
+      emails: 1
+      sms: 0
+`)
+	require.NoError(t, err)
+
+	result := Run(flow, suite)
+	require.Len(t, result.Tests, 1)
+	assert.Empty(t, result.Tests[0].Failures)
+}
+
+func TestRun_Back(t *testing.T) {
+	flow, err := lib.LoadFlowDefinitonFromString(`
+start: init
+nodes:
+  init:
+    name: init
+    use: init
+    next:
+      start: askUsername
+  askUsername:
+    name: askUsername
+    use: askUsername
+    reversible: [submitted]
+    next:
+      submitted: askPassword
+  askPassword:
+    name: askPassword
+    use: askPassword
+    next:
+      submitted: failureResult
+  failureResult:
+    name: failureResult
+    use: failureResult
+`)
+	require.NoError(t, err)
+
+	suite, err := LoadSuite(`
+tests:
+  - name: change the username
+    steps:
+      - inputs: {username: alice}
+      - node: askPassword
+        action: back
+      - node: askUsername
+        inputs: {username: bob}
+    expect:
+      node: askPassword
+      context:
+        username: bob
+`)
+	require.NoError(t, err)
+
+	result := Run(flow, suite)
+	require.Len(t, result.Tests, 1)
+	assert.Empty(t, result.Tests[0].Failures)
+	assert.Equal(t, []string{"init", "askUsername", "askPassword", "askUsername", "askPassword"}, result.Tests[0].Path)
+}
+
+func TestLoadSuite_Invalid(t *testing.T) {
+	_, err := LoadSuite(`
+tests:
+  - name: no inputs
+    steps:
+      - node: askUsername
+`)
+	assert.ErrorContains(t, err, "step 1 of test 'no inputs' needs inputs or an action")
+
+	_, err = LoadSuite(`
+tests:
+  - name: unknown action
+    steps:
+      - action: forward
+`)
+	assert.ErrorContains(t, err, "unknown action 'forward'")
+
+	_, err = LoadSuite(`
+tests:
+  - name: unknown result
+    expect:
+      result: done
+`)
+	assert.ErrorContains(t, err, "unknown result 'done'")
+
+	_, err = LoadSuite(`
+users:
+  - username: alice
+`)
+	assert.ErrorContains(t, err, "user 1 has no id")
+
+	_, err = LoadSuite(`
+http:
+  - method: GET
+`)
+	assert.ErrorContains(t, err, "http mock 1 has no url")
+}
+
+const riskCheckFlow = `
+start: init
+nodes:
+  init:
+    name: init
+    use: init
+    next:
+      start: riskCheck
+  riskCheck:
+    name: riskCheck
+    use: httpRequest
+    custom_config:
+      method: POST
+      url: https://risk.example.com/v1/check
+      body: '{"username": "{{ context.username }}"}'
+      response_mapping: |
+        risk_score: score
+    next:
+      success: allowed
+      error: unavailable
+  allowed:
+    name: allowed
+    use: failureResult
+  unavailable:
+    name: unavailable
+    use: failureResult
+`
+
+func TestRun_HTTPMocks(t *testing.T) {
+	flow, err := lib.LoadFlowDefinitonFromString(riskCheckFlow)
+	require.NoError(t, err)
+
+	suite, err := LoadSuite(`
+settings:
+  http_request_allowed_hosts: risk.example.com
+http:
+  - method: POST
+    url: https://risk.example.com/v1/*
+    body: '{"score": 10}'
+tests:
+  - name: mocked response
+    context: {username: alice}
+    expect:
+      node: allowed
+      context:
+        risk_score: "10"
+`)
+	require.NoError(t, err)
+
+	result := Run(flow, suite)
+	require.Len(t, result.Tests, 1)
+	assert.Empty(t, result.Tests[0].Failures)
+
+	// Requests without a mock are never sent
+	suite.HTTP[0].Method = "GET"
+	result = Run(flow, suite)
+	require.Len(t, result.Tests, 1)
+	assert.Contains(t, result.Tests[0].Failures, "the flow sent a request without http mock: POST https://risk.example.com/v1/check")
+}
+
+func TestRun_NodesWithDirectConnectionsAreRefused(t *testing.T) {
+	flow, err := lib.LoadFlowDefinitonFromString(`
+start: init
+nodes:
+  init:
+    name: init
+    use: init
+    next:
+      start: ldapBind
+  ldapBind:
+    name: ldapBind
+    use: ldapBind
+    custom_config:
+      ldap_url: ldap://ldap.example.com
+      ldap_base_dn: dc=example,dc=com
+    next:
+      success: successResult
+      fail: failureResult
+  failureResult:
+    name: failureResult
+    use: failureResult
+  successResult:
+    name: successResult
+    use: successResult
+`)
+	require.NoError(t, err)
+
+	suite, err := LoadSuite(`
+tests:
+  - name: login
+    context: {username: alice, password: secret}
+    expect:
+      result: success
+`)
+	require.NoError(t, err)
+
+	result := Run(flow, suite)
+	assert.False(t, result.Passed)
+	require.Len(t, result.Tests, 1)
+	assert.Equal(t, []string{"node 'ldapBind' cannot run in flow tests, ldapBind connects to external services that cannot be mocked"}, result.Tests[0].Failures)
+	assert.Empty(t, result.Tests[0].Path)
+}
@@ -0,0 +1,126 @@
+package flowtest
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ActionBack    = "back"
+	ActionRestart = "restart"
+
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Suite is a set of tests for a flow. It is either a file of its own or the tests section of the flow definition.
+type Suite struct {
+	Name     string            `yaml:"name" json:"name"`
+	Users    []UserFixture     `yaml:"users" json:"users,omitempty"`       // users that exist before each test
+	Secrets  map[string]string `yaml:"secrets" json:"-"`                   // secrets of the realm, e.g. api keys of nodes
+	Settings map[string]string `yaml:"settings" json:"settings,omitempty"` // settings of the realm
+	HTTP     []HTTPMock        `yaml:"http" json:"http,omitempty"`         // responses of external services
+	Tests    []TestCase        `yaml:"tests" json:"tests"`
+}
+
+// UserFixture is a user that is stored in the user repository before a test runs
+type UserFixture struct {
+	ID            string `yaml:"id" json:"id"`
+	Status        string `yaml:"status" json:"status,omitempty"` // default is active
+	Username      string `yaml:"username" json:"username,omitempty"`
+	Email         string `yaml:"email" json:"email,omitempty"`
+	EmailVerified bool   `yaml:"email_verified" json:"email_verified,omitempty"`
+	Phone         string `yaml:"phone" json:"phone,omitempty"`
+	PhoneVerified bool   `yaml:"phone_verified" json:"phone_verified,omitempty"`
+	Password      string `yaml:"password" json:"-"` // stored as hash
+}
+
+// TestCase runs the flow from the start with scripted inputs and checks where it ended
+type TestCase struct {
+	Name    string            `yaml:"name" json:"name"`
+	Context map[string]string `yaml:"context" json:"context,omitempty"` // context of the session before the flow starts
+	Steps   []Step            `yaml:"steps" json:"steps"`
+	Expect  Expectation       `yaml:"expect" json:"expect"`
+}
+
+// Step answers the prompts of the node at which the flow waits
+type Step struct {
+	Node    string            `yaml:"node" json:"node,omitempty"`       // expected node that prompts (optional)
+	Prompts []string          `yaml:"prompts" json:"prompts,omitempty"` // expected prompts of the node (optional)
+	Inputs  map[string]string `yaml:"inputs" json:"inputs,omitempty"`   // ${email.<param>} and ${sms.<param>} are replaced with the last message
+	Action  string            `yaml:"action" json:"action,omitempty"`   // back or restart instead of inputs
+}
+
+// Expectation is checked after the last step, fields that are not set are not checked
+type Expectation struct {
+	Path    []string           `yaml:"path" json:"path,omitempty"`       // names of the nodes the flow passed, in order
+	Node    string             `yaml:"node" json:"node,omitempty"`       // node at which the flow ended or waits
+	Result  string             `yaml:"result" json:"result,omitempty"`   // success or failure, the flow must have finished
+	User    string             `yaml:"user" json:"user,omitempty"`       // id of the user of the session
+	Context map[string]*string `yaml:"context" json:"context,omitempty"` // values of the context, null if the key must not be set
+	Error   string             `yaml:"error" json:"error,omitempty"`     // code of the last error of a node
+	Emails  *int               `yaml:"emails" json:"emails,omitempty"`   // number of emails sent
+	SMS     *int               `yaml:"sms" json:"sms,omitempty"`         // number of sms sent
+}
+
+// LoadSuite parses a test suite from yaml. Flow definitions can contain their tests, the keys of the flow are
+// ignored in that case.
+func LoadSuite(content string) (*Suite, error) {
+	var suite Suite
+	if err := yaml.Unmarshal([]byte(content), &suite); err != nil {
+		return nil, fmt.Errorf("failed to parse test suite: %w", err)
+	}
+
+	if err := suite.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &suite, nil
+}
+
+// Validate checks that the tests of the suite can be run
+func (s *Suite) Validate() error {
+	for i, user := range s.Users {
+		if user.ID == "" {
+			return fmt.Errorf("user %d has no id", i+1)
+		}
+	}
+
+	for i, mock := range s.HTTP {
+		if mock.URL == "" {
+			return fmt.Errorf("http mock %d has no url", i+1)
+		}
+		if mock.Status != 0 && (mock.Status < 100 || mock.Status > 599) {
+			return fmt.Errorf("http mock %d has the invalid status %d", i+1, mock.Status)
+		}
+	}
+
+	for i, test := range s.Tests {
+		if test.Name == "" {
+			return fmt.Errorf("test %d has no name", i+1)
+		}
+
+		for j, step := range test.Steps {
+			switch step.Action {
+			case "":
+				if step.Inputs == nil {
+					return fmt.Errorf("step %d of test '%s' needs inputs or an action", j+1, test.Name)
+				}
+			case ActionBack, ActionRestart:
+				if step.Inputs != nil {
+					return fmt.Errorf("step %d of test '%s' cannot have inputs and an action", j+1, test.Name)
+				}
+			default:
+				return fmt.Errorf("step %d of test '%s' has the unknown action '%s'", j+1, test.Name, step.Action)
+			}
+		}
+
+		result := test.Expect.Result
+		if result != "" && result != ResultSuccess && result != ResultFailure {
+			return fmt.Errorf("test '%s' expects the unknown result '%s', expected success or failure", test.Name, result)
+		}
+	}
+
+	return nil
+}
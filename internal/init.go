@@ -13,6 +13,7 @@ import (
 	"github.com/Identityplane/GoAM/internal/web/auth"
 	"github.com/Identityplane/GoAM/pkg/db"
 	dbinit "github.com/Identityplane/GoAM/pkg/db/init"
+	"github.com/Identityplane/GoAM/pkg/kms"
 	"github.com/Identityplane/GoAM/pkg/model"
 	"github.com/Identityplane/GoAM/pkg/server_settings"
 	services_init "github.com/Identityplane/GoAM/pkg/services/init"
@@ -37,14 +38,20 @@ func Initialize(serverSettings *server_settings.GoamServerSettings) {
 	log := logger.GetGoamLogger()
 	log.Debug().Str("config_path", config.ServerSettings.RealmConfigurationFolder).Msg("using config path")
 
-	// Step 1: Initialize database connections
+	// Step 1: Initialize encryption at rest, it must be ready before data is read from the database
+	err := initEncryption()
+	if err != nil {
+		log.Panic().Err(err).Msg("failed to initialize encryption")
+	}
+
+	// Step 2: Initialize database connections
 	dbConnections, err := initDatabase()
 	if err != nil {
 		log.Panic().Err(err).Msg("failed to initialize database connections")
 	}
 	DBConnections = dbConnections
 
-	// Step 2: Initialize services and realms
+	// Step 3: Initialize services and realms
 	err = initServices(dbConnections)
 	if err != nil {
 		log.Panic().Err(err).Msg("failed to initialize services")
@@ -64,6 +71,39 @@ func Initialize(serverSettings *server_settings.GoamServerSettings) {
 
 }
 
+// initEncryption creates the local key provider from the server settings unless a provider was already set
+func initEncryption() error {
+	log := logger.GetGoamLogger()
+
+	if config.ServerSettings.EncryptionPlaintextUntil != "" {
+		cutoff, err := time.Parse(time.RFC3339, config.ServerSettings.EncryptionPlaintextUntil)
+		if err != nil {
+			return fmt.Errorf("invalid encryption_plaintext_until: %w", err)
+		}
+		kms.SetPlaintextCutoff(cutoff)
+		log.Info().Time("until", cutoff).Msg("accepting unencrypted secrets until the plaintext cutoff")
+	}
+
+	if kms.GetKeyProvider() != nil {
+		log.Info().Str("provider", kms.GetKeyProvider().Name()).Msg("encrypting secrets at rest")
+		return nil
+	}
+
+	provider, err := kms.LoadLocalKeyProvider(config.ServerSettings.EncryptionKekFile, config.ServerSettings.EncryptionKek)
+	if err != nil {
+		return err
+	}
+
+	if provider == nil {
+		log.Warn().Msg("no key encryption key configured, signing keys and credential secrets are stored unencrypted")
+		return nil
+	}
+
+	kms.SetKeyProvider(provider)
+	log.Info().Str("provider", provider.Name()).Str("kek", provider.CurrentKeyID()).Msg("encrypting secrets at rest")
+	return nil
+}
+
 // initDatabase initializes all database connections based on the connection strings
 func initDatabase() (*db.DatabaseConnections, error) {
 
@@ -118,6 +158,30 @@ func initServices(dbConnections *db.DatabaseConnections) error {
 		return fmt.Errorf("failed to load static configuration: %w", err)
 	}
 
+	// Watch for configuration changes made by other instances
+	if services.ConfigChangeService != nil {
+		err = services.ConfigChangeService.Start(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to start config change service: %w", err)
+		}
+	}
+
+	// Clean up expired sessions and stale data in the background
+	if services.MaintenanceService != nil {
+		err = services.MaintenanceService.Start(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to start maintenance service: %w", err)
+		}
+	}
+
+	// Write the counters of the flow analytics in the background
+	if services.FlowAnalyticsService != nil {
+		err = services.FlowAnalyticsService.Start(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to start flow analytics service: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,297 @@
+// Package expression evaluates the expressions of flow nodes such as condition and setVariable.
+//
+// Expressions are written in the expr language (https://expr-lang.org) and run against a read-only view of the
+// authentication session. They cannot call into the server, access the database or change the session, the node
+// that evaluates them decides what to do with the result.
+package expression
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// maxNodes limits the size of an expression so that a flow cannot contain arbitrarily expensive expressions
+const maxNodes = 500
+
+// Environment is what an expression can see of the authentication session
+type Environment struct {
+	Context map[string]string `expr:"context"`
+	User    User              `expr:"user"`
+	Request Request           `expr:"request"`
+	OAuth2  OAuth2            `expr:"oauth2"`
+	Time    Time              `expr:"time"`
+	Error   Error             `expr:"error"`
+
+	// Secret returns a secret of the server by name, e.g. secret("crm_api_key"). Only nodes that send the
+	// value to a trusted service provide secrets, in all other nodes the function fails.
+	Secret func(name string) (string, error) `expr:"secret"`
+}
+
+// User describes the user of the session. Credentials are not part of it, only the types of the attributes
+// without the identityplane: prefix, e.g. "totp" in user.attributes
+type User struct {
+	Exists        bool     `expr:"exists"`
+	ID            string   `expr:"id"`
+	Status        string   `expr:"status"`
+	Email         string   `expr:"email"`
+	EmailVerified bool     `expr:"email_verified"`
+	Phone         string   `expr:"phone"`
+	PhoneVerified bool     `expr:"phone_verified"`
+	Username      string   `expr:"username"`
+	Attributes    []string `expr:"attributes"`
+}
+
+// Request describes the http request, header names are lower case
+type Request struct {
+	IP      string            `expr:"ip"`
+	Headers map[string]string `expr:"headers"`
+}
+
+// OAuth2 describes the authorization request of the client that started the flow
+type OAuth2 struct {
+	ClientID  string   `expr:"client_id"`
+	Scopes    []string `expr:"scopes"`
+	AcrValues []string `expr:"acr_values"`
+	Prompt    string   `expr:"prompt"`
+}
+
+// Time is the time of the evaluation in the configured timezone
+type Time struct {
+	Hour    int    `expr:"hour"`
+	Minute  int    `expr:"minute"`
+	Weekday string `expr:"weekday"`
+	Date    string `expr:"date"`
+	Unix    int64  `expr:"unix"`
+}
+
+// Error is the last error of a node in the session, all fields are empty if no node failed
+type Error struct {
+	Node    string `expr:"node"`
+	Code    string `expr:"code"`
+	Class   string `expr:"class"`
+	Message string `expr:"message"`
+}
+
+// Kind defines the type an expression must evaluate to
+type Kind int
+
+const (
+	// KindBool is used for conditions
+	KindBool Kind = iota
+	// KindValue is used for values that are stored in the context, the result is converted to a string
+	KindValue
+)
+
+type cacheKey struct {
+	kind   Kind
+	source string
+}
+
+// programs caches compiled expressions, flows are evaluated on every request but rarely change
+var programs sync.Map
+
+// Compile parses and type checks the expression. Compiled expressions are cached.
+func Compile(source string, kind Kind) (*vm.Program, error) {
+
+	key := cacheKey{kind: kind, source: source}
+	if program, ok := programs.Load(key); ok {
+		return program.(*vm.Program), nil
+	}
+
+	options := []expr.Option{
+		expr.Env(Environment{}),
+		expr.MaxNodes(maxNodes),
+		expr.Function("ipInRange", ipInRange, new(func(string, string) bool)),
+	}
+	if kind == KindBool {
+		options = append(options, expr.AsBool())
+	}
+
+	program, err := expr.Compile(source, options...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression '%s': %w", source, err)
+	}
+
+	programs.Store(key, program)
+	return program, nil
+}
+
+// EvalBool evaluates a condition
+func EvalBool(source string, env *Environment) (bool, error) {
+
+	program, err := Compile(source, KindBool)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := expr.Run(program, env)
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate expression '%s': %w", source, err)
+	}
+
+	return result.(bool), nil
+}
+
+// EvalString evaluates a value and converts it to a string. Lists are joined with spaces like scopes,
+// nil results in an empty string.
+func EvalString(source string, env *Environment) (string, error) {
+
+	program, err := Compile(source, KindValue)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := expr.Run(program, env)
+	if err != nil {
+		return "", fmt.Errorf("failed to evaluate expression '%s': %w", source, err)
+	}
+
+	switch v := result.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []string:
+		return strings.Join(v, " "), nil
+	case []any:
+		values := make([]string, len(v))
+		for i, value := range v {
+			values[i] = fmt.Sprint(value)
+		}
+		return strings.Join(values, " "), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// NewEnvironment creates the environment for the session, now should already be in the timezone of the node
+func NewEnvironment(state *model.AuthenticationSession, now time.Time) *Environment {
+
+	env := &Environment{
+		Context: map[string]string{},
+		Request: Request{Headers: map[string]string{}},
+		OAuth2:  OAuth2{Scopes: []string{}, AcrValues: []string{}},
+		User:    User{Attributes: []string{}},
+		Secret:  noSecrets,
+		Time: Time{
+			Hour:    now.Hour(),
+			Minute:  now.Minute(),
+			Weekday: now.Weekday().String(),
+			Date:    now.Format(time.DateOnly),
+			Unix:    now.Unix(),
+		},
+	}
+
+	// Secrets in the context are not visible to expressions
+	for key, value := range state.Context {
+		if !model.IsSensitiveContextKey(key) {
+			env.Context[key] = value
+		}
+	}
+
+	if state.HttpAuthContext != nil {
+		env.Request.IP = state.HttpAuthContext.RequestIP
+		for name, value := range state.HttpAuthContext.RequestHeaders {
+			env.Request.Headers[strings.ToLower(name)] = value
+		}
+	}
+
+	if state.Oauth2SessionInformation != nil && state.Oauth2SessionInformation.AuthorizeRequest != nil {
+		request := state.Oauth2SessionInformation.AuthorizeRequest
+		env.OAuth2.ClientID = request.ClientID
+		env.OAuth2.Prompt = request.Prompt
+		env.OAuth2.Scopes = append(env.OAuth2.Scopes, request.Scope...)
+		env.OAuth2.AcrValues = append(env.OAuth2.AcrValues, request.AcrValues...)
+	} else if state.SimpleAuthSessionInformation != nil && state.SimpleAuthSessionInformation.Request != nil {
+		request := state.SimpleAuthSessionInformation.Request
+		env.OAuth2.ClientID = request.ClientID
+		env.OAuth2.Scopes = append(env.OAuth2.Scopes, strings.Fields(request.Scope)...)
+	}
+
+	if state.User != nil {
+		env.User = newUser(state.User)
+	}
+
+	if state.LastError != nil {
+		env.Error = Error{
+			Node:    state.LastError.Node,
+			Code:    state.LastError.Code,
+			Class:   string(state.LastError.Class),
+			Message: state.LastError.Message,
+		}
+	}
+
+	return env
+}
+
+func newUser(user *model.User) User {
+
+	u := User{
+		Exists:     true,
+		ID:         user.ID,
+		Status:     user.Status,
+		Attributes: []string{},
+	}
+
+	types := map[string]bool{}
+	for _, attr := range user.UserAttributes {
+		types[strings.TrimPrefix(attr.Type, "identityplane:")] = true
+	}
+	for t := range types {
+		u.Attributes = append(u.Attributes, t)
+	}
+	sort.Strings(u.Attributes)
+
+	if emails, _, err := model.GetAttributes[model.EmailAttributeValue](user, model.AttributeTypeEmail); err == nil && len(emails) > 0 {
+		u.Email = emails[0].Email
+		u.EmailVerified = emails[0].Verified
+	}
+	if phones, _, err := model.GetAttributes[model.PhoneAttributeValue](user, model.AttributeTypePhone); err == nil && len(phones) > 0 {
+		u.Phone = phones[0].Phone
+		u.PhoneVerified = phones[0].Verified
+	}
+	if usernames, _, err := model.GetAttributes[model.UsernameAttributeValue](user, model.AttributeTypeUsername); err == nil && len(usernames) > 0 {
+		u.Username = usernames[0].PreferredUsername
+	}
+
+	return u
+}
+
+func noSecrets(name string) (string, error) {
+	return "", fmt.Errorf("secret '%s' is not available here", name)
+}
+
+// WithSecrets returns a copy of the environment in which secret() looks up the secrets of the store
+func (env Environment) WithSecrets(secrets model.SecretStore) *Environment {
+
+	env.Secret = func(name string) (string, error) {
+		if secrets != nil {
+			if secret, ok := secrets.GetSecret(name); ok {
+				return secret, nil
+			}
+		}
+		return "", fmt.Errorf("secret '%s' is not configured", name)
+	}
+
+	return &env
+}
+
+// ipInRange checks if the ip is in the network given in CIDR notation, e.g. ipInRange(request.ip, "10.0.0.0/8")
+func ipInRange(params ...any) (any, error) {
+
+	ip := net.ParseIP(params[0].(string))
+	_, network, err := net.ParseCIDR(params[1].(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return ip != nil && network.Contains(ip), nil
+}
@@ -0,0 +1,132 @@
+package expression
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEnvironment() *Environment {
+	user := &model.User{ID: "user-1", Status: "active"}
+	user.AddAttribute(&model.UserAttribute{Type: model.AttributeTypeEmail, Value: model.EmailAttributeValue{Email: "alice@example.com", Verified: true}})
+	user.AddAttribute(&model.UserAttribute{Type: model.AttributeTypeTOTP, Value: model.TOTPAttributeValue{SecretKey: "secret"}})
+
+	state := &model.AuthenticationSession{
+		Context: map[string]string{"email": "Alice@Example.com", "email_otp": "123456"},
+		User:    user,
+		HttpAuthContext: &model.HttpAuthContext{
+			RequestIP:      "10.1.2.3",
+			RequestHeaders: map[string]string{"User-Agent": "curl/8.0"},
+		},
+		Oauth2SessionInformation: &model.Oauth2Session{
+			AuthorizeRequest: &model.AuthorizeRequest{ClientID: "admin-ui", Scope: []string{"openid", "admin"}, AcrValues: []string{"mfa"}},
+		},
+		LastError: &model.FlowError{Node: "callCrm", Code: model.ErrorCodeTimeout, Class: model.ErrorClassTransient},
+	}
+
+	return NewEnvironment(state, time.Date(2025, 3, 14, 22, 30, 0, 0, time.UTC))
+}
+
+func TestEvalBool(t *testing.T) {
+	env := newTestEnvironment()
+
+	tests := []struct {
+		expression string
+		expected   bool
+	}{
+		{`context.email endsWith "@Example.com"`, true},
+		{`user.exists && user.email_verified`, true},
+		{`"totp" in user.attributes`, true},
+		{`"passkey" in user.attributes`, false},
+		{`ipInRange(request.ip, "10.0.0.0/8")`, true},
+		{`ipInRange(request.ip, "192.168.0.0/16")`, false},
+		{`request.headers["user-agent"] startsWith "curl"`, true},
+		{`oauth2.client_id == "admin-ui" && "admin" in oauth2.scopes`, true},
+		{`"mfa" in oauth2.acr_values`, true},
+		{`time.hour >= 22 || time.hour < 6`, true},
+		{`time.weekday in ["Saturday", "Sunday"]`, false},
+		{`context.unknown == ""`, true},
+		{`error.code == "timeout" && error.class == "transient" && error.node == "callCrm"`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			result, err := EvalBool(test.expression, env)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
+
+func TestEvalString(t *testing.T) {
+	env := newTestEnvironment()
+
+	value, err := EvalString(`lower(context.email)`, env)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", value)
+
+	value, err = EvalString(`time.hour * 60 + time.minute`, env)
+	require.NoError(t, err)
+	assert.Equal(t, "1350", value)
+
+	value, err = EvalString(`oauth2.scopes`, env)
+	require.NoError(t, err)
+	assert.Equal(t, "openid admin", value)
+}
+
+func TestSecretsAreNotVisible(t *testing.T) {
+	env := newTestEnvironment()
+
+	value, err := EvalString(`context.email_otp`, env)
+	require.NoError(t, err)
+	assert.Empty(t, value)
+
+	// Attribute values are not part of the environment
+	_, err = Compile(`user.attributes.totp.secret`, KindValue)
+	assert.Error(t, err)
+}
+
+func TestServerSecrets(t *testing.T) {
+	env := newTestEnvironment()
+
+	// Server secrets are only available if the node provides them
+	_, err := EvalString(`secret("crm_api_key")`, env)
+	assert.ErrorContains(t, err, "not available")
+
+	store := staticSecrets{"crm_api_key": "key-1"}
+	value, err := EvalString(`"Bearer " + secret("crm_api_key")`, env.WithSecrets(store))
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer key-1", value)
+
+	_, err = EvalString(`secret("unknown")`, env.WithSecrets(store))
+	assert.ErrorContains(t, err, "not configured")
+}
+
+type staticSecrets map[string]string
+
+func (s staticSecrets) GetSecret(name string) (string, bool) {
+	secret, ok := s[name]
+	return secret, ok
+}
+
+func TestCompileErrors(t *testing.T) {
+	_, err := Compile(`context.email ==`, KindBool)
+	assert.Error(t, err)
+
+	_, err = Compile(`context.email`, KindBool)
+	assert.Error(t, err)
+
+	_, err = Compile(`request.unknown == "x"`, KindBool)
+	assert.Error(t, err)
+}
+
+func TestEnvironmentWithoutUser(t *testing.T) {
+	env := NewEnvironment(&model.AuthenticationSession{Context: map[string]string{}}, time.Now())
+
+	result, err := EvalBool(`!user.exists && len(user.attributes) == 0 && request.ip == "" && error.code == ""`, env)
+	require.NoError(t, err)
+	assert.True(t, result)
+}
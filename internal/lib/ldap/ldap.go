@@ -0,0 +1,369 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// Names of the directory settings. The ldapBind node reads them from its custom config, which falls back to the
+// realm settings, and the sync job reads them from the realm settings.
+const (
+	SettingUrl                  = "ldap_url"
+	SettingStartTLS             = "ldap_start_tls"
+	SettingCaCertificate        = "ldap_ca_certificate"
+	SettingBindDn               = "ldap_bind_dn"
+	SettingBindPassword         = "ldap_bind_password"
+	SettingBaseDn               = "ldap_base_dn"
+	SettingUserFilter           = "ldap_user_filter"
+	SettingUsernameAttribute    = "ldap_username_attribute"
+	SettingIdAttribute          = "ldap_id_attribute"
+	SettingAttributeMapping     = "ldap_attribute_mapping"
+	SettingLinkBy               = "ldap_link_by"
+	SettingTimeout              = "ldap_timeout"
+	SettingSync                 = "ldap_sync"
+	SettingGroupBaseDn          = "ldap_group_base_dn"
+	SettingGroupFilter          = "ldap_group_filter"
+	SettingGroupMemberAttribute = "ldap_group_member_attribute"
+	SettingGroupResourcePrefix  = "ldap_group_resource_prefix"
+)
+
+// Defaults of the settings, they fit OpenLDAP. Active Directory uses sAMAccountName and objectGUID instead.
+const (
+	DefaultStartTLS             = "true"
+	DefaultUserFilter           = "(objectClass=person)"
+	DefaultUsernameAttribute    = "uid"
+	DefaultIdAttribute          = "entryUUID"
+	DefaultAttributeMapping     = "mail: email\ngivenName: given_name\nsn: family_name\ncn: name"
+	DefaultLinkBy               = LinkByNone
+	DefaultTimeout              = "10s"
+	DefaultGroupFilter          = "(|(objectClass=groupOfNames)(objectClass=groupOfUniqueNames)(objectClass=group))"
+	DefaultGroupMemberAttribute = "member"
+	DefaultGroupResourcePrefix  = "group:"
+)
+
+// Existing users a directory entry can be linked to if no user has its ldap attribute yet
+const (
+	LinkByNone     = "none"
+	LinkByUsername = "username"
+	LinkByEmail    = "email"
+)
+
+// pageSize is the number of entries that are requested at once when all users or groups are searched
+const pageSize = 500
+
+var (
+	// ErrInvalidCredentials is returned if the user is not found or the password is wrong
+	ErrInvalidCredentials = errors.New("invalid username or password")
+)
+
+// Config is the configuration of a directory
+type Config struct {
+	Url               string
+	StartTLS          bool           // Upgrade ldap:// connections with StartTLS, ldaps:// connections always use TLS
+	RootCAs           *x509.CertPool // Certificates to trust, the system pool is used if nil
+	BindDn            string         // Service account that searches the directory, anonymous if empty
+	BindPassword      string
+	BaseDn            string
+	UserFilter        string
+	UsernameAttribute string
+	IdAttribute       string
+	AttributeMapping  map[string]string // directory attribute -> field of the user
+	LinkBy            string
+	Timeout           time.Duration
+
+	Sync                 bool // Import the users and groups with the sync job
+	GroupBaseDn          string
+	GroupFilter          string
+	GroupMemberAttribute string
+	GroupResourcePrefix  string
+}
+
+// ParseConfig reads the configuration from the settings, empty settings use their default
+func ParseConfig(setting func(name string) string) (*Config, error) {
+
+	get := func(name, defaultValue string) string {
+		if value := strings.TrimSpace(setting(name)); value != "" {
+			return value
+		}
+		return defaultValue
+	}
+
+	cfg := &Config{
+		Url:                  get(SettingUrl, ""),
+		BindDn:               get(SettingBindDn, ""),
+		BindPassword:         setting(SettingBindPassword),
+		BaseDn:               get(SettingBaseDn, ""),
+		UserFilter:           get(SettingUserFilter, DefaultUserFilter),
+		UsernameAttribute:    get(SettingUsernameAttribute, DefaultUsernameAttribute),
+		IdAttribute:          get(SettingIdAttribute, DefaultIdAttribute),
+		LinkBy:               get(SettingLinkBy, DefaultLinkBy),
+		GroupFilter:          get(SettingGroupFilter, DefaultGroupFilter),
+		GroupMemberAttribute: get(SettingGroupMemberAttribute, DefaultGroupMemberAttribute),
+		GroupResourcePrefix:  get(SettingGroupResourcePrefix, DefaultGroupResourcePrefix),
+	}
+	cfg.GroupBaseDn = get(SettingGroupBaseDn, cfg.BaseDn)
+
+	if cfg.Url == "" {
+		return nil, fmt.Errorf("%s is required", SettingUrl)
+	}
+	u, err := url.Parse(cfg.Url)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return nil, fmt.Errorf("%s must be an ldap:// or ldaps:// url", SettingUrl)
+	}
+	if cfg.BaseDn == "" {
+		return nil, fmt.Errorf("%s is required", SettingBaseDn)
+	}
+
+	if cfg.StartTLS, err = strconv.ParseBool(get(SettingStartTLS, DefaultStartTLS)); err != nil {
+		return nil, fmt.Errorf("%s is not a boolean", SettingStartTLS)
+	}
+	if cfg.Sync, err = strconv.ParseBool(get(SettingSync, "false")); err != nil {
+		return nil, fmt.Errorf("%s is not a boolean", SettingSync)
+	}
+	if cfg.Timeout, err = time.ParseDuration(get(SettingTimeout, DefaultTimeout)); err != nil {
+		return nil, fmt.Errorf("%s is not a duration", SettingTimeout)
+	}
+
+	if certificates := setting(SettingCaCertificate); strings.TrimSpace(certificates) != "" {
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM([]byte(certificates)) {
+			return nil, fmt.Errorf("%s contains no PEM encoded certificate", SettingCaCertificate)
+		}
+	}
+
+	switch cfg.LinkBy {
+	case LinkByNone, LinkByUsername, LinkByEmail:
+	default:
+		return nil, fmt.Errorf("%s must be one of %s, %s, %s", SettingLinkBy, LinkByNone, LinkByUsername, LinkByEmail)
+	}
+
+	if cfg.AttributeMapping, err = parseAttributeMapping(get(SettingAttributeMapping, DefaultAttributeMapping)); err != nil {
+		return nil, fmt.Errorf("%s: %w", SettingAttributeMapping, err)
+	}
+
+	return cfg, nil
+}
+
+// Entry is a user or group of the directory
+type Entry struct {
+	DN         string
+	attributes map[string][][]byte // by lower case attribute name
+}
+
+func newEntry(entry *goldap.Entry) *Entry {
+	e := &Entry{DN: entry.DN, attributes: map[string][][]byte{}}
+	for _, attribute := range entry.Attributes {
+		name := strings.ToLower(attribute.Name)
+		e.attributes[name] = append(e.attributes[name], attribute.ByteValues...)
+	}
+	return e
+}
+
+// Values returns the values of the attribute, attribute names are case insensitive
+func (e *Entry) Values(name string) []string {
+	var values []string
+	for _, value := range e.attributes[strings.ToLower(name)] {
+		values = append(values, string(value))
+	}
+	return values
+}
+
+// Value returns the first value of the attribute or an empty string
+func (e *Entry) Value(name string) string {
+	values := e.attributes[strings.ToLower(name)]
+	if len(values) == 0 {
+		return ""
+	}
+	return string(values[0])
+}
+
+// id returns the unique id of the entry. The binary objectGUID of Active Directory is formatted like AD shows it.
+func (e *Entry) id(attribute string) string {
+	values := e.attributes[strings.ToLower(attribute)]
+	if len(values) == 0 {
+		return ""
+	}
+
+	value := values[0]
+	if strings.EqualFold(attribute, "objectGUID") && len(value) == 16 {
+		return fmt.Sprintf("%02x%02x%02x%02x-%02x%02x-%02x%02x-%x-%x",
+			value[3], value[2], value[1], value[0], value[5], value[4], value[7], value[6], value[8:10], value[10:])
+	}
+	return string(value)
+}
+
+// Group is a group of the directory with the normalized DNs of its members
+type Group struct {
+	DN      string
+	Name    string
+	members map[string]bool
+}
+
+// HasMember checks if the entry is a member of the group
+func (g *Group) HasMember(entry *Entry) bool {
+	return g.members[normalizeDn(entry.DN)]
+}
+
+// Directory is a connection to the directory that is bound as the service account
+type Directory struct {
+	cfg  *Config
+	conn *goldap.Conn
+}
+
+// Connect opens a connection to the directory, secures it with StartTLS and binds as the service account
+func Connect(cfg *Config) (*Directory, error) {
+
+	u, err := url.Parse(cfg.Url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName: u.Hostname(),
+		RootCAs:    cfg.RootCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	conn, err := goldap.DialURL(cfg.Url,
+		goldap.DialWithDialer(&net.Dialer{Timeout: cfg.Timeout}),
+		goldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", u.Host, err)
+	}
+	conn.SetTimeout(cfg.Timeout)
+
+	if u.Scheme == "ldap" && cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+
+	d := &Directory{cfg: cfg, conn: conn}
+	if err := d.bindServiceAccount(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// Close closes the connection
+func (d *Directory) Close() {
+	d.conn.Close()
+}
+
+func (d *Directory) bindServiceAccount() error {
+	if d.cfg.BindDn == "" {
+		return nil
+	}
+	if err := d.conn.Bind(d.cfg.BindDn, d.cfg.BindPassword); err != nil {
+		return fmt.Errorf("failed to bind as %s: %w", d.cfg.BindDn, err)
+	}
+	return nil
+}
+
+// Authenticate searches the user by the username and binds with the password. It returns ErrInvalidCredentials if
+// the user does not exist or the password is wrong. The connection is bound as the user afterwards.
+func (d *Directory) Authenticate(username, password string) (*Entry, error) {
+
+	// An empty password would be an unauthenticated bind, which many servers accept
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	filter := fmt.Sprintf("(&%s(%s=%s))", d.cfg.UserFilter, d.cfg.UsernameAttribute, goldap.EscapeFilter(username))
+	entries, err := d.search(d.cfg.BaseDn, filter, d.userAttributes(), false)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrInvalidCredentials
+	}
+	if len(entries) > 1 {
+		return nil, fmt.Errorf("username %s matches %d entries", username, len(entries))
+	}
+
+	entry := entries[0]
+	if err := d.conn.Bind(entry.DN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to bind as %s: %w", entry.DN, err)
+	}
+
+	return entry, nil
+}
+
+// SearchUsers returns all users that match the user filter
+func (d *Directory) SearchUsers() ([]*Entry, error) {
+	return d.search(d.cfg.BaseDn, d.cfg.UserFilter, d.userAttributes(), true)
+}
+
+// SearchGroups returns all groups that match the group filter
+func (d *Directory) SearchGroups() ([]*Group, error) {
+	entries, err := d.search(d.cfg.GroupBaseDn, d.cfg.GroupFilter, []string{"cn", d.cfg.GroupMemberAttribute}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]*Group, 0, len(entries))
+	for _, entry := range entries {
+		group := &Group{DN: entry.DN, Name: entry.Value("cn"), members: map[string]bool{}}
+		if group.Name == "" {
+			group.Name = entry.DN
+		}
+		for _, member := range entry.Values(d.cfg.GroupMemberAttribute) {
+			group.members[normalizeDn(member)] = true
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// userAttributes are the attributes that are read of users
+func (d *Directory) userAttributes() []string {
+	attributes := []string{d.cfg.IdAttribute, d.cfg.UsernameAttribute}
+	for attribute := range d.cfg.AttributeMapping {
+		attributes = append(attributes, attribute)
+	}
+	return attributes
+}
+
+func (d *Directory) search(baseDn, filter string, attributes []string, paged bool) ([]*Entry, error) {
+	request := goldap.NewSearchRequest(baseDn, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, int(d.cfg.Timeout.Seconds()), false, filter, attributes, nil)
+
+	var result *goldap.SearchResult
+	var err error
+	if paged {
+		result, err = d.conn.SearchWithPaging(request, pageSize)
+	} else {
+		result, err = d.conn.Search(request)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %s: %w", baseDn, err)
+	}
+
+	entries := make([]*Entry, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		entries = append(entries, newEntry(entry))
+	}
+	return entries, nil
+}
+
+// normalizeDn returns the DN in a form that can be compared, DNs that cannot be parsed are only lower cased
+func normalizeDn(dn string) string {
+	parsed, err := goldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(dn)
+	}
+	return strings.ToLower(parsed.String())
+}
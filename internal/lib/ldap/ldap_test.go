@@ -0,0 +1,302 @@
+package ldap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Identityplane/GoAM/internal/auth/repository"
+	"github.com/Identityplane/GoAM/internal/lib/ldap/ldaptest"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testBaseDn        = "dc=example,dc=com"
+	testServiceDn     = "cn=goam,ou=services,dc=example,dc=com"
+	testServicePasswd = "service-secret"
+	testJaneDn        = "uid=jane,ou=people,dc=example,dc=com"
+	testJohnDn        = "uid=john,ou=people,dc=example,dc=com"
+)
+
+// newTestDirectory starts a server with a service account, two users and a group
+func newTestDirectory(t *testing.T) (*ldaptest.Server, map[string]string) {
+	server := ldaptest.NewServer(t)
+
+	server.AddEntry(testServiceDn, testServicePasswd, map[string][]string{"objectClass": {"applicationProcess"}, "cn": {"goam"}})
+	server.AddEntry(testJaneDn, "jane-secret", map[string][]string{
+		"objectClass": {"inetOrgPerson", "person"},
+		"uid":         {"jane"},
+		"entryUUID":   {"7b1e4f0c-8f55-4d42-a3c5-3c1f3d5e9a10"},
+		"mail":        {"jane@example.com"},
+		"givenName":   {"Jane"},
+		"sn":          {"Doe"},
+		"cn":          {"Jane Doe"},
+	})
+	server.AddEntry(testJohnDn, "john-secret", map[string][]string{
+		"objectClass": {"inetOrgPerson", "person"},
+		"uid":         {"john"},
+		"entryUUID":   {"0c8e2d9b-1f0a-4a8e-9a1c-1d9a8b7c6e5f"},
+		"mail":        {"john@example.com"},
+		"cn":          {"John Smith"},
+	})
+	server.AddEntry("cn=staff,ou=groups,dc=example,dc=com", "", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"staff"},
+		"member":      {testJaneDn, "UID=John, OU=People, DC=Example, DC=Com"},
+	})
+	server.AddEntry("cn=admins,ou=groups,dc=example,dc=com", "", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"admins"},
+		"member":      {testJaneDn},
+	})
+
+	settings := map[string]string{
+		SettingUrl:           server.URL,
+		SettingCaCertificate: server.CertificatePEM(),
+		SettingBindDn:        testServiceDn,
+		SettingBindPassword:  testServicePasswd,
+		SettingBaseDn:        testBaseDn,
+	}
+	return server, settings
+}
+
+func parseTestConfig(t *testing.T, settings map[string]string) *Config {
+	cfg, err := ParseConfig(func(name string) string { return settings[name] })
+	require.NoError(t, err)
+	return cfg
+}
+
+func TestParseConfig(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		cfg := parseTestConfig(t, map[string]string{SettingUrl: "ldap://ldap.example.com", SettingBaseDn: testBaseDn})
+
+		assert.True(t, cfg.StartTLS)
+		assert.False(t, cfg.Sync)
+		assert.Equal(t, "uid", cfg.UsernameAttribute)
+		assert.Equal(t, "entryUUID", cfg.IdAttribute)
+		assert.Equal(t, LinkByNone, cfg.LinkBy)
+		assert.Equal(t, testBaseDn, cfg.GroupBaseDn)
+		assert.Equal(t, map[string]string{"mail": "email", "givenName": "given_name", "sn": "family_name", "cn": "name"}, cfg.AttributeMapping)
+	})
+
+	invalid := []struct {
+		name     string
+		settings map[string]string
+	}{
+		{"missing url", map[string]string{SettingBaseDn: testBaseDn}},
+		{"http url", map[string]string{SettingUrl: "https://ldap.example.com", SettingBaseDn: testBaseDn}},
+		{"missing base dn", map[string]string{SettingUrl: "ldap://ldap.example.com"}},
+		{"invalid link by", map[string]string{SettingUrl: "ldap://ldap.example.com", SettingBaseDn: testBaseDn, SettingLinkBy: "phone"}},
+		{"unknown field", map[string]string{SettingUrl: "ldap://ldap.example.com", SettingBaseDn: testBaseDn, SettingAttributeMapping: "mail: mail"}},
+		{"invalid certificate", map[string]string{SettingUrl: "ldap://ldap.example.com", SettingBaseDn: testBaseDn, SettingCaCertificate: "not a certificate"}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfig(func(name string) string { return tt.settings[name] })
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	server, settings := newTestDirectory(t)
+	cfg := parseTestConfig(t, settings)
+
+	authenticate := func(username, password string) (*Entry, error) {
+		directory, err := Connect(cfg)
+		require.NoError(t, err)
+		defer directory.Close()
+		return directory.Authenticate(username, password)
+	}
+
+	t.Run("valid password", func(t *testing.T) {
+		entry, err := authenticate("jane", "jane-secret")
+		require.NoError(t, err)
+		assert.Equal(t, testJaneDn, entry.DN)
+		assert.Equal(t, "jane@example.com", entry.Value("MAIL"))
+		assert.Contains(t, server.Binds(), testJaneDn)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		_, err := authenticate("jane", "wrong")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("empty password is not an unauthenticated bind", func(t *testing.T) {
+		_, err := authenticate("jane", "")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		_, err := authenticate("nobody", "secret")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("filter injection", func(t *testing.T) {
+		_, err := authenticate("*", "jane-secret")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("without StartTLS", func(t *testing.T) {
+		plain := parseTestConfig(t, settings)
+		plain.StartTLS = false
+		_, err := Connect(plain)
+		assert.ErrorContains(t, err, "Confidentiality Required")
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		untrusted := parseTestConfig(t, settings)
+		untrusted.RootCAs = nil
+		_, err := Connect(untrusted)
+		assert.ErrorContains(t, err, "failed to start tls")
+	})
+}
+
+func TestSearch(t *testing.T) {
+	_, settings := newTestDirectory(t)
+	cfg := parseTestConfig(t, settings)
+
+	directory, err := Connect(cfg)
+	require.NoError(t, err)
+	defer directory.Close()
+
+	users, err := directory.SearchUsers()
+	require.NoError(t, err)
+	assert.Len(t, users, 2)
+
+	groups, err := directory.SearchGroups()
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+
+	jane := &Entry{DN: testJaneDn}
+	john := &Entry{DN: testJohnDn}
+	for _, group := range groups {
+		assert.True(t, group.HasMember(jane), group.Name)
+		assert.Equal(t, group.Name == "staff", group.HasMember(john), group.Name)
+	}
+}
+
+func TestProvisionUser(t *testing.T) {
+	_, settings := newTestDirectory(t)
+	ctx := context.Background()
+
+	repo, err := repository.NewTestUserRepository("acme", "staff")
+	require.NoError(t, err)
+	defer repo.Close()
+
+	cfg := parseTestConfig(t, settings)
+	directory, err := Connect(cfg)
+	require.NoError(t, err)
+	defer directory.Close()
+
+	users, err := directory.SearchUsers()
+	require.NoError(t, err)
+	groups, err := directory.SearchGroups()
+	require.NoError(t, err)
+
+	var jane *Entry
+	for _, user := range users {
+		if user.DN == testJaneDn {
+			jane = user
+		}
+	}
+	require.NotNil(t, jane)
+
+	t.Run("new user", func(t *testing.T) {
+		user, err := FindUser(ctx, repo, cfg, jane)
+		require.NoError(t, err)
+		assert.Nil(t, user)
+
+		user = &model.User{Status: "active"}
+		changed, err := ApplyEntry(user, cfg, jane)
+		require.NoError(t, err)
+		assert.True(t, changed)
+		changed, err = ApplyGroups(user, cfg, jane, groups)
+		require.NoError(t, err)
+		assert.True(t, changed)
+		require.NoError(t, repo.Create(ctx, user))
+
+		stored, err := FindUser(ctx, repo, cfg, jane)
+		require.NoError(t, err)
+		require.NotNil(t, stored)
+		assert.Equal(t, user.ID, stored.ID)
+
+		username, _, err := model.GetAttribute[model.UsernameAttributeValue](stored, model.AttributeTypeUsername)
+		require.NoError(t, err)
+		assert.Equal(t, "jane", username.PreferredUsername)
+		assert.Equal(t, "Jane", username.GivenName)
+		assert.Equal(t, "Jane Doe", username.Name)
+
+		email, _, err := model.GetAttribute[model.EmailAttributeValue](stored, model.AttributeTypeEmail)
+		require.NoError(t, err)
+		assert.Equal(t, "jane@example.com", email.Email)
+		assert.True(t, email.Verified)
+
+		entitlements, _, err := model.GetAttribute[model.EntitlementSetAttributeValue](stored, model.AttributeTypeEntitlements)
+		require.NoError(t, err)
+		require.Len(t, entitlements.Entitlements, 2)
+		assert.Equal(t, "group:admins", entitlements.Entitlements[0].Resource)
+		assert.Equal(t, "member", entitlements.Entitlements[0].Action)
+		assert.Equal(t, EntitlementSource, entitlements.Entitlements[0].Source)
+
+		// Applying the same entry again does not change the stored user
+		changed, err = ApplyEntry(stored, cfg, jane)
+		require.NoError(t, err)
+		assert.False(t, changed)
+		changed, err = ApplyGroups(stored, cfg, jane, groups)
+		require.NoError(t, err)
+		assert.False(t, changed)
+	})
+
+	t.Run("group removed, other entitlements are kept", func(t *testing.T) {
+		user, err := FindUser(ctx, repo, cfg, jane)
+		require.NoError(t, err)
+
+		user.AddAttribute(&model.UserAttribute{
+			Type: model.AttributeTypeEntitlements,
+			Value: &model.EntitlementSetAttributeValue{Entitlements: []model.Entitlement{
+				{Resource: "/admin/acme/staff", Action: "GET", Effect: model.EffectTypeAllow},
+			}},
+		})
+
+		changed, err := ApplyGroups(user, cfg, jane, groups[:0])
+		require.NoError(t, err)
+		assert.True(t, changed)
+
+		values, _, err := model.GetAttributes[model.EntitlementSetAttributeValue](user, model.AttributeTypeEntitlements)
+		require.NoError(t, err)
+		var resources []string
+		for _, value := range values {
+			for _, entitlement := range value.Entitlements {
+				resources = append(resources, entitlement.Resource)
+			}
+		}
+		assert.Equal(t, []string{"/admin/acme/staff"}, resources)
+	})
+
+	t.Run("link by username", func(t *testing.T) {
+		var john *Entry
+		for _, user := range users {
+			if user.DN == testJohnDn {
+				john = user
+			}
+		}
+
+		username := "john"
+		local := &model.User{Status: "active"}
+		local.AddAttribute(&model.UserAttribute{Index: &username, Type: model.AttributeTypeUsername, Value: &model.UsernameAttributeValue{PreferredUsername: username}})
+		require.NoError(t, repo.Create(ctx, local))
+
+		user, err := FindUser(ctx, repo, cfg, john)
+		require.NoError(t, err)
+		assert.Nil(t, user, "users are not linked by default")
+
+		linking := *cfg
+		linking.LinkBy = LinkByUsername
+		user, err = FindUser(ctx, repo, &linking, john)
+		require.NoError(t, err)
+		require.NotNil(t, user)
+		assert.Equal(t, local.ID, user.ID)
+	})
+}
@@ -0,0 +1,408 @@
+// Package ldaptest provides an in-process LDAP server to test the directory integration without a real directory.
+// It supports StartTLS, simple binds and subtree searches with the filters the directory client sends.
+//
+//	server := ldaptest.NewServer(t)
+//	server.AddEntry("uid=jane,ou=people,dc=example,dc=com", "secret", map[string][]string{"uid": {"jane"}})
+//	settings := map[string]string{"ldap_url": server.URL, "ldap_ca_certificate": server.CertificatePEM(), ...}
+package ldaptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+const oidStartTLS = "1.3.6.1.4.1.1466.20037"
+
+// Server is an LDAP server that listens on localhost. Binds and searches require StartTLS, searches also require
+// a bind with a password.
+type Server struct {
+	URL string
+
+	listener    net.Listener
+	tlsConfig   *tls.Config
+	certificate []byte
+
+	mutex   sync.Mutex
+	entries map[string]*entry // by normalized DN
+	binds   []string
+}
+
+type entry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// NewServer starts a server that is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	certificate, key, err := selfSignedCertificate()
+	if err != nil {
+		listener.Close()
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	s := &Server{
+		URL:         "ldap://" + listener.Addr().String(),
+		listener:    listener,
+		certificate: certificate,
+		tlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{certificate}, PrivateKey: key}},
+		},
+		entries: map[string]*entry{},
+	}
+
+	go s.accept()
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	s.listener.Close()
+}
+
+// CertificatePEM returns the certificate of the server, clients need to trust it for StartTLS
+func (s *Server) CertificatePEM() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.certificate}))
+}
+
+// AddEntry adds or replaces an entry. Entries with a password can bind.
+func (s *Server) AddEntry(dn, password string, attributes map[string][]string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries[normalize(dn)] = &entry{dn: dn, password: password, attributes: attributes}
+}
+
+// RemoveEntry removes an entry
+func (s *Server) RemoveEntry(dn string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, normalize(dn))
+}
+
+// Binds returns the DNs of the successful binds
+func (s *Server) Binds() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.binds...)
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serve(conn)
+	}
+}
+
+// serve handles the requests of a connection until it is closed or the client unbinds
+func (s *Server) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	secure := false
+	bound := ""
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+
+		messageID, _ := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+
+		switch request.Tag {
+		case goldap.ApplicationUnbindRequest:
+			return
+
+		case goldap.ApplicationExtendedRequest:
+			if len(request.Children) == 0 || request.Children[0].Data.String() != oidStartTLS || secure {
+				s.write(conn, result(messageID, goldap.ApplicationExtendedResponse, goldap.LDAPResultUnwillingToPerform, "unsupported extended operation"))
+				continue
+			}
+			if !s.write(conn, result(messageID, goldap.ApplicationExtendedResponse, goldap.LDAPResultSuccess, "")) {
+				return
+			}
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			secure = true
+
+		case goldap.ApplicationBindRequest:
+			code := s.bind(request, secure)
+			if code == goldap.LDAPResultSuccess {
+				bound = request.Children[1].Data.String()
+			} else {
+				bound = ""
+			}
+			s.write(conn, result(messageID, goldap.ApplicationBindResponse, code, ""))
+
+		case goldap.ApplicationSearchRequest:
+			code := uint16(goldap.LDAPResultSuccess)
+			switch {
+			case !secure:
+				code = goldap.LDAPResultConfidentialityRequired
+			case bound == "":
+				code = goldap.LDAPResultInsufficientAccessRights
+			default:
+				for _, response := range s.search(messageID, request) {
+					if !s.write(conn, response) {
+						return
+					}
+				}
+			}
+			s.write(conn, result(messageID, goldap.ApplicationSearchResultDone, code, ""))
+
+		case goldap.ApplicationAbandonRequest:
+			// nothing to abandon, results are sent right away
+
+		default:
+			s.write(conn, result(messageID, goldap.ApplicationExtendedResponse, goldap.LDAPResultUnwillingToPerform, "unsupported operation"))
+		}
+	}
+}
+
+// bind checks a simple bind. Like most servers an empty password is an unauthenticated bind that succeeds.
+func (s *Server) bind(request *ber.Packet, secure bool) uint16 {
+	if len(request.Children) < 3 {
+		return goldap.LDAPResultProtocolError
+	}
+	if !secure {
+		return goldap.LDAPResultConfidentialityRequired
+	}
+
+	dn := request.Children[1].Data.String()
+	password := request.Children[2].Data.String()
+	if dn == "" || password == "" {
+		return goldap.LDAPResultSuccess
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e := s.entries[normalize(dn)]
+	if e == nil || e.password == "" || e.password != password {
+		return goldap.LDAPResultInvalidCredentials
+	}
+	s.binds = append(s.binds, dn)
+	return goldap.LDAPResultSuccess
+}
+
+// search returns the result entries of a subtree search
+func (s *Server) search(messageID int64, request *ber.Packet) []*ber.Packet {
+	if len(request.Children) < 8 {
+		return nil
+	}
+
+	base := normalize(request.Children[0].Data.String())
+	filter := request.Children[6]
+	var requested []string
+	for _, attribute := range request.Children[7].Children {
+		requested = append(requested, attribute.Data.String())
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var responses []*ber.Packet
+	for normalized, e := range s.entries {
+		if normalized != base && !strings.HasSuffix(normalized, ","+base) {
+			continue
+		}
+		if !e.matches(filter) {
+			continue
+		}
+
+		response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+		response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "Object Name"))
+		attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+		for name, values := range e.attributes {
+			if !isRequested(requested, name) {
+				continue
+			}
+			attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+			attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+			for _, value := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+			}
+			attribute.AppendChild(set)
+			attributes.AppendChild(attribute)
+		}
+		response.AppendChild(attributes)
+
+		responses = append(responses, envelope(messageID, response))
+	}
+	return responses
+}
+
+// matches evaluates a search filter, values are compared case insensitive
+func (e *entry) matches(filter *ber.Packet) bool {
+	switch filter.Tag {
+	case goldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !e.matches(child) {
+				return false
+			}
+		}
+		return true
+	case goldap.FilterOr:
+		for _, child := range filter.Children {
+			if e.matches(child) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterNot:
+		return len(filter.Children) == 1 && !e.matches(filter.Children[0])
+	case goldap.FilterPresent:
+		return len(e.values(filter.Data.String())) > 0
+	case goldap.FilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		for _, value := range e.values(filter.Children[0].Data.String()) {
+			if strings.EqualFold(value, filter.Children[1].Data.String()) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterSubstrings:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		for _, value := range e.values(filter.Children[0].Data.String()) {
+			if matchesSubstrings(strings.ToLower(value), filter.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func (e *entry) values(name string) []string {
+	for attribute, values := range e.attributes {
+		if strings.EqualFold(attribute, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+func matchesSubstrings(value string, parts []*ber.Packet) bool {
+	for _, part := range parts {
+		substring := strings.ToLower(part.Data.String())
+		switch part.Tag {
+		case goldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, substring) {
+				return false
+			}
+			value = value[len(substring):]
+		case goldap.FilterSubstringsAny:
+			index := strings.Index(value, substring)
+			if index < 0 {
+				return false
+			}
+			value = value[index+len(substring):]
+		case goldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(value, substring) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isRequested(requested []string, name string) bool {
+	if len(requested) == 0 {
+		return true
+	}
+	for _, attribute := range requested {
+		if attribute == "*" || strings.EqualFold(attribute, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) write(conn net.Conn, packet *ber.Packet) bool {
+	_, err := conn.Write(packet.Bytes())
+	return err == nil
+}
+
+// result creates a response with a result code, e.g. a bind response
+func result(messageID int64, tag ber.Tag, code uint16, message string) *ber.Packet {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+	return envelope(messageID, response)
+}
+
+func envelope(messageID int64, response *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	packet.AppendChild(response)
+	return packet
+}
+
+func normalize(dn string) string {
+	parsed, err := goldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(dn)
+	}
+	return strings.ToLower(parsed.String())
+}
+
+// selfSignedCertificate creates a certificate for localhost
+func selfSignedCertificate() ([]byte, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	return certificate, key, err
+}
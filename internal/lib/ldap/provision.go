@@ -0,0 +1,320 @@
+package ldap
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// EntitlementSource marks the entitlements of a user that come from directory groups, the sync job replaces them
+const EntitlementSource = "ldap"
+
+// Fields of the user that directory attributes can be mapped to
+const (
+	FieldEmail = "email"
+	FieldPhone = "phone"
+)
+
+// usernameFields are the fields of the username attribute that directory attributes can be mapped to
+var usernameFields = map[string]func(*model.UsernameAttributeValue) *string{
+	"preferred_username": func(v *model.UsernameAttributeValue) *string { return &v.PreferredUsername },
+	"name":               func(v *model.UsernameAttributeValue) *string { return &v.Name },
+	"given_name":         func(v *model.UsernameAttributeValue) *string { return &v.GivenName },
+	"middle_name":        func(v *model.UsernameAttributeValue) *string { return &v.MiddleName },
+	"family_name":        func(v *model.UsernameAttributeValue) *string { return &v.FamilyName },
+	"nickname":           func(v *model.UsernameAttributeValue) *string { return &v.Nickname },
+	"locale":             func(v *model.UsernameAttributeValue) *string { return &v.Locale },
+	"zoneinfo":           func(v *model.UsernameAttributeValue) *string { return &v.Zoneinfo },
+	"picture":            func(v *model.UsernameAttributeValue) *string { return &v.Picture },
+	"profile":            func(v *model.UsernameAttributeValue) *string { return &v.Profile },
+	"website":            func(v *model.UsernameAttributeValue) *string { return &v.Website },
+}
+
+// parseAttributeMapping parses one mapping per line as 'directory attribute: field', e.g. 'mail: email'
+func parseAttributeMapping(value string) (map[string]string, error) {
+	mapping := map[string]string{}
+
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		attribute, field, ok := strings.Cut(line, ":")
+		attribute, field = strings.TrimSpace(attribute), strings.TrimSpace(field)
+		if !ok || attribute == "" || field == "" {
+			return nil, fmt.Errorf("invalid mapping '%s', expected 'attribute: field'", line)
+		}
+		if _, ok := usernameFields[field]; !ok && field != FieldEmail && field != FieldPhone {
+			return nil, fmt.Errorf("unknown field '%s'", field)
+		}
+		mapping[attribute] = field
+	}
+
+	return mapping, nil
+}
+
+// FindUser returns the user of the directory entry. That is the user with the ldap attribute of the entry or, if
+// there is none, an existing user that is linked by username or email. Returns nil if there is no user yet.
+func FindUser(ctx context.Context, repo model.UserRepository, cfg *Config, entry *Entry) (*model.User, error) {
+
+	id := entry.id(cfg.IdAttribute)
+	if id == "" {
+		return nil, fmt.Errorf("entry %s has no %s", entry.DN, cfg.IdAttribute)
+	}
+
+	user, err := repo.GetByAttributeIndex(ctx, model.AttributeTypeLdap, id)
+	if err != nil || user != nil {
+		return user, err
+	}
+
+	switch cfg.LinkBy {
+	case LinkByUsername:
+		user, err = repo.GetByAttributeIndex(ctx, model.AttributeTypeUsername, entry.Value(cfg.UsernameAttribute))
+	case LinkByEmail:
+		if email := mappedValue(cfg, entry, FieldEmail); email != "" {
+			user, err = repo.GetByAttributeIndex(ctx, model.AttributeTypeEmail, email)
+		}
+	}
+	if err != nil || user == nil {
+		return nil, err
+	}
+
+	// A user that is already linked to another entry is not taken over
+	if attrs := user.GetAttributesByType(model.AttributeTypeLdap); len(attrs) > 0 {
+		return nil, fmt.Errorf("user %s is already linked to another directory entry", user.ID)
+	}
+	return user, nil
+}
+
+// Provision creates or updates the user of the entry and returns it with whether it was created or changed. newUser
+// creates the model of a user that does not exist yet. The entitlements of the groups are only set if groups is not nil.
+func Provision(ctx context.Context, repo model.UserRepository, cfg *Config, entry *Entry, groups []*Group, newUser func() (*model.User, error)) (*model.User, bool, error) {
+
+	user, err := FindUser(ctx, repo, cfg, entry)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to find user of %s: %w", entry.DN, err)
+	}
+
+	created := user == nil
+	if created {
+		if user, err = newUser(); err != nil {
+			return nil, false, fmt.Errorf("failed to create user: %w", err)
+		}
+	}
+
+	changed, err := ApplyEntry(user, cfg, entry)
+	if err != nil {
+		return nil, false, err
+	}
+	if groups != nil {
+		groupsChanged, err := ApplyGroups(user, cfg, entry, groups)
+		if err != nil {
+			return nil, false, err
+		}
+		changed = changed || groupsChanged
+	}
+
+	switch {
+	case created:
+		if err := repo.Create(ctx, user); err != nil {
+			return nil, false, fmt.Errorf("failed to create user of %s: %w", entry.DN, err)
+		}
+	case changed:
+		if err := repo.Update(ctx, user); err != nil {
+			return nil, false, fmt.Errorf("failed to update user of %s: %w", entry.DN, err)
+		}
+	}
+
+	return user, created || changed, nil
+}
+
+// ApplyEntry sets the ldap attribute and the mapped attributes of the entry on the user and returns whether the
+// user changed. Emails and phone numbers from the directory are trusted and marked as verified.
+func ApplyEntry(user *model.User, cfg *Config, entry *Entry) (bool, error) {
+
+	ldapValue := &model.LdapAttributeValue{
+		Id:         entry.id(cfg.IdAttribute),
+		DN:         entry.DN,
+		Username:   entry.Value(cfg.UsernameAttribute),
+		Attributes: map[string][]string{},
+	}
+	if ldapValue.Id == "" {
+		return false, fmt.Errorf("entry %s has no %s", entry.DN, cfg.IdAttribute)
+	}
+	for attribute := range cfg.AttributeMapping {
+		if values := entry.Values(attribute); len(values) > 0 {
+			ldapValue.Attributes[attribute] = values
+		}
+	}
+
+	changed, err := setAttribute(user, model.AttributeTypeLdap, ldapValue)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+
+	if email := mappedValue(cfg, entry, FieldEmail); email != "" {
+		existing, _, err := model.GetAttribute[model.EmailAttributeValue](user, model.AttributeTypeEmail)
+		if err != nil {
+			return false, err
+		}
+		if existing == nil || existing.Email != email || !existing.Verified {
+			if _, err := setAttribute(user, model.AttributeTypeEmail, &model.EmailAttributeValue{Email: email, Verified: true, VerifiedAt: &now}); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+
+	if phone := mappedValue(cfg, entry, FieldPhone); phone != "" {
+		existing, _, err := model.GetAttribute[model.PhoneAttributeValue](user, model.AttributeTypePhone)
+		if err != nil {
+			return false, err
+		}
+		if existing == nil || existing.Phone != phone || !existing.Verified {
+			if _, err := setAttribute(user, model.AttributeTypePhone, &model.PhoneAttributeValue{Phone: phone, Verified: true, VerifiedAt: &now}); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+
+	// The username of the directory is the preferred username unless another attribute is mapped to it
+	existing, _, err := model.GetAttribute[model.UsernameAttributeValue](user, model.AttributeTypeUsername)
+	if err != nil {
+		return false, err
+	}
+	username := model.UsernameAttributeValue{}
+	if existing != nil {
+		username = *existing
+	}
+	username.PreferredUsername = ldapValue.Username
+	for _, attribute := range sortedKeys(cfg.AttributeMapping) {
+		if fieldOf, ok := usernameFields[cfg.AttributeMapping[attribute]]; ok {
+			if value := entry.Value(attribute); value != "" {
+				*fieldOf(&username) = value
+			}
+		}
+	}
+	if existing == nil || username != *existing {
+		if _, err := setAttribute(user, model.AttributeTypeUsername, &username); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// ApplyGroups replaces the entitlements of the user that come from directory groups with an entitlement for each
+// group the entry is a member of and returns whether the user changed. Other entitlements are kept.
+func ApplyGroups(user *model.User, cfg *Config, entry *Entry, groups []*Group) (bool, error) {
+
+	wanted := []model.Entitlement{}
+	for _, group := range groups {
+		if entry != nil && group.HasMember(entry) {
+			wanted = append(wanted, model.Entitlement{
+				Description: group.DN,
+				Resource:    cfg.GroupResourcePrefix + group.Name,
+				Action:      "member",
+				Effect:      model.EffectTypeAllow,
+				Source:      EntitlementSource,
+			})
+		}
+	}
+	sort.Slice(wanted, func(i, j int) bool { return wanted[i].Resource < wanted[j].Resource })
+
+	values, attrs, err := model.GetAttributes[model.EntitlementSetAttributeValue](user, model.AttributeTypeEntitlements)
+	if err != nil {
+		return false, err
+	}
+
+	current := []model.Entitlement{}
+	for _, value := range values {
+		for _, entitlement := range value.Entitlements {
+			if entitlement.Source == EntitlementSource {
+				current = append(current, entitlement)
+			}
+		}
+	}
+	sort.Slice(current, func(i, j int) bool { return current[i].Resource < current[j].Resource })
+
+	if slices.Equal(current, wanted) {
+		return false, nil
+	}
+
+	// Remove the entitlements of the directory and add the current ones to the first entitlement set
+	for i, attr := range attrs {
+		kept := slices.DeleteFunc(slices.Clone(values[i].Entitlements), func(e model.Entitlement) bool {
+			return e.Source == EntitlementSource
+		})
+		if i == 0 {
+			kept = append(kept, wanted...)
+		}
+		attr.Value = &model.EntitlementSetAttributeValue{Entitlements: kept}
+	}
+	if len(attrs) == 0 {
+		user.AddAttribute(&model.UserAttribute{
+			Type:  model.AttributeTypeEntitlements,
+			Value: &model.EntitlementSetAttributeValue{Entitlements: wanted},
+		})
+	}
+
+	return true, nil
+}
+
+// mappedValue returns the value of the first directory attribute that is mapped to the field
+func mappedValue(cfg *Config, entry *Entry, field string) string {
+	for _, attribute := range sortedKeys(cfg.AttributeMapping) {
+		if cfg.AttributeMapping[attribute] != field {
+			continue
+		}
+		if value := entry.Value(attribute); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setAttribute sets the value and the index of the single attribute of the type, the attribute is added if the
+// user has none. Returns whether the value changed.
+func setAttribute[T any, P interface {
+	*T
+	model.AttributeValue
+}](user *model.User, attributeType string, value P) (bool, error) {
+
+	current, attr, err := model.GetAttribute[T](user, attributeType)
+	if err != nil {
+		return false, err
+	}
+
+	index := value.GetIndex()
+	if attr == nil {
+		user.AddAttribute(&model.UserAttribute{Index: &index, Type: attributeType, Value: value})
+		return true, nil
+	}
+	if reflect.DeepEqual(current, (*T)(value)) {
+		return false, nil
+	}
+
+	attr.Index = &index
+	attr.Value = value
+	return true, nil
+}
@@ -0,0 +1,51 @@
+package lib
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidPhoneNumber = errors.New("invalid phone number")
+
+// NormalizePhoneNumber converts a phone number to E.164, e.g. "+41 79 123 45 67" to "+41791234567".
+// Spaces, dashes, dots and brackets are removed and an international 00 prefix is replaced by +.
+// Numbers without a country code are prefixed with the default country code (e.g. "41") after
+// removing the national trunk prefix 0. If there is no default country code they are rejected.
+func NormalizePhoneNumber(phone string, defaultCountryCode string) (string, error) {
+
+	var digits strings.Builder
+	international := false
+
+	for i, r := range strings.TrimSpace(phone) {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+			international = true
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')' || r == '/':
+			continue
+		default:
+			return "", ErrInvalidPhoneNumber
+		}
+	}
+
+	number := digits.String()
+
+	switch {
+	case international:
+		// already has a country code
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	case defaultCountryCode != "":
+		number = strings.TrimPrefix(defaultCountryCode, "+") + strings.TrimPrefix(number, "0")
+	default:
+		return "", ErrInvalidPhoneNumber
+	}
+
+	// E.164 allows at most 15 digits and country codes never start with 0
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", ErrInvalidPhoneNumber
+	}
+
+	return "+" + number, nil
+}
@@ -0,0 +1,41 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizePhoneNumber(t *testing.T) {
+	testCases := []struct {
+		name               string
+		phone              string
+		defaultCountryCode string
+		want               string
+		wantErr            bool
+	}{
+		{name: "E.164", phone: "+41791234567", want: "+41791234567"},
+		{name: "Formatted", phone: " +41 (79) 123-45.67 ", want: "+41791234567"},
+		{name: "International prefix", phone: "0041 79 123 45 67", want: "+41791234567"},
+		{name: "National with default country", phone: "079 123 45 67", defaultCountryCode: "41", want: "+41791234567"},
+		{name: "National with default country and plus", phone: "(415) 555-2671", defaultCountryCode: "+1", want: "+14155552671"},
+		{name: "National without default country", phone: "079 123 45 67", wantErr: true},
+		{name: "Letters", phone: "+41 79 CALL ME", wantErr: true},
+		{name: "Plus in the middle", phone: "41+791234567", wantErr: true},
+		{name: "Too short", phone: "+4112", wantErr: true},
+		{name: "Too long", phone: "+4179123456789012", wantErr: true},
+		{name: "Empty", phone: "", defaultCountryCode: "41", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NormalizePhoneNumber(tc.phone, tc.defaultCountryCode)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidPhoneNumber)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package saml
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/cert"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+const (
+	// SigningKeyAlgorithm is the algorithm of the signing keys of the identity provider in the SigningKeyDB
+	SigningKeyAlgorithm = "RS256"
+
+	signingKeySize           = 2048
+	signingCertificateExpiry = 10 * 365 * 24 * time.Hour
+)
+
+// SigningKey is the key the identity provider signs its assertions with and the certificate it publishes for it
+type SigningKey struct {
+	Kid         string
+	PrivateKey  *rsa.PrivateKey
+	Certificate *x509.Certificate
+}
+
+// GenerateSigningKey generates an RSA key with a self signed certificate and returns it as private and public JWK.
+// The certificate is stored as x5c of the JWKs, service providers only trust the certificate from the metadata.
+func GenerateSigningKey(keyID, commonName string) (string, string, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, signingKeySize)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate RSA key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(signingCertificateExpiry),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	chain := &cert.Chain{}
+	if err := chain.AddString(base64.StdEncoding.EncodeToString(der)); err != nil {
+		return "", "", fmt.Errorf("failed to add certificate: %w", err)
+	}
+
+	privateJWK, err := jwk.FromRaw(privateKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to convert to JWK: %w", err)
+	}
+
+	privateJWK.Set(jwk.KeyIDKey, keyID)
+	privateJWK.Set(jwk.AlgorithmKey, SigningKeyAlgorithm)
+	privateJWK.Set(jwk.KeyUsageKey, "sig")
+	privateJWK.Set(jwk.X509CertChainKey, chain)
+
+	publicJWK, err := jwk.PublicKeyOf(privateJWK)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to extract public key: %w", err)
+	}
+
+	privateJSON, err := json.Marshal(privateJWK)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal JWK to JSON: %w", err)
+	}
+
+	publicJSON, err := json.Marshal(publicJWK)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal public JWK: %w", err)
+	}
+
+	return string(privateJSON), string(publicJSON), nil
+}
+
+// ParseSigningKey reads the private key and the certificate from a private JWK created by GenerateSigningKey
+func ParseSigningKey(privateJWK string) (*SigningKey, error) {
+	key, err := jwk.ParseKey([]byte(privateJWK))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWK: %w", err)
+	}
+
+	var privateKey rsa.PrivateKey
+	if err := key.Raw(&privateKey); err != nil {
+		return nil, fmt.Errorf("signing key is not an RSA private key: %w", err)
+	}
+
+	certificate, err := certificateOf(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		Kid:         key.KeyID(),
+		PrivateKey:  &privateKey,
+		Certificate: certificate,
+	}, nil
+}
+
+// ParseCertificate reads the certificate from a public JWK created by GenerateSigningKey
+func ParseCertificate(publicJWK string) (*x509.Certificate, error) {
+	key, err := jwk.ParseKey([]byte(publicJWK))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWK: %w", err)
+	}
+	return certificateOf(key)
+}
+
+// certificateOf returns the first certificate of the x5c of a JWK
+func certificateOf(key jwk.Key) (*x509.Certificate, error) {
+	chain := key.X509CertChain()
+	if chain == nil || chain.Len() == 0 {
+		return nil, fmt.Errorf("signing key has no certificate")
+	}
+
+	encoded, _ := chain.Get(0)
+	der, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode certificate: %w", err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return certificate, nil
+}
@@ -0,0 +1,317 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	NamespaceAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	NamespaceProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	NamespaceMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	NamespaceDSig      = "http://www.w3.org/2000/09/xmldsig#"
+
+	BindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	BindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	NameIdFormatUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	NameIdFormatEmail       = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIdFormatPersistent  = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	NameIdFormatTransient   = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+
+	StatusSuccess             = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	StatusRequester           = "urn:oasis:names:tc:SAML:2.0:status:Requester"
+	StatusResponder           = "urn:oasis:names:tc:SAML:2.0:status:Responder"
+	StatusAuthnFailed         = "urn:oasis:names:tc:SAML:2.0:status:AuthnFailed"
+	StatusNoPassive           = "urn:oasis:names:tc:SAML:2.0:status:NoPassive"
+	StatusInvalidNameIDPolicy = "urn:oasis:names:tc:SAML:2.0:status:InvalidNameIDPolicy"
+
+	attributeNameFormatBasic = "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"
+	authnContextUnspecified  = "urn:oasis:names:tc:SAML:2.0:ac:classes:unspecified"
+	confirmationMethodBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+	// maxRequestSize limits the size of an inflated AuthnRequest
+	maxRequestSize = 1 << 20
+
+	// notBeforeSkew is how long before the issue instant an assertion becomes valid, so that service providers
+	// whose clock is behind accept it
+	notBeforeSkew = 3 * time.Minute
+
+	timeFormat = "2006-01-02T15:04:05Z"
+)
+
+// SupportedNameIdFormats are the NameID formats the identity provider can issue
+var SupportedNameIdFormats = []string{NameIdFormatUnspecified, NameIdFormatEmail, NameIdFormatPersistent, NameIdFormatTransient}
+
+// IsSupportedNameIdFormat returns true if the identity provider can issue the NameID format
+func IsSupportedNameIdFormat(format string) bool {
+	return slices.Contains(SupportedNameIdFormats, format)
+}
+
+// AuthnRequest is the authentication request of a service provider
+type AuthnRequest struct {
+	XMLName                     xml.Name      `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string        `xml:"ID,attr"`
+	Version                     string        `xml:"Version,attr"`
+	IssueInstant                string        `xml:"IssueInstant,attr"`
+	Destination                 string        `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string        `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string        `xml:"ProtocolBinding,attr"`
+	ForceAuthn                  bool          `xml:"ForceAuthn,attr"`
+	IsPassive                   bool          `xml:"IsPassive,attr"`
+	Issuer                      string        `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                *NameIDPolicy `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+}
+
+type NameIDPolicy struct {
+	Format string `xml:"Format,attr"`
+}
+
+// NameIdFormat returns the requested NameID format or an empty string if the request has none
+func (r *AuthnRequest) NameIdFormat() string {
+	if r.NameIDPolicy == nil {
+		return ""
+	}
+	return r.NameIDPolicy.Format
+}
+
+// DecodeRedirectRequest decodes the SAMLRequest parameter of the HTTP-Redirect binding, which is deflated and base64 encoded
+func DecodeRedirectRequest(samlRequest string) (*AuthnRequest, error) {
+	compressed, err := base64.StdEncoding.DecodeString(samlRequest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 encoding: %w", err)
+	}
+
+	inflated, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(compressed)), maxRequestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid deflate encoding: %w", err)
+	}
+
+	return parseAuthnRequest(inflated)
+}
+
+// DecodePostRequest decodes the SAMLRequest parameter of the HTTP-POST binding, which is base64 encoded
+func DecodePostRequest(samlRequest string) (*AuthnRequest, error) {
+	decoded, err := base64.StdEncoding.DecodeString(samlRequest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 encoding: %w", err)
+	}
+
+	return parseAuthnRequest(decoded)
+}
+
+func parseAuthnRequest(data []byte) (*AuthnRequest, error) {
+	if len(data) > maxRequestSize {
+		return nil, fmt.Errorf("request is too large")
+	}
+
+	var request AuthnRequest
+	if err := xml.Unmarshal(data, &request); err != nil {
+		return nil, fmt.Errorf("invalid AuthnRequest: %w", err)
+	}
+
+	if request.ID == "" {
+		return nil, fmt.Errorf("AuthnRequest has no ID")
+	}
+	if request.Version != "2.0" {
+		return nil, fmt.Errorf("unsupported SAML version %s", request.Version)
+	}
+	if request.Issuer == "" {
+		return nil, fmt.Errorf("AuthnRequest has no issuer")
+	}
+	if request.ProtocolBinding != "" && request.ProtocolBinding != BindingHTTPPost {
+		return nil, fmt.Errorf("unsupported protocol binding %s", request.ProtocolBinding)
+	}
+
+	return &request, nil
+}
+
+// Response contains the values of a successful response to a service provider
+type Response struct {
+	Issuer       string // Entity ID of the identity provider
+	Destination  string // Assertion consumer service URL
+	InResponseTo string // ID of the AuthnRequest, empty for IdP initiated SSO
+	Audience     string // Entity ID of the service provider
+	NameId       string
+	NameIdFormat string
+	SessionIndex string
+	AuthnInstant time.Time
+	IssueInstant time.Time
+	Lifetime     time.Duration
+	Attributes   map[string][]string
+}
+
+// BuildResponse creates a response with an assertion that is signed with an enveloped signature
+func BuildResponse(r *Response, key *SigningKey) (string, error) {
+	assertionId, err := NewID()
+	if err != nil {
+		return "", err
+	}
+	responseId, err := NewID()
+	if err != nil {
+		return "", err
+	}
+
+	issueInstant := r.IssueInstant.UTC().Format(timeFormat)
+	notBefore := r.IssueInstant.Add(-notBeforeSkew).UTC().Format(timeFormat)
+	notOnOrAfter := r.IssueInstant.Add(r.Lifetime).UTC().Format(timeFormat)
+
+	assertion := newElement("saml:Assertion").
+		ns("saml", NamespaceAssertion).
+		attr("ID", assertionId).
+		attr("IssueInstant", issueInstant).
+		attr("Version", "2.0").
+		add(
+			newElement("saml:Issuer").setText(r.Issuer),
+			newElement("saml:Subject").add(
+				newElement("saml:NameID").attr("Format", r.NameIdFormat).setText(r.NameId),
+				newElement("saml:SubjectConfirmation").attr("Method", confirmationMethodBearer).add(
+					newElement("saml:SubjectConfirmationData").
+						attr("InResponseTo", r.InResponseTo).
+						attr("NotOnOrAfter", notOnOrAfter).
+						attr("Recipient", r.Destination),
+				),
+			),
+			newElement("saml:Conditions").
+				attr("NotBefore", notBefore).
+				attr("NotOnOrAfter", notOnOrAfter).
+				add(newElement("saml:AudienceRestriction").add(newElement("saml:Audience").setText(r.Audience))),
+			newElement("saml:AuthnStatement").
+				attr("AuthnInstant", r.AuthnInstant.UTC().Format(timeFormat)).
+				attr("SessionIndex", r.SessionIndex).
+				add(newElement("saml:AuthnContext").add(newElement("saml:AuthnContextClassRef").setText(authnContextUnspecified))),
+		)
+
+	if len(r.Attributes) > 0 {
+		names := make([]string, 0, len(r.Attributes))
+		for name := range r.Attributes {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		statement := newElement("saml:AttributeStatement")
+		for _, name := range names {
+			attribute := newElement("saml:Attribute").attr("Name", name).attr("NameFormat", attributeNameFormatBasic)
+			for _, value := range r.Attributes[name] {
+				attribute.add(newElement("saml:AttributeValue").setText(value))
+			}
+			statement.add(attribute)
+		}
+		assertion.add(statement)
+	}
+
+	response := newElement("samlp:Response").
+		ns("saml", NamespaceAssertion).
+		ns("samlp", NamespaceProtocol).
+		attr("Destination", r.Destination).
+		attr("ID", responseId).
+		attr("InResponseTo", r.InResponseTo).
+		attr("IssueInstant", issueInstant).
+		attr("Version", "2.0").
+		add(
+			newElement("saml:Issuer").setText(r.Issuer),
+			status(StatusSuccess, ""),
+			assertion,
+		)
+
+	// The assertion is signed in the parsed response, so that the signature is computed over the XML that is sent
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(response.String()); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	if err := signAssertion(doc.Root().SelectElement("Assertion"), key); err != nil {
+		return "", err
+	}
+
+	// Like the messages that are not signed, the response has no empty element tags
+	doc.WriteSettings.CanonicalEndTags = true
+	signed, err := doc.WriteToString()
+	if err != nil {
+		return "", fmt.Errorf("failed to write response: %w", err)
+	}
+	return signed, nil
+}
+
+// BuildErrorResponse creates an unsigned response without assertion that tells the service provider why the
+// authentication failed
+func BuildErrorResponse(issuer, destination, inResponseTo, statusCode, subStatusCode string, issueInstant time.Time) (string, error) {
+	responseId, err := NewID()
+	if err != nil {
+		return "", err
+	}
+
+	response := newElement("samlp:Response").
+		ns("saml", NamespaceAssertion).
+		ns("samlp", NamespaceProtocol).
+		attr("Destination", destination).
+		attr("ID", responseId).
+		attr("InResponseTo", inResponseTo).
+		attr("IssueInstant", issueInstant.UTC().Format(timeFormat)).
+		attr("Version", "2.0").
+		add(
+			newElement("saml:Issuer").setText(issuer),
+			status(statusCode, subStatusCode),
+		)
+
+	return response.String(), nil
+}
+
+func status(statusCode, subStatusCode string) *element {
+	code := newElement("samlp:StatusCode").attr("Value", statusCode)
+	if subStatusCode != "" {
+		code.add(newElement("samlp:StatusCode").attr("Value", subStatusCode))
+	}
+	return newElement("samlp:Status").add(code)
+}
+
+// BuildMetadata creates the metadata of the identity provider with the certificates of its signing keys
+func BuildMetadata(entityId, ssoUrl string, keys [][]byte) string {
+	descriptor := newElement("md:IDPSSODescriptor").
+		attr("WantAuthnRequestsSigned", "false").
+		attr("protocolSupportEnumeration", NamespaceProtocol)
+
+	for _, der := range keys {
+		descriptor.add(newElement("md:KeyDescriptor").attr("use", "signing").add(
+			newElement("ds:KeyInfo").ns("ds", NamespaceDSig).add(
+				newElement("ds:X509Data").add(
+					newElement("ds:X509Certificate").setText(base64.StdEncoding.EncodeToString(der)),
+				),
+			),
+		))
+	}
+
+	for _, format := range SupportedNameIdFormats {
+		descriptor.add(newElement("md:NameIDFormat").setText(format))
+	}
+
+	descriptor.add(
+		newElement("md:SingleSignOnService").attr("Binding", BindingHTTPRedirect).attr("Location", ssoUrl),
+		newElement("md:SingleSignOnService").attr("Binding", BindingHTTPPost).attr("Location", ssoUrl),
+	)
+
+	metadata := newElement("md:EntityDescriptor").
+		ns("md", NamespaceMetadata).
+		attr("entityID", entityId).
+		add(descriptor)
+
+	return xml.Header + metadata.String()
+}
+
+// NewID returns a random identifier for a SAML message. IDs must not start with a digit.
+func NewID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate id: %w", err)
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
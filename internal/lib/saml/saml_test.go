@@ -0,0 +1,147 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAuthnRequest = `<samlp:AuthnRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"
+	ID="_request1" Version="2.0" IssueInstant="2024-01-01T00:00:00Z" Destination="https://idp.example.com/acme/customers/saml/sso"
+	AssertionConsumerServiceURL="https://sp.example.com/acs" ProtocolBinding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST">
+	<saml:Issuer>https://sp.example.com</saml:Issuer>
+	<samlp:NameIDPolicy Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress" AllowCreate="true"/>
+</samlp:AuthnRequest>`
+
+func TestDecodeRequest(t *testing.T) {
+	var compressed bytes.Buffer
+	writer, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte(testAuthnRequest))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	redirectRequest, err := DecodeRedirectRequest(base64.StdEncoding.EncodeToString(compressed.Bytes()))
+	require.NoError(t, err)
+
+	postRequest, err := DecodePostRequest(base64.StdEncoding.EncodeToString([]byte(testAuthnRequest)))
+	require.NoError(t, err)
+	assert.Equal(t, redirectRequest, postRequest)
+
+	assert.Equal(t, "_request1", postRequest.ID)
+	assert.Equal(t, "https://sp.example.com", postRequest.Issuer)
+	assert.Equal(t, "https://sp.example.com/acs", postRequest.AssertionConsumerServiceURL)
+	assert.Equal(t, NameIdFormatEmail, postRequest.NameIdFormat())
+	assert.False(t, postRequest.IsPassive)
+
+	// A request without issuer is rejected
+	_, err = DecodePostRequest(base64.StdEncoding.EncodeToString([]byte(strings.Replace(testAuthnRequest, "<saml:Issuer>https://sp.example.com</saml:Issuer>", "", 1))))
+	assert.Error(t, err)
+
+	// Responses can only be sent with the HTTP-POST binding
+	_, err = DecodePostRequest(base64.StdEncoding.EncodeToString([]byte(strings.Replace(testAuthnRequest, BindingHTTPPost, "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Artifact", 1))))
+	assert.Error(t, err)
+}
+
+func TestBuildResponse(t *testing.T) {
+	privateJWK, publicJWK, err := GenerateSigningKey("kid-1", "idp.example.com")
+	require.NoError(t, err)
+	key, err := ParseSigningKey(privateJWK)
+	require.NoError(t, err)
+	assert.Equal(t, "kid-1", key.Kid)
+
+	certificate, err := ParseCertificate(publicJWK)
+	require.NoError(t, err)
+	assert.Equal(t, key.Certificate.Raw, certificate.Raw)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	response, err := BuildResponse(&Response{
+		Issuer:       "https://idp.example.com/acme/customers/saml/metadata",
+		Destination:  "https://sp.example.com/acs",
+		InResponseTo: "_request1",
+		Audience:     "https://sp.example.com",
+		NameId:       "alice@example.com",
+		NameIdFormat: NameIdFormatEmail,
+		SessionIndex: "_session1",
+		AuthnInstant: now,
+		IssueInstant: now,
+		Lifetime:     5 * time.Minute,
+		Attributes:   map[string][]string{"mail": {"alice@example.com"}, "name": {"Alice & Bob"}},
+	}, key)
+	require.NoError(t, err)
+
+	// The response is well formed and contains the values
+	var parsed struct {
+		InResponseTo string `xml:"InResponseTo,attr"`
+		Assertion    struct {
+			NameID     string `xml:"Subject>NameID"`
+			Audience   string `xml:"Conditions>AudienceRestriction>Audience"`
+			Attributes []struct {
+				Name  string `xml:"Name,attr"`
+				Value string `xml:"AttributeValue"`
+			} `xml:"AttributeStatement>Attribute"`
+		} `xml:"Assertion"`
+	}
+	require.NoError(t, xml.Unmarshal([]byte(response), &parsed))
+	assert.Equal(t, "_request1", parsed.InResponseTo)
+	assert.Equal(t, "alice@example.com", parsed.Assertion.NameID)
+	assert.Equal(t, "https://sp.example.com", parsed.Assertion.Audience)
+	require.Len(t, parsed.Assertion.Attributes, 2)
+	assert.Equal(t, "Alice & Bob", parsed.Assertion.Attributes[1].Value)
+	assert.Contains(t, response, `NotOnOrAfter="2024-01-01T12:05:00Z"`)
+
+	assert.Contains(t, response, `NotBefore="2024-01-01T11:57:00Z"`)
+
+	// The signature follows the issuer and is valid for an independent XML signature implementation
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(response))
+	assertion := doc.Root().SelectElement("Assertion")
+	require.NotNil(t, assertion)
+	assert.Equal(t, "Signature", assertion.ChildElements()[1].Tag)
+
+	validator := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{certificate}})
+	_, err = validator.Validate(assertion)
+	assert.NoError(t, err)
+
+	// A changed assertion is not valid anymore
+	assertion.FindElement("./Subject/NameID").SetText("mallory@example.com")
+	_, err = validator.Validate(assertion)
+	assert.Error(t, err)
+}
+
+func TestBuildErrorResponse(t *testing.T) {
+	response, err := BuildErrorResponse("https://idp.example.com", "https://sp.example.com/acs", "_request1", StatusResponder, StatusAuthnFailed, time.Now())
+	require.NoError(t, err)
+
+	assert.Contains(t, response, `<samlp:StatusCode Value="`+StatusResponder+`"><samlp:StatusCode Value="`+StatusAuthnFailed+`"></samlp:StatusCode></samlp:StatusCode>`)
+	assert.NotContains(t, response, "Assertion")
+}
+
+func TestBuildMetadata(t *testing.T) {
+	metadata := BuildMetadata("https://idp.example.com/metadata", "https://idp.example.com/sso", [][]byte{[]byte("certificate")})
+
+	var parsed struct {
+		EntityID    string `xml:"entityID,attr"`
+		Certificate string `xml:"IDPSSODescriptor>KeyDescriptor>KeyInfo>X509Data>X509Certificate"`
+		Services    []struct {
+			Binding  string `xml:"Binding,attr"`
+			Location string `xml:"Location,attr"`
+		} `xml:"IDPSSODescriptor>SingleSignOnService"`
+	}
+	require.NoError(t, xml.Unmarshal([]byte(metadata), &parsed))
+	assert.Equal(t, "https://idp.example.com/metadata", parsed.EntityID)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("certificate")), parsed.Certificate)
+	require.Len(t, parsed.Services, 2)
+	assert.Equal(t, BindingHTTPRedirect, parsed.Services[0].Binding)
+	assert.Equal(t, "https://idp.example.com/sso", parsed.Services[1].Location)
+}
@@ -0,0 +1,83 @@
+package saml
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+// signAssertion adds an enveloped signature with exclusive canonicalization to an assertion. The signature follows
+// the issuer of the assertion, as required by the schema of the assertion.
+func signAssertion(assertion *etree.Element, key *SigningKey) error {
+	signer, err := dsig.NewSigningContext(key.PrivateKey, [][]byte{key.Certificate.Raw})
+	if err != nil {
+		return fmt.Errorf("failed to create signing context: %w", err)
+	}
+	signer.Prefix = "ds"
+	signer.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+
+	issuer := assertion.SelectElement("Issuer")
+	if issuer == nil {
+		return fmt.Errorf("assertion has no issuer")
+	}
+
+	signature, err := signer.ConstructSignature(assertion, true)
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
+
+	assertion.InsertChildAt(issuer.Index()+1, signature)
+	return nil
+}
+
+// sha1Algorithms are supported by goxmldsig, but SHA-1 signatures can be forged and are rejected
+var sha1Algorithms = map[string]bool{
+	dsig.RSASHA1SignatureMethod:              true,
+	dsig.ECDSASHA1SignatureMethod:            true,
+	"http://www.w3.org/2000/09/xmldsig#sha1": true,
+}
+
+// verifySignature verifies the enveloped signature of an element with the certificate of the identity provider and
+// returns the signed element without the signature. The element is detached from the document with the namespaces
+// it inherits, so that the signature of an assertion can be verified within the response. A certificate in the
+// KeyInfo of the signature must be the certificate of the identity provider.
+func verifySignature(validator *dsig.ValidationContext, signed *etree.Element) (*etree.Element, error) {
+
+	var signedInfo *etree.Element
+	if signature := childElement(signed, NamespaceDSig, "Signature"); signature != nil {
+		signedInfo = childElement(signature, NamespaceDSig, "SignedInfo")
+	}
+	if signedInfo == nil {
+		return nil, fmt.Errorf("signature has no signed info")
+	}
+
+	algorithms := []*etree.Element{childElement(signedInfo, NamespaceDSig, "SignatureMethod")}
+	for _, reference := range childElements(signedInfo, NamespaceDSig, "Reference") {
+		algorithms = append(algorithms, childElement(reference, NamespaceDSig, "DigestMethod"))
+	}
+	for _, algorithm := range algorithms {
+		if algorithm != nil && sha1Algorithms[attrValue(algorithm, "Algorithm")] {
+			return nil, fmt.Errorf("unsupported algorithm %s", attrValue(algorithm, "Algorithm"))
+		}
+	}
+
+	namespaces, err := etreeutils.NSBuildParentContext(signed)
+	if err != nil {
+		return nil, err
+	}
+	detached, err := etreeutils.NSDetatch(namespaces, signed)
+	if err != nil {
+		return nil, err
+	}
+
+	return validator.Validate(detached)
+}
+
+// decodeBase64 decodes base64 that may be wrapped into lines
+func decodeBase64(value string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+}
@@ -0,0 +1,321 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// maxClockSkew is the difference between the clocks of the identity provider and GoAM that is tolerated
+const maxClockSkew = 2 * time.Minute
+
+// BuildAuthnRequest creates the AuthnRequest of a service provider that asks for a response with the HTTP-POST binding
+func BuildAuthnRequest(id, issuer, destination, acsUrl, nameIdFormat string, issueInstant time.Time) string {
+	request := newElement("samlp:AuthnRequest").
+		ns("saml", NamespaceAssertion).
+		ns("samlp", NamespaceProtocol).
+		attr("AssertionConsumerServiceURL", acsUrl).
+		attr("Destination", destination).
+		attr("ID", id).
+		attr("IssueInstant", issueInstant.UTC().Format(timeFormat)).
+		attr("ProtocolBinding", BindingHTTPPost).
+		attr("Version", "2.0").
+		add(newElement("saml:Issuer").setText(issuer))
+
+	if nameIdFormat != "" {
+		request.add(newElement("samlp:NameIDPolicy").attr("AllowCreate", "true").attr("Format", nameIdFormat))
+	}
+
+	return request.String()
+}
+
+// EncodeRedirectRequest encodes a request for the SAMLRequest parameter of the HTTP-Redirect binding
+func EncodeRedirectRequest(request string) (string, error) {
+	var compressed bytes.Buffer
+	writer, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return "", fmt.Errorf("failed to create deflate writer: %w", err)
+	}
+	if _, err := writer.Write([]byte(request)); err != nil {
+		return "", fmt.Errorf("failed to deflate request: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("failed to deflate request: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(compressed.Bytes()), nil
+}
+
+// ParseIdpCertificate parses the certificate of an identity provider, either PEM encoded or as base64 encoded DER
+// like in the X509Certificate element of its metadata
+func ParseIdpCertificate(value string) (*x509.Certificate, error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(value)); block != nil {
+		der = block.Bytes
+	} else {
+		decoded, err := decodeBase64(value)
+		if err != nil {
+			return nil, fmt.Errorf("certificate is neither PEM nor base64 encoded: %w", err)
+		}
+		der = decoded
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+	return certificate, nil
+}
+
+// ResponseValidation are the expected values of a response to an AuthnRequest of the service provider
+type ResponseValidation struct {
+	IdpEntityId string            // Entity ID of the identity provider, the issuer of the assertion
+	Certificate *x509.Certificate // Certificate the identity provider signs with
+	SpEntityId  string            // Entity ID of the service provider, the audience of the assertion
+	AcsUrl      string            // Assertion consumer service URL the response was sent to
+	RequestId   string            // ID of the AuthnRequest
+	Now         time.Time
+}
+
+// Assertion contains the values of a validated assertion
+type Assertion struct {
+	ID           string
+	Issuer       string
+	NameId       string
+	NameIdFormat string
+	SessionIndex string
+	Attributes   map[string][]string
+	ExpiresAt    time.Time // Time until which the assertion is accepted, including the clock skew
+}
+
+// ValidateResponse validates the SAMLResponse parameter of the HTTP-POST binding and returns its assertion. Either
+// the response or the assertion must be signed by the identity provider, encrypted assertions are not supported.
+// The signatures are verified with goxmldsig and the values are only read from the XML that the signatures cover.
+func ValidateResponse(samlResponse string, v *ResponseValidation) (*Assertion, error) {
+	decoded, err := decodeBase64(samlResponse)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 encoding: %w", err)
+	}
+	if len(decoded) > maxRequestSize {
+		return nil, fmt.Errorf("response is too large")
+	}
+
+	response, err := parseDocument(decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isElement(response, NamespaceProtocol, "Response") {
+		return nil, fmt.Errorf("document is not a SAML response")
+	}
+
+	validator := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{v.Certificate}})
+
+	// A signature that is present must be valid, the response is accepted if at least one of them is present
+	responseSigned := childElement(response, NamespaceDSig, "Signature") != nil
+	if responseSigned {
+		if response, err = verifySignature(validator, response); err != nil {
+			return nil, fmt.Errorf("invalid signature of the response: %w", err)
+		}
+	}
+
+	if attrValue(response, "Version") != "2.0" {
+		return nil, fmt.Errorf("unsupported SAML version %s", attrValue(response, "Version"))
+	}
+
+	// A signed response must name its destination, so that it cannot be sent to another service provider
+	destination := attrValue(response, "Destination")
+	if destination == "" && responseSigned {
+		return nil, fmt.Errorf("signed response has no destination")
+	}
+	if destination != "" && destination != v.AcsUrl {
+		return nil, fmt.Errorf("response is for destination %s", destination)
+	}
+
+	if attrValue(response, "InResponseTo") != v.RequestId {
+		return nil, fmt.Errorf("response is not for the request of the service provider")
+	}
+	if issuer := childElement(response, NamespaceAssertion, "Issuer"); issuer != nil && textOf(issuer) != v.IdpEntityId {
+		return nil, fmt.Errorf("response is issued by %s", textOf(issuer))
+	}
+
+	if statusCode := responseStatus(response); statusCode != StatusSuccess {
+		return nil, fmt.Errorf("identity provider returned status %s", statusCode)
+	}
+
+	if childElement(response, NamespaceAssertion, "EncryptedAssertion") != nil {
+		return nil, fmt.Errorf("encrypted assertions are not supported")
+	}
+	assertions := childElements(response, NamespaceAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, fmt.Errorf("response must contain exactly one assertion")
+	}
+	assertion := assertions[0]
+
+	assertionSigned := childElement(assertion, NamespaceDSig, "Signature") != nil
+	if assertionSigned {
+		if assertion, err = verifySignature(validator, assertion); err != nil {
+			return nil, fmt.Errorf("invalid signature of the assertion: %w", err)
+		}
+	}
+	if !responseSigned && !assertionSigned {
+		return nil, fmt.Errorf("neither the response nor the assertion is signed")
+	}
+
+	return validateAssertion(assertion, v)
+}
+
+func responseStatus(response *etree.Element) string {
+	status := childElement(response, NamespaceProtocol, "Status")
+	if status == nil {
+		return ""
+	}
+	code := childElement(status, NamespaceProtocol, "StatusCode")
+	if code == nil {
+		return ""
+	}
+
+	// The second level status code tells why the request failed
+	if subCode := childElement(code, NamespaceProtocol, "StatusCode"); subCode != nil {
+		return attrValue(code, "Value") + " " + attrValue(subCode, "Value")
+	}
+	return attrValue(code, "Value")
+}
+
+func validateAssertion(assertion *etree.Element, v *ResponseValidation) (*Assertion, error) {
+	if attrValue(assertion, "Version") != "2.0" {
+		return nil, fmt.Errorf("unsupported assertion version %s", attrValue(assertion, "Version"))
+	}
+	if attrValue(assertion, "ID") == "" {
+		return nil, fmt.Errorf("assertion has no ID")
+	}
+
+	issuer := childElement(assertion, NamespaceAssertion, "Issuer")
+	if issuer == nil || textOf(issuer) != v.IdpEntityId {
+		return nil, fmt.Errorf("assertion is not issued by the identity provider")
+	}
+
+	subject := childElement(assertion, NamespaceAssertion, "Subject")
+	if subject == nil {
+		return nil, fmt.Errorf("assertion has no subject")
+	}
+	nameId := childElement(subject, NamespaceAssertion, "NameID")
+	if nameId == nil || textOf(nameId) == "" {
+		return nil, fmt.Errorf("assertion has no NameID")
+	}
+
+	expiresAt, err := validateSubjectConfirmation(subject, v)
+	if err != nil {
+		return nil, err
+	}
+	conditionsExpireAt, err := validateConditions(childElement(assertion, NamespaceAssertion, "Conditions"), v)
+	if err != nil {
+		return nil, err
+	}
+	if !conditionsExpireAt.IsZero() && conditionsExpireAt.Before(expiresAt) {
+		expiresAt = conditionsExpireAt
+	}
+
+	result := &Assertion{
+		ID:           attrValue(assertion, "ID"),
+		Issuer:       textOf(issuer),
+		NameId:       textOf(nameId),
+		NameIdFormat: attrValue(nameId, "Format"),
+		Attributes:   map[string][]string{},
+		ExpiresAt:    expiresAt,
+	}
+
+	if statement := childElement(assertion, NamespaceAssertion, "AuthnStatement"); statement != nil {
+		result.SessionIndex = attrValue(statement, "SessionIndex")
+	}
+
+	for _, statement := range childElements(assertion, NamespaceAssertion, "AttributeStatement") {
+		for _, attribute := range childElements(statement, NamespaceAssertion, "Attribute") {
+			name := attrValue(attribute, "Name")
+			for _, value := range childElements(attribute, NamespaceAssertion, "AttributeValue") {
+				result.Attributes[name] = append(result.Attributes[name], textOf(value))
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// validateSubjectConfirmation checks that the subject has a bearer confirmation for the request and the ACS URL and
+// returns until when it is valid
+func validateSubjectConfirmation(subject *etree.Element, v *ResponseValidation) (time.Time, error) {
+	for _, confirmation := range childElements(subject, NamespaceAssertion, "SubjectConfirmation") {
+		if attrValue(confirmation, "Method") != confirmationMethodBearer {
+			continue
+		}
+		data := childElement(confirmation, NamespaceAssertion, "SubjectConfirmationData")
+		if data == nil || attrValue(data, "Recipient") != v.AcsUrl {
+			continue
+		}
+		if inResponseTo := attrValue(data, "InResponseTo"); inResponseTo != "" && inResponseTo != v.RequestId {
+			continue
+		}
+		notOnOrAfter, err := time.Parse(time.RFC3339Nano, attrValue(data, "NotOnOrAfter"))
+		if err != nil || !v.Now.Before(notOnOrAfter.Add(maxClockSkew)) {
+			continue
+		}
+		return notOnOrAfter.Add(maxClockSkew), nil
+	}
+
+	return time.Time{}, fmt.Errorf("assertion has no valid bearer subject confirmation")
+}
+
+// validateConditions checks the validity period and that the service provider is an audience of the assertion. It
+// returns until when the conditions are valid, the zero time if they have no end.
+func validateConditions(conditions *etree.Element, v *ResponseValidation) (time.Time, error) {
+	if conditions == nil {
+		return time.Time{}, fmt.Errorf("assertion has no conditions")
+	}
+
+	if value := attrValue(conditions, "NotBefore"); value != "" {
+		notBefore, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid NotBefore: %w", err)
+		}
+		if v.Now.Add(maxClockSkew).Before(notBefore) {
+			return time.Time{}, fmt.Errorf("assertion is not valid yet")
+		}
+	}
+
+	var expiresAt time.Time
+	if value := attrValue(conditions, "NotOnOrAfter"); value != "" {
+		notOnOrAfter, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid NotOnOrAfter: %w", err)
+		}
+		expiresAt = notOnOrAfter.Add(maxClockSkew)
+		if !v.Now.Before(expiresAt) {
+			return time.Time{}, fmt.Errorf("assertion has expired")
+		}
+	}
+
+	// Each audience restriction must include the service provider
+	restrictions := childElements(conditions, NamespaceAssertion, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return time.Time{}, fmt.Errorf("assertion has no audience restriction")
+	}
+	for _, restriction := range restrictions {
+		var audiences []string
+		for _, audience := range childElements(restriction, NamespaceAssertion, "Audience") {
+			audiences = append(audiences, textOf(audience))
+		}
+		if !slices.Contains(audiences, v.SpEntityId) {
+			return time.Time{}, fmt.Errorf("service provider is not an audience of the assertion")
+		}
+	}
+
+	return expiresAt, nil
+}
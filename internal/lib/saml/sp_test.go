@@ -0,0 +1,404 @@
+package saml
+
+import (
+	"crypto"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shibbolethResponse is a response in the style of Shibboleth that was canonicalized with xmllint and signed with
+// openssl, so that the verification does not only accept signatures of this package
+const shibbolethResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<saml2p:Response xmlns:saml2p="urn:oasis:names:tc:SAML:2.0:protocol" Destination="https://sp.example.com/acme/customers/saml/acs" ID="_response1" InResponseTo="_request1" IssueInstant="2024-05-01T10:00:00.123Z" Version="2.0">
+    <saml2:Issuer xmlns:saml2="urn:oasis:names:tc:SAML:2.0:assertion">https://idp.example.org/idp/shibboleth</saml2:Issuer>
+    <saml2p:Status>
+        <saml2p:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/>
+    </saml2p:Status>
+    <saml2:Assertion xmlns:saml2="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xs="http://www.w3.org/2001/XMLSchema" ID="_assertion1" IssueInstant="2024-05-01T10:00:00.123Z" Version="2.0">
+    <saml2:Issuer>https://idp.example.org/idp/shibboleth</saml2:Issuer><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+<ds:SignedInfo>
+<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>
+<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>
+<ds:Reference URI="#_assertion1">
+<ds:Transforms>
+<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>
+<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>
+</ds:Transforms>
+<ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>
+<ds:DigestValue>9/4neR1SCiYc0JZrqChVUbV9FLuVo742LB09Jxn8q0I=</ds:DigestValue>
+</ds:Reference>
+</ds:SignedInfo>
+<ds:SignatureValue>
+LZl5a/WI7v/UKvdEtKkAGB2QgElUCw603HODNz5rETZDesSa0SK2SuboL1SHI/m7S9P0CV2Salju
+Yy7C/SFlcpf5/S4h7GqDxCKdQ45dbIUdsI3wcLIxO6+V5vMxwnu42xzcMT/9wgrMJkvWMFgXKkd6
+IJjlUWSzYKa42HIXyBdjw++lLUwCpV8AcD70gtlasicKw14pHjkkvkwhPj8tKc403mlCvMxRBtHp
+OsJrIES3/cmFutjquzNXiwaOMQsu5nOKxMu3W067nISw2EwgLUssVF9NOfad0GNeFPtPFoQmKJ0X
+ZiA1g6ATLTJxDLanP1by1v+AvZY0iQuDB2pBoQ==
+</ds:SignatureValue>
+<ds:KeyInfo><ds:X509Data><ds:X509Certificate>MIIDFTCCAf2gAwIBAgIUS/la89uBu+FDOcKfUVjDZeb5IHgwDQYJKoZIhvcNAQEL
+BQAwGjEYMBYGA1UEAwwPaWRwLmV4YW1wbGUub3JnMB4XDTI2MTAxODE5MzU1M1oX
+DTM2MTAxNTE5MzU1M1owGjEYMBYGA1UEAwwPaWRwLmV4YW1wbGUub3JnMIIBIjAN
+BgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAtL7z0vQwKrtVACGk1l6FvxfaDAB1
+GdJciVGZGNa9rGwNdhtuHRyCkIBUGLRVei8l5CTu5t4GGchQAOD/NPR4F0zNtXX7
+Z8PM9Y6jZwWISmptbhccC/AnIEVFikQ3lUodHcqXOWwPmeueK7SP60czgx3TUf0c
+IkLyBTXyIQdPkZLHJsJxFZi3zWZDqF4oI9/oKFDAW4+hILvR/A9YNUyqXQLX83iG
+be+5sQnfHyB04ysaMu5VzxFgJqspsE0QiodkZYkC/dujS2cCeG6Kw7A5ITrBJMWY
+bB7vi0Bzg4OTmX1F/ryPO7IimWW2Dj3Dg/OH6EOeJpHmmOvuKMgdH58ybQIDAQAB
+o1MwUTAdBgNVHQ4EFgQUe8HhGayWVBuPvd5tZtIRpDwK6/wwHwYDVR0jBBgwFoAU
+e8HhGayWVBuPvd5tZtIRpDwK6/wwDwYDVR0TAQH/BAUwAwEB/zANBgkqhkiG9w0B
+AQsFAAOCAQEAl29TKqXjGF8A63Zto0+ygHc2RU3xP5PT/O0MlzUWnsm0ewdbHIYw
+D/2DMg1oYQe6uQcgdqOfLgoaA9ZaB6QgZJzUIVncWb2kwEMScB2ysrbGquq77qCC
+Yt2g/ijL1ZsTbXFPWnWPsjc4jqUKY2HTcmEaBZlMz2bBkPKW6DGDFxFxQNbz4K9J
+75OKymvp1YI9Z/WC/2KQaY+bszncsSufFXgct1BsFg+/1uJPi9IxQYed7a0ar7wI
+0OyUjNHyvkVjSBr9tdMEj1hkQ8gQQ3wzkiV2dQYyp8sjQl1xZKPxQ10+F2nUNaJs
+Osp7gf/SPgD9JM0J926TqbcMXMCv6ECeNg==</ds:X509Certificate></ds:X509Data></ds:KeyInfo>
+</ds:Signature><saml2:Subject>
+        <saml2:NameID Format="urn:oasis:names:tc:SAML:2.0:nameid-format:persistent" NameQualifier="https://idp.example.org/idp/shibboleth">AAdzZWNyZXQxwJ2v</saml2:NameID>
+        <saml2:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+            <saml2:SubjectConfirmationData Address="192.0.2.1" InResponseTo="_request1" NotOnOrAfter="2024-05-01T10:05:00.123Z" Recipient="https://sp.example.com/acme/customers/saml/acs"/>
+        </saml2:SubjectConfirmation>
+    </saml2:Subject>
+    <saml2:Conditions NotBefore="2024-05-01T10:00:00.123Z" NotOnOrAfter="2024-05-01T10:05:00.123Z">
+        <saml2:AudienceRestriction>
+            <saml2:Audience>https://sp.example.com/saml</saml2:Audience>
+        </saml2:AudienceRestriction>
+    </saml2:Conditions>
+    <saml2:AuthnStatement AuthnInstant="2024-05-01T09:59:58.000Z" SessionIndex="_session1">
+        <saml2:AuthnContext>
+            <saml2:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport</saml2:AuthnContextClassRef>
+        </saml2:AuthnContext>
+    </saml2:AuthnStatement>
+    <saml2:AttributeStatement>
+        <saml2:Attribute FriendlyName="mail" Name="urn:oid:0.9.2342.19200300.100.1.3" NameFormat="urn:oasis:names:tc:SAML:2.0:attrname-format:uri">
+            <saml2:AttributeValue xsi:type="xs:string">jane.doe@example.org</saml2:AttributeValue>
+        </saml2:Attribute>
+        <saml2:Attribute FriendlyName="eduPersonAffiliation" Name="urn:oid:1.3.6.1.4.1.5923.1.1.1.1" NameFormat="urn:oasis:names:tc:SAML:2.0:attrname-format:uri">
+            <saml2:AttributeValue xsi:type="xs:string">member</saml2:AttributeValue>
+            <saml2:AttributeValue xsi:type="xs:string">staff &amp; faculty</saml2:AttributeValue>
+        </saml2:Attribute>
+    </saml2:AttributeStatement>
+</saml2:Assertion>
+</saml2p:Response>
+`
+
+const shibbolethCertificate = `-----BEGIN CERTIFICATE-----
+MIIDFTCCAf2gAwIBAgIUS/la89uBu+FDOcKfUVjDZeb5IHgwDQYJKoZIhvcNAQEL
+BQAwGjEYMBYGA1UEAwwPaWRwLmV4YW1wbGUub3JnMB4XDTI2MTAxODE5MzU1M1oX
+DTM2MTAxNTE5MzU1M1owGjEYMBYGA1UEAwwPaWRwLmV4YW1wbGUub3JnMIIBIjAN
+BgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAtL7z0vQwKrtVACGk1l6FvxfaDAB1
+GdJciVGZGNa9rGwNdhtuHRyCkIBUGLRVei8l5CTu5t4GGchQAOD/NPR4F0zNtXX7
+Z8PM9Y6jZwWISmptbhccC/AnIEVFikQ3lUodHcqXOWwPmeueK7SP60czgx3TUf0c
+IkLyBTXyIQdPkZLHJsJxFZi3zWZDqF4oI9/oKFDAW4+hILvR/A9YNUyqXQLX83iG
+be+5sQnfHyB04ysaMu5VzxFgJqspsE0QiodkZYkC/dujS2cCeG6Kw7A5ITrBJMWY
+bB7vi0Bzg4OTmX1F/ryPO7IimWW2Dj3Dg/OH6EOeJpHmmOvuKMgdH58ybQIDAQAB
+o1MwUTAdBgNVHQ4EFgQUe8HhGayWVBuPvd5tZtIRpDwK6/wwHwYDVR0jBBgwFoAU
+e8HhGayWVBuPvd5tZtIRpDwK6/wwDwYDVR0TAQH/BAUwAwEB/zANBgkqhkiG9w0B
+AQsFAAOCAQEAl29TKqXjGF8A63Zto0+ygHc2RU3xP5PT/O0MlzUWnsm0ewdbHIYw
+D/2DMg1oYQe6uQcgdqOfLgoaA9ZaB6QgZJzUIVncWb2kwEMScB2ysrbGquq77qCC
+Yt2g/ijL1ZsTbXFPWnWPsjc4jqUKY2HTcmEaBZlMz2bBkPKW6DGDFxFxQNbz4K9J
+75OKymvp1YI9Z/WC/2KQaY+bszncsSufFXgct1BsFg+/1uJPi9IxQYed7a0ar7wI
+0OyUjNHyvkVjSBr9tdMEj1hkQ8gQQ3wzkiV2dQYyp8sjQl1xZKPxQ10+F2nUNaJs
+Osp7gf/SPgD9JM0J926TqbcMXMCv6ECeNg==
+-----END CERTIFICATE-----`
+
+// entraResponse is a response in the style of Microsoft Entra ID: the assertion is signed with a signature in the
+// default namespace and the response is not signed
+const entraResponse = `<samlp:Response ID="_entra-response-1" Version="2.0" IssueInstant="2024-05-01T10:00:00.1234567Z" Destination="https://sp.example.com/acme/customers/saml/acs" InResponseTo="_request1" xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol"><Issuer xmlns="urn:oasis:names:tc:SAML:2.0:assertion">https://sts.windows.net/00000000-0000-0000-0000-000000000001/</Issuer><samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status><Assertion ID="_entra-assertion-1" IssueInstant="2024-05-01T10:00:00.1234567Z" Version="2.0" xmlns="urn:oasis:names:tc:SAML:2.0:assertion"><Issuer>https://sts.windows.net/00000000-0000-0000-0000-000000000001/</Issuer><Signature xmlns="http://www.w3.org/2000/09/xmldsig#"><SignedInfo><CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/><SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/><Reference URI="#_entra-assertion-1"><Transforms><Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/><Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/></Transforms><DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/><DigestValue>lBA7/wu+F+2ZfRnQvs2HDJrZoBE1/0T/fqsJRRUkyZk=</DigestValue></Reference></SignedInfo><SignatureValue>q6BSKT0/zIJuJ/GvNtspaWZDS+PIPOF5NsLzWMZobFIvdByz7xEb6H3qUc11RH4Oj+1tM6gBx4qk
+djta/8LuyJo0W3zrtLGiAodcPcoBLAoG42Qpm+pZqaK0DeIeQtkkC4kGopt0pErPFUHmfm95fU07
+T/v34RagWEm4LWBSZBT+H87db3NKCWsj8KFyavbJ1TiWOrC9HtlKcy9nU7lAvmcasrA0huEWREOh
+bI9YsEndRfQNyu+ZDZWCg3ePwoqwDUKqPqx54yvjlVC6M09zxs98l+dETFGq4mv5o2b8a1kvCc6y
+cwsp3zSqrGvleRU0GrjbVLL+eOdWvSKiz5dgjA==</SignatureValue><KeyInfo><X509Data><X509Certificate>MIIDHTCCAgWgAwIBAgIUEWfHeU5xbny/TuIq8iYkuGhN0uMwDQYJKoZIhvcNAQELBQAwHjEcMBoG
+A1UEAwwTaW50ZXJvcC5leGFtcGxlLm5ldDAeFw0yNjEwMTgyMTM5MTdaFw0zNjEwMTUyMTM5MTda
+MB4xHDAaBgNVBAMME2ludGVyb3AuZXhhbXBsZS5uZXQwggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAw
+ggEKAoIBAQCxNPauafnNjVaNR7CeXvXsg++QOHojwq2J2RX4/P+AbmELOUpJkywhFRnyWzaehSa5
+RbdsixI5vaugIXo7tT7Qj9ynMB3ZagCH3uMfRTzufn6nSdkl4QBbvSWYzSYtlnYfWiVjV6hUmIJE
+0/n6ZzI/U494zcfP/ADZ00TIFhU/L68jPmV9urZtChHVzQRoPo2CWRW5yEQW3z+ErjLv6ivVEX/K
+VqhApEWAwd3T5LisAAXLiBZiCHU+VEkoXB23tc3CNLAskUGLeop0JQsfrujXQYj8BtEnbaHJjkYG
+2P6cSTv5ZrMOUUwsb+n3qWrRA1l3DHwRK4heh3fa+OU9cWPxAgMBAAGjUzBRMB0GA1UdDgQWBBS5
+EGKamycPPFpP2UYqY2WEB+L8EDAfBgNVHSMEGDAWgBS5EGKamycPPFpP2UYqY2WEB+L8EDAPBgNV
+HRMBAf8EBTADAQH/MA0GCSqGSIb3DQEBCwUAA4IBAQAPDJFmEj+CKJryZEhRj1HnsvtUkSwZHWJu
+I9AKNqedFFNEc2bDEGDf4xcNkkjMBewqa0MEMHMSjYyyiFJYrguQeDugIZ8kGk6MOGCOtbheASFa
+h08WUTB52H5ETGPzhJ5WpFuBBvMiflKMxpcF+zA1d6EVhV5BIrXoAHrgN4j2dCYbEAXOCl3rJMuW
+KQNK6OsPxB+NHMbIeAVto7528kRoj+jPOw0qEVKeLZYgOoyhE/4Z4ZQKejfeJsJ3OezZISlHuYbo
++X6kwHWhrd1Io+vbig98hP+Dukh5U1fFxzkg8ryWIupYq7KB6A5hBPagobLJ2kg/eqiBEn5H25sy
+ioPP</X509Certificate></X509Data></KeyInfo></Signature><Subject><NameID Format="urn:oasis:names:tc:SAML:2.0:nameid-format:persistent">pQbF2mN8yV3xK7sW1tR4uZ9aE6cD0hJ5gL</NameID><SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer"><SubjectConfirmationData InResponseTo="_request1" NotOnOrAfter="2024-05-01T11:00:00.1234567Z" Recipient="https://sp.example.com/acme/customers/saml/acs"/></SubjectConfirmation></Subject><Conditions NotBefore="2024-05-01T09:55:00.1234567Z" NotOnOrAfter="2024-05-01T11:00:00.1234567Z"><AudienceRestriction><Audience>https://sp.example.com/saml</Audience></AudienceRestriction></Conditions><AttributeStatement><Attribute Name="http://schemas.microsoft.com/identity/claims/tenantid"><AttributeValue>00000000-0000-0000-0000-000000000001</AttributeValue></Attribute><Attribute Name="http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress"><AttributeValue>adele.vance@example.net</AttributeValue></Attribute><Attribute Name="http://schemas.microsoft.com/ws/2008/06/identity/claims/groups"><AttributeValue>b1c2d3e4-0000-0000-0000-000000000002</AttributeValue><AttributeValue>b1c2d3e4-0000-0000-0000-000000000003</AttributeValue></Attribute></AttributeStatement><AuthnStatement AuthnInstant="2024-05-01T09:59:58.000Z" SessionIndex="_entra-session-1"><AuthnContext><AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:Password</AuthnContextClassRef></AuthnContext></AuthnStatement></Assertion>
+</samlp:Response>`
+
+// oktaResponse is a response in the style of Okta: the namespace of the assertion is declared on the response and
+// both the response and the assertion are signed
+const oktaResponse = `<?xml version="1.0" encoding="UTF-8"?><saml2p:Response xmlns:saml2p="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml2="urn:oasis:names:tc:SAML:2.0:assertion" Destination="https://sp.example.com/acme/customers/saml/acs" ID="id-okta-response-1" InResponseTo="_request1" IssueInstant="2024-05-01T10:00:00.452Z" Version="2.0"><saml2:Issuer Format="urn:oasis:names:tc:SAML:2.0:nameid-format:entity">http://www.okta.com/exk1a2b3c4d5e6f7g8h9</saml2:Issuer><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/><ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/><ds:Reference URI="#id-okta-response-1"><ds:Transforms><ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/><ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/></ds:Transforms><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/><ds:DigestValue>u0D8sSypPTMle6WHd8qRpnM7Uyslq2/janjbGiksB2g=</ds:DigestValue></ds:Reference></ds:SignedInfo><ds:SignatureValue>eVmx+gvZHNlkkfHj4/Rb2ZjFb+xvrwqpsrgWua+3nnvM0/zDdp7g2PqH0w0SQdVyGkp8apAdMz8A
+E6LSBeb19Vd40SLhCl33sIx87hfPnqsld2lTJC5bHrM2y5Gpr0KGkkmPqHIP23exQy7OHMxBXIzu
+YwdSU+pZnX6nGGKlgCW26areg048/g7ftHk17MVPm8a12F91CfKaDfbvUlLC0LnKswvA0ZN6wvj+
+1zZXrTpof11uglMGaxC6yYxc/YprUJuCJYuilJhaSU1psDWRl4a021VGXGbhcf53txmauSsLi4Hz
+vtW4K7Ib5RQsuoLkOJWTz+HUYw3ZMrj08xvsMw==</ds:SignatureValue><ds:KeyInfo><ds:X509Data><ds:X509Certificate>MIIDHTCCAgWgAwIBAgIUEWfHeU5xbny/TuIq8iYkuGhN0uMwDQYJKoZIhvcNAQELBQAwHjEcMBoG
+A1UEAwwTaW50ZXJvcC5leGFtcGxlLm5ldDAeFw0yNjEwMTgyMTM5MTdaFw0zNjEwMTUyMTM5MTda
+MB4xHDAaBgNVBAMME2ludGVyb3AuZXhhbXBsZS5uZXQwggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAw
+ggEKAoIBAQCxNPauafnNjVaNR7CeXvXsg++QOHojwq2J2RX4/P+AbmELOUpJkywhFRnyWzaehSa5
+RbdsixI5vaugIXo7tT7Qj9ynMB3ZagCH3uMfRTzufn6nSdkl4QBbvSWYzSYtlnYfWiVjV6hUmIJE
+0/n6ZzI/U494zcfP/ADZ00TIFhU/L68jPmV9urZtChHVzQRoPo2CWRW5yEQW3z+ErjLv6ivVEX/K
+VqhApEWAwd3T5LisAAXLiBZiCHU+VEkoXB23tc3CNLAskUGLeop0JQsfrujXQYj8BtEnbaHJjkYG
+2P6cSTv5ZrMOUUwsb+n3qWrRA1l3DHwRK4heh3fa+OU9cWPxAgMBAAGjUzBRMB0GA1UdDgQWBBS5
+EGKamycPPFpP2UYqY2WEB+L8EDAfBgNVHSMEGDAWgBS5EGKamycPPFpP2UYqY2WEB+L8EDAPBgNV
+HRMBAf8EBTADAQH/MA0GCSqGSIb3DQEBCwUAA4IBAQAPDJFmEj+CKJryZEhRj1HnsvtUkSwZHWJu
+I9AKNqedFFNEc2bDEGDf4xcNkkjMBewqa0MEMHMSjYyyiFJYrguQeDugIZ8kGk6MOGCOtbheASFa
+h08WUTB52H5ETGPzhJ5WpFuBBvMiflKMxpcF+zA1d6EVhV5BIrXoAHrgN4j2dCYbEAXOCl3rJMuW
+KQNK6OsPxB+NHMbIeAVto7528kRoj+jPOw0qEVKeLZYgOoyhE/4Z4ZQKejfeJsJ3OezZISlHuYbo
++X6kwHWhrd1Io+vbig98hP+Dukh5U1fFxzkg8ryWIupYq7KB6A5hBPagobLJ2kg/eqiBEn5H25sy
+ioPP</ds:X509Certificate></ds:X509Data></ds:KeyInfo></ds:Signature><saml2p:Status><saml2p:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></saml2p:Status><saml2:Assertion ID="id-okta-assertion-1" IssueInstant="2024-05-01T10:00:00.452Z" Version="2.0"><saml2:Issuer Format="urn:oasis:names:tc:SAML:2.0:nameid-format:entity">http://www.okta.com/exk1a2b3c4d5e6f7g8h9</saml2:Issuer><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/><ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/><ds:Reference URI="#id-okta-assertion-1"><ds:Transforms><ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/><ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/></ds:Transforms><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/><ds:DigestValue>ZWmayL3ambm4JYXiWduOaa1eIf7GDR5rcCyErUZ0+gI=</ds:DigestValue></ds:Reference></ds:SignedInfo><ds:SignatureValue>IBveqia0lYz3dzoaBKKwgF69GNmINqcql66pDBxdp5m4mzDlMG/+xw6s+uwD++vPoUKuzu/48J8G
+ptwttsYtl5aJ3/Xcn20FkJgMDkHm2rYWFWnSr0Hd8ipnurFZJqO54/hnwCU+nH8Fop+DVJUJDkTb
+0KxJQN8K95y5VAmXhi1s74w8s3ZiRzPvprsLqCHmX+UDcpd/q7jiiwazRldLvdTvYJhgokKmUwHw
+2R846YDV68DVcwQajHKPDUWhO8eNjK00o52gjk74a4tQdOwQ8NzC9XTmJqyW9iSpEAzndEQWKoor
+h3tM/y7BhomMbz2CQPGUtEE0qKnLJk0JzYUg4Q==</ds:SignatureValue><ds:KeyInfo><ds:X509Data><ds:X509Certificate>MIIDHTCCAgWgAwIBAgIUEWfHeU5xbny/TuIq8iYkuGhN0uMwDQYJKoZIhvcNAQELBQAwHjEcMBoG
+A1UEAwwTaW50ZXJvcC5leGFtcGxlLm5ldDAeFw0yNjEwMTgyMTM5MTdaFw0zNjEwMTUyMTM5MTda
+MB4xHDAaBgNVBAMME2ludGVyb3AuZXhhbXBsZS5uZXQwggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAw
+ggEKAoIBAQCxNPauafnNjVaNR7CeXvXsg++QOHojwq2J2RX4/P+AbmELOUpJkywhFRnyWzaehSa5
+RbdsixI5vaugIXo7tT7Qj9ynMB3ZagCH3uMfRTzufn6nSdkl4QBbvSWYzSYtlnYfWiVjV6hUmIJE
+0/n6ZzI/U494zcfP/ADZ00TIFhU/L68jPmV9urZtChHVzQRoPo2CWRW5yEQW3z+ErjLv6ivVEX/K
+VqhApEWAwd3T5LisAAXLiBZiCHU+VEkoXB23tc3CNLAskUGLeop0JQsfrujXQYj8BtEnbaHJjkYG
+2P6cSTv5ZrMOUUwsb+n3qWrRA1l3DHwRK4heh3fa+OU9cWPxAgMBAAGjUzBRMB0GA1UdDgQWBBS5
+EGKamycPPFpP2UYqY2WEB+L8EDAfBgNVHSMEGDAWgBS5EGKamycPPFpP2UYqY2WEB+L8EDAPBgNV
+HRMBAf8EBTADAQH/MA0GCSqGSIb3DQEBCwUAA4IBAQAPDJFmEj+CKJryZEhRj1HnsvtUkSwZHWJu
+I9AKNqedFFNEc2bDEGDf4xcNkkjMBewqa0MEMHMSjYyyiFJYrguQeDugIZ8kGk6MOGCOtbheASFa
+h08WUTB52H5ETGPzhJ5WpFuBBvMiflKMxpcF+zA1d6EVhV5BIrXoAHrgN4j2dCYbEAXOCl3rJMuW
+KQNK6OsPxB+NHMbIeAVto7528kRoj+jPOw0qEVKeLZYgOoyhE/4Z4ZQKejfeJsJ3OezZISlHuYbo
++X6kwHWhrd1Io+vbig98hP+Dukh5U1fFxzkg8ryWIupYq7KB6A5hBPagobLJ2kg/eqiBEn5H25sy
+ioPP</ds:X509Certificate></ds:X509Data></ds:KeyInfo></ds:Signature><saml2:Subject><saml2:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">john.doe@example.net</saml2:NameID><saml2:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer"><saml2:SubjectConfirmationData InResponseTo="_request1" NotOnOrAfter="2024-05-01T10:05:00.452Z" Recipient="https://sp.example.com/acme/customers/saml/acs"/></saml2:SubjectConfirmation></saml2:Subject><saml2:Conditions NotBefore="2024-05-01T09:55:00.452Z" NotOnOrAfter="2024-05-01T10:05:00.452Z"><saml2:AudienceRestriction><saml2:Audience>https://sp.example.com/saml</saml2:Audience></saml2:AudienceRestriction></saml2:Conditions><saml2:AuthnStatement AuthnInstant="2024-05-01T09:59:59.452Z" SessionIndex="id-okta-session-1"><saml2:AuthnContext><saml2:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport</saml2:AuthnContextClassRef></saml2:AuthnContext></saml2:AuthnStatement><saml2:AttributeStatement><saml2:Attribute Name="email" NameFormat="urn:oasis:names:tc:SAML:2.0:attrname-format:unspecified"><saml2:AttributeValue xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xs:string">john.doe@example.net</saml2:AttributeValue></saml2:Attribute></saml2:AttributeStatement></saml2:Assertion>
+</saml2p:Response>`
+
+// interopCertificate signed entraResponse and oktaResponse
+const interopCertificate = `-----BEGIN CERTIFICATE-----
+MIIDHTCCAgWgAwIBAgIUEWfHeU5xbny/TuIq8iYkuGhN0uMwDQYJKoZIhvcNAQEL
+BQAwHjEcMBoGA1UEAwwTaW50ZXJvcC5leGFtcGxlLm5ldDAeFw0yNjEwMTgyMTM5
+MTdaFw0zNjEwMTUyMTM5MTdaMB4xHDAaBgNVBAMME2ludGVyb3AuZXhhbXBsZS5u
+ZXQwggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAwggEKAoIBAQCxNPauafnNjVaNR7Ce
+XvXsg++QOHojwq2J2RX4/P+AbmELOUpJkywhFRnyWzaehSa5RbdsixI5vaugIXo7
+tT7Qj9ynMB3ZagCH3uMfRTzufn6nSdkl4QBbvSWYzSYtlnYfWiVjV6hUmIJE0/n6
+ZzI/U494zcfP/ADZ00TIFhU/L68jPmV9urZtChHVzQRoPo2CWRW5yEQW3z+ErjLv
+6ivVEX/KVqhApEWAwd3T5LisAAXLiBZiCHU+VEkoXB23tc3CNLAskUGLeop0JQsf
+rujXQYj8BtEnbaHJjkYG2P6cSTv5ZrMOUUwsb+n3qWrRA1l3DHwRK4heh3fa+OU9
+cWPxAgMBAAGjUzBRMB0GA1UdDgQWBBS5EGKamycPPFpP2UYqY2WEB+L8EDAfBgNV
+HSMEGDAWgBS5EGKamycPPFpP2UYqY2WEB+L8EDAPBgNVHRMBAf8EBTADAQH/MA0G
+CSqGSIb3DQEBCwUAA4IBAQAPDJFmEj+CKJryZEhRj1HnsvtUkSwZHWJuI9AKNqed
+FFNEc2bDEGDf4xcNkkjMBewqa0MEMHMSjYyyiFJYrguQeDugIZ8kGk6MOGCOtbhe
+ASFah08WUTB52H5ETGPzhJ5WpFuBBvMiflKMxpcF+zA1d6EVhV5BIrXoAHrgN4j2
+dCYbEAXOCl3rJMuWKQNK6OsPxB+NHMbIeAVto7528kRoj+jPOw0qEVKeLZYgOoyh
+E/4Z4ZQKejfeJsJ3OezZISlHuYbo+X6kwHWhrd1Io+vbig98hP+Dukh5U1fFxzkg
+8ryWIupYq7KB6A5hBPagobLJ2kg/eqiBEn5H25syioPP
+-----END CERTIFICATE-----`
+
+func TestBuildAuthnRequest(t *testing.T) {
+	request := BuildAuthnRequest("_request1", "https://sp.example.com", "https://idp.example.com/sso", "https://sp.example.com/acs", NameIdFormatEmail, time.Now())
+
+	encoded, err := EncodeRedirectRequest(request)
+	require.NoError(t, err)
+
+	decoded, err := DecodeRedirectRequest(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, "_request1", decoded.ID)
+	assert.Equal(t, "https://sp.example.com", decoded.Issuer)
+	assert.Equal(t, "https://idp.example.com/sso", decoded.Destination)
+	assert.Equal(t, "https://sp.example.com/acs", decoded.AssertionConsumerServiceURL)
+	assert.Equal(t, NameIdFormatEmail, decoded.NameIdFormat())
+}
+
+func TestValidateResponse(t *testing.T) {
+	privateJWK, publicJWK, err := GenerateSigningKey("kid-1", "idp.example.com")
+	require.NoError(t, err)
+	key, err := ParseSigningKey(privateJWK)
+	require.NoError(t, err)
+	certificate, err := ParseCertificate(publicJWK)
+	require.NoError(t, err)
+
+	now := time.Now()
+	response, err := BuildResponse(&Response{
+		Issuer:       "https://idp.example.com",
+		Destination:  "https://sp.example.com/acs",
+		InResponseTo: "_request1",
+		Audience:     "https://sp.example.com",
+		NameId:       "alice@example.com",
+		NameIdFormat: NameIdFormatEmail,
+		SessionIndex: "_session1",
+		AuthnInstant: now,
+		IssueInstant: now,
+		Lifetime:     5 * time.Minute,
+		Attributes:   map[string][]string{"groups": {"admins", "users"}},
+	}, key)
+	require.NoError(t, err)
+	encoded := base64.StdEncoding.EncodeToString([]byte(response))
+
+	validation := func() *ResponseValidation {
+		return &ResponseValidation{
+			IdpEntityId: "https://idp.example.com",
+			Certificate: certificate,
+			SpEntityId:  "https://sp.example.com",
+			AcsUrl:      "https://sp.example.com/acs",
+			RequestId:   "_request1",
+			Now:         now,
+		}
+	}
+
+	assertion, err := ValidateResponse(encoded, validation())
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", assertion.NameId)
+	assert.Equal(t, NameIdFormatEmail, assertion.NameIdFormat)
+	assert.Equal(t, "_session1", assertion.SessionIndex)
+	assert.Equal(t, []string{"admins", "users"}, assertion.Attributes["groups"])
+
+	// signResponse signs the response itself after it was changed, as some identity providers do
+	signResponse := func(hash crypto.Hash, change func(response *etree.Element)) string {
+		doc := etree.NewDocument()
+		require.NoError(t, doc.ReadFromString(response))
+		change(doc.Root())
+
+		signer, err := dsig.NewSigningContext(key.PrivateKey, [][]byte{key.Certificate.Raw})
+		require.NoError(t, err)
+		signer.Hash = hash
+		signer.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+		signed, err := signer.SignEnveloped(doc.Root())
+		require.NoError(t, err)
+		doc.SetRoot(signed)
+
+		signedResponse, err := doc.WriteToString()
+		require.NoError(t, err)
+		return signedResponse
+	}
+
+	_, err = ValidateResponse(base64.StdEncoding.EncodeToString([]byte(signResponse(crypto.SHA256, func(*etree.Element) {}))), validation())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		response string
+		modify   func(v *ResponseValidation)
+	}{
+		{name: "other request", modify: func(v *ResponseValidation) { v.RequestId = "_request2" }},
+		{name: "other audience", modify: func(v *ResponseValidation) { v.SpEntityId = "https://other.example.com" }},
+		{name: "other acs url", modify: func(v *ResponseValidation) { v.AcsUrl = "https://sp.example.com/other" }},
+		{name: "other issuer", modify: func(v *ResponseValidation) { v.IdpEntityId = "https://other.example.com" }},
+		{name: "expired", modify: func(v *ResponseValidation) { v.Now = now.Add(10 * time.Minute) }},
+		{name: "not valid yet", modify: func(v *ResponseValidation) { v.Now = now.Add(-10 * time.Minute) }},
+		{name: "other certificate", modify: func(v *ResponseValidation) {
+			v.Certificate, err = ParseIdpCertificate(shibbolethCertificate)
+			require.NoError(t, err)
+		}},
+		{name: "modified assertion", response: strings.Replace(response, "alice@example.com", "mallory@example.com", 1)},
+		{name: "unsigned assertion", response: response[:strings.Index(response, "<ds:Signature")] + response[strings.Index(response, "</ds:Signature>")+len("</ds:Signature>"):]},
+		{name: "error status", response: strings.Replace(response, StatusSuccess, StatusResponder, 1)},
+		{name: "signed response without destination", response: signResponse(crypto.SHA256, func(r *etree.Element) { r.RemoveAttr("Destination") })},
+		{name: "sha-1 signature", response: signResponse(crypto.SHA1, func(*etree.Element) {})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validation()
+			if tt.modify != nil {
+				tt.modify(v)
+			}
+			encodedResponse := encoded
+			if tt.response != "" {
+				encodedResponse = base64.StdEncoding.EncodeToString([]byte(tt.response))
+			}
+
+			_, err := ValidateResponse(encodedResponse, v)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestValidateResponseOfOtherIdentityProvider(t *testing.T) {
+	certificate, err := ParseIdpCertificate(shibbolethCertificate)
+	require.NoError(t, err)
+
+	validation := &ResponseValidation{
+		IdpEntityId: "https://idp.example.org/idp/shibboleth",
+		Certificate: certificate,
+		SpEntityId:  "https://sp.example.com/saml",
+		AcsUrl:      "https://sp.example.com/acme/customers/saml/acs",
+		RequestId:   "_request1",
+		Now:         time.Date(2024, 5, 1, 10, 1, 0, 0, time.UTC),
+	}
+
+	assertion, err := ValidateResponse(base64.StdEncoding.EncodeToString([]byte(shibbolethResponse)), validation)
+	require.NoError(t, err)
+	assert.Equal(t, "AAdzZWNyZXQxwJ2v", assertion.NameId)
+	assert.Equal(t, NameIdFormatPersistent, assertion.NameIdFormat)
+	assert.Equal(t, []string{"member", "staff & faculty"}, assertion.Attributes["urn:oid:1.3.6.1.4.1.5923.1.1.1.1"])
+
+	// The whitespace of the signed assertion is part of the digest
+	modified := strings.Replace(shibbolethResponse, "<saml2:Audience>", "<saml2:Audience> ", 1)
+	_, err = ValidateResponse(base64.StdEncoding.EncodeToString([]byte(modified)), validation)
+	assert.Error(t, err)
+}
+
+func TestValidateResponseOfEntraId(t *testing.T) {
+	certificate, err := ParseIdpCertificate(interopCertificate)
+	require.NoError(t, err)
+
+	validation := &ResponseValidation{
+		IdpEntityId: "https://sts.windows.net/00000000-0000-0000-0000-000000000001/",
+		Certificate: certificate,
+		SpEntityId:  "https://sp.example.com/saml",
+		AcsUrl:      "https://sp.example.com/acme/customers/saml/acs",
+		RequestId:   "_request1",
+		Now:         time.Date(2024, 5, 1, 10, 1, 0, 0, time.UTC),
+	}
+
+	assertion, err := ValidateResponse(base64.StdEncoding.EncodeToString([]byte(entraResponse)), validation)
+	require.NoError(t, err)
+	assert.Equal(t, "_entra-assertion-1", assertion.ID)
+	assert.Equal(t, "pQbF2mN8yV3xK7sW1tR4uZ9aE6cD0hJ5gL", assertion.NameId)
+	assert.Equal(t, NameIdFormatPersistent, assertion.NameIdFormat)
+	assert.Equal(t, []string{"adele.vance@example.net"}, assertion.Attributes["http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress"])
+	assert.Equal(t, time.Date(2024, 5, 1, 11, 2, 0, 123456700, time.UTC), assertion.ExpiresAt.UTC())
+
+	// The response is not signed, but the assertion is
+	modified := strings.Replace(entraResponse, "adele.vance@example.net", "mallory@example.net", 1)
+	_, err = ValidateResponse(base64.StdEncoding.EncodeToString([]byte(modified)), validation)
+	assert.Error(t, err)
+}
+
+func TestValidateResponseOfOkta(t *testing.T) {
+	certificate, err := ParseIdpCertificate(interopCertificate)
+	require.NoError(t, err)
+
+	validation := &ResponseValidation{
+		IdpEntityId: "http://www.okta.com/exk1a2b3c4d5e6f7g8h9",
+		Certificate: certificate,
+		SpEntityId:  "https://sp.example.com/saml",
+		AcsUrl:      "https://sp.example.com/acme/customers/saml/acs",
+		RequestId:   "_request1",
+		Now:         time.Date(2024, 5, 1, 10, 1, 0, 0, time.UTC),
+	}
+
+	assertion, err := ValidateResponse(base64.StdEncoding.EncodeToString([]byte(oktaResponse)), validation)
+	require.NoError(t, err)
+	assert.Equal(t, "id-okta-assertion-1", assertion.ID)
+	assert.Equal(t, "john.doe@example.net", assertion.NameId)
+	assert.Equal(t, NameIdFormatEmail, assertion.NameIdFormat)
+	assert.Equal(t, []string{"john.doe@example.net"}, assertion.Attributes["email"])
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 7, 0, 452000000, time.UTC), assertion.ExpiresAt.UTC())
+
+	tests := []struct {
+		name     string
+		response string
+	}{
+		{name: "modified assertion", response: strings.Replace(oktaResponse, "<saml2:NameID Format=\"urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress\">john.doe@", "<saml2:NameID Format=\"urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress\">mallory@", 1)},
+		{name: "modified response", response: strings.Replace(oktaResponse, `InResponseTo="_request1" IssueInstant="2024-05-01T10:00:00.452Z"`, `InResponseTo="_request1" IssueInstant="2024-05-01T10:00:01.452Z"`, 1)},
+		{name: "removed destination", response: strings.Replace(oktaResponse, ` Destination="https://sp.example.com/acme/customers/saml/acs"`, "", 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NotEqual(t, oktaResponse, tt.response)
+			_, err := ValidateResponse(base64.StdEncoding.EncodeToString([]byte(tt.response)), validation)
+			assert.Error(t, err)
+		})
+	}
+}
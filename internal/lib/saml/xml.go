@@ -0,0 +1,180 @@
+package saml
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// element is a node of an XML message of GoAM. It is written with sorted namespace declarations and attributes and
+// without empty element tags, so messages are always the same for the same values.
+type element struct {
+	name       string
+	namespaces []attribute
+	attributes []attribute
+	children   []*element
+	text       string
+}
+
+type attribute struct {
+	name, value string
+}
+
+func newElement(name string) *element {
+	return &element{name: name}
+}
+
+// ns declares the namespace of a prefix on the element
+func (e *element) ns(prefix, uri string) *element {
+	e.namespaces = append(e.namespaces, attribute{name: prefix, value: uri})
+	return e
+}
+
+// attr sets an attribute, an empty value omits the attribute
+func (e *element) attr(name, value string) *element {
+	if value != "" {
+		e.attributes = append(e.attributes, attribute{name: name, value: value})
+	}
+	return e
+}
+
+func (e *element) setText(text string) *element {
+	e.text = text
+	return e
+}
+
+func (e *element) add(children ...*element) *element {
+	e.children = append(e.children, children...)
+	return e
+}
+
+func (e *element) String() string {
+	var b strings.Builder
+	e.write(&b)
+	return b.String()
+}
+
+func (e *element) write(b *strings.Builder) {
+	b.WriteString("<")
+	b.WriteString(e.name)
+
+	// Namespace declarations come first and are sorted by prefix, then the attributes sorted by name
+	namespaces := append([]attribute{}, e.namespaces...)
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].name < namespaces[j].name })
+	for _, namespace := range namespaces {
+		b.WriteString(` xmlns:`)
+		b.WriteString(namespace.name)
+		b.WriteString(`="`)
+		b.WriteString(escapeAttribute(namespace.value))
+		b.WriteString(`"`)
+	}
+
+	attributes := append([]attribute{}, e.attributes...)
+	sort.Slice(attributes, func(i, j int) bool { return attributes[i].name < attributes[j].name })
+	for _, attr := range attributes {
+		b.WriteString(" ")
+		b.WriteString(attr.name)
+		b.WriteString(`="`)
+		b.WriteString(escapeAttribute(attr.value))
+		b.WriteString(`"`)
+	}
+	b.WriteString(">")
+
+	b.WriteString(escapeText(e.text))
+	for _, child := range e.children {
+		child.write(b)
+	}
+
+	// The canonical form has no empty element tags
+	b.WriteString("</")
+	b.WriteString(e.name)
+	b.WriteString(">")
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+var attributeEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+
+func escapeText(text string) string {
+	return textEscaper.Replace(text)
+}
+
+func escapeAttribute(value string) string {
+	return attributeEscaper.Replace(value)
+}
+
+// parseDocument parses an XML document of another party. Documents with a DTD are rejected.
+func parseDocument(data []byte) (*etree.Element, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("invalid xml: %w", err)
+	}
+
+	for _, token := range doc.Child {
+		if _, ok := token.(*etree.Directive); ok {
+			return nil, fmt.Errorf("invalid xml: documents with a DTD are not supported")
+		}
+	}
+
+	if doc.Root() == nil {
+		return nil, fmt.Errorf("invalid xml: document has no root element")
+	}
+	return doc.Root(), nil
+}
+
+// isElement returns true if the element has the local name in the namespace
+func isElement(el *etree.Element, namespace, local string) bool {
+	return el.Tag == local && el.NamespaceURI() == namespace
+}
+
+// childElement returns the first child element with the local name in the namespace
+func childElement(el *etree.Element, namespace, local string) *etree.Element {
+	for _, child := range el.ChildElements() {
+		if isElement(child, namespace, local) {
+			return child
+		}
+	}
+	return nil
+}
+
+// childElements returns all child elements with the local name in the namespace
+func childElements(el *etree.Element, namespace, local string) []*etree.Element {
+	var elements []*etree.Element
+	for _, child := range el.ChildElements() {
+		if isElement(child, namespace, local) {
+			elements = append(elements, child)
+		}
+	}
+	return elements
+}
+
+// attrValue returns the value of an attribute without namespace
+func attrValue(el *etree.Element, name string) string {
+	for _, attr := range el.Attr {
+		if attr.Space == "" && attr.Key == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// textOf returns the text content of the element. Unlike etree it does not stop at the first comment, which would
+// allow to shorten a signed value by inserting a comment.
+func textOf(el *etree.Element) string {
+	var b strings.Builder
+	writeText(&b, el)
+	return strings.TrimSpace(b.String())
+}
+
+func writeText(b *strings.Builder, el *etree.Element) {
+	for _, token := range el.Child {
+		switch t := token.(type) {
+		case *etree.CharData:
+			b.WriteString(t.Data)
+		case *etree.Element:
+			writeText(b, t)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContextLines is the number of unchanged lines shown around each change
+const diffContextLines = 3
+
+type diffOp struct {
+	kind byte // ' ' for unchanged, '-' for removed and '+' for added lines
+	line string
+	a, b int // line index in the old and new text before this op
+}
+
+// UnifiedDiff returns a line based diff of two texts in the unified diff format.
+// If both texts are equal an empty string is returned.
+func UnifiedDiff(fromName, toName, from, to string) string {
+	ops := diffLines(splitLines(from), splitLines(to))
+
+	var out strings.Builder
+	for i := 0; i < len(ops); {
+
+		// Skip to the next change
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// Extend the hunk as long as the next change is within the context of the current one
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			} else if j-end > 2*diffContextLines {
+				break
+			}
+		}
+
+		start := max(0, i-diffContextLines)
+		stop := min(len(ops), end+1+diffContextLines)
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&out, ops[start:stop])
+
+		i = stop
+	}
+
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, ops []diffOp) {
+	countA, countB := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			countA++
+		}
+		if op.kind != '-' {
+			countB++
+		}
+	}
+
+	// Line numbers are 1-based, an empty range refers to the line before it
+	startA, startB := ops[0].a+1, ops[0].b+1
+	if countA == 0 {
+		startA--
+	}
+	if countB == 0 {
+		startB--
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", startA, countA, startB, countB)
+	for _, op := range ops {
+		out.WriteByte(op.kind)
+		out.WriteString(op.line)
+		out.WriteByte('\n')
+	}
+}
+
+// diffLines computes the edit script between two lists of lines based on their longest common subsequence
+func diffLines(a, b []string) []diffOp {
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{kind: ' ', line: a[i], a: i, b: j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{kind: '-', line: a[i], a: i, b: j})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', line: b[j], a: i, b: j})
+			j++
+		}
+	}
+
+	return ops
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
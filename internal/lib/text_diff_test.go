@@ -0,0 +1,48 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+
+	t.Run("Equal texts have no diff", func(t *testing.T) {
+		assert.Equal(t, "", UnifiedDiff("a", "b", "start: init\n", "start: init\n"))
+	})
+
+	t.Run("Changed line with context", func(t *testing.T) {
+		from := "start: init\nnodes:\n  init:\n    use: init\n    next:\n      start: askUsername\n"
+		to := "start: init\nnodes:\n  init:\n    use: init\n    next:\n      start: askEmail\n"
+
+		expected := "--- version 1\n+++ version 2\n" +
+			"@@ -3,4 +3,4 @@\n" +
+			"   init:\n" +
+			"     use: init\n" +
+			"     next:\n" +
+			"-      start: askUsername\n" +
+			"+      start: askEmail\n"
+
+		assert.Equal(t, expected, UnifiedDiff("version 1", "version 2", from, to))
+	})
+
+	t.Run("Distant changes are split into hunks", func(t *testing.T) {
+		from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+		to := "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n"
+
+		expected := "--- a\n+++ b\n" +
+			"@@ -1,3 +1,4 @@\n" +
+			"+0\n" +
+			" 1\n" +
+			" 2\n" +
+			" 3\n" +
+			"@@ -9,4 +10,3 @@\n" +
+			" 9\n" +
+			" 10\n" +
+			" 11\n" +
+			"-12\n"
+
+		assert.Equal(t, expected, UnifiedDiff("a", "b", from, to))
+	})
+}
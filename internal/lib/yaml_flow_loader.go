@@ -13,6 +13,7 @@ import (
 type yamlFlowDefinition struct {
 	Description string                   `yaml:"description"`
 	Start       string                   `yaml:"start"`
+	OnError     string                   `yaml:"on_error,omitempty"`
 	Nodes       map[string]yamlGraphNode `yaml:"nodes"`
 }
 
@@ -23,6 +24,8 @@ type yamlGraphNode struct {
 	CustomConfig        map[string]string `yaml:"custom_config,omitempty"`
 	CustomConfigLeggacy map[string]string `yaml:"customConfig,omitempty"`
 	ConfigPrefix        string            `yaml:"config_prefix,omitempty"`
+	Timeout             string            `yaml:"timeout,omitempty"`
+	Reversible          []string          `yaml:"reversible,omitempty"`
 }
 
 func LoadFlowDefinitonFromString(content string) (*model.FlowDefinition, error) {
@@ -55,12 +58,15 @@ func (y *yamlFlowDefinition) convertToFlowDefinition() (*model.FlowDefinition, e
 			Next:         yn.Next,
 			CustomConfig: yn.CustomConfig,
 			ConfigPrefix: yn.ConfigPrefix,
+			Timeout:      yn.Timeout,
+			Reversible:   yn.Reversible,
 		}
 	}
 
 	return &model.FlowDefinition{
 		Description: y.Description,
 		Start:       y.Start,
+		OnError:     y.OnError,
 		Nodes:       nodes,
 	}, nil
 }
@@ -194,3 +194,31 @@ nodes:
 	assert.Equal(t, "success", flow.Nodes["loadUser"].Next["loaded"])
 	assert.Equal(t, "failure", flow.Nodes["loadUser"].Next["not_found"])
 }
+
+func TestLoadFlowWithErrorHandling(t *testing.T) {
+	yamlContent := `
+description: Test flow with error handling
+start: init
+on_error: failure
+nodes:
+  init:
+    use: init
+    next:
+      start: callCrm
+  callCrm:
+    use: httpRequest
+    timeout: 3s
+    next:
+      success: success
+      error: failure
+  success:
+    use: successResult
+  failure:
+    use: failureResult`
+
+	flow, err := LoadFlowDefinitonFromString(yamlContent)
+	assert.NoError(t, err)
+	assert.Equal(t, "failure", flow.OnError)
+	assert.Equal(t, "3s", flow.Nodes["callCrm"].Timeout)
+	assert.Equal(t, "failure", flow.Nodes["callCrm"].Next["error"])
+}
@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// YamlPosition is a range in a yaml document, lines and columns start at 1
+type YamlPosition struct {
+	StartLine   int
+	StartColumn int
+	EndLine     int
+	EndColumn   int
+}
+
+// FindFlowDefinitionPosition returns the position of an element in the yaml of a flow definition.
+// The element is addressed by the node name, a field of the node such as "next" and a key within that field.
+// Empty parts are ignored, if node is empty the field is looked up at the top level (e.g. "start").
+// If the element does not exist the position of the closest parent is returned, or the first line
+// if the yaml cannot be parsed.
+func FindFlowDefinitionPosition(content string, node string, field string, key string) YamlPosition {
+	position := YamlPosition{StartLine: 1, StartColumn: 1, EndLine: 1, EndColumn: 1}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil || len(document.Content) == 0 {
+		return position
+	}
+
+	path := []string{field, key}
+	if node != "" {
+		path = []string{"nodes", node, field, key}
+	}
+
+	current := document.Content[0]
+	for _, name := range path {
+		if name == "" {
+			break
+		}
+
+		keyNode, valueNode := findMappingEntry(current, name)
+		if keyNode == nil {
+			break
+		}
+
+		position = YamlPosition{
+			StartLine:   keyNode.Line,
+			StartColumn: keyNode.Column,
+			EndLine:     keyNode.Line,
+			EndColumn:   keyNode.Column + len(keyNode.Value),
+		}
+		current = valueNode
+	}
+
+	return position
+}
+
+// findMappingEntry returns the key and value node of an entry in a yaml mapping
+func findMappingEntry(mapping *yaml.Node, name string) (*yaml.Node, *yaml.Node) {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == name {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,39 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindFlowDefinitionPosition(t *testing.T) {
+	content := `description: test
+start: init
+nodes:
+  init:
+    use: init
+    next:
+      start: askUsername
+  askUsername:
+    use: askUsername
+    custom_config:
+      titel: Welcome
+`
+
+	t.Run("Top level field", func(t *testing.T) {
+		assert.Equal(t, YamlPosition{StartLine: 2, StartColumn: 1, EndLine: 2, EndColumn: 6}, FindFlowDefinitionPosition(content, "", "start", ""))
+	})
+
+	t.Run("Key within a node field", func(t *testing.T) {
+		assert.Equal(t, YamlPosition{StartLine: 7, StartColumn: 7, EndLine: 7, EndColumn: 12}, FindFlowDefinitionPosition(content, "init", "next", "start"))
+		assert.Equal(t, YamlPosition{StartLine: 11, StartColumn: 7, EndLine: 11, EndColumn: 12}, FindFlowDefinitionPosition(content, "askUsername", "custom_config", "titel"))
+	})
+
+	t.Run("Missing elements fall back to the parent", func(t *testing.T) {
+		assert.Equal(t, YamlPosition{StartLine: 8, StartColumn: 3, EndLine: 8, EndColumn: 14}, FindFlowDefinitionPosition(content, "askUsername", "next", ""))
+	})
+
+	t.Run("Invalid yaml", func(t *testing.T) {
+		assert.Equal(t, YamlPosition{StartLine: 1, StartColumn: 1, EndLine: 1, EndColumn: 1}, FindFlowDefinitionPosition("start: [", "", "start", ""))
+	})
+}
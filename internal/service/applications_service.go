@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"fmt"
 
+	"github.com/Identityplane/GoAM/internal/lib/saml"
 	"github.com/Identityplane/GoAM/pkg/db"
 	"github.com/Identityplane/GoAM/pkg/model"
 	services_interface "github.com/Identityplane/GoAM/pkg/services"
@@ -58,6 +59,10 @@ func (s *applicationServiceImpl) CreateApplication(tenant, realm string, app mod
 	app.Realm = realm
 	app.Tenant = tenant
 
+	if err := validateApplicationType(&app); err != nil {
+		return err
+	}
+
 	// Check if the application already exists
 	_, exists := s.GetApplication(tenant, realm, app.ClientId)
 	if exists {
@@ -83,6 +88,10 @@ func (s *applicationServiceImpl) UpdateApplication(tenant, realm string, app mod
 	app.Realm = realm
 	app.Tenant = tenant
 
+	if err := validateApplicationType(&app); err != nil {
+		return err
+	}
+
 	// Check if the application exists
 	existingApp, exists := s.GetApplication(tenant, realm, app.ClientId)
 	if !exists {
@@ -150,3 +159,29 @@ func hashClientSecret(secret string) string {
 	hash := sha256.Sum256([]byte(secret))
 	return hex.EncodeToString(hash[:])
 }
+
+// validateApplicationType defaults the type of the application to oauth2 and checks that a saml application
+// has the settings of its service provider
+func validateApplicationType(app *model.Application) error {
+	switch app.Type {
+	case "":
+		app.Type = model.ApplicationTypeOAuth2
+	case model.ApplicationTypeOAuth2:
+	case model.ApplicationTypeSaml:
+		if app.Settings == nil || app.Settings.Saml == nil {
+			return fmt.Errorf("saml application requires saml_settings")
+		}
+		if app.Settings.Saml.EntityId == "" {
+			return fmt.Errorf("saml application requires an entity_id")
+		}
+		if len(app.Settings.Saml.AcsUrls) == 0 {
+			return fmt.Errorf("saml application requires at least one acs_url")
+		}
+		if format := app.Settings.Saml.NameIdFormat; format != "" && !saml.IsSupportedNameIdFormat(format) {
+			return fmt.Errorf("unsupported name_id_format %s", format)
+		}
+	default:
+		return fmt.Errorf("unknown application type %s", app.Type)
+	}
+	return nil
+}
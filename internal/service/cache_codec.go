@@ -0,0 +1,150 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// Type names used in the envelope of serialized cache entries
+const (
+	cacheTypeString                = "string"
+	cacheTypeFlow                  = "flow"
+	cacheTypeApplication           = "application"
+	cacheTypeAuthSession           = "auth_session"
+	cacheTypePersistentAuthSession = "persistent_auth_session"
+	cacheTypeClientSession         = "client_session"
+)
+
+// errCacheValueNotSerializable is returned for values that must stay in the local process,
+// e.g. loaded realms which hold live repositories or signing keys which hold private key material
+var errCacheValueNotSerializable = errors.New("cache value type is not serializable")
+
+// cacheEnvelope wraps a serialized cache value together with its type so it can be decoded again
+type cacheEnvelope struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// cachedFlow also carries the fields of a flow that are excluded from the api json representation
+type cachedFlow struct {
+	Flow           *model.Flow           `json:"flow"`
+	Definition     *model.FlowDefinition `json:"definition,omitempty"`
+	DefinitionYaml string                `json:"definition_yaml,omitempty"`
+}
+
+// cachedApplication also carries the client secret which is excluded from the api json representation
+type cachedApplication struct {
+	Application  *model.Application `json:"application"`
+	ClientSecret string             `json:"client_secret,omitempty"`
+}
+
+// cachedClientSession also carries the token hashes which are excluded from the api json representation
+type cachedClientSession struct {
+	Session          *model.ClientSession `json:"session"`
+	AccessTokenHash  string               `json:"access_token_hash,omitempty"`
+	RefreshTokenHash string               `json:"refresh_token_hash,omitempty"`
+	AuthCodeHash     string               `json:"auth_code_hash,omitempty"`
+}
+
+// encodeCacheValue serializes one of the cached model types into a json envelope
+func encodeCacheValue(value interface{}) ([]byte, error) {
+
+	var typeName string
+	var payload interface{}
+
+	switch v := value.(type) {
+	case string:
+		typeName, payload = cacheTypeString, v
+	case *model.Flow:
+		typeName, payload = cacheTypeFlow, &cachedFlow{Flow: v, Definition: v.Definition, DefinitionYaml: v.DefinitionYaml}
+	case *model.Application:
+		typeName, payload = cacheTypeApplication, &cachedApplication{Application: v, ClientSecret: v.ClientSecret}
+	case *model.AuthenticationSession:
+		typeName, payload = cacheTypeAuthSession, v
+	case *model.PersistentAuthSession:
+		typeName, payload = cacheTypePersistentAuthSession, v
+	case *model.ClientSession:
+		typeName, payload = cacheTypeClientSession, &cachedClientSession{
+			Session:          v,
+			AccessTokenHash:  v.AccessTokenHash,
+			RefreshTokenHash: v.RefreshTokenHash,
+			AuthCodeHash:     v.AuthCodeHash,
+		}
+	default:
+		return nil, fmt.Errorf("%w: %T", errCacheValueNotSerializable, value)
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cache value: %w", err)
+	}
+
+	return json.Marshal(&cacheEnvelope{Type: typeName, Value: raw})
+}
+
+// decodeCacheValue restores a value that was serialized with encodeCacheValue
+func decodeCacheValue(data []byte) (interface{}, error) {
+
+	var envelope cacheEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cache envelope: %w", err)
+	}
+
+	switch envelope.Type {
+	case cacheTypeString:
+		var s string
+		err := json.Unmarshal(envelope.Value, &s)
+		return s, err
+
+	case cacheTypeFlow:
+		var cf cachedFlow
+		if err := json.Unmarshal(envelope.Value, &cf); err != nil {
+			return nil, err
+		}
+		if cf.Flow == nil {
+			return nil, fmt.Errorf("cached flow is empty")
+		}
+		cf.Flow.Definition = cf.Definition
+		cf.Flow.DefinitionYaml = cf.DefinitionYaml
+		return cf.Flow, nil
+
+	case cacheTypeApplication:
+		var ca cachedApplication
+		if err := json.Unmarshal(envelope.Value, &ca); err != nil {
+			return nil, err
+		}
+		if ca.Application == nil {
+			return nil, fmt.Errorf("cached application is empty")
+		}
+		ca.Application.ClientSecret = ca.ClientSecret
+		return ca.Application, nil
+
+	case cacheTypeAuthSession:
+		var session model.AuthenticationSession
+		err := json.Unmarshal(envelope.Value, &session)
+		return &session, err
+
+	case cacheTypePersistentAuthSession:
+		var session model.PersistentAuthSession
+		err := json.Unmarshal(envelope.Value, &session)
+		return &session, err
+
+	case cacheTypeClientSession:
+		var cs cachedClientSession
+		if err := json.Unmarshal(envelope.Value, &cs); err != nil {
+			return nil, err
+		}
+		if cs.Session == nil {
+			return nil, fmt.Errorf("cached client session is empty")
+		}
+		cs.Session.AccessTokenHash = cs.AccessTokenHash
+		cs.Session.RefreshTokenHash = cs.RefreshTokenHash
+		cs.Session.AuthCodeHash = cs.AuthCodeHash
+		return cs.Session, nil
+	}
+
+	return nil, fmt.Errorf("unknown cache value type: %s", envelope.Type)
+}
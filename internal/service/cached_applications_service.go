@@ -116,4 +116,17 @@ func (s *cachedApplicationService) VerifyClientSecret(tenant, realm, clientId, c
 func (s *cachedApplicationService) invalidateCache(tenant, realm, clientId string) {
 	cacheKey := s.getApplicationCacheKey(tenant, realm, clientId)
 	s.cache.Invalidate(cacheKey)
+
+	// Let the other instances know that the application changed
+	publishConfigChange(tenant, realm, model.ConfigEntityApplication, clientId)
+}
+
+// handleConfigChange evicts an application changed on any instance and reloads it into the cache
+func (s *cachedApplicationService) handleConfigChange(change model.ConfigChange) {
+	if change.EntityType != model.ConfigEntityApplication {
+		return
+	}
+
+	s.cache.Invalidate(s.getApplicationCacheKey(change.Tenant, change.Realm, change.EntityId))
+	s.GetApplication(change.Tenant, change.Realm, change.EntityId)
 }
@@ -34,6 +34,11 @@ func (s *cachedFlowService) getFlowByIdCacheKey(tenant, realm, id string) string
 	return fmt.Sprintf("/%s/%s/flow/id/%s", tenant, realm, id)
 }
 
+// getFlowVersionCacheKey returns a cache key in the format /<tenant>/<realm>/flow/id/<id>/version/<version>
+func (s *cachedFlowService) getFlowVersionCacheKey(tenant, realm, id string, version int) string {
+	return fmt.Sprintf("/%s/%s/flow/id/%s/version/%d", tenant, realm, id, version)
+}
+
 // getFlowByPathCacheKey returns a cache key in the format /<tenant>/<realm>/flow/path/<path>
 func (s *cachedFlowService) getFlowByPathCacheKey(tenant, realm, path string) string {
 	return fmt.Sprintf("/%s/%s/flow/path/%s", tenant, realm, path)
@@ -92,6 +97,30 @@ func (s *cachedFlowService) GetFlowForExecution(path string, loadedRealm *servic
 	return flow, true
 }
 
+func (s *cachedFlowService) GetFlowVersionForExecution(id string, version int, loadedRealm *services_interface.LoadedRealm) (*model.Flow, bool) {
+	log := logger.GetGoamLogger()
+
+	// Versions are immutable, but the flow settings are not, so the usual flow TTL applies
+	cacheKey := s.getFlowVersionCacheKey(loadedRealm.Config.Tenant, loadedRealm.Config.Realm, id, version)
+	if cached, exists := s.cache.Get(cacheKey); exists {
+		if flow, ok := cached.(*model.Flow); ok {
+			return flow, true
+		}
+	}
+
+	flow, exists := s.flowService.GetFlowVersionForExecution(id, version, loadedRealm)
+	if !exists {
+		return nil, false
+	}
+
+	err := s.cache.Cache(cacheKey, flow, flowCacheTTL, 1)
+	if err != nil {
+		log.Info().Err(err).Msg("failed to cache flow version")
+	}
+
+	return flow, true
+}
+
 // Direct pass-through methods (no caching)
 func (s *cachedFlowService) ListFlows(tenant, realm string) ([]model.Flow, error) {
 	return s.flowService.ListFlows(tenant, realm)
@@ -130,6 +159,22 @@ func (s *cachedFlowService) UpdateFlow(tenant, realm string, flow model.Flow) er
 	return nil
 }
 
+func (s *cachedFlowService) ImportFlow(tenant, realm string, flow model.Flow) error {
+	// Get the original flow first to get its path for cache invalidation
+	originalFlow, exists := s.flowService.GetFlowById(tenant, realm, flow.Id)
+
+	err := s.flowService.ImportFlow(tenant, realm, flow)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		s.invalidateCaches(tenant, realm, flow.Id, originalFlow.Route)
+	}
+	s.invalidateCaches(tenant, realm, flow.Id, flow.Route)
+	return nil
+}
+
 func (s *cachedFlowService) DeleteFlow(tenant, realm, id string) error {
 	// Get the flow first to get its route for cache invalidation
 	flow, exists := s.flowService.GetFlowById(tenant, realm, id)
@@ -151,6 +196,71 @@ func (s *cachedFlowService) ValidateFlowDefinition(content string) ([]services_i
 	return s.flowService.ValidateFlowDefinition(content)
 }
 
+func (s *cachedFlowService) CreateFlowVersion(tenant, realm, id, definitionYaml, comment string) (*model.FlowVersion, error) {
+	version, err := s.flowService.CreateFlowVersion(tenant, realm, id, definitionYaml, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	// Creating the first draft of a flow also records its initial version
+	s.invalidateFlowById(tenant, realm, id)
+	return version, nil
+}
+
+func (s *cachedFlowService) ListFlowVersions(tenant, realm, id string) ([]model.FlowVersion, error) {
+	return s.flowService.ListFlowVersions(tenant, realm, id)
+}
+
+func (s *cachedFlowService) GetFlowVersion(tenant, realm, id string, version int) (*model.FlowVersion, bool) {
+	return s.flowService.GetFlowVersion(tenant, realm, id, version)
+}
+
+func (s *cachedFlowService) PublishFlowVersion(tenant, realm, id string, version int) error {
+	err := s.flowService.PublishFlowVersion(tenant, realm, id, version)
+	if err != nil {
+		return err
+	}
+
+	s.invalidateFlowById(tenant, realm, id)
+	return nil
+}
+
+func (s *cachedFlowService) RollbackFlow(tenant, realm, id string) (*model.FlowVersion, error) {
+	version, err := s.flowService.RollbackFlow(tenant, realm, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidateFlowById(tenant, realm, id)
+	return version, nil
+}
+
+func (s *cachedFlowService) DiffFlowVersions(tenant, realm, id string, from, to int) (string, error) {
+	return s.flowService.DiffFlowVersions(tenant, realm, id, from, to)
+}
+
+func (s *cachedFlowService) SelectFlowVariant(flow *model.Flow, stickyKey, runId string) *model.FlowVariant {
+	return s.flowService.SelectFlowVariant(flow, stickyKey, runId)
+}
+
+func (s *cachedFlowService) RecordFlowVariantResult(session *model.AuthenticationSession) {
+	s.flowService.RecordFlowVariantResult(session)
+}
+
+func (s *cachedFlowService) GetFlowVariantMetrics(tenant, realm, id string) ([]services_interface.FlowVariantMetrics, error) {
+	return s.flowService.GetFlowVariantMetrics(tenant, realm, id)
+}
+
+// invalidateFlowById invalidates the caches of a flow whose route did not change
+func (s *cachedFlowService) invalidateFlowById(tenant, realm, id string) {
+	flow, exists := s.flowService.GetFlowById(tenant, realm, id)
+	if !exists {
+		return
+	}
+
+	s.invalidateCaches(tenant, realm, id, flow.Route)
+}
+
 // invalidateCaches invalidates all relevant cache entries
 func (s *cachedFlowService) invalidateCaches(tenant, realm, id, path string) {
 	// Invalidate by ID cache
@@ -160,4 +270,20 @@ func (s *cachedFlowService) invalidateCaches(tenant, realm, id, path string) {
 	// Invalidate by path cache
 	pathKey := s.getFlowByPathCacheKey(tenant, realm, path)
 	s.cache.Invalidate(pathKey)
+
+	// Let the other instances know that the flow and its route changed
+	publishConfigChange(tenant, realm, model.ConfigEntityFlow, id)
+	publishConfigChange(tenant, realm, model.ConfigEntityFlowRoute, path)
+}
+
+// handleConfigChange evicts a flow changed on any instance. Flows by id are reloaded into the cache right away,
+// flows by route are reloaded with the next request as they need the loaded realm.
+func (s *cachedFlowService) handleConfigChange(change model.ConfigChange) {
+	switch change.EntityType {
+	case model.ConfigEntityFlow:
+		s.cache.Invalidate(s.getFlowByIdCacheKey(change.Tenant, change.Realm, change.EntityId))
+		s.GetFlowById(change.Tenant, change.Realm, change.EntityId)
+	case model.ConfigEntityFlowRoute:
+		s.cache.Invalidate(s.getFlowByPathCacheKey(change.Tenant, change.Realm, change.EntityId))
+	}
 }
@@ -100,6 +100,19 @@ func (s *cachedRealmService) invalidateCaches(tenant, realm string) {
 	// Invalidate specific realm cache
 	realmKey := s.getCacheKey(tenant, realm)
 	s.cache.Invalidate(realmKey)
+
+	// Let the other instances know that the realm changed
+	publishConfigChange(tenant, realm, model.ConfigEntityRealm, "")
+}
+
+// handleConfigChange evicts a realm changed on any instance and reloads it into the cache
+func (s *cachedRealmService) handleConfigChange(change model.ConfigChange) {
+	if change.EntityType != model.ConfigEntityRealm {
+		return
+	}
+
+	s.cache.Invalidate(s.getCacheKey(change.Tenant, change.Realm))
+	s.GetRealm(change.Tenant, change.Realm)
 }
 
 // This is not cached
@@ -49,16 +49,28 @@ func (s *cachedSessionsService) ResetAuthSessionObject(session *model.Authentica
 func (s *cachedSessionsService) CreateOrUpdateAuthenticationSession(ctx context.Context, tenant, realm string, session model.AuthenticationSession) error {
 	err := s.sessionsService.CreateOrUpdateAuthenticationSession(ctx, tenant, realm, session)
 	if err == nil {
-		// Cache the session
-		cacheKey := fmt.Sprintf("auth_session:%s:%s:%s", tenant, realm, session.SessionIdHash)
-		if err := s.cache.Cache(cacheKey, &session, sessionCacheTTL, 1); err != nil {
-			log := logger.GetGoamLogger()
-			log.Error().Err(err).Msg("failed to cache auth session")
-		}
+		s.cacheAuthSession(ctx, tenant, realm, session.SessionIdHash, &session)
 	}
 	return err
 }
 
+// cacheAuthSession caches the session like it is persisted: ephemeral values are removed and sensitive values are
+// encrypted, as the cache may be shared with other instances through redis
+func (s *cachedSessionsService) cacheAuthSession(ctx context.Context, tenant, realm, sessionIDHash string, session *model.AuthenticationSession) {
+	log := logger.GetGoamLogger()
+
+	cached := session.WithoutEphemeralContext()
+	if err := encryptSessionSecrets(ctx, tenant, realm, sessionIDHash, cached); err != nil {
+		log.Error().Err(err).Msg("failed to cache auth session")
+		return
+	}
+
+	cacheKey := fmt.Sprintf("auth_session:%s:%s:%s", tenant, realm, sessionIDHash)
+	if err := s.cache.Cache(cacheKey, cached, sessionCacheTTL, 1); err != nil {
+		log.Error().Err(err).Msg("failed to cache auth session")
+	}
+}
+
 // GetAuthenticationSessionByID retrieves an authentication session by its ID
 func (s *cachedSessionsService) GetAuthenticationSessionByID(ctx context.Context, tenant, realm, sessionID string) (*model.AuthenticationSession, bool) {
 	return s.sessionsService.GetAuthenticationSessionByID(ctx, tenant, realm, sessionID)
@@ -69,23 +81,27 @@ func (s *cachedSessionsService) GetAuthenticationSession(ctx context.Context, te
 	// Try to get from cache first
 	cacheKey := fmt.Sprintf("auth_session:%s:%s:%s", tenant, realm, sessionIDHash)
 	if cached, found := s.cache.Get(cacheKey); found && cached != nil {
-		if session, ok := cached.(*model.AuthenticationSession); ok {
-			return session, true
+		if cachedSession, ok := cached.(*model.AuthenticationSession); ok {
+			session := *cachedSession
+			if err := decryptSessionSecrets(ctx, tenant, realm, sessionIDHash, &session); err == nil {
+				return &session, true
+			}
 		}
 	}
 
 	// If not in cache, get from service
 	session, found := s.sessionsService.GetAuthenticationSession(ctx, tenant, realm, sessionIDHash)
 	if found {
-		// Cache the session
-		if err := s.cache.Cache(cacheKey, session, sessionCacheTTL, 1); err != nil {
-			log := logger.GetGoamLogger()
-			log.Error().Err(err).Msg("failed to cache auth session")
-		}
+		s.cacheAuthSession(ctx, tenant, realm, sessionIDHash, session)
 	}
 	return session, found
 }
 
+// ListAuthenticationSessions returns the sessions of a flow created since the given time, always from the database
+func (s *cachedSessionsService) ListAuthenticationSessions(ctx context.Context, tenant, realm, flowId string, since time.Time) ([]*model.AuthenticationSession, error) {
+	return s.sessionsService.ListAuthenticationSessions(ctx, tenant, realm, flowId, since)
+}
+
 // DeleteAuthenticationSession removes an authentication session
 func (s *cachedSessionsService) DeleteAuthenticationSession(ctx context.Context, tenant, realm, sessionIDHash string) error {
 	err := s.sessionsService.DeleteAuthenticationSession(ctx, tenant, realm, sessionIDHash)
@@ -100,6 +116,16 @@ func (s *cachedSessionsService) DeleteAuthenticationSession(ctx context.Context,
 	return err
 }
 
+// ApproveMagicLink records the approval of a magic link, approvals are not cached
+func (s *cachedSessionsService) ApproveMagicLink(ctx context.Context, tenant, realm, sessionIDHash, linkID string, expiresAt time.Time) (bool, error) {
+	return s.sessionsService.ApproveMagicLink(ctx, tenant, realm, sessionIDHash, linkID, expiresAt)
+}
+
+// ConsumeMagicLinkApproval deletes the approval of a magic link, approvals are not cached
+func (s *cachedSessionsService) ConsumeMagicLinkApproval(ctx context.Context, tenant, realm, sessionIDHash, linkID string) (bool, error) {
+	return s.sessionsService.ConsumeMagicLinkApproval(ctx, tenant, realm, sessionIDHash, linkID)
+}
+
 // CreateAuthCodeSession creates a new client session with an auth code
 func (s *cachedSessionsService) CreateAuthCodeSession(ctx context.Context, tenant, realm, clientID, userID string, scope []string, grantType string, codeChallenge string, codeChallengeMethod string, loginSession *model.AuthenticationSession, claims map[string]interface{}) (string, *model.ClientSession, error) {
 	code, session, err := s.sessionsService.CreateAuthCodeSession(ctx, tenant, realm, clientID, userID, scope, grantType, codeChallenge, codeChallengeMethod, loginSession, claims)
@@ -167,6 +193,12 @@ func (s *cachedSessionsService) LoadAndDeleteRefreshTokenSession(ctx context.Con
 	return s.sessionsService.LoadAndDeleteRefreshTokenSession(ctx, tenant, realm, refreshToken)
 }
 
+// RevokeUserClientSessions deletes all client sessions of a user
+// Cached access tokens are keyed by the token itself and expire with the short session cache ttl
+func (s *cachedSessionsService) RevokeUserClientSessions(ctx context.Context, tenant, realm, userID string) (int, error) {
+	return s.sessionsService.RevokeUserClientSessions(ctx, tenant, realm, userID)
+}
+
 // cachedAuthSessionDB implements AuthSessionDB with caching
 type cachedAuthSessionDB struct {
 	authSessionDB db.AuthSessionDB
@@ -236,6 +268,11 @@ func (c *cachedAuthSessionDB) ListAuthSessions(ctx context.Context, tenant, real
 	return c.authSessionDB.ListAuthSessions(ctx, tenant, realm)
 }
 
+func (c *cachedAuthSessionDB) ListAuthSessionsByFlow(ctx context.Context, tenant, realm, flowID string, since time.Time, limit int) ([]model.PersistentAuthSession, error) {
+	// Direct call to database - no caching for list operations
+	return c.authSessionDB.ListAuthSessionsByFlow(ctx, tenant, realm, flowID, since, limit)
+}
+
 func (c *cachedAuthSessionDB) ListAllAuthSessions(ctx context.Context, tenant string) ([]model.PersistentAuthSession, error) {
 	// Direct call to database - no caching for list operations
 	return c.authSessionDB.ListAllAuthSessions(ctx, tenant)
@@ -255,11 +292,21 @@ func (c *cachedAuthSessionDB) DeleteAuthSession(ctx context.Context, tenant, rea
 	return nil
 }
 
-func (c *cachedAuthSessionDB) DeleteExpiredAuthSessions(ctx context.Context, tenant, realm string) error {
+func (c *cachedAuthSessionDB) DeleteExpiredAuthSessions(ctx context.Context, tenant, realm string) (int, error) {
 	// Direct call to database - no caching for cleanup operations
 	return c.authSessionDB.DeleteExpiredAuthSessions(ctx, tenant, realm)
 }
 
+func (c *cachedAuthSessionDB) SaveMagicLinkApproval(ctx context.Context, tenant, realm, sessionIDHash, linkID string, expiresAt time.Time) (bool, error) {
+	// Direct call to database - approvals must not be served from a stale cache
+	return c.authSessionDB.SaveMagicLinkApproval(ctx, tenant, realm, sessionIDHash, linkID, expiresAt)
+}
+
+func (c *cachedAuthSessionDB) ConsumeMagicLinkApproval(ctx context.Context, tenant, realm, sessionIDHash, linkID string) (bool, error) {
+	// Direct call to database - approvals must not be served from a stale cache
+	return c.authSessionDB.ConsumeMagicLinkApproval(ctx, tenant, realm, sessionIDHash, linkID)
+}
+
 // cachedClientSessionDB implements ClientSessionDB with caching for auth code and access token sessions
 type cachedClientSessionDB struct {
 	clientSessionDB db.ClientSessionDB
@@ -423,7 +470,7 @@ func (c *cachedClientSessionDB) DeleteClientSession(ctx context.Context, tenant,
 	return nil
 }
 
-func (c *cachedClientSessionDB) DeleteExpiredClientSessions(ctx context.Context, tenant, realm string) error {
+func (c *cachedClientSessionDB) DeleteExpiredClientSessions(ctx context.Context, tenant, realm string) (int, error) {
 	// Direct call to database - no caching for cleanup operations
 	return c.clientSessionDB.DeleteExpiredClientSessions(ctx, tenant, realm)
 }
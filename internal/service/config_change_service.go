@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/logger"
+	"github.com/Identityplane/GoAM/pkg/db"
+	"github.com/Identityplane/GoAM/pkg/model"
+	services_interface "github.com/Identityplane/GoAM/pkg/services"
+)
+
+// configChangeWatchRetryDelay is the delay before the watch is restarted after it failed, e.g. due to a lost database connection
+var configChangeWatchRetryDelay = 5 * time.Second
+
+// configChangeGapTimeout is how long a missing version below the latest applied version is read again. Versions are
+// assigned when a change is inserted, a change that commits after a later one shows up late. Versions of rolled back
+// inserts never show up, they are given up after this timeout.
+var configChangeGapTimeout = time.Minute
+
+// configChangeHandler is implemented by services that cache configuration and need to evict and reload it
+// when it was changed on any instance
+type configChangeHandler interface {
+	handleConfigChange(change model.ConfigChange)
+}
+
+// configChangeServiceImpl implements ConfigChangeService on top of the change log in the database.
+// If no ConfigChangeDB is available changes are only applied on the local instance.
+type configChangeServiceImpl struct {
+	changeDB db.ConfigChangeDB
+
+	// applyMutex ensures changes are applied one at a time and in order
+	applyMutex sync.Mutex
+	handlers   []func(change model.ConfigChange)
+	version    atomic.Int64
+
+	// gaps are the versions below version that were not seen yet and when they were first missed
+	gaps map[int64]time.Time
+}
+
+// NewConfigChangeService creates a new ConfigChangeService, changeDB may be nil for single instance deployments
+func NewConfigChangeService(changeDB db.ConfigChangeDB) services_interface.ConfigChangeService {
+	return &configChangeServiceImpl{
+		changeDB: changeDB,
+	}
+}
+
+// RegisterConfigChangeHandlers connects all services that cache configuration to the config change service
+func RegisterConfigChangeHandlers(services *services_interface.Services) {
+
+	if services.ConfigChangeService == nil {
+		return
+	}
+
+	candidates := []interface{}{
+		services.RealmService,
+		services.FlowService,
+		services.ApplicationService,
+		services.TemplatesService,
+	}
+
+	for _, candidate := range candidates {
+		if handler, ok := candidate.(configChangeHandler); ok {
+			services.ConfigChangeService.OnChange(handler.handleConfigChange)
+		}
+	}
+}
+
+func (s *configChangeServiceImpl) PublishChange(ctx context.Context, change *model.ConfigChange) error {
+
+	if s.changeDB == nil {
+		s.applyMutex.Lock()
+		defer s.applyMutex.Unlock()
+
+		change.Version = s.version.Load() + 1
+		change.CreatedAt = time.Now()
+		s.applyChange(*change)
+		s.version.Store(change.Version)
+		return nil
+	}
+
+	err := s.changeDB.CreateConfigChange(ctx, change)
+	if err != nil {
+		return err
+	}
+
+	// Apply the change on this instance right away instead of waiting for the notification
+	s.applyPendingChanges(ctx)
+	return nil
+}
+
+func (s *configChangeServiceImpl) OnChange(handler func(change model.ConfigChange)) {
+	s.applyMutex.Lock()
+	defer s.applyMutex.Unlock()
+
+	s.handlers = append(s.handlers, handler)
+}
+
+func (s *configChangeServiceImpl) Start(ctx context.Context) error {
+
+	if s.changeDB == nil {
+		return nil
+	}
+
+	// The configuration is loaded fresh at startup, so only changes after this version are relevant
+	version, err := s.changeDB.GetLatestConfigVersion(ctx)
+	if err != nil {
+		return err
+	}
+	s.version.Store(version)
+
+	go s.watch(ctx)
+	return nil
+}
+
+func (s *configChangeServiceImpl) GetConfigVersion() int64 {
+	return s.version.Load()
+}
+
+// watch keeps the database watch running and catches up on changes that were missed while it was down
+func (s *configChangeServiceImpl) watch(ctx context.Context) {
+	log := logger.GetGoamLogger()
+
+	for ctx.Err() == nil {
+
+		err := s.changeDB.WatchConfigChanges(ctx, func() {
+			s.applyPendingChanges(ctx)
+		})
+		if err != nil {
+			log.Warn().Err(err).Msg("config change watch failed, restarting")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(configChangeWatchRetryDelay):
+		}
+
+		s.applyPendingChanges(ctx)
+	}
+}
+
+// applyPendingChanges loads all changes after the current version from the database and applies them in order.
+// Changes that commit out of order leave a gap below the current version, which is read again until the missing
+// change shows up or the gap times out.
+func (s *configChangeServiceImpl) applyPendingChanges(ctx context.Context) {
+	s.applyMutex.Lock()
+	defer s.applyMutex.Unlock()
+
+	version := s.version.Load()
+
+	from := version
+	for gap := range s.gaps {
+		from = min(from, gap-1)
+	}
+
+	changes, err := s.changeDB.ListConfigChangesSince(ctx, from)
+	if err != nil {
+		log := logger.GetGoamLogger()
+		log.Warn().Err(err).Msg("failed to load config changes")
+		return
+	}
+
+	now := time.Now()
+	for _, change := range changes {
+
+		if change.Version <= version {
+			// Changes below the current version were applied already, unless they fill a gap
+			if _, missing := s.gaps[change.Version]; missing {
+				delete(s.gaps, change.Version)
+				s.applyChange(change)
+			}
+			continue
+		}
+
+		for missing := version + 1; missing < change.Version; missing++ {
+			if s.gaps == nil {
+				s.gaps = make(map[int64]time.Time)
+			}
+			s.gaps[missing] = now
+		}
+
+		s.applyChange(change)
+		version = change.Version
+		s.version.Store(version)
+	}
+
+	for gap, missedAt := range s.gaps {
+		if now.Sub(missedAt) > configChangeGapTimeout {
+			delete(s.gaps, gap)
+		}
+	}
+}
+
+// applyChange calls all handlers for a change, must be called with the applyMutex held
+func (s *configChangeServiceImpl) applyChange(change model.ConfigChange) {
+	log := logger.GetGoamLogger()
+	log.Debug().
+		Int64("version", change.Version).
+		Str("tenant", change.Tenant).
+		Str("realm", change.Realm).
+		Str("entity_type", change.EntityType).
+		Str("entity_id", change.EntityId).
+		Msg("applying config change")
+
+	for _, handler := range s.handlers {
+		handler(change)
+	}
+}
+
+// publishConfigChange announces a change through the registered ConfigChangeService, if there is one.
+// Failing to publish does not fail the write itself, the other instances then pick up the change after their cache TTL.
+func publishConfigChange(tenant, realm, entityType, entityId string) {
+
+	// Services might not be registered yet, e.g. when the cached services are used standalone
+	if services == nil || services.ConfigChangeService == nil {
+		return
+	}
+
+	err := services.ConfigChangeService.PublishChange(context.Background(), &model.ConfigChange{
+		Tenant:     tenant,
+		Realm:      realm,
+		EntityType: entityType,
+		EntityId:   entityId,
+	})
+	if err != nil {
+		log := logger.GetGoamLogger()
+		log.Warn().Err(err).Str("tenant", tenant).Str("realm", realm).Str("entity_type", entityType).Msg("failed to publish config change")
+	}
+}
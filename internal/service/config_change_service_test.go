@@ -0,0 +1,167 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/db/sqlite_adapter"
+	"github.com/Identityplane/GoAM/pkg/model"
+	services_interface "github.com/Identityplane/GoAM/pkg/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestInstance simulates one GoAM instance with its own cache on top of the shared database
+func newTestInstance(t *testing.T, sqliteDB *sql.DB) (services_interface.FlowService, services_interface.ConfigChangeService) {
+	flowDB, err := sqlite_adapter.NewFlowDB(sqliteDB)
+	require.NoError(t, err)
+
+	configChangeDB, err := sqlite_adapter.NewConfigChangeDB(sqliteDB)
+	require.NoError(t, err)
+
+	cache, err := NewCacheService()
+	require.NoError(t, err)
+
+	flowService := NewCachedFlowService(NewFlowService(flowDB, nil, nil), cache)
+	configChangeService := NewConfigChangeService(configChangeDB)
+	configChangeService.OnChange(flowService.(configChangeHandler).handleConfigChange)
+
+	return flowService, configChangeService
+}
+
+func TestConfigChangeService_PropagatesChangesBetweenInstances(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sqliteDB, err := sql.Open("sqlite", ":memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	defer sqliteDB.Close()
+	sqliteDB.SetMaxOpenConns(1)
+
+	err = sqlite_adapter.RunMigrations(sqliteDB)
+	require.NoError(t, err)
+
+	flowsA, changesA := newTestInstance(t, sqliteDB)
+	flowsB, changesB := newTestInstance(t, sqliteDB)
+
+	require.NoError(t, changesA.Start(ctx))
+	require.NoError(t, changesB.Start(ctx))
+
+	flow := model.Flow{Id: "login", Route: "/login", Active: true, DefinitionYaml: DEFAULT_FLOW_DEFINITION}
+	require.NoError(t, flowsA.CreateFlow("acme", "customers", flow))
+
+	// Instance B caches the flow
+	cached, found := flowsB.GetFlowById("acme", "customers", "login")
+	require.True(t, found)
+	assert.True(t, cached.Active)
+
+	// Instance A deactivates the flow and publishes the change
+	flow.Active = false
+	require.NoError(t, flowsA.UpdateFlow("acme", "customers", flow))
+	change := &model.ConfigChange{Tenant: "acme", Realm: "customers", EntityType: model.ConfigEntityFlow, EntityId: "login"}
+	require.NoError(t, changesA.PublishChange(ctx, change))
+	assert.Equal(t, change.Version, changesA.GetConfigVersion())
+
+	// Instance B picks up the change without waiting for the cache TTL
+	assert.Eventually(t, func() bool {
+		return changesB.GetConfigVersion() == change.Version
+	}, 5*time.Second, 50*time.Millisecond)
+
+	cached, found = flowsB.GetFlowById("acme", "customers", "login")
+	require.True(t, found)
+	assert.False(t, cached.Active)
+}
+
+func TestConfigChangeService_WithoutDatabaseAppliesLocally(t *testing.T) {
+	configChangeService := NewConfigChangeService(nil)
+	require.NoError(t, configChangeService.Start(context.Background()))
+
+	var received []model.ConfigChange
+	configChangeService.OnChange(func(change model.ConfigChange) {
+		received = append(received, change)
+	})
+
+	err := configChangeService.PublishChange(context.Background(), &model.ConfigChange{Tenant: "acme", Realm: "customers", EntityType: model.ConfigEntityRealm})
+	require.NoError(t, err)
+
+	require.Len(t, received, 1)
+	assert.Equal(t, int64(1), received[0].Version)
+	assert.Equal(t, int64(1), configChangeService.GetConfigVersion())
+}
+
+// outOfOrderConfigChangeDB is a change log in which changes only become visible once they are committed,
+// which can happen in a different order than their versions were assigned
+type outOfOrderConfigChangeDB struct {
+	committed []model.ConfigChange
+}
+
+func (d *outOfOrderConfigChangeDB) commit(version int64) {
+	d.committed = append(d.committed, model.ConfigChange{Version: version, Tenant: "acme", Realm: "customers", EntityType: model.ConfigEntityFlow})
+	slices.SortFunc(d.committed, func(a, b model.ConfigChange) int { return cmp.Compare(a.Version, b.Version) })
+}
+
+func (d *outOfOrderConfigChangeDB) CreateConfigChange(ctx context.Context, change *model.ConfigChange) error {
+	return nil
+}
+
+func (d *outOfOrderConfigChangeDB) ListConfigChangesSince(ctx context.Context, version int64) ([]model.ConfigChange, error) {
+	var changes []model.ConfigChange
+	for _, change := range d.committed {
+		if change.Version > version {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+func (d *outOfOrderConfigChangeDB) GetLatestConfigVersion(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (d *outOfOrderConfigChangeDB) WatchConfigChanges(ctx context.Context, notify func()) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestConfigChangeService_AppliesChangesCommittedOutOfOrder(t *testing.T) {
+	changeDB := &outOfOrderConfigChangeDB{}
+	configChangeService := NewConfigChangeService(changeDB).(*configChangeServiceImpl)
+
+	var received []int64
+	configChangeService.OnChange(func(change model.ConfigChange) {
+		received = append(received, change.Version)
+	})
+
+	ctx := context.Background()
+
+	// Version 2 commits while the transaction that got version 1 is still running
+	changeDB.commit(2)
+	configChangeService.applyPendingChanges(ctx)
+	assert.Equal(t, []int64{2}, received)
+	assert.Equal(t, int64(2), configChangeService.GetConfigVersion())
+
+	// Version 1 shows up after the later change and is applied nevertheless
+	changeDB.commit(1)
+	changeDB.commit(3)
+	configChangeService.applyPendingChanges(ctx)
+	assert.Equal(t, []int64{2, 1, 3}, received)
+	assert.Equal(t, int64(3), configChangeService.GetConfigVersion())
+
+	// Applied changes are not applied again
+	configChangeService.applyPendingChanges(ctx)
+	assert.Equal(t, []int64{2, 1, 3}, received)
+
+	// The version of a rolled back insert never shows up, its gap is given up after the timeout
+	changeDB.commit(5)
+	configChangeService.applyPendingChanges(ctx)
+	assert.Contains(t, configChangeService.gaps, int64(4))
+
+	configChangeService.gaps[4] = time.Now().Add(-2 * configChangeGapTimeout)
+	configChangeService.applyPendingChanges(ctx)
+	assert.Empty(t, configChangeService.gaps)
+	assert.Equal(t, []int64{2, 1, 3, 5}, received)
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/logger"
+	"github.com/Identityplane/GoAM/pkg/db"
+	"github.com/Identityplane/GoAM/pkg/model"
+	services_interface "github.com/Identityplane/GoAM/pkg/services"
+)
+
+// DefaultFlowAnalyticsFlushInterval is how often the buffered counters of the flow analytics are written
+const DefaultFlowAnalyticsFlushInterval = 10 * time.Second
+
+// flowAnalyticsShutdownFlushTimeout limits the last flush when the service is stopped
+const flowAnalyticsShutdownFlushTimeout = 5 * time.Second
+
+// flowStatKey identifies a counter of the flow analytics
+type flowStatKey struct {
+	tenant, realm, flowId, clientId string
+	bucket                          time.Time
+	node, metric                    string
+}
+
+// flowAnalyticsServiceImpl counts the events of the flow engine in memory and adds them to the counters in the
+// database when it flushes, so that a request does not write to the database for every step. The counters of a
+// run are added to the bucket of the hour in which the run started, so that a funnel only contains complete runs.
+type flowAnalyticsServiceImpl struct {
+	statsDB       db.FlowStatsDB
+	flushInterval time.Duration
+	timeProvider  services_interface.TimeProvider
+
+	mutex   sync.Mutex
+	pending map[flowStatKey]int64
+}
+
+// NewFlowAnalyticsService creates a new FlowAnalyticsService, a flush interval of 0 uses the default interval
+func NewFlowAnalyticsService(statsDB db.FlowStatsDB, flushInterval time.Duration) services_interface.FlowAnalyticsService {
+	if flushInterval <= 0 {
+		flushInterval = DefaultFlowAnalyticsFlushInterval
+	}
+
+	return &flowAnalyticsServiceImpl{
+		statsDB:       statsDB,
+		flushInterval: flushInterval,
+		timeProvider:  &RealTimeProvider{},
+		pending:       map[flowStatKey]int64{},
+	}
+}
+
+func (s *flowAnalyticsServiceImpl) RecordFlowEvent(tenant, realm string, state *model.AuthenticationSession, event *model.FlowEvent) {
+
+	started := state.CreatedAt
+	if started.IsZero() {
+		started = s.timeProvider.Now()
+	}
+
+	base := flowStatKey{
+		tenant:   tenant,
+		realm:    realm,
+		flowId:   state.FlowId,
+		clientId: state.ClientID(),
+		bucket:   started.UTC().Truncate(model.FlowStatsBucketSize),
+	}
+	count := func(node, metric string, delta int64) {
+		key := base
+		key.node, key.metric = node, metric
+		s.pending[key] += delta
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch event.Type {
+	case model.FlowEventStarted:
+		count("", model.FlowStatStarted, 1)
+
+	case model.FlowEventPrompted:
+		if event.First {
+			count(event.Node, model.FlowStatReached, 1)
+		}
+		count(event.Node, model.FlowStatWaiting, 1)
+		if event.Previous != "" {
+			count(event.Previous, model.FlowStatWaiting, -1)
+		}
+
+	case model.FlowEventSubmitted:
+		count(event.Node, model.FlowStatSubmitted, 1)
+		count(event.Node, model.FlowStepTimeMetric(event.Duration), 1)
+
+	case model.FlowEventFinished:
+		if event.Success {
+			count(event.Node, model.FlowStatSucceeded, 1)
+		} else {
+			count(event.Node, model.FlowStatFailed, 1)
+		}
+		if event.Previous != "" {
+			count(event.Previous, model.FlowStatWaiting, -1)
+		}
+	}
+}
+
+func (s *flowAnalyticsServiceImpl) Flush(ctx context.Context) error {
+
+	s.mutex.Lock()
+	pending := s.pending
+	s.pending = map[flowStatKey]int64{}
+	s.mutex.Unlock()
+
+	stats := make([]*model.FlowStat, 0, len(pending))
+	for key, value := range pending {
+		if value == 0 {
+			continue
+		}
+		stats = append(stats, &model.FlowStat{
+			Tenant:   key.tenant,
+			Realm:    key.realm,
+			FlowId:   key.flowId,
+			ClientId: key.clientId,
+			Bucket:   key.bucket,
+			Node:     key.node,
+			Metric:   key.metric,
+			Value:    value,
+		})
+	}
+
+	if err := s.statsDB.IncrementFlowStats(ctx, stats); err != nil {
+
+		// The counters are kept and written with the next flush
+		s.mutex.Lock()
+		for key, value := range pending {
+			s.pending[key] += value
+		}
+		s.mutex.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+func (s *flowAnalyticsServiceImpl) Start(ctx context.Context) error {
+
+	go func() {
+		log := logger.GetGoamLogger()
+		ticker := time.NewTicker(s.flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				// Write the counters of the last interval, the context of the service is already done
+				flushCtx, cancel := context.WithTimeout(context.Background(), flowAnalyticsShutdownFlushTimeout)
+				if err := s.Flush(flushCtx); err != nil {
+					log.Warn().Err(err).Msg("failed to flush flow analytics on shutdown")
+				}
+				cancel()
+				return
+			case <-ticker.C:
+				if err := s.Flush(ctx); err != nil {
+					log.Warn().Err(err).Msg("failed to flush flow analytics")
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (s *flowAnalyticsServiceImpl) GetFlowFunnels(ctx context.Context, tenant, realm string, filter model.FlowStatsFilter) ([]*model.FlowFunnel, error) {
+
+	stats, err := s.statsDB.ListFlowStats(ctx, tenant, realm, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Runs of a bucket can still be in progress until the sessions of the last run that started in it expired
+	inProgressSince := s.timeProvider.Now().Add(-model.FlowStatsBucketSize - model.AuthSessionLifetime)
+
+	funnels := map[string]*model.FlowFunnel{}
+	steps := map[string]map[string]*model.FlowFunnelStep{}
+	stepTimes := map[string]map[string]map[string]int64{}
+
+	for _, stat := range stats {
+		funnel := funnels[stat.FlowId]
+		if funnel == nil {
+			funnel = &model.FlowFunnel{FlowId: stat.FlowId, Steps: []model.FlowFunnelStep{}}
+			funnels[stat.FlowId] = funnel
+			steps[stat.FlowId] = map[string]*model.FlowFunnelStep{}
+			stepTimes[stat.FlowId] = map[string]map[string]int64{}
+		}
+
+		switch stat.Metric {
+		case model.FlowStatStarted:
+			funnel.Started += stat.Value
+			continue
+		case model.FlowStatSucceeded:
+			funnel.Succeeded += stat.Value
+			continue
+		case model.FlowStatFailed:
+			funnel.Failed += stat.Value
+			continue
+		}
+
+		step := steps[stat.FlowId][stat.Node]
+		if step == nil {
+			step = &model.FlowFunnelStep{Node: stat.Node}
+			steps[stat.FlowId][stat.Node] = step
+			stepTimes[stat.FlowId][stat.Node] = map[string]int64{}
+		}
+
+		switch stat.Metric {
+		case model.FlowStatReached:
+			step.Reached += stat.Value
+		case model.FlowStatWaiting:
+			if stat.Bucket.After(inProgressSince) {
+				step.InProgress += stat.Value
+			} else {
+				step.Abandoned += stat.Value
+			}
+		case model.FlowStatSubmitted:
+			step.Submitted += stat.Value
+		default:
+			stepTimes[stat.FlowId][stat.Node][stat.Metric] += stat.Value
+		}
+	}
+
+	result := make([]*model.FlowFunnel, 0, len(funnels))
+	for flowId, funnel := range funnels {
+		for node, step := range steps[flowId] {
+			// The counters of runs that span two flushes can be off until both are written
+			step.Abandoned = max(step.Abandoned, 0)
+			step.InProgress = max(step.InProgress, 0)
+			step.MedianStepSeconds = medianStepSeconds(stepTimes[flowId][node])
+
+			funnel.Abandoned += step.Abandoned
+			funnel.InProgress += step.InProgress
+			funnel.Steps = append(funnel.Steps, *step)
+		}
+
+		// The steps that most runs reached come first, which is the order of the funnel. Of two steps that
+		// the same runs reached, the earlier step is usually the one that more runs continued from.
+		sort.Slice(funnel.Steps, func(i, j int) bool {
+			a, b := funnel.Steps[i], funnel.Steps[j]
+			if a.Reached != b.Reached {
+				return a.Reached > b.Reached
+			}
+			if a.Reached-a.Abandoned-a.InProgress != b.Reached-b.Abandoned-b.InProgress {
+				return a.Reached-a.Abandoned-a.InProgress > b.Reached-b.Abandoned-b.InProgress
+			}
+			return a.Node < b.Node
+		})
+
+		result = append(result, funnel)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].FlowId < result[j].FlowId })
+	return result, nil
+}
+
+// medianStepSeconds returns the upper bound of the histogram bucket that contains the median step time,
+// 0 if there are no step times and -1 if the median is longer than the largest bound
+func medianStepSeconds(histogram map[string]int64) float64 {
+	var total int64
+	for _, count := range histogram {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	var cumulative int64
+	for _, bound := range model.FlowStepTimeBounds {
+		cumulative += histogram[model.FlowStepTimeMetric(bound)]
+		if cumulative*2 >= total {
+			return bound.Seconds()
+		}
+	}
+	return -1
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/db/sqlite_adapter"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowAnalyticsService_Funnel(t *testing.T) {
+	ctx := context.Background()
+
+	sqliteDB, err := sql.Open("sqlite", ":memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	defer sqliteDB.Close()
+	sqliteDB.SetMaxOpenConns(1)
+	require.NoError(t, sqlite_adapter.RunMigrations(sqliteDB))
+
+	statsDB, err := sqlite_adapter.NewFlowStatsDB(sqliteDB)
+	require.NoError(t, err)
+	svc := NewFlowAnalyticsService(statsDB, 0)
+	clock := newMockTimeProvider()
+	svc.(*flowAnalyticsServiceImpl).timeProvider = clock
+
+	newRun := func(clientId string) *model.AuthenticationSession {
+		return &model.AuthenticationSession{
+			FlowId:                       "login",
+			CreatedAt:                    clock.Now(),
+			SimpleAuthSessionInformation: &model.SimpleAuthContext{Request: &model.SimpleAuthRequest{ClientID: clientId}},
+		}
+	}
+	record := func(state *model.AuthenticationSession, events ...model.FlowEvent) {
+		for _, event := range events {
+			svc.RecordFlowEvent("acme", "customers", state, &event)
+		}
+	}
+
+	// Succeeds after a wrong password
+	record(newRun("app"),
+		model.FlowEvent{Type: model.FlowEventStarted},
+		model.FlowEvent{Type: model.FlowEventPrompted, Node: "askUsername", First: true},
+		model.FlowEvent{Type: model.FlowEventSubmitted, Node: "askUsername", Duration: 3 * time.Second},
+		model.FlowEvent{Type: model.FlowEventPrompted, Node: "askPassword", Previous: "askUsername", First: true},
+		model.FlowEvent{Type: model.FlowEventSubmitted, Node: "askPassword", Duration: 4 * time.Second},
+		model.FlowEvent{Type: model.FlowEventPrompted, Node: "askPassword", Previous: "askPassword"},
+		model.FlowEvent{Type: model.FlowEventSubmitted, Node: "askPassword", Duration: 40 * time.Second},
+		model.FlowEvent{Type: model.FlowEventFinished, Node: "successResult", Previous: "askPassword", Success: true},
+	)
+
+	// Stops at the password
+	record(newRun("app"),
+		model.FlowEvent{Type: model.FlowEventStarted},
+		model.FlowEvent{Type: model.FlowEventPrompted, Node: "askUsername", First: true},
+		model.FlowEvent{Type: model.FlowEventSubmitted, Node: "askUsername", Duration: 15 * time.Second},
+		model.FlowEvent{Type: model.FlowEventPrompted, Node: "askPassword", Previous: "askUsername", First: true},
+	)
+	require.NoError(t, svc.Flush(ctx))
+
+	// Fails, from another client and written by a later flush
+	record(newRun("other"),
+		model.FlowEvent{Type: model.FlowEventStarted},
+		model.FlowEvent{Type: model.FlowEventPrompted, Node: "askUsername", First: true},
+		model.FlowEvent{Type: model.FlowEventSubmitted, Node: "askUsername", Duration: 2 * time.Second},
+		model.FlowEvent{Type: model.FlowEventFinished, Node: "failureResult", Previous: "askUsername"},
+	)
+	require.NoError(t, svc.Flush(ctx))
+
+	funnels, err := svc.GetFlowFunnels(ctx, "acme", "customers", model.FlowStatsFilter{})
+	require.NoError(t, err)
+	require.Len(t, funnels, 1)
+
+	funnel := funnels[0]
+	assert.Equal(t, "login", funnel.FlowId)
+	assert.Equal(t, int64(3), funnel.Started)
+	assert.Equal(t, int64(1), funnel.Succeeded)
+	assert.Equal(t, int64(1), funnel.Failed)
+	assert.Equal(t, int64(0), funnel.Abandoned)
+	assert.Equal(t, int64(1), funnel.InProgress)
+	assert.Equal(t, []model.FlowFunnelStep{
+		{Node: "askUsername", Reached: 3, Submitted: 3, MedianStepSeconds: 5},
+		{Node: "askPassword", Reached: 2, Submitted: 2, InProgress: 1, MedianStepSeconds: 5},
+	}, funnel.Steps)
+
+	// The run is abandoned once the sessions of its hour expired
+	clock.Advance(model.FlowStatsBucketSize + model.AuthSessionLifetime)
+	funnels, err = svc.GetFlowFunnels(ctx, "acme", "customers", model.FlowStatsFilter{})
+	require.NoError(t, err)
+	require.Len(t, funnels, 1)
+	assert.Equal(t, int64(1), funnels[0].Abandoned)
+	assert.Equal(t, int64(0), funnels[0].InProgress)
+	assert.Equal(t, int64(1), funnels[0].Steps[1].Abandoned)
+
+	// Filtered by client
+	funnels, err = svc.GetFlowFunnels(ctx, "acme", "customers", model.FlowStatsFilter{ClientId: "other"})
+	require.NoError(t, err)
+	require.Len(t, funnels, 1)
+	assert.Equal(t, int64(1), funnels[0].Started)
+	assert.Equal(t, int64(0), funnels[0].Abandoned)
+
+	// Runs are counted in the hour they started
+	funnels, err = svc.GetFlowFunnels(ctx, "acme", "customers", model.FlowStatsFilter{To: time.Now().Add(-time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, funnels)
+}
+
+func TestFlowAnalyticsService_FlushesWhenStopped(t *testing.T) {
+	sqliteDB, err := sql.Open("sqlite", ":memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	defer sqliteDB.Close()
+	sqliteDB.SetMaxOpenConns(1)
+	require.NoError(t, sqlite_adapter.RunMigrations(sqliteDB))
+
+	statsDB, err := sqlite_adapter.NewFlowStatsDB(sqliteDB)
+	require.NoError(t, err)
+	svc := NewFlowAnalyticsService(statsDB, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, svc.Start(ctx))
+
+	state := &model.AuthenticationSession{FlowId: "login", CreatedAt: time.Now()}
+	svc.RecordFlowEvent("acme", "customers", state, &model.FlowEvent{Type: model.FlowEventStarted})
+	cancel()
+
+	// The interval has not passed, the counter is written because the service stopped
+	assert.Eventually(t, func() bool {
+		funnels, err := svc.GetFlowFunnels(context.Background(), "acme", "customers", model.FlowStatsFilter{})
+		return err == nil && len(funnels) == 1 && funnels[0].Started == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestMedianStepSeconds(t *testing.T) {
+	assert.Equal(t, 0.0, medianStepSeconds(nil))
+	assert.Equal(t, 1.0, medianStepSeconds(map[string]int64{"step_time_le_1s": 2, "step_time_le_inf": 1}))
+	assert.Equal(t, 600.0, medianStepSeconds(map[string]int64{"step_time_le_10m0s": 1}))
+	assert.Equal(t, -1.0, medianStepSeconds(map[string]int64{"step_time_le_1s": 1, "step_time_le_inf": 2}))
+}
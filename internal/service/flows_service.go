@@ -2,12 +2,15 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"strings"
 
 	"github.com/Identityplane/GoAM/internal/auth/graph"
 	"github.com/Identityplane/GoAM/internal/config"
 	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/internal/logger"
 	"github.com/Identityplane/GoAM/pkg/db"
 	"github.com/Identityplane/GoAM/pkg/model"
 	services_interface "github.com/Identityplane/GoAM/pkg/services"
@@ -42,15 +45,27 @@ editor:
       'y': 200
 `
 
+// ErrInvalidFlowDefinition is returned if a flow definition does not pass the validation
+var ErrInvalidFlowDefinition = errors.New("flow definition is invalid")
+
+// errFlowVersioningNotAvailable is returned by the version operations if no FlowVersionDB is configured
+var errFlowVersioningNotAvailable = errors.New("flow versioning is not available")
+
 // flowServiceImpl implements FlowService
 type flowServiceImpl struct {
-	flowsDb db.FlowDB
+	flowsDb    db.FlowDB
+	versionsDb db.FlowVersionDB
+	variantsDb db.FlowVariantDB
 }
 
-// NewFlowService creates a new FlowService instance
-func NewFlowService(flowsDb db.FlowDB) services_interface.FlowService {
+// NewFlowService creates a new FlowService instance. If versionsDb is nil flow definitions
+// are overwritten in place and no version history is kept. Weighted rollouts between versions
+// need both versionsDb and variantsDb.
+func NewFlowService(flowsDb db.FlowDB, versionsDb db.FlowVersionDB, variantsDb db.FlowVariantDB) services_interface.FlowService {
 	return &flowServiceImpl{
-		flowsDb: flowsDb,
+		flowsDb:    flowsDb,
+		versionsDb: versionsDb,
+		variantsDb: variantsDb,
 	}
 }
 
@@ -93,6 +108,11 @@ func (s *flowServiceImpl) GetFlowForExecution(path string, loadedRealm *services
 		}
 	}
 
+	// Add the nodes of the child flows of subflow nodes
+	if !s.expandSubflows(flow) {
+		return nil, false
+	}
+
 	// Overwrite node settings from realm and server overwrites
 	overwriteNodeSettings(flow.Definition, loadedRealm)
 
@@ -116,6 +136,23 @@ func (s *flowServiceImpl) ListAllFlows() ([]model.Flow, error) {
 }
 
 func (s *flowServiceImpl) CreateFlow(tenant, realm string, flow model.Flow) error {
+	return s.createFlow(tenant, realm, flow, true)
+}
+
+// ImportFlow creates or updates a flow from the configuration files. Errors of the lint checks are only enforced if
+// strict flow validation is enabled, so that flow files written before the lint checks keep loading after an upgrade.
+func (s *flowServiceImpl) ImportFlow(tenant, realm string, flow model.Flow) error {
+
+	strict := config.ServerSettings != nil && config.ServerSettings.StrictFlowValidation
+
+	if _, exists := s.GetFlowById(tenant, realm, flow.Id); exists {
+		return s.updateFlow(tenant, realm, flow, strict)
+	}
+	return s.createFlow(tenant, realm, flow, strict)
+}
+
+// createFlow creates a flow, strict decides whether errors of the lint checks reject the definition
+func (s *flowServiceImpl) createFlow(tenant, realm string, flow model.Flow, strict bool) error {
 	// Check that route is not ""
 	if flow.Route == "" {
 		return fmt.Errorf("flow route is empty")
@@ -141,23 +178,32 @@ func (s *flowServiceImpl) CreateFlow(tenant, realm string, flow model.Flow) erro
 
 	// If the flow definition is yet, we validate it
 	if flow.DefinitionYaml != "" {
-		lintErrors, err := s.ValidateFlowDefinition(flow.DefinitionYaml)
-		if err != nil {
-			return fmt.Errorf("failed to validate flow definition: %w", err)
-		}
-		if len(lintErrors) > 0 {
-			return fmt.Errorf("flow definition is invalid: %v", lintErrors)
+		if err := s.checkFlowDefinition(tenant, realm, flow.Id, flow.DefinitionYaml, strict); err != nil {
+			return err
 		}
 	} else {
 		// If the flow definition is not set, we set it to an default flow definition
 		flow.DefinitionYaml = DEFAULT_FLOW_DEFINITION
 	}
 
-	// Create the flow in the database
-	return s.flowsDb.CreateFlow(context.Background(), flow)
+	// Create the flow in the database, the initial definition becomes the first version.
+	// Variants refer to versions, so they can only be set once the flow exists.
+	flow.ActiveVersion = 0
+	flow.Variants = nil
+	err := s.flowsDb.CreateFlow(context.Background(), flow)
+	if err != nil {
+		return err
+	}
+
+	return s.ensureInitialVersion(&flow)
 }
 
 func (s *flowServiceImpl) UpdateFlow(tenant, realm string, flow model.Flow) error {
+	return s.updateFlow(tenant, realm, flow, true)
+}
+
+// updateFlow updates a flow, strict decides whether errors of the lint checks reject the definition
+func (s *flowServiceImpl) updateFlow(tenant, realm string, flow model.Flow, strict bool) error {
 
 	// Check that route is not ""
 	if flow.Route == "" {
@@ -177,11 +223,46 @@ func (s *flowServiceImpl) UpdateFlow(tenant, realm string, flow model.Flow) erro
 	flow.Route, _ = strings.CutPrefix(flow.Route, "/")
 
 	// Check if the flow exists
-	_, exists := s.GetFlowById(tenant, realm, flow.Id)
+	existingFlow, exists := s.GetFlowById(tenant, realm, flow.Id)
 	if !exists {
 		return fmt.Errorf("flow with id %s not found", flow.Id)
 	}
 
+	// The active version can only be changed by publishing a version
+	flow.ActiveVersion = existingFlow.ActiveVersion
+
+	err := s.validateFlowVariants(&flow)
+	if err != nil {
+		return err
+	}
+
+	// The definition is validated before it is recorded as a version
+	if flow.DefinitionYaml != existingFlow.DefinitionYaml {
+		if err := s.checkFlowDefinition(tenant, realm, flow.Id, flow.DefinitionYaml, strict); err != nil {
+			return err
+		}
+	}
+
+	// A direct update of the definition is recorded as a new version and published right away
+	if s.versionsDb != nil && flow.DefinitionYaml != existingFlow.DefinitionYaml {
+		err := s.ensureInitialVersion(existingFlow)
+		if err != nil {
+			return err
+		}
+
+		version := &model.FlowVersion{Tenant: tenant, Realm: realm, FlowId: flow.Id, DefinitionYaml: flow.DefinitionYaml}
+		err = s.versionsDb.CreateFlowVersion(context.Background(), version)
+		if err != nil {
+			return err
+		}
+
+		err = s.recordPublication(&flow, version.Version, existingFlow.ActiveVersion)
+		if err != nil {
+			return err
+		}
+		flow.ActiveVersion = version.Version
+	}
+
 	// Update the flow in the database
 	return s.flowsDb.UpdateFlow(context.Background(), &flow)
 }
@@ -195,10 +276,33 @@ func (s *flowServiceImpl) DeleteFlow(tenant, realm, id string) error {
 	}
 
 	// Delete the flow from the database
-	return s.flowsDb.DeleteFlow(context.Background(), tenant, realm, id)
+	err := s.flowsDb.DeleteFlow(context.Background(), tenant, realm, id)
+	if err != nil {
+		return err
+	}
+
+	// Delete the version history, otherwise a new flow with the same id would continue it
+	if s.versionsDb != nil {
+		err = s.versionsDb.DeleteFlowVersions(context.Background(), tenant, realm, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.variantsDb != nil {
+		return s.variantsDb.DeleteFlowVariants(context.Background(), tenant, realm, id)
+	}
+
+	return nil
 }
 
 func (s *flowServiceImpl) ValidateFlowDefinition(content string) ([]services_interface.FlowLintError, error) {
+	return lintFlowDefinition(content, true), nil
+}
+
+// lintFlowDefinition runs the lint checks on a definition. Errors of the lint checks are reported as warnings unless
+// strict is set.
+func lintFlowDefinition(content string, strict bool) []services_interface.FlowLintError {
 	// Try to parse the YAML content
 	flowDefinition, err := lib.LoadFlowDefinitonFromString(content)
 
@@ -209,24 +313,554 @@ func (s *flowServiceImpl) ValidateFlowDefinition(content string) ([]services_int
 			EndLineNumber:   1,
 			EndColumn:       1,
 			Message:         fmt.Sprintf("%s", err.Error()),
-			Severity:        8,
-		}}, nil
+			Severity:        services_interface.FlowLintSeverityError,
+		}}
 	}
 
-	error := graph.ValidateFlowDefinition(flowDefinition)
+	lintErrors := []services_interface.FlowLintError{}
+	for _, issue := range graph.LintFlowDefinition(flowDefinition) {
 
-	if error != nil {
-		return []services_interface.FlowLintError{{
-			StartLineNumber: 1,
-			StartColumn:     1,
-			EndLineNumber:   1,
-			EndColumn:       1,
-			Message:         fmt.Sprintf("%s", error.Error()),
-			Severity:        8,
-		}}, nil
+		severity := services_interface.FlowLintSeverityWarning
+		if issue.IsError(strict) {
+			severity = services_interface.FlowLintSeverityError
+		}
+
+		position := lib.FindFlowDefinitionPosition(content, issue.Node, issue.Field, issue.Key)
+		lintErrors = append(lintErrors, services_interface.FlowLintError{
+			StartLineNumber: position.StartLine,
+			StartColumn:     position.StartColumn,
+			EndLineNumber:   position.EndLine,
+			EndColumn:       position.EndColumn,
+			Message:         issue.Message,
+			Severity:        severity,
+			Node:            issue.Node,
+		})
+	}
+
+	return lintErrors
+}
+
+// checkFlowDefinition validates a definition before it is stored. Warnings are logged, the first error is returned.
+// Errors of the lint checks are only enforced if strict is set.
+func (s *flowServiceImpl) checkFlowDefinition(tenant, realm, id, definitionYaml string, strict bool) error {
+
+	lintErrors := lintFlowDefinition(definitionYaml, strict)
+
+	log := logger.GetGoamLogger()
+	for _, lintError := range lintErrors {
+		if lintError.Severity == services_interface.FlowLintSeverityError {
+			return fmt.Errorf("%w: %s", ErrInvalidFlowDefinition, lintError.Message)
+		}
+
+		log.Warn().
+			Str("tenant", tenant).
+			Str("realm", realm).
+			Str("flow_id", id).
+			Int("line", lintError.StartLineNumber).
+			Msg("flow definition: " + lintError.Message)
+	}
+
+	if err := s.checkSubflowIncludes(tenant, realm, id, definitionYaml); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidFlowDefinition, err)
+	}
+
+	return nil
+}
+
+func (s *flowServiceImpl) GetFlowVersionForExecution(id string, version int, loadedRealm *services_interface.LoadedRealm) (*model.Flow, bool) {
+
+	if s.versionsDb == nil {
+		return nil, false
+	}
+
+	tenant := loadedRealm.Config.Tenant
+	realm := loadedRealm.Config.Realm
+
+	flow, err := s.flowsDb.GetFlow(context.Background(), tenant, realm, id)
+	if err != nil || flow == nil {
+		return nil, false
+	}
+
+	flowVersion, err := s.versionsDb.GetFlowVersion(context.Background(), tenant, realm, id, version)
+	if err != nil || flowVersion == nil {
+		return nil, false
+	}
+
+	// The flow keeps its route and settings, only the definition is taken from the version
+	flow.DefinitionYaml = flowVersion.DefinitionYaml
+	flow.Definition, err = lib.LoadFlowDefinitonFromString(flow.DefinitionYaml)
+	if err != nil {
+		return nil, false
+	}
+
+	// Add the nodes of the child flows of subflow nodes
+	if !s.expandSubflows(flow) {
+		return nil, false
+	}
+
+	// Overwrite node settings from realm and server overwrites
+	overwriteNodeSettings(flow.Definition, loadedRealm)
+
+	return flow, true
+}
+
+func (s *flowServiceImpl) CreateFlowVersion(tenant, realm, id, definitionYaml, comment string) (*model.FlowVersion, error) {
+
+	if s.versionsDb == nil {
+		return nil, errFlowVersioningNotAvailable
+	}
+
+	flow, exists := s.GetFlowById(tenant, realm, id)
+	if !exists {
+		return nil, fmt.Errorf("flow with id %s not found", id)
+	}
+
+	if err := s.checkFlowDefinition(tenant, realm, id, definitionYaml, true); err != nil {
+		return nil, err
+	}
+
+	// Keep the currently active definition so that the draft can be rolled back
+	err := s.ensureInitialVersion(flow)
+	if err != nil {
+		return nil, err
+	}
+
+	version := &model.FlowVersion{
+		Tenant:         tenant,
+		Realm:          realm,
+		FlowId:         id,
+		DefinitionYaml: definitionYaml,
+		Comment:        comment,
+	}
+
+	err = s.versionsDb.CreateFlowVersion(context.Background(), version)
+	if err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+func (s *flowServiceImpl) ListFlowVersions(tenant, realm, id string) ([]model.FlowVersion, error) {
+
+	if s.versionsDb == nil {
+		return nil, errFlowVersioningNotAvailable
+	}
+
+	flow, exists := s.GetFlowById(tenant, realm, id)
+	if !exists {
+		return nil, fmt.Errorf("flow with id %s not found", id)
+	}
+
+	versions, err := s.versionsDb.ListFlowVersions(context.Background(), tenant, realm, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list flow versions: %w", err)
+	}
+
+	for i := range versions {
+		versions[i].Active = versions[i].Version == flow.ActiveVersion
+	}
+
+	return versions, nil
+}
+
+func (s *flowServiceImpl) GetFlowVersion(tenant, realm, id string, version int) (*model.FlowVersion, bool) {
+
+	if s.versionsDb == nil {
+		return nil, false
+	}
+
+	flow, exists := s.GetFlowById(tenant, realm, id)
+	if !exists {
+		return nil, false
+	}
+
+	flowVersion, err := s.versionsDb.GetFlowVersion(context.Background(), tenant, realm, id, version)
+	if err != nil || flowVersion == nil {
+		return nil, false
+	}
+
+	flowVersion.Active = flowVersion.Version == flow.ActiveVersion
+	return flowVersion, true
+}
+
+func (s *flowServiceImpl) PublishFlowVersion(tenant, realm, id string, version int) error {
+
+	if s.versionsDb == nil {
+		return errFlowVersioningNotAvailable
+	}
+
+	flow, exists := s.GetFlowById(tenant, realm, id)
+	if !exists {
+		return fmt.Errorf("flow with id %s not found", id)
+	}
+
+	flowVersion, err := s.versionsDb.GetFlowVersion(context.Background(), tenant, realm, id, version)
+	if err != nil {
+		return fmt.Errorf("failed to load flow version: %w", err)
+	}
+	if flowVersion == nil {
+		return fmt.Errorf("version %d of flow %s not found", version, id)
+	}
+
+	return s.publishFlowVersion(flow, flowVersion, flow.ActiveVersion)
+}
+
+// publishFlowVersion makes the version the active version of the flow and records the publication, previousVersion
+// is the version a rollback returns to
+func (s *flowServiceImpl) publishFlowVersion(flow *model.Flow, flowVersion *model.FlowVersion, previousVersion int) error {
+
+	err := s.recordPublication(flow, flowVersion.Version, previousVersion)
+	if err != nil {
+		return err
+	}
+
+	// The flow keeps a copy of the active definition so that loading a flow for execution needs a single query
+	flow.DefinitionYaml = flowVersion.DefinitionYaml
+	flow.ActiveVersion = flowVersion.Version
+
+	return s.flowsDb.UpdateFlow(context.Background(), flow)
+}
+
+// recordPublication appends the publication of a version to the publish history of the flow
+func (s *flowServiceImpl) recordPublication(flow *model.Flow, version, previousVersion int) error {
+
+	publication := &model.FlowPublication{
+		Tenant:          flow.Tenant,
+		Realm:           flow.Realm,
+		FlowId:          flow.Id,
+		Version:         version,
+		PreviousVersion: previousVersion,
+	}
+
+	return s.versionsDb.CreateFlowPublication(context.Background(), publication)
+}
+
+func (s *flowServiceImpl) RollbackFlow(tenant, realm, id string) (*model.FlowVersion, error) {
+
+	if s.versionsDb == nil {
+		return nil, errFlowVersioningNotAvailable
+	}
+
+	flow, exists := s.GetFlowById(tenant, realm, id)
+	if !exists {
+		return nil, fmt.Errorf("flow with id %s not found", id)
+	}
+
+	publications, err := s.versionsDb.ListFlowPublications(context.Background(), tenant, realm, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list flow publications: %w", err)
+	}
+
+	// Drafts are never published, so the publish history names the version that was active before
+	if len(publications) == 0 || publications[0].Version != flow.ActiveVersion || publications[0].PreviousVersion == 0 {
+		return nil, fmt.Errorf("flow %s has no published version before version %d", id, flow.ActiveVersion)
+	}
+	previous := publications[0].PreviousVersion
+
+	version, err := s.versionsDb.GetFlowVersion(context.Background(), tenant, realm, id, previous)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load flow version: %w", err)
+	}
+	if version == nil {
+		return nil, fmt.Errorf("version %d of flow %s not found", previous, id)
+	}
+
+	// The rollback restores the version with its own predecessor, so that repeated rollbacks walk back the history
+	restoredPrevious := 0
+	for _, publication := range publications[1:] {
+		if publication.Version == previous {
+			restoredPrevious = publication.PreviousVersion
+			break
+		}
+	}
+
+	err = s.publishFlowVersion(flow, version, restoredPrevious)
+	if err != nil {
+		return nil, err
+	}
+
+	version.Active = true
+	return version, nil
+}
+
+func (s *flowServiceImpl) DiffFlowVersions(tenant, realm, id string, from, to int) (string, error) {
+
+	if s.versionsDb == nil {
+		return "", errFlowVersioningNotAvailable
+	}
+
+	fromVersion, exists := s.GetFlowVersion(tenant, realm, id, from)
+	if !exists {
+		return "", fmt.Errorf("version %d of flow %s not found", from, id)
+	}
+
+	toVersion, exists := s.GetFlowVersion(tenant, realm, id, to)
+	if !exists {
+		return "", fmt.Errorf("version %d of flow %s not found", to, id)
+	}
+
+	return lib.UnifiedDiff(
+		fmt.Sprintf("%s version %d", id, from),
+		fmt.Sprintf("%s version %d", id, to),
+		fromVersion.DefinitionYaml,
+		toVersion.DefinitionYaml,
+	), nil
+}
+
+func (s *flowServiceImpl) SelectFlowVariant(flow *model.Flow, stickyKey, runId string) *model.FlowVariant {
+
+	if s.variantsDb == nil || flow.Variants.TotalWeight() <= 0 {
+		return nil
+	}
+
+	log := logger.GetGoamLogger()
+	ctx := context.Background()
+
+	// Devices stay on the variant they were assigned to the first time, until it is removed or its weight set to 0
+	stickyHash := lib.HashString(stickyKey)
+	var variant *model.FlowVariant
+
+	assignment, err := s.variantsDb.GetFlowVariantAssignment(ctx, flow.Tenant, flow.Realm, flow.Id, stickyHash)
+	if err != nil {
+		log.Warn().Err(err).Str("flow_id", flow.Id).Msg("failed to load flow variant assignment")
+	}
+	if assignment != nil {
+		variant = flow.Variants.Get(assignment.Variant)
+		if variant != nil && variant.Weight <= 0 {
+			variant = nil
+		}
+	}
+
+	if variant == nil {
+		variant = pickFlowVariant(flow, stickyKey)
+
+		err = s.variantsDb.SaveFlowVariantAssignment(ctx, &model.FlowVariantAssignment{
+			Tenant:    flow.Tenant,
+			Realm:     flow.Realm,
+			FlowId:    flow.Id,
+			StickyKey: stickyHash,
+			Variant:   variant.Name,
+		})
+		if err != nil {
+			log.Warn().Err(err).Str("flow_id", flow.Id).Msg("failed to save flow variant assignment")
+		}
+	}
+
+	err = s.variantsDb.CreateFlowVariantSession(ctx, &model.FlowVariantSession{
+		Tenant:  flow.Tenant,
+		Realm:   flow.Realm,
+		FlowId:  flow.Id,
+		RunID:   runId,
+		Variant: variant.Name,
+		Version: variant.Version,
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("flow_id", flow.Id).Str("run_id", runId).Msg("failed to record flow variant session")
+	}
+
+	return variant
+}
+
+// pickFlowVariant picks the variant of a device that has no assignment yet by hashing its key into the cumulative
+// weights, so that the pick is stable while the weights do not change
+func pickFlowVariant(flow *model.Flow, stickyKey string) *model.FlowVariant {
+
+	hash := fnv.New32a()
+	hash.Write([]byte(flow.Tenant + "/" + flow.Realm + "/" + flow.Id + "/" + stickyKey))
+	bucket := int(hash.Sum32() % uint32(flow.Variants.TotalWeight()))
+
+	for i := range flow.Variants {
+		bucket -= flow.Variants[i].Weight
+		if bucket < 0 {
+			return &flow.Variants[i]
+		}
+	}
+
+	return nil
+}
+
+func (s *flowServiceImpl) RecordFlowVariantResult(session *model.AuthenticationSession) {
+
+	if session.FlowVariant == "" || s.variantsDb == nil {
+		return
+	}
+
+	result := model.FlowVariantResultFailed
+	if session.DidResultAuthenticated() {
+		result = model.FlowVariantResultSucceeded
+	}
+
+	log := logger.GetGoamLogger()
+
+	// Only the first call for a session records the result, reloading a finished session does not count it again
+	recorded, err := s.variantsDb.FinishFlowVariantSession(context.Background(), session.Tenant, session.Realm, session.RunID, result)
+	if err != nil {
+		log.Warn().Err(err).Str("flow_id", session.FlowId).Str("run_id", session.RunID).Msg("failed to record flow variant result")
+		return
+	}
+	if !recorded {
+		return
+	}
+
+	log.Info().
+		Str("flow_id", session.FlowId).
+		Str("run_id", session.RunID).
+		Str("flow_variant", session.FlowVariant).
+		Int("flow_version", session.FlowVersion).
+		Str("result", result).
+		Msg("flow variant finished")
+}
+
+func (s *flowServiceImpl) GetFlowVariantMetrics(tenant, realm, id string) ([]services_interface.FlowVariantMetrics, error) {
+
+	if s.variantsDb == nil {
+		return nil, errFlowVersioningNotAvailable
+	}
+
+	flow, exists := s.GetFlowById(tenant, realm, id)
+	if !exists {
+		return nil, fmt.Errorf("flow with id %s not found", id)
+	}
+
+	counts, err := s.variantsDb.CountFlowVariantSessions(context.Background(), tenant, realm, id)
+	if err != nil {
+		return nil, err
+	}
+
+	countsByVariant := make(map[string]model.FlowVariantCount, len(counts))
+	for _, count := range counts {
+		countsByVariant[count.Variant] = count
+	}
+
+	metrics := make([]services_interface.FlowVariantMetrics, 0, len(flow.Variants))
+	for _, variant := range flow.Variants {
+		count := countsByVariant[variant.Name]
+		metrics = append(metrics, services_interface.FlowVariantMetrics{
+			Name:      variant.Name,
+			Version:   variant.Version,
+			Weight:    variant.Weight,
+			Started:   count.Started,
+			Succeeded: count.Succeeded,
+			Failed:    count.Failed,
+		})
+	}
+
+	return metrics, nil
+}
+
+// validateFlowVariants checks that the variants of a flow refer to existing versions and can be selected.
+// Variants without a name are named after their version.
+func (s *flowServiceImpl) validateFlowVariants(flow *model.Flow) error {
+
+	if len(flow.Variants) == 0 {
+		return nil
+	}
+
+	if s.versionsDb == nil || s.variantsDb == nil {
+		return errFlowVersioningNotAvailable
+	}
+
+	names := make(map[string]bool)
+	for i := range flow.Variants {
+		variant := &flow.Variants[i]
+
+		if variant.Name == "" {
+			variant.Name = fmt.Sprintf("v%d", variant.Version)
+		}
+		if names[variant.Name] {
+			return fmt.Errorf("duplicate flow variant %s", variant.Name)
+		}
+		names[variant.Name] = true
+
+		if variant.Weight < 0 {
+			return fmt.Errorf("weight of flow variant %s must not be negative", variant.Name)
+		}
+
+		version, err := s.versionsDb.GetFlowVersion(context.Background(), flow.Tenant, flow.Realm, flow.Id, variant.Version)
+		if err != nil {
+			return fmt.Errorf("failed to load flow version: %w", err)
+		}
+		if version == nil {
+			return fmt.Errorf("version %d of flow variant %s not found", variant.Version, variant.Name)
+		}
+	}
+
+	if flow.Variants.TotalWeight() == 0 {
+		return fmt.Errorf("at least one flow variant must have a weight")
+	}
+
+	return nil
+}
+
+// ensureInitialVersion records the current definition as the first version of flows that have no versions yet,
+// which are newly created flows and flows that were created before versioning was introduced
+func (s *flowServiceImpl) ensureInitialVersion(flow *model.Flow) error {
+
+	if s.versionsDb == nil || flow.ActiveVersion != 0 {
+		return nil
+	}
+
+	version := &model.FlowVersion{
+		Tenant:         flow.Tenant,
+		Realm:          flow.Realm,
+		FlowId:         flow.Id,
+		DefinitionYaml: flow.DefinitionYaml,
+		Comment:        "initial version",
+	}
+
+	err := s.versionsDb.CreateFlowVersion(context.Background(), version)
+	if err != nil {
+		return err
+	}
+
+	err = s.recordPublication(flow, version.Version, 0)
+	if err != nil {
+		return err
+	}
+
+	flow.ActiveVersion = version.Version
+	return s.flowsDb.UpdateFlow(context.Background(), flow)
+}
+
+// subflowLoader loads the active definitions of the flows of a realm that are run by subflow nodes
+func (s *flowServiceImpl) subflowLoader(tenant, realm string) graph.SubflowLoader {
+	return func(flowId string) (*model.FlowDefinition, error) {
+		flow, ok := s.GetFlowById(tenant, realm, flowId)
+		if !ok || flow.Definition == nil {
+			return nil, nil
+		}
+		return flow.Definition, nil
+	}
+}
+
+// checkSubflowIncludes rejects definitions that would include the flow itself through their subflow nodes
+func (s *flowServiceImpl) checkSubflowIncludes(tenant, realm, id, definitionYaml string) error {
+
+	definition, err := lib.LoadFlowDefinitonFromString(definitionYaml)
+	if err != nil {
+		return err
+	}
+
+	return graph.CheckSubflowIncludes(id, definition, s.subflowLoader(tenant, realm))
+}
+
+// expandSubflows replaces the definition of the flow with one that contains the nodes of its child flows
+func (s *flowServiceImpl) expandSubflows(flow *model.Flow) bool {
+
+	if flow.Definition == nil {
+		return true
+	}
+
+	expanded, err := graph.ExpandSubflows(flow.Id, flow.Definition, s.subflowLoader(flow.Tenant, flow.Realm))
+	if err != nil {
+		log := logger.GetGoamLogger()
+		log.Error().Err(err).Str("flow_id", flow.Id).Msg("failed to expand subflows")
+		return false
 	}
 
-	return []services_interface.FlowLintError{}, nil
+	flow.Definition = expanded
+	return true
 }
 
 func overwriteNodeSettings(flow *model.FlowDefinition, loadedRealm *services_interface.LoadedRealm) {
@@ -236,12 +870,12 @@ func overwriteNodeSettings(flow *model.FlowDefinition, loadedRealm *services_int
 
 		// Load the node definiton to get the configuration options
 		definiton := graph.GetNodeDefinitionByName(node.Use)
-		if definiton == nil || definiton.CustomConfigOptions == nil {
+		if definiton == nil {
 			continue
 		}
 
 		// Go over each configuration option
-		for configOption, _ := range definiton.CustomConfigOptions {
+		for _, configOption := range definiton.ConfigOptionNames() {
 
 			// Set the configuration option based on the available settings
 			if node.CustomConfig == nil {
@@ -277,6 +911,6 @@ func getConfigurationOption(loadedRealm *services_interface.LoadedRealm, nodeDef
 		return config.ServerSettings.NodeSettings[fullConfigOption]
 	}
 
-	// If we have no setting we return an empty string
-	return ""
+	// Otherwise we use the default of the config schema, which is empty if there is none
+	return nodeDefiniton.ConfigSchema[configOption].Default
 }
@@ -0,0 +1,421 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Identityplane/GoAM/internal/auth/graph"
+	"github.com/Identityplane/GoAM/internal/config"
+	"github.com/Identityplane/GoAM/internal/db/sqlite_adapter"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/Identityplane/GoAM/pkg/server_settings"
+	services_interface "github.com/Identityplane/GoAM/pkg/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestVersionedFlowService(t *testing.T) services_interface.FlowService {
+	sqliteDB, err := sql.Open("sqlite", ":memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	t.Cleanup(func() { sqliteDB.Close() })
+	sqliteDB.SetMaxOpenConns(1)
+
+	require.NoError(t, sqlite_adapter.RunMigrations(sqliteDB))
+
+	flowDB, err := sqlite_adapter.NewFlowDB(sqliteDB)
+	require.NoError(t, err)
+	flowVersionDB, err := sqlite_adapter.NewFlowVersionDB(sqliteDB)
+	require.NoError(t, err)
+	flowVariantDB, err := sqlite_adapter.NewFlowVariantDB(sqliteDB)
+	require.NoError(t, err)
+
+	return NewFlowService(flowDB, flowVersionDB, flowVariantDB)
+}
+
+func TestFlowService_Versioning(t *testing.T) {
+	flowService := newTestVersionedFlowService(t)
+	draftYaml := strings.Replace(DEFAULT_FLOW_DEFINITION, "An empty flow", "A draft flow", 1)
+
+	require.NoError(t, flowService.CreateFlow("acme", "customers", model.Flow{Id: "login", Route: "/login", Active: true}))
+
+	t.Run("Creating a flow records the initial version", func(t *testing.T) {
+		flow, found := flowService.GetFlowById("acme", "customers", "login")
+		require.True(t, found)
+		assert.Equal(t, 1, flow.ActiveVersion)
+
+		versions, err := flowService.ListFlowVersions("acme", "customers", "login")
+		require.NoError(t, err)
+		require.Len(t, versions, 1)
+		assert.True(t, versions[0].Active)
+	})
+
+	t.Run("Drafts do not change the active definition", func(t *testing.T) {
+		version, err := flowService.CreateFlowVersion("acme", "customers", "login", draftYaml, "new description")
+		require.NoError(t, err)
+		assert.Equal(t, 2, version.Version)
+
+		flow, _ := flowService.GetFlowById("acme", "customers", "login")
+		assert.Equal(t, 1, flow.ActiveVersion)
+		assert.Equal(t, DEFAULT_FLOW_DEFINITION, flow.DefinitionYaml)
+	})
+
+	t.Run("Invalid drafts are rejected", func(t *testing.T) {
+		_, err := flowService.CreateFlowVersion("acme", "customers", "login", "start: missing", "")
+		assert.ErrorIs(t, err, ErrInvalidFlowDefinition)
+	})
+
+	t.Run("Diff between versions", func(t *testing.T) {
+		diff, err := flowService.DiffFlowVersions("acme", "customers", "login", 1, 2)
+		require.NoError(t, err)
+		assert.Contains(t, diff, "-description: 'An empty flow'")
+		assert.Contains(t, diff, "+description: 'A draft flow'")
+	})
+
+	t.Run("Publish a draft", func(t *testing.T) {
+		require.NoError(t, flowService.PublishFlowVersion("acme", "customers", "login", 2))
+
+		flow, _ := flowService.GetFlowById("acme", "customers", "login")
+		assert.Equal(t, 2, flow.ActiveVersion)
+		assert.Equal(t, draftYaml, flow.DefinitionYaml)
+		assert.Equal(t, "A draft flow", flow.Definition.Description)
+	})
+
+	t.Run("Older versions can still be executed", func(t *testing.T) {
+		loadedRealm := &services_interface.LoadedRealm{Config: &model.Realm{Tenant: "acme", Realm: "customers"}}
+
+		flow, found := flowService.GetFlowVersionForExecution("login", 1, loadedRealm)
+		require.True(t, found)
+		assert.Equal(t, "An empty flow", flow.Definition.Description)
+		assert.Equal(t, "login", flow.Route)
+	})
+
+	t.Run("Rollback publishes the previous version", func(t *testing.T) {
+		version, err := flowService.RollbackFlow("acme", "customers", "login")
+		require.NoError(t, err)
+		assert.Equal(t, 1, version.Version)
+
+		flow, _ := flowService.GetFlowById("acme", "customers", "login")
+		assert.Equal(t, 1, flow.ActiveVersion)
+		assert.Equal(t, DEFAULT_FLOW_DEFINITION, flow.DefinitionYaml)
+
+		_, err = flowService.RollbackFlow("acme", "customers", "login")
+		assert.Error(t, err)
+	})
+
+	t.Run("Updating the definition directly publishes a new version", func(t *testing.T) {
+		flow, _ := flowService.GetFlowById("acme", "customers", "login")
+		flow.DefinitionYaml = draftYaml
+		require.NoError(t, flowService.UpdateFlow("acme", "customers", *flow))
+
+		flow, _ = flowService.GetFlowById("acme", "customers", "login")
+		assert.Equal(t, 3, flow.ActiveVersion)
+
+		// Updating other settings keeps the version
+		flow.DebugAllowed = true
+		require.NoError(t, flowService.UpdateFlow("acme", "customers", *flow))
+		flow, _ = flowService.GetFlowById("acme", "customers", "login")
+		assert.Equal(t, 3, flow.ActiveVersion)
+	})
+
+	t.Run("Rollback skips unpublished drafts", func(t *testing.T) {
+		draft, err := flowService.CreateFlowVersion("acme", "customers", "login", DEFAULT_FLOW_DEFINITION+"# unpublished\n", "")
+		require.NoError(t, err)
+		published, err := flowService.CreateFlowVersion("acme", "customers", "login", DEFAULT_FLOW_DEFINITION+"# published\n", "")
+		require.NoError(t, err)
+		require.NoError(t, flowService.PublishFlowVersion("acme", "customers", "login", published.Version))
+
+		version, err := flowService.RollbackFlow("acme", "customers", "login")
+		require.NoError(t, err)
+		assert.NotEqual(t, draft.Version, version.Version)
+		assert.Equal(t, 3, version.Version)
+
+		// Rolling back again returns to the version that was published before version 3
+		version, err = flowService.RollbackFlow("acme", "customers", "login")
+		require.NoError(t, err)
+		assert.Equal(t, 1, version.Version)
+	})
+
+	t.Run("Deleting a flow deletes its versions", func(t *testing.T) {
+		require.NoError(t, flowService.DeleteFlow("acme", "customers", "login"))
+		require.NoError(t, flowService.CreateFlow("acme", "customers", model.Flow{Id: "login", Route: "/login"}))
+
+		versions, err := flowService.ListFlowVersions("acme", "customers", "login")
+		require.NoError(t, err)
+		require.Len(t, versions, 1)
+		assert.Equal(t, 1, versions[0].Version)
+	})
+}
+
+func TestFlowService_Variants(t *testing.T) {
+	flowService := newTestVersionedFlowService(t)
+	draftYaml := strings.Replace(DEFAULT_FLOW_DEFINITION, "An empty flow", "A redesigned flow", 1)
+
+	require.NoError(t, flowService.CreateFlow("acme", "customers", model.Flow{Id: "login", Route: "/login", Active: true}))
+	_, err := flowService.CreateFlowVersion("acme", "customers", "login", draftYaml, "")
+	require.NoError(t, err)
+
+	t.Run("Variants must refer to existing versions", func(t *testing.T) {
+		flow, _ := flowService.GetFlowById("acme", "customers", "login")
+		flow.Variants = model.FlowVariants{{Name: "control", Version: 1, Weight: 95}, {Name: "redesign", Version: 7, Weight: 5}}
+		assert.Error(t, flowService.UpdateFlow("acme", "customers", *flow))
+
+		flow.Variants = model.FlowVariants{{Version: 1, Weight: 0}}
+		assert.Error(t, flowService.UpdateFlow("acme", "customers", *flow))
+	})
+
+	flow, _ := flowService.GetFlowById("acme", "customers", "login")
+	flow.Variants = model.FlowVariants{{Name: "control", Version: 1, Weight: 95}, {Version: 2, Weight: 5}}
+	require.NoError(t, flowService.UpdateFlow("acme", "customers", *flow))
+	flow, _ = flowService.GetFlowById("acme", "customers", "login")
+	assert.Equal(t, "v2", flow.Variants[1].Name)
+
+	t.Run("Assignment is sticky and follows the weights", func(t *testing.T) {
+		counts := map[string]int{}
+		for i := 0; i < 2000; i++ {
+			key := fmt.Sprintf("device-%d", i)
+			variant := flowService.SelectFlowVariant(flow, key, fmt.Sprintf("run-%d-a", i))
+			require.NotNil(t, variant)
+			assert.Equal(t, variant.Name, flowService.SelectFlowVariant(flow, key, fmt.Sprintf("run-%d-b", i)).Name)
+			counts[variant.Name]++
+		}
+
+		assert.InDelta(t, 100, counts["v2"], 50)
+		assert.Equal(t, 2000, counts["control"]+counts["v2"])
+	})
+
+	t.Run("Changing the weights keeps the assignments", func(t *testing.T) {
+		changed := *flow
+		changed.Variants = model.FlowVariants{{Name: "control", Version: 1, Weight: 5}, {Name: "v2", Version: 2, Weight: 95}}
+
+		for i := 0; i < 200; i++ {
+			key := fmt.Sprintf("device-%d", i)
+			before := flowService.SelectFlowVariant(flow, key, fmt.Sprintf("run-%d-c", i))
+			assert.Equal(t, before.Name, flowService.SelectFlowVariant(&changed, key, fmt.Sprintf("run-%d-d", i)).Name)
+		}
+
+		// Devices of a variant without weight are assigned again
+		stopped := *flow
+		stopped.Variants = model.FlowVariants{{Name: "control", Version: 1, Weight: 0}, {Name: "v2", Version: 2, Weight: 100}}
+		assert.Equal(t, "v2", flowService.SelectFlowVariant(&stopped, "device-0", "run-0-e").Name)
+		assert.Equal(t, "v2", flowService.SelectFlowVariant(flow, "device-0", "run-0-f").Name)
+	})
+
+	t.Run("Results are recorded once per session", func(t *testing.T) {
+		session := &model.AuthenticationSession{
+			RealmObject: model.RealmObject{Tenant: "acme", Realm: "customers"},
+			RunID:       "run-1-a",
+			FlowId:      "login",
+			FlowVariant: "control",
+			CurrentType: model.NODE_FAILURE_RESULT,
+		}
+		before, err := flowService.GetFlowVariantMetrics("acme", "customers", "login")
+		require.NoError(t, err)
+
+		flowService.RecordFlowVariantResult(session)
+		flowService.RecordFlowVariantResult(session)
+
+		metrics, err := flowService.GetFlowVariantMetrics("acme", "customers", "login")
+		require.NoError(t, err)
+		require.Len(t, metrics, 2)
+		assert.Equal(t, "control", metrics[0].Name)
+		assert.Equal(t, before[0].Failed+1, metrics[0].Failed)
+		assert.Greater(t, metrics[1].Started, uint64(0))
+		assert.Greater(t, metrics[0].Started, metrics[1].Started)
+	})
+}
+
+const subflowParentYaml = `
+description: 'Login with a shared mfa step'
+start: init
+nodes:
+  init:
+    name: init
+    use: init
+    next:
+      start: askUsername
+  askUsername:
+    name: askUsername
+    use: askUsername
+    next:
+      submitted: mfa
+  mfa:
+    name: mfa
+    use: subflow
+    custom_config:
+      flow: mfa
+      inputs: username
+    next:
+      success: successResult
+      failure: failureResult
+  successResult:
+    name: successResult
+    use: successResult
+  failureResult:
+    name: failureResult
+    use: failureResult
+`
+
+const subflowChildYaml = `
+description: 'Shared mfa step'
+start: init
+nodes:
+  init:
+    name: init
+    use: init
+    next:
+      start: verifyTOTP
+  verifyTOTP:
+    name: verifyTOTP
+    use: verifyTOTP
+    next:
+      success: successResult
+      failure: failureResult
+      locked: failureResult
+  successResult:
+    name: successResult
+    use: successResult
+  failureResult:
+    name: failureResult
+    use: failureResult
+`
+
+func TestFlowService_Subflows(t *testing.T) {
+	flowService := newTestVersionedFlowService(t)
+	loadedRealm := &services_interface.LoadedRealm{Config: &model.Realm{Tenant: "acme", Realm: "customers"}}
+
+	// Node settings are resolved from the server settings when a flow is loaded for execution
+	if config.ServerSettings == nil {
+		config.InitConfiguration(server_settings.NewGoamServerSettings())
+	}
+
+	// The child flow may be created after the flow that uses it
+	require.NoError(t, flowService.CreateFlow("acme", "customers", model.Flow{Id: "login", Route: "/login", Active: true, DefinitionYaml: subflowParentYaml}))
+
+	_, found := flowService.GetFlowForExecution("login", loadedRealm)
+	assert.False(t, found)
+
+	require.NoError(t, flowService.CreateFlow("acme", "customers", model.Flow{Id: "mfa", Route: "/mfa", DefinitionYaml: subflowChildYaml}))
+
+	t.Run("Flows are expanded for execution", func(t *testing.T) {
+		flow, found := flowService.GetFlowForExecution("login", loadedRealm)
+		require.True(t, found)
+		assert.Contains(t, flow.Definition.Nodes, "mfa.verifyTOTP")
+		assert.Equal(t, "mfa.init", flow.Definition.Nodes["mfa"].Next["enter"])
+
+		// The stored definition is not changed
+		flow, _ = flowService.GetFlowById("acme", "customers", "login")
+		assert.NotContains(t, flow.Definition.Nodes, "mfa.verifyTOTP")
+	})
+
+	t.Run("Recursive includes are rejected", func(t *testing.T) {
+		recursiveYaml := strings.Replace(subflowParentYaml, "flow: mfa", "flow: login", 1)
+
+		mfa, _ := flowService.GetFlowById("acme", "customers", "mfa")
+		mfa.DefinitionYaml = recursiveYaml
+		err := flowService.UpdateFlow("acme", "customers", *mfa)
+		assert.ErrorContains(t, err, "mfa -> login -> mfa")
+
+		_, err = flowService.CreateFlowVersion("acme", "customers", "mfa", recursiveYaml, "")
+		assert.Error(t, err)
+
+		err = flowService.CreateFlow("acme", "customers", model.Flow{Id: "loop", Route: "/loop", DefinitionYaml: strings.Replace(subflowParentYaml, "flow: mfa", "flow: loop", 1)})
+		assert.ErrorContains(t, err, "includes flow 'loop' recursively")
+	})
+}
+
+func TestOverwriteNodeSettings_ConfigSchema(t *testing.T) {
+	if config.ServerSettings == nil {
+		config.InitConfiguration(server_settings.NewGoamServerSettings())
+	}
+
+	def := &model.NodeDefinition{
+		Name:                 "riskScore",
+		Type:                 model.NodeTypeLogic,
+		PossibleResultStates: []string{"done"},
+		ConfigSchema: map[string]model.ConfigOption{
+			"threshold": {Description: "Score above which the login is rejected", Type: model.ConfigOptionInt, Default: "80"},
+			"api_key":   {Description: "Api key of the risk service", Secret: true},
+		},
+		Run: func(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+			return &model.NodeResult{Condition: "done"}, nil
+		},
+	}
+	require.NoError(t, graph.RegisterNodeDefinition(def, nil))
+	defer graph.UnregisterNodeDefinition(def.Name)
+
+	flow := &model.FlowDefinition{Nodes: map[string]*model.GraphNode{
+		"risk": {Name: "risk", Use: "riskScore"},
+	}}
+	loadedRealm := &services_interface.LoadedRealm{Config: &model.Realm{RealmSettings: map[string]string{"api_key": "realm-key"}}}
+
+	overwriteNodeSettings(flow, loadedRealm)
+
+	// Options that are not set anywhere else use the default of the schema
+	assert.Equal(t, "80", flow.Nodes["risk"].CustomConfig["threshold"])
+	assert.Equal(t, "realm-key", flow.Nodes["risk"].CustomConfig["api_key"])
+
+	flow.Nodes["risk"].CustomConfig["threshold"] = "50"
+	overwriteNodeSettings(flow, loadedRealm)
+	assert.Equal(t, "50", flow.Nodes["risk"].CustomConfig["threshold"])
+}
+
+func TestFlowService_StrictFlowValidation(t *testing.T) {
+	flowService := newTestVersionedFlowService(t)
+	if config.ServerSettings == nil {
+		config.InitConfiguration(server_settings.NewGoamServerSettings())
+	}
+
+	// createUser never returns 'fail', flows written before the lint checks still use it
+	legacyYaml := `start: init
+nodes:
+  init:
+    name: init
+    use: init
+    next:
+      start: createUser
+  createUser:
+    name: createUser
+    use: createUser
+    next:
+      fail: failure
+      success: failure
+  failure:
+    name: failureResult
+    use: failureResult
+`
+
+	// Definitions saved through the service are always checked strictly
+	err := flowService.CreateFlow("acme", "customers", model.Flow{Id: "strict", Route: "/strict", DefinitionYaml: legacyYaml})
+	assert.ErrorIs(t, err, ErrInvalidFlowDefinition)
+
+	lintErrors, err := flowService.ValidateFlowDefinition(legacyYaml)
+	require.NoError(t, err)
+	require.NotEmpty(t, lintErrors)
+	assert.Equal(t, services_interface.FlowLintSeverityError, lintErrors[0].Severity)
+
+	// Flows from the configuration files still load, also when they are updated
+	require.NoError(t, flowService.ImportFlow("acme", "customers", model.Flow{Id: "legacy", Route: "/legacy", DefinitionYaml: legacyYaml}))
+	require.NoError(t, flowService.ImportFlow("acme", "customers", model.Flow{Id: "legacy", Route: "/legacy2", DefinitionYaml: legacyYaml}))
+	flow, ok := flowService.GetFlowById("acme", "customers", "legacy")
+	require.True(t, ok)
+	assert.Equal(t, "legacy2", flow.Route)
+
+	// An update through the service is validated before it is recorded as a version
+	versions, err := flowService.ListFlowVersions("acme", "customers", "legacy")
+	require.NoError(t, err)
+
+	flow.DefinitionYaml = legacyYaml + "# changed\n"
+	assert.ErrorIs(t, flowService.UpdateFlow("acme", "customers", *flow), ErrInvalidFlowDefinition)
+
+	versionsAfter, err := flowService.ListFlowVersions("acme", "customers", "legacy")
+	require.NoError(t, err)
+	assert.Len(t, versionsAfter, len(versions))
+
+	config.ServerSettings.StrictFlowValidation = true
+	defer func() { config.ServerSettings.StrictFlowValidation = false }()
+
+	err = flowService.ImportFlow("acme", "customers", model.Flow{Id: "imported", Route: "/imported", DefinitionYaml: legacyYaml})
+	assert.ErrorIs(t, err, ErrInvalidFlowDefinition)
+}
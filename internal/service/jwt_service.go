@@ -8,12 +8,17 @@ import (
 
 	"github.com/Identityplane/GoAM/internal/lib/jwt_ec256"
 	"github.com/Identityplane/GoAM/pkg/db"
+	"github.com/Identityplane/GoAM/pkg/kms"
 	"github.com/Identityplane/GoAM/pkg/model"
 	services_interface "github.com/Identityplane/GoAM/pkg/services"
 
 	"github.com/google/uuid"
 )
 
+// jwtKeyAlgorithm is the algorithm of the keys the JWT service signs with. The signing keys of a realm can also
+// contain keys of other protocols, such as the RSA keys of the SAML identity provider, which the JWT service ignores.
+const jwtKeyAlgorithm = "EC256"
+
 // jwtServiceImpl implements JWTService
 type jwtServiceImpl struct {
 	signingKeyDB db.SigningKeyDB
@@ -34,7 +39,7 @@ func (s *jwtServiceImpl) ensureKeyExists(ctx context.Context, tenant, realm stri
 	if err != nil {
 		return fmt.Errorf("failed to list active keys: %w", err)
 	}
-	if len(keys) > 0 {
+	if len(filterJWTKeys(keys)) > 0 {
 		return nil // Active key already exists
 	}
 
@@ -57,8 +62,8 @@ func (s *jwtServiceImpl) ensureKeyExists(ctx context.Context, tenant, realm stri
 		Realm:              realm,
 		Kid:                keyID,
 		Active:             true,
-		Algorithm:          "EC256",
-		Implementation:     "plain",
+		Algorithm:          jwtKeyAlgorithm,
+		Implementation:     kms.PlainImplementation,
 		SigningKeyMaterial: privateKey,
 		PublicKeyJWK:       publicKey,
 		Created:            time.Now(),
@@ -87,7 +92,7 @@ func (s *jwtServiceImpl) LoadPublicKeys(tenant, realm string) (string, error) {
 
 	// Create a JWKS set with all keys
 	var jwksKeys []interface{}
-	for _, key := range keys {
+	for _, key := range filterJWTKeys(keys) {
 		// Parse the public key JSON
 		var keyMap map[string]interface{}
 		if err := json.Unmarshal([]byte(key.PublicKeyJWK), &keyMap); err != nil {
@@ -117,6 +122,7 @@ func (s *jwtServiceImpl) GetActiveSigningKey(ctx context.Context, tenant, realm
 	if err != nil {
 		return nil, fmt.Errorf("failed to list active keys: %w", err)
 	}
+	keys = filterJWTKeys(keys)
 	if len(keys) == 0 {
 		return nil, fmt.Errorf("no active keys found")
 	}
@@ -167,7 +173,7 @@ func (s *jwtServiceImpl) RotateKey(tenant, realm string) error {
 		return fmt.Errorf("failed to list active keys: %w", err)
 	}
 
-	for _, key := range keys {
+	for _, key := range filterJWTKeys(keys) {
 		if err := s.signingKeyDB.DisableSigningKey(ctx, tenant, realm, key.Kid); err != nil {
 			return fmt.Errorf("failed to disable key %s: %w", key.Kid, err)
 		}
@@ -176,3 +182,14 @@ func (s *jwtServiceImpl) RotateKey(tenant, realm string) error {
 	// Then generate a new key
 	return s.ensureKeyExists(ctx, tenant, realm)
 }
+
+// filterJWTKeys returns the keys that are used to sign JWTs
+func filterJWTKeys(keys []model.SigningKey) []model.SigningKey {
+	filtered := make([]model.SigningKey, 0, len(keys))
+	for _, key := range keys {
+		if key.Algorithm == jwtKeyAlgorithm {
+			filtered = append(filtered, key)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Identityplane/GoAM/internal/auth/repository"
+	"github.com/Identityplane/GoAM/internal/lib/ldap"
+	"github.com/Identityplane/GoAM/internal/logger"
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// syncLdapDirectory creates or updates a user for every entry of the directory of the realm and replaces their group
+// entitlements. Users that were removed from the directory are kept, but lose the entitlements of their groups.
+// Realms without ldap_sync in their settings or the node settings of the server are skipped.
+func (s *maintenanceServiceImpl) syncLdapDirectory(ctx context.Context, tenant, realm string) (int, error) {
+
+	realmConfig, err := s.realmDB.GetRealm(ctx, tenant, realm)
+	if err != nil || realmConfig == nil {
+		return 0, err
+	}
+
+	settings := repository.NewSettingsReader(realmConfig.RealmSettings, nodeSettings())
+	setting := func(name string) string {
+		value, _ := settings.GetSetting(name)
+		return value
+	}
+	if enabled, _ := strconv.ParseBool(setting(ldap.SettingSync)); !enabled {
+		return 0, nil
+	}
+
+	cfg, err := ldap.ParseConfig(setting)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ldap settings: %w", err)
+	}
+
+	directory, err := ldap.Connect(cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer directory.Close()
+
+	entries, err := directory.SearchUsers()
+	if err != nil {
+		return 0, err
+	}
+	groups, err := directory.SearchGroups()
+	if err != nil {
+		return 0, err
+	}
+
+	repo := repository.NewUserRepository(tenant, realm, s.userDB, s.userAttributeDB)
+	newUser := func() (*model.User, error) {
+		return repo.NewUserModel(&model.AuthenticationSession{Context: map[string]string{}})
+	}
+
+	log := logger.GetGoamLogger()
+	affected := 0
+	synced := map[string]bool{}
+	var errs []error
+
+	// A single entry that cannot be imported, e.g. because its email is used by a local user, does not stop the sync
+	for _, entry := range entries {
+		user, changed, err := ldap.Provision(ctx, repo, cfg, entry, groups, newUser)
+		if err != nil {
+			log.Warn().Err(err).Str("tenant", tenant).Str("realm", realm).Msg("failed to sync ldap entry")
+			errs = append(errs, err)
+			continue
+		}
+		synced[user.ID] = true
+		if changed {
+			affected++
+		}
+	}
+
+	// Users of entries that failed might not be in synced, their entitlements are kept until the next sync
+	if len(errs) > 0 {
+		return affected, errors.Join(errs...)
+	}
+
+	err = s.forEachAttribute(ctx, tenant, realm, model.AttributeTypeLdap, func(attr *model.UserAttribute) error {
+		if synced[attr.UserID] {
+			return nil
+		}
+
+		user, err := repo.GetByID(ctx, attr.UserID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return nil
+		}
+
+		changed, err := ldap.ApplyGroups(user, cfg, nil, groups)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return nil
+		}
+		if err := repo.Update(ctx, user); err != nil {
+			return err
+		}
+		affected++
+		return nil
+	})
+
+	return affected, err
+}
@@ -0,0 +1,570 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/logger"
+	"github.com/Identityplane/GoAM/pkg/db"
+	"github.com/Identityplane/GoAM/pkg/kms"
+	"github.com/Identityplane/GoAM/pkg/model"
+	services_interface "github.com/Identityplane/GoAM/pkg/services"
+)
+
+// Names of the maintenance jobs, they are used as keys for the schedules in the server settings
+const (
+	MaintenanceJobExpiredAuthSessions   = "expired_auth_sessions"
+	MaintenanceJobExpiredClientSessions = "expired_client_sessions"
+	MaintenanceJobExpiredDeviceSessions = "expired_device_sessions"
+	MaintenanceJobStaleOtpState         = "stale_otp_state"
+	MaintenanceJobReencryptSecrets      = "reencrypt_secrets"
+	MaintenanceJobExpiredPasswordResets = "expired_password_reset_tokens"
+	MaintenanceJobLdapSync              = "ldap_sync"
+)
+
+// DefaultOtpStateRetention is how long failed OTP attempts are remembered if the user does not try again
+const DefaultOtpStateRetention = 24 * time.Hour
+
+// ErrMaintenanceJobNotFound is returned if a job with the given name does not exist
+var ErrMaintenanceJobNotFound = errors.New("maintenance job not found")
+
+// maintenanceJob is a job that runs for every realm. It returns the number of changed or deleted attributes.
+type maintenanceJob struct {
+	name            string
+	description     string
+	defaultInterval time.Duration
+	run             func(ctx context.Context, tenant, realm string) (int, error)
+}
+
+type maintenanceServiceImpl struct {
+	realmDB         db.RealmDB
+	authSessionDB   db.AuthSessionDB
+	clientSessionDB db.ClientSessionDB
+	userDB          db.UserDB
+	userAttributeDB db.UserAttributeDB
+	signingKeyDB    db.SigningKeyDB
+	resetTokenDB    db.PasswordResetTokenDB
+	jobLockDB       db.JobLockDB
+
+	jobs         []*maintenanceJob
+	intervals    map[string]time.Duration
+	otpRetention time.Duration
+
+	mutex  sync.Mutex
+	status map[string]*services_interface.MaintenanceJobStatus
+}
+
+// NewMaintenanceService creates a new MaintenanceService. Schedules map job names to an interval such as "15m"
+// or "disabled", jobs without a schedule use their default interval. jobLockDB may be nil for single instance deployments.
+func NewMaintenanceService(realmDB db.RealmDB, authSessionDB db.AuthSessionDB, clientSessionDB db.ClientSessionDB, userDB db.UserDB, userAttributeDB db.UserAttributeDB, signingKeyDB db.SigningKeyDB, resetTokenDB db.PasswordResetTokenDB, jobLockDB db.JobLockDB, schedules map[string]string, otpRetention time.Duration) (services_interface.MaintenanceService, error) {
+
+	s := &maintenanceServiceImpl{
+		realmDB:         realmDB,
+		authSessionDB:   authSessionDB,
+		clientSessionDB: clientSessionDB,
+		userDB:          userDB,
+		userAttributeDB: userAttributeDB,
+		signingKeyDB:    signingKeyDB,
+		resetTokenDB:    resetTokenDB,
+		jobLockDB:       jobLockDB,
+		intervals:       map[string]time.Duration{},
+		otpRetention:    otpRetention,
+		status:          map[string]*services_interface.MaintenanceJobStatus{},
+	}
+
+	if s.otpRetention <= 0 {
+		s.otpRetention = DefaultOtpStateRetention
+	}
+
+	s.jobs = []*maintenanceJob{
+		{
+			name:            MaintenanceJobExpiredAuthSessions,
+			description:     "Deletes expired authentication sessions",
+			defaultInterval: 5 * time.Minute,
+			run:             s.deleteExpiredAuthSessions,
+		},
+		{
+			name:            MaintenanceJobExpiredClientSessions,
+			description:     "Deletes expired client sessions such as authorization codes, access and refresh tokens",
+			defaultInterval: time.Hour,
+			run:             s.deleteExpiredClientSessions,
+		},
+		{
+			name:            MaintenanceJobExpiredDeviceSessions,
+			description:     "Deletes devices whose cookie has expired and removes expired sessions from the remaining devices",
+			defaultInterval: time.Hour,
+			run:             s.cleanupExpiredDeviceSessions,
+		},
+		{
+			name:            MaintenanceJobStaleOtpState,
+			description:     fmt.Sprintf("Resets failed OTP attempts of email and TOTP attributes that were not used for %s, locked attributes are kept", s.otpRetention),
+			defaultInterval: time.Hour,
+			run:             s.resetStaleOtpState,
+		},
+		{
+			name:            MaintenanceJobExpiredPasswordResets,
+			description:     "Deletes expired password reset tokens, they are kept until then to rate limit reset requests",
+			defaultInterval: time.Hour,
+			run:             s.deleteExpiredPasswordResetTokens,
+		},
+		{
+			// Disabled by default as it rewrites every secret, run it after a new key encryption key was added
+			name:        MaintenanceJobReencryptSecrets,
+			description: "Encrypts signing keys and sensitive attribute fields with the current key encryption key",
+			run:         s.reencryptSecrets,
+		},
+		{
+			// Disabled by default, realms also need ldap_sync to be set
+			name:        MaintenanceJobLdapSync,
+			description: "Imports the users and groups of the LDAP directory of realms with ldap_sync enabled",
+			run:         s.syncLdapDirectory,
+		},
+	}
+
+	for _, job := range s.jobs {
+		s.intervals[job.name] = job.defaultInterval
+	}
+
+	for name, schedule := range schedules {
+		if s.findJob(name) == nil {
+			return nil, fmt.Errorf("unknown maintenance job %s", name)
+		}
+
+		interval, err := parseMaintenanceSchedule(schedule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule for maintenance job %s: %w", name, err)
+		}
+		s.intervals[name] = interval
+	}
+
+	for _, job := range s.jobs {
+		interval := s.intervals[job.name]
+		status := &services_interface.MaintenanceJobStatus{
+			Name:        job.name,
+			Description: job.description,
+			Enabled:     interval > 0,
+		}
+		if interval > 0 {
+			status.Interval = interval.String()
+		}
+		s.status[job.name] = status
+	}
+
+	return s, nil
+}
+
+// parseMaintenanceSchedule parses an interval like "30m", a schedule of "disabled" or "0" disables the job
+func parseMaintenanceSchedule(schedule string) (time.Duration, error) {
+	schedule = strings.TrimSpace(schedule)
+
+	if schedule == "" {
+		return 0, fmt.Errorf("schedule is empty")
+	}
+	if schedule == "disabled" || schedule == "0" {
+		return 0, nil
+	}
+
+	interval, err := time.ParseDuration(schedule)
+	if err != nil {
+		return 0, err
+	}
+	if interval < time.Second {
+		return 0, fmt.Errorf("interval must be at least 1s")
+	}
+	return interval, nil
+}
+
+func (s *maintenanceServiceImpl) Start(ctx context.Context) error {
+
+	for _, job := range s.jobs {
+		interval := s.intervals[job.name]
+		if interval <= 0 {
+			continue
+		}
+		go s.schedule(ctx, job, interval)
+	}
+
+	return nil
+}
+
+func (s *maintenanceServiceImpl) RunJob(ctx context.Context, name string) (*services_interface.MaintenanceJobStatus, error) {
+
+	job := s.findJob(name)
+	if job == nil {
+		return nil, ErrMaintenanceJobNotFound
+	}
+
+	s.runJob(ctx, job)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	status := *s.status[name]
+	return &status, nil
+}
+
+func (s *maintenanceServiceImpl) ListJobs() []services_interface.MaintenanceJobStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	jobs := make([]services_interface.MaintenanceJobStatus, 0, len(s.status))
+	for _, status := range s.status {
+		jobs = append(jobs, *status)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Name < jobs[j].Name
+	})
+	return jobs
+}
+
+func (s *maintenanceServiceImpl) findJob(name string) *maintenanceJob {
+	for _, job := range s.jobs {
+		if job.name == name {
+			return job
+		}
+	}
+	return nil
+}
+
+// schedule runs the job every interval until the context is cancelled
+func (s *maintenanceServiceImpl) schedule(ctx context.Context, job *maintenanceJob, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.setNextRun(job.name, time.Now().Add(interval))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runJob(ctx, job)
+			s.setNextRun(job.name, time.Now().Add(interval))
+		}
+	}
+}
+
+func (s *maintenanceServiceImpl) setNextRun(name string, next time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.status[name].NextRun = &next
+}
+
+// runJob runs the job for all realms while holding the job lock and records the result
+func (s *maintenanceServiceImpl) runJob(ctx context.Context, job *maintenanceJob) {
+	log := logger.GetGoamLogger()
+
+	s.mutex.Lock()
+	if s.status[job.name].Running {
+		s.mutex.Unlock()
+		return
+	}
+	s.status[job.name].Running = true
+	s.mutex.Unlock()
+
+	start := time.Now()
+	affected := 0
+
+	run := func(ctx context.Context) error {
+		var err error
+		affected, err = s.runForAllRealms(ctx, job)
+		return err
+	}
+
+	acquired := true
+	var err error
+	if s.jobLockDB != nil {
+		acquired, err = s.jobLockDB.RunWithLock(ctx, "goam_maintenance_"+job.name, run)
+	} else {
+		err = run(ctx)
+	}
+
+	duration := time.Since(start)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	status := s.status[job.name]
+	status.Running = false
+	status.LastRun = &start
+	status.LastDuration = duration.String()
+	status.LastAffected = affected
+	status.LastError = ""
+
+	switch {
+	case err != nil:
+		status.LastResult = services_interface.MaintenanceJobResultFailed
+		status.LastError = err.Error()
+		log.Error().Err(err).Str("job", job.name).Msg("maintenance job failed")
+	case !acquired:
+		status.LastResult = services_interface.MaintenanceJobResultSkipped
+		log.Debug().Str("job", job.name).Msg("maintenance job is running on another instance")
+	default:
+		status.LastResult = services_interface.MaintenanceJobResultSuccess
+		log.Debug().Str("job", job.name).Int("affected", affected).Dur("duration", duration).Msg("maintenance job finished")
+	}
+}
+
+// runForAllRealms runs the job for every realm. A failing realm does not stop the other realms,
+// the errors are joined instead.
+func (s *maintenanceServiceImpl) runForAllRealms(ctx context.Context, job *maintenanceJob) (int, error) {
+
+	realms, err := s.realmDB.ListAllRealms(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list realms: %w", err)
+	}
+
+	affected := 0
+	var errs []error
+	for _, realm := range realms {
+		if ctx.Err() != nil {
+			return affected, ctx.Err()
+		}
+
+		n, err := job.run(ctx, realm.Tenant, realm.Realm)
+		affected += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s: %w", realm.Tenant, realm.Realm, err))
+		}
+	}
+
+	return affected, errors.Join(errs...)
+}
+
+func (s *maintenanceServiceImpl) deleteExpiredAuthSessions(ctx context.Context, tenant, realm string) (int, error) {
+	return s.authSessionDB.DeleteExpiredAuthSessions(ctx, tenant, realm)
+}
+
+func (s *maintenanceServiceImpl) deleteExpiredClientSessions(ctx context.Context, tenant, realm string) (int, error) {
+	return s.clientSessionDB.DeleteExpiredClientSessions(ctx, tenant, realm)
+}
+
+// deleteExpiredPasswordResetTokens deletes reset tokens that expired before the rate limit window ended
+func (s *maintenanceServiceImpl) deleteExpiredPasswordResetTokens(ctx context.Context, tenant, realm string) (int, error) {
+	return s.resetTokenDB.DeleteExpiredPasswordResetTokens(ctx, tenant, realm, time.Now().Add(-maxPasswordResetWindow))
+}
+
+// cleanupExpiredDeviceSessions deletes devices that the browser has already forgotten and drops expired
+// LOA1 and LOA2 sessions so that they are not kept in the attribute forever
+func (s *maintenanceServiceImpl) cleanupExpiredDeviceSessions(ctx context.Context, tenant, realm string) (int, error) {
+	now := time.Now()
+	affected := 0
+
+	err := s.forEachAttribute(ctx, tenant, realm, model.AttributeTypeDevice, func(attr *model.UserAttribute) error {
+		device, err := decodeAttributeValue[model.DeviceAttributeValue](attr)
+		if err != nil {
+			skipAttribute(tenant, realm, attr, err)
+			return nil
+		}
+
+		// The browser no longer sends the cookie, so the device cannot be updated by a login in the meantime
+		if !device.CookieExpires.IsZero() && device.CookieExpires.Before(now) {
+			if err := s.userAttributeDB.DeleteUserAttribute(ctx, tenant, realm, attr.ID); err != nil {
+				return err
+			}
+			affected++
+			return nil
+		}
+
+		changed := false
+		if device.SessionLoa1 != nil && !device.SessionLoa1.IsActive(now) {
+			device.SessionLoa1 = nil
+			changed = true
+		}
+		if device.SessionLoa2 != nil && !device.SessionLoa2.IsActive(now) {
+			device.SessionLoa2 = nil
+			changed = true
+		}
+		if !changed {
+			return nil
+		}
+
+		attr.Value = device
+		return s.updateAttributeIfUnchanged(ctx, attr, &affected)
+	})
+
+	return affected, err
+}
+
+// resetStaleOtpState resets failed OTP attempts that are older than the retention period. Locked attributes
+// are not touched as unlocking is an administrative decision.
+func (s *maintenanceServiceImpl) resetStaleOtpState(ctx context.Context, tenant, realm string) (int, error) {
+	cutoff := time.Now().Add(-s.otpRetention)
+	affected := 0
+
+	err := s.forEachAttribute(ctx, tenant, realm, model.AttributeTypeEmail, func(attr *model.UserAttribute) error {
+		if !attr.UpdatedAt.Before(cutoff) {
+			return nil
+		}
+
+		email, err := decodeAttributeValue[model.EmailAttributeValue](attr)
+		if err != nil {
+			skipAttribute(tenant, realm, attr, err)
+			return nil
+		}
+		if email.OtpLocked || email.OtpFailedAttempts == 0 {
+			return nil
+		}
+
+		email.OtpFailedAttempts = 0
+		attr.Value = email
+		return s.updateAttributeIfUnchanged(ctx, attr, &affected)
+	})
+	if err != nil {
+		return affected, err
+	}
+
+	err = s.forEachAttribute(ctx, tenant, realm, model.AttributeTypePhone, func(attr *model.UserAttribute) error {
+		if !attr.UpdatedAt.Before(cutoff) {
+			return nil
+		}
+
+		phone, err := decodeAttributeValue[model.PhoneAttributeValue](attr)
+		if err != nil {
+			skipAttribute(tenant, realm, attr, err)
+			return nil
+		}
+		if phone.OtpLocked || phone.OtpFailedAttempts == 0 {
+			return nil
+		}
+
+		phone.OtpFailedAttempts = 0
+		attr.Value = phone
+		return s.updateAttributeIfUnchanged(ctx, attr, &affected)
+	})
+	if err != nil {
+		return affected, err
+	}
+
+	err = s.forEachAttribute(ctx, tenant, realm, model.AttributeTypeTOTP, func(attr *model.UserAttribute) error {
+		if !attr.UpdatedAt.Before(cutoff) {
+			return nil
+		}
+
+		totp, err := decodeAttributeValue[model.TOTPAttributeValue](attr)
+		if err != nil {
+			skipAttribute(tenant, realm, attr, err)
+			return nil
+		}
+		if totp.Locked || totp.FailedAttempts == 0 {
+			return nil
+		}
+
+		totp.FailedAttempts = 0
+		attr.Value = totp
+		return s.updateAttributeIfUnchanged(ctx, attr, &affected)
+	})
+
+	return affected, err
+}
+
+// reencryptSecrets writes all signing keys and attributes with sensitive fields again. The database adapters
+// decrypt them on read and encrypt them with the current key encryption key on write, which also encrypts
+// secrets that were stored before encryption was enabled.
+func (s *maintenanceServiceImpl) reencryptSecrets(ctx context.Context, tenant, realm string) (int, error) {
+
+	if kms.GetKeyProvider() == nil {
+		return 0, nil
+	}
+
+	affected := 0
+
+	keys, err := s.signingKeyDB.ListSigningKeys(ctx, tenant, realm)
+	if err != nil {
+		return affected, err
+	}
+
+	for i := range keys {
+		if err := s.signingKeyDB.UpdateSigningKey(ctx, &keys[i]); err != nil {
+			return affected, err
+		}
+		affected++
+	}
+
+	attributeTypes := make([]string, 0, len(model.SensitiveAttributeFields))
+	for attributeType := range model.SensitiveAttributeFields {
+		attributeTypes = append(attributeTypes, attributeType)
+	}
+	sort.Strings(attributeTypes)
+
+	// An attribute that was changed in the meantime has already been written with the current key
+	for _, attributeType := range attributeTypes {
+		err := s.forEachAttribute(ctx, tenant, realm, attributeType, func(attr *model.UserAttribute) error {
+			return s.updateAttributeIfUnchanged(ctx, attr, &affected)
+		})
+		if err != nil {
+			return affected, err
+		}
+	}
+
+	return affected, nil
+}
+
+// maintenanceAttributePageSize is the number of attributes a job loads from the database at once
+const maintenanceAttributePageSize = 500
+
+// forEachAttribute calls fn for every attribute of a type in the realm. The attributes are loaded page by page,
+// so jobs do not need to hold all attributes of a realm in memory.
+func (s *maintenanceServiceImpl) forEachAttribute(ctx context.Context, tenant, realm, attributeType string, fn func(attr *model.UserAttribute) error) error {
+	afterID := ""
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		attrs, err := s.userAttributeDB.ListUserAttributesByType(ctx, tenant, realm, attributeType, afterID, maintenanceAttributePageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, attr := range attrs {
+			if err := fn(attr); err != nil {
+				return err
+			}
+		}
+
+		if len(attrs) < maintenanceAttributePageSize {
+			return nil
+		}
+		afterID = attrs[len(attrs)-1].ID
+	}
+}
+
+// updateAttributeIfUnchanged writes an attribute changed by a job unless the user changed it since it was loaded.
+// Such attributes are skipped, the next run of the job looks at them again.
+func (s *maintenanceServiceImpl) updateAttributeIfUnchanged(ctx context.Context, attr *model.UserAttribute, affected *int) error {
+	updated, err := s.userAttributeDB.UpdateUserAttributeIfUnchanged(ctx, attr, attr.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if updated {
+		*affected++
+	}
+	return nil
+}
+
+// skipAttribute logs an attribute that a job cannot process, so that a single broken attribute does not stop
+// the job for the whole realm
+func skipAttribute(tenant, realm string, attr *model.UserAttribute, err error) {
+	log := logger.GetGoamLogger()
+	log.Warn().Err(err).Str("tenant", tenant).Str("realm", realm).Str("attribute_id", attr.ID).Str("type", attr.Type).Msg("skipping attribute that cannot be decoded")
+}
+
+// decodeAttributeValue converts the value of an attribute loaded from the database to its typed value
+func decodeAttributeValue[T any](attr *model.UserAttribute) (*T, error) {
+	user := &model.User{UserAttributes: []*model.UserAttribute{attr}}
+
+	value, _, err := model.GetAttribute[T](user, attr.Type)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode attribute %s: %w", attr.ID, err)
+	}
+	if value == nil {
+		return nil, fmt.Errorf("attribute %s has no value of type %s", attr.ID, attr.Type)
+	}
+	return value, nil
+}
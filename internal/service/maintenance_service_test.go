@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/db/sqlite_adapter"
+	"github.com/Identityplane/GoAM/internal/lib/ldap"
+	"github.com/Identityplane/GoAM/internal/lib/ldap/ldaptest"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/Identityplane/GoAM/pkg/model/attributes"
+	services_interface "github.com/Identityplane/GoAM/pkg/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupMaintenanceTest(t *testing.T, schedules map[string]string) (*maintenanceServiceImpl, *sqlite_adapter.SQLiteUserAttributeDB) {
+	sqliteDB, err := sql.Open("sqlite", ":memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	t.Cleanup(func() { sqliteDB.Close() })
+	sqliteDB.SetMaxOpenConns(1)
+
+	require.NoError(t, sqlite_adapter.RunMigrations(sqliteDB))
+
+	realmDB, err := sqlite_adapter.NewRealmDB(sqliteDB)
+	require.NoError(t, err)
+	authSessionDB, err := sqlite_adapter.NewAuthSessionDB(sqliteDB)
+	require.NoError(t, err)
+	clientSessionDB, err := sqlite_adapter.NewClientSessionDB(sqliteDB)
+	require.NoError(t, err)
+	userDB, err := sqlite_adapter.NewUserDB(sqliteDB)
+	require.NoError(t, err)
+	userAttributeDB, err := sqlite_adapter.NewUserAttributeDB(sqliteDB)
+	require.NoError(t, err)
+	signingKeyDB, err := sqlite_adapter.NewSigningKeyDB(sqliteDB)
+	require.NoError(t, err)
+	resetTokenDB, err := sqlite_adapter.NewPasswordResetTokenDB(sqliteDB)
+	require.NoError(t, err)
+	jobLockDB, err := sqlite_adapter.NewJobLockDB(sqliteDB)
+	require.NoError(t, err)
+
+	require.NoError(t, realmDB.CreateRealm(context.Background(), model.Realm{Tenant: "acme", Realm: "customers"}))
+
+	maintenanceService, err := NewMaintenanceService(realmDB, authSessionDB, clientSessionDB, userDB, userAttributeDB, signingKeyDB, resetTokenDB, jobLockDB, schedules, time.Hour)
+	require.NoError(t, err)
+
+	return maintenanceService.(*maintenanceServiceImpl), userAttributeDB
+}
+
+func TestMaintenanceService_Schedules(t *testing.T) {
+	s, _ := setupMaintenanceTest(t, map[string]string{
+		MaintenanceJobExpiredAuthSessions: "30s",
+		MaintenanceJobStaleOtpState:       "disabled",
+	})
+
+	jobs := s.ListJobs()
+	require.Len(t, jobs, 7)
+
+	byName := map[string]services_interface.MaintenanceJobStatus{}
+	for _, job := range jobs {
+		byName[job.Name] = job
+	}
+
+	assert.Equal(t, "30s", byName[MaintenanceJobExpiredAuthSessions].Interval)
+	assert.True(t, byName[MaintenanceJobExpiredAuthSessions].Enabled)
+	assert.Equal(t, "1h0m0s", byName[MaintenanceJobExpiredClientSessions].Interval)
+	assert.False(t, byName[MaintenanceJobStaleOtpState].Enabled)
+	assert.False(t, byName[MaintenanceJobReencryptSecrets].Enabled)
+	assert.False(t, byName[MaintenanceJobLdapSync].Enabled)
+
+	_, err := NewMaintenanceService(nil, nil, nil, nil, nil, nil, nil, nil, map[string]string{"unknown_job": "1m"}, 0)
+	assert.ErrorContains(t, err, "unknown maintenance job")
+
+	_, err = NewMaintenanceService(nil, nil, nil, nil, nil, nil, nil, nil, map[string]string{MaintenanceJobExpiredAuthSessions: "often"}, 0)
+	assert.ErrorContains(t, err, "invalid schedule")
+}
+
+func TestMaintenanceService_ExpiredDeviceSessions(t *testing.T) {
+	ctx := context.Background()
+	s, userAttributeDB := setupMaintenanceTest(t, nil)
+	now := time.Now()
+
+	expiredDevice := &model.UserAttribute{
+		Type: model.AttributeTypeDevice,
+		Value: model.DeviceAttributeValue{
+			DeviceID:      "expired",
+			CookieExpires: now.Add(-time.Hour),
+		},
+	}
+	activeDevice := &model.UserAttribute{
+		Type: model.AttributeTypeDevice,
+		Value: model.DeviceAttributeValue{
+			DeviceID:      "active",
+			CookieExpires: now.Add(time.Hour),
+			SessionLoa0:   attributes.Session{SessionExpiry: now.Add(time.Hour)},
+			SessionLoa1:   &attributes.Session{SessionExpiry: now.Add(-time.Minute), LevelOfAssurance: 1},
+			SessionLoa2:   &attributes.Session{SessionExpiry: now.Add(time.Minute), LevelOfAssurance: 2},
+		},
+	}
+
+	user := &model.User{ID: "user-1", Tenant: "acme", Realm: "customers", Status: "active"}
+	user.AddAttribute(expiredDevice)
+	user.AddAttribute(activeDevice)
+	require.NoError(t, userAttributeDB.CreateUserWithAttributes(ctx, user))
+
+	status, err := s.RunJob(ctx, MaintenanceJobExpiredDeviceSessions)
+	require.NoError(t, err)
+	assert.Equal(t, services_interface.MaintenanceJobResultSuccess, status.LastResult)
+	assert.Equal(t, 2, status.LastAffected)
+	assert.NotNil(t, status.LastRun)
+
+	attrs, err := userAttributeDB.ListUserAttributesByType(ctx, "acme", "customers", model.AttributeTypeDevice, "", 100)
+	require.NoError(t, err)
+	require.Len(t, attrs, 1)
+
+	device, err := decodeAttributeValue[model.DeviceAttributeValue](attrs[0])
+	require.NoError(t, err)
+	assert.Equal(t, "active", device.DeviceID)
+	assert.Nil(t, device.SessionLoa1)
+	assert.NotNil(t, device.SessionLoa2)
+}
+
+func TestMaintenanceService_StaleOtpState(t *testing.T) {
+	ctx := context.Background()
+	s, userAttributeDB := setupMaintenanceTest(t, nil)
+
+	// Treat every attribute as stale
+	s.otpRetention = -time.Minute
+
+	user := &model.User{ID: "user-1", Tenant: "acme", Realm: "customers", Status: "active"}
+	user.AddAttribute(&model.UserAttribute{
+		Type:  model.AttributeTypeEmail,
+		Value: model.EmailAttributeValue{Email: "alice@example.com", OtpFailedAttempts: 2},
+	})
+	user.AddAttribute(&model.UserAttribute{
+		Type:  model.AttributeTypePhone,
+		Value: model.PhoneAttributeValue{Phone: "+41791234567", OtpFailedAttempts: 3},
+	})
+	user.AddAttribute(&model.UserAttribute{
+		Type:  model.AttributeTypeTOTP,
+		Value: model.TOTPAttributeValue{FailedAttempts: 5, Locked: true},
+	})
+	require.NoError(t, userAttributeDB.CreateUserWithAttributes(ctx, user))
+
+	status, err := s.RunJob(ctx, MaintenanceJobStaleOtpState)
+	require.NoError(t, err)
+	assert.Equal(t, services_interface.MaintenanceJobResultSuccess, status.LastResult)
+	assert.Equal(t, 2, status.LastAffected)
+
+	emails, err := userAttributeDB.ListUserAttributesByType(ctx, "acme", "customers", model.AttributeTypeEmail, "", 100)
+	require.NoError(t, err)
+	email, err := decodeAttributeValue[model.EmailAttributeValue](emails[0])
+	require.NoError(t, err)
+	assert.Equal(t, 0, email.OtpFailedAttempts)
+
+	phones, err := userAttributeDB.ListUserAttributesByType(ctx, "acme", "customers", model.AttributeTypePhone, "", 100)
+	require.NoError(t, err)
+	phone, err := decodeAttributeValue[model.PhoneAttributeValue](phones[0])
+	require.NoError(t, err)
+	assert.Equal(t, 0, phone.OtpFailedAttempts)
+
+	// Locked attributes are left for an administrator
+	totps, err := userAttributeDB.ListUserAttributesByType(ctx, "acme", "customers", model.AttributeTypeTOTP, "", 100)
+	require.NoError(t, err)
+	totp, err := decodeAttributeValue[model.TOTPAttributeValue](totps[0])
+	require.NoError(t, err)
+	assert.Equal(t, 5, totp.FailedAttempts)
+	assert.True(t, totp.Locked)
+}
+
+func TestMaintenanceService_SkipsUndecodableAttributes(t *testing.T) {
+	ctx := context.Background()
+	s, userAttributeDB := setupMaintenanceTest(t, nil)
+	s.otpRetention = -time.Minute
+
+	user := &model.User{ID: "user-1", Tenant: "acme", Realm: "customers", Status: "active"}
+	user.AddAttribute(&model.UserAttribute{
+		Type:  model.AttributeTypeEmail,
+		Value: "not an email attribute",
+	})
+	user.AddAttribute(&model.UserAttribute{
+		Type:  model.AttributeTypeEmail,
+		Value: model.EmailAttributeValue{Email: "alice@example.com", OtpFailedAttempts: 2},
+	})
+	require.NoError(t, userAttributeDB.CreateUserWithAttributes(ctx, user))
+
+	// The broken attribute is logged and skipped, the other one is still reset
+	status, err := s.RunJob(ctx, MaintenanceJobStaleOtpState)
+	require.NoError(t, err)
+	assert.Equal(t, services_interface.MaintenanceJobResultSuccess, status.LastResult)
+	assert.Equal(t, 1, status.LastAffected)
+}
+
+func TestMaintenanceService_ExpiredAuthSessions(t *testing.T) {
+	ctx := context.Background()
+	s, _ := setupMaintenanceTest(t, nil)
+
+	for _, expiresAt := range []time.Time{time.Now().Add(-time.Hour), time.Now().Add(time.Hour)} {
+		require.NoError(t, s.authSessionDB.CreateOrUpdateAuthSession(ctx, &model.PersistentAuthSession{
+			Tenant:             "acme",
+			Realm:              "customers",
+			RunID:              expiresAt.String(),
+			SessionIDHash:      expiresAt.String(),
+			CreatedAt:          time.Now().Add(-2 * time.Hour),
+			ExpiresAt:          expiresAt,
+			SessionInformation: []byte(`{}`),
+		}))
+	}
+
+	status, err := s.RunJob(ctx, MaintenanceJobExpiredAuthSessions)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status.LastAffected)
+}
+
+func TestMaintenanceService_SkipsJobLockedByOtherInstance(t *testing.T) {
+	ctx := context.Background()
+	s, _ := setupMaintenanceTest(t, nil)
+
+	// Simulate another instance holding the lock while this instance runs the job
+	_, err := s.jobLockDB.RunWithLock(ctx, "goam_maintenance_"+MaintenanceJobExpiredAuthSessions, func(ctx context.Context) error {
+		status, err := s.RunJob(ctx, MaintenanceJobExpiredAuthSessions)
+		require.NoError(t, err)
+		assert.Equal(t, services_interface.MaintenanceJobResultSkipped, status.LastResult)
+		return nil
+	})
+	require.NoError(t, err)
+
+	status, err := s.RunJob(ctx, MaintenanceJobExpiredAuthSessions)
+	require.NoError(t, err)
+	assert.Equal(t, services_interface.MaintenanceJobResultSuccess, status.LastResult)
+
+	_, err = s.RunJob(ctx, "unknown_job")
+	assert.ErrorIs(t, err, ErrMaintenanceJobNotFound)
+}
+
+func TestMaintenanceService_ExpiredPasswordResetTokens(t *testing.T) {
+	ctx := context.Background()
+	s, _ := setupMaintenanceTest(t, nil)
+
+	// Expired recently, still needed for the rate limit
+	require.NoError(t, s.resetTokenDB.CreatePasswordResetToken(ctx, &model.PasswordResetToken{
+		ID: "recent", Tenant: "acme", Realm: "customers", TokenHash: "recent", IdentifierHash: "alice",
+		Channel: model.PasswordResetChannelEmail, ExpiresAt: time.Now().Add(-time.Minute),
+	}))
+	require.NoError(t, s.resetTokenDB.CreatePasswordResetToken(ctx, &model.PasswordResetToken{
+		ID: "old", Tenant: "acme", Realm: "customers", TokenHash: "old", IdentifierHash: "alice",
+		Channel: model.PasswordResetChannelEmail, ExpiresAt: time.Now().Add(-2 * maxPasswordResetWindow),
+	}))
+
+	status, err := s.RunJob(ctx, MaintenanceJobExpiredPasswordResets)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status.LastAffected)
+
+	token, err := s.resetTokenDB.GetPasswordResetTokenByHash(ctx, "acme", "customers", "recent")
+	require.NoError(t, err)
+	assert.NotNil(t, token)
+}
+
+func TestMaintenanceService_LdapSync(t *testing.T) {
+	ctx := context.Background()
+	s, userAttributeDB := setupMaintenanceTest(t, nil)
+
+	server := ldaptest.NewServer(t)
+	server.AddEntry("cn=goam,ou=services,dc=example,dc=com", "service-secret", map[string][]string{"cn": {"goam"}})
+	server.AddEntry("uid=jane,ou=people,dc=example,dc=com", "jane-secret", map[string][]string{
+		"objectClass": {"inetOrgPerson", "person"},
+		"uid":         {"jane"},
+		"entryUUID":   {"7b1e4f0c-8f55-4d42-a3c5-3c1f3d5e9a10"},
+		"mail":        {"jane@example.com"},
+	})
+	server.AddEntry("cn=staff,ou=groups,dc=example,dc=com", "", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"staff"},
+		"member":      {"uid=jane,ou=people,dc=example,dc=com"},
+	})
+
+	// Realms without ldap_sync are skipped
+	status, err := s.RunJob(ctx, MaintenanceJobLdapSync)
+	require.NoError(t, err)
+	assert.Equal(t, services_interface.MaintenanceJobResultSuccess, status.LastResult)
+	assert.Equal(t, 0, status.LastAffected)
+
+	require.NoError(t, s.realmDB.UpdateRealm(ctx, &model.Realm{Tenant: "acme", Realm: "customers", RealmSettings: map[string]string{
+		ldap.SettingUrl:           server.URL,
+		ldap.SettingCaCertificate: server.CertificatePEM(),
+		ldap.SettingBindDn:        "cn=goam,ou=services,dc=example,dc=com",
+		ldap.SettingBindPassword:  "service-secret",
+		ldap.SettingBaseDn:        "dc=example,dc=com",
+		ldap.SettingSync:          "true",
+	}}))
+
+	entitlements := func() []model.Entitlement {
+		attrs, err := userAttributeDB.ListUserAttributesByType(ctx, "acme", "customers", model.AttributeTypeEntitlements, "", 100)
+		require.NoError(t, err)
+		require.Len(t, attrs, 1)
+		value, err := decodeAttributeValue[model.EntitlementSetAttributeValue](attrs[0])
+		require.NoError(t, err)
+		return value.Entitlements
+	}
+
+	status, err = s.RunJob(ctx, MaintenanceJobLdapSync)
+	require.NoError(t, err)
+	assert.Equal(t, services_interface.MaintenanceJobResultSuccess, status.LastResult)
+	assert.Equal(t, 1, status.LastAffected)
+
+	users, err := userAttributeDB.ListUserAttributesByType(ctx, "acme", "customers", model.AttributeTypeLdap, "", 100)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	require.Len(t, entitlements(), 1)
+	assert.Equal(t, "group:staff", entitlements()[0].Resource)
+
+	// Nothing changed in the directory
+	status, err = s.RunJob(ctx, MaintenanceJobLdapSync)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status.LastAffected)
+
+	// Users removed from the directory keep their account but lose their groups
+	server.RemoveEntry("uid=jane,ou=people,dc=example,dc=com")
+	status, err = s.RunJob(ctx, MaintenanceJobLdapSync)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status.LastAffected)
+	assert.Empty(t, entitlements())
+
+	users, err = userAttributeDB.ListUserAttributesByType(ctx, "acme", "customers", model.AttributeTypeLdap, "", 100)
+	require.NoError(t, err)
+	assert.Len(t, users, 1)
+}
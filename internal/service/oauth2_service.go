@@ -123,6 +123,14 @@ func (s *OAuth2Service) FinishOauth2AuthorizationEndpoint(session *model.Authent
 		return nil, oauth2.NewOAuth2Error(oauth2.ErrorServerError, "Internal server error. No user found in result")
 	}
 
+	// If the flow stepped up a device session we raise the level of assurance of the device
+	if session.Oauth2SessionInformation.StepUpDevice != "" {
+		err := s.raiseStepUpDevice(tenant, realm, session)
+		if err != nil {
+			return nil, oauth2.NewOAuth2Error(oauth2.ErrorServerError, "Internal server error. Could not update device session")
+		}
+	}
+
 	// The the login graph does not set an auth_time we assume the user was authenticated as of now
 	// If a session etc is used the graph needs to set the auth_time
 	if session.Oauth2SessionInformation.AuthTime.IsZero() {
@@ -402,9 +410,16 @@ func (s *OAuth2Service) generateIdToken(session *model.ClientSession, loginSessi
 		otherClaims["nonce"] = loginSession.Oauth2SessionInformation.AuthorizeRequest.Nonce
 	}
 
-	// if we have a auth_time in the login session we add it to the claims
-	if loginSession.Result.AuthLevel != "" {
-		otherClaims["acr"] = loginSession.Result.AuthLevel
+	// The acr of the acr mapping is only claimed if the flow reached its level of assurance
+	if acr := acrClaim(loginSession, application); acr != "" {
+		otherClaims["acr"] = acr
+	} else {
+		delete(otherClaims, "acr")
+	}
+
+	// The amr lists the methods the flow verified the user with
+	if amr := amrClaim(loginSession); amr != nil {
+		otherClaims["amr"] = amr
 	}
 
 	jwtUserClaims := make(map[string]interface{})
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/Identityplane/GoAM/pkg/model/attributes"
+)
+
+// DEFAULT_STEP_UP_DEVICE_COOKIE is the device cookie that is used if the acr mapping does not name one, it is the
+// default cookie of the device nodes
+const DEFAULT_STEP_UP_DEVICE_COOKIE = "device"
+
+// GetStepUpDevice returns the user and the device of the device cookie if the authorize request can step up the
+// device session to the level of the acr mapping. It returns nil if the user needs to run the complete flow of the
+// mapping, e.g. because the device is unknown, the session expired or the request has prompt=login.
+func (s *OAuth2Service) GetStepUpDevice(tenant, realm, deviceCookie string, mapping *model.AcrMapping, oauth2request *model.AuthorizeRequest) (*model.User, *model.DeviceAttributeValue, error) {
+	if mapping == nil || mapping.StepUpFlow == "" || mapping.Loa == 0 || deviceCookie == "" {
+		return nil, nil, nil
+	}
+
+	loadedRealm, ok := GetServices().RealmService.GetRealm(tenant, realm)
+	if !ok {
+		return nil, nil, fmt.Errorf("realm not found")
+	}
+
+	deviceHash := lib.HashString(deviceCookie)
+	user, err := loadedRealm.Repositories.UserRepo.GetByAttributeIndex(context.Background(), model.AttributeTypeDevice, deviceHash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load user of device: %w", err)
+	}
+	if user == nil {
+		return nil, nil, nil
+	}
+
+	device, _ := findDevice(user, func(attribute *model.UserAttribute, _ *model.DeviceAttributeValue) bool {
+		return attribute.Index != nil && *attribute.Index == deviceHash
+	})
+	if device == nil || !canStepUp(user, device, mapping, oauth2request, time.Now()) {
+		return nil, nil, nil
+	}
+
+	return user, device, nil
+}
+
+// canStepUp checks if the device session of the user is a first factor the step up flow can build on
+func canStepUp(user *model.User, device *model.DeviceAttributeValue, mapping *model.AcrMapping, oauth2request *model.AuthorizeRequest, now time.Time) bool {
+
+	// Locked and disabled users are not logged in, the complete flow handles them
+	if user.Status == "locked" || user.Status == "disabled" {
+		return false
+	}
+
+	// prompt=login asks for a new login with all factors
+	if oauth2request.Prompt == "login" {
+		return false
+	}
+
+	// The device needs an active session that verified the user, but below the requested level
+	loa := device.CurrentLoa(now)
+	if loa < 1 || loa >= mapping.Loa {
+		return false
+	}
+
+	session := device.CurrentSession(now)
+	if len(session.AuthMethods) == 0 {
+		return false
+	}
+
+	// If the session is older than max_age the user needs to log in again
+	if oauth2request.MaxAge != nil && session.FirstLoginTime.Before(now.Add(-time.Duration(*oauth2request.MaxAge)*time.Second)) {
+		return false
+	}
+
+	return true
+}
+
+// raiseStepUpDevice raises the level of assurance of the device session the flow stepped up to the level the flow
+// reached, so that later authorize requests for the acr do not need to step up again
+func (s *OAuth2Service) raiseStepUpDevice(tenant, realm string, session *model.AuthenticationSession) error {
+	loa, err := strconv.Atoi(string(session.Result.AuthLevel))
+	if err != nil || loa == 0 {
+		return nil
+	}
+
+	loadedRealm, ok := GetServices().RealmService.GetRealm(tenant, realm)
+	if !ok {
+		return fmt.Errorf("realm not found")
+	}
+
+	ctx := context.Background()
+	user, err := loadedRealm.Repositories.UserRepo.GetByID(ctx, session.Result.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+	if user == nil {
+		return nil
+	}
+
+	// The device must belong to the user the flow authenticated
+	deviceId := session.Oauth2SessionInformation.StepUpDevice
+	device, attribute := findDevice(user, func(_ *model.UserAttribute, device *model.DeviceAttributeValue) bool {
+		return device.DeviceID == deviceId
+	})
+	if device == nil {
+		return nil
+	}
+
+	now := time.Now()
+	if device.CurrentLoa(now) >= loa {
+		return nil
+	}
+
+	var methods []string
+	if session.AuthMethodsUserID == user.ID {
+		methods = slices.Clone(session.AuthMethods)
+	}
+	device.RaiseLoa(now, loa, methods, attributes.DEFAULT_LOA_TO_EXPIRY_MAPPINGS)
+
+	attribute.Value = device
+	attribute.UpdatedAt = now
+	return loadedRealm.Repositories.UserRepo.UpdateUserAttribute(ctx, attribute)
+}
+
+// findDevice returns the first device attribute of the user that matches
+func findDevice(user *model.User, match func(*model.UserAttribute, *model.DeviceAttributeValue) bool) (*model.DeviceAttributeValue, *model.UserAttribute) {
+	devices, deviceAttributes, err := model.GetAttributes[model.DeviceAttributeValue](user, model.AttributeTypeDevice)
+	if err != nil {
+		return nil, nil
+	}
+	for i := range devices {
+		if match(deviceAttributes[i], &devices[i]) {
+			return &devices[i], deviceAttributes[i]
+		}
+	}
+	return nil, nil
+}
+
+// acrClaim returns the acr of the id token. The acr of the mapping is only claimed if the flow reached the level of
+// assurance of the mapping, otherwise the level the flow reached is claimed. If the flow recorded no methods it did
+// not prove any level and no acr that requires one is claimed.
+func acrClaim(loginSession *model.AuthenticationSession, application *model.Application) string {
+	acr := loginSession.Oauth2SessionInformation.Acr
+	authLevel := string(loginSession.Result.AuthLevel)
+	mapping := application.GetAcrMapping(acr)
+
+	if authLevel == "" {
+		if mapping != nil && mapping.Loa > 0 {
+			return ""
+		}
+		return acr
+	}
+
+	if mapping == nil {
+		return authLevel
+	}
+	if mapping.Loa == 0 {
+		return acr
+	}
+
+	loa, err := strconv.Atoi(authLevel)
+	if err != nil || loa < mapping.Loa {
+		return authLevel
+	}
+	return acr
+}
+
+// amrClaim returns the amr of the id token, the methods the flow verified the user with
+func amrClaim(loginSession *model.AuthenticationSession) []string {
+	if loginSession.User == nil || loginSession.AuthMethodsUserID != loginSession.User.ID || len(loginSession.AuthMethods) == 0 {
+		return nil
+	}
+
+	amr := slices.Clone(loginSession.AuthMethods)
+	if model.AuthLevelOf(amr) == model.AuthLevel2FA {
+		amr = append(amr, "mfa")
+	}
+	return amr
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/Identityplane/GoAM/pkg/model/attributes"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStepUpTestDevice(now time.Time, loa int, methods []string) *model.DeviceAttributeValue {
+	device := &model.DeviceAttributeValue{
+		DeviceID:    "device-1",
+		SessionLoa0: *attributes.InitSession(now, attributes.DEFAULT_LOA_TO_EXPIRY_MAPPINGS[0]),
+	}
+	device.RaiseLoa(now, loa, methods, attributes.DEFAULT_LOA_TO_EXPIRY_MAPPINGS)
+	return device
+}
+
+func TestCanStepUp(t *testing.T) {
+	now := time.Now()
+	mapping := &model.AcrMapping{Acr: "urn:mfa", Flow: "login_mfa", Loa: 2, StepUpFlow: "step_up_mfa"}
+	user := &model.User{ID: "user-1", Status: "active"}
+	maxAge := 60
+
+	tests := []struct {
+		name    string
+		user    *model.User
+		device  *model.DeviceAttributeValue
+		request *model.AuthorizeRequest
+		want    bool
+	}{
+		{"loa1 session", user, newStepUpTestDevice(now, 1, []string{"pwd"}), &model.AuthorizeRequest{}, true},
+		{"loa0 session", user, newStepUpTestDevice(now, 0, nil), &model.AuthorizeRequest{}, false},
+		{"already loa2", user, newStepUpTestDevice(now, 2, []string{"pwd", "otp"}), &model.AuthorizeRequest{}, false},
+		{"no verified methods", user, newStepUpTestDevice(now, 1, nil), &model.AuthorizeRequest{}, false},
+		{"prompt login", user, newStepUpTestDevice(now, 1, []string{"pwd"}), &model.AuthorizeRequest{Prompt: "login"}, false},
+		{"max age exceeded", user, newStepUpTestDevice(now.Add(-2*time.Minute), 1, []string{"pwd"}), &model.AuthorizeRequest{MaxAge: &maxAge}, false},
+		{"max age not exceeded", user, newStepUpTestDevice(now, 1, []string{"pwd"}), &model.AuthorizeRequest{MaxAge: &maxAge}, true},
+		{"locked user", &model.User{ID: "user-1", Status: "locked"}, newStepUpTestDevice(now, 1, []string{"pwd"}), &model.AuthorizeRequest{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, canStepUp(tt.user, tt.device, mapping, tt.request, now))
+		})
+	}
+}
+
+func TestDeviceRaiseLoa(t *testing.T) {
+	now := time.Now()
+	device := newStepUpTestDevice(now, 1, []string{"pwd"})
+	firstLogin := device.SessionLoa1.FirstLoginTime
+
+	later := now.Add(time.Minute)
+	device.RaiseLoa(later, 2, []string{"pwd", "otp"}, attributes.DEFAULT_LOA_TO_EXPIRY_MAPPINGS)
+
+	// The active LOA1 session is kept, the LOA2 session is started
+	assert.Equal(t, 2, device.CurrentLoa(later))
+	assert.Equal(t, firstLogin, device.SessionLoa1.FirstLoginTime)
+	assert.Equal(t, []string{"pwd"}, device.SessionLoa1.AuthMethods)
+	assert.Equal(t, []string{"pwd", "otp"}, device.CurrentSession(later).AuthMethods)
+
+	// The LOA2 session expires after five minutes and the device falls back to LOA1
+	assert.Equal(t, 1, device.CurrentLoa(later.Add(10*time.Minute)))
+}
+
+func TestAcrAndAmrClaims(t *testing.T) {
+	application := &model.Application{
+		Settings: &model.ApplicationExtensionSettings{
+			ArcMapping: []model.AcrMapping{
+				{Acr: "urn:mfa", Flow: "login_mfa", Loa: 2, StepUpFlow: "step_up_mfa"},
+				{Acr: "urn:basic", Flow: "login"},
+			},
+		},
+	}
+
+	newSession := func(acr string, methods ...string) *model.AuthenticationSession {
+		session := &model.AuthenticationSession{
+			User:                     &model.User{ID: "user-1"},
+			Oauth2SessionInformation: &model.Oauth2Session{Acr: acr},
+		}
+		for _, method := range methods {
+			session.AddAuthMethod(method)
+		}
+		session.Result = &model.FlowResult{UserID: "user-1", AuthLevel: session.AuthLevel("user-1")}
+		return session
+	}
+
+	// The acr is claimed if the flow reached the level of the mapping
+	session := newSession("urn:mfa", model.AuthMethodPassword, model.AuthMethodOtp)
+	assert.Equal(t, "urn:mfa", acrClaim(session, application))
+	assert.Equal(t, []string{"pwd", "otp", "mfa"}, amrClaim(session))
+
+	// A code sent by sms or a passkey is a possession factor as well
+	session = newSession("urn:mfa", model.AuthMethodPassword, model.AuthMethodSms)
+	assert.Equal(t, "urn:mfa", acrClaim(session, application))
+	assert.Equal(t, []string{"pwd", "sms", "mfa"}, amrClaim(session))
+	assert.Equal(t, []string{"swk"}, amrClaim(newSession("urn:mfa", model.AuthMethodSoftwareKey)))
+
+	// Otherwise the level of the flow is claimed
+	session = newSession("urn:mfa", model.AuthMethodPassword)
+	assert.Equal(t, "1", acrClaim(session, application))
+	assert.Equal(t, []string{"pwd"}, amrClaim(session))
+
+	// Mappings without a level of assurance are always claimed
+	session = newSession("urn:basic", model.AuthMethodPassword)
+	assert.Equal(t, "urn:basic", acrClaim(session, application))
+
+	// Without an acr the level of the flow is claimed, and nothing without verified methods
+	assert.Equal(t, "1", acrClaim(newSession("", model.AuthMethodPassword), application))
+	assert.Equal(t, "", acrClaim(newSession(""), application))
+
+	// A flow without verified methods did not prove the level of a mapping
+	assert.Equal(t, "", acrClaim(newSession("urn:mfa"), application))
+	assert.Equal(t, "urn:basic", acrClaim(newSession("urn:basic"), application))
+	assert.Nil(t, amrClaim(newSession("")))
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/pkg/db"
+	"github.com/Identityplane/GoAM/pkg/model"
+	services_interface "github.com/Identityplane/GoAM/pkg/services"
+	"github.com/google/uuid"
+)
+
+// passwordResetTokenBytes is the amount of randomness in a reset token
+const passwordResetTokenBytes = 32
+
+// maxPasswordResetWindow is how long expired reset tokens are kept, rate limit windows longer than this
+// do not see older requests
+const maxPasswordResetWindow = 24 * time.Hour
+
+// passwordResetServiceImpl implements PasswordResetService on top of the password reset token store.
+// Tokens, identifiers and ips are only stored as hashes or as given, the token itself is never stored.
+type passwordResetServiceImpl struct {
+	tokenDB db.PasswordResetTokenDB
+}
+
+// NewPasswordResetService creates a new PasswordResetService
+func NewPasswordResetService(tokenDB db.PasswordResetTokenDB) services_interface.PasswordResetService {
+	return &passwordResetServiceImpl{
+		tokenDB: tokenDB,
+	}
+}
+
+func (s *passwordResetServiceImpl) CreateResetToken(ctx context.Context, tenant, realm string, request *model.PasswordResetRequest) (string, error) {
+
+	randomBytes, err := lib.GenerateRandomBytes(passwordResetTokenBytes)
+	if err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(randomBytes)
+
+	resetToken := &model.PasswordResetToken{
+		ID:             uuid.NewString(),
+		Tenant:         tenant,
+		Realm:          realm,
+		TokenHash:      lib.HashString(token),
+		UserID:         request.UserID,
+		IdentifierHash: hashResetIdentifier(request.Identifier),
+		RequestIP:      request.RequestIP,
+		Channel:        request.Channel,
+		ExpiresAt:      time.Now().Add(request.Lifetime),
+	}
+
+	if err := s.tokenDB.CreatePasswordResetToken(ctx, resetToken); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (s *passwordResetServiceImpl) CountResetRequests(ctx context.Context, tenant, realm, identifier, requestIP string, since time.Time) (int, int, error) {
+
+	byIdentifier, err := s.tokenDB.CountPasswordResetTokensByIdentifier(ctx, tenant, realm, hashResetIdentifier(identifier), since)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Requests without a known ip are only limited by identifier
+	byIP := 0
+	if requestIP != "" {
+		byIP, err = s.tokenDB.CountPasswordResetTokensByIP(ctx, tenant, realm, requestIP, since)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return byIdentifier, byIP, nil
+}
+
+func (s *passwordResetServiceImpl) ConsumeResetToken(ctx context.Context, tenant, realm, token string) (*model.PasswordResetToken, error) {
+
+	resetToken, err := s.getValidResetToken(ctx, tenant, realm, token)
+	if err != nil || resetToken == nil {
+		return nil, err
+	}
+
+	// Marking the token as used only succeeds once, even with concurrent requests
+	now := time.Now()
+	ok, err := s.tokenDB.MarkPasswordResetTokenUsed(ctx, tenant, realm, resetToken.TokenHash, now)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	resetToken.UsedAt = &now
+	return resetToken, nil
+}
+
+func (s *passwordResetServiceImpl) IsResetTokenValid(ctx context.Context, tenant, realm, token string) (bool, error) {
+
+	resetToken, err := s.getValidResetToken(ctx, tenant, realm, token)
+	if err != nil {
+		return false, err
+	}
+
+	return resetToken != nil, nil
+}
+
+// getValidResetToken returns the token if it exists, was issued for a user and is neither used nor expired
+func (s *passwordResetServiceImpl) getValidResetToken(ctx context.Context, tenant, realm, token string) (*model.PasswordResetToken, error) {
+
+	if token == "" {
+		return nil, nil
+	}
+
+	resetToken, err := s.tokenDB.GetPasswordResetTokenByHash(ctx, tenant, realm, lib.HashString(token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load password reset token: %w", err)
+	}
+
+	// Requests for unknown users never deliver their token, but they must not be usable either
+	if resetToken == nil || resetToken.UserID == "" || resetToken.UsedAt != nil || time.Now().After(resetToken.ExpiresAt) {
+		return nil, nil
+	}
+
+	return resetToken, nil
+}
+
+// hashResetIdentifier hashes the email address or phone number so that they are not stored in clear text
+func hashResetIdentifier(identifier string) string {
+	return lib.HashString(strings.ToLower(strings.TrimSpace(identifier)))
+}
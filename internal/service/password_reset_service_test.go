@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/db/sqlite_adapter"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordResetService_TokenLifecycle(t *testing.T) {
+	ctx := context.Background()
+
+	sqliteDB, err := sql.Open("sqlite", ":memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	defer sqliteDB.Close()
+	sqliteDB.SetMaxOpenConns(1)
+	require.NoError(t, sqlite_adapter.RunMigrations(sqliteDB))
+
+	tokenDB, err := sqlite_adapter.NewPasswordResetTokenDB(sqliteDB)
+	require.NoError(t, err)
+	svc := NewPasswordResetService(tokenDB)
+
+	token, err := svc.CreateResetToken(ctx, "acme", "customers", &model.PasswordResetRequest{
+		UserID:     "user-1",
+		Identifier: " Alice@Example.com",
+		RequestIP:  "10.0.0.1",
+		Channel:    model.PasswordResetChannelEmail,
+		Lifetime:   15 * time.Minute,
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+
+	// Requests for unknown users are counted but their token can never be used
+	unknownToken, err := svc.CreateResetToken(ctx, "acme", "customers", &model.PasswordResetRequest{
+		Identifier: "mallory@example.com",
+		RequestIP:  "10.0.0.1",
+		Channel:    model.PasswordResetChannelEmail,
+		Lifetime:   15 * time.Minute,
+	})
+	require.NoError(t, err)
+
+	byIdentifier, byIP, err := svc.CountResetRequests(ctx, "acme", "customers", "alice@example.com", "10.0.0.1", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, byIdentifier)
+	assert.Equal(t, 2, byIP)
+
+	resetToken, err := svc.ConsumeResetToken(ctx, "acme", "customers", unknownToken)
+	require.NoError(t, err)
+	assert.Nil(t, resetToken)
+
+	// Checking the token does not use it
+	valid, err := svc.IsResetTokenValid(ctx, "acme", "customers", unknownToken)
+	require.NoError(t, err)
+	assert.False(t, valid)
+
+	valid, err = svc.IsResetTokenValid(ctx, "acme", "customers", token)
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	resetToken, err = svc.ConsumeResetToken(ctx, "acme", "other", token)
+	require.NoError(t, err)
+	assert.Nil(t, resetToken)
+
+	resetToken, err = svc.ConsumeResetToken(ctx, "acme", "customers", token)
+	require.NoError(t, err)
+	require.NotNil(t, resetToken)
+	assert.Equal(t, "user-1", resetToken.UserID)
+
+	// Tokens are single-use
+	resetToken, err = svc.ConsumeResetToken(ctx, "acme", "customers", token)
+	require.NoError(t, err)
+	assert.Nil(t, resetToken)
+
+	valid, err = svc.IsResetTokenValid(ctx, "acme", "customers", token)
+	require.NoError(t, err)
+	assert.False(t, valid)
+}
+
+func TestPasswordResetService_ExpiredToken(t *testing.T) {
+	ctx := context.Background()
+
+	sqliteDB, err := sql.Open("sqlite", ":memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	defer sqliteDB.Close()
+	sqliteDB.SetMaxOpenConns(1)
+	require.NoError(t, sqlite_adapter.RunMigrations(sqliteDB))
+
+	tokenDB, err := sqlite_adapter.NewPasswordResetTokenDB(sqliteDB)
+	require.NoError(t, err)
+	svc := NewPasswordResetService(tokenDB)
+
+	token, err := svc.CreateResetToken(ctx, "acme", "customers", &model.PasswordResetRequest{
+		UserID:     "user-1",
+		Identifier: "alice@example.com",
+		Channel:    model.PasswordResetChannelEmail,
+		Lifetime:   -time.Minute,
+	})
+	require.NoError(t, err)
+
+	resetToken, err := svc.ConsumeResetToken(ctx, "acme", "customers", token)
+	require.NoError(t, err)
+	assert.Nil(t, resetToken)
+}
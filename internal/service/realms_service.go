@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/Identityplane/GoAM/internal/auth/repository"
+	"github.com/Identityplane/GoAM/internal/config"
 	"github.com/Identityplane/GoAM/internal/logger"
 	"github.com/Identityplane/GoAM/pkg/db"
 	"github.com/Identityplane/GoAM/pkg/model"
@@ -63,15 +64,8 @@ func (s *realmServiceImpl) GetRealm(tenant, realm string) (*services_interface.L
 	}
 
 	// Load the realm with repo
-	userRepo := repository.NewUserRepository(tenant, realm, s.userDb, s.userAttributeDb)
-	emailService := services.EmailService
-	emailSender := repository.NewEmailSender(tenant, realm, emailService)
-
-	repos := &model.Repositories{
-		UserRepo:    userRepo,
-		EmailSender: emailSender,
-	}
-	loadedRealm := NewLoadedRealm(realmConfig, *repos)
+	repos := s.newRepositories(realmConfig)
+	loadedRealm := NewLoadedRealm(realmConfig, repos)
 
 	return loadedRealm, true
 }
@@ -89,13 +83,8 @@ func (s *realmServiceImpl) GetAllRealms() (map[string]*services_interface.Loaded
 	for _, realmConfig := range realmConfigs {
 
 		// Load the realm with repo
-		userRepo := repository.NewUserRepository(realmConfig.Tenant, realmConfig.Realm, s.userDb, s.userAttributeDb)
-		emailSender := repository.NewEmailSender(realmConfig.Tenant, realmConfig.Realm, services.EmailService)
-		repos := &model.Repositories{
-			UserRepo:    userRepo,
-			EmailSender: emailSender,
-		}
-		loadedRealm := NewLoadedRealm(&realmConfig, *repos)
+		repos := s.newRepositories(&realmConfig)
+		loadedRealm := NewLoadedRealm(&realmConfig, repos)
 
 		loadedRealms[loadedRealm.RealmID] = loadedRealm
 	}
@@ -178,3 +167,49 @@ func (s *realmServiceImpl) IsTenantNameAvailable(tenantName string) (bool, error
 
 	return isAvailable, nil
 }
+
+// HTTPAllowPrivateNetworksSetting is the node setting of the server that allows nodes to call services in private
+// networks. It is only read from the server settings, realm settings cannot enable it.
+const HTTPAllowPrivateNetworksSetting = "http_allow_private_networks"
+
+// newRepositories creates the services for the nodes of the realm
+func (s *realmServiceImpl) newRepositories(realmConfig *model.Realm) model.Repositories {
+	tenant, realm := realmConfig.Tenant, realmConfig.Realm
+
+	repositories := model.Repositories{
+		Version:           model.RepositoriesVersion,
+		UserRepo:          repository.NewUserRepository(tenant, realm, s.userDb, s.userAttributeDb),
+		EmailSender:       repository.NewEmailSender(tenant, realm, services.EmailService),
+		SMSSender:         repository.NewSMSSender(tenant, realm, services.SMSService),
+		PasswordResetRepo: repository.NewPasswordResetRepository(tenant, realm, services.PasswordResetService, services.SessionsService),
+		Secrets:           repository.NewSecretStore(tenant, realm, extensionSettings()),
+		Cache:             repository.NewCache(tenant, realm, services.CacheService),
+		HTTPClient:        repository.NewHTTPClient(nodeSettings()[HTTPAllowPrivateNetworksSetting] == "true"),
+		JWT:               repository.NewJWTSigner(tenant, realm, services.JWTService),
+		Audit:             repository.NewAuditLogger(tenant, realm),
+		Settings:          repository.NewSettingsReader(realmConfig.RealmSettings, nodeSettings()),
+		MagicLinks:        repository.NewMagicLinkRepository(tenant, realm, services.SessionsService),
+	}
+
+	if services.FlowAnalyticsService != nil {
+		repositories.Analytics = repository.NewFlowAnalytics(tenant, realm, services.FlowAnalyticsService)
+	}
+
+	return repositories
+}
+
+// extensionSettings returns the extension settings of the server, they provide the secrets of the nodes
+func extensionSettings() map[string]string {
+	if config.ServerSettings == nil {
+		return nil
+	}
+	return config.ServerSettings.ExtensionSettings
+}
+
+// nodeSettings returns the node settings of the server, which apply to all realms
+func nodeSettings() map[string]string {
+	if config.ServerSettings == nil {
+		return nil
+	}
+	return config.ServerSettings.NodeSettings
+}
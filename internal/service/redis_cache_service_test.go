@@ -0,0 +1,174 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	services_interface "github.com/Identityplane/GoAM/pkg/services"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedisCache(t *testing.T, mr *miniredis.Miniredis, localTier bool) *redisCacheServiceImpl {
+	cache, err := NewRedisCacheService("redis://"+mr.Addr(), localTier)
+	require.NoError(t, err)
+
+	impl := cache.(*redisCacheServiceImpl)
+	t.Cleanup(func() { impl.Close() })
+	return impl
+}
+
+func TestRedisCacheService(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	t.Run("Get non-existing key", func(t *testing.T) {
+		cache := newTestRedisCache(t, mr, false)
+
+		value, exists := cache.Get("non-existing-key")
+		assert.False(t, exists)
+		assert.Nil(t, value)
+	})
+
+	t.Run("Values are shared between instances", func(t *testing.T) {
+		cacheA := newTestRedisCache(t, mr, false)
+		cacheB := newTestRedisCache(t, mr, false)
+
+		flow := &model.Flow{
+			Tenant:         "acme",
+			Realm:          "customers",
+			Id:             "login",
+			Route:          "/login",
+			Active:         true,
+			DefinitionYaml: "start: init",
+			Definition: &model.FlowDefinition{
+				Start: "init",
+				Nodes: map[string]*model.GraphNode{
+					"init": {Name: "init", Use: "init", Next: map[string]string{"start": "done"}},
+				},
+			},
+		}
+
+		err := cacheA.Cache("/acme/customers/flow/id/login", flow, time.Minute, 1)
+		require.NoError(t, err)
+
+		value, exists := cacheB.Get("/acme/customers/flow/id/login")
+		require.True(t, exists)
+
+		cachedFlow, ok := value.(*model.Flow)
+		require.True(t, ok)
+		assert.Equal(t, "/login", cachedFlow.Route)
+		assert.Equal(t, "start: init", cachedFlow.DefinitionYaml)
+		require.NotNil(t, cachedFlow.Definition)
+		assert.Equal(t, "done", cachedFlow.Definition.Nodes["init"].Next["start"])
+	})
+
+	t.Run("Serialization keeps fields hidden from json", func(t *testing.T) {
+		cache := newTestRedisCache(t, mr, false)
+
+		err := cache.Cache("client-session", &model.ClientSession{ClientSessionID: "cs1", AccessTokenHash: "hash"}, time.Minute, 1)
+		require.NoError(t, err)
+		err = cache.Cache("application", &model.Application{ClientId: "app", ClientSecret: "secret"}, time.Minute, 1)
+		require.NoError(t, err)
+
+		value, exists := cache.Get("client-session")
+		require.True(t, exists)
+		assert.Equal(t, "hash", value.(*model.ClientSession).AccessTokenHash)
+
+		value, exists = cache.Get("application")
+		require.True(t, exists)
+		assert.Equal(t, "secret", value.(*model.Application).ClientSecret)
+	})
+
+	t.Run("Non serializable values stay local", func(t *testing.T) {
+		cacheA := newTestRedisCache(t, mr, false)
+		cacheB := newTestRedisCache(t, mr, false)
+
+		realm := &services_interface.LoadedRealm{RealmID: "acme/customers"}
+		err := cacheA.Cache("/acme/customers/realm", realm, time.Minute, 1)
+		require.NoError(t, err)
+
+		value, exists := cacheA.Get("/acme/customers/realm")
+		require.True(t, exists)
+		assert.Same(t, realm, value)
+
+		_, exists = cacheB.Get("/acme/customers/realm")
+		assert.False(t, exists)
+		assert.False(t, mr.Exists(redisCacheKeyPrefix+"/acme/customers/realm"))
+	})
+
+	t.Run("Invalidate evicts the local tier of other instances", func(t *testing.T) {
+		cacheA := newTestRedisCache(t, mr, true)
+		cacheB := newTestRedisCache(t, mr, true)
+
+		err := cacheA.Cache("tiered-key", "v1", time.Minute, 1)
+		require.NoError(t, err)
+
+		// Load into the local tier of B
+		value, exists := cacheB.Get("tiered-key")
+		require.True(t, exists)
+		assert.Equal(t, "v1", value)
+		_, inLocalTier := cacheB.local.Get("tiered-key")
+		require.True(t, inLocalTier)
+
+		err = cacheA.Invalidate("tiered-key")
+		require.NoError(t, err)
+
+		assert.Eventually(t, func() bool {
+			_, exists := cacheB.Get("tiered-key")
+			return !exists
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Writes evict the local tier of other instances", func(t *testing.T) {
+		cacheA := newTestRedisCache(t, mr, true)
+		cacheB := newTestRedisCache(t, mr, true)
+
+		require.NoError(t, cacheA.Cache("session-key", "v1", time.Minute, 1))
+		value, _ := cacheB.Get("session-key")
+		assert.Equal(t, "v1", value)
+
+		require.NoError(t, cacheA.Cache("session-key", "v2", time.Minute, 1))
+
+		assert.Eventually(t, func() bool {
+			value, _ := cacheB.Get("session-key")
+			return value == "v2"
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Local tier expires values without ttl", func(t *testing.T) {
+		cache := newTestRedisCache(t, mr, true)
+
+		require.NoError(t, cache.Cache("no-ttl-key", "value", 0, 1))
+
+		ttl, found := cache.local.cache.GetTTL("no-ttl-key")
+		require.True(t, found)
+		assert.Greater(t, ttl, time.Duration(0))
+		assert.LessOrEqual(t, ttl, localTierMaxTTL)
+	})
+
+	t.Run("Redis TTL is applied", func(t *testing.T) {
+		cache := newTestRedisCache(t, mr, false)
+
+		require.NoError(t, cache.Cache("expiry-key", "value", time.Second, 1))
+		mr.FastForward(2 * time.Second)
+
+		_, exists := cache.Get("expiry-key")
+		assert.False(t, exists)
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		cache := newTestRedisCache(t, mr, false)
+
+		require.NoError(t, cache.Cache("metrics-key", "value", time.Minute, 1))
+		cache.Get("metrics-key")
+		cache.Get("missing-metrics-key")
+
+		metrics := cache.GetMetrics()
+		assert.Equal(t, uint64(1), metrics.Hits)
+		assert.Equal(t, uint64(1), metrics.Misses)
+		assert.Equal(t, uint64(1), metrics.KeysAdded)
+		assert.Equal(t, 0.5, metrics.Ratio)
+	})
+}
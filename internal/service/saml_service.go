@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/lib/saml"
+	"github.com/Identityplane/GoAM/pkg/db"
+	"github.com/Identityplane/GoAM/pkg/kms"
+	"github.com/Identityplane/GoAM/pkg/model"
+	services_interface "github.com/Identityplane/GoAM/pkg/services"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultSamlAssertionLifetime is the lifetime of an assertion if the application does not configure one
+	DefaultSamlAssertionLifetime = 5 * time.Minute
+
+	// samlAttributeScope are the scopes of the user claims that an attribute mapping can refer to
+	samlAttributeScope = "openid email profile"
+)
+
+// samlServiceImpl implements SamlService
+type samlServiceImpl struct {
+	signingKeyDB db.SigningKeyDB
+}
+
+// NewSamlService creates a new SamlService instance
+func NewSamlService(signingKeyDB db.SigningKeyDB) services_interface.SamlService {
+	return &samlServiceImpl{
+		signingKeyDB: signingKeyDB,
+	}
+}
+
+// SamlIdpEntityId returns the entity id of the identity provider of a realm, which is the URL of its metadata
+func SamlIdpEntityId(baseUrl string) string {
+	return baseUrl + "/saml/metadata"
+}
+
+// SamlSsoUrl returns the single sign-on endpoint of the identity provider of a realm for both bindings
+func SamlSsoUrl(baseUrl string) string {
+	return baseUrl + "/saml/sso"
+}
+
+func (s *samlServiceImpl) GetMetadata(ctx context.Context, tenant, realm, baseUrl string) (string, error) {
+	if _, err := s.getSigningKey(ctx, tenant, realm); err != nil {
+		return "", err
+	}
+
+	keys, err := s.signingKeyDB.ListActiveSigningKeys(ctx, tenant, realm)
+	if err != nil {
+		return "", fmt.Errorf("failed to list active keys: %w", err)
+	}
+
+	// All active keys are published so that a new key is trusted before it is used
+	var certificates [][]byte
+	for _, key := range keys {
+		if key.Algorithm != saml.SigningKeyAlgorithm {
+			continue
+		}
+		certificate, err := saml.ParseCertificate(key.PublicKeyJWK)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse certificate of key %s: %w", key.Kid, err)
+		}
+		certificates = append(certificates, certificate.Raw)
+	}
+
+	return saml.BuildMetadata(SamlIdpEntityId(baseUrl), SamlSsoUrl(baseUrl), certificates), nil
+}
+
+func (s *samlServiceImpl) GetServiceProvider(tenant, realm, entityId string) (*model.Application, bool) {
+	applications, err := GetServices().ApplicationService.ListApplications(tenant, realm)
+	if err != nil {
+		return nil, false
+	}
+
+	for i := range applications {
+		application := &applications[i]
+		if application.Type == model.ApplicationTypeSaml && application.Settings != nil && application.Settings.Saml != nil && application.Settings.Saml.EntityId == entityId {
+			return application, true
+		}
+	}
+
+	return nil, false
+}
+
+func (s *samlServiceImpl) CreateSamlSession(application *model.Application, requestId, acsUrl, nameIdFormat, relayState string) (*model.SamlSession, error) {
+	if application.Type != model.ApplicationTypeSaml || application.Settings == nil || application.Settings.Saml == nil {
+		return nil, fmt.Errorf("application %s is not a saml service provider", application.ClientId)
+	}
+	settings := application.Settings.Saml
+
+	if len(settings.AcsUrls) == 0 {
+		return nil, fmt.Errorf("service provider has no acs url")
+	}
+
+	// The response is only sent to a registered ACS URL
+	if acsUrl == "" {
+		acsUrl = settings.AcsUrls[0]
+	} else if !slices.Contains(settings.AcsUrls, acsUrl) {
+		return nil, fmt.Errorf("acs url %s is not registered for the service provider", acsUrl)
+	}
+
+	format, err := resolveNameIdFormat(settings.NameIdFormat, nameIdFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.SamlSession{
+		ClientID:     application.ClientId,
+		RequestID:    requestId,
+		AcsUrl:       acsUrl,
+		RelayState:   relayState,
+		NameIdFormat: format,
+	}, nil
+}
+
+// resolveNameIdFormat returns the NameID format of the response. The format of the application wins, a request can
+// only ask for a different format if the application does not configure one.
+func resolveNameIdFormat(configured, requested string) (string, error) {
+	if requested == "" || requested == saml.NameIdFormatUnspecified {
+		if configured != "" {
+			return configured, nil
+		}
+		return saml.NameIdFormatUnspecified, nil
+	}
+
+	if configured != "" && configured != requested {
+		return "", fmt.Errorf("requested NameID format %s does not match the format of the service provider", requested)
+	}
+	if !saml.IsSupportedNameIdFormat(requested) {
+		return "", fmt.Errorf("unsupported NameID format %s", requested)
+	}
+	return requested, nil
+}
+
+func (s *samlServiceImpl) CreateResponse(ctx context.Context, tenant, realm, baseUrl string, session *model.AuthenticationSession) (string, error) {
+	samlSession := session.SamlSessionInformation
+	if samlSession == nil {
+		return "", fmt.Errorf("no saml session information")
+	}
+
+	if session.Result == nil {
+		return "", fmt.Errorf("flow has no result")
+	}
+
+	if session.DidResultError() {
+		return "", fmt.Errorf("unexpected result node")
+	}
+
+	if !session.DidResultAuthenticated() {
+		return s.CreateErrorResponse(baseUrl, samlSession, saml.StatusResponder, saml.StatusAuthnFailed)
+	}
+
+	if session.User == nil {
+		return "", fmt.Errorf("no user found in result")
+	}
+
+	application, ok := GetServices().ApplicationService.GetApplication(tenant, realm, samlSession.ClientID)
+	if !ok || application.Settings == nil || application.Settings.Saml == nil {
+		return "", fmt.Errorf("service provider %s not found", samlSession.ClientID)
+	}
+	settings := application.Settings.Saml
+
+	nameId, err := samlNameId(session.User, samlSession.NameIdFormat)
+	if err != nil {
+		return "", err
+	}
+
+	attributes, err := samlAttributes(session.User, settings.AttributeMapping)
+	if err != nil {
+		return "", err
+	}
+
+	sessionIndex, err := saml.NewID()
+	if err != nil {
+		return "", err
+	}
+
+	key, err := s.getSigningKey(ctx, tenant, realm)
+	if err != nil {
+		return "", err
+	}
+
+	lifetime := DefaultSamlAssertionLifetime
+	if settings.AssertionLifetime > 0 {
+		lifetime = time.Duration(settings.AssertionLifetime) * time.Second
+	}
+
+	// If the flow does not set an auth time the user authenticated now
+	now := time.Now()
+	if samlSession.AuthTime.IsZero() {
+		samlSession.AuthTime = now
+	}
+
+	return saml.BuildResponse(&saml.Response{
+		Issuer:       SamlIdpEntityId(baseUrl),
+		Destination:  samlSession.AcsUrl,
+		InResponseTo: samlSession.RequestID,
+		Audience:     settings.EntityId,
+		NameId:       nameId,
+		NameIdFormat: samlSession.NameIdFormat,
+		SessionIndex: sessionIndex,
+		AuthnInstant: samlSession.AuthTime,
+		IssueInstant: now,
+		Lifetime:     lifetime,
+		Attributes:   attributes,
+	}, key)
+}
+
+func (s *samlServiceImpl) CreateErrorResponse(baseUrl string, samlSession *model.SamlSession, statusCode, subStatusCode string) (string, error) {
+	return saml.BuildErrorResponse(SamlIdpEntityId(baseUrl), samlSession.AcsUrl, samlSession.RequestID, statusCode, subStatusCode, time.Now())
+}
+
+// samlNameId returns the value of the NameID of the user in the format
+func samlNameId(user *model.User, format string) (string, error) {
+	switch format {
+	case saml.NameIdFormatEmail:
+		email, _, err := model.GetAttribute[model.EmailAttributeValue](user, model.AttributeTypeEmail)
+		if err != nil || email == nil || email.Email == "" {
+			return "", fmt.Errorf("user has no email address for the NameID")
+		}
+		return email.Email, nil
+
+	case saml.NameIdFormatTransient:
+		return saml.NewID()
+
+	default:
+		return user.ID, nil
+	}
+}
+
+// samlAttributes maps the claims of the user to the attributes of the assertion, claims the user does not have are omitted
+func samlAttributes(user *model.User, mapping map[string]string) (map[string][]string, error) {
+	if len(mapping) == 0 {
+		return nil, nil
+	}
+
+	claims, err := GetServices().UserClaimsService.GetUserClaims(*user, samlAttributeScope, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not get user claims: %w", err)
+	}
+
+	attributes := map[string][]string{}
+	for name, claim := range mapping {
+		value, ok := claims[claim]
+		if !ok || value == nil || value == "" {
+			continue
+		}
+		attributes[name] = []string{fmt.Sprint(value)}
+	}
+
+	return attributes, nil
+}
+
+// getSigningKey returns the active RSA key of the realm and creates one if the realm has none
+func (s *samlServiceImpl) getSigningKey(ctx context.Context, tenant, realm string) (*saml.SigningKey, error) {
+	keys, err := s.signingKeyDB.ListActiveSigningKeys(ctx, tenant, realm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active keys: %w", err)
+	}
+
+	for _, key := range keys {
+		if key.Algorithm == saml.SigningKeyAlgorithm {
+			return saml.ParseSigningKey(key.SigningKeyMaterial)
+		}
+	}
+
+	keyID := uuid.New().String()
+	privateKey, publicKey, err := saml.GenerateSigningKey(keyID, fmt.Sprintf("%s/%s", tenant, realm))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	signingKey := model.SigningKey{
+		Tenant:             tenant,
+		Realm:              realm,
+		Kid:                keyID,
+		Active:             true,
+		Algorithm:          saml.SigningKeyAlgorithm,
+		Implementation:     kms.PlainImplementation,
+		SigningKeyMaterial: privateKey,
+		PublicKeyJWK:       publicKey,
+		Created:            time.Now(),
+	}
+
+	if err := s.signingKeyDB.CreateSigningKey(ctx, signingKey); err != nil {
+		return nil, fmt.Errorf("failed to store key: %w", err)
+	}
+
+	return saml.ParseSigningKey(privateKey)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -11,12 +12,17 @@ import (
 	"github.com/Identityplane/GoAM/internal/lib"
 	"github.com/Identityplane/GoAM/internal/logger"
 	"github.com/Identityplane/GoAM/pkg/db"
+	"github.com/Identityplane/GoAM/pkg/kms"
 	"github.com/Identityplane/GoAM/pkg/model"
 	services_interface "github.com/Identityplane/GoAM/pkg/services"
 
 	"github.com/google/uuid"
 )
 
+// MaxListedAuthenticationSessions limits the sessions that ListAuthenticationSessions loads, so that the traffic of a
+// busy flow does not load all its sessions into memory
+const MaxListedAuthenticationSessions = 5000
+
 // RealTimeProvider implements TimeProvider using the system clock
 type RealTimeProvider struct{}
 
@@ -65,7 +71,7 @@ func (s *sessionsService) CreateAuthSessionObject(tenant, realm, flowId, loginUr
 		Prompts:                  make(map[string]string),
 		Oauth2SessionInformation: nil,
 		CreatedAt:                s.timeProvider.Now(),
-		ExpiresAt:                s.timeProvider.Now().Add(30 * time.Minute), // 30 minutes expiration TODO make this variable by realm
+		ExpiresAt:                s.timeProvider.Now().Add(model.AuthSessionLifetime), // TODO make this variable by realm
 		LoginUriBase:             loginUri,
 		LoginUriNext:             loginUri,
 	}
@@ -78,7 +84,10 @@ func (s *sessionsService) ResetAuthSessionObject(session *model.AuthenticationSe
 	session.History = append(session.History, "reset")
 	session.LoginUriNext = session.LoginUriBase
 	session.Context = make(map[string]string)
+	session.Subflows = nil
 	session.Error = nil
+	session.LastError = nil
+	session.Steps = nil
 	session.Result = nil
 	session.User = nil
 	session.Prompts = make(map[string]string)
@@ -88,6 +97,12 @@ func (s *sessionsService) ResetAuthSessionObject(session *model.AuthenticationSe
 
 // CreateOrUpdateAuthenticationSession creates a new authentication session or updates an existing one
 func (s *sessionsService) CreateOrUpdateAuthenticationSession(ctx context.Context, tenant, realm string, session model.AuthenticationSession) error {
+
+	// Secrets that need to survive until the next step are encrypted, the session is a copy of the caller's session
+	if err := encryptSessionSecrets(ctx, tenant, realm, session.SessionIdHash, &session); err != nil {
+		return err
+	}
+
 	persistentSession, err := model.NewPersistentAuthSession(tenant, realm, &session)
 	if err != nil {
 		return fmt.Errorf("failed to create persistent session: %w", err)
@@ -132,14 +147,126 @@ func (s *sessionsService) GetAuthenticationSession(ctx context.Context, tenant,
 		return nil, false
 	}
 
+	if err := decryptSessionSecrets(ctx, tenant, realm, sessionIDHash, session); err != nil {
+		log := logger.GetGoamLogger()
+		log.Error().Err(err).Msg("failed to decrypt auth session")
+		return nil, false
+	}
+
 	return session, true
 }
 
+// ListAuthenticationSessions returns the sessions of a flow created since the given time, at most the newest
+// MaxListedAuthenticationSessions. Expired sessions are included as they show where users dropped off.
+func (s *sessionsService) ListAuthenticationSessions(ctx context.Context, tenant, realm, flowId string, since time.Time) ([]*model.AuthenticationSession, error) {
+	persistentSessions, err := s.authSessionDB.ListAuthSessionsByFlow(ctx, tenant, realm, flowId, since, MaxListedAuthenticationSessions)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []*model.AuthenticationSession{}
+	for _, persistentSession := range persistentSessions {
+		session, err := persistentSession.ToAuthenticationSession()
+		if err != nil {
+			log := logger.GetGoamLogger()
+			log.Error().Err(err).Str("run_id", persistentSession.RunID).Msg("failed to convert persistent session to auth session")
+			continue
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// encryptSessionSecrets encrypts the sensitive values of the session like they are persisted. The maps are replaced
+// by copies, so the session may share them with the caller.
+func encryptSessionSecrets(ctx context.Context, tenant, realm, sessionIDHash string, session *model.AuthenticationSession) error {
+	var err error
+	scope := []string{"auth_session", tenant, realm, sessionIDHash}
+	if session.Context, err = transformSensitiveValues(ctx, session.Context, kms.EncryptString, append(scope, "context")); err != nil {
+		return fmt.Errorf("failed to encrypt session context: %w", err)
+	}
+	if session.Prompts, err = transformSensitiveValues(ctx, session.Prompts, kms.EncryptString, append(scope, "prompts")); err != nil {
+		return fmt.Errorf("failed to encrypt session prompts: %w", err)
+	}
+	if session.Subflows, err = transformSubflowSecrets(ctx, session.Subflows, kms.EncryptString, scope); err != nil {
+		return fmt.Errorf("failed to encrypt subflow context: %w", err)
+	}
+	return nil
+}
+
+// decryptSessionSecrets decrypts the sensitive values that encryptSessionSecrets encrypted, the maps are replaced by copies
+func decryptSessionSecrets(ctx context.Context, tenant, realm, sessionIDHash string, session *model.AuthenticationSession) error {
+	var err error
+	scope := []string{"auth_session", tenant, realm, sessionIDHash}
+	if session.Context, err = transformSensitiveValues(ctx, session.Context, kms.DecryptString, append(scope, "context")); err != nil {
+		return fmt.Errorf("failed to decrypt session context: %w", err)
+	}
+	if session.Prompts, err = transformSensitiveValues(ctx, session.Prompts, kms.DecryptString, append(scope, "prompts")); err != nil {
+		return fmt.Errorf("failed to decrypt session prompts: %w", err)
+	}
+	if session.Subflows, err = transformSubflowSecrets(ctx, session.Subflows, kms.DecryptString, scope); err != nil {
+		return fmt.Errorf("failed to decrypt subflow context: %w", err)
+	}
+	return nil
+}
+
+// transformSensitiveValues returns a copy of the values where the sensitive ones are transformed with fn. The scope and
+// the key of a value are its additional authenticated data, so an encrypted value cannot be moved to another session or key.
+func transformSensitiveValues(ctx context.Context, values map[string]string, fn func(context.Context, string, []byte) (string, error), scope []string) (map[string]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		if model.IsSensitiveContextKey(key) {
+			aad := kms.AAD(append(append([]string{}, scope...), key)...)
+			transformed, err := fn(ctx, value, aad)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			value = transformed
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+// transformSubflowSecrets returns a copy of the subflow frames where the sensitive values of the saved parent contexts are transformed with fn
+func transformSubflowSecrets(ctx context.Context, frames []model.SubflowFrame, fn func(context.Context, string, []byte) (string, error), scope []string) ([]model.SubflowFrame, error) {
+	if frames == nil {
+		return nil, nil
+	}
+
+	result := make([]model.SubflowFrame, len(frames))
+	for i, frame := range frames {
+		transformed, err := transformSensitiveValues(ctx, frame.Context, fn, append(scope, "subflow", strconv.Itoa(i)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", frame.Node, err)
+		}
+		frame.Context = transformed
+		result[i] = frame
+	}
+	return result, nil
+}
+
 // DeleteAuthenticationSession removes an authentication session
 func (s *sessionsService) DeleteAuthenticationSession(ctx context.Context, tenant, realm, sessionIDHash string) error {
 	return s.authSessionDB.DeleteAuthSession(ctx, tenant, realm, sessionIDHash)
 }
 
+// ApproveMagicLink records the approval of a magic link opened on another device
+func (s *sessionsService) ApproveMagicLink(ctx context.Context, tenant, realm, sessionIDHash, linkID string, expiresAt time.Time) (bool, error) {
+	return s.authSessionDB.SaveMagicLinkApproval(ctx, tenant, realm, sessionIDHash, linkID, expiresAt)
+}
+
+// ConsumeMagicLinkApproval deletes the approval of a magic link and returns true if the link was approved
+func (s *sessionsService) ConsumeMagicLinkApproval(ctx context.Context, tenant, realm, sessionIDHash, linkID string) (bool, error) {
+	return s.authSessionDB.ConsumeMagicLinkApproval(ctx, tenant, realm, sessionIDHash, linkID)
+}
+
 // CreateAuthCodeSession creates a new client session with an auth code
 func (s *sessionsService) CreateAuthCodeSession(ctx context.Context, tenant, realm, clientID, userID string, scope []string, grantType string, codeChallenge string, codeChallengeMethod string, loginSession *model.AuthenticationSession, claims map[string]interface{}) (string, *model.ClientSession, error) {
 	// Generate a new auth code
@@ -147,8 +274,8 @@ func (s *sessionsService) CreateAuthCodeSession(ctx context.Context, tenant, rea
 	authCode := lib.GenerateSecureSessionID()
 	authCodeHash := lib.HashString(authCode)
 
-	// json encode the login session
-	loginSessionJSON, err := json.Marshal(loginSession)
+	// json encode the login session, the flow is finished so secrets from the context are not needed anymore
+	loginSessionJSON, err := json.Marshal(loginSession.Redacted())
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to marshal login session: %w", err)
 	}
@@ -331,3 +458,21 @@ func (s *sessionsService) LoadAndDeleteRefreshTokenSession(ctx context.Context,
 
 	return session, nil
 }
+
+// RevokeUserClientSessions deletes all client sessions of a user, e.g. after the password was reset
+func (s *sessionsService) RevokeUserClientSessions(ctx context.Context, tenant, realm, userID string) (int, error) {
+
+	sessions, err := s.clientSessionDB.ListUserClientSessions(ctx, tenant, realm, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list client sessions: %w", err)
+	}
+
+	for _, session := range sessions {
+		err = s.clientSessionDB.DeleteClientSession(ctx, tenant, realm, session.ClientSessionID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete client session: %w", err)
+		}
+	}
+
+	return len(sessions), nil
+}
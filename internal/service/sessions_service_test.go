@@ -2,12 +2,17 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/Identityplane/GoAM/pkg/kms"
 	"github.com/Identityplane/GoAM/pkg/model"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -112,24 +117,28 @@ func (m *mockClientSessionDB) DeleteClientSession(ctx context.Context, tenant, r
 	return nil
 }
 
-func (m *mockClientSessionDB) DeleteExpiredClientSessions(ctx context.Context, tenant, realm string) error {
+func (m *mockClientSessionDB) DeleteExpiredClientSessions(ctx context.Context, tenant, realm string) (int, error) {
 	now := time.Now()
+	deleted := 0
 	for key, session := range m.sessions {
 		if session.Expire.Before(now) {
 			delete(m.sessions, key)
+			deleted++
 		}
 	}
-	return nil
+	return deleted, nil
 }
 
 type mockAuthSessionDB struct {
-	sessions map[string]*model.PersistentAuthSession
-	mu       sync.RWMutex
+	sessions  map[string]*model.PersistentAuthSession
+	approvals map[string]time.Time
+	mu        sync.RWMutex
 }
 
 func newMockAuthSessionDB() *mockAuthSessionDB {
 	return &mockAuthSessionDB{
-		sessions: make(map[string]*model.PersistentAuthSession),
+		sessions:  make(map[string]*model.PersistentAuthSession),
+		approvals: make(map[string]time.Time),
 	}
 }
 
@@ -178,6 +187,24 @@ func (m *mockAuthSessionDB) ListAuthSessions(ctx context.Context, tenant, realm
 	return sessions, nil
 }
 
+func (m *mockAuthSessionDB) ListAuthSessionsByFlow(ctx context.Context, tenant, realm, flowID string, since time.Time, limit int) ([]model.PersistentAuthSession, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sessions []model.PersistentAuthSession
+	for _, session := range m.sessions {
+		if session.Tenant == tenant && session.Realm == realm && session.FlowID == flowID && !session.CreatedAt.Before(since) {
+			sessions = append(sessions, *session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+	if len(sessions) > limit {
+		sessions = sessions[:limit]
+	}
+	return sessions, nil
+}
+
 func (m *mockAuthSessionDB) ListAllAuthSessions(ctx context.Context, tenant string) ([]model.PersistentAuthSession, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -200,17 +227,44 @@ func (m *mockAuthSessionDB) DeleteAuthSession(ctx context.Context, tenant, realm
 	return nil
 }
 
-func (m *mockAuthSessionDB) DeleteExpiredAuthSessions(ctx context.Context, tenant, realm string) error {
+func (m *mockAuthSessionDB) DeleteExpiredAuthSessions(ctx context.Context, tenant, realm string) (int, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	now := time.Now()
+	deleted := 0
 	for key, session := range m.sessions {
 		if session.Tenant == tenant && session.Realm == realm && session.ExpiresAt.Before(now) {
 			delete(m.sessions, key)
+			deleted++
 		}
 	}
-	return nil
+	return deleted, nil
+}
+
+func (m *mockAuthSessionDB) SaveMagicLinkApproval(ctx context.Context, tenant, realm, sessionIDHash, linkID string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := tenant + ":" + realm + ":" + sessionIDHash + ":" + linkID
+	if _, ok := m.approvals[key]; ok {
+		return false, nil
+	}
+	m.approvals[key] = expiresAt
+	return true, nil
+}
+
+func (m *mockAuthSessionDB) ConsumeMagicLinkApproval(ctx context.Context, tenant, realm, sessionIDHash, linkID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := tenant + ":" + realm + ":" + sessionIDHash + ":" + linkID
+	expiresAt, ok := m.approvals[key]
+	if !ok {
+		return false, nil
+	}
+	delete(m.approvals, key)
+	return expiresAt.After(time.Now()), nil
 }
 
 func (m *mockAuthSessionDB) CreateOrUpdateAuthSession(ctx context.Context, session *model.PersistentAuthSession) error {
@@ -400,4 +454,109 @@ func TestSessionsService(t *testing.T) {
 		assert.True(t, exists)
 		assert.Equal(t, "new_value", retrievedSession.Context["new_key"])
 	})
+
+	t.Run("SensitiveContext", func(t *testing.T) {
+		provider, err := kms.NewLocalKeyProvider("test:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))))
+		require.NoError(t, err)
+		kms.SetKeyProvider(provider)
+		t.Cleanup(func() { kms.SetKeyProvider(nil) })
+
+		session, sessionID := service.CreateAuthSessionObject(testTenant, testRealm, "test-flow", "/login")
+		session.Context["password"] = "secret-password"
+		session.Context["email_otp"] = "123456"
+		session.Context["email"] = "alice@example.com"
+
+		err = service.CreateOrUpdateAuthenticationSession(ctx, testTenant, testRealm, *session)
+		require.NoError(t, err)
+
+		// The caller's session must not be modified
+		assert.Equal(t, "123456", session.Context["email_otp"])
+
+		persisted, err := mockAuthSessionDB.GetAuthSessionByHash(ctx, testTenant, testRealm, session.SessionIdHash)
+		require.NoError(t, err)
+		assert.NotContains(t, string(persisted.SessionInformation), "secret-password")
+		assert.NotContains(t, string(persisted.SessionInformation), "123456")
+		assert.Contains(t, string(persisted.SessionInformation), "alice@example.com")
+
+		retrievedSession, exists := service.GetAuthenticationSessionByID(ctx, testTenant, testRealm, sessionID)
+		require.True(t, exists)
+		assert.NotContains(t, retrievedSession.Context, "password")
+		assert.Equal(t, "123456", retrievedSession.Context["email_otp"])
+		assert.Equal(t, "alice@example.com", retrievedSession.Context["email"])
+	})
+}
+
+func TestListAuthenticationSessions(t *testing.T) {
+	ctx := context.Background()
+	service := NewSessionsService(newMockClientSessionDB(), newMockAuthSessionDB())
+	mockTime := newMockTimeProvider()
+	service.SetTimeProvider(mockTime)
+
+	create := func(flowId string) *model.AuthenticationSession {
+		session, _ := service.CreateAuthSessionObject("acme", "customers", flowId, "/login")
+		session.History = []string{"init:start"}
+		require.NoError(t, service.CreateOrUpdateAuthenticationSession(ctx, "acme", "customers", *session))
+		return session
+	}
+
+	old := create("login")
+	mockTime.Advance(2 * time.Hour)
+	since := mockTime.Now().Add(-time.Hour)
+	recent := create("login")
+	create("register")
+
+	// Sessions of other flows and before the window are skipped, expired sessions are included
+	mockTime.Advance(time.Hour)
+	sessions, err := service.ListAuthenticationSessions(ctx, "acme", "customers", "login", since)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, recent.RunID, sessions[0].RunID)
+	assert.NotEqual(t, old.RunID, sessions[0].RunID)
+	assert.Equal(t, []string{"init:start"}, sessions[0].History)
+}
+
+func TestCachedSessionsServiceEncryptsSecrets(t *testing.T) {
+	ctx := context.Background()
+	provider, err := kms.NewLocalKeyProvider("test:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))))
+	require.NoError(t, err)
+	kms.SetKeyProvider(provider)
+	t.Cleanup(func() { kms.SetKeyProvider(nil) })
+
+	mr := miniredis.RunT(t)
+	sessionsService := NewSessionsService(newMockClientSessionDB(), newMockAuthSessionDB())
+	service := NewCachedSessionsService(sessionsService, newTestRedisCache(t, mr, false))
+
+	session, _ := service.CreateAuthSessionObject("acme", "customers", "login", "/login")
+	session.Context["password"] = "secret-password"
+	session.Context["email_otp"] = "123456"
+	session.Context["totpSecret"] = "JBSWY3DPEHPK3PXP"
+	session.Context["email"] = "alice@example.com"
+	session.Subflows = []model.SubflowFrame{{Node: "otp", Context: map[string]string{"sms_otp": "654321"}}}
+	require.NoError(t, service.CreateOrUpdateAuthenticationSession(ctx, "acme", "customers", *session))
+
+	// Read the session once from the cache and once from the database, both are cached in redis
+	assertRedisHasNoSecrets := func() {
+		keys := mr.Keys()
+		require.NotEmpty(t, keys)
+		for _, key := range keys {
+			payload, err := mr.Get(key)
+			require.NoError(t, err)
+			for _, secret := range []string{"secret-password", "123456", "JBSWY3DPEHPK3PXP", "654321"} {
+				assert.NotContains(t, payload, secret, key)
+			}
+		}
+	}
+	assertRedisHasNoSecrets()
+
+	retrieved, exists := service.GetAuthenticationSession(ctx, "acme", "customers", session.SessionIdHash)
+	require.True(t, exists)
+	assert.Equal(t, "123456", retrieved.Context["email_otp"])
+	assert.Equal(t, "654321", retrieved.Subflows[0].Context["sms_otp"])
+	assert.NotContains(t, retrieved.Context, "password")
+
+	mr.FlushAll()
+	retrieved, exists = service.GetAuthenticationSession(ctx, "acme", "customers", session.SessionIdHash)
+	require.True(t, exists)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", retrieved.Context["totpSecret"])
+	assertRedisHasNoSecrets()
 }
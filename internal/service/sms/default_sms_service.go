@@ -0,0 +1,23 @@
+package sms
+
+import (
+	"github.com/Identityplane/GoAM/internal/logger"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/rs/zerolog"
+)
+
+// DefaultSMSService only logs the messages, it is used if no SMS provider is configured
+type DefaultSMSService struct {
+	logger zerolog.Logger
+}
+
+func NewDefaultSMSService() *DefaultSMSService {
+	return &DefaultSMSService{
+		logger: logger.GetGoamLogger(),
+	}
+}
+
+func (m *DefaultSMSService) SendSMS(tenant, realm string, sms *model.SendSMSParams) error {
+	m.logger.Info().Str("tenant", tenant).Str("realm", realm).Str("to", sms.To).Str("template", sms.Template).Str("message", sms.Message).Msg("sending sms")
+	return nil
+}
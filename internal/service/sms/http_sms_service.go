@@ -0,0 +1,80 @@
+package sms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// HttpSMSService sends messages by posting them as json to the endpoint of an SMS gateway
+type HttpSMSService struct {
+	url           string
+	authorization string
+	sender        string
+	client        *http.Client
+}
+
+// httpSMSRequest is the body posted to the gateway
+type httpSMSRequest struct {
+	Tenant   string         `json:"tenant"`
+	Realm    string         `json:"realm"`
+	From     string         `json:"from,omitempty"`
+	To       string         `json:"to"`
+	Template string         `json:"template,omitempty"`
+	Message  string         `json:"message"`
+	Params   map[string]any `json:"params,omitempty"`
+}
+
+// NewHttpSMSService creates a service that posts messages to the url. The authorization value is sent
+// as Authorization header if set, the sender is used as the from number or alphanumeric sender id.
+func NewHttpSMSService(url, authorization, sender string) *HttpSMSService {
+	return &HttpSMSService{
+		url:           url,
+		authorization: authorization,
+		sender:        sender,
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *HttpSMSService) SendSMS(tenant, realm string, sms *model.SendSMSParams) error {
+
+	body, err := json.Marshal(httpSMSRequest{
+		Tenant:   tenant,
+		Realm:    realm,
+		From:     s.sender,
+		To:       sms.To,
+		Template: sms.Template,
+		Message:  sms.Message,
+		Params:   sms.Params,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal sms: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create sms request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.authorization != "" {
+		req.Header.Set("Authorization", s.authorization)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send sms: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("sms provider returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
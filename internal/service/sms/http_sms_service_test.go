@@ -0,0 +1,63 @@
+package sms
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHttpSMSService_SendSMS(t *testing.T) {
+
+	var received httpSMSRequest
+	var authorization string
+
+	// Mock SMS gateway
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if received.To == "+15005550001" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"error":"invalid number"}`))
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	service := NewHttpSMSService(server.URL, "Bearer test-token", "GoAM")
+
+	err := service.SendSMS("acme", "customers", &model.SendSMSParams{
+		Template: "sms-otp",
+		To:       "+41791234567",
+		Message:  "Your verification code is 123456",
+		Params:   map[string]any{"otp": "123456"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Bearer test-token", authorization)
+	assert.Equal(t, "acme", received.Tenant)
+	assert.Equal(t, "customers", received.Realm)
+	assert.Equal(t, "GoAM", received.From)
+	assert.Equal(t, "+41791234567", received.To)
+	assert.Equal(t, "sms-otp", received.Template)
+	assert.Equal(t, "Your verification code is 123456", received.Message)
+	assert.Equal(t, "123456", received.Params["otp"])
+
+	// Errors of the gateway are returned
+	err = service.SendSMS("acme", "customers", &model.SendSMSParams{To: "+15005550001", Message: "test"})
+	assert.ErrorContains(t, err, "status 422")
+	assert.ErrorContains(t, err, "invalid number")
+}
@@ -83,7 +83,7 @@ func (s *staticConfigurationServiceImpl) LoadConfigurationFromFiles(configRoot s
 			// Create flow if not existing
 			if !exists {
 				log.Debug().Str("flow_id", flow.Id).Msg("creating flow")
-				err := flowService.CreateFlow(realm.Tenant, realm.Realm, *flow)
+				err := flowService.ImportFlow(realm.Tenant, realm.Realm, *flow)
 				if err != nil {
 					log.Panic().Err(err).Str("flow_id", flow.Id).Msg("failed to create flow")
 				}
@@ -92,7 +92,7 @@ func (s *staticConfigurationServiceImpl) LoadConfigurationFromFiles(configRoot s
 			// Update flow if in infrastructure as code mode
 			if exists && config.ServerSettings.InfrastructureAsCodeMode {
 				log.Debug().Str("flow_id", flow.Id).Msg("updating flow")
-				err := flowService.UpdateFlow(realm.Tenant, realm.Realm, *flow)
+				err := flowService.ImportFlow(realm.Tenant, realm.Realm, *flow)
 				if err != nil {
 					log.Panic().Err(err).Str("flow_id", flow.Id).Msg("failed to update flow")
 				}
@@ -2,16 +2,23 @@ package service
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"testing"
+	"testing/fstest"
 
+	"github.com/Identityplane/GoAM/internal/auth/graph"
+	"github.com/Identityplane/GoAM/internal/db/sqlite_adapter"
 	"github.com/Identityplane/GoAM/pkg/model"
+	services_interface "github.com/Identityplane/GoAM/pkg/services"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoadTempalte(t *testing.T) {
 
 	// Arrange
-	service := NewTemplatesService().(*templatesService)
+	service := NewTemplatesService(nil).(*templatesService)
 	view := &ViewData{
 		Title:         "Test",
 		NodeName:      "askEmail",
@@ -58,7 +65,7 @@ func TestLoadTempalte(t *testing.T) {
 func TestLoadTempalteOverride(t *testing.T) {
 
 	// Arrange
-	service := NewTemplatesService().(*templatesService)
+	service := NewTemplatesService(nil).(*templatesService)
 	view := &ViewData{
 		Title:         "Test",
 		NodeName:      "askEmail",
@@ -120,7 +127,7 @@ OVERRIDE
 func TestLayoutTemplateOverride(t *testing.T) {
 
 	// Arrange
-	service := NewTemplatesService().(*templatesService)
+	service := NewTemplatesService(nil).(*templatesService)
 	view := &ViewData{
 		Title:         "Test",
 		NodeName:      "askEmail",
@@ -189,7 +196,7 @@ CUSTOM LAYOUT OVERRIDE
 func TestErrorTemplateOverride(t *testing.T) {
 
 	// Arrange
-	service := NewTemplatesService().(*templatesService)
+	service := NewTemplatesService(nil).(*templatesService)
 	view := &ViewData{
 		Title:         "Error Test",
 		NodeName:      "error",
@@ -256,7 +263,7 @@ func TestErrorTemplateOverride(t *testing.T) {
 func TestRemoveTemplateOverride(t *testing.T) {
 
 	// Arrange
-	service := NewTemplatesService().(*templatesService)
+	service := NewTemplatesService(nil).(*templatesService)
 
 	// Act - Create an override
 	override := `{{ define "content" }}
@@ -296,7 +303,7 @@ OVERRIDE
 func TestMultipleTemplateOverrides(t *testing.T) {
 
 	// Arrange
-	service := NewTemplatesService().(*templatesService)
+	service := NewTemplatesService(nil).(*templatesService)
 	view := &ViewData{
 		Title:         "Test",
 		NodeName:      "askEmail",
@@ -373,3 +380,152 @@ OVERRIDE 2
 	output2 := buf2.String()
 	assert.Contains(t, output2, "OVERRIDE 2")
 }
+
+func TestCustomNodeTemplate(t *testing.T) {
+
+	// Arrange
+	service := NewTemplatesService(nil).(*templatesService)
+	def := &model.NodeDefinition{
+		Name:                 "askFavoriteColor",
+		Type:                 model.NodeTypeQuery,
+		PossiblePrompts:      map[string]string{"color": "text"},
+		PossibleResultStates: []string{"submitted"},
+	}
+	templates := fstest.MapFS{"askFavoriteColor.html": {Data: []byte(`{{ define "content" }}<input name="color">{{ end }}`)}}
+
+	if err := graph.RegisterNodeDefinition(def, templates); err != nil {
+		t.Fatalf("failed to register node: %v", err)
+	}
+	defer graph.UnregisterNodeDefinition(def.Name)
+
+	view := &ViewData{
+		NodeName:     "askFavoriteColor",
+		State:        &model.AuthenticationSession{},
+		Node:         &model.GraphNode{},
+		CustomConfig: map[string]string{},
+		Tenant:       "acme",
+		Realm:        "customers",
+	}
+
+	// Act
+	tmpl, err := service.GetTemplates("acme", "customers", "flow1", "askFavoriteColor")
+	if err != nil {
+		t.Fatalf("failed to load template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "layout", view); err != nil {
+		t.Fatalf("failed to execute template: %v", err)
+	}
+
+	// Assert
+	assert.Contains(t, buf.String(), `<input name="color">`)
+
+	// Overrides take precedence over the template of the node
+	err = service.CreateTemplateOverride("acme", "customers", "flow1", "askFavoriteColor", `{{ define "content" }}OVERRIDE{{ end }}`)
+	assert.NoError(t, err)
+	defer service.RemoveTemplateOverride("acme", "customers", "flow1", "askFavoriteColor")
+
+	tmpl, err = service.GetTemplates("acme", "customers", "flow1", "askFavoriteColor")
+	assert.NoError(t, err)
+
+	buf.Reset()
+	assert.NoError(t, tmpl.ExecuteTemplate(&buf, "layout", view))
+	assert.Contains(t, buf.String(), "OVERRIDE")
+}
+
+func TestCustomNodeWithoutTemplate(t *testing.T) {
+	service := NewTemplatesService(nil).(*templatesService)
+	def := &model.NodeDefinition{
+		Name:                 "askFavoriteFood",
+		Type:                 model.NodeTypeQuery,
+		PossiblePrompts:      map[string]string{"food": "text"},
+		PossibleResultStates: []string{"submitted"},
+	}
+
+	require.NoError(t, graph.RegisterNodeDefinition(def, nil))
+	defer graph.UnregisterNodeDefinition(def.Name)
+
+	// Without a template the node cannot be rendered
+	_, err := service.GetTemplates("acme", "customers", "flow1", "askFavoriteFood")
+	assert.ErrorContains(t, err, "has no template")
+
+	// A template override renders it
+	require.NoError(t, service.CreateTemplateOverride("acme", "customers", "*", "askFavoriteFood", `{{ define "content" }}<input name="food">{{ end }}`))
+	defer service.RemoveTemplateOverride("acme", "customers", "*", "askFavoriteFood")
+
+	tmpl, err := service.GetTemplates("acme", "customers", "flow1", "askFavoriteFood")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, tmpl.ExecuteTemplate(&buf, "layout", &ViewData{
+		NodeName:     "askFavoriteFood",
+		State:        &model.AuthenticationSession{},
+		Node:         &model.GraphNode{},
+		CustomConfig: map[string]string{},
+		Tenant:       "acme",
+		Realm:        "customers",
+	}))
+	assert.Contains(t, buf.String(), `<input name="food">`)
+}
+
+func TestTemplateOverridesArePropagated(t *testing.T) {
+	sqliteDB, err := sql.Open("sqlite", ":memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	defer sqliteDB.Close()
+	sqliteDB.SetMaxOpenConns(1)
+	require.NoError(t, sqlite_adapter.RunMigrations(sqliteDB))
+
+	overrideDB, err := sqlite_adapter.NewTemplateOverrideDB(sqliteDB)
+	require.NoError(t, err)
+
+	// Record the changes that are announced to the other instances
+	configChangeService := NewConfigChangeService(nil)
+	var published []model.ConfigChange
+	configChangeService.OnChange(func(change model.ConfigChange) {
+		published = append(published, change)
+	})
+	previous := services
+	SetServices(&services_interface.Services{ConfigChangeService: configChangeService})
+	defer SetServices(previous)
+
+	service := NewTemplatesService(overrideDB).(*templatesService)
+
+	require.NoError(t, service.CreateTemplateOverride("acme", "customers", "login", "askEmail", "stored"))
+	require.Len(t, published, 1)
+	assert.Equal(t, model.ConfigEntityTemplates, published[0].EntityType)
+	assert.Equal(t, "login/askEmail", published[0].EntityId)
+
+	stored, err := overrideDB.GetTemplateOverride(context.Background(), "acme", "customers", "login", "askEmail")
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, "stored", stored.Template)
+
+	// Another instance only has the override in memory once it handled the change
+	overwriteTemplatesMutex.Lock()
+	overwriteTemplates = make(map[string]string)
+	overwriteTemplatesMutex.Unlock()
+
+	service.handleConfigChange(published[0])
+	assert.Equal(t, "stored", service.findOverrideTemplate("acme", "customers", "login", "askEmail"))
+
+	// Instances also load the stored overrides when they start
+	overwriteTemplatesMutex.Lock()
+	overwriteTemplates = make(map[string]string)
+	overwriteTemplatesMutex.Unlock()
+
+	service = NewTemplatesService(overrideDB).(*templatesService)
+	assert.Equal(t, "stored", service.findOverrideTemplate("acme", "customers", "login", "askEmail"))
+
+	// Removing the override removes it from the database and announces it
+	require.NoError(t, service.RemoveTemplateOverride("acme", "customers", "login", "askEmail"))
+	require.Len(t, published, 2)
+
+	stored, err = overrideDB.GetTemplateOverride(context.Background(), "acme", "customers", "login", "askEmail")
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	setTemplateOverride("acme", "customers", "login", "askEmail", "stale")
+	service.handleConfigChange(published[1])
+	assert.Equal(t, "", service.findOverrideTemplate("acme", "customers", "login", "askEmail"))
+}
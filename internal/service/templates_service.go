@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"html/template"
@@ -8,8 +9,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
+	"github.com/Identityplane/GoAM/internal/auth/graph"
+	"github.com/Identityplane/GoAM/internal/config"
 	"github.com/Identityplane/GoAM/internal/logger"
+	"github.com/Identityplane/GoAM/pkg/db"
 	"github.com/Identityplane/GoAM/pkg/model"
 	services_interface "github.com/Identityplane/GoAM/pkg/services"
 )
@@ -37,14 +42,20 @@ type ViewData struct {
 	StaticPath    string
 	AssetsCSSPath string
 	CspNonce      string
+	CanGoBack     bool // the user can return to the previous step
 }
 
 type templatesService struct {
+	overrideDB db.TemplateOverrideDB
 }
 
-func NewTemplatesService() services_interface.TemplatesService {
+// NewTemplatesService creates a new TemplatesService, overrideDB may be nil if overrides created at runtime
+// only need to be kept in memory
+func NewTemplatesService(overrideDB db.TemplateOverrideDB) services_interface.TemplatesService {
 
-	service := &templatesService{}
+	service := &templatesService{
+		overrideDB: overrideDB,
+	}
 
 	// Initialize the maps
 	componentTemplates = make(map[string]string)
@@ -56,6 +67,10 @@ func NewTemplatesService() services_interface.TemplatesService {
 		panic("failed to initialize templates: " + err.Error())
 	}
 
+	if err := service.loadStoredOverrides("", ""); err != nil {
+		panic("failed to load template overrides: " + err.Error())
+	}
+
 	return service
 }
 
@@ -78,12 +93,15 @@ var (
 	nodeTemplates      map[string]string
 
 	// The templates that are overwritten - store the template strings
-	overwriteTemplates map[string]string
+	// Overrides can be reloaded at runtime when the configuration changes, so access is guarded by the mutex
+	overwriteTemplates      map[string]string
+	overwriteTemplatesMutex sync.RWMutex
 
 	log = logger.GetGoamLogger()
 )
 
-// CreateTemplateOverride creates a template override for a given node
+// CreateTemplateOverride creates a template override for a given node. The override is stored in the database,
+// if there is one, and all instances are notified about it.
 func (s *templatesService) CreateTemplateOverride(tenant, realm, flowId, nodeName, templateString string) error {
 
 	// Validate input parameters
@@ -95,10 +113,21 @@ func (s *templatesService) CreateTemplateOverride(tenant, realm, flowId, nodeNam
 		return fmt.Errorf("templateString cannot be empty")
 	}
 
-	overwriteIndex := fmt.Sprintf("%s/%s/%s/%s", tenant, realm, flowId, nodeName)
+	if s.overrideDB != nil {
+		err := s.overrideDB.UpsertTemplateOverride(context.Background(), &model.TemplateOverride{
+			Tenant:   tenant,
+			Realm:    realm,
+			FlowId:   flowId,
+			NodeName: nodeName,
+			Template: templateString,
+		})
+		if err != nil {
+			return err
+		}
+	}
 
-	// Add the template to the map
-	overwriteTemplates[overwriteIndex] = templateString
+	setTemplateOverride(tenant, realm, flowId, nodeName, templateString)
+	publishConfigChange(tenant, realm, model.ConfigEntityTemplates, templateOverrideEntityId(flowId, nodeName))
 
 	log.Debug().Str("tenant", tenant).Str("realm", realm).Str("flowId", flowId).Str("nodeName", nodeName).Msg("created template override")
 
@@ -110,19 +139,49 @@ func (s *templatesService) RemoveTemplateOverride(tenant, realm, flowId, nodeNam
 
 	overwriteIndex := fmt.Sprintf("%s/%s/%s/%s", tenant, realm, flowId, nodeName)
 
+	overwriteTemplatesMutex.Lock()
+	_, exists := overwriteTemplates[overwriteIndex]
+	delete(overwriteTemplates, overwriteIndex)
+	overwriteTemplatesMutex.Unlock()
+
+	stored := false
+	if s.overrideDB != nil {
+		var err error
+		stored, err = s.overrideDB.DeleteTemplateOverride(context.Background(), tenant, realm, flowId, nodeName)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Check if the override exists
-	if _, exists := overwriteTemplates[overwriteIndex]; !exists {
+	if !exists && !stored {
 		return fmt.Errorf("template override not found for: %s", overwriteIndex)
 	}
 
-	// Remove the template from the map
-	delete(overwriteTemplates, overwriteIndex)
+	publishConfigChange(tenant, realm, model.ConfigEntityTemplates, templateOverrideEntityId(flowId, nodeName))
 
 	return nil
 }
 
+// setTemplateOverride sets the override in memory only
+func setTemplateOverride(tenant, realm, flowId, nodeName, templateString string) {
+	overwriteIndex := fmt.Sprintf("%s/%s/%s/%s", tenant, realm, flowId, nodeName)
+
+	overwriteTemplatesMutex.Lock()
+	overwriteTemplates[overwriteIndex] = templateString
+	overwriteTemplatesMutex.Unlock()
+}
+
+// templateOverrideEntityId is the entity id of the config change of an override
+func templateOverrideEntityId(flowId, nodeName string) string {
+	return flowId + "/" + nodeName
+}
+
 // ListTemplateOverrides returns a map of all existing template overrides
 func (s *templatesService) ListTemplateOverrides() map[string]bool {
+	overwriteTemplatesMutex.RLock()
+	defer overwriteTemplatesMutex.RUnlock()
+
 	result := make(map[string]bool)
 	for key := range overwriteTemplates {
 		result[key] = true
@@ -130,6 +189,104 @@ func (s *templatesService) ListTemplateOverrides() map[string]bool {
 	return result
 }
 
+// handleConfigChange reloads the template overrides when the templates or the realm changed on any instance.
+// A change of a single override reloads it from the database, a realm wide change reloads the templates of the
+// configuration folder and the overrides of the realm from the database.
+func (s *templatesService) handleConfigChange(change model.ConfigChange) {
+	if change.EntityType != model.ConfigEntityTemplates && change.EntityType != model.ConfigEntityRealm {
+		return
+	}
+
+	if change.EntityType == model.ConfigEntityTemplates && change.EntityId != "" {
+		s.reloadStoredOverride(change)
+		return
+	}
+
+	s.reloadTemplatesFolder(change.Tenant, change.Realm)
+
+	if err := s.loadStoredOverrides(change.Tenant, change.Realm); err != nil {
+		log.Warn().Err(err).Str("tenant", change.Tenant).Str("realm", change.Realm).Msg("failed to reload template overrides")
+	}
+}
+
+// reloadStoredOverride loads the override of the change from the database, or removes it if it was deleted
+func (s *templatesService) reloadStoredOverride(change model.ConfigChange) {
+
+	// Without a database the override only exists on the instance that created it
+	if s.overrideDB == nil {
+		return
+	}
+
+	flowId, nodeName, ok := strings.Cut(change.EntityId, "/")
+	if !ok {
+		return
+	}
+
+	override, err := s.overrideDB.GetTemplateOverride(context.Background(), change.Tenant, change.Realm, flowId, nodeName)
+	if err != nil {
+		log.Warn().Err(err).Str("tenant", change.Tenant).Str("realm", change.Realm).Str("override", change.EntityId).Msg("failed to reload template override")
+		return
+	}
+
+	if override == nil {
+		overwriteTemplatesMutex.Lock()
+		delete(overwriteTemplates, fmt.Sprintf("%s/%s/%s/%s", change.Tenant, change.Realm, flowId, nodeName))
+		overwriteTemplatesMutex.Unlock()
+		return
+	}
+
+	setTemplateOverride(override.Tenant, override.Realm, override.FlowId, override.NodeName, override.Template)
+}
+
+// loadStoredOverrides loads the overrides of the realm from the database, all overrides if tenant and realm are empty
+func (s *templatesService) loadStoredOverrides(tenant, realm string) error {
+	if s.overrideDB == nil {
+		return nil
+	}
+
+	overrides, err := s.overrideDB.ListTemplateOverrides(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, override := range overrides {
+		if tenant != "" && (override.Tenant != tenant || override.Realm != realm) {
+			continue
+		}
+		setTemplateOverride(override.Tenant, override.Realm, override.FlowId, override.NodeName, override.Template)
+	}
+
+	return nil
+}
+
+// reloadTemplatesFolder reloads the realm wide template overrides from the configuration folder
+func (s *templatesService) reloadTemplatesFolder(tenant, realm string) {
+
+	if config.ServerSettings == nil {
+		return
+	}
+
+	// Only realms with templates in the configuration folder are reloaded, overrides from other sources are kept
+	templatesPath := filepath.Join(config.ServerSettings.RealmConfigurationFolder, "tenants", tenant, realm, "templates")
+	if _, err := os.Stat(templatesPath); err != nil {
+		return
+	}
+
+	// Remove the overrides previously loaded for the realm so that deleted template files are removed as well
+	prefix := fmt.Sprintf("%s/%s/*/", tenant, realm)
+	overwriteTemplatesMutex.Lock()
+	for key := range overwriteTemplates {
+		if strings.HasPrefix(key, prefix) {
+			delete(overwriteTemplates, key)
+		}
+	}
+	overwriteTemplatesMutex.Unlock()
+
+	if err := s.LoadTemplateOverridesFromPath(tenant, realm, templatesPath); err != nil {
+		log.Warn().Err(err).Str("templates_path", templatesPath).Msg("failed to reload template overrides")
+	}
+}
+
 // LoadTemplateOverridesFromPath loads template overrides from a local file path for a specific tenant and realm
 func (s *templatesService) LoadTemplateOverridesFromPath(tenant, realm, templatesPath string) error {
 
@@ -181,8 +338,9 @@ func (s *templatesService) LoadTemplateOverridesFromFS(tenant, realm string, tem
 		}
 
 		// Extract the template name from the filename (without .html extension)
+		// Every instance loads the files itself, so they are neither stored nor announced
 		templateName := strings.TrimSuffix(entry.Name(), ".html")
-		s.CreateTemplateOverride(tenant, realm, "*", templateName, string(templateContent))
+		setTemplateOverride(tenant, realm, "*", templateName, string(templateContent))
 	}
 
 	return nil
@@ -217,6 +375,16 @@ func (s *templatesService) GetTemplates(tenant, realm, flowId, nodeName string)
 		usedNode = nodeTemplates[nodeName+".html"]
 	}
 
+	// Custom nodes ship their templates when they are registered
+	if usedNode == "" {
+		usedNode, _ = graph.GetCustomNodeTemplate(nodeName)
+	}
+
+	// Custom nodes can be registered without a template, they need a template override then
+	if usedNode == "" && !graph.IsBuiltinNode(nodeName) && graph.GetNodeDefinitionByName(nodeName) != nil {
+		return nil, fmt.Errorf("node '%s' has no template, add a template override for it", nodeName)
+	}
+
 	// Parse the node template
 	template, err = template.Parse(usedNode)
 	if err != nil {
@@ -228,6 +396,9 @@ func (s *templatesService) GetTemplates(tenant, realm, flowId, nodeName string)
 
 func (s *templatesService) findOverrideTemplate(tenant, realm, flowId, nodeName string) string {
 
+	overwriteTemplatesMutex.RLock()
+	defer overwriteTemplatesMutex.RUnlock()
+
 	// First check the most specific override
 	overwriteIndex := fmt.Sprintf("%s/%s/%s/%s", tenant, realm, flowId, nodeName)
 	if overrideTemplateString, exists := overwriteTemplates[overwriteIndex]; exists {
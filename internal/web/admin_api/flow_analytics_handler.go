@@ -0,0 +1,153 @@
+package admin_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/service"
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/valyala/fasthttp"
+)
+
+// defaultFlowAnalyticsRange is the time range of the flow analytics if the request does not set one
+const defaultFlowAnalyticsRange = 7 * 24 * time.Hour
+
+// FlowFunnelsResponse represents the response structure for the flow analytics endpoints
+type FlowFunnelsResponse struct {
+	From     time.Time           `json:"from"`
+	To       time.Time           `json:"to"`
+	ClientId string              `json:"client_id,omitempty"`
+	Flows    []*model.FlowFunnel `json:"flows"`
+}
+
+// HandleDashboardFlows returns the funnels of the flows of a realm
+// @Summary Get flow funnels
+// @Description Returns how the runs of the flows progressed: started, reached, abandoned and in progress steps, median step time, succeeded and failed. Runs are counted in the hour they started.
+// @Tags Dashboard
+// @Produce json
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Param flow query string false "Flow ID"
+// @Param client_id query string false "Client ID of the application that started the flow"
+// @Param from query string false "Start of the time range as RFC 3339, defaults to 7 days ago"
+// @Param to query string false "End of the time range as RFC 3339, defaults to now"
+// @Success 200 {object} FlowFunnelsResponse
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /admin/{tenant}/{realm}/dashboard/flows [get]
+func HandleDashboardFlows(ctx *fasthttp.RequestCtx) {
+	handleFlowFunnels(ctx, string(ctx.QueryArgs().Peek("flow")))
+}
+
+// HandleDashboardFlow returns the funnel of a flow
+// @Summary Get flow funnel
+// @Description Returns how the runs of the flow progressed, the response contains one flow with zero counters if no run started in the time range
+// @Tags Dashboard
+// @Produce json
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Param flow path string true "Flow ID"
+// @Param client_id query string false "Client ID of the application that started the flow"
+// @Param from query string false "Start of the time range as RFC 3339, defaults to 7 days ago"
+// @Param to query string false "End of the time range as RFC 3339, defaults to now"
+// @Success 200 {object} FlowFunnelsResponse
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /admin/{tenant}/{realm}/dashboard/flows/{flow} [get]
+func HandleDashboardFlow(ctx *fasthttp.RequestCtx) {
+	handleFlowFunnels(ctx, ctx.UserValue("flow").(string))
+}
+
+func handleFlowFunnels(ctx *fasthttp.RequestCtx, flowId string) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+
+	services := service.GetServices()
+
+	// Lookup the loaded realm
+	_, ok := services.RealmService.GetRealm(tenant, realm)
+	if !ok {
+		ctx.SetStatusCode(http.StatusNotFound)
+		ctx.SetBodyString("Realm not found")
+		return
+	}
+
+	filter, err := parseFlowStatsFilter(ctx.QueryArgs())
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		ctx.SetBodyString(err.Error())
+		return
+	}
+	filter.FlowId = flowId
+
+	// The counters of this instance are written first so that the response includes the latest runs
+	if err := services.FlowAnalyticsService.Flush(ctx); err != nil {
+		ctx.SetStatusCode(http.StatusInternalServerError)
+		ctx.SetBodyString("Failed to write flow analytics: " + err.Error())
+		return
+	}
+
+	funnels, err := services.FlowAnalyticsService.GetFlowFunnels(ctx, tenant, realm, filter)
+	if err != nil {
+		ctx.SetStatusCode(http.StatusInternalServerError)
+		ctx.SetBodyString("Failed to get flow analytics: " + err.Error())
+		return
+	}
+
+	if flowId != "" && len(funnels) == 0 {
+		funnels = []*model.FlowFunnel{{FlowId: flowId, Steps: []model.FlowFunnelStep{}}}
+	}
+
+	response := FlowFunnelsResponse{
+		From:     filter.From,
+		To:       filter.To,
+		ClientId: filter.ClientId,
+		Flows:    funnels,
+	}
+
+	jsonData, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		ctx.SetStatusCode(http.StatusInternalServerError)
+		ctx.SetBodyString("Failed to marshal response: " + err.Error())
+		return
+	}
+
+	ctx.SetContentType("application/json")
+	ctx.SetBody(jsonData)
+}
+
+// parseFlowStatsFilter reads the client and the time range from the query
+func parseFlowStatsFilter(args *fasthttp.Args) (model.FlowStatsFilter, error) {
+	filter := model.FlowStatsFilter{
+		ClientId: string(args.Peek("client_id")),
+		To:       time.Now(),
+	}
+
+	if value := string(args.Peek("to")); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to: %w", err)
+		}
+		filter.To = to
+	}
+
+	filter.From = filter.To.Add(-defaultFlowAnalyticsRange)
+	if value := string(args.Peek("from")); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from: %w", err)
+		}
+		filter.From = from
+	}
+
+	if !filter.From.Before(filter.To) {
+		return filter, fmt.Errorf("from must be before to")
+	}
+
+	return filter, nil
+}
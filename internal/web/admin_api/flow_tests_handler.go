@@ -0,0 +1,185 @@
+package admin_api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Identityplane/GoAM/internal/flowtest"
+	"github.com/Identityplane/GoAM/internal/service"
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/valyala/fasthttp"
+)
+
+// HandleRunFlowTests runs the tests of a flow
+// @Summary Run the tests of a flow
+// @Description Runs the tests in the tests section of the flow definition in-process with an in-memory user repository.
+// @Description Emails and sms are recorded instead of sent and http requests are answered by the http mocks of the suite.
+// @Description Flows with nodes that connect to external services directly, such as ldapBind, are not run. A test suite as YAML in the body is run in addition to the tests of the flow.
+// @Description Use version to test a draft before it is published.
+// @Tags Flows
+// @Accept text/yaml
+// @Produce json
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Param flow path string true "Flow ID"
+// @Param version query int false "Version of the definition, the published definition if not set"
+// @Param request body string false "Test suite as YAML"
+// @Success 200 {object} FlowTestResult
+// @Failure 400 {string} string "Invalid test suite"
+// @Failure 404 {string} string "Flow not found"
+// @Router /admin/{tenant}/{realm}/flows/{flow}/tests [post]
+func HandleRunFlowTests(ctx *fasthttp.RequestCtx) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+	flowId := ctx.UserValue("flow").(string)
+
+	loadedRealm, found := service.GetServices().RealmService.GetRealm(tenant, realm)
+	if !found {
+		writeFlowTestsError(ctx, http.StatusNotFound, "Realm not found")
+		return
+	}
+
+	flow, found := service.GetServices().FlowService.GetFlowById(tenant, realm, flowId)
+	if !found {
+		writeFlowTestsError(ctx, http.StatusNotFound, "Flow not found")
+		return
+	}
+
+	// The definition is loaded the same way as for a login, with its subflows and the settings of the realm
+	if versionParam := string(ctx.QueryArgs().Peek("version")); versionParam != "" {
+		version, ok := parseVersionValue(ctx, versionParam)
+		if !ok {
+			return
+		}
+		flow, found = service.GetServices().FlowService.GetFlowVersionForExecution(flowId, version, loadedRealm)
+	} else {
+		flow, found = service.GetServices().FlowService.GetFlowForExecution(flow.Route, loadedRealm)
+	}
+	if !found || flow.Definition == nil {
+		writeFlowTestsError(ctx, http.StatusNotFound, "Flow definition not found")
+		return
+	}
+
+	suites, err := flowTestSuites(flow.Id, flow.DefinitionYaml)
+	if err != nil {
+		writeFlowTestsError(ctx, http.StatusBadRequest, "Invalid tests of the flow: "+err.Error())
+		return
+	}
+
+	if body := string(ctx.PostBody()); body != "" {
+		suite, err := flowtest.LoadSuite(body)
+		if err != nil {
+			writeFlowTestsError(ctx, http.StatusBadRequest, err.Error())
+			return
+		}
+		if suite.Name == "" {
+			suite.Name = "request"
+		}
+		suites = append(suites, suite)
+	}
+
+	writeFlowTestsResponse(ctx, runFlowTestSuites(flow.Id, flow.Definition, suites))
+}
+
+// HandleRunRealmFlowTests runs the tests of all flows of a realm
+// @Summary Run the tests of all flows
+// @Description Runs the tests of the published definitions of all flows of the realm that have tests
+// @Tags Flows
+// @Produce json
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Success 200 {object} RealmFlowTestResult
+// @Failure 404 {string} string "Realm not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /admin/{tenant}/{realm}/flows/tests [post]
+func HandleRunRealmFlowTests(ctx *fasthttp.RequestCtx) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+
+	loadedRealm, found := service.GetServices().RealmService.GetRealm(tenant, realm)
+	if !found {
+		writeFlowTestsError(ctx, http.StatusNotFound, "Realm not found")
+		return
+	}
+
+	flows, err := service.GetServices().FlowService.ListFlows(tenant, realm)
+	if err != nil {
+		writeFlowTestsError(ctx, http.StatusInternalServerError, "Failed to list flows: "+err.Error())
+		return
+	}
+
+	result := RealmFlowTestResult{Passed: true, Flows: []FlowTestResult{}}
+	for _, listed := range flows {
+		flow, found := service.GetServices().FlowService.GetFlowForExecution(listed.Route, loadedRealm)
+		if !found || flow.Definition == nil {
+			continue
+		}
+
+		// A flow with invalid tests is reported as failed instead of failing the whole request
+		suites, err := flowTestSuites(flow.Id, flow.DefinitionYaml)
+		if err != nil {
+			result.Passed = false
+			result.Flows = append(result.Flows, FlowTestResult{Flow: flow.Id, Error: err.Error(), Suites: []*flowtest.SuiteResult{}})
+			continue
+		}
+		if len(suites) == 0 {
+			continue
+		}
+
+		flowResult := runFlowTestSuites(flow.Id, flow.Definition, suites)
+		if !flowResult.Passed {
+			result.Passed = false
+		}
+		result.Flows = append(result.Flows, flowResult)
+	}
+
+	writeFlowTestsResponse(ctx, result)
+}
+
+// flowTestSuites returns the tests section of the flow definition as suite, or no suite if the flow has no tests
+func flowTestSuites(flowId, definitionYaml string) ([]*flowtest.Suite, error) {
+	suite, err := flowtest.LoadSuite(definitionYaml)
+	if err != nil {
+		return nil, err
+	}
+	if len(suite.Tests) == 0 {
+		return nil, nil
+	}
+
+	if suite.Name == "" {
+		suite.Name = flowId
+	}
+	return []*flowtest.Suite{suite}, nil
+}
+
+func runFlowTestSuites(flowId string, definition *model.FlowDefinition, suites []*flowtest.Suite) FlowTestResult {
+	result := FlowTestResult{Flow: flowId, Passed: true, Suites: []*flowtest.SuiteResult{}}
+	for _, suite := range suites {
+		suiteResult := flowtest.Run(definition, suite)
+		if !suiteResult.Passed {
+			result.Passed = false
+		}
+		result.Suites = append(result.Suites, suiteResult)
+	}
+	return result
+}
+
+func writeFlowTestsResponse(ctx *fasthttp.RequestCtx, response interface{}) {
+	jsonData, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		writeFlowTestsError(ctx, http.StatusInternalServerError, "Failed to marshal response: "+err.Error())
+		return
+	}
+
+	ctx.SetContentType("application/json")
+	ctx.SetBody(jsonData)
+}
+
+func writeFlowTestsError(ctx *fasthttp.RequestCtx, status int, message string) {
+	ctx.SetStatusCode(status)
+	ctx.SetContentType("application/json")
+	_ = json.NewEncoder(ctx).Encode(map[string]string{
+		"error": message,
+	})
+}
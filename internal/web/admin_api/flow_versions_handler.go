@@ -0,0 +1,342 @@
+package admin_api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Identityplane/GoAM/internal/service"
+
+	"github.com/valyala/fasthttp"
+)
+
+// HandleListFlowVersions returns all versions of a flow
+// @Summary List flow versions
+// @Description Returns all versions of a flow, the newest version first. The published version is marked as active.
+// @Tags Flows
+// @Accept json
+// @Produce json
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Param flow path string true "Flow ID"
+// @Success 200 {array} model.FlowVersion
+// @Failure 404 {string} string "Flow not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /admin/{tenant}/{realm}/flows/{flow}/versions [get]
+func HandleListFlowVersions(ctx *fasthttp.RequestCtx) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+	flowId := ctx.UserValue("flow").(string)
+
+	if _, ok := service.GetServices().FlowService.GetFlowById(tenant, realm, flowId); !ok {
+		ctx.SetStatusCode(http.StatusNotFound)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{
+			"error": "Flow not found",
+		})
+		return
+	}
+
+	versions, err := service.GetServices().FlowService.ListFlowVersions(tenant, realm, flowId)
+	if err != nil {
+		ctx.SetStatusCode(http.StatusInternalServerError)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	writeFlowVersionsResponse(ctx, versions)
+}
+
+// HandleCreateFlowVersion saves a yaml flow definition as a draft version of a flow
+// @Summary Create a flow version
+// @Description Saves the flow definition as a new draft version without publishing it. The draft can be tested with
+// @Description ?debug&version=<version> on the auth endpoint and is only used for new logins after it was published.
+// @Tags Flows
+// @Accept text/yaml
+// @Produce json
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Param flow path string true "Flow ID"
+// @Param comment query string false "Description of the change"
+// @Param request body string true "Flow definition as YAML"
+// @Success 201 {object} model.FlowVersion
+// @Failure 400 {string} string "Invalid flow definition"
+// @Failure 404 {string} string "Flow not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /admin/{tenant}/{realm}/flows/{flow}/versions [post]
+func HandleCreateFlowVersion(ctx *fasthttp.RequestCtx) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+	flowId := ctx.UserValue("flow").(string)
+
+	if _, ok := service.GetServices().FlowService.GetFlowById(tenant, realm, flowId); !ok {
+		ctx.SetStatusCode(http.StatusNotFound)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{
+			"error": "Flow not found",
+		})
+		return
+	}
+
+	comment := string(ctx.QueryArgs().Peek("comment"))
+	flowVersion, err := service.GetServices().FlowService.CreateFlowVersion(tenant, realm, flowId, string(ctx.PostBody()), comment)
+	if err != nil {
+		ctx.SetStatusCode(http.StatusInternalServerError)
+		if errors.Is(err, service.ErrInvalidFlowDefinition) {
+			ctx.SetStatusCode(http.StatusBadRequest)
+		}
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.SetStatusCode(http.StatusCreated)
+	writeFlowVersionsResponse(ctx, flowVersion)
+}
+
+// HandleGetFlowVersion returns a single version of a flow
+// @Summary Get a flow version
+// @Description Returns a single version of a flow including its definition
+// @Tags Flows
+// @Accept json
+// @Produce json
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Param flow path string true "Flow ID"
+// @Param version path int true "Version"
+// @Success 200 {object} model.FlowVersion
+// @Failure 400 {string} string "Invalid version"
+// @Failure 404 {string} string "Flow version not found"
+// @Router /admin/{tenant}/{realm}/flows/{flow}/versions/{version} [get]
+func HandleGetFlowVersion(ctx *fasthttp.RequestCtx) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+	flowId := ctx.UserValue("flow").(string)
+
+	version, ok := parseVersionValue(ctx, ctx.UserValue("version").(string))
+	if !ok {
+		return
+	}
+
+	flowVersion, ok := service.GetServices().FlowService.GetFlowVersion(tenant, realm, flowId, version)
+	if !ok {
+		ctx.SetStatusCode(http.StatusNotFound)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{
+			"error": "Flow version not found",
+		})
+		return
+	}
+
+	writeFlowVersionsResponse(ctx, flowVersion)
+}
+
+// HandlePublishFlowVersion publishes a version of a flow
+// @Summary Publish a flow version
+// @Description Makes the version the active definition of the flow. New logins use this version right away,
+// @Description logins that are in progress finish on the version they were started on.
+// @Tags Flows
+// @Accept json
+// @Produce json
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Param flow path string true "Flow ID"
+// @Param version path int true "Version"
+// @Success 200 {object} model.FlowVersion
+// @Failure 400 {string} string "Invalid version"
+// @Failure 404 {string} string "Flow version not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /admin/{tenant}/{realm}/flows/{flow}/versions/{version}/publish [post]
+func HandlePublishFlowVersion(ctx *fasthttp.RequestCtx) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+	flowId := ctx.UserValue("flow").(string)
+
+	version, ok := parseVersionValue(ctx, ctx.UserValue("version").(string))
+	if !ok {
+		return
+	}
+
+	if _, ok := service.GetServices().FlowService.GetFlowVersion(tenant, realm, flowId, version); !ok {
+		ctx.SetStatusCode(http.StatusNotFound)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{
+			"error": "Flow version not found",
+		})
+		return
+	}
+
+	if err := service.GetServices().FlowService.PublishFlowVersion(tenant, realm, flowId, version); err != nil {
+		ctx.SetStatusCode(http.StatusInternalServerError)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	flowVersion, _ := service.GetServices().FlowService.GetFlowVersion(tenant, realm, flowId, version)
+	writeFlowVersionsResponse(ctx, flowVersion)
+}
+
+// HandleRollbackFlow publishes the version before the active version of a flow
+// @Summary Roll back a flow
+// @Description Publishes the latest version before the active version of the flow
+// @Tags Flows
+// @Accept json
+// @Produce json
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Param flow path string true "Flow ID"
+// @Success 200 {object} model.FlowVersion
+// @Failure 404 {string} string "Flow not found"
+// @Failure 409 {string} string "No previous version"
+// @Router /admin/{tenant}/{realm}/flows/{flow}/rollback [post]
+func HandleRollbackFlow(ctx *fasthttp.RequestCtx) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+	flowId := ctx.UserValue("flow").(string)
+
+	if _, ok := service.GetServices().FlowService.GetFlowById(tenant, realm, flowId); !ok {
+		ctx.SetStatusCode(http.StatusNotFound)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{
+			"error": "Flow not found",
+		})
+		return
+	}
+
+	flowVersion, err := service.GetServices().FlowService.RollbackFlow(tenant, realm, flowId)
+	if err != nil {
+		ctx.SetStatusCode(http.StatusConflict)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	writeFlowVersionsResponse(ctx, flowVersion)
+}
+
+// HandleDiffFlowVersions returns the difference between two versions of a flow
+// @Summary Diff flow versions
+// @Description Returns a unified diff between the definitions of two versions of a flow. If to is omitted the active version is used.
+// @Tags Flows
+// @Accept json
+// @Produce text/plain
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Param flow path string true "Flow ID"
+// @Param from query int true "Version to compare from"
+// @Param to query int false "Version to compare to"
+// @Success 200 {string} string "Unified diff, empty if the definitions are equal"
+// @Failure 400 {string} string "Invalid version"
+// @Failure 404 {string} string "Flow version not found"
+// @Router /admin/{tenant}/{realm}/flows/{flow}/versions/diff [get]
+func HandleDiffFlowVersions(ctx *fasthttp.RequestCtx) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+	flowId := ctx.UserValue("flow").(string)
+
+	flow, ok := service.GetServices().FlowService.GetFlowById(tenant, realm, flowId)
+	if !ok {
+		ctx.SetStatusCode(http.StatusNotFound)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{
+			"error": "Flow not found",
+		})
+		return
+	}
+
+	from, ok := parseVersionValue(ctx, string(ctx.QueryArgs().Peek("from")))
+	if !ok {
+		return
+	}
+
+	to := flow.ActiveVersion
+	if ctx.QueryArgs().Has("to") {
+		to, ok = parseVersionValue(ctx, string(ctx.QueryArgs().Peek("to")))
+		if !ok {
+			return
+		}
+	}
+
+	diff, err := service.GetServices().FlowService.DiffFlowVersions(tenant, realm, flowId, from, to)
+	if err != nil {
+		ctx.SetStatusCode(http.StatusNotFound)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.SetContentType("text/plain")
+	ctx.SetBodyString(diff)
+}
+
+// parseVersionValue parses a flow version number and writes a bad request response if it is invalid
+func parseVersionValue(ctx *fasthttp.RequestCtx, value string) (int, bool) {
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{
+			"error": "Invalid version: " + value,
+		})
+		return 0, false
+	}
+	return version, true
+}
+
+func writeFlowVersionsResponse(ctx *fasthttp.RequestCtx, response interface{}) {
+	jsonData, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		ctx.SetStatusCode(http.StatusInternalServerError)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{
+			"error": "Failed to marshal response: " + err.Error(),
+		})
+		return
+	}
+
+	ctx.SetContentType("application/json")
+	ctx.SetBody(jsonData)
+}
+
+// HandleGetFlowVariantMetrics returns the metrics of the rollout variants of a flow
+// @Summary Get flow variant metrics
+// @Description Returns the number of started, succeeded and failed sessions per rollout variant of a flow
+// @Tags Flows
+// @Accept json
+// @Produce json
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Param flow path string true "Flow ID"
+// @Success 200 {array} services.FlowVariantMetrics
+// @Failure 404 {string} string "Flow not found"
+// @Router /admin/{tenant}/{realm}/flows/{flow}/variants [get]
+func HandleGetFlowVariantMetrics(ctx *fasthttp.RequestCtx) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+	flowId := ctx.UserValue("flow").(string)
+
+	metrics, err := service.GetServices().FlowService.GetFlowVariantMetrics(tenant, realm, flowId)
+	if err != nil {
+		ctx.SetStatusCode(http.StatusNotFound)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	writeFlowVersionsResponse(ctx, metrics)
+}
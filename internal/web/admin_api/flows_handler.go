@@ -2,8 +2,10 @@ package admin_api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/Identityplane/GoAM/internal/auth/graph"
 	"github.com/Identityplane/GoAM/internal/service"
@@ -12,7 +14,6 @@ import (
 	services_interface "github.com/Identityplane/GoAM/pkg/services"
 
 	"github.com/valyala/fasthttp"
-	"gopkg.in/yaml.v2"
 )
 
 type EnrichedFlow struct {
@@ -209,7 +210,8 @@ func HandleCreateFlow(ctx *fasthttp.RequestCtx) {
 
 // HandleUpdateFlow updates an existing flow
 // @Summary Update a flow
-// @Description Updates an existing flow configuration
+// @Description Updates an existing flow configuration. Setting variants starts a weighted rollout between versions of the flow,
+// @Description new sessions are assigned to a variant per device and stay on it.
 // @Tags Flows
 // @Accept json
 // @Produce json
@@ -262,6 +264,10 @@ func HandleUpdateFlow(ctx *fasthttp.RequestCtx) {
 		existingFlow.DebugAllowed = *patch.DebugAllowed
 	}
 
+	if patch.Variants != nil {
+		existingFlow.Variants = *patch.Variants
+	}
+
 	// Update flow by creating a new one with the same route
 	if err := service.GetServices().FlowService.UpdateFlow(tenant, realm, *existingFlow); err != nil {
 		ctx.SetStatusCode(http.StatusInternalServerError)
@@ -351,8 +357,9 @@ func HandleDeleteFlow(ctx *fasthttp.RequestCtx) {
 // @Router /admin/{tenant}/{realm}/nodes [get]
 func HandleListNodes(ctx *fasthttp.RequestCtx) {
 	// Get all node definitions and convert to API format
-	nodes := make([]NodeInfo, 0, len(graph.NodeDefinitions))
-	for _, node := range graph.NodeDefinitions {
+	definitions := graph.ListNodeDefinitions()
+	nodes := make([]NodeInfo, 0, len(definitions))
+	for _, node := range definitions {
 
 		prettyName := node.PrettyName
 		if prettyName == "" {
@@ -369,6 +376,7 @@ func HandleListNodes(ctx *fasthttp.RequestCtx) {
 			PossibleResultStates: node.PossibleResultStates,
 			Description:          node.Description,
 			CustomConfigOptions:  node.CustomConfigOptions, // TODO: Add custom config options
+			ConfigSchema:         node.ConfigSchema,
 		})
 	}
 
@@ -389,14 +397,17 @@ func HandleListNodes(ctx *fasthttp.RequestCtx) {
 
 // HandleGetFlowDefintion returns the flow definition for a given flow id as yaml
 // @Summary Get a flow definition
-// @Description Returns the flow definition for a given flow id as yaml
+// @Description Returns the latest saved version of the flow definition as yaml, which might be a draft that is not published yet.
+// @Description Use version=active for the published definition or a version number for a specific version.
 // @Tags Flows
 // @Accept json
 // @Produce text/yaml
 // @Param tenant path string true "Tenant ID"
 // @Param realm path string true "Realm ID"
 // @Param flow path string true "Flow ID"
+// @Param version query string false "Version number or 'active'"
 // @Success 200 {string} string "Flow definition as YAML"
+// @Failure 400 {string} string "Invalid version"
 // @Failure 404 {string} string "Flow not found"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /admin/{tenant}/{realm}/flows/{flow}/definition [get]
@@ -424,13 +435,51 @@ func HandleGetFlowDefintion(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	definitionYaml := flow.DefinitionYaml
+	versionParam := string(ctx.QueryArgs().Peek("version"))
+
+	switch versionParam {
+	case "active":
+		// The flow always holds the published definition
+
+	case "":
+		// Editors continue on the latest saved version, flows without versions only have the published definition
+		versions, err := service.GetServices().FlowService.ListFlowVersions(tenant, realm, flowId)
+		if err == nil && len(versions) > 0 {
+			definitionYaml = versions[0].DefinitionYaml
+		}
+
+	default:
+		version, err := strconv.Atoi(versionParam)
+		if err != nil {
+			ctx.SetStatusCode(http.StatusBadRequest)
+			ctx.SetContentType("application/json")
+			_ = json.NewEncoder(ctx).Encode(map[string]string{
+				"error": "Invalid version: " + versionParam,
+			})
+			return
+		}
+
+		flowVersion, ok := service.GetServices().FlowService.GetFlowVersion(tenant, realm, flowId, version)
+		if !ok {
+			ctx.SetStatusCode(http.StatusNotFound)
+			ctx.SetContentType("application/json")
+			_ = json.NewEncoder(ctx).Encode(map[string]string{
+				"error": "Flow version not found",
+			})
+			return
+		}
+		definitionYaml = flowVersion.DefinitionYaml
+	}
+
 	ctx.SetContentType("text/yaml")
-	ctx.SetBody([]byte(flow.DefinitionYaml))
+	ctx.SetBody([]byte(definitionYaml))
 }
 
 // HandleValidateFlowDefinition handles the validation of a YAML flow definition
 // @Summary Validate a flow definition
-// @Description Validates a YAML flow definition
+// @Description Validates a YAML flow definition. Each result has a severity of 8 (error) or 4 (warning), the position in the YAML
+// @Description and the node it belongs to. Only errors make the definition invalid.
 // @Tags Flows
 // @Accept text/yaml
 // @Produce json
@@ -469,18 +518,27 @@ func HandleValidateFlowDefinition(ctx *fasthttp.RequestCtx) {
 		validationErrors = []services_interface.FlowLintError{}
 	}
 
+	// Warnings are reported but do not make the flow invalid
+	valid := true
+	for _, validationError := range validationErrors {
+		if validationError.Severity == services_interface.FlowLintSeverityError {
+			valid = false
+		}
+	}
+
 	// Return the validation results
 	ctx.SetStatusCode(fasthttp.StatusOK)
 	ctx.SetContentType("application/json")
 	_ = json.NewEncoder(ctx).Encode(map[string]interface{}{
-		"valid":  len(validationErrors) == 0,
+		"valid":  valid,
 		"errors": validationErrors,
 	})
 }
 
 // HandlePutFlowDefintion creates or updates a yaml flow defintion for a flow
 // @Summary Create or update a flow definition
-// @Description Creates or updates a flow definition for a given flow ID
+// @Description Creates or updates a flow definition for a given flow ID. The definition is recorded as a new version and
+// @Description published right away, use POST /versions to save a draft instead.
 // @Tags Flows
 // @Accept text/yaml
 // @Produce json
@@ -488,7 +546,7 @@ func HandleValidateFlowDefinition(ctx *fasthttp.RequestCtx) {
 // @Param realm path string true "Realm ID"
 // @Param flow path string true "Flow ID"
 // @Param request body string true "Flow definition as YAML"
-// @Success 200 {object} model.Flow
+// @Success 200
 // @Failure 400 {string} string "Invalid request"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /admin/{tenant}/{realm}/flows/{flow}/definition [put]
@@ -523,32 +581,27 @@ func HandlePutFlowDefintion(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	if len(validationErrors) > 0 {
-		ctx.SetStatusCode(fasthttp.StatusBadRequest)
-		ctx.SetContentType("application/json")
-		_ = json.NewEncoder(ctx).Encode(map[string]string{
-			"error": "Invalid flow definition: " + validationErrors[0].Message,
-		})
-		return
-	}
+	for _, validationError := range validationErrors {
+		if validationError.Severity != services_interface.FlowLintSeverityError {
+			continue
+		}
 
-	// Unmarsahl the yaml and update the flow definition
-	var flowDef model.FlowDefinition
-	if err := yaml.Unmarshal([]byte(yamlDefinition), &flowDef); err != nil {
-		ctx.SetStatusCode(http.StatusInternalServerError)
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
 		ctx.SetContentType("application/json")
 		_ = json.NewEncoder(ctx).Encode(map[string]string{
-			"error": "Failed to unmarshal flow definition: " + err.Error(),
+			"error": "Invalid flow definition: " + validationError.Message,
 		})
 		return
 	}
 
-	existingFlow.Definition = &flowDef
 	existingFlow.DefinitionYaml = yamlDefinition
 
-	// Update flow by creating a new one with the same route
+	// The flow service records the definition as a new version and publishes it
 	if err := service.GetServices().FlowService.UpdateFlow(tenant, realm, *existingFlow); err != nil {
 		ctx.SetStatusCode(http.StatusInternalServerError)
+		if errors.Is(err, service.ErrInvalidFlowDefinition) {
+			ctx.SetStatusCode(http.StatusBadRequest)
+		}
 		ctx.SetContentType("application/json")
 		_ = json.NewEncoder(ctx).Encode(map[string]string{
 			"error": "Failed to update flow: " + err.Error(),
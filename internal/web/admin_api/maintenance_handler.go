@@ -0,0 +1,88 @@
+package admin_api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Identityplane/GoAM/internal/service"
+	"github.com/valyala/fasthttp"
+)
+
+// HandleListMaintenanceJobs returns the status of the background maintenance jobs
+// @Summary List maintenance jobs
+// @Description Returns the schedule and the result of the last run of each background maintenance job on this instance
+// @Tags System
+// @Produce json
+// @Success 200 {array} services.MaintenanceJobStatus
+// @Failure 503 {object} map[string]string "Maintenance service not available"
+// @Router /admin/system/maintenance/jobs [get]
+func HandleListMaintenanceJobs(ctx *fasthttp.RequestCtx) {
+	maintenanceService := service.GetServices().MaintenanceService
+	if maintenanceService == nil {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{"error": "maintenance service not available"})
+		return
+	}
+
+	jsonData, err := json.MarshalIndent(maintenanceService.ListJobs(), "", "  ")
+	if err != nil {
+		ctx.SetStatusCode(http.StatusInternalServerError)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{"error": "failed to marshal jobs"})
+		return
+	}
+
+	ctx.SetStatusCode(http.StatusOK)
+	ctx.SetContentType("application/json")
+	ctx.SetBody(jsonData)
+}
+
+// HandleRunMaintenanceJob runs a background maintenance job right away
+// @Summary Run maintenance job
+// @Description Runs a maintenance job for all realms and returns its status. The job is skipped if it is already running on another instance.
+// @Tags System
+// @Produce json
+// @Param job path string true "Job name"
+// @Success 200 {object} services.MaintenanceJobStatus
+// @Failure 404 {object} map[string]string "Job not found"
+// @Failure 503 {object} map[string]string "Maintenance service not available"
+// @Router /admin/system/maintenance/jobs/{job}/run [post]
+func HandleRunMaintenanceJob(ctx *fasthttp.RequestCtx) {
+	job := ctx.UserValue("job").(string)
+
+	maintenanceService := service.GetServices().MaintenanceService
+	if maintenanceService == nil {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{"error": "maintenance service not available"})
+		return
+	}
+
+	status, err := maintenanceService.RunJob(ctx, job)
+	if errors.Is(err, service.ErrMaintenanceJobNotFound) {
+		ctx.SetStatusCode(http.StatusNotFound)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{"error": "maintenance job not found"})
+		return
+	}
+	if err != nil {
+		ctx.SetStatusCode(http.StatusInternalServerError)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	jsonData, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		ctx.SetStatusCode(http.StatusInternalServerError)
+		ctx.SetContentType("application/json")
+		_ = json.NewEncoder(ctx).Encode(map[string]string{"error": "failed to marshal job status"})
+		return
+	}
+
+	ctx.SetStatusCode(http.StatusOK)
+	ctx.SetContentType("application/json")
+	ctx.SetBody(jsonData)
+}
@@ -1,11 +1,18 @@
 package admin_api
 
+import (
+	"github.com/Identityplane/GoAM/internal/flowtest"
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
 // FlowPatch represents a partial update to a flow
 // Note: FlowId cannot be changed after creation
+// Note: Variants replace the whole rollout, an empty list ends the rollout
 type FlowPatch struct {
-	Route        *string `json:"route,omitempty"`
-	Active       *bool   `json:"active,omitempty"`
-	DebugAllowed *bool   `json:"debug_allowed,omitempty"`
+	Route        *string             `json:"route,omitempty"`
+	Active       *bool               `json:"active,omitempty"`
+	DebugAllowed *bool               `json:"debug_allowed,omitempty"`
+	Variants     *model.FlowVariants `json:"variants,omitempty"`
 }
 
 // RealmPatch represents a partial update to a realm
@@ -19,15 +26,16 @@ type RealmPatch struct {
 
 // NodeInfo represents a node definition in the API response
 type NodeInfo struct {
-	Use                  string            `json:"use"`
-	PrettyName           string            `json:"prettyName"`
-	Type                 string            `json:"type"`
-	Category             string            `json:"category"`
-	RequiredContext      []string          `json:"requiredContext"`
-	OutputContext        []string          `json:"outputContext"`
-	PossibleResultStates []string          `json:"possibleResultStates"`
-	Description          string            `json:"description"`
-	CustomConfigOptions  map[string]string `json:"customConfigOptions"`
+	Use                  string                        `json:"use"`
+	PrettyName           string                        `json:"prettyName"`
+	Type                 string                        `json:"type"`
+	Category             string                        `json:"category"`
+	RequiredContext      []string                      `json:"requiredContext"`
+	OutputContext        []string                      `json:"outputContext"`
+	PossibleResultStates []string                      `json:"possibleResultStates"`
+	Description          string                        `json:"description"`
+	CustomConfigOptions  map[string]string             `json:"customConfigOptions"`
+	ConfigSchema         map[string]model.ConfigOption `json:"configSchema,omitempty"`
 }
 
 // AuthzEntitlement represents an authorization entitlement
@@ -37,3 +45,17 @@ type AuthzEntitlement struct {
 	Action      string `json:"action"`
 	Effect      string `json:"effect"`
 }
+
+// FlowTestResult is the result of the test suites of a flow
+type FlowTestResult struct {
+	Flow   string                  `json:"flow"`
+	Passed bool                    `json:"passed"`
+	Error  string                  `json:"error,omitempty"` // set if the tests of the flow could not be loaded
+	Suites []*flowtest.SuiteResult `json:"suites"`
+}
+
+// RealmFlowTestResult is the result of the tests of all flows of a realm
+type RealmFlowTestResult struct {
+	Passed bool             `json:"passed"`
+	Flows  []FlowTestResult `json:"flows"`
+}
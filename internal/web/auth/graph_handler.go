@@ -1,21 +1,40 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/Identityplane/GoAM/internal/auth/graph"
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_email"
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_password"
 	"github.com/Identityplane/GoAM/internal/service"
 	"github.com/Identityplane/GoAM/internal/web/webutils"
 	"github.com/Identityplane/GoAM/pkg/model"
 
+	"github.com/google/uuid"
 	"github.com/valyala/fasthttp"
 )
 
 const sessionCookieName = "session_id"
 
+// deviceCookieName is the cookie that keeps a device on the same rollout variant of a flow across sessions
+const deviceCookieName = "device_id"
+
+// deviceCookieMaxAge is the lifetime of the device cookie
+const deviceCookieMaxAge = 365 * 24 * time.Hour
+
+// actionParameter is the form field of the back and restart buttons
+const actionParameter = "action"
+
+const (
+	actionBack    = "back"
+	actionRestart = "restart"
+)
+
 type GraphHandler struct {
 	Flow     *model.FlowDefinition
 	Tenant   string
@@ -64,6 +83,13 @@ func HandleAuthRequest(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	// Magic links that are opened on another device than the one where the login was started are handled separately
+	if token := string(ctx.QueryArgs().Peek(node_email.MAGIC_LINK_PARAM)); token != "" {
+		if handleCrossDeviceMagicLink(ctx, realm, flow, token, baseUrl) {
+			return
+		}
+	}
+
 	// Check if debug is in the query parameters and enable it if debug is allowed
 	debug := flow.DebugAllowed && ctx.QueryArgs().Has("debug")
 
@@ -75,8 +101,11 @@ func HandleAuthRequest(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	// If there is no Oauth2 session and no SimpleAuth context we create a new one if we have a client id in the params
-	if session.Oauth2SessionInformation == nil && session.SimpleAuthSessionInformation == nil {
+	// Continue with the flow version the session was started on
+	flow = ResolveSessionFlow(flow, session)
+
+	// If there is no Oauth2 session, no SAML request and no SimpleAuth context we create a new one if we have a client id in the params
+	if session.Oauth2SessionInformation == nil && session.SamlSessionInformation == nil && session.SimpleAuthSessionInformation == nil {
 
 		authErr := CreateSimpleAuthSession(ctx, flow, session, model.GRANT_SIMPLE_AUTH_COOKIE)
 		if authErr != nil {
@@ -101,6 +130,11 @@ func HandleAuthRequest(ctx *fasthttp.RequestCtx) {
 	// Save the updated state in the session
 	service.GetServices().SessionsService.CreateOrUpdateAuthenticationSession(ctx, realm.Tenant, realm.Realm, *newSession)
 
+	// Count the result in the metrics of the rollout variant
+	if newSession.Finished() {
+		service.GetServices().FlowService.RecordFlowVariantResult(newSession)
+	}
+
 	// If the session has any additional response cookies we set them
 	SetHttpAuthContextToResponse(newSession, ctx, realm)
 
@@ -139,6 +173,9 @@ func SetHttpAuthContextFromRequest(session *model.AuthenticationSession, ctx *fa
 
 	// Set the http auth context
 	session.HttpAuthContext = &model.HttpAuthContext{
+		RequestIP:                 webutils.GetRequestIP(ctx),
+		RequestQuery:              webutils.GetRequestQuery(ctx),
+		RequestMethod:             string(ctx.Method()),
 		RequestHeaders:            webutils.GetRequestHeaders(ctx),
 		RequestCookies:            webutils.GetRequestCookies(ctx),
 		AdditionalResponseCookies: make(map[string]http.Cookie),
@@ -213,15 +250,23 @@ func ProcessAuthRequest(ctx *fasthttp.RequestCtx, flow *model.Flow, session *mod
 	// Load the inputs from the request
 	input := extractPromptsFromRequest(ctx, flow.Definition, session.Current)
 
+	// The back and restart buttons return to a step instead of submitting inputs
+	action := string(ctx.PostArgs().Peek(actionParameter))
+
 	// if we have a node in the url we check if it is the current node
-	if len(input) == 0 && len(session.History) > 0 {
+	returnToNode := ""
+	if len(input) == 0 && len(session.History) > 0 && action == "" {
 		if flowNode != session.Current {
 
 			// If it is not the current node we detect an invalid node transition which could be because of
-			// a backwards navigation in the browser. In that case we move back in the graph
-			log.Debug().Msg("invalid node transition detected, resetting the session")
-			service.GetServices().SessionsService.ResetAuthSessionObject(session)
-
+			// a backwards navigation in the browser. In that case we move back in the graph if the steps since
+			// then can be reversed, otherwise the session starts over
+			if graph.CanGoBackTo(session, flowNode) {
+				returnToNode = flowNode
+			} else {
+				log.Debug().Msg("invalid node transition detected, resetting the session")
+				service.GetServices().SessionsService.ResetAuthSessionObject(session)
+			}
 		}
 	}
 
@@ -246,7 +291,29 @@ func ProcessAuthRequest(ctx *fasthttp.RequestCtx, flow *model.Flow, session *mod
 	session.Error = nil
 
 	// Run the flow engine with the current state and input
-	newSession, err := graph.Run(flow.Definition, session, input, registry)
+	var newSession *model.AuthenticationSession
+	var err error
+	switch {
+	case action == actionBack:
+		newSession, err = graph.Back(flow.Definition, session, registry)
+	case action == actionRestart:
+		newSession, err = graph.Restart(flow.Definition, session, registry)
+	case returnToNode != "":
+		newSession, err = graph.BackTo(flow.Definition, session, returnToNode, registry)
+
+		// The form of the earlier step may have been submitted from the browser history
+		input = extractPromptsFromRequest(ctx, flow.Definition, returnToNode)
+		if err == nil && len(input) > 0 {
+			newSession, err = graph.Run(flow.Definition, newSession, input, registry)
+		}
+	default:
+		newSession, err = graph.Run(flow.Definition, session, input, registry)
+	}
+
+	// If the step is not available anymore the current node prompts again
+	if errors.Is(err, graph.ErrStepNotAvailable) {
+		newSession, err = graph.Run(flow.Definition, session, nil, registry)
+	}
 	if err != nil {
 		log.Debug().Err(err).Msg("flow resulted in error")
 		return newSession, err
@@ -305,12 +372,27 @@ func GetOrCreateAuthenticationSesssion(ctx *fasthttp.RequestCtx, realm *model.Re
 		return CreateNewAuthenticationSession(ctx, realm, flow, debug)
 	}
 
+	// Valid password reset links start over, a pending session in the same browser must not swallow the token.
+	// Other links must not be able to end the session.
+	if session != nil && isValidResetLink(ctx, realm) {
+		service.GetServices().SessionsService.DeleteAuthenticationSession(ctx, realm.Tenant, realm.Realm, session.SessionIdHash)
+		return CreateNewAuthenticationSession(ctx, realm, flow, debug)
+	}
+
 	// If the session if from a different flow we delete it and create a new one by overwriting it
 	if session != nil && session.FlowId != flow.Id {
 		service.GetServices().SessionsService.DeleteAuthenticationSession(ctx, realm.Tenant, realm.Realm, session.SessionIdHash)
 		return CreateNewAuthenticationSession(ctx, realm, flow, debug)
 	}
 
+	// If a debug session requests a different version of the flow we start over with that version
+	if session != nil && debug && flow.DebugAllowed {
+		if version := requestedFlowVersion(ctx); version != 0 && version != session.FlowVersion {
+			service.GetServices().SessionsService.DeleteAuthenticationSession(ctx, realm.Tenant, realm.Realm, session.SessionIdHash)
+			return CreateNewAuthenticationSession(ctx, realm, flow, debug)
+		}
+	}
+
 	// if the session was not debug, but now we have debug, we need to set the debug flag if debug is allowed
 	if session != nil && !session.Debug && debug && flow.DebugAllowed {
 		session.Debug = true
@@ -320,6 +402,23 @@ func GetOrCreateAuthenticationSesssion(ctx *fasthttp.RequestCtx, realm *model.Re
 	return session, nil
 }
 
+// isValidResetLink checks if the request carries a password reset token that can still be used
+func isValidResetLink(ctx *fasthttp.RequestCtx, realm *model.Realm) bool {
+
+	token := string(ctx.QueryArgs().Peek(node_password.RESET_TOKEN_PARAM))
+	if token == "" || service.GetServices().PasswordResetService == nil {
+		return false
+	}
+
+	valid, err := service.GetServices().PasswordResetService.IsResetTokenValid(ctx, realm.Tenant, realm.Realm, token)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to check password reset token")
+		return false
+	}
+
+	return valid
+}
+
 func CreateNewAuthenticationSession(ctx *fasthttp.RequestCtx, realm *model.Realm, flow *model.Flow, debug bool) (*model.AuthenticationSession, *model.AuthError) {
 
 	baseUrl := webutils.GetUrlForRealm(ctx, realm)
@@ -331,6 +430,9 @@ func CreateNewAuthenticationSession(ctx *fasthttp.RequestCtx, realm *model.Realm
 	// Set the debug flag
 	session.Debug = debug
 
+	// Pin the session to the version of the flow it will run on
+	AssignFlowVersion(ctx, realm, flow, session)
+
 	isHttps := strings.HasPrefix(baseUrl, "https://")
 
 	// Parse base url and get path
@@ -356,6 +458,97 @@ func CreateNewAuthenticationSession(ctx *fasthttp.RequestCtx, realm *model.Realm
 	return session, nil
 }
 
+// AssignFlowVersion pins a new session to the version of the flow it runs on. This is the active version, or if the flow
+// has a weighted rollout the version of the variant the device is assigned to. Debug sessions can also request a specific
+// version such as a draft with the version query parameter.
+func AssignFlowVersion(ctx *fasthttp.RequestCtx, realm *model.Realm, flow *model.Flow, session *model.AuthenticationSession) {
+
+	session.FlowVersion = flow.ActiveVersion
+
+	if len(flow.Variants) > 0 {
+		variant := service.GetServices().FlowService.SelectFlowVariant(flow, getOrCreateDeviceId(ctx, realm), session.RunID)
+		if variant != nil {
+			session.FlowVersion = variant.Version
+			session.FlowVariant = variant.Name
+
+			log.Info().
+				Str("flow_id", flow.Id).
+				Str("run_id", session.RunID).
+				Str("flow_variant", variant.Name).
+				Int("flow_version", variant.Version).
+				Msg("assigned flow variant")
+		}
+	}
+
+	if session.Debug && flow.DebugAllowed {
+		if version := requestedFlowVersion(ctx); version != 0 {
+			session.FlowVersion = version
+			session.FlowVariant = ""
+		}
+	}
+}
+
+// getOrCreateDeviceId returns the device id from the device cookie and sets the cookie if the device has none yet
+func getOrCreateDeviceId(ctx *fasthttp.RequestCtx, realm *model.Realm) string {
+
+	deviceId := string(ctx.Request.Header.Cookie(deviceCookieName))
+	if deviceId != "" {
+		return deviceId
+	}
+
+	deviceId = uuid.New().String()
+
+	baseUrl := webutils.GetUrlForRealm(ctx, realm)
+	parsedUrl, err := url.Parse(baseUrl)
+	if err != nil {
+		// Without a cookie the assignment is only sticky for the session
+		return deviceId
+	}
+
+	c := &fasthttp.Cookie{}
+	c.SetPath(parsedUrl.Path)
+	c.SetKey(deviceCookieName)
+	c.SetValue(deviceId)
+	c.SetMaxAge(int(deviceCookieMaxAge.Seconds()))
+	c.SetSameSite(fasthttp.CookieSameSiteLaxMode)
+	c.SetHTTPOnly(true)
+	if strings.HasPrefix(baseUrl, "https://") {
+		c.SetSecure(true)
+	}
+	ctx.Response.Header.SetCookie(c)
+
+	return deviceId
+}
+
+// ResolveSessionFlow returns the flow with the definition of the version the session is pinned to.
+// Sessions keep running on the version they were started on, even if another version was published in the meantime.
+func ResolveSessionFlow(flow *model.Flow, session *model.AuthenticationSession) *model.Flow {
+
+	// Sessions started before versioning or on the active version use the flow as is
+	if session.FlowVersion == 0 || session.FlowVersion == flow.ActiveVersion {
+		return flow
+	}
+
+	var pinnedFlow *model.Flow
+	loadedRealm, ok := service.GetServices().RealmService.GetRealm(flow.Tenant, flow.Realm)
+	if ok {
+		pinnedFlow, ok = service.GetServices().FlowService.GetFlowVersionForExecution(flow.Id, session.FlowVersion, loadedRealm)
+	}
+	if !ok {
+		// If the version cannot be loaded the session continues on the active version
+		log.Warn().Str("flow_id", flow.Id).Int("flow_version", session.FlowVersion).Msg("pinned flow version not found, using active version")
+		session.FlowVersion = flow.ActiveVersion
+		return flow
+	}
+
+	return pinnedFlow
+}
+
+// requestedFlowVersion returns the flow version requested with the version query parameter, or 0 if there is none
+func requestedFlowVersion(ctx *fasthttp.RequestCtx) int {
+	return ctx.QueryArgs().GetUintOrZero("version")
+}
+
 func extractPromptsFromRequest(ctx *fasthttp.RequestCtx, flow *model.FlowDefinition, step string) map[string]string {
 	input := make(map[string]string)
 
@@ -370,7 +563,10 @@ func extractPromptsFromRequest(ctx *fasthttp.RequestCtx, flow *model.FlowDefinit
 	log.Debug().Str("body", string(body)).Msg("post body")
 
 	// Check the definiton to see which inputs are allowed
-	def := graph.NodeDefinitions[node.Use]
+	def := graph.GetNodeDefinitionByName(node.Use)
+	if def == nil {
+		return input
+	}
 	for key := range def.PossiblePrompts {
 
 		// read from query parameters (this is needed for example for oauth2 flows)
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"net/url"
+
+	"github.com/Identityplane/GoAM/internal/auth/graph/node_email"
+	"github.com/Identityplane/GoAM/internal/service"
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/valyala/fasthttp"
+)
+
+// handleCrossDeviceMagicLink handles magic links that are opened on another device than the one where the login was
+// started. It returns false if the link belongs to the session of this device, in that case the token is passed to the
+// node as regular input.
+//
+// Depending on the policy of the node the other device is either asked to open the link on the original device or it
+// can approve the login. Approving requires a POST so that links that are prefetched by email scanners are not approved.
+func handleCrossDeviceMagicLink(ctx *fasthttp.RequestCtx, realm *model.Realm, flow *model.Flow, token string, baseUrl string) bool {
+
+	errorState := &model.AuthenticationSession{FlowId: flow.Id}
+
+	sessionIdHash, err := node_email.MagicLinkSessionHash(token)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		RenderError(ctx, node_email.MSG_INVALID_MAGIC_LINK, errorState, baseUrl)
+		return true
+	}
+
+	// Same device, the node verifies the link
+	if session, ok := GetAuthenticationSession(ctx, realm.Tenant, realm.Realm); ok && session.SessionIdHash == sessionIdHash {
+		return false
+	}
+
+	session, ok := service.GetServices().SessionsService.GetAuthenticationSession(ctx, realm.Tenant, realm.Realm, sessionIdHash)
+	if !ok || session.FlowId != flow.Id || session.Finished() {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		RenderError(ctx, node_email.MSG_INVALID_MAGIC_LINK, errorState, baseUrl)
+		return true
+	}
+
+	flow = ResolveSessionFlow(flow, session)
+	node := flow.Definition.Nodes[session.Current]
+	if node == nil || node.Use != node_email.EmailMagicLinkNode.Name {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		RenderError(ctx, node_email.MSG_INVALID_MAGIC_LINK, errorState, baseUrl)
+		return true
+	}
+
+	// The other device only sees the page of the node, never the state of the original session
+	view := &model.AuthenticationSession{
+		RealmObject:  session.RealmObject,
+		FlowId:       session.FlowId,
+		Current:      session.Current,
+		Context:      map[string]string{},
+		LoginUriNext: session.LoginUriBase + "/" + session.Current + "?" + node_email.MAGIC_LINK_PARAM + "=" + url.QueryEscape(token),
+	}
+
+	if node.CustomConfig[node_email.MAGIC_LINK_OPTION_CROSS_DEVICE] != node_email.MAGIC_LINK_CROSS_DEVICE_APPROVE {
+		renderMagicLinkPage(ctx, flow, view, node, "use_original_device", baseUrl)
+		return true
+	}
+
+	if !ctx.IsPost() {
+		renderMagicLinkPage(ctx, flow, view, node, "confirm", baseUrl)
+		return true
+	}
+
+	linkID, expiresAt, err := node_email.VerifyMagicLink(session, token)
+	if err != nil {
+		log.Debug().Err(err).Msg("magic link approval rejected")
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		RenderError(ctx, node_email.MSG_INVALID_MAGIC_LINK, errorState, baseUrl)
+		return true
+	}
+
+	// The approval is stored as its own record and not in the session, the original device keeps saving its
+	// session while it waits and would overwrite it. Each link can only be approved once.
+	approved, err := service.GetServices().SessionsService.ApproveMagicLink(ctx, realm.Tenant, realm.Realm, session.SessionIdHash, linkID, expiresAt)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to save magic link approval")
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		RenderError(ctx, "Failed to approve the login", errorState, baseUrl)
+		return true
+	}
+	if !approved {
+		log.Debug().Msg("magic link was already approved")
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		RenderError(ctx, node_email.MSG_INVALID_MAGIC_LINK, errorState, baseUrl)
+		return true
+	}
+
+	renderMagicLinkPage(ctx, flow, view, node, "approved", baseUrl)
+	return true
+}
+
+func renderMagicLinkPage(ctx *fasthttp.RequestCtx, flow *model.Flow, view *model.AuthenticationSession, node *model.GraphNode, page string, baseUrl string) {
+	view.Prompts = map[string]string{node_email.MAGIC_LINK_PARAM: page}
+	Render(ctx, flow.Definition, view, node, view.Prompts, baseUrl)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/Identityplane/GoAM/internal/auth/graph"
 	"github.com/Identityplane/GoAM/internal/auth/graph/node_system"
 	"github.com/Identityplane/GoAM/internal/lib"
 	"github.com/Identityplane/GoAM/internal/logger"
@@ -24,7 +25,7 @@ func Render(ctx *fasthttp.RequestCtx, flow *model.FlowDefinition, state *model.A
 	debug := state.Debug
 	var stateJSON string
 	if debug {
-		if js, err := json.MarshalIndent(state, "", "  "); err == nil {
+		if js, err := json.MarshalIndent(state.Redacted(), "", "  "); err == nil {
 			stateJSON = string(js)
 		}
 	}
@@ -57,10 +58,14 @@ func Render(ctx *fasthttp.RequestCtx, flow *model.FlowDefinition, state *model.A
 		return
 	}
 
-	// Lookup custom config of node to make it available to the template
-	CustomConfig := currentGraphNode.CustomConfig
-	if CustomConfig == nil {
-		CustomConfig = make(map[string]string)
+	// Lookup custom config of node to make it available to the template, secret options are left out
+	CustomConfig := make(map[string]string, len(currentGraphNode.CustomConfig))
+	def := graph.GetNodeDefinitionByName(currentGraphNode.Use)
+	for key, value := range currentGraphNode.CustomConfig {
+		if def != nil && def.ConfigSchema[key].Secret {
+			continue
+		}
+		CustomConfig[key] = value
 	}
 
 	flowPath := ""
@@ -107,7 +112,8 @@ func Render(ctx *fasthttp.RequestCtx, flow *model.FlowDefinition, state *model.A
 			}
 			return ""
 		}(),
-		CspNonce: cspNonce,
+		CspNonce:  cspNonce,
+		CanGoBack: graph.CanGoBack(state),
 	}
 
 	// Execute the template
@@ -136,7 +142,7 @@ func RenderError(ctx *fasthttp.RequestCtx, msg string, state *model.Authenticati
 	debug := state.Debug
 	var stateJSON string
 	if debug {
-		if js, err := json.MarshalIndent(state, "", "  "); err == nil {
+		if js, err := json.MarshalIndent(state.Redacted(), "", "  "); err == nil {
 			stateJSON = string(js)
 		}
 	}
@@ -2,6 +2,7 @@ package auth_api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/Identityplane/GoAM/internal/auth/graph"
@@ -16,11 +17,18 @@ import (
 
 // JSON API Request/Response Structures
 
+// Actions of a FlowRequest that return to a step of the flow
+const (
+	flowActionBack    = "back"
+	flowActionRestart = "restart"
+)
+
 // FlowRequest represents a JSON API request for flow processing
 type FlowRequest struct {
 	SessionID   string            `json:"sessionId"`
 	CurrentNode string            `json:"currentNode"`
 	Responses   map[string]string `json:"responses"`
+	Action      string            `json:"action,omitempty"` // "back" or "restart" to return to a step instead of submitting responses
 }
 
 // FlowResponse represents a JSON API response for flow processing
@@ -28,6 +36,7 @@ type FlowResponse struct {
 	RunId       string                    `json:"executionId,omitempty"`
 	SessionID   string                    `json:"sessionId,omitempty"`
 	CurrentNode string                    `json:"currentNode,omitempty"`
+	CanGoBack   bool                      `json:"canGoBack,omitempty"`
 	Prompts     map[string]string         `json:"prompts,omitempty"`
 	Result      *model.SimpleAuthResponse `json:"result,omitempty"`
 	Error       *model.AuthError          `json:"error,omitempty"`
@@ -101,6 +110,9 @@ func handleJSONGetRequest(ctx *fasthttp.RequestCtx, realm *model.Realm, flow *mo
 		return
 	}
 
+	// Run the flow version the session is pinned to
+	flow = auth.ResolveSessionFlow(flow, session)
+
 	// Get the client ID from the query parameters
 	shouldReturn := initializeSimpleFlow(queryArgs, realm.Tenant, realm.Realm, ctx, flow, session)
 	if shouldReturn {
@@ -148,14 +160,26 @@ func handleJSONPostRequest(ctx *fasthttp.RequestCtx, realm *model.Realm, flow *m
 		return
 	}
 
+	// Continue with the flow version the session was started on
+	flow = auth.ResolveSessionFlow(flow, session)
+
 	// Validate current node matches
 	if session.Current != req.CurrentNode {
 		sendErrorResponse(ctx, fasthttp.StatusBadRequest, "INVALID_NODE", "Current node mismatch", "")
 		return
 	}
 
+	if req.Action != "" && req.Action != flowActionBack && req.Action != flowActionRestart {
+		sendErrorResponse(ctx, fasthttp.StatusBadRequest, "INVALID_ACTION", "Unknown action", "action")
+		return
+	}
+
 	// Process the flow with user responses
-	newSession, err := processJSONFlowWithResponses(ctx, flow, *session, req.Responses)
+	newSession, err := processJSONFlowWithResponses(ctx, flow, *session, req.Action, req.Responses)
+	if errors.Is(err, graph.ErrStepNotAvailable) {
+		sendErrorResponse(ctx, fasthttp.StatusBadRequest, "STEP_NOT_AVAILABLE", "Cannot return to the step", "action")
+		return
+	}
 	if err != nil {
 		sendErrorResponse(ctx, fasthttp.StatusBadRequest, "FLOW_ERROR", err.Error(), "")
 		return
@@ -182,6 +206,9 @@ func createNewJSONSession(ctx *fasthttp.RequestCtx, realm *model.Realm, flow *mo
 		session.Debug = true
 	}
 
+	// Pin the session to the version of the flow it will run on
+	auth.AssignFlowVersion(ctx, realm, flow, session)
+
 	return session, sessionId, nil
 }
 
@@ -213,15 +240,24 @@ func processJSONFlow(ctx *fasthttp.RequestCtx, flow *model.Flow, session model.A
 	return newSession, nil
 }
 
-func processJSONFlowWithResponses(ctx *fasthttp.RequestCtx, flow *model.Flow, session model.AuthenticationSession, responses map[string]string) (*model.AuthenticationSession, error) {
+func processJSONFlowWithResponses(ctx *fasthttp.RequestCtx, flow *model.Flow, session model.AuthenticationSession, action string, responses map[string]string) (*model.AuthenticationSession, error) {
 	// Load realm
 	loadedRealm, ok := service.GetServices().RealmService.GetRealm(flow.Tenant, flow.Realm)
 	if !ok {
 		return nil, fmt.Errorf("realm not found")
 	}
 
-	// Run flow engine with user responses
-	newSession, err := graph.Run(flow.Definition, &session, responses, loadedRealm.Repositories)
+	// Return to a step or run flow engine with user responses
+	var newSession *model.AuthenticationSession
+	var err error
+	switch action {
+	case flowActionBack:
+		newSession, err = graph.Back(flow.Definition, &session, loadedRealm.Repositories)
+	case flowActionRestart:
+		newSession, err = graph.Restart(flow.Definition, &session, loadedRealm.Repositories)
+	default:
+		newSession, err = graph.Run(flow.Definition, &session, responses, loadedRealm.Repositories)
+	}
 	if err != nil {
 		return newSession, err
 	}
@@ -235,10 +271,11 @@ func sendFlowResponse(ctx *fasthttp.RequestCtx, session *model.AuthenticationSes
 		RunId:       session.RunID,
 		SessionID:   sessionId, // Sensitive session id
 		CurrentNode: session.Current,
+		CanGoBack:   graph.CanGoBack(session),
 	}
 
 	if session.Debug {
-		response.Debug = session
+		response.Debug = session.Redacted()
 	}
 
 	// If there are prompts, add them
@@ -248,6 +285,9 @@ func sendFlowResponse(ctx *fasthttp.RequestCtx, session *model.AuthenticationSes
 
 	if session.Finished() {
 
+		// Count the result in the metrics of the rollout variant
+		service.GetServices().FlowService.RecordFlowVariantResult(session)
+
 		if session.SimpleAuthSessionInformation != nil {
 			authResult, authError := auth.FinishSimpleAuthFlow(ctx, session, realm)
 			if authError != nil {
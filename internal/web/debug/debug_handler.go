@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os/exec"
+	"time"
 
 	"github.com/Identityplane/GoAM/internal/auth/graph/visual"
 	"github.com/Identityplane/GoAM/internal/logger"
@@ -93,6 +94,7 @@ func HandleListFlows(ctx *fasthttp.RequestCtx) {
 // @Param tenant path string true "Tenant ID"
 // @Param realm path string true "Realm ID"
 // @Param flow path string true "Flow name"
+// @Param window query string false "Annotate the graph with the traffic of the sessions of this duration, e.g. 1h"
 // @Success 200 {file} binary "SVG image of the flow graph"
 // @Failure 400 {string} string "Bad request - missing flow parameter"
 // @Failure 404 {string} string "Flow not found"
@@ -100,6 +102,99 @@ func HandleListFlows(ctx *fasthttp.RequestCtx) {
 // @Router /{tenant}/{realm}/debug/{flow}/graph.svg [get]
 func HandleFlowGraphSVG(ctx *fasthttp.RequestCtx) {
 
+	flowGraph, ok := loadFlowGraph(ctx)
+	if !ok {
+		return
+	}
+
+	// Generate the DOT representation for the flow graph
+	dot := visual.RenderDOT(flowGraph)
+
+	// Prepare the SVG output buffer
+	var out bytes.Buffer
+
+	// Use the `dot` command to convert the DOT string into an SVG image
+	cmd := exec.Command("dot", "-Tsvg")
+	cmd.Stdin = bytes.NewReader([]byte(dot)) // Pass the DOT data as input
+	cmd.Stdout = &out                        // Capture the SVG output in the buffer
+
+	// Run the command and check for errors
+	if err := cmd.Run(); err != nil {
+		// Return an internal server error if Graphviz fails
+		logger.GetRequestLogger(ctx).Warn().Err(err).Msg("Failed to generate SVG")
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.SetBodyString(fmt.Sprintf("Failed to generate SVG: %v", err))
+		return
+	}
+
+	// Set the content type to image/svg+xml and return the SVG data
+	ctx.SetContentType("image/svg+xml")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBody(out.Bytes())
+}
+
+// HandleFlowGraphMermaid serves the requested flow graph as Mermaid flowchart.
+// @Summary Generate Mermaid graph of a flow
+// @Description Returns the specified authentication flow as Mermaid flowchart, which can be embedded in markdown
+// @Tags Debug
+// @Produce text/plain
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Param flow path string true "Flow name"
+// @Param window query string false "Annotate the graph with the traffic of the sessions of this duration, e.g. 1h"
+// @Success 200 {string} string "Mermaid flowchart of the flow graph"
+// @Failure 400 {string} string "Bad request - invalid window"
+// @Failure 404 {string} string "Flow not found"
+// @Router /{tenant}/{realm}/debug/{flow}/graph.mmd [get]
+func HandleFlowGraphMermaid(ctx *fasthttp.RequestCtx) {
+
+	flowGraph, ok := loadFlowGraph(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.SetContentType("text/plain; charset=utf-8")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBodyString(visual.RenderMermaid(flowGraph))
+}
+
+// HandleFlowGraphJSON serves the nodes and edges of the requested flow graph as JSON.
+// @Summary Get the graph of a flow as JSON
+// @Description Returns the nodes and edges of the specified authentication flow, e.g. for a flow editor. With a window
+// @Description the nodes have the executions, errors and waiting sessions and the edges the number of transitions.
+// @Tags Debug
+// @Produce json
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Param flow path string true "Flow name"
+// @Param window query string false "Annotate the graph with the traffic of the sessions of this duration, e.g. 1h"
+// @Success 200 {object} visual.Graph
+// @Failure 400 {string} string "Bad request - invalid window"
+// @Failure 404 {string} string "Flow not found"
+// @Router /{tenant}/{realm}/debug/{flow}/graph.json [get]
+func HandleFlowGraphJSON(ctx *fasthttp.RequestCtx) {
+
+	flowGraph, ok := loadFlowGraph(ctx)
+	if !ok {
+		return
+	}
+
+	flowGraphJSON, err := json.MarshalIndent(flowGraph, "", "  ")
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.SetBodyString("Failed to encode flow graph: " + err.Error())
+		return
+	}
+
+	ctx.SetContentType("application/json")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBody(flowGraphJSON)
+}
+
+// loadFlowGraph builds the graph of the requested flow. If the request has a window, the graph is annotated with
+// the traffic of the sessions of the flow that were created within the window.
+func loadFlowGraph(ctx *fasthttp.RequestCtx) (*visual.Graph, bool) {
+
 	tenant := ctx.UserValue("tenant").(string)
 	realm := ctx.UserValue("realm").(string)
 	flowPath := ctx.UserValue("flow").(string)
@@ -108,14 +203,25 @@ func HandleFlowGraphSVG(ctx *fasthttp.RequestCtx) {
 		// Return a bad request if the flow name is missing
 		ctx.SetStatusCode(fasthttp.StatusBadRequest)
 		ctx.SetBodyString("Missing query flow")
-		return
+		return nil, false
+	}
+
+	var window time.Duration
+	if windowParam := string(ctx.QueryArgs().Peek("window")); windowParam != "" {
+		var err error
+		window, err = time.ParseDuration(windowParam)
+		if err != nil || window <= 0 {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			ctx.SetBodyString(fmt.Sprintf("Invalid window %q, expected a duration like 1h", windowParam))
+			return nil, false
+		}
 	}
 
 	loadedRealm, ok := service.GetServices().RealmService.GetRealm(tenant, realm)
 	if !ok {
 		ctx.SetStatusCode(fasthttp.StatusNotFound)
 		ctx.SetBodyString("realm not found")
-		return
+		return nil, false
 	}
 
 	// Look up the flow in the registry
@@ -125,37 +231,22 @@ func HandleFlowGraphSVG(ctx *fasthttp.RequestCtx) {
 		// Return 404 if flow is not found
 		ctx.SetStatusCode(fasthttp.StatusNotFound)
 		ctx.SetBodyString(fmt.Sprintf("Flow not found: %q", flowPath))
-		return
+		return nil, false
 	}
 
-	// Generate the DOT representation for the flow graph
-	dot, err := visual.RenderDOTGraph(flow.Definition)
-	if err != nil {
-
-		logger.GetRequestLogger(ctx).Warn().Err(err).Msg("Failed to generate SVG")
-		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
-		ctx.SetBodyString(fmt.Sprintf("Failed to generate SVG: %v", err))
-		return
+	if window == 0 {
+		return visual.BuildGraph(flow.Definition, nil), true
 	}
 
-	// Prepare the SVG output buffer
-	var out bytes.Buffer
-
-	// Use the `dot` command to convert the DOT string into an SVG image
-	cmd := exec.Command("dot", "-Tsvg")
-	cmd.Stdin = bytes.NewReader([]byte(dot)) // Pass the DOT data as input
-	cmd.Stdout = &out                        // Capture the SVG output in the buffer
-
-	// Run the command and check for errors
-	if err := cmd.Run(); err != nil {
-		// Return an internal server error if Graphviz fails
+	since := time.Now().Add(-window)
+	sessions, err := service.GetServices().SessionsService.ListAuthenticationSessions(ctx, tenant, realm, flow.Id, since)
+	if err != nil {
+		logger.GetRequestLogger(ctx).Warn().Err(err).Msg("Failed to list sessions")
 		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
-		ctx.SetBodyString(fmt.Sprintf("Failed to generate SVG: %v", err))
-		return
+		ctx.SetBodyString(fmt.Sprintf("Failed to list sessions: %v", err))
+		return nil, false
 	}
 
-	// Set the content type to image/svg+xml and return the SVG data
-	ctx.SetContentType("image/svg+xml")
-	ctx.SetStatusCode(fasthttp.StatusOK)
-	ctx.SetBody(out.Bytes())
+	traffic := visual.AggregateTraffic(flow.Definition, sessions, since)
+	return visual.BuildGraph(flow.Definition, traffic), true
 }
@@ -70,7 +70,7 @@ func handleReadiness(ctx *fasthttp.RequestCtx) {
 
 // handleInfo returns basic service information
 // @Summary Get service information
-// @Description Returns basic information about the service including version
+// @Description Returns basic information about the service including version and the loaded configuration version
 // @Tags Health
 // @Produce json
 // @Success 200 {object} object "Service information"
@@ -107,6 +107,11 @@ func handleInfo(ctx *fasthttp.RequestCtx) {
 	// Add services info directly to the main structure
 	info["services"] = servicesInfo
 
+	// The version of the latest configuration change applied on this instance
+	if services.ConfigChangeService != nil {
+		info["config_version"] = services.ConfigChangeService.GetConfigVersion()
+	}
+
 	// Get database implementations
 	databases, err := dbinit.GetDatabaseConnections()
 	if err != nil {
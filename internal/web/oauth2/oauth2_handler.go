@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Identityplane/GoAM/internal/auth/graph"
 	"github.com/Identityplane/GoAM/internal/lib/oauth2"
@@ -74,6 +77,12 @@ func HandleAuthorizeEndpoint(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	// SAML service providers sign in through the saml endpoints
+	if application.Type == model.ApplicationTypeSaml {
+		RenderOauth2ErrorWithoutRedirect(ctx, oauth2.ErrorUnauthorizedClient, "Client is not an oauth2 client")
+		return
+	}
+
 	if len(application.RedirectUris) == 0 {
 		RenderOauth2ErrorWithoutRedirect(ctx, oauth2.ErrorInvalidRequest, "No redirect URI found for client")
 		return
@@ -105,12 +114,35 @@ func HandleAuthorizeEndpoint(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	flowId, acrValue, err := getFlowIdForRequest(flowId, oauth2request, application)
+	flowId, acrMapping, err := getFlowIdForRequest(flowId, oauth2request, application)
 	if err != nil {
 		RenderOauth2Error(ctx, oauth2.ErrorInvalidRequest, err.Error(), oauth2request, redirectUri, application)
 		return
 	}
 
+	// If the user has a device session below the level of the acr we only run the step up flow of the acr mapping
+	acrValue := ""
+	var stepUpUser *model.User
+	var stepUpDevice *model.DeviceAttributeValue
+	if acrMapping != nil {
+		acrValue = acrMapping.Acr
+
+		cookieName := acrMapping.DeviceCookie
+		if cookieName == "" {
+			cookieName = service.DEFAULT_STEP_UP_DEVICE_COOKIE
+		}
+		deviceCookie := string(ctx.Request.Header.Cookie(cookieName))
+
+		stepUpUser, stepUpDevice, err = service.GetServices().OAuth2Service.GetStepUpDevice(tenant, realm, deviceCookie, acrMapping, oauth2request)
+		if err != nil {
+			RenderOauth2Error(ctx, oauth2.ErrorServerError, "Internal server error. Cannot load device session", oauth2request, redirectUri, application)
+			return
+		}
+		if stepUpDevice != nil {
+			flowId = acrMapping.StepUpFlow
+		}
+	}
+
 	// Load the realm
 	loadedRealm, ok := service.GetServices().RealmService.GetRealm(tenant, realm)
 	if !ok {
@@ -163,6 +195,10 @@ func HandleAuthorizeEndpoint(ctx *fasthttp.RequestCtx) {
 	session.Oauth2SessionInformation.AuthorizeRequest = oauth2request
 	session.Oauth2SessionInformation.Acr = acrValue
 
+	if stepUpDevice != nil {
+		startStepUp(session, stepUpUser, stepUpDevice)
+	}
+
 	session, oauth2error = peekGraphExecutionForPromptParameter(session, flow, loadedRealm)
 
 	if oauth2error != nil {
@@ -443,11 +479,11 @@ func RenderOauth2Error(ctx *fasthttp.RequestCtx, errorCode string, errorDescript
 	ctx.Response.Header.Set("Pragma", "no-cache")
 }
 
-func getFlowIdForRequest(queryFlowId string, oauth2request *model.AuthorizeRequest, application *model.Application) (string, string, error) {
+func getFlowIdForRequest(queryFlowId string, oauth2request *model.AuthorizeRequest, application *model.Application) (string, *model.AcrMapping, error) {
 
 	// First check if a flow was specified in the query parameters
 	flowId := ""
-	acr := ""
+	var acrMapping *model.AcrMapping
 	if queryFlowId != "" {
 		// Validate that the specified flow is in the allowed flows
 		flowAllowed := false
@@ -459,17 +495,17 @@ func getFlowIdForRequest(queryFlowId string, oauth2request *model.AuthorizeReque
 			}
 		}
 		if !flowAllowed {
-			return "", "", fmt.Errorf("flow '%s' is not in the allowed authentication flows", queryFlowId)
+			return "", nil, fmt.Errorf("flow '%s' is not in the allowed authentication flows", queryFlowId)
 		}
 	}
 
 	// If no flow was specified in query, check the acr mappings for a acr value of the request
 	if flowId == "" && application != nil && application.Settings != nil && application.Settings.ArcMapping != nil {
-		for _, arcMapping := range application.Settings.ArcMapping {
+		for i, arcMapping := range application.Settings.ArcMapping {
 			for _, acrValue := range oauth2request.AcrValues {
 				if arcMapping.Acr == acrValue {
 					flowId = arcMapping.Flow
-					acr = acrValue
+					acrMapping = &application.Settings.ArcMapping[i]
 					break
 				}
 			}
@@ -479,11 +515,24 @@ func getFlowIdForRequest(queryFlowId string, oauth2request *model.AuthorizeReque
 	// if the flow id is not set yet we take the first flow of the allowed flows
 	if flowId == "" {
 		if len(application.AllowedAuthenticationFlows) == 0 {
-			return "", "", fmt.Errorf("no allowed authentication flows")
+			return "", nil, fmt.Errorf("no allowed authentication flows")
 		}
 
 		flowId = application.AllowedAuthenticationFlows[0]
 	}
 
-	return flowId, acr, nil
+	return flowId, acrMapping, nil
+}
+
+// startStepUp starts the session with the user and the verified methods of the device session, so that the step up
+// flow only needs to verify the missing factor
+func startStepUp(session *model.AuthenticationSession, user *model.User, device *model.DeviceAttributeValue) {
+	now := time.Now()
+
+	session.User = user
+	session.AuthMethods = slices.Clone(device.CurrentSession(now).AuthMethods)
+	session.AuthMethodsUserID = user.ID
+	session.Context["device"] = device.DeviceID
+	session.Context["loa"] = strconv.Itoa(device.CurrentLoa(now))
+	session.Oauth2SessionInformation.StepUpDevice = device.DeviceID
 }
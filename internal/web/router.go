@@ -9,6 +9,7 @@ import (
 	"github.com/Identityplane/GoAM/internal/web/auth_api"
 	"github.com/Identityplane/GoAM/internal/web/debug"
 	"github.com/Identityplane/GoAM/internal/web/oauth2"
+	"github.com/Identityplane/GoAM/internal/web/saml"
 
 	"github.com/fasthttp/router"
 	"github.com/valyala/fasthttp"
@@ -29,6 +30,10 @@ func New() *router.Router {
 	admin.GET("/tenants/check-availability/{tenant_name}", adminMiddlewareAllowsAll(admin_api.HandleTenantNameAvailable))
 	admin.POST("/tenants", adminMiddlewareAllowsAll(admin_api.HandleCreateTenant))
 
+	// Background maintenance jobs
+	admin.GET("/system/maintenance/jobs", adminMiddleware(admin_api.HandleListMaintenanceJobs))
+	admin.POST("/system/maintenance/jobs/{job}/run", adminMiddleware(admin_api.HandleRunMaintenanceJob))
+
 	admin.GET("/{tenant}/{realm}/users", adminMiddleware(admin_api.HandleListUsers))
 	admin.GET("/{tenant}/{realm}/users/stats", adminMiddleware(admin_api.HandleGetUserStats))
 	admin.GET("/{tenant}/{realm}/users/{id}", adminMiddleware(admin_api.HandleGetUser))
@@ -45,6 +50,8 @@ func New() *router.Router {
 	admin.DELETE("/{tenant}/{realm}/users/{id}/attributes/{attribute-id}", adminMiddleware(admin_api.HandleDeleteUserAttribute))
 
 	admin.GET("/{tenant}/{realm}/dashboard", adminMiddleware(admin_api.HandleDashboard))
+	admin.GET("/{tenant}/{realm}/dashboard/flows", adminMiddleware(admin_api.HandleDashboardFlows))
+	admin.GET("/{tenant}/{realm}/dashboard/flows/{flow}", adminMiddleware(admin_api.HandleDashboardFlow))
 
 	admin.GET("/{tenant}/{realm}/", adminMiddleware(admin_api.HandleGetRealm))
 	admin.POST("/{tenant}/{realm}/", adminMiddleware(admin_api.HandleCreateRealm))
@@ -68,14 +75,27 @@ func New() *router.Router {
 
 	// Flow defintion routes
 	admin.POST("/{tenant}/{realm}/flows/validate", adminMiddleware(admin_api.HandleValidateFlowDefinition))
+	admin.POST("/{tenant}/{realm}/flows/tests", adminMiddleware(admin_api.HandleRunRealmFlowTests))
+	admin.POST("/{tenant}/{realm}/flows/{flow}/tests", adminMiddleware(admin_api.HandleRunFlowTests))
 	admin.GET("/{tenant}/{realm}/flows/{flow}/definition", adminMiddleware(admin_api.HandleGetFlowDefintion))
 	admin.PUT("/{tenant}/{realm}/flows/{flow}/definition", adminMiddleware(admin_api.HandlePutFlowDefintion))
 
+	// Flow version routes
+	admin.GET("/{tenant}/{realm}/flows/{flow}/versions", adminMiddleware(admin_api.HandleListFlowVersions))
+	admin.POST("/{tenant}/{realm}/flows/{flow}/versions", adminMiddleware(admin_api.HandleCreateFlowVersion))
+	admin.GET("/{tenant}/{realm}/flows/{flow}/versions/diff", adminMiddleware(admin_api.HandleDiffFlowVersions))
+	admin.GET("/{tenant}/{realm}/flows/{flow}/versions/{version}", adminMiddleware(admin_api.HandleGetFlowVersion))
+	admin.POST("/{tenant}/{realm}/flows/{flow}/versions/{version}/publish", adminMiddleware(admin_api.HandlePublishFlowVersion))
+	admin.POST("/{tenant}/{realm}/flows/{flow}/rollback", adminMiddleware(admin_api.HandleRollbackFlow))
+	admin.GET("/{tenant}/{realm}/flows/{flow}/variants", adminMiddleware(admin_api.HandleGetFlowVariantMetrics))
+
 	// Node management routes
 	admin.GET("/{tenant}/{realm}/nodes", adminMiddleware(admin_api.HandleListNodes))
 
 	// Debug routes
 	r.GET("/{tenant}/{realm}/debug/{flow}/graph.svg", adminMiddleware(debug.HandleFlowGraphSVG))
+	r.GET("/{tenant}/{realm}/debug/{flow}/graph.mmd", adminMiddleware(debug.HandleFlowGraphMermaid))
+	r.GET("/{tenant}/{realm}/debug/{flow}/graph.json", adminMiddleware(debug.HandleFlowGraphJSON))
 
 	// Static files
 	r.GET("/{tenant}/{realm}/static/{filename}", DisableRequestLogging(WrapMiddleware(StaticHandler)))
@@ -118,6 +138,16 @@ func New() *router.Router {
 	// OIDC JWKS endpoint
 	r.GET("/{tenant}/{realm}/oauth2/.well-known/jwks.json", cors(WrapMiddleware(oauth2.HandleJWKs)))
 
+	// SAML 2.0 identity provider
+	r.GET("/{tenant}/{realm}/saml/metadata", cors(WrapMiddleware(saml.HandleMetadata)))
+	r.GET("/{tenant}/{realm}/saml/sso", WrapMiddleware(saml.HandleSingleSignOn))
+	r.POST("/{tenant}/{realm}/saml/sso", WrapMiddleware(saml.HandleSingleSignOn))
+	r.GET("/{tenant}/{realm}/saml/sso/init", WrapMiddleware(saml.HandleIdpInitiatedSingleSignOn))
+	r.GET("/{tenant}/{realm}/saml/finish", WrapMiddleware(saml.HandleFinish))
+
+	// Assertion consumer service of the samlLogin node
+	r.POST("/{tenant}/{realm}/saml/acs", WrapMiddleware(saml.HandleAssertionConsumerService))
+
 	// handleNotFound is the fallback handler for unmatched routes
 	redirectUrl = config.ServerSettings.NotFoundRedirectUrl
 	r.NotFound = WrapMiddleware(func(ctx *fasthttp.RequestCtx) {
@@ -0,0 +1,383 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"html/template"
+	"slices"
+
+	"github.com/Identityplane/GoAM/internal/auth/graph"
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/internal/lib/saml"
+	"github.com/Identityplane/GoAM/internal/logger"
+	"github.com/Identityplane/GoAM/internal/service"
+	"github.com/Identityplane/GoAM/internal/web/auth"
+	"github.com/Identityplane/GoAM/internal/web/webutils"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+// postFormTemplate posts a SAML response with the HTTP-POST binding, to the assertion consumer service of a service
+// provider or to the realm itself
+var postFormTemplate = template.Must(template.New("saml_post").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Signing in</title></head>
+<body>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="SAMLResponse" value="{{.Response}}">
+{{if .RelayState}}<input type="hidden" name="RelayState" value="{{.RelayState}}">{{end}}
+{{if .Resume}}<input type="hidden" name="resume" value="true">{{end}}
+<noscript><button type="submit">Continue</button></noscript>
+</form>
+<script nonce="{{.CspNonce}}">document.forms[0].submit();</script>
+</body>
+</html>`))
+
+// HandleMetadata returns the metadata of the SAML identity provider of the realm
+// @Summary SAML IdP Metadata
+// @Description Returns the SAML 2.0 metadata of the identity provider with its signing certificates and single sign-on endpoints
+// @Tags SAML
+// @Produce xml
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Success 200 {string} string "SAML metadata"
+// @Failure 404 {string} string "Realm not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /{tenant}/{realm}/saml/metadata [get]
+func HandleMetadata(ctx *fasthttp.RequestCtx) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+
+	loadedRealm, ok := service.GetServices().RealmService.GetRealm(tenant, realm)
+	if !ok {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		ctx.SetBodyString("realm not found")
+		return
+	}
+
+	metadata, err := service.GetServices().SamlService.GetMetadata(ctx, tenant, realm, webutils.GetUrlForRealm(ctx, loadedRealm.Config))
+	if err != nil {
+		log := logger.GetGoamLogger()
+		log.Error().Err(err).Msg("failed to create saml metadata")
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.SetBodyString("Internal server error. Cannot create metadata")
+		return
+	}
+
+	ctx.SetContentType("application/samlmetadata+xml")
+	ctx.SetBodyString(metadata)
+}
+
+// HandleSingleSignOn handles the AuthnRequest of a service provider (SP initiated SSO)
+// @Summary SAML Single Sign-On Endpoint
+// @Description Handles a SAML 2.0 AuthnRequest with the HTTP-Redirect (GET) or HTTP-POST (POST) binding and redirects to the login of the flow of the service provider
+// @Tags SAML
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Param SAMLRequest query string true "Deflated and base64 encoded AuthnRequest, or base64 encoded as form parameter for the HTTP-POST binding"
+// @Param RelayState query string false "Relay state that is returned to the service provider"
+// @Param flow query string false "Flow of the allowed authentication flows of the service provider"
+// @Success 302 {string} string "Redirect to the login page"
+// @Failure 400 {string} string "Invalid request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /{tenant}/{realm}/saml/sso [get]
+// @Router /{tenant}/{realm}/saml/sso [post]
+func HandleSingleSignOn(ctx *fasthttp.RequestCtx) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+
+	var request *saml.AuthnRequest
+	var relayState string
+	var err error
+
+	if ctx.IsPost() {
+		samlRequest := string(ctx.PostArgs().Peek("SAMLRequest"))
+		relayState = string(ctx.PostArgs().Peek("RelayState"))
+		if samlRequest == "" {
+			renderSamlError(ctx, fasthttp.StatusBadRequest, "Missing SAMLRequest")
+			return
+		}
+		request, err = saml.DecodePostRequest(samlRequest)
+	} else {
+		samlRequest := string(ctx.QueryArgs().Peek("SAMLRequest"))
+		relayState = string(ctx.QueryArgs().Peek("RelayState"))
+		if samlRequest == "" {
+			renderSamlError(ctx, fasthttp.StatusBadRequest, "Missing SAMLRequest")
+			return
+		}
+		request, err = saml.DecodeRedirectRequest(samlRequest)
+	}
+	if err != nil {
+		renderSamlError(ctx, fasthttp.StatusBadRequest, "Invalid SAMLRequest: "+err.Error())
+		return
+	}
+
+	application, ok := service.GetServices().SamlService.GetServiceProvider(tenant, realm, request.Issuer)
+	if !ok {
+		renderSamlError(ctx, fasthttp.StatusBadRequest, "Unknown service provider: "+request.Issuer)
+		return
+	}
+
+	samlSession, err := service.GetServices().SamlService.CreateSamlSession(application, request.ID, request.AssertionConsumerServiceURL, request.NameIdFormat(), relayState)
+	if err != nil {
+		renderSamlError(ctx, fasthttp.StatusBadRequest, err.Error())
+		return
+	}
+
+	startSamlFlow(ctx, application, samlSession, request.IsPassive)
+}
+
+// HandleIdpInitiatedSingleSignOn starts a login to a service provider without a request of the service provider
+// @Summary SAML IdP Initiated Single Sign-On
+// @Description Authenticates the user with the flow of the service provider and posts an unsolicited response to its default assertion consumer service
+// @Tags SAML
+// @Produce html
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Param sp query string true "Client ID of the service provider"
+// @Param RelayState query string false "Relay state that is sent to the service provider"
+// @Param flow query string false "Flow of the allowed authentication flows of the service provider"
+// @Success 302 {string} string "Redirect to the login page"
+// @Failure 400 {string} string "Invalid request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /{tenant}/{realm}/saml/sso/init [get]
+func HandleIdpInitiatedSingleSignOn(ctx *fasthttp.RequestCtx) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+	clientId := string(ctx.QueryArgs().Peek("sp"))
+
+	application, ok := service.GetServices().ApplicationService.GetApplication(tenant, realm, clientId)
+	if !ok || application.Type != model.ApplicationTypeSaml {
+		renderSamlError(ctx, fasthttp.StatusBadRequest, "Unknown service provider: "+clientId)
+		return
+	}
+
+	if application.Settings == nil || application.Settings.Saml == nil || !application.Settings.Saml.AllowIdpInitiated {
+		renderSamlError(ctx, fasthttp.StatusBadRequest, "IdP initiated SSO is not allowed for the service provider")
+		return
+	}
+
+	samlSession, err := service.GetServices().SamlService.CreateSamlSession(application, "", "", "", string(ctx.QueryArgs().Peek("RelayState")))
+	if err != nil {
+		renderSamlError(ctx, fasthttp.StatusBadRequest, err.Error())
+		return
+	}
+
+	startSamlFlow(ctx, application, samlSession, false)
+}
+
+// startSamlFlow creates the authentication session for the service provider and runs the flow until it prompts the
+// user, a passive request fails if the flow would prompt
+func startSamlFlow(ctx *fasthttp.RequestCtx, application *model.Application, samlSession *model.SamlSession, isPassive bool) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+
+	flowId, err := getFlowIdForRequest(string(ctx.QueryArgs().Peek("flow")), application)
+	if err != nil {
+		renderSamlError(ctx, fasthttp.StatusBadRequest, err.Error())
+		return
+	}
+
+	loadedRealm, ok := service.GetServices().RealmService.GetRealm(tenant, realm)
+	if !ok {
+		renderSamlError(ctx, fasthttp.StatusNotFound, "Realm not found")
+		return
+	}
+	baseUrl := webutils.GetUrlForRealm(ctx, loadedRealm.Config)
+
+	flow, ok := service.GetServices().FlowService.GetFlowById(tenant, realm, flowId)
+	if !ok {
+		renderSamlError(ctx, fasthttp.StatusBadRequest, "Flow not found: "+flowId)
+		return
+	}
+
+	flow, ok = service.GetServices().FlowService.GetFlowForExecution(flow.Route, loadedRealm)
+	if !ok || flow.Definition == nil {
+		renderSamlError(ctx, fasthttp.StatusBadRequest, "Cannot load flow for execution: "+flowId)
+		return
+	}
+
+	session, authErr := auth.CreateNewAuthenticationSession(ctx, loadedRealm.Config, flow, false)
+	if authErr != nil {
+		renderSamlError(ctx, fasthttp.StatusInternalServerError, "Internal server error. Cannot create session")
+		return
+	}
+
+	auth.SetHttpAuthContextFromRequest(session, ctx)
+	session.FinishUri = baseUrl + "/saml/finish"
+	session.SamlSessionInformation = samlSession
+
+	// Run the flow until it prompts, so that a flow that does not need the user finishes right away
+	session, err = graph.Run(flow.Definition, session, nil, loadedRealm.Repositories)
+	if err != nil {
+		log := logger.GetGoamLogger()
+		log.Debug().Err(err).Msg("flow resulted in error")
+		renderSamlError(ctx, fasthttp.StatusInternalServerError, "Internal server error. Flow resulted in error")
+		return
+	}
+
+	auth.SetHttpAuthContextToResponse(session, ctx, loadedRealm.Config)
+
+	if session.Result != nil {
+		ctx.SetUserValue("session", session)
+		HandleFinish(ctx)
+		return
+	}
+
+	if isPassive {
+		response, err := service.GetServices().SamlService.CreateErrorResponse(baseUrl, samlSession, saml.StatusResponder, saml.StatusNoPassive)
+		if err != nil {
+			renderSamlError(ctx, fasthttp.StatusInternalServerError, "Internal server error. Cannot create response")
+			return
+		}
+		renderPostForm(ctx, samlSession, response)
+		return
+	}
+
+	service.GetServices().SessionsService.CreateOrUpdateAuthenticationSession(ctx, tenant, realm, *session)
+	webutils.RedirectTo(ctx, session.LoginUriNext)
+}
+
+// HandleFinish posts the response to the service provider after the flow has finished
+// This endpoint is called by the login page after the flow has been completed
+func HandleFinish(ctx *fasthttp.RequestCtx) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+
+	// Load session from context if available, otherwise from the cookie
+	var session *model.AuthenticationSession
+	if sessionAny := ctx.UserValue("session"); sessionAny != nil {
+		session = sessionAny.(*model.AuthenticationSession)
+	}
+
+	if session == nil {
+		var ok bool
+		session, ok = auth.GetAuthenticationSession(ctx, tenant, realm)
+		if !ok {
+			renderSamlError(ctx, fasthttp.StatusBadRequest, "No authentication session")
+			return
+		}
+	}
+
+	if session.SamlSessionInformation == nil {
+		renderSamlError(ctx, fasthttp.StatusBadRequest, "Authentication session has no SAML request")
+		return
+	}
+
+	loadedRealm, ok := service.GetServices().RealmService.GetRealm(tenant, realm)
+	if !ok {
+		renderSamlError(ctx, fasthttp.StatusNotFound, "Realm not found")
+		return
+	}
+
+	response, err := service.GetServices().SamlService.CreateResponse(ctx, tenant, realm, webutils.GetUrlForRealm(ctx, loadedRealm.Config), session)
+	if err != nil {
+		log := logger.GetGoamLogger()
+		log.Debug().Err(err).Msg("failed to create saml response")
+		renderSamlError(ctx, fasthttp.StatusInternalServerError, "Internal server error. Cannot create response")
+		return
+	}
+
+	// The response is sent, the authentication session cannot be used again
+	if session.SessionIdHash != "" && !session.Debug {
+		service.GetServices().SessionsService.DeleteAuthenticationSession(ctx, tenant, realm, session.SessionIdHash)
+	}
+
+	renderPostForm(ctx, session.SamlSessionInformation, response)
+}
+
+// HandleAssertionConsumerService receives the responses of federated identity providers and passes them on to the
+// samlLogin node of the authentication session
+// @Summary SAML Assertion Consumer Service
+// @Description Receives the SAML response of a federated identity provider with the HTTP-POST binding and forwards it to the current node of the login
+// @Tags SAML
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param tenant path string true "Tenant ID"
+// @Param realm path string true "Realm ID"
+// @Param SAMLResponse formData string true "Base64 encoded SAML response"
+// @Param RelayState formData string false "Relay state of the AuthnRequest"
+// @Success 200 {string} string "Page that posts the response again with the session cookie"
+// @Success 307 {string} string "Redirect to the login page that keeps the response"
+// @Failure 400 {string} string "Invalid request"
+// @Router /{tenant}/{realm}/saml/acs [post]
+func HandleAssertionConsumerService(ctx *fasthttp.RequestCtx) {
+	tenant := ctx.UserValue("tenant").(string)
+	realm := ctx.UserValue("realm").(string)
+
+	samlResponse := string(ctx.PostArgs().Peek("SAMLResponse"))
+	if samlResponse == "" {
+		renderSamlError(ctx, fasthttp.StatusBadRequest, "Missing SAMLResponse")
+		return
+	}
+
+	session, ok := auth.GetAuthenticationSession(ctx, tenant, realm)
+	if !ok {
+		// The identity provider posts from its own site, so the browser does not send the SameSite=Lax session
+		// cookie. Posting the response again from this page is a same-site request that includes the cookie.
+		if ctx.PostArgs().Has("resume") {
+			renderSamlError(ctx, fasthttp.StatusBadRequest, "No authentication session")
+			return
+		}
+		writePostForm(ctx, string(ctx.Path()), samlResponse, string(ctx.PostArgs().Peek("RelayState")), true)
+		return
+	}
+
+	// 307 keeps the method and the body, so the login page receives the response as input of the current node
+	ctx.Response.Header.Set("Location", session.LoginUriNext)
+	ctx.Response.Header.Set("Cache-Control", "no-store")
+	ctx.SetStatusCode(fasthttp.StatusTemporaryRedirect)
+}
+
+// renderPostForm renders the page that posts the response to the assertion consumer service
+func renderPostForm(ctx *fasthttp.RequestCtx, samlSession *model.SamlSession, response string) {
+	writePostForm(ctx, samlSession.AcsUrl, base64.StdEncoding.EncodeToString([]byte(response)), samlSession.RelayState, false)
+}
+
+func writePostForm(ctx *fasthttp.RequestCtx, action, encodedResponse, relayState string, resume bool) {
+	cspNonce := lib.GenerateSecureSessionID()
+	ctx.SetUserValue("cspNonce", cspNonce)
+
+	var buf bytes.Buffer
+	err := postFormTemplate.Execute(&buf, map[string]any{
+		"Action":     action,
+		"Response":   encodedResponse,
+		"RelayState": relayState,
+		"Resume":     resume,
+		"CspNonce":   cspNonce,
+	})
+	if err != nil {
+		renderSamlError(ctx, fasthttp.StatusInternalServerError, "Internal server error. Cannot render response")
+		return
+	}
+
+	ctx.Response.Header.Set("Cache-Control", "no-store")
+	ctx.Response.Header.Set("Pragma", "no-cache")
+	ctx.SetContentType("text/html; charset=utf-8")
+	ctx.SetBody(buf.Bytes())
+}
+
+func renderSamlError(ctx *fasthttp.RequestCtx, statusCode int, msg string) {
+	ctx.SetStatusCode(statusCode)
+	auth.SimpleErrorHtml(ctx, html.EscapeString(msg))
+}
+
+// getFlowIdForRequest returns the flow of the query if it is allowed for the service provider, otherwise its first allowed flow
+func getFlowIdForRequest(queryFlowId string, application *model.Application) (string, error) {
+	if queryFlowId != "" {
+		if !slices.Contains(application.AllowedAuthenticationFlows, queryFlowId) {
+			return "", fmt.Errorf("flow '%s' is not in the allowed authentication flows", queryFlowId)
+		}
+		return queryFlowId, nil
+	}
+
+	if len(application.AllowedAuthenticationFlows) == 0 {
+		return "", fmt.Errorf("no allowed authentication flows")
+	}
+
+	return application.AllowedAuthenticationFlows[0], nil
+}
@@ -92,3 +92,19 @@ func GetRequestCookies(ctx *fasthttp.RequestCtx) map[string]string {
 	})
 	return cookies
 }
+
+func GetRequestQuery(ctx *fasthttp.RequestCtx) map[string]string {
+	query := make(map[string]string)
+	ctx.QueryArgs().VisitAll(func(key []byte, value []byte) {
+		query[string(key)] = string(value)
+	})
+	return query
+}
+
+// GetRequestIP returns the ip of the client as determined by the middleware, falls back to the remote address
+func GetRequestIP(ctx *fasthttp.RequestCtx) string {
+	if ip, ok := ctx.UserValue("remote_ip").(string); ok && ip != "" {
+		return ip
+	}
+	return ctx.RemoteIP().String()
+}
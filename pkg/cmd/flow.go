@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Identityplane/GoAM/internal/auth/graph"
+	"github.com/Identityplane/GoAM/internal/flowtest"
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+)
+
+var suiteFiles []string
+var flowsDir string
+var verbose bool
+
+func init() {
+	flowTestCmd.Flags().StringArrayVar(&suiteFiles, "suite", nil, "Test suite file, can be repeated. Only allowed with a single flow file")
+	flowTestCmd.Flags().StringVar(&flowsDir, "flows-dir", "", "Directory with the flows that are used as subflows, <id>.yaml. Defaults to the directory of the flow")
+	flowTestCmd.Flags().BoolVar(&verbose, "verbose", false, "Show the logs of the nodes")
+
+	flowCmd.AddCommand(flowTestCmd)
+	rootCmd.AddCommand(flowCmd)
+}
+
+var flowCmd = &cobra.Command{
+	Use:   "flow",
+	Short: "Work with flow definitions",
+}
+
+var flowTestCmd = &cobra.Command{
+	Use:   "test <flow.yaml>...",
+	Short: "Run the tests of flow definitions",
+	Long: `Runs the tests in the tests section of each flow definition and the tests of the suites given with --suite.
+The flows run in-process with an in-memory user repository, emails and sms are recorded instead of sent.
+The command exits with status 1 if a test fails.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(suiteFiles) > 0 && len(args) > 1 {
+			fmt.Fprintln(cmd.ErrOrStderr(), "--suite can only be used with a single flow file")
+			os.Exit(1)
+		}
+
+		if !verbose {
+			zerolog.SetGlobalLevel(zerolog.WarnLevel)
+		}
+
+		total, failed := 0, 0
+		for _, flowFile := range args {
+			tests, failures, err := runFlowTests(cmd.OutOrStdout(), flowFile, suiteFiles)
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", flowFile, err)
+				os.Exit(1)
+			}
+			total += tests
+			failed += failures
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "\n%d tests, %d failed\n", total, failed)
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// runFlowTests runs the tests of the flow file and of the suite files and prints the results
+func runFlowTests(out io.Writer, flowFile string, suiteFiles []string) (int, int, error) {
+
+	content, err := os.ReadFile(flowFile) // #nosec G304 (the file is given by the user of the command)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	flow, err := lib.LoadFlowDefinitonFromString(string(content))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	dir := flowsDir
+	if dir == "" {
+		dir = filepath.Dir(flowFile)
+	}
+	flowId := strings.TrimSuffix(filepath.Base(flowFile), filepath.Ext(flowFile))
+	flow, err = graph.ExpandSubflows(flowId, flow, fileSubflowLoader(dir))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	suite, err := flowtest.LoadSuite(string(content))
+	if err != nil {
+		return 0, 0, err
+	}
+	if suite.Name == "" {
+		suite.Name = flowId
+	}
+	suites := []*flowtest.Suite{suite}
+
+	for _, suiteFile := range suiteFiles {
+		content, err := os.ReadFile(suiteFile) // #nosec G304 (the file is given by the user of the command)
+		if err != nil {
+			return 0, 0, err
+		}
+		suite, err := flowtest.LoadSuite(string(content))
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", suiteFile, err)
+		}
+		if suite.Name == "" {
+			suite.Name = suiteFile
+		}
+		suites = append(suites, suite)
+	}
+
+	total, failed := 0, 0
+	for _, suite := range suites {
+		if len(suite.Tests) == 0 {
+			continue
+		}
+
+		result := flowtest.Run(flow, suite)
+		printSuiteResult(out, result)
+		total += len(result.Tests)
+		failed += result.Failed()
+	}
+
+	return total, failed, nil
+}
+
+func printSuiteResult(out io.Writer, result *flowtest.SuiteResult) {
+	fmt.Fprintln(out, result.Name)
+	for _, test := range result.Tests {
+		if test.Passed {
+			fmt.Fprintf(out, "  PASS  %s\n", test.Name)
+			continue
+		}
+
+		fmt.Fprintf(out, "  FAIL  %s\n", test.Name)
+		fmt.Fprintf(out, "        path: %s\n", strings.Join(test.Path, " > "))
+		for _, failure := range test.Failures {
+			fmt.Fprintf(out, "        %s\n", failure)
+		}
+	}
+}
+
+// fileSubflowLoader loads the child flows of subflow nodes from <dir>/<id>.yaml
+func fileSubflowLoader(dir string) graph.SubflowLoader {
+	return func(flowId string) (*model.FlowDefinition, error) {
+		content, err := os.ReadFile(filepath.Join(dir, flowId+".yaml")) // #nosec G304 (the dir is given by the user of the command)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return lib.LoadFlowDefinitonFromString(string(content))
+	}
+}
@@ -22,6 +22,7 @@ func TemplateTestApplicationCRUD(t *testing.T, db ApplicationDB) {
 		Tenant:                     testTenant,
 		Realm:                      testRealm,
 		ClientId:                   "test-app",
+		Type:                       model.ApplicationTypeOAuth2,
 		ClientSecret:               "test-secret",
 		Confidential:               true,
 		ConsentRequired:            false,
@@ -58,6 +59,7 @@ func TemplateTestApplicationCRUD(t *testing.T, db ApplicationDB) {
 		assert.NoError(t, err)
 		assert.NotNil(t, app)
 		assert.Equal(t, testApp.ClientId, app.ClientId)
+		assert.Equal(t, testApp.Type, app.Type)
 		assert.Equal(t, testApp.ClientSecret, app.ClientSecret)
 		assert.Equal(t, testApp.Description, app.Description)
 		assert.Equal(t, testApp.AllowedScopes, app.AllowedScopes)
@@ -92,6 +94,8 @@ func TemplateTestApplicationCRUD(t *testing.T, db ApplicationDB) {
 		app.IdTokenMapping = "custom"
 		app.RedirectUris = []string{"https://example.com/new-callback"}
 		app.Settings.Cookie.HttpOnly = true
+		app.Type = model.ApplicationTypeSaml
+		app.Settings.Saml = &model.SamlSettings{EntityId: "https://sp.example.com", AcsUrls: []string{"https://sp.example.com/acs"}}
 		err = db.UpdateApplication(ctx, app)
 		assert.NoError(t, err)
 
@@ -109,6 +113,8 @@ func TemplateTestApplicationCRUD(t *testing.T, db ApplicationDB) {
 		assert.Equal(t, "custom", updatedApp.IdTokenMapping)
 		assert.Equal(t, []string{"https://example.com/new-callback"}, updatedApp.RedirectUris)
 		assert.Equal(t, true, updatedApp.Settings.Cookie.HttpOnly)
+		assert.Equal(t, model.ApplicationTypeSaml, updatedApp.Type)
+		assert.Equal(t, "https://sp.example.com", updatedApp.Settings.Saml.EntityId)
 	})
 
 	t.Run("ListApplications", func(t *testing.T) {
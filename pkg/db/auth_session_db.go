@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/Identityplane/GoAM/pkg/model"
 )
@@ -20,12 +21,23 @@ type AuthSessionDB interface {
 	// ListAuthSessions lists all authentication sessions for a specific tenant and realm
 	ListAuthSessions(ctx context.Context, tenant, realm string) ([]model.PersistentAuthSession, error)
 
+	// ListAuthSessionsByFlow lists the newest authentication sessions of a flow that were created since the given time,
+	// at most limit sessions
+	ListAuthSessionsByFlow(ctx context.Context, tenant, realm, flowID string, since time.Time, limit int) ([]model.PersistentAuthSession, error)
+
 	// ListAllAuthSessions lists all authentication sessions for a specific tenant
 	ListAllAuthSessions(ctx context.Context, tenant string) ([]model.PersistentAuthSession, error)
 
 	// DeleteAuthSession deletes an authentication session
 	DeleteAuthSession(ctx context.Context, tenant, realm, sessionIDHash string) error
 
-	// DeleteExpiredAuthSessions deletes all expired authentication sessions
-	DeleteExpiredAuthSessions(ctx context.Context, tenant, realm string) error
+	// DeleteExpiredAuthSessions deletes all expired authentication sessions and returns how many were deleted
+	DeleteExpiredAuthSessions(ctx context.Context, tenant, realm string) (int, error)
+
+	// SaveMagicLinkApproval records that the magic link of a session was approved on another device.
+	// Returns false if the link was already approved.
+	SaveMagicLinkApproval(ctx context.Context, tenant, realm, sessionIDHash, linkID string, expiresAt time.Time) (bool, error)
+
+	// ConsumeMagicLinkApproval deletes an unexpired magic link approval and returns true if there was one
+	ConsumeMagicLinkApproval(ctx context.Context, tenant, realm, sessionIDHash, linkID string) (bool, error)
 }
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -139,6 +140,40 @@ func TemplateTestAuthSessionCRUD(t *testing.T, db AuthSessionDB) {
 		assert.True(t, foundDifferent)
 	})
 
+	t.Run("ListAuthSessionsByFlow", func(t *testing.T) {
+		for i, createdAt := range []time.Time{now.Add(-2 * time.Hour), now.Add(-30 * time.Minute), now.Add(-10 * time.Minute), now} {
+			err := db.CreateOrUpdateAuthSession(ctx, &model.PersistentAuthSession{
+				Tenant:             testTenant,
+				Realm:              testRealm,
+				RunID:              fmt.Sprintf("login-run-%d", i),
+				SessionIDHash:      fmt.Sprintf("login-session-hash-%d", i),
+				FlowID:             "login",
+				CreatedAt:          createdAt,
+				ExpiresAt:          createdAt.Add(1 * time.Hour),
+				SessionInformation: []byte(`{"flow_id":"login"}`),
+			})
+			assert.NoError(t, err)
+		}
+
+		// Sessions before the window and of other flows are not listed, the newest come first
+		sessions, err := db.ListAuthSessionsByFlow(ctx, testTenant, testRealm, "login", now.Add(-time.Hour), 10)
+		assert.NoError(t, err)
+		runIDs := []string{}
+		for _, session := range sessions {
+			assert.Equal(t, "login", session.FlowID)
+			runIDs = append(runIDs, session.RunID)
+		}
+		assert.Equal(t, []string{"login-run-3", "login-run-2", "login-run-1"}, runIDs)
+
+		sessions, err = db.ListAuthSessionsByFlow(ctx, testTenant, testRealm, "login", now.Add(-time.Hour), 2)
+		assert.NoError(t, err)
+		assert.Len(t, sessions, 2)
+
+		for i := range 4 {
+			assert.NoError(t, db.DeleteAuthSession(ctx, testTenant, testRealm, fmt.Sprintf("login-session-hash-%d", i)))
+		}
+	})
+
 	t.Run("DeleteAuthSession", func(t *testing.T) {
 		err := db.DeleteAuthSession(ctx, testTenant, testRealm, testSession.SessionIDHash)
 		assert.NoError(t, err)
@@ -164,12 +199,51 @@ func TemplateTestAuthSessionCRUD(t *testing.T, db AuthSessionDB) {
 		assert.NoError(t, err)
 
 		// Delete expired sessions
-		err = db.DeleteExpiredAuthSessions(ctx, testTenant, testRealm)
+		deleted, err := db.DeleteExpiredAuthSessions(ctx, testTenant, testRealm)
 		assert.NoError(t, err)
+		assert.Equal(t, 1, deleted)
 
 		// Verify expired session is deleted
 		session, err := db.GetAuthSessionByHash(ctx, testTenant, testRealm, expiredSession.SessionIDHash)
 		assert.NoError(t, err)
 		assert.Nil(t, session)
 	})
+
+	t.Run("MagicLinkApprovals", func(t *testing.T) {
+		// A link can only be approved once
+		saved, err := db.SaveMagicLinkApproval(ctx, testTenant, testRealm, "waiting-session-hash", "link-1", now.Add(10*time.Minute))
+		assert.NoError(t, err)
+		assert.True(t, saved)
+
+		saved, err = db.SaveMagicLinkApproval(ctx, testTenant, testRealm, "waiting-session-hash", "link-1", now.Add(10*time.Minute))
+		assert.NoError(t, err)
+		assert.False(t, saved)
+
+		// Approvals of other links do not count
+		consumed, err := db.ConsumeMagicLinkApproval(ctx, testTenant, testRealm, "waiting-session-hash", "link-2")
+		assert.NoError(t, err)
+		assert.False(t, consumed)
+
+		// The approval can only be consumed once
+		consumed, err = db.ConsumeMagicLinkApproval(ctx, testTenant, testRealm, "waiting-session-hash", "link-1")
+		assert.NoError(t, err)
+		assert.True(t, consumed)
+
+		consumed, err = db.ConsumeMagicLinkApproval(ctx, testTenant, testRealm, "waiting-session-hash", "link-1")
+		assert.NoError(t, err)
+		assert.False(t, consumed)
+
+		// Expired approvals cannot be consumed and are deleted with the expired sessions
+		saved, err = db.SaveMagicLinkApproval(ctx, testTenant, testRealm, "waiting-session-hash", "link-3", now.Add(-1*time.Minute))
+		assert.NoError(t, err)
+		assert.True(t, saved)
+
+		consumed, err = db.ConsumeMagicLinkApproval(ctx, testTenant, testRealm, "waiting-session-hash", "link-3")
+		assert.NoError(t, err)
+		assert.False(t, consumed)
+
+		deleted, err := db.DeleteExpiredAuthSessions(ctx, testTenant, testRealm)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+	})
 }
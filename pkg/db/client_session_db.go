@@ -35,6 +35,6 @@ type ClientSessionDB interface {
 	// DeleteClientSession deletes a client session
 	DeleteClientSession(ctx context.Context, tenant, realm, sessionID string) error
 
-	// DeleteExpiredClientSessions deletes all expired client sessions
-	DeleteExpiredClientSessions(ctx context.Context, tenant, realm string) error
+	// DeleteExpiredClientSessions deletes all expired client sessions and returns how many were deleted
+	DeleteExpiredClientSessions(ctx context.Context, tenant, realm string) (int, error)
 }
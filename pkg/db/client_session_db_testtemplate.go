@@ -154,8 +154,9 @@ func TemplateTestClientSessionCRUD(t *testing.T, db ClientSessionDB) {
 		assert.NoError(t, err)
 
 		// Delete expired sessions
-		err = db.DeleteExpiredClientSessions(ctx, testTenant, testRealm)
+		deleted, err := db.DeleteExpiredClientSessions(ctx, testTenant, testRealm)
 		assert.NoError(t, err)
+		assert.Equal(t, 1, deleted)
 
 		// Verify expired session is deleted
 		session, err := db.GetClientSessionByID(ctx, testTenant, testRealm, expiredSession.ClientSessionID)
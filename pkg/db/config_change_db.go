@@ -0,0 +1,24 @@
+package db
+
+import (
+	"context"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// ConfigChangeDB stores the log of configuration changes and notifies other instances about new entries
+type ConfigChangeDB interface {
+	// CreateConfigChange appends a change to the log and sets the version assigned by the database
+	CreateConfigChange(ctx context.Context, change *model.ConfigChange) error
+
+	// ListConfigChangesSince lists all changes with a version greater than the given version ordered by version
+	ListConfigChangesSince(ctx context.Context, version int64) ([]model.ConfigChange, error)
+
+	// GetLatestConfigVersion returns the version of the latest change or 0 if there are no changes
+	GetLatestConfigVersion(ctx context.Context) (int64, error)
+
+	// WatchConfigChanges blocks until the context is cancelled or the watch fails and calls notify
+	// whenever new changes might be available. Implementations either listen for database notifications or poll.
+	// notify is also called once the watch is established so that changes made in between are not missed.
+	WatchConfigChanges(ctx context.Context, notify func()) error
+}
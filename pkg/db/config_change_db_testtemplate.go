@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TemplateTestConfigChangeDB is a parameterized test for the configuration change log
+func TemplateTestConfigChangeDB(t *testing.T, db ConfigChangeDB) {
+	ctx := context.Background()
+
+	t.Run("GetLatestConfigVersion on empty log", func(t *testing.T) {
+		version, err := db.GetLatestConfigVersion(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), version)
+	})
+
+	first := &model.ConfigChange{Tenant: "acme", Realm: "customers", EntityType: model.ConfigEntityFlow, EntityId: "login"}
+	second := &model.ConfigChange{Tenant: "acme", Realm: "customers", EntityType: model.ConfigEntityRealm}
+
+	t.Run("CreateConfigChange assigns increasing versions", func(t *testing.T) {
+		require.NoError(t, db.CreateConfigChange(ctx, first))
+		require.NoError(t, db.CreateConfigChange(ctx, second))
+
+		assert.Greater(t, first.Version, int64(0))
+		assert.Greater(t, second.Version, first.Version)
+
+		version, err := db.GetLatestConfigVersion(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, second.Version, version)
+	})
+
+	t.Run("ListConfigChangesSince", func(t *testing.T) {
+		changes, err := db.ListConfigChangesSince(ctx, 0)
+		require.NoError(t, err)
+		require.Len(t, changes, 2)
+		assert.Equal(t, first.Version, changes[0].Version)
+		assert.Equal(t, "login", changes[0].EntityId)
+		assert.Equal(t, model.ConfigEntityFlow, changes[0].EntityType)
+		assert.False(t, changes[0].CreatedAt.IsZero())
+
+		changes, err = db.ListConfigChangesSince(ctx, first.Version)
+		require.NoError(t, err)
+		require.Len(t, changes, 1)
+		assert.Equal(t, second.Version, changes[0].Version)
+		assert.Equal(t, "", changes[0].EntityId)
+	})
+
+	t.Run("WatchConfigChanges notifies about new changes", func(t *testing.T) {
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		notified := make(chan struct{}, 100)
+		go db.WatchConfigChanges(watchCtx, func() {
+			notified <- struct{}{}
+		})
+
+		// The first notification signals that the watch is established
+		select {
+		case <-notified:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected a notification once the watch is established")
+		}
+
+		err := db.CreateConfigChange(ctx, &model.ConfigChange{Tenant: "acme", Realm: "customers", EntityType: model.ConfigEntityApplication, EntityId: "app"})
+		require.NoError(t, err)
+
+		select {
+		case <-notified:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected a notification for the new change")
+		}
+	})
+}
@@ -2,12 +2,19 @@ package db
 
 // DatabaseConnections holds all database connections
 type DatabaseConnections struct {
-	UserDB          UserDB
-	UserAttributeDB UserAttributeDB
-	RealmDB         RealmDB
-	FlowDB          FlowDB
-	ApplicationsDB  ApplicationDB
-	ClientSessionDB ClientSessionDB
-	SigningKeyDB    SigningKeyDB
-	AuthSessionDB   AuthSessionDB
+	UserDB               UserDB
+	UserAttributeDB      UserAttributeDB
+	RealmDB              RealmDB
+	FlowDB               FlowDB
+	FlowVersionDB        FlowVersionDB
+	FlowVariantDB        FlowVariantDB
+	ApplicationsDB       ApplicationDB
+	ClientSessionDB      ClientSessionDB
+	SigningKeyDB         SigningKeyDB
+	AuthSessionDB        AuthSessionDB
+	ConfigChangeDB       ConfigChangeDB
+	JobLockDB            JobLockDB
+	PasswordResetTokenDB PasswordResetTokenDB
+	FlowStatsDB          FlowStatsDB
+	TemplateOverrideDB   TemplateOverrideDB
 }
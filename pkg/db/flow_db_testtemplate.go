@@ -59,6 +59,8 @@ func TemplateTestFlowCRUD(t *testing.T, db FlowDB) {
 		flow.Route = "/updated"
 		flow.DefinitionYaml = "updated: yaml"
 		flow.DebugAllowed = false
+		flow.ActiveVersion = 2
+		flow.Variants = model.FlowVariants{{Name: "control", Version: 1, Weight: 95}, {Name: "redesign", Version: 2, Weight: 5}}
 		err = db.UpdateFlow(ctx, flow)
 		assert.NoError(t, err)
 
@@ -67,6 +69,8 @@ func TemplateTestFlowCRUD(t *testing.T, db FlowDB) {
 		assert.Equal(t, "/updated", updatedFlow.Route)
 		assert.Equal(t, "updated: yaml", updatedFlow.DefinitionYaml)
 		assert.Equal(t, false, updatedFlow.DebugAllowed)
+		assert.Equal(t, 2, updatedFlow.ActiveVersion)
+		assert.Equal(t, flow.Variants, updatedFlow.Variants)
 	})
 
 	t.Run("ListFlows", func(t *testing.T) {
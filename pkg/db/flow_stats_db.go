@@ -0,0 +1,16 @@
+package db
+
+import (
+	"context"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// FlowStatsDB stores the counters of the flow analytics in hourly buckets
+type FlowStatsDB interface {
+	// IncrementFlowStats adds the values of the stats to the stored counters, counters that do not exist are created
+	IncrementFlowStats(ctx context.Context, stats []*model.FlowStat) error
+
+	// ListFlowStats returns the counters of the realm that match the filter
+	ListFlowStats(ctx context.Context, tenant, realm string, filter model.FlowStatsFilter) ([]*model.FlowStat, error)
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TemplateTestFlowStatsDB is a parameterized test for the flow analytics store
+func TemplateTestFlowStatsDB(t *testing.T, db FlowStatsDB) {
+	ctx := context.Background()
+	tenant, realm := "acme", "customers"
+	bucket := time.Now().UTC().Truncate(model.FlowStatsBucketSize)
+
+	stat := func(flowId, clientId string, bucket time.Time, node, metric string, value int64) *model.FlowStat {
+		return &model.FlowStat{Tenant: tenant, Realm: realm, FlowId: flowId, ClientId: clientId, Bucket: bucket, Node: node, Metric: metric, Value: value}
+	}
+
+	t.Run("IncrementFlowStats", func(t *testing.T) {
+		require.NoError(t, db.IncrementFlowStats(ctx, []*model.FlowStat{
+			stat("login", "app", bucket, "", model.FlowStatStarted, 2),
+			stat("login", "app", bucket, "askPassword", model.FlowStatWaiting, 1),
+			stat("login", "", bucket.Add(-2*time.Hour), "", model.FlowStatStarted, 1),
+			stat("register", "app", bucket, "", model.FlowStatStarted, 1),
+		}))
+
+		// Existing counters are increased, waiting counters can also decrease
+		require.NoError(t, db.IncrementFlowStats(ctx, []*model.FlowStat{
+			stat("login", "app", bucket, "", model.FlowStatStarted, 3),
+			stat("login", "app", bucket, "askPassword", model.FlowStatWaiting, -1),
+		}))
+
+		require.NoError(t, db.IncrementFlowStats(ctx, nil))
+	})
+
+	t.Run("ListFlowStats", func(t *testing.T) {
+		stats, err := db.ListFlowStats(ctx, tenant, realm, model.FlowStatsFilter{FlowId: "login", ClientId: "app"})
+		require.NoError(t, err)
+		require.Len(t, stats, 2)
+
+		values := map[string]int64{}
+		for _, s := range stats {
+			assert.Equal(t, "login", s.FlowId)
+			assert.True(t, bucket.Equal(s.Bucket), "bucket %s", s.Bucket)
+			values[s.Metric] = s.Value
+		}
+		assert.Equal(t, map[string]int64{model.FlowStatStarted: 5, model.FlowStatWaiting: 0}, values)
+	})
+
+	t.Run("ListFlowStats by time range", func(t *testing.T) {
+		stats, err := db.ListFlowStats(ctx, tenant, realm, model.FlowStatsFilter{FlowId: "login", From: bucket.Add(-3 * time.Hour), To: bucket})
+		require.NoError(t, err)
+		require.Len(t, stats, 1)
+		assert.Equal(t, "", stats[0].ClientId)
+		assert.Equal(t, int64(1), stats[0].Value)
+
+		stats, err = db.ListFlowStats(ctx, tenant, realm, model.FlowStatsFilter{From: bucket})
+		require.NoError(t, err)
+		assert.Len(t, stats, 3)
+
+		stats, err = db.ListFlowStats(ctx, tenant, "other", model.FlowStatsFilter{})
+		require.NoError(t, err)
+		assert.Empty(t, stats)
+	})
+}
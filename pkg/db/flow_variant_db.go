@@ -0,0 +1,32 @@
+package db
+
+import (
+	"context"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// FlowVariantDB stores the assignments and the sessions of weighted rollouts between flow versions
+type FlowVariantDB interface {
+	// GetFlowVariantAssignment returns the variant a sticky key is assigned to, returns nil if it has none
+	GetFlowVariantAssignment(ctx context.Context, tenant, realm, flowId, stickyKey string) (*model.FlowVariantAssignment, error)
+
+	// SaveFlowVariantAssignment creates or replaces the assignment of a sticky key
+	SaveFlowVariantAssignment(ctx context.Context, assignment *model.FlowVariantAssignment) error
+
+	// CreateFlowVariantSession records that a session started on a variant
+	CreateFlowVariantSession(ctx context.Context, session *model.FlowVariantSession) error
+
+	// GetFlowVariantSession returns the record of a session, returns nil if the session did not run on a variant
+	GetFlowVariantSession(ctx context.Context, tenant, realm, runId string) (*model.FlowVariantSession, error)
+
+	// FinishFlowVariantSession records the result of a session. It returns false if the session has no record
+	// or its result was already recorded, so that every session is counted once.
+	FinishFlowVariantSession(ctx context.Context, tenant, realm, runId, result string) (bool, error)
+
+	// CountFlowVariantSessions counts the started, succeeded and failed sessions per variant of a flow
+	CountFlowVariantSessions(ctx context.Context, tenant, realm, flowId string) ([]model.FlowVariantCount, error)
+
+	// DeleteFlowVariants deletes all assignments and session records of a flow
+	DeleteFlowVariants(ctx context.Context, tenant, realm, flowId string) error
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TemplateTestFlowVariantDB is a parameterized test for the flow variant store
+func TemplateTestFlowVariantDB(t *testing.T, db FlowVariantDB) {
+	ctx := context.Background()
+	testTenant := "acme"
+	testRealm := "customers"
+
+	t.Run("Assignments", func(t *testing.T) {
+		assignment, err := db.GetFlowVariantAssignment(ctx, testTenant, testRealm, "login", "device-hash")
+		require.NoError(t, err)
+		assert.Nil(t, assignment)
+
+		require.NoError(t, db.SaveFlowVariantAssignment(ctx, &model.FlowVariantAssignment{
+			Tenant: testTenant, Realm: testRealm, FlowId: "login", StickyKey: "device-hash", Variant: "control",
+		}))
+
+		assignment, err = db.GetFlowVariantAssignment(ctx, testTenant, testRealm, "login", "device-hash")
+		require.NoError(t, err)
+		require.NotNil(t, assignment)
+		assert.Equal(t, "control", assignment.Variant)
+
+		// Saving again replaces the assignment
+		require.NoError(t, db.SaveFlowVariantAssignment(ctx, &model.FlowVariantAssignment{
+			Tenant: testTenant, Realm: testRealm, FlowId: "login", StickyKey: "device-hash", Variant: "redesign",
+		}))
+
+		assignment, err = db.GetFlowVariantAssignment(ctx, testTenant, testRealm, "login", "device-hash")
+		require.NoError(t, err)
+		require.NotNil(t, assignment)
+		assert.Equal(t, "redesign", assignment.Variant)
+	})
+
+	t.Run("Sessions are finished once", func(t *testing.T) {
+		for _, runId := range []string{"run-1", "run-2", "run-3"} {
+			require.NoError(t, db.CreateFlowVariantSession(ctx, &model.FlowVariantSession{
+				Tenant: testTenant, Realm: testRealm, FlowId: "login", RunID: runId, Variant: "control", Version: 1,
+			}))
+		}
+		require.NoError(t, db.CreateFlowVariantSession(ctx, &model.FlowVariantSession{
+			Tenant: testTenant, Realm: testRealm, FlowId: "login", RunID: "run-4", Variant: "redesign", Version: 2,
+		}))
+
+		finished, err := db.FinishFlowVariantSession(ctx, testTenant, testRealm, "run-1", model.FlowVariantResultSucceeded)
+		require.NoError(t, err)
+		assert.True(t, finished)
+
+		finished, err = db.FinishFlowVariantSession(ctx, testTenant, testRealm, "run-1", model.FlowVariantResultSucceeded)
+		require.NoError(t, err)
+		assert.False(t, finished)
+
+		finished, err = db.FinishFlowVariantSession(ctx, testTenant, testRealm, "run-2", model.FlowVariantResultFailed)
+		require.NoError(t, err)
+		assert.True(t, finished)
+
+		finished, err = db.FinishFlowVariantSession(ctx, testTenant, testRealm, "unknown", model.FlowVariantResultFailed)
+		require.NoError(t, err)
+		assert.False(t, finished)
+
+		session, err := db.GetFlowVariantSession(ctx, testTenant, testRealm, "run-1")
+		require.NoError(t, err)
+		require.NotNil(t, session)
+		assert.Equal(t, "control", session.Variant)
+		assert.Equal(t, model.FlowVariantResultSucceeded, session.Result)
+		assert.NotNil(t, session.FinishedAt)
+
+		session, err = db.GetFlowVariantSession(ctx, testTenant, testRealm, "unknown")
+		require.NoError(t, err)
+		assert.Nil(t, session)
+	})
+
+	t.Run("CountFlowVariantSessions", func(t *testing.T) {
+		counts, err := db.CountFlowVariantSessions(ctx, testTenant, testRealm, "login")
+		require.NoError(t, err)
+		require.Len(t, counts, 2)
+
+		assert.Equal(t, model.FlowVariantCount{Variant: "control", Started: 3, Succeeded: 1, Failed: 1}, counts[0])
+		assert.Equal(t, model.FlowVariantCount{Variant: "redesign", Started: 1}, counts[1])
+	})
+
+	t.Run("DeleteFlowVariants", func(t *testing.T) {
+		require.NoError(t, db.DeleteFlowVariants(ctx, testTenant, testRealm, "login"))
+
+		counts, err := db.CountFlowVariantSessions(ctx, testTenant, testRealm, "login")
+		require.NoError(t, err)
+		assert.Empty(t, counts)
+
+		assignment, err := db.GetFlowVariantAssignment(ctx, testTenant, testRealm, "login", "device-hash")
+		require.NoError(t, err)
+		assert.Nil(t, assignment)
+	})
+}
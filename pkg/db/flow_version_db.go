@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// FlowVersionDB stores the immutable versions of flow definitions
+type FlowVersionDB interface {
+	// CreateFlowVersion stores a new version of a flow definition and sets the version number assigned by the database
+	CreateFlowVersion(ctx context.Context, version *model.FlowVersion) error
+
+	// GetFlowVersion retrieves a single version of a flow, returns nil if the version does not exist
+	GetFlowVersion(ctx context.Context, tenant, realm, flowId string, version int) (*model.FlowVersion, error)
+
+	// ListFlowVersions lists all versions of a flow, the newest version first
+	ListFlowVersions(ctx context.Context, tenant, realm, flowId string) ([]model.FlowVersion, error)
+
+	// DeleteFlowVersions deletes all versions and the publish history of a flow
+	DeleteFlowVersions(ctx context.Context, tenant, realm, flowId string) error
+
+	// CreateFlowPublication appends a publication to the publish history of a flow
+	CreateFlowPublication(ctx context.Context, publication *model.FlowPublication) error
+
+	// ListFlowPublications lists the publish history of a flow, the latest publication first
+	ListFlowPublications(ctx context.Context, tenant, realm, flowId string) ([]model.FlowPublication, error)
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TemplateTestFlowVersionDB is a parameterized test for storing and listing flow versions
+func TemplateTestFlowVersionDB(t *testing.T, db FlowVersionDB) {
+	ctx := context.Background()
+	testTenant := "test-tenant"
+	testRealm := "test-realm"
+
+	t.Run("CreateFlowVersion assigns increasing versions per flow", func(t *testing.T) {
+		v1 := &model.FlowVersion{Tenant: testTenant, Realm: testRealm, FlowId: "login", DefinitionYaml: "start: v1", Comment: "initial"}
+		require.NoError(t, db.CreateFlowVersion(ctx, v1))
+		assert.Equal(t, 1, v1.Version)
+		assert.False(t, v1.CreatedAt.IsZero())
+
+		v2 := &model.FlowVersion{Tenant: testTenant, Realm: testRealm, FlowId: "login", DefinitionYaml: "start: v2"}
+		require.NoError(t, db.CreateFlowVersion(ctx, v2))
+		assert.Equal(t, 2, v2.Version)
+
+		// Other flows have their own version sequence
+		other := &model.FlowVersion{Tenant: testTenant, Realm: testRealm, FlowId: "register", DefinitionYaml: "start: other"}
+		require.NoError(t, db.CreateFlowVersion(ctx, other))
+		assert.Equal(t, 1, other.Version)
+	})
+
+	t.Run("GetFlowVersion", func(t *testing.T) {
+		version, err := db.GetFlowVersion(ctx, testTenant, testRealm, "login", 1)
+		require.NoError(t, err)
+		require.NotNil(t, version)
+		assert.Equal(t, "start: v1", version.DefinitionYaml)
+		assert.Equal(t, "initial", version.Comment)
+
+		version, err = db.GetFlowVersion(ctx, testTenant, testRealm, "login", 42)
+		require.NoError(t, err)
+		assert.Nil(t, version)
+	})
+
+	t.Run("ListFlowVersions", func(t *testing.T) {
+		versions, err := db.ListFlowVersions(ctx, testTenant, testRealm, "login")
+		require.NoError(t, err)
+		require.Len(t, versions, 2)
+		assert.Equal(t, 2, versions[0].Version)
+		assert.Equal(t, 1, versions[1].Version)
+	})
+
+	t.Run("FlowPublications are listed latest first", func(t *testing.T) {
+		require.NoError(t, db.CreateFlowPublication(ctx, &model.FlowPublication{Tenant: testTenant, Realm: testRealm, FlowId: "login", Version: 1}))
+		require.NoError(t, db.CreateFlowPublication(ctx, &model.FlowPublication{Tenant: testTenant, Realm: testRealm, FlowId: "login", Version: 2, PreviousVersion: 1}))
+		require.NoError(t, db.CreateFlowPublication(ctx, &model.FlowPublication{Tenant: testTenant, Realm: testRealm, FlowId: "login", Version: 1, PreviousVersion: 2}))
+
+		publications, err := db.ListFlowPublications(ctx, testTenant, testRealm, "login")
+		require.NoError(t, err)
+		require.Len(t, publications, 3)
+		assert.Equal(t, 1, publications[0].Version)
+		assert.Equal(t, 2, publications[0].PreviousVersion)
+		assert.Equal(t, 2, publications[1].Version)
+		assert.Equal(t, 1, publications[2].Version)
+		assert.False(t, publications[0].PublishedAt.IsZero())
+	})
+
+	t.Run("DeleteFlowVersions", func(t *testing.T) {
+		require.NoError(t, db.DeleteFlowVersions(ctx, testTenant, testRealm, "login"))
+
+		publications, err := db.ListFlowPublications(ctx, testTenant, testRealm, "login")
+		require.NoError(t, err)
+		assert.Empty(t, publications)
+
+		versions, err := db.ListFlowVersions(ctx, testTenant, testRealm, "login")
+		require.NoError(t, err)
+		assert.Empty(t, versions)
+
+		versions, err = db.ListFlowVersions(ctx, testTenant, testRealm, "register")
+		require.NoError(t, err)
+		assert.Len(t, versions, 1)
+	})
+}
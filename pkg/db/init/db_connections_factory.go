@@ -11,10 +11,17 @@ type DBConnectionsFactory interface {
 	NewUserAttributeDB() (db.UserAttributeDB, error)
 	NewRealmDB() (db.RealmDB, error)
 	NewFlowDB() (db.FlowDB, error)
+	NewFlowVersionDB() (db.FlowVersionDB, error)
 	NewApplicationsDB() (db.ApplicationDB, error)
 	NewClientSessionDB() (db.ClientSessionDB, error)
 	NewSigningKeyDB() (db.SigningKeyDB, error)
 	NewAuthSessionDB() (db.AuthSessionDB, error)
+	NewConfigChangeDB() (db.ConfigChangeDB, error)
+	NewJobLockDB() (db.JobLockDB, error)
+	NewPasswordResetTokenDB() (db.PasswordResetTokenDB, error)
+	NewFlowStatsDB() (db.FlowStatsDB, error)
+	NewTemplateOverrideDB() (db.TemplateOverrideDB, error)
+	NewFlowVariantDB() (db.FlowVariantDB, error)
 }
 
 // Singleton instance of the DBConnectionsFactory
@@ -83,11 +90,53 @@ func GetDatabaseConnections() (*db.DatabaseConnections, error) {
 		return nil, fmt.Errorf("failed to initialize postgres flow db: %w", err)
 	}
 
+	// Init flow version db
+	connections.FlowVersionDB, err = factory.NewFlowVersionDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize postgres flow version db: %w", err)
+	}
+
 	// Init application db
 	connections.ApplicationsDB, err = factory.NewApplicationsDB()
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize postgres application db: %w", err)
 	}
 
+	// Init config change db
+	connections.ConfigChangeDB, err = factory.NewConfigChangeDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize postgres config change db: %w", err)
+	}
+
+	// Init job lock db
+	connections.JobLockDB, err = factory.NewJobLockDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize postgres job lock db: %w", err)
+	}
+
+	// Init password reset token db
+	connections.PasswordResetTokenDB, err = factory.NewPasswordResetTokenDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize postgres password reset token db: %w", err)
+	}
+
+	// Init flow stats db
+	connections.FlowStatsDB, err = factory.NewFlowStatsDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize postgres flow stats db: %w", err)
+	}
+
+	// Init template override db
+	connections.TemplateOverrideDB, err = factory.NewTemplateOverrideDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize postgres template override db: %w", err)
+	}
+
+	// Init flow variant db
+	connections.FlowVariantDB, err = factory.NewFlowVariantDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize postgres flow variant db: %w", err)
+	}
+
 	return connections, nil
 }
@@ -61,10 +61,38 @@ func (f *PostgresConnectionsFactory) NewFlowDB() (db.FlowDB, error) {
 	return postgres_adapter.NewPostgresFlowDB(f.pool)
 }
 
+func (f *PostgresConnectionsFactory) NewFlowVersionDB() (db.FlowVersionDB, error) {
+	return postgres_adapter.NewPostgresFlowVersionDB(f.pool)
+}
+
 func (f *PostgresConnectionsFactory) NewRealmDB() (db.RealmDB, error) {
 	return postgres_adapter.NewPostgresRealmDB(f.pool)
 }
 
+func (f *PostgresConnectionsFactory) NewConfigChangeDB() (db.ConfigChangeDB, error) {
+	return postgres_adapter.NewPostgresConfigChangeDB(f.pool)
+}
+
+func (f *PostgresConnectionsFactory) NewJobLockDB() (db.JobLockDB, error) {
+	return postgres_adapter.NewPostgresJobLockDB(f.pool)
+}
+
+func (f *PostgresConnectionsFactory) NewPasswordResetTokenDB() (db.PasswordResetTokenDB, error) {
+	return postgres_adapter.NewPostgresPasswordResetTokenDB(f.pool)
+}
+
+func (f *PostgresConnectionsFactory) NewFlowStatsDB() (db.FlowStatsDB, error) {
+	return postgres_adapter.NewPostgresFlowStatsDB(f.pool)
+}
+
+func (f *PostgresConnectionsFactory) NewTemplateOverrideDB() (db.TemplateOverrideDB, error) {
+	return postgres_adapter.NewPostgresTemplateOverrideDB(f.pool)
+}
+
+func (f *PostgresConnectionsFactory) NewFlowVariantDB() (db.FlowVariantDB, error) {
+	return postgres_adapter.NewPostgresFlowVariantDB(f.pool)
+}
+
 // initPostgresDB initializes a PostgreSQL database connection
 func initPostgresDB() (*pgxpool.Pool, error) {
 	log := logger.GetGoamLogger()
@@ -62,10 +62,38 @@ func (f *SQLiteConnectionsFactory) NewFlowDB() (db.FlowDB, error) {
 	return sqlite_adapter.NewFlowDB(f.db)
 }
 
+func (f *SQLiteConnectionsFactory) NewFlowVersionDB() (db.FlowVersionDB, error) {
+	return sqlite_adapter.NewFlowVersionDB(f.db)
+}
+
 func (f *SQLiteConnectionsFactory) NewRealmDB() (db.RealmDB, error) {
 	return sqlite_adapter.NewRealmDB(f.db)
 }
 
+func (f *SQLiteConnectionsFactory) NewConfigChangeDB() (db.ConfigChangeDB, error) {
+	return sqlite_adapter.NewConfigChangeDB(f.db)
+}
+
+func (f *SQLiteConnectionsFactory) NewJobLockDB() (db.JobLockDB, error) {
+	return sqlite_adapter.NewJobLockDB(f.db)
+}
+
+func (f *SQLiteConnectionsFactory) NewPasswordResetTokenDB() (db.PasswordResetTokenDB, error) {
+	return sqlite_adapter.NewPasswordResetTokenDB(f.db)
+}
+
+func (f *SQLiteConnectionsFactory) NewFlowStatsDB() (db.FlowStatsDB, error) {
+	return sqlite_adapter.NewFlowStatsDB(f.db)
+}
+
+func (f *SQLiteConnectionsFactory) NewTemplateOverrideDB() (db.TemplateOverrideDB, error) {
+	return sqlite_adapter.NewTemplateOverrideDB(f.db)
+}
+
+func (f *SQLiteConnectionsFactory) NewFlowVariantDB() (db.FlowVariantDB, error) {
+	return sqlite_adapter.NewFlowVariantDB(f.db)
+}
+
 // initSQLiteDB initializes a SQLite database connection
 func initSQLiteDB() (*sql.DB, error) {
 	log := logger.GetGoamLogger()
@@ -0,0 +1,14 @@
+package db
+
+import (
+	"context"
+)
+
+// JobLockDB coordinates background jobs between instances so that a job does not run on two instances at the same
+// time. This is mutual exclusion for a single run and not leader election: every instance keeps its own schedule and
+// whichever instance finds the lock free runs the job, so a job may run once per instance and interval in the worst case.
+type JobLockDB interface {
+	// RunWithLock runs fn while holding the lock with the given name and releases the lock afterwards.
+	// If the lock is held by another instance fn is not called and false is returned.
+	RunWithLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error)
+}
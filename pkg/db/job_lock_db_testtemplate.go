@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TemplateTestJobLockDB is a parameterized test for the job lock
+func TemplateTestJobLockDB(t *testing.T, db JobLockDB) {
+	ctx := context.Background()
+
+	t.Run("RunWithLock runs the function", func(t *testing.T) {
+		called := false
+		acquired, err := db.RunWithLock(ctx, "test_job", func(ctx context.Context) error {
+			called = true
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, acquired)
+		assert.True(t, called)
+	})
+
+	t.Run("RunWithLock skips while the lock is held", func(t *testing.T) {
+		acquired, err := db.RunWithLock(ctx, "test_job", func(ctx context.Context) error {
+			nestedCalled := false
+			nestedAcquired, err := db.RunWithLock(ctx, "test_job", func(ctx context.Context) error {
+				nestedCalled = true
+				return nil
+			})
+			require.NoError(t, err)
+			assert.False(t, nestedAcquired)
+			assert.False(t, nestedCalled)
+
+			// Other locks are independent
+			otherAcquired, err := db.RunWithLock(ctx, "other_job", func(ctx context.Context) error { return nil })
+			require.NoError(t, err)
+			assert.True(t, otherAcquired)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, acquired)
+	})
+
+	t.Run("RunWithLock releases the lock on error", func(t *testing.T) {
+		jobErr := errors.New("job failed")
+		acquired, err := db.RunWithLock(ctx, "test_job", func(ctx context.Context) error {
+			return jobErr
+		})
+		assert.True(t, acquired)
+		assert.ErrorIs(t, err, jobErr)
+
+		acquired, err = db.RunWithLock(ctx, "test_job", func(ctx context.Context) error { return nil })
+		require.NoError(t, err)
+		assert.True(t, acquired)
+	})
+}
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// PasswordResetTokenDB stores password reset tokens and the reset requests they were issued for
+type PasswordResetTokenDB interface {
+	// CreatePasswordResetToken stores a new token
+	CreatePasswordResetToken(ctx context.Context, token *model.PasswordResetToken) error
+
+	// GetPasswordResetTokenByHash returns the token with the given hash or nil if it does not exist
+	GetPasswordResetTokenByHash(ctx context.Context, tenant, realm, tokenHash string) (*model.PasswordResetToken, error)
+
+	// MarkPasswordResetTokenUsed sets the used timestamp if the token was not used before.
+	// Returns false if the token does not exist or was already used, so that a token can only be used once.
+	MarkPasswordResetTokenUsed(ctx context.Context, tenant, realm, tokenHash string, usedAt time.Time) (bool, error)
+
+	// CountPasswordResetTokensByIdentifier counts the tokens created for the identifier since the given time
+	CountPasswordResetTokensByIdentifier(ctx context.Context, tenant, realm, identifierHash string, since time.Time) (int, error)
+
+	// CountPasswordResetTokensByIP counts the tokens requested from the ip since the given time
+	CountPasswordResetTokensByIP(ctx context.Context, tenant, realm, requestIP string, since time.Time) (int, error)
+
+	// DeleteExpiredPasswordResetTokens deletes tokens that expired before the given time and returns the number of deleted tokens
+	DeleteExpiredPasswordResetTokens(ctx context.Context, tenant, realm string, before time.Time) (int, error)
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TemplateTestPasswordResetTokenDB is a parameterized test for the password reset token store
+func TemplateTestPasswordResetTokenDB(t *testing.T, db PasswordResetTokenDB) {
+	ctx := context.Background()
+	tenant, realm := "acme", "customers"
+	now := time.Now()
+
+	token := &model.PasswordResetToken{
+		ID:             "token-1",
+		Tenant:         tenant,
+		Realm:          realm,
+		TokenHash:      "hash-1",
+		UserID:         "user-1",
+		IdentifierHash: "alice",
+		RequestIP:      "10.0.0.1",
+		Channel:        model.PasswordResetChannelEmail,
+		ExpiresAt:      now.Add(15 * time.Minute),
+	}
+
+	// A request for an unknown user that is only recorded for rate limiting
+	unknown := &model.PasswordResetToken{
+		ID:             "token-2",
+		Tenant:         tenant,
+		Realm:          realm,
+		TokenHash:      "hash-2",
+		IdentifierHash: "mallory",
+		RequestIP:      "10.0.0.1",
+		Channel:        model.PasswordResetChannelEmail,
+		ExpiresAt:      now.Add(-time.Minute),
+	}
+
+	t.Run("CreatePasswordResetToken", func(t *testing.T) {
+		require.NoError(t, db.CreatePasswordResetToken(ctx, token))
+		require.NoError(t, db.CreatePasswordResetToken(ctx, unknown))
+		assert.False(t, token.CreatedAt.IsZero())
+	})
+
+	t.Run("GetPasswordResetTokenByHash", func(t *testing.T) {
+		loaded, err := db.GetPasswordResetTokenByHash(ctx, tenant, realm, "hash-1")
+		require.NoError(t, err)
+		require.NotNil(t, loaded)
+		assert.Equal(t, "token-1", loaded.ID)
+		assert.Equal(t, "user-1", loaded.UserID)
+		assert.Equal(t, model.PasswordResetChannelEmail, loaded.Channel)
+		assert.WithinDuration(t, token.ExpiresAt, loaded.ExpiresAt, time.Second)
+		assert.Nil(t, loaded.UsedAt)
+
+		loaded, err = db.GetPasswordResetTokenByHash(ctx, tenant, "other", "hash-1")
+		require.NoError(t, err)
+		assert.Nil(t, loaded)
+	})
+
+	t.Run("CountPasswordResetTokens", func(t *testing.T) {
+		count, err := db.CountPasswordResetTokensByIdentifier(ctx, tenant, realm, "alice", now.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+
+		count, err = db.CountPasswordResetTokensByIP(ctx, tenant, realm, "10.0.0.1", now.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		count, err = db.CountPasswordResetTokensByIP(ctx, tenant, realm, "10.0.0.1", now.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 0, count)
+	})
+
+	t.Run("MarkPasswordResetTokenUsed only once", func(t *testing.T) {
+		ok, err := db.MarkPasswordResetTokenUsed(ctx, tenant, realm, "hash-1", now)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = db.MarkPasswordResetTokenUsed(ctx, tenant, realm, "hash-1", now)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		ok, err = db.MarkPasswordResetTokenUsed(ctx, tenant, realm, "unknown", now)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		loaded, err := db.GetPasswordResetTokenByHash(ctx, tenant, realm, "hash-1")
+		require.NoError(t, err)
+		require.NotNil(t, loaded.UsedAt)
+		assert.WithinDuration(t, now, *loaded.UsedAt, time.Second)
+	})
+
+	t.Run("DeleteExpiredPasswordResetTokens", func(t *testing.T) {
+		deleted, err := db.DeleteExpiredPasswordResetTokens(ctx, tenant, realm, now)
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+
+		loaded, err := db.GetPasswordResetTokenByHash(ctx, tenant, realm, "hash-2")
+		require.NoError(t, err)
+		assert.Nil(t, loaded)
+
+		loaded, err = db.GetPasswordResetTokenByHash(ctx, tenant, realm, "hash-1")
+		require.NoError(t, err)
+		assert.NotNil(t, loaded)
+	})
+}
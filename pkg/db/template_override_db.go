@@ -0,0 +1,22 @@
+package db
+
+import (
+	"context"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// TemplateOverrideDB stores the template overrides that were created at runtime, so that all instances can load them
+type TemplateOverrideDB interface {
+	// UpsertTemplateOverride creates the override or replaces the template of an existing one
+	UpsertTemplateOverride(ctx context.Context, override *model.TemplateOverride) error
+
+	// GetTemplateOverride returns the override or nil if it does not exist
+	GetTemplateOverride(ctx context.Context, tenant, realm, flowId, nodeName string) (*model.TemplateOverride, error)
+
+	// ListTemplateOverrides lists the overrides of all tenants and realms
+	ListTemplateOverrides(ctx context.Context) ([]model.TemplateOverride, error)
+
+	// DeleteTemplateOverride deletes the override, returns false if it did not exist
+	DeleteTemplateOverride(ctx context.Context, tenant, realm, flowId, nodeName string) (bool, error)
+}
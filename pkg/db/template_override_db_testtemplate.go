@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TemplateTestTemplateOverrideDB is a parameterized test for the template override store
+func TemplateTestTemplateOverrideDB(t *testing.T, db TemplateOverrideDB) {
+	ctx := context.Background()
+
+	override := &model.TemplateOverride{
+		Tenant:   "acme",
+		Realm:    "customers",
+		FlowId:   "*",
+		NodeName: "askUsername",
+		Template: "<p>v1</p>",
+	}
+
+	t.Run("Upsert and get", func(t *testing.T) {
+		require.NoError(t, db.UpsertTemplateOverride(ctx, override))
+
+		loaded, err := db.GetTemplateOverride(ctx, "acme", "customers", "*", "askUsername")
+		require.NoError(t, err)
+		require.NotNil(t, loaded)
+		assert.Equal(t, "<p>v1</p>", loaded.Template)
+		assert.False(t, loaded.UpdatedAt.IsZero())
+
+		override.Template = "<p>v2</p>"
+		require.NoError(t, db.UpsertTemplateOverride(ctx, override))
+
+		loaded, err = db.GetTemplateOverride(ctx, "acme", "customers", "*", "askUsername")
+		require.NoError(t, err)
+		assert.Equal(t, "<p>v2</p>", loaded.Template)
+
+		missing, err := db.GetTemplateOverride(ctx, "acme", "customers", "login", "askUsername")
+		require.NoError(t, err)
+		assert.Nil(t, missing)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		require.NoError(t, db.UpsertTemplateOverride(ctx, &model.TemplateOverride{Tenant: "acme", Realm: "staff", FlowId: "login", NodeName: "askPassword", Template: "<p>staff</p>"}))
+
+		overrides, err := db.ListTemplateOverrides(ctx)
+		require.NoError(t, err)
+		require.Len(t, overrides, 2)
+		assert.Equal(t, "customers", overrides[0].Realm)
+		assert.Equal(t, "staff", overrides[1].Realm)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		deleted, err := db.DeleteTemplateOverride(ctx, "acme", "customers", "*", "askUsername")
+		require.NoError(t, err)
+		assert.True(t, deleted)
+
+		deleted, err = db.DeleteTemplateOverride(ctx, "acme", "customers", "*", "askUsername")
+		require.NoError(t, err)
+		assert.False(t, deleted)
+
+		loaded, err := db.GetTemplateOverride(ctx, "acme", "customers", "*", "askUsername")
+		require.NoError(t, err)
+		assert.Nil(t, loaded)
+	})
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/Identityplane/GoAM/pkg/model"
 )
@@ -14,12 +15,21 @@ type UserAttributeDB interface {
 	// Get all attributes for a user (without detailed values)
 	ListUserAttributes(ctx context.Context, tenant, realm, userID string) ([]*model.UserAttribute, error)
 
+	// Get a page of attributes of a type within a realm ordered by id, e.g. for maintenance jobs.
+	// Returns at most limit attributes with an id greater than afterID.
+	ListUserAttributesByType(ctx context.Context, tenant, realm, attributeType, afterID string, limit int) ([]*model.UserAttribute, error)
+
 	// Get a specific user attribute by ID with full details
 	GetUserAttributeByID(ctx context.Context, tenant, realm, attributeID string) (*model.UserAttribute, error)
 
 	// Update an existing user attribute
 	UpdateUserAttribute(ctx context.Context, attribute *model.UserAttribute) error
 
+	// Update an attribute only if it was not changed since it was read, i.e. its stored updated_at still equals
+	// lastUpdatedAt (SQLite compares with millisecond precision). Returns false if the attribute was changed or
+	// deleted in the meantime.
+	UpdateUserAttributeIfUnchanged(ctx context.Context, attribute *model.UserAttribute, lastUpdatedAt time.Time) (bool, error)
+
 	// Delete a specific user attribute
 	DeleteUserAttribute(ctx context.Context, tenant, realm, attributeID string) error
 
@@ -217,6 +217,69 @@ func TemplateTestMultipleAttributesOfSameType(t *testing.T, db UserAttributeDB)
 		assert.True(t, indexes["work@example.com"])
 	})
 
+	t.Run("ListUserAttributesByType", func(t *testing.T) {
+		attrs, err := db.ListUserAttributesByType(ctx, testTenant, testRealm, "email", "", 10)
+		assert.NoError(t, err)
+		assert.Len(t, attrs, 2)
+		for _, attr := range attrs {
+			assert.Equal(t, "email", attr.Type)
+		}
+
+		attrs, err = db.ListUserAttributesByType(ctx, testTenant, testRealm, "password", "", 10)
+		assert.NoError(t, err)
+		assert.Empty(t, attrs)
+	})
+
+	t.Run("ListUserAttributesByTypePaged", func(t *testing.T) {
+		first, err := db.ListUserAttributesByType(ctx, testTenant, testRealm, "email", "", 1)
+		require.NoError(t, err)
+		require.Len(t, first, 1)
+
+		second, err := db.ListUserAttributesByType(ctx, testTenant, testRealm, "email", first[0].ID, 1)
+		require.NoError(t, err)
+		require.Len(t, second, 1)
+		assert.Less(t, first[0].ID, second[0].ID)
+
+		rest, err := db.ListUserAttributesByType(ctx, testTenant, testRealm, "email", second[0].ID, 1)
+		require.NoError(t, err)
+		assert.Empty(t, rest)
+	})
+
+	t.Run("UpdateUserAttributeIfUnchanged", func(t *testing.T) {
+		attrs, err := db.ListUserAttributesByType(ctx, testTenant, testRealm, "email", "", 1)
+		require.NoError(t, err)
+		require.Len(t, attrs, 1)
+		stale := attrs[0]
+		lastUpdatedAt := stale.UpdatedAt
+
+		// A concurrent update changes updated_at, so the stale copy must not overwrite it. SQLite compares
+		// updated_at with millisecond precision, so wait until the timestamp differs.
+		time.Sleep(5 * time.Millisecond)
+		current, err := db.GetUserAttributeByID(ctx, testTenant, testRealm, stale.ID)
+		require.NoError(t, err)
+		current.Value = model.EmailAttributeValue{Email: "changed@example.com", Verified: true}
+		require.NoError(t, db.UpdateUserAttribute(ctx, current))
+
+		stale.Value = model.EmailAttributeValue{Email: "stale@example.com"}
+		updated, err := db.UpdateUserAttributeIfUnchanged(ctx, stale, lastUpdatedAt)
+		require.NoError(t, err)
+		assert.False(t, updated)
+
+		// With the current updated_at the update goes through
+		current, err = db.GetUserAttributeByID(ctx, testTenant, testRealm, stale.ID)
+		require.NoError(t, err)
+		current.Value = model.EmailAttributeValue{Email: "conditional@example.com", Verified: true}
+		updated, err = db.UpdateUserAttributeIfUnchanged(ctx, current, current.UpdatedAt)
+		require.NoError(t, err)
+		assert.True(t, updated)
+
+		loaded, err := db.GetUserAttributeByID(ctx, testTenant, testRealm, stale.ID)
+		require.NoError(t, err)
+		emailValue, ok := loaded.Value.(map[string]interface{})
+		require.True(t, ok)
+		assert.Equal(t, "conditional@example.com", emailValue["email"])
+	})
+
 	// Clean up
 	attrs, err := db.ListUserAttributes(ctx, testTenant, testRealm, testUserID)
 	require.NoError(t, err)
@@ -1,6 +1,9 @@
 package pkg
 
 import (
+	"fmt"
+	"io/fs"
+
 	"github.com/Identityplane/GoAM/internal/auth/graph"
 	"github.com/Identityplane/GoAM/internal/config"
 	"github.com/Identityplane/GoAM/internal/service"
@@ -13,13 +16,30 @@ import (
 var serverStartCallbacks []func(settings *server_settings.GoamServerSettings) error
 
 // RegisterNode registers a node definition. Use this to add a new custom node
+// Invalid definitions and nodes with the name of a registered node are logged and not registered,
+// use RegisterNodeWithTemplates to handle the error
 func RegisterNode(name string, def *model.NodeDefinition) {
-	graph.NodeDefinitions[name] = def
+	if err := RegisterNodeWithTemplates(name, def, nil); err != nil {
+		log.Error().Err(err).Str("node", name).Msg("failed to register node")
+	}
+}
+
+// RegisterNodeWithTemplates registers a node definition together with its html template, which is read
+// from '<name>.html' in the templates, e.g. an embed.FS. Returns an error if the definition is invalid or a node
+// with the same name exists, built-in nodes cannot be replaced. Nodes that prompt the user without a template
+// need a template override.
+func RegisterNodeWithTemplates(name string, def *model.NodeDefinition, templates fs.FS) error {
+	if def != nil && def.Name != name {
+		return fmt.Errorf("node is registered as '%s' but its definition is named '%s'", name, def.Name)
+	}
+	return graph.RegisterNodeDefinition(def, templates)
 }
 
-// UnregisterNode unregisters a node definition. Use this to remove a node
+// UnregisterNode unregisters a node definition. Use this to remove a node, built-in nodes cannot be removed
 func UnregisterNode(name string) {
-	delete(graph.NodeDefinitions, name)
+	if err := graph.UnregisterNodeDefinition(name); err != nil {
+		log.Error().Err(err).Str("node", name).Msg("failed to unregister node")
+	}
 }
 
 // GetServerConfig returns a pointer to the current server runtime configuration
@@ -0,0 +1,111 @@
+package kms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// attributeAAD binds an encrypted field to the attribute it belongs to
+func attributeAAD(attribute *model.UserAttribute, field string) []byte {
+	return AAD("attribute", attribute.Tenant, attribute.Realm, attribute.ID, field)
+}
+
+// EncryptAttributeValue marshals the value of an attribute to json and encrypts its sensitive fields.
+// Used by the database adapters before a value is written, the id, tenant and realm must already be set.
+func EncryptAttributeValue(ctx context.Context, attribute *model.UserAttribute) ([]byte, error) {
+
+	valueJSON, err := json.Marshal(attribute.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := model.SensitiveAttributeFields[attribute.Type]
+	if len(fields) == 0 || GetKeyProvider() == nil {
+		return valueJSON, nil
+	}
+
+	var valueMap map[string]interface{}
+	if err := json.Unmarshal(valueJSON, &valueMap); err != nil || valueMap == nil {
+		// Not an object, there are no fields to encrypt
+		return valueJSON, nil
+	}
+
+	for _, field := range fields {
+		plaintext, ok := valueMap[field].(string)
+		if !ok {
+			continue
+		}
+
+		encrypted, err := EncryptString(ctx, plaintext, attributeAAD(attribute, field))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s: %w", field, err)
+		}
+		valueMap[field] = encrypted
+	}
+
+	return json.Marshal(valueMap)
+}
+
+// DecryptAttributeValue decrypts the sensitive fields of the value of an attribute that was read from the database.
+// The value is expected as unmarshalled json, values without encrypted fields are returned unchanged.
+func DecryptAttributeValue(ctx context.Context, attribute *model.UserAttribute, value interface{}) (interface{}, error) {
+
+	valueMap, ok := value.(map[string]interface{})
+	if !ok {
+		return value, nil
+	}
+
+	for _, field := range model.SensitiveAttributeFields[attribute.Type] {
+		encrypted, ok := valueMap[field].(string)
+		if !ok {
+			continue
+		}
+
+		plaintext, err := DecryptString(ctx, encrypted, attributeAAD(attribute, field))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s: %w", field, err)
+		}
+		valueMap[field] = plaintext
+	}
+
+	return valueMap, nil
+}
+
+// EncryptSigningKey encrypts the key material of a signing key before it is written and records
+// the provider in the implementation. Without a provider the key is stored as is.
+func EncryptSigningKey(ctx context.Context, key model.SigningKey) (model.SigningKey, error) {
+
+	provider := GetKeyProvider()
+	if provider == nil || IsEncrypted(key.SigningKeyMaterial) {
+		return key, nil
+	}
+
+	encrypted, err := Encrypt(ctx, provider, []byte(key.SigningKeyMaterial), signingKeyAAD(key))
+	if err != nil {
+		return key, fmt.Errorf("failed to encrypt signing key %s: %w", key.Kid, err)
+	}
+
+	key.SigningKeyMaterial = encrypted
+	key.Implementation = provider.Name()
+	return key, nil
+}
+
+// DecryptSigningKey decrypts the key material of a signing key that was read from the database
+func DecryptSigningKey(ctx context.Context, key *model.SigningKey) error {
+
+	material, err := DecryptString(ctx, key.SigningKeyMaterial, signingKeyAAD(*key))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt signing key %s: %w", key.Kid, err)
+	}
+
+	key.SigningKeyMaterial = material
+	return nil
+}
+
+// signingKeyAAD binds the encrypted key material to the key it belongs to
+func signingKeyAAD(key model.SigningKey) []byte {
+	return AAD("signing_key", key.Tenant, key.Realm, key.Kid)
+}
@@ -0,0 +1,179 @@
+package kms
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// envelopePrefix marks values that are encrypted, values without it are treated as plain text
+const envelopePrefix = "enc:v1:"
+
+// PlainImplementation is the SigningKey.Implementation of keys that are stored unencrypted
+const PlainImplementation = "plain"
+
+// Envelope is an encrypted value. Every value has its own data key which is wrapped by the KEK of the provider.
+type Envelope struct {
+	Provider   string
+	KeyID      string
+	WrappedKey []byte
+	Ciphertext []byte
+}
+
+// IsEncrypted returns true if the value is an encrypted envelope
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, envelopePrefix)
+}
+
+// ParseEnvelope parses an encrypted value in the form enc:v1:<provider>:<key id>:<wrapped key>:<ciphertext>
+func ParseEnvelope(value string) (*Envelope, error) {
+	if !IsEncrypted(value) {
+		return nil, fmt.Errorf("value is not encrypted")
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, envelopePrefix), ":")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid envelope")
+	}
+
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid envelope key: %w", err)
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid envelope ciphertext: %w", err)
+	}
+
+	return &Envelope{
+		Provider:   parts[0],
+		KeyID:      parts[1],
+		WrappedKey: wrappedKey,
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+// String serializes the envelope
+func (e *Envelope) String() string {
+	return envelopePrefix + strings.Join([]string{
+		e.Provider,
+		e.KeyID,
+		base64.RawStdEncoding.EncodeToString(e.WrappedKey),
+		base64.RawStdEncoding.EncodeToString(e.Ciphertext),
+	}, ":")
+}
+
+// AAD builds the additional authenticated data that binds an encrypted value to the record and field it was
+// written for, e.g. AAD("attribute", tenant, realm, attributeID, field). A value copied to another record fails to decrypt.
+func AAD(parts ...string) []byte {
+	return []byte(strings.Join(parts, "\x00"))
+}
+
+// Encrypt encrypts the plaintext with a new data key that is wrapped by the current KEK of the provider.
+// The same aad must be passed to Decrypt.
+func Encrypt(ctx context.Context, provider KeyProvider, plaintext, aad []byte) (string, error) {
+
+	if strings.Contains(provider.Name(), ":") {
+		return "", fmt.Errorf("invalid key provider name %s", provider.Name())
+	}
+
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	ciphertext, err := sealAESGCM(dek, plaintext, aad)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt value: %w", err)
+	}
+
+	keyID, wrappedKey, err := provider.WrapKey(ctx, dek)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(keyID, ":") {
+		return "", fmt.Errorf("invalid key encryption key id %s", keyID)
+	}
+
+	envelope := &Envelope{
+		Provider:   provider.Name(),
+		KeyID:      keyID,
+		WrappedKey: wrappedKey,
+		Ciphertext: ciphertext,
+	}
+	return envelope.String(), nil
+}
+
+// Decrypt decrypts an envelope created by Encrypt. The data key is unwrapped by the provider named in the envelope,
+// which is either the configured provider or one that was registered with RegisterKeyProvider.
+func Decrypt(ctx context.Context, value string, aad []byte) ([]byte, error) {
+
+	envelope, err := ParseEnvelope(value)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := getKeyProviderByName(envelope.Provider)
+	if provider == nil {
+		return nil, fmt.Errorf("value is encrypted by %s but no such key provider is configured", envelope.Provider)
+	}
+
+	dek, err := provider.UnwrapKey(ctx, envelope.KeyID, envelope.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := openAESGCM(dek, envelope.Ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return plaintext, nil
+}
+
+// EncryptString encrypts the value with the configured key provider. If no provider is configured
+// the value is returned unchanged.
+func EncryptString(ctx context.Context, value string, aad []byte) (string, error) {
+	provider := GetKeyProvider()
+	if provider == nil || value == "" || IsEncrypted(value) {
+		return value, nil
+	}
+	return Encrypt(ctx, provider, []byte(value), aad)
+}
+
+// DecryptString decrypts the value with the key provider named in its envelope. Values that are not encrypted,
+// e.g. because they were written before encryption was enabled, are returned unchanged until the plaintext cutoff.
+func DecryptString(ctx context.Context, value string, aad []byte) (string, error) {
+	if !IsEncrypted(value) {
+		if value != "" && plaintextRejected() {
+			return "", ErrPlaintextSecret
+		}
+		return value, nil
+	}
+
+	plaintext, err := Decrypt(ctx, value, aad)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// ErrPlaintextSecret is returned when a secret that is not encrypted is read after the plaintext cutoff
+var ErrPlaintextSecret = errors.New("secret is stored unencrypted")
+
+// Time after which unencrypted secrets are rejected, the zero time accepts them
+var plaintextCutoff time.Time
+
+// SetPlaintextCutoff sets the time after which secrets that are stored unencrypted are rejected while a key provider
+// is configured. Until then they are accepted so that the reencrypt_secrets maintenance job can encrypt secrets that
+// were written before encryption was enabled. The zero time accepts unencrypted secrets without a limit.
+func SetPlaintextCutoff(cutoff time.Time) {
+	plaintextCutoff = cutoff
+}
+
+func plaintextRejected() bool {
+	return GetKeyProvider() != nil && !plaintextCutoff.IsZero() && time.Now().After(plaintextCutoff)
+}
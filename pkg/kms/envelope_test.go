@@ -0,0 +1,264 @@
+package kms
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string([]byte{b}), 32)))
+}
+
+func TestLocalKeyProvider_Parse(t *testing.T) {
+	provider, err := NewLocalKeyProvider("# rotated 2025-06\nnew:" + testKey('a') + "\nold:" + testKey('b') + "\n")
+	require.NoError(t, err)
+	assert.Equal(t, "new", provider.CurrentKeyID())
+	assert.Equal(t, LocalKeyProviderName, provider.Name())
+
+	_, err = NewLocalKeyProvider("short:" + base64.StdEncoding.EncodeToString([]byte("too short")))
+	assert.ErrorContains(t, err, "must be 32 bytes")
+
+	_, err = NewLocalKeyProvider("a:" + testKey('a') + ",a:" + testKey('b'))
+	assert.ErrorContains(t, err, "duplicate")
+
+	_, err = NewLocalKeyProvider("")
+	assert.Error(t, err)
+}
+
+func TestLoadLocalKeyProvider(t *testing.T) {
+	provider, err := LoadLocalKeyProvider("", "")
+	require.NoError(t, err)
+	assert.Nil(t, provider)
+
+	keyFile := filepath.Join(t.TempDir(), "kek")
+	require.NoError(t, os.WriteFile(keyFile, []byte("file:"+testKey('f')+"\n"), 0600))
+
+	provider, err = LoadLocalKeyProvider(keyFile, "")
+	require.NoError(t, err)
+	assert.Equal(t, "file", provider.CurrentKeyID())
+
+	_, err = LoadLocalKeyProvider(keyFile, "env:"+testKey('e'))
+	assert.Error(t, err)
+}
+
+func TestEnvelope_EncryptDecryptAndRotate(t *testing.T) {
+	ctx := context.Background()
+	aad := AAD("attribute", "acme", "customers", "attribute-1", "secret")
+
+	oldProvider, err := NewLocalKeyProvider("old:" + testKey('o'))
+	require.NoError(t, err)
+	SetKeyProvider(oldProvider)
+	t.Cleanup(func() { SetKeyProvider(nil) })
+
+	encrypted, err := Encrypt(ctx, oldProvider, []byte("secret"), aad)
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.NotContains(t, encrypted, "secret")
+
+	envelope, err := ParseEnvelope(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, LocalKeyProviderName, envelope.Provider)
+	assert.Equal(t, "old", envelope.KeyID)
+
+	// Every value gets its own data key
+	other, err := Encrypt(ctx, oldProvider, []byte("secret"), aad)
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, other)
+
+	// After the rotation the old key can still decrypt existing values
+	rotatedProvider, err := NewLocalKeyProvider("new:" + testKey('n') + ",old:" + testKey('o'))
+	require.NoError(t, err)
+	SetKeyProvider(rotatedProvider)
+
+	plaintext, err := Decrypt(ctx, encrypted, aad)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+
+	reencrypted, err := Encrypt(ctx, rotatedProvider, plaintext, aad)
+	require.NoError(t, err)
+	envelope, err = ParseEnvelope(reencrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "new", envelope.KeyID)
+
+	// Without the key the value cannot be decrypted
+	SetKeyProvider(oldProvider)
+	_, err = Decrypt(ctx, reencrypted, aad)
+	assert.ErrorContains(t, err, "unknown key encryption key new")
+
+	SetKeyProvider(nil)
+	_, err = Decrypt(ctx, reencrypted, aad)
+	assert.ErrorContains(t, err, "no such key provider is configured")
+}
+
+func TestEnvelope_AADBindsValueToRecord(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := NewLocalKeyProvider("test:" + testKey('t'))
+	require.NoError(t, err)
+	SetKeyProvider(provider)
+	t.Cleanup(func() { SetKeyProvider(nil) })
+
+	encrypted, err := EncryptString(ctx, "secret", AAD("attribute", "acme", "customers", "attribute-1", "secret"))
+	require.NoError(t, err)
+
+	// A ciphertext copied to another attribute, realm or field does not decrypt
+	for _, aad := range [][]byte{
+		AAD("attribute", "acme", "customers", "attribute-2", "secret"),
+		AAD("attribute", "acme", "employees", "attribute-1", "secret"),
+		AAD("attribute", "acme", "customers", "attribute-1", "other"),
+		nil,
+	} {
+		_, err = DecryptString(ctx, encrypted, aad)
+		assert.ErrorContains(t, err, "failed to decrypt value")
+	}
+
+	plaintext, err := DecryptString(ctx, encrypted, AAD("attribute", "acme", "customers", "attribute-1", "secret"))
+	require.NoError(t, err)
+	assert.Equal(t, "secret", plaintext)
+}
+
+// testKeyProvider is a provider with another name, e.g. an external KMS
+type testKeyProvider struct {
+	*LocalKeyProvider
+	name string
+}
+
+func (p *testKeyProvider) Name() string {
+	return p.name
+}
+
+func TestEnvelope_DecryptsWithProviderOfEnvelope(t *testing.T) {
+	ctx := context.Background()
+	aad := AAD("signing_key", "acme", "customers", "kid")
+
+	local, err := NewLocalKeyProvider("local:" + testKey('l'))
+	require.NoError(t, err)
+	encrypted, err := Encrypt(ctx, local, []byte("private"), aad)
+	require.NoError(t, err)
+
+	external, err := NewLocalKeyProvider("external:" + testKey('e'))
+	require.NoError(t, err)
+	SetKeyProvider(&testKeyProvider{LocalKeyProvider: external, name: "external"})
+	t.Cleanup(func() { SetKeyProvider(nil) })
+
+	// Values of the previous provider need the provider to be registered
+	_, err = Decrypt(ctx, encrypted, aad)
+	assert.ErrorContains(t, err, "encrypted by local")
+
+	RegisterKeyProvider(local)
+	t.Cleanup(func() {
+		keyProvidersMutex.Lock()
+		delete(keyProviders, LocalKeyProviderName)
+		keyProvidersMutex.Unlock()
+	})
+
+	plaintext, err := Decrypt(ctx, encrypted, aad)
+	require.NoError(t, err)
+	assert.Equal(t, "private", string(plaintext))
+
+	// New values are encrypted by the configured provider
+	reencrypted, err := EncryptString(ctx, "private", aad)
+	require.NoError(t, err)
+	envelope, err := ParseEnvelope(reencrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "external", envelope.Provider)
+}
+
+func TestDecryptString_PlaintextCutoff(t *testing.T) {
+	ctx := context.Background()
+
+	// Without a key provider values are never encrypted
+	SetPlaintextCutoff(time.Now().Add(-time.Hour))
+	t.Cleanup(func() { SetPlaintextCutoff(time.Time{}) })
+	value, err := DecryptString(ctx, "plain", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "plain", value)
+
+	provider, err := NewLocalKeyProvider("test:" + testKey('t'))
+	require.NoError(t, err)
+	SetKeyProvider(provider)
+	t.Cleanup(func() { SetKeyProvider(nil) })
+
+	_, err = DecryptString(ctx, "plain", nil)
+	assert.ErrorIs(t, err, ErrPlaintextSecret)
+
+	// Empty values are not encrypted
+	value, err = DecryptString(ctx, "", nil)
+	require.NoError(t, err)
+	assert.Empty(t, value)
+
+	// Before the cutoff plain text is accepted so that it can be re-encrypted
+	SetPlaintextCutoff(time.Now().Add(time.Hour))
+	value, err = DecryptString(ctx, "plain", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "plain", value)
+}
+
+func TestAttributeValue_EncryptsSensitiveFields(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := NewLocalKeyProvider("test:" + testKey('t'))
+	require.NoError(t, err)
+	SetKeyProvider(provider)
+	t.Cleanup(func() { SetKeyProvider(nil) })
+
+	attribute := &model.UserAttribute{
+		ID: "attribute-1", Tenant: "acme", Realm: "customers", Type: model.AttributeTypeTOTP,
+		Value: model.TOTPAttributeValue{SecretKey: "JBSWY3DPEHPK3PXP", FailedAttempts: 1},
+	}
+	stored, err := EncryptAttributeValue(ctx, attribute)
+	require.NoError(t, err)
+	assert.NotContains(t, string(stored), "JBSWY3DPEHPK3PXP")
+	assert.Contains(t, string(stored), `"failed_attempts":1`)
+
+	var decoded interface{}
+	require.NoError(t, json.Unmarshal(stored, &decoded))
+	value, err := DecryptAttributeValue(ctx, attribute, decoded)
+	require.NoError(t, err)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", value.(map[string]interface{})["secret"])
+
+	// The value of another attribute cannot be copied into this one
+	require.NoError(t, json.Unmarshal(stored, &decoded))
+	_, err = DecryptAttributeValue(ctx, &model.UserAttribute{ID: "attribute-2", Tenant: "acme", Realm: "customers", Type: model.AttributeTypeTOTP}, decoded)
+	assert.Error(t, err)
+
+	// Attributes without sensitive fields are stored as is
+	stored, err = EncryptAttributeValue(ctx, &model.UserAttribute{Type: model.AttributeTypeEmail, Value: model.EmailAttributeValue{Email: "alice@example.com"}})
+	require.NoError(t, err)
+	assert.Contains(t, string(stored), "alice@example.com")
+}
+
+func TestSigningKey_RecordsProvider(t *testing.T) {
+	ctx := context.Background()
+
+	key := model.SigningKey{Kid: "kid", Implementation: PlainImplementation, SigningKeyMaterial: "private"}
+
+	// Without a provider keys are stored in plain text
+	stored, err := EncryptSigningKey(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, PlainImplementation, stored.Implementation)
+	assert.Equal(t, "private", stored.SigningKeyMaterial)
+
+	provider, err := NewLocalKeyProvider("test:" + testKey('t'))
+	require.NoError(t, err)
+	SetKeyProvider(provider)
+	t.Cleanup(func() { SetKeyProvider(nil) })
+
+	stored, err = EncryptSigningKey(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, LocalKeyProviderName, stored.Implementation)
+	assert.True(t, IsEncrypted(stored.SigningKeyMaterial))
+
+	require.NoError(t, DecryptSigningKey(ctx, &stored))
+	assert.Equal(t, "private", stored.SigningKeyMaterial)
+}
@@ -0,0 +1,61 @@
+package kms
+
+import (
+	"context"
+	"sync"
+)
+
+// KeyProvider wraps and unwraps data encryption keys (DEK) with a key encryption key (KEK).
+// The local provider keeps the KEKs in memory, other implementations can delegate to an external KMS.
+type KeyProvider interface {
+	// Name identifies the provider. It is stored with every encrypted record and in SigningKey.Implementation.
+	Name() string
+
+	// CurrentKeyID returns the id of the KEK that is used to wrap new data keys
+	CurrentKeyID() string
+
+	// WrapKey encrypts a data key with the current KEK and returns the id of the KEK that was used
+	WrapKey(ctx context.Context, dek []byte) (keyID string, wrapped []byte, err error)
+
+	// UnwrapKey decrypts a data key that was wrapped with the KEK with the given id
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Singleton instance of the KeyProvider, if it is nil secrets are stored in plain text
+var keyProvider KeyProvider
+
+// Providers that can decrypt existing values by their name, e.g. the previous provider while migrating to another KMS
+var (
+	keyProvidersMutex sync.RWMutex
+	keyProviders      = map[string]KeyProvider{}
+)
+
+// SetKeyProvider sets the provider that is used to encrypt secrets at rest. Set it before the server
+// is initialized to use an external KMS, otherwise the local provider is created from the server settings.
+func SetKeyProvider(provider KeyProvider) {
+	keyProvider = provider
+}
+
+// GetKeyProvider returns the configured provider or nil if encryption at rest is disabled
+func GetKeyProvider() KeyProvider {
+	return keyProvider
+}
+
+// RegisterKeyProvider makes a provider available to decrypt values that name it in their envelope without using
+// it for new values. Register the previous provider when moving to another KMS until all secrets are re-encrypted.
+func RegisterKeyProvider(provider KeyProvider) {
+	keyProvidersMutex.Lock()
+	defer keyProvidersMutex.Unlock()
+	keyProviders[provider.Name()] = provider
+}
+
+// getKeyProviderByName returns the provider that encrypted a value, preferring the configured provider
+func getKeyProviderByName(name string) KeyProvider {
+	if provider := GetKeyProvider(); provider != nil && provider.Name() == name {
+		return provider
+	}
+
+	keyProvidersMutex.RLock()
+	defer keyProvidersMutex.RUnlock()
+	return keyProviders[name]
+}
@@ -0,0 +1,157 @@
+package kms
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LocalKeyProviderName is the name of the provider that keeps the KEKs in memory
+const LocalKeyProviderName = "local"
+
+// LocalKeyProvider wraps data keys with AES-256-GCM using KEKs from a file or an environment variable.
+// The first key is used to wrap new data keys, the remaining keys are only used to unwrap existing ones
+// which allows to rotate the KEK by adding a new key in front.
+type LocalKeyProvider struct {
+	currentKeyID string
+	keys         map[string][]byte
+}
+
+// NewLocalKeyProvider parses a list of KEKs in the form "<id>:<base64 encoded 32 byte key>" separated
+// by commas or new lines. Empty lines and lines starting with # are ignored.
+func NewLocalKeyProvider(keyList string) (*LocalKeyProvider, error) {
+	provider := &LocalKeyProvider{keys: map[string][]byte{}}
+
+	entries := strings.FieldsFunc(keyList, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	})
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		keyID, encoded, found := strings.Cut(entry, ":")
+		if !found || keyID == "" {
+			return nil, fmt.Errorf("invalid key encryption key, expected <id>:<base64 key>")
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key encryption key %s: %w", keyID, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key encryption key %s must be 32 bytes but is %d bytes", keyID, len(key))
+		}
+		if _, exists := provider.keys[keyID]; exists {
+			return nil, fmt.Errorf("duplicate key encryption key %s", keyID)
+		}
+
+		provider.keys[keyID] = key
+		if provider.currentKeyID == "" {
+			provider.currentKeyID = keyID
+		}
+	}
+
+	if provider.currentKeyID == "" {
+		return nil, fmt.Errorf("no key encryption key found")
+	}
+
+	return provider, nil
+}
+
+// LoadLocalKeyProvider creates the local provider from a KEK file or the keys from an environment variable.
+// Returns nil if neither is set, in which case secrets are stored in plain text.
+func LoadLocalKeyProvider(keyFile string, keyList string) (*LocalKeyProvider, error) {
+
+	if keyFile != "" && keyList != "" {
+		return nil, fmt.Errorf("only one of the key encryption key file and the key encryption keys can be set")
+	}
+
+	if keyFile != "" {
+		content, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key encryption key file: %w", err)
+		}
+		keyList = string(content)
+	}
+
+	if keyList == "" {
+		return nil, nil
+	}
+
+	return NewLocalKeyProvider(keyList)
+}
+
+func (p *LocalKeyProvider) Name() string {
+	return LocalKeyProviderName
+}
+
+func (p *LocalKeyProvider) CurrentKeyID() string {
+	return p.currentKeyID
+}
+
+func (p *LocalKeyProvider) WrapKey(ctx context.Context, dek []byte) (string, []byte, error) {
+	wrapped, err := sealAESGCM(p.keys[p.currentKeyID], dek, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return p.currentKeyID, wrapped, nil
+}
+
+func (p *LocalKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	kek, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key encryption key %s", keyID)
+	}
+
+	dek, err := openAESGCM(kek, wrapped, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dek, nil
+}
+
+// sealAESGCM encrypts the plaintext with a random nonce that is prepended to the ciphertext
+func sealAESGCM(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// openAESGCM decrypts a ciphertext created by sealAESGCM
+func openAESGCM(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -12,11 +12,22 @@ const (
 	AccessTokenTypeSessionKey AccessTokenType = "session"
 )
 
-// Application represents an OAuth2 client application
+// ApplicationType represents the protocol an application uses to authenticate its users
+type ApplicationType string
+
+const (
+	// ApplicationTypeOAuth2 represents an OAuth2 or OpenID Connect client, this is the default
+	ApplicationTypeOAuth2 ApplicationType = "oauth2"
+	// ApplicationTypeSaml represents a SAML 2.0 service provider
+	ApplicationTypeSaml ApplicationType = "saml"
+)
+
+// Application represents an OAuth2 client application or a SAML service provider
 type Application struct {
 	Tenant                     string          `json:"tenant" yaml:"tenant" db:"tenant"`
 	Realm                      string          `json:"realm" yaml:"realm" db:"realm"`
 	ClientId                   string          `json:"client_id" yaml:"client_id" db:"client_id"`
+	Type                       ApplicationType `json:"type" yaml:"type" db:"application_type"`
 	ClientSecret               string          `json:"-" yaml:"client_secret" db:"client_secret"` // Only in yaml as this is used to load from static configuration
 	Confidential               bool            `json:"confidential" yaml:"confidential" db:"confidential"`
 	ConsentRequired            bool            `json:"consent_required" yaml:"consent_required" db:"consent_required"`
@@ -45,6 +56,7 @@ type ApplicationExtensionSettings struct {
 	Cookie         *CookieSpecification `json:"cookie_specification,omitempty" yaml:"cookie_specification,omitempty" db:"cookie_specification"`
 	OAuth2Settings *OAuth2Settings      `json:"oauth2_settings,omitempty" yaml:"oauth2_settings,omitempty" db:"oauth2_settings"`
 	ArcMapping     []AcrMapping         `json:"arc_mapping,omitempty" yaml:"arc_mapping,omitempty" db:"arc_mapping"`
+	Saml           *SamlSettings        `json:"saml_settings,omitempty" yaml:"saml_settings,omitempty" db:"saml_settings"`
 }
 
 type CookieSpecification struct {
@@ -63,7 +75,33 @@ type OAuth2Settings struct {
 	ShowErrorPageInsteadOfRedirect      bool `json:"show_error_page_instead_of_redirect" yaml:"show_error_page_instead_of_redirect"`         // If true the error page will be shown instead of the redirect
 }
 
+// SamlSettings configures an application of type saml
+type SamlSettings struct {
+	EntityId          string            `json:"entity_id" yaml:"entity_id"`                                       // Entity ID of the service provider, matched against the issuer of its requests
+	AcsUrls           []string          `json:"acs_urls" yaml:"acs_urls"`                                         // Assertion consumer service URLs, the first one is used if the request does not name one
+	NameIdFormat      string            `json:"name_id_format,omitempty" yaml:"name_id_format,omitempty"`         // NameID format of the subject, defaults to the requested format or unspecified
+	AttributeMapping  map[string]string `json:"attribute_mapping,omitempty" yaml:"attribute_mapping,omitempty"`   // SAML attribute name to the user claim it is set from, e.g. "mail": "email"
+	AssertionLifetime int               `json:"assertion_lifetime,omitempty" yaml:"assertion_lifetime,omitempty"` // Lifetime of the assertion in seconds, defaults to 300
+	AllowIdpInitiated bool              `json:"allow_idp_initiated" yaml:"allow_idp_initiated"`                   // Allows the IdP initiated SSO to this service provider
+}
+
 type AcrMapping struct {
-	Acr  string `json:"acr" yaml:"acr"`
-	Flow string `json:"flow" yaml:"flow"`
+	Acr          string `json:"acr" yaml:"acr"`
+	Flow         string `json:"flow" yaml:"flow"`
+	Loa          int    `json:"loa,omitempty" yaml:"loa,omitempty"`                     // Level of assurance the acr requires, the acr is only claimed if the login reached it
+	StepUpFlow   string `json:"step_up_flow,omitempty" yaml:"step_up_flow,omitempty"`   // Flow that is run instead of the flow if the device session of the user is below the loa, e.g. only the second factor
+	DeviceCookie string `json:"device_cookie,omitempty" yaml:"device_cookie,omitempty"` // Name of the device cookie of the device session, defaults to device
+}
+
+// GetAcrMapping returns the acr mapping of the application for the acr, nil if there is none
+func (a *Application) GetAcrMapping(acr string) *AcrMapping {
+	if a == nil || a.Settings == nil || acr == "" {
+		return nil
+	}
+	for i := range a.Settings.ArcMapping {
+		if a.Settings.ArcMapping[i].Acr == acr {
+			return &a.Settings.ArcMapping[i]
+		}
+	}
+	return nil
 }
@@ -7,20 +7,33 @@ import (
 )
 
 const (
-	AttributeTypeTOTP         = "identityplane:totp"
-	AttributeTypeUsername     = "identityplane:username"
-	AttributeTypeGitHub       = "identityplane:github"
-	AttributeTypeTelegram     = "identityplane:telegram"
-	AttributeTypePassword     = "identityplane:password"
-	AttributeTypeEmail        = "identityplane:email"
-	AttributeTypePhone        = "identityplane:phone"
-	AttributeTypePasskey      = "identityplane:passkey"
-	AttributeTypeEntitlements = "identityplane:entitlements"
-	AttributeTypeYubico       = "identityplane:yubico"
-	AttributeTypeDevice       = "identityplane:device"
-	AttributeTypeOidc         = "identityplane:oidc"
+	AttributeTypeTOTP          = "identityplane:totp"
+	AttributeTypeUsername      = "identityplane:username"
+	AttributeTypeGitHub        = "identityplane:github"
+	AttributeTypeTelegram      = "identityplane:telegram"
+	AttributeTypePassword      = "identityplane:password"
+	AttributeTypeEmail         = "identityplane:email"
+	AttributeTypePhone         = "identityplane:phone"
+	AttributeTypePasskey       = "identityplane:passkey"
+	AttributeTypeEntitlements  = "identityplane:entitlements"
+	AttributeTypeYubico        = "identityplane:yubico"
+	AttributeTypeDevice        = "identityplane:device"
+	AttributeTypeOidc          = "identityplane:oidc"
+	AttributeTypeSaml          = "identityplane:saml"
+	AttributeTypeLdap          = "identityplane:ldap"
+	AttributeTypeRecoveryCodes = "identityplane:recovery_codes"
 )
 
+// SensitiveAttributeFields lists the json fields of attribute values that hold credential material.
+// They are encrypted at rest if a key provider is configured.
+var SensitiveAttributeFields = map[string][]string{
+	AttributeTypeTOTP:     {"secret"},
+	AttributeTypePassword: {"password_hash"},
+	AttributeTypeDevice:   {"device_secret_hash"},
+	AttributeTypeGitHub:   {"github_access_token", "github_refresh_token"},
+	AttributeTypeOidc:     {"access_token", "id_token", "refresh_token"},
+}
+
 // AttributeValue is the interface that all attribute value types must implement
 // The GetIndex method returns a unique identifier for the attribute value
 // that can be used for user lookup within a realm
@@ -44,6 +57,10 @@ type EntitlementSetAttributeValue = attributes.EntitlementSetAttributeValue
 type Entitlement = attributes.Entitlement
 type EffectType = attributes.EffectType
 type OidcAttributeValue = attributes.OidcAttributeValue
+type SamlAttributeValue = attributes.SamlAttributeValue
+type LdapAttributeValue = attributes.LdapAttributeValue
+type RecoveryCodesAttributeValue = attributes.RecoveryCodesAttributeValue
+type RecoveryCode = attributes.RecoveryCode
 type DeviceAttributeValue = attributes.DeviceAttributeValue
 
 // Constants for EffectType
@@ -117,6 +134,21 @@ var attributeValueConverters = map[string]attributeValueConverter{
 		err := json.Unmarshal(data, &val)
 		return &val, err
 	},
+	AttributeTypeSaml: func(data []byte) (AttributeValue, error) {
+		var val SamlAttributeValue
+		err := json.Unmarshal(data, &val)
+		return &val, err
+	},
+	AttributeTypeLdap: func(data []byte) (AttributeValue, error) {
+		var val LdapAttributeValue
+		err := json.Unmarshal(data, &val)
+		return &val, err
+	},
+	AttributeTypeRecoveryCodes: func(data []byte) (AttributeValue, error) {
+		var val RecoveryCodesAttributeValue
+		err := json.Unmarshal(data, &val)
+		return &val, err
+	},
 }
 
 // ConvertMapToAttributeValue converts a map[string]interface{} to an AttributeValue
@@ -46,7 +46,8 @@ type Session struct {
 	SessionExpiry       time.Time `json:"session_expiry" example:"2024-01-01T00:00:00Z"` // The expiry time of the session
 	SessionRefreshAfter int       `json:"session_refresh_after" example:"1800"`          // The time after which the session will be refreshed (if the session has an activity after expiry-refresh but before expiry, the session will be refreshed)
 
-	LevelOfAssurance int `json:"level_of_assurance"` // The level of assurance for the session
+	LevelOfAssurance int      `json:"level_of_assurance"`     // The level of assurance for the session
+	AuthMethods      []string `json:"auth_methods,omitempty"` // The authentication methods the user was verified with when the session started, e.g. pwd and otp
 }
 
 // LoaToExpiryMapping is a mapping of level of assurance to duration and refresh after
@@ -142,6 +143,30 @@ func (d *DeviceAttributeValue) CurrentLoa(now time.Time) int {
 	return loa
 }
 
+// CurrentSession returns the active session with the highest level of assurance
+func (d *DeviceAttributeValue) CurrentSession(now time.Time) *Session {
+	if d.SessionLoa2 != nil && d.SessionLoa2.IsActive(now) {
+		return d.SessionLoa2
+	}
+	if d.SessionLoa1 != nil && d.SessionLoa1.IsActive(now) {
+		return d.SessionLoa1
+	}
+	return &d.SessionLoa0
+}
+
+// RaiseLoa starts the sessions above the current level of assurance up to the loa, e.g. after a step up authentication
+// with the second factor. Sessions that are still active are kept.
+func (d *DeviceAttributeValue) RaiseLoa(now time.Time, loa int, methods []string, mappings []LoaToExpiryMapping) {
+	if loa >= 1 && len(mappings) > 1 && (d.SessionLoa1 == nil || !d.SessionLoa1.IsActive(now)) {
+		d.SessionLoa1 = InitSession(now, mappings[1])
+		d.SessionLoa1.AuthMethods = methods
+	}
+	if loa >= 2 && len(mappings) > 2 && (d.SessionLoa2 == nil || !d.SessionLoa2.IsActive(now)) {
+		d.SessionLoa2 = InitSession(now, mappings[2])
+		d.SessionLoa2.AuthMethods = methods
+	}
+}
+
 // DEFAULT_LOA_TO_EXPIRY_MAPPINGS is the default mapping of level of assurance to duration and refresh after
 var DEFAULT_LOA_TO_EXPIRY_MAPPINGS = []LoaToExpiryMapping{
 	{
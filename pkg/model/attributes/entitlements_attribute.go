@@ -23,6 +23,7 @@ type Entitlement struct {
 	Resource    string     `json:"resource" example:"arn:identityplane:acme:customers:users:123"`
 	Action      string     `json:"action" example:"read"`
 	Effect      EffectType `json:"effect" example:"allow"`
+	Source      string     `json:"source,omitempty" example:"ldap"` // Set if the entitlement is managed by an import, e.g. the LDAP sync
 }
 
 // EffectType represents the effect of an entitlement
@@ -0,0 +1,27 @@
+package attributes
+
+// LdapAttributeValue is the attribute value of a user that logged in with or was imported from an LDAP directory
+type LdapAttributeValue struct {
+
+	// @description The unique id of the directory entry, e.g. its entryUUID or objectGUID
+	Id string `json:"id" example:"8f0d8e7a-3c55-4f07-9a57-3f2d1c4b1e2a"`
+
+	// @description The distinguished name of the directory entry
+	DN string `json:"dn" example:"uid=jane,ou=people,dc=example,dc=com"`
+
+	// @description The username the user logs in with at the directory
+	Username string `json:"username" example:"jane"`
+
+	// @description The mapped attributes of the entry at the last login or sync
+	Attributes map[string][]string `json:"attributes" example:"map[string][]string"`
+}
+
+// GetIndex returns the index of the ldap attribute value
+func (l *LdapAttributeValue) GetIndex() string {
+	return l.Id
+}
+
+// IndexIsSensitive returns whether the index should be omitted from JSON API responses
+func (l *LdapAttributeValue) IndexIsSensitive() bool {
+	return false // The id of the entry is an identifier and not a credential
+}
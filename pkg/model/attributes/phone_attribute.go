@@ -8,6 +8,9 @@ type PhoneAttributeValue struct {
 	Phone      string     `json:"phone" example:"+1234567890"`
 	Verified   bool       `json:"verified" example:"true"`
 	VerifiedAt *time.Time `json:"verified_at" example:"2024-01-01T00:00:00Z"`
+
+	OtpFailedAttempts int  `json:"otp_failed_attempts" example:"0"`
+	OtpLocked         bool `json:"otp_locked" example:"false"`
 }
 
 // GetIndex returns the index of the phone attribute value
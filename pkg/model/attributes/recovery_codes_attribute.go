@@ -0,0 +1,53 @@
+package attributes
+
+import "time"
+
+// RecoveryCodesAttributeValue is the attribute value for recovery codes
+// @description Single use codes that replace a lost second factor
+type RecoveryCodesAttributeValue struct {
+	// @description The hashed codes, used codes are kept so they cannot be used again
+	Codes []RecoveryCode `json:"codes"`
+
+	// @description When the codes were generated
+	CreatedAt time.Time `json:"created_at" example:"2024-01-01T00:00:00Z"`
+
+	// @description Whether the codes are locked
+	Locked bool `json:"locked" example:"false"`
+
+	// @description The number of failed attempts
+	FailedAttempts int `json:"failed_attempts" example:"0"`
+}
+
+// RecoveryCode is a single recovery code
+type RecoveryCode struct {
+	// @description The first characters of the code, so that a code is only compared with the hash of the matching code
+	ID string `json:"id,omitempty" example:"ab"`
+
+	// @description The bcrypt hash of the code
+	Hash string `json:"hash" example:"$2a$10$..."`
+
+	// @description When the code was used, empty if it is still valid
+	UsedAt *time.Time `json:"used_at,omitempty" example:"2024-01-01T00:00:00Z"`
+}
+
+// Remaining returns the number of codes that were not used yet
+func (r *RecoveryCodesAttributeValue) Remaining() int {
+	remaining := 0
+	for _, code := range r.Codes {
+		if code.UsedAt == nil {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+// GetIndex returns the index of the recovery codes attribute value
+// Recovery codes are not used for lookup, so return empty string
+func (r *RecoveryCodesAttributeValue) GetIndex() string {
+	return ""
+}
+
+// IndexIsSensitive returns whether the index should be omitted from JSON API responses
+func (r *RecoveryCodesAttributeValue) IndexIsSensitive() bool {
+	return true // Recovery codes are sensitive (even though they don't have an index)
+}
@@ -0,0 +1,30 @@
+package attributes
+
+// SamlAttributeValue is the attribute value of a user that logged in with a federated SAML identity provider
+type SamlAttributeValue struct {
+
+	// @description The entity id of the identity provider
+	IdpEntityId string `json:"idp_entity_id" example:"https://idp.example.com/adfs/services/trust"`
+
+	// @description The NameID of the user at the identity provider
+	NameId string `json:"name_id" example:"jane.doe@example.com"`
+
+	// @description The format of the NameID
+	NameIdFormat string `json:"name_id_format" example:"urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"`
+
+	// @description The session index of the last login at the identity provider
+	SessionIndex string `json:"session_index" example:"_be9967abd904ddcae3c0eb4189adbe3f71e327cf93"`
+
+	// @description The attributes of the assertion of the last login
+	Attributes map[string][]string `json:"attributes" example:"map[string][]string"`
+}
+
+// GetIndex returns the index of the saml attribute value
+func (s *SamlAttributeValue) GetIndex() string {
+	return s.IdpEntityId + "/" + s.NameId
+}
+
+// IndexIsSensitive returns whether the index should be omitted from JSON API responses
+func (s *SamlAttributeValue) IndexIsSensitive() bool {
+	return false // The NameID is an identifier and not a credential
+}
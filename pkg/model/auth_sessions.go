@@ -1,6 +1,7 @@
 package model
 
 import (
+	"slices"
 	"time"
 
 	"github.com/Identityplane/GoAM/internal/logger"
@@ -14,12 +15,17 @@ const (
 	NODE_ERROR          = "error"
 )
 
+// AuthSessionLifetime is how long a run of a flow can take, the session expires this long after it was created
+const AuthSessionLifetime = 30 * time.Minute
+
 // Represents a ongoing execution of a flow
 type AuthenticationSession struct {
 	RealmObject
 	RunID                        string             `json:"run_id"`            // Unique identifier for the flow execution
 	SessionIdHash                string             `json:"session_id_hash"`   // Hash of the session id
 	FlowId                       string             `json:"flow_id"`           // Id of the flow
+	FlowVersion                  int                `json:"flow_version"`      // Version of the flow definition the session is pinned to
+	FlowVariant                  string             `json:"flow_variant"`      // Name of the rollout variant the session was assigned to, if any
 	Current                      string             `json:"current"`           // name of the active node
 	CurrentType                  string             `json:"current_type"`      // type of the active node
 	Context                      map[string]string  `json:"context"`           // dynamic values (inputs + outputs)
@@ -30,6 +36,7 @@ type AuthenticationSession struct {
 	Prompts                      map[string]string  `json:"prompts,omitempty"` // Prompts to be shown to the user, if applicable
 	Oauth2SessionInformation     *Oauth2Session     `json:"oauth2_request,omitempty"`
 	SimpleAuthSessionInformation *SimpleAuthContext `json:"simple_auth_request,omitempty"`
+	SamlSessionInformation       *SamlSession       `json:"saml_request,omitempty"`
 	CreatedAt                    time.Time          `json:"created_at"` // Time the session was created
 	ExpiresAt                    time.Time          `json:"expires_at"` // Time when this auth session will expire
 
@@ -48,6 +55,104 @@ type AuthenticationSession struct {
 
 	// HttpAuthContext is the context for the http authentication
 	HttpAuthContext *HttpAuthContext `json:"http_auth_context,omitempty"`
+
+	// Subflows are the parent flows of the subflow that is currently running, innermost last.
+	// While a subflow runs the context only contains the values of the child flow.
+	Subflows []SubflowFrame `json:"subflows,omitempty"`
+
+	// LastError is the last error of a node that the flow handled with an error transition or its on_error node.
+	// Error only holds the message for the user, LastError also has the code and the class of the error.
+	LastError *FlowError `json:"last_error,omitempty"`
+
+	// Steps are the nodes that prompted the user since the last transition that cannot be reversed, the current
+	// node last. They allow the user to go back to a previous node.
+	Steps []FlowStep `json:"steps,omitempty"`
+
+	// PromptedAt is the time the current node prompted the user, it measures how long the user needs for a step
+	PromptedAt time.Time `json:"prompted_at"`
+
+	// AuthMethods are the authentication methods, e.g. pwd or otp, that nodes verified for the user AuthMethodsUserID
+	AuthMethods       []string `json:"auth_methods,omitempty"`
+	AuthMethodsUserID string   `json:"auth_methods_user_id,omitempty"`
+}
+
+// FlowStep is a snapshot of the session taken when a node prompted the user. Secrets are not part of the
+// snapshot, they are not restored when the user returns to the step.
+type FlowStep struct {
+	Node     string            `json:"node"`               // name of the node that prompted the user
+	Context  map[string]string `json:"context"`            // context when the node prompted the user
+	Subflows []SubflowFrame    `json:"subflows,omitempty"` // running subflows when the node prompted the user
+	UserID   string            `json:"user_id,omitempty"`  // id of the user of the session, empty if there was none
+}
+
+// SubflowFrame holds the state of a parent flow while one of its subflow nodes runs the child flow
+type SubflowFrame struct {
+	Node    string            `json:"node"`             // name of the subflow node in the parent flow
+	Context map[string]string `json:"context"`          // context of the parent flow, restored once the child flow returns
+	Result  string            `json:"result,omitempty"` // result of the child flow, set when it reaches one of its result nodes
+}
+
+// CurrentSubflow returns the frame of the innermost running subflow or nil if the session is in the main flow
+func (s *AuthenticationSession) CurrentSubflow() *SubflowFrame {
+	if len(s.Subflows) == 0 {
+		return nil
+	}
+	return &s.Subflows[len(s.Subflows)-1]
+}
+
+// Snapshot returns the step of the current node without the secrets of the context
+func (s *AuthenticationSession) Snapshot() FlowStep {
+	step := FlowStep{
+		Node:     s.Current,
+		Context:  withoutSensitiveValues(s.Context),
+		Subflows: mapSubflowContexts(s.Subflows, withoutSensitiveValues),
+	}
+	if step.Context == nil {
+		step.Context = map[string]string{}
+	}
+	if s.User != nil {
+		step.UserID = s.User.ID
+	}
+	return step
+}
+
+// AddAuthMethod records that a node verified the method for the user of the session. The methods of another user are
+// discarded, e.g. if the user went back and logged in with a different account.
+func (s *AuthenticationSession) AddAuthMethod(method string) {
+	userID := ""
+	if s.User != nil {
+		userID = s.User.ID
+	}
+
+	if s.AuthMethodsUserID != userID {
+		s.AuthMethods = nil
+		s.AuthMethodsUserID = userID
+	}
+	if !slices.Contains(s.AuthMethods, method) {
+		s.AuthMethods = append(s.AuthMethods, method)
+	}
+}
+
+// AuthLevel returns the level of the methods that were verified for the user
+func (s *AuthenticationSession) AuthLevel(userID string) AuthLevel {
+	if s.AuthMethodsUserID != userID {
+		return ""
+	}
+	return AuthLevelOf(s.AuthMethods)
+}
+
+// ClientID returns the id of the application that started the flow or an empty string if there is none
+func (s *AuthenticationSession) ClientID() string {
+	if s.Oauth2SessionInformation != nil && s.Oauth2SessionInformation.AuthorizeRequest != nil {
+		return s.Oauth2SessionInformation.AuthorizeRequest.ClientID
+	}
+	if s.SimpleAuthSessionInformation != nil && s.SimpleAuthSessionInformation.Request != nil {
+		return s.SimpleAuthSessionInformation.Request.ClientID
+	}
+	if s.SamlSessionInformation != nil {
+		return s.SamlSessionInformation.ClientID
+	}
+	return ""
 }
 
 func (s *AuthenticationSession) GetLatestHistory() string {
@@ -98,8 +203,14 @@ func (s *AuthenticationSession) GetLogger() zerolog.Logger {
 		Str("session_id", s.SessionIdHash[:8]). // First 8 chars for readability
 		Str("run_id", s.RunID).
 		Str("flow_id", s.FlowId).
+		Int("flow_version", s.FlowVersion).
 		Str("current_node", s.Current)
 
+	// Add the rollout variant if the flow has one
+	if s.FlowVariant != "" {
+		event = event.Str("flow_variant", s.FlowVariant)
+	}
+
 	// Add user context if available
 	if s.User != nil {
 		event = event.Str("user_id", s.User.ID)
@@ -113,10 +224,21 @@ func (s *AuthenticationSession) GetLogger() zerolog.Logger {
 	return event.Logger()
 }
 
+// SamlSession holds the SAML request of a flow that authenticates a user for a SAML service provider
+type SamlSession struct {
+	ClientID     string    `json:"client_id"`                // Client id of the application of the service provider
+	RequestID    string    `json:"request_id,omitempty"`     // ID of the AuthnRequest, empty for IdP initiated SSO
+	AcsUrl       string    `json:"acs_url"`                  // Validated assertion consumer service URL the response is posted to
+	RelayState   string    `json:"relay_state,omitempty"`    // Relay state that is returned to the service provider
+	NameIdFormat string    `json:"name_id_format,omitempty"` // NameID format requested by the service provider
+	AuthTime     time.Time `json:"auth_time"`
+}
+
 type Oauth2Session struct {
 	AuthorizeRequest *AuthorizeRequest `json:"authorize_request"`
 	AuthTime         time.Time         `json:"auth_time"`
 	Acr              string            `json:"acr"`
+	StepUpDevice     string            `json:"step_up_device,omitempty"` // ID of the device whose session the flow steps up to the level of the acr
 }
 
 // AuthorizeRequest represents the parameters for the authorization request
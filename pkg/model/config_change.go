@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Types of configuration entities that are propagated between instances
+const (
+	ConfigEntityRealm       = "realm"
+	ConfigEntityFlow        = "flow"
+	ConfigEntityFlowRoute   = "flow_route"
+	ConfigEntityApplication = "application"
+	ConfigEntityTemplates   = "templates"
+)
+
+// ConfigChange records that a configuration entity of a realm was created, updated or deleted.
+// Changes are stored in an append only log, the version is assigned by the database and increases monotonically.
+type ConfigChange struct {
+	Version    int64     `json:"version" db:"version"`
+	Tenant     string    `json:"tenant" db:"tenant"`
+	Realm      string    `json:"realm" db:"realm"`
+	EntityType string    `json:"entity_type" db:"entity_type"` // e.g. "flow"
+	EntityId   string    `json:"entity_id" db:"entity_id"`     // e.g. the flow id, empty for realm wide changes
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
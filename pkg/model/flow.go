@@ -2,6 +2,7 @@ package model
 
 import (
 	"errors"
+	"slices"
 	"time"
 )
 
@@ -27,12 +28,15 @@ type GraphNode struct {
 	Use          string            `json:"use"`                     // reference to NodeDefinition.Name
 	Next         map[string]string `json:"next"`                    // condition -> next GraphNode.Name
 	CustomConfig map[string]string `json:"custom_config,omitempty"` // for overrides (optional)
+	Timeout      string            `json:"timeout,omitempty"`       // maximum duration of a step of the node, e.g. "5s" (optional)
+	Reversible   []string          `json:"reversible,omitempty"`    // result states whose transitions the user can reverse with back (optional)
 }
 
 // This is the flow definition, usually stored as a yaml file
 type FlowDefinition struct {
 	Description string                `json:"description"`
-	Start       string                `json:"start"` // e.g., "init"
+	Start       string                `json:"start"`              // e.g., "init"
+	OnError     string                `json:"on_error,omitempty"` // node that handles errors of nodes without an error transition (optional)
 	Nodes       map[string]*GraphNode `json:"nodes"`
 }
 
@@ -48,6 +52,8 @@ type Flow struct {
 	Definition         *FlowDefinition `json:"-" yaml:"-" db:"-"`                                                                           // pre-loaded flow definition
 	DefinitionYaml     string          `json:"-" yaml:"-" db:"definition_yaml"`                                                             // original yaml content, we keep that in order to perserve the exactly same yaml
 	DefinitionLocation string          `json:"definition_location,omitempty" yaml:"definition_location,omitempty" db:"definition_location"` // path to the yaml file
+	ActiveVersion      int             `json:"active_version" yaml:"-" db:"active_version"`                                                 // published version of the definition, 0 if the flow has no versions yet
+	Variants           FlowVariants    `json:"variants,omitempty" yaml:"-" db:"variants"`                                                   // weighted rollout between versions, if empty all sessions use the active version
 	CreatedAt          time.Time       `json:"created_at" yaml:"-" db:"created_at"`
 	UpdatedAt          time.Time       `json:"updated_at" yaml:"-" db:"updated_at"`
 }
@@ -60,6 +66,42 @@ const (
 	AuthLevel2FA             AuthLevel = "2"
 )
 
+// Authentication methods that nodes record in the session once they verified a factor of the user. The values are
+// registered in RFC 8176, except for rc which stands for recovery codes.
+const (
+	AuthMethodPassword     = "pwd"
+	AuthMethodOtp          = "otp"
+	AuthMethodSms          = "sms"
+	AuthMethodHardwareKey  = "hwk" // a passkey that is bound to the device
+	AuthMethodSoftwareKey  = "swk" // a passkey that can be synced between devices
+	AuthMethodRecoveryCode = "rc"
+)
+
+// possessionAuthMethods prove that the user has an authenticator, together with another method they are two factors
+var possessionAuthMethods = []string{AuthMethodOtp, AuthMethodSms, AuthMethodHardwareKey, AuthMethodSoftwareKey, AuthMethodRecoveryCode}
+
+// AuthLevelOf returns the level of the verified methods: two factors need a possession method and a method of
+// another kind, e.g. a password and a TOTP code. The level is empty if no method was recorded.
+func AuthLevelOf(methods []string) AuthLevel {
+	if len(methods) == 0 {
+		return ""
+	}
+
+	possession, other := false, false
+	for _, method := range methods {
+		if slices.Contains(possessionAuthMethods, method) {
+			possession = true
+		} else {
+			other = true
+		}
+	}
+
+	if possession && other {
+		return AuthLevel2FA
+	}
+	return AuthLevel1FA
+}
+
 type FlowResult struct {
 	UserID        string    `json:"user_id"`
 	Authenticated bool      `json:"authenticated"`
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Metrics of the flow analytics. The node of started, succeeded and failed is the result node or empty,
+// the other metrics are counted per node that prompted the user.
+const (
+	FlowStatStarted   = "started"   // runs of the flow that were started
+	FlowStatSucceeded = "succeeded" // runs that reached a result node that authenticated the user
+	FlowStatFailed    = "failed"    // runs that reached a result node that did not authenticate the user
+	FlowStatReached   = "reached"   // runs in which the node prompted the user at least once
+	FlowStatWaiting   = "waiting"   // runs that wait at the node, they are abandoned if they do not continue before the session expires
+	FlowStatSubmitted = "submitted" // inputs submitted to the node
+)
+
+// FlowStatsBucketSize is the time span that is aggregated in one row
+const FlowStatsBucketSize = time.Hour
+
+// FlowStepTimeBounds are the upper bounds of the step time histogram, a longer step is counted as "inf"
+var FlowStepTimeBounds = []time.Duration{
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second, 20 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute,
+}
+
+// FlowStepTimeMetric returns the metric of the histogram bucket for the time the user needed for a step,
+// e.g. "step_time_le_5s"
+func FlowStepTimeMetric(d time.Duration) string {
+	for _, bound := range FlowStepTimeBounds {
+		if d <= bound {
+			return fmt.Sprintf("step_time_le_%s", bound)
+		}
+	}
+	return "step_time_le_inf"
+}
+
+// FlowStat is a counter of the flow analytics for one flow, client, hour and node
+type FlowStat struct {
+	Tenant   string    `json:"tenant" db:"tenant"`
+	Realm    string    `json:"realm" db:"realm"`
+	FlowId   string    `json:"flow_id" db:"flow_id"`
+	ClientId string    `json:"client_id" db:"client_id"` // Empty if the flow was not started by an application
+	Bucket   time.Time `json:"bucket" db:"bucket"`       // Start of the hour in which the runs were started
+	Node     string    `json:"node" db:"node"`
+	Metric   string    `json:"metric" db:"metric"`
+	Value    int64     `json:"value" db:"value"`
+}
+
+// FlowStatsFilter selects the counters of a realm, empty fields match all values
+type FlowStatsFilter struct {
+	FlowId   string
+	ClientId string
+	From     time.Time // inclusive
+	To       time.Time // exclusive
+}
+
+// FlowEventType is the type of a FlowEvent
+type FlowEventType string
+
+const (
+	FlowEventStarted   FlowEventType = "started"   // the flow started a new run
+	FlowEventPrompted  FlowEventType = "prompted"  // a node prompted the user, a node that only renders its prompts again is not reported
+	FlowEventSubmitted FlowEventType = "submitted" // the user submitted the inputs of the node that prompted
+	FlowEventFinished  FlowEventType = "finished"  // the run reached a result node
+)
+
+// FlowEvent is reported by the flow engine when a run of a flow makes progress
+type FlowEvent struct {
+	Type     FlowEventType
+	Node     string        // name of the node, empty for started
+	Previous string        // node at which the run waited before, for prompted and finished
+	First    bool          // for prompted, true if the node prompted the first time in the run
+	Duration time.Duration // for submitted, time between the prompt and the submission
+	Success  bool          // for finished, true if the user was authenticated
+}
+
+// FlowFunnel is how the runs of a flow progressed in a time range
+type FlowFunnel struct {
+	FlowId     string           `json:"flow_id"`
+	Started    int64            `json:"started"`
+	Succeeded  int64            `json:"succeeded"`
+	Failed     int64            `json:"failed"`
+	Abandoned  int64            `json:"abandoned"`   // runs without result whose session expired
+	InProgress int64            `json:"in_progress"` // runs without result whose session may not have expired yet
+	Steps      []FlowFunnelStep `json:"steps"`
+}
+
+// FlowFunnelStep is a node of the flow that prompted the user
+type FlowFunnelStep struct {
+	Node              string  `json:"node"`
+	Reached           int64   `json:"reached"`
+	Abandoned         int64   `json:"abandoned"`
+	InProgress        int64   `json:"in_progress"`
+	Submitted         int64   `json:"submitted"`
+	MedianStepSeconds float64 `json:"median_step_seconds"` // upper bound of the histogram bucket of the median, -1 if longer than the largest bound
+}
@@ -36,3 +36,23 @@ func TestFlowDeserialization(t *testing.T) {
 	assert.True(t, flow.Active, "Active should be true")
 	assert.Equal(t, "login.yaml", flow.DefinitionLocation, "DefinitionLocation mismatch")
 }
+
+func TestAuthLevel(t *testing.T) {
+	assert.Equal(t, AuthLevel(""), AuthLevelOf(nil))
+	assert.Equal(t, AuthLevel1FA, AuthLevelOf([]string{AuthMethodPassword}))
+	assert.Equal(t, AuthLevel1FA, AuthLevelOf([]string{AuthMethodOtp, AuthMethodRecoveryCode}))
+	assert.Equal(t, AuthLevel2FA, AuthLevelOf([]string{AuthMethodPassword, AuthMethodOtp}))
+	assert.Equal(t, AuthLevel2FA, AuthLevelOf([]string{AuthMethodPassword, AuthMethodRecoveryCode}))
+
+	session := &AuthenticationSession{User: &User{ID: "alice"}}
+	session.AddAuthMethod(AuthMethodPassword)
+	session.AddAuthMethod(AuthMethodPassword)
+	assert.Equal(t, []string{AuthMethodPassword}, session.AuthMethods)
+
+	// The methods of another user do not count
+	session.User = &User{ID: "bob"}
+	assert.Equal(t, AuthLevel(""), session.AuthLevel("bob"))
+	session.AddAuthMethod(AuthMethodRecoveryCode)
+	assert.Equal(t, AuthLevel1FA, session.AuthLevel("bob"))
+	assert.Equal(t, AuthLevel(""), session.AuthLevel("alice"))
+}
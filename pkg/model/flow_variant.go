@@ -0,0 +1,111 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// FlowVariant routes a share of the new sessions of a flow to a version of its definition
+type FlowVariant struct {
+	Name    string `json:"name"`    // e.g. "redesign", used in logs and metrics
+	Version int    `json:"version"` // version of the flow definition
+	Weight  int    `json:"weight"`  // weight relative to the other variants, e.g. 95 and 5
+}
+
+// FlowVariants are stored as a json column
+type FlowVariants []FlowVariant
+
+// Value implements driver.Valuer
+func (v FlowVariants) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (v *FlowVariants) Scan(src interface{}) error {
+	var data []byte
+
+	switch s := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case string:
+		data = []byte(s)
+	case []byte:
+		data = s
+	default:
+		return fmt.Errorf("cannot scan %T into FlowVariants", src)
+	}
+
+	if len(data) == 0 {
+		*v = nil
+		return nil
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// Get returns the variant with the name, nil if there is none
+func (v FlowVariants) Get(name string) *FlowVariant {
+	for i := range v {
+		if v[i].Name == name {
+			return &v[i]
+		}
+	}
+	return nil
+}
+
+// TotalWeight returns the sum of the weights of all variants
+func (v FlowVariants) TotalWeight() int {
+	total := 0
+	for _, variant := range v {
+		total += variant.Weight
+	}
+	return total
+}
+
+const (
+	FlowVariantResultSucceeded = "succeeded"
+	FlowVariantResultFailed    = "failed"
+)
+
+// FlowVariantAssignment stores the variant a device was assigned to the first time it started the flow, so that it
+// stays on the variant when the weights change
+type FlowVariantAssignment struct {
+	Tenant    string    `json:"tenant" db:"tenant"`
+	Realm     string    `json:"realm" db:"realm"`
+	FlowId    string    `json:"flow_id" db:"flow_id"`
+	StickyKey string    `json:"sticky_key" db:"sticky_key"` // hash of the device id
+	Variant   string    `json:"variant" db:"variant"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// FlowVariantSession is the audit record of a session that ran on a rollout variant
+type FlowVariantSession struct {
+	Tenant     string     `json:"tenant" db:"tenant"`
+	Realm      string     `json:"realm" db:"realm"`
+	FlowId     string     `json:"flow_id" db:"flow_id"`
+	RunID      string     `json:"run_id" db:"run_id"`
+	Variant    string     `json:"variant" db:"variant"`
+	Version    int        `json:"version" db:"version"`
+	Result     string     `json:"result" db:"result"` // empty until the session finished, then FlowVariantResultSucceeded or FlowVariantResultFailed
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// FlowVariantCount counts the sessions of a rollout variant
+type FlowVariantCount struct {
+	Variant   string `json:"variant" db:"variant"`
+	Started   uint64 `json:"started" db:"started"`
+	Succeeded uint64 `json:"succeeded" db:"succeeded"`
+	Failed    uint64 `json:"failed" db:"failed"`
+}
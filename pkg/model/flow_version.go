@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// FlowVersion is an immutable snapshot of a flow definition. Every save of a flow definition creates a new version,
+// the version that is used for new logins is referenced by Flow.ActiveVersion. All other versions are either
+// drafts (newer than the active version) or previously published versions.
+type FlowVersion struct {
+	Tenant         string    `json:"tenant" db:"tenant"`
+	Realm          string    `json:"realm" db:"realm"`
+	FlowId         string    `json:"flow_id" db:"flow_id"`
+	Version        int       `json:"version" db:"version"` // assigned by the database, starts at 1 per flow
+	DefinitionYaml string    `json:"definition_yaml" db:"definition_yaml"`
+	Comment        string    `json:"comment,omitempty" db:"comment"` // optional description of the change
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	Active         bool      `json:"active" db:"-"` // whether this is the published version of the flow
+}
+
+// FlowPublication records that a version of a flow was published. The publications of a flow form its publish
+// history, which is used to roll back to the version that was published before.
+type FlowPublication struct {
+	Tenant          string    `json:"tenant" db:"tenant"`
+	Realm           string    `json:"realm" db:"realm"`
+	FlowId          string    `json:"flow_id" db:"flow_id"`
+	Version         int       `json:"version" db:"version"`
+	PreviousVersion int       `json:"previous_version" db:"previous_version"` // the version that was active before, 0 for the first publication
+	PublishedAt     time.Time `json:"published_at" db:"published_at"`
+}
@@ -10,6 +10,13 @@ type HttpAuthContext struct {
 	RequestHeaders map[string]string `json:"request_headers"`
 	RequestCookies map[string]string `json:"request_cookies"`
 
+	// RequestQuery are the query parameters of the incoming request, e.g. of a link that was sent to the user.
+	// They may carry one-time tokens and are not persisted with the session.
+	RequestQuery map[string]string `json:"-"`
+
+	// RequestMethod is the http method of the incoming request, e.g. nodes only use one-time tokens with a POST
+	RequestMethod string `json:"-"`
+
 	// Response Modifications
 	AdditionalResponseHeaders map[string]string      `json:"additional_response_headers"`
 	AdditionalResponseCookies map[string]http.Cookie `json:"additional_response_cookies"`
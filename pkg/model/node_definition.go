@@ -1,5 +1,14 @@
 package model
 
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // NodeDefinition is a definition of a node in the graph
 type NodeDefinition struct {
 	Name                 string            // e.g. "askUsername", references as use
@@ -7,10 +16,113 @@ type NodeDefinition struct {
 	Description          string            // Description of the node as text
 	Category             string            // Category for the editor
 	Type                 NodeType          // query, logic, etc.
-	RequiredContext      []string          `json:"inputs"`  // field that the node requires from the flow context
-	OutputContext        []string          `json:"outputs"` // fields that the node will set in the flow context
-	PossiblePrompts      map[string]string `json:"prompts"` // key: label/type shown to user, will be returned via the user input argument
+	RequiredContext      []string          `json:"inputs"`              // field that the node requires from the flow context
+	OutputContext        []string          `json:"outputs"`             // fields that the node will set in the flow context
+	PossiblePrompts      map[string]string `json:"prompts"`             // key: label/type shown to user, will be returned via the user input argument
+	SensitiveContext     []string          `json:"sensitive,omitempty"` // secret fields the node consumes, removed from the flow context once the node is done
 	PossibleResultStates []string
 	CustomConfigOptions  map[string]string                                                                                                         // e.g. ["success", "fail"]
 	Run                  func(state *AuthenticationSession, node *GraphNode, input map[string]string, services *Repositories) (*NodeResult, error) // Run function for logic nodes, must either return a condition or a set of prompts
+
+	// ResultStates returns the result states of a configured node, it is only set for nodes whose result states
+	// are defined in the flow, e.g. the outcomes of a condition node. PossibleResultStates is used otherwise.
+	ResultStates func(node *GraphNode) []string `json:"-"`
+
+	// ValidateConfig checks the custom config of a node when the flow is validated, e.g. to parse expressions up front
+	ValidateConfig func(node *GraphNode) error `json:"-"`
+
+	// DirectConnections marks nodes that connect to external services themselves instead of through the
+	// repositories, e.g. to a directory. Their calls cannot be mocked, so flow tests refuse to run them.
+	DirectConnections bool `json:"direct_connections,omitempty"`
+
+	// ConfigSchema describes the custom config options with their type, default and whether they are required.
+	// Options in the schema are config options of the node in addition to CustomConfigOptions.
+	ConfigSchema map[string]ConfigOption `json:"config_schema,omitempty"`
+}
+
+type ConfigOptionType string
+
+const (
+	ConfigOptionString   ConfigOptionType = "string"
+	ConfigOptionInt      ConfigOptionType = "int"
+	ConfigOptionBool     ConfigOptionType = "bool"
+	ConfigOptionDuration ConfigOptionType = "duration" // e.g. "30s", parsed with time.ParseDuration
+	ConfigOptionEnum     ConfigOptionType = "enum"     // one of Values
+)
+
+// ConfigOption describes a custom config option of a node
+type ConfigOption struct {
+	Description string           `json:"description"`
+	Type        ConfigOptionType `json:"type,omitempty"` // string if empty
+	Required    bool             `json:"required,omitempty"`
+	Default     string           `json:"default,omitempty"`
+	Values      []string         `json:"values,omitempty"` // allowed values of enum options
+
+	// Secret options such as api keys are set in the realm or server settings instead of the flow
+	// and are not passed to the templates
+	Secret bool `json:"secret,omitempty"`
+}
+
+// ConfigOptionNames returns the names of all custom config options of the node, sorted by name
+func (d *NodeDefinition) ConfigOptionNames() []string {
+	names := make([]string, 0, len(d.CustomConfigOptions)+len(d.ConfigSchema))
+	for name := range d.CustomConfigOptions {
+		names = append(names, name)
+	}
+	for name := range d.ConfigSchema {
+		if _, ok := d.CustomConfigOptions[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasConfigOption checks if the option is a custom config option of the node
+func (d *NodeDefinition) HasConfigOption(name string) bool {
+	if _, ok := d.CustomConfigOptions[name]; ok {
+		return true
+	}
+	_, ok := d.ConfigSchema[name]
+	return ok
+}
+
+// ValidateValue checks that the value has the type of the option, empty values are valid
+func (o ConfigOption) ValidateValue(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	switch o.Type {
+	case "", ConfigOptionString:
+		return nil
+	case ConfigOptionInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("'%s' is not an integer", value)
+		}
+	case ConfigOptionBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("'%s' is not a boolean", value)
+		}
+	case ConfigOptionDuration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("'%s' is not a duration", value)
+		}
+	case ConfigOptionEnum:
+		if !slices.Contains(o.Values, value) {
+			return fmt.Errorf("'%s' is not one of %s", value, strings.Join(o.Values, ", "))
+		}
+	default:
+		return fmt.Errorf("unknown option type '%s'", o.Type)
+	}
+
+	return nil
+}
+
+// ResultStatesFor returns the result states the configured node can return
+func (d *NodeDefinition) ResultStatesFor(node *GraphNode) []string {
+	if d.ResultStates != nil && node != nil {
+		return d.ResultStates(node)
+	}
+	return d.PossibleResultStates
 }
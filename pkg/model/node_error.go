@@ -0,0 +1,88 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrorClass tells the flow how to handle an error of a node
+type ErrorClass string
+
+const (
+	ErrorClassUser      ErrorClass = "user"      // caused by the user, e.g. an invalid input. The message can be shown to the user.
+	ErrorClassTransient ErrorClass = "transient" // e.g. a timeout of an external service, the step may succeed when it is retried
+	ErrorClassInternal  ErrorClass = "internal"  // a bug or misconfiguration, the details are only logged
+)
+
+const (
+	ErrorCodeInternal          = "internal_error"
+	ErrorCodeTimeout           = "timeout"
+	ErrorCodePanic             = "panic"
+	ErrorCodeInvalidResult     = "invalid_result"
+	ErrorCodeMissingTransition = "missing_transition"
+	ErrorCodeInvalidConfig     = "invalid_config"
+)
+
+// NodeError is an error of a node with a code that flows can branch on. Nodes return it from their run
+// function, other errors are handled as internal errors.
+type NodeError struct {
+	Code    string     // e.g. "timeout", stable so that flows and clients can rely on it
+	Class   ErrorClass // how the error is handled
+	Message string     // message for the user, only shown for user errors
+	Err     error      // the cause, which is logged
+}
+
+func (e *NodeError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Code, e.Err)
+	}
+	if e.Message != "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+	return e.Code
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// NewUserError creates an error with a message that is shown to the user
+func NewUserError(code, message string) *NodeError {
+	return &NodeError{Code: code, Class: ErrorClassUser, Message: message}
+}
+
+// NewTransientError creates an error for a step that may succeed when it is retried
+func NewTransientError(code string, err error) *NodeError {
+	return &NodeError{Code: code, Class: ErrorClassTransient, Err: err}
+}
+
+// NewInternalError creates an error for a bug or misconfiguration
+func NewInternalError(code string, err error) *NodeError {
+	return &NodeError{Code: code, Class: ErrorClassInternal, Err: err}
+}
+
+// ClassifyError returns the error as NodeError, errors of nodes that are not NodeErrors are internal errors
+// unless a deadline was exceeded
+func ClassifyError(err error) *NodeError {
+	var nodeError *NodeError
+	if errors.As(err, &nodeError) {
+		return nodeError
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return NewTransientError(ErrorCodeTimeout, err)
+	}
+
+	return NewInternalError(ErrorCodeInternal, err)
+}
+
+// FlowError is the last error of a node of the session, it is kept until another node fails
+type FlowError struct {
+	Node    string     `json:"node"`
+	Code    string     `json:"code"`
+	Class   ErrorClass `json:"class"`
+	Message string     `json:"message,omitempty"` // message for the user, empty for transient and internal errors
+	Time    time.Time  `json:"time"`
+}
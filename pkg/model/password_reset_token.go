@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// Channels through which a password reset token is delivered
+const (
+	PasswordResetChannelEmail = "email"
+	PasswordResetChannelSMS   = "sms"
+)
+
+// PasswordResetToken is a single-use token to reset the password of a user, only the hash of the token is stored.
+// Every reset request is recorded, also if no user was found for the identifier, so that requests can be
+// rate-limited without revealing whether an account exists.
+type PasswordResetToken struct {
+	ID             string     `json:"id" db:"id"`
+	Tenant         string     `json:"tenant" db:"tenant"`
+	Realm          string     `json:"realm" db:"realm"`
+	TokenHash      string     `json:"-" db:"token_hash"`
+	UserID         string     `json:"user_id" db:"user_id"`                 // Empty if no user was found for the identifier
+	IdentifierHash string     `json:"identifier_hash" db:"identifier_hash"` // Hash of the email address or phone number the reset was requested for
+	RequestIP      string     `json:"request_ip" db:"request_ip"`
+	Channel        string     `json:"channel" db:"channel"` // e.g. "email"
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt         *time.Time `json:"used_at,omitempty" db:"used_at"`
+}
+
+// PasswordResetRequest describes a request to reset a password
+type PasswordResetRequest struct {
+	UserID     string // Empty if no user was found, the request is then only recorded for rate limiting
+	Identifier string // Email address or phone number the reset was requested for
+	RequestIP  string
+	Channel    string
+	Lifetime   time.Duration
+}
@@ -11,14 +11,16 @@ type PersistentAuthSession struct {
 	Realm              string    `json:"realm"`
 	RunID              string    `json:"run_id"`
 	SessionIDHash      string    `json:"session_id_hash"`
+	FlowID             string    `json:"flow_id"`
 	CreatedAt          time.Time `json:"created_at"`
 	ExpiresAt          time.Time `json:"expires_at"`
 	SessionInformation []byte    `json:"session_information"`
 }
 
-// NewPersistentAuthSession creates a new PersistentAuthSession from an AuthenticationSession
+// NewPersistentAuthSession creates a new PersistentAuthSession from an AuthenticationSession.
+// Ephemeral context values like passwords are not persisted.
 func NewPersistentAuthSession(tenant, realm string, session *AuthenticationSession) (*PersistentAuthSession, error) {
-	sessionInfo, err := json.Marshal(session)
+	sessionInfo, err := json.Marshal(session.WithoutEphemeralContext())
 	if err != nil {
 		return nil, err
 	}
@@ -28,6 +30,7 @@ func NewPersistentAuthSession(tenant, realm string, session *AuthenticationSessi
 		Realm:              realm,
 		RunID:              session.RunID,
 		SessionIDHash:      session.SessionIdHash,
+		FlowID:             session.FlowId,
 		CreatedAt:          session.CreatedAt,
 		ExpiresAt:          session.ExpiresAt,
 		SessionInformation: sessionInfo,
@@ -58,3 +58,59 @@ func TestPersistentAuthSession_MarshalUnmarshal(t *testing.T) {
 	assert.Equal(t, session.LoginUriNext, recoveredSession.LoginUriNext)
 	assert.Equal(t, session.LoginUriBase, recoveredSession.LoginUriBase)
 }
+
+func TestPersistentAuthSession_SensitiveContext(t *testing.T) {
+	session := &AuthenticationSession{
+		RunID: "test-run-id",
+		Context: map[string]string{
+			"username":  "alice",
+			"password":  "secret-password",
+			"email_otp": "123456",
+		},
+		Prompts: map[string]string{"totpSecret": "JBSWY3DPEHPK3PXP"},
+	}
+
+	// Ephemeral values are never persisted
+	persistentSession, err := NewPersistentAuthSession("test-tenant", "test-realm", session)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(persistentSession.SessionInformation), "secret-password")
+	assert.Equal(t, "secret-password", session.Context["password"])
+
+	recoveredSession, err := persistentSession.ToAuthenticationSession()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "alice", "email_otp": "123456"}, recoveredSession.Context)
+
+	// Debug output redacts all secrets
+	redacted := session.Redacted()
+	assert.Equal(t, "alice", redacted.Context["username"])
+	assert.Equal(t, RedactedValue, redacted.Context["password"])
+	assert.Equal(t, RedactedValue, redacted.Context["email_otp"])
+	assert.Equal(t, RedactedValue, redacted.Prompts["totpSecret"])
+	assert.Equal(t, "123456", session.Context["email_otp"])
+}
+
+func TestPersistentAuthSession_SubflowContext(t *testing.T) {
+	session := &AuthenticationSession{
+		RunID:   "test-run-id",
+		Context: map[string]string{"email": "alice@example.com"},
+		Subflows: []SubflowFrame{{
+			Node:    "mfa",
+			Context: map[string]string{"username": "alice", "password": "secret-password", "email_otp": "123456"},
+		}},
+	}
+
+	// The saved parent context is persisted without ephemeral values
+	persistentSession, err := NewPersistentAuthSession("test-tenant", "test-realm", session)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(persistentSession.SessionInformation), "secret-password")
+
+	recoveredSession, err := persistentSession.ToAuthenticationSession()
+	assert.NoError(t, err)
+	assert.Len(t, recoveredSession.Subflows, 1)
+	assert.Equal(t, "mfa", recoveredSession.CurrentSubflow().Node)
+	assert.Equal(t, map[string]string{"username": "alice", "email_otp": "123456"}, recoveredSession.CurrentSubflow().Context)
+
+	redacted := session.Redacted()
+	assert.Equal(t, RedactedValue, redacted.Subflows[0].Context["email_otp"])
+	assert.Equal(t, "123456", session.Subflows[0].Context["email_otp"])
+}
@@ -2,11 +2,41 @@ package model
 
 import (
 	"context"
+	"net/http"
+	"time"
 )
 
+// RepositoriesVersion is increased whenever services are added to the Repositories. Custom nodes that are built
+// against a newer version of GoAM can compare it with Repositories.Version before they use the newer services.
+const RepositoriesVersion = 4
+
+// Repositories are the services that nodes can use, they are scoped to the realm of the flow
 type Repositories struct {
-	UserRepo    UserRepository
-	EmailSender EmailSender
+	Version int // see RepositoriesVersion
+
+	UserRepo          UserRepository
+	EmailSender       EmailSender
+	SMSSender         SMSSender
+	PasswordResetRepo PasswordResetRepository
+	Secrets           SecretStore
+
+	// Since version 2
+	Cache      Cache
+	HTTPClient HTTPClient
+	JWT        JWTSigner
+	Audit      AuditLogger
+	Settings   SettingsReader
+
+	// Since version 3
+	Analytics FlowAnalytics // used by the flow engine, may be nil
+
+	// Since version 4
+	MagicLinks MagicLinkRepository
+}
+
+// Supports checks if the repositories provide the services of the given version
+func (r *Repositories) Supports(version int) bool {
+	return r.Version >= version
 }
 
 type UserRepository interface {
@@ -19,6 +49,9 @@ type UserRepository interface {
 
 	CreateUserAttribute(ctx context.Context, attribute *UserAttribute) error
 	UpdateUserAttribute(ctx context.Context, attribute *UserAttribute) error
+	// Updates the attribute only if it was not changed since it was read, i.e. it was last updated at lastUpdatedAt.
+	// Returns false if another session changed or deleted the attribute in the meantime.
+	UpdateUserAttributeIfUnchanged(ctx context.Context, attribute *UserAttribute, lastUpdatedAt time.Time) (bool, error)
 	DeleteUserAttribute(ctx context.Context, attributeID string) error
 
 	// Creates a new user model based on the context value
@@ -43,3 +76,94 @@ type EmailAddress struct {
 	Email string
 	Name  string
 }
+
+type SMSSender interface {
+	SendSMS(sms *SendSMSParams) error
+}
+
+type SendSMSParams struct {
+	Template string // e.g. sms-otp, allows providers to pick a localized template
+	To       string // Phone number in E.164 format
+	Message  string // Rendered message text
+
+	Params map[string]any
+}
+
+// PasswordResetRepository issues and verifies password reset tokens and revokes the sessions of a user after a reset
+type PasswordResetRepository interface {
+	// CreateResetToken records the request and returns the token that is delivered to the user
+	CreateResetToken(ctx context.Context, request *PasswordResetRequest) (string, error)
+
+	// CountResetRequests returns the number of requests for the identifier and from the ip since the given time
+	CountResetRequests(ctx context.Context, identifier, requestIP string, since time.Time) (byIdentifier int, byIP int, err error)
+
+	// ConsumeResetToken marks the token as used and returns it, returns nil if the token is unknown, expired or was already used
+	ConsumeResetToken(ctx context.Context, token string) (*PasswordResetToken, error)
+
+	// RevokeClientSessions deletes all access and refresh tokens of the user and returns the number of revoked sessions
+	RevokeClientSessions(ctx context.Context, userID string) (int, error)
+}
+
+// MagicLinkRepository stores the approvals of magic links that were opened on another device. The approvals are
+// stored apart from the authentication session so that the waiting device cannot overwrite them when it saves its session.
+type MagicLinkRepository interface {
+	// ApproveMagicLink records the approval of the link until it expires, returns false if the link was already approved
+	ApproveMagicLink(ctx context.Context, sessionIdHash, linkID string, expiresAt time.Time) (bool, error)
+
+	// ConsumeMagicLinkApproval deletes the approval and returns true if the link was approved and the approval did not expire
+	ConsumeMagicLinkApproval(ctx context.Context, sessionIdHash, linkID string) (bool, error)
+}
+
+// SecretStore provides the secrets nodes need to call external services, e.g. api keys from the extension settings
+type SecretStore interface {
+	// GetSecret returns the secret with the name and false if there is none
+	GetSecret(name string) (string, bool)
+}
+
+// Cache stores values of nodes in memory of the instance, keys are scoped to the realm
+type Cache interface {
+	// Get returns the value of the key and false if there is none or it expired
+	Get(key string) (any, bool)
+
+	// Set stores the value for the given time
+	Set(key string, value any, ttl time.Duration) error
+
+	// Delete removes the value of the key
+	Delete(key string) error
+}
+
+// HTTPClient sends requests to external services, it is shared by all nodes and has a default timeout
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// JWTSigner signs tokens with the signing keys of the realm
+type JWTSigner interface {
+	// SignJWT returns the signed token with the claims
+	SignJWT(claims map[string]any) (string, error)
+
+	// PublicKeys returns the public keys of the realm as JWKS to verify the tokens
+	PublicKeys() (string, error)
+}
+
+// AuditLogger records security relevant events of a flow, e.g. a changed password
+type AuditLogger interface {
+	LogEvent(ctx context.Context, event *AuditEvent)
+}
+
+type AuditEvent struct {
+	Type    string            // e.g. "password_changed"
+	UserID  string            // Empty if the user is not known
+	Details map[string]string // Additional information, must not contain secrets
+}
+
+// FlowAnalytics aggregates how the runs of flows progress, the flow engine reports the events of each run
+type FlowAnalytics interface {
+	RecordFlowEvent(state *AuthenticationSession, event *FlowEvent)
+}
+
+// SettingsReader provides the settings of the realm and the node settings of the server
+type SettingsReader interface {
+	// GetSetting returns the realm setting with the name, or the node setting of the server if the realm does not set it
+	GetSetting(name string) (string, bool)
+}
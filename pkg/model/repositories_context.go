@@ -0,0 +1,297 @@
+package model
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WithContext returns a copy of the repositories whose services stop working once the context is done. The flow
+// engine uses it for nodes with a timeout, so that a node that is still running after its timeout cannot change
+// users or send messages anymore. Calls of the services are canceled with the context, even if the node passes
+// another context to them.
+func (r *Repositories) WithContext(ctx context.Context) *Repositories {
+	if r == nil {
+		return nil
+	}
+
+	bound := *r
+	if r.UserRepo != nil {
+		bound.UserRepo = &contextUserRepository{ctx: ctx, next: r.UserRepo}
+	}
+	if r.EmailSender != nil {
+		bound.EmailSender = &contextEmailSender{ctx: ctx, next: r.EmailSender}
+	}
+	if r.SMSSender != nil {
+		bound.SMSSender = &contextSMSSender{ctx: ctx, next: r.SMSSender}
+	}
+	if r.PasswordResetRepo != nil {
+		bound.PasswordResetRepo = &contextPasswordResetRepository{ctx: ctx, next: r.PasswordResetRepo}
+	}
+	if r.Cache != nil {
+		bound.Cache = &contextCache{ctx: ctx, next: r.Cache}
+	}
+	if r.HTTPClient != nil {
+		bound.HTTPClient = &contextHTTPClient{ctx: ctx, next: r.HTTPClient}
+	}
+	if r.Audit != nil {
+		bound.Audit = &contextAuditLogger{ctx: ctx, next: r.Audit}
+	}
+	if r.MagicLinks != nil {
+		bound.MagicLinks = &contextMagicLinkRepository{ctx: ctx, next: r.MagicLinks}
+	}
+
+	return &bound
+}
+
+// mergeContext returns a context that is canceled when the call context or the bound context is done
+func mergeContext(call, bound context.Context) (context.Context, context.CancelFunc) {
+	if call == nil {
+		call = context.Background()
+	}
+
+	ctx, cancel := context.WithCancelCause(call)
+	stop := context.AfterFunc(bound, func() { cancel(context.Cause(bound)) })
+
+	return ctx, func() {
+		stop()
+		cancel(context.Canceled)
+	}
+}
+
+type contextUserRepository struct {
+	ctx  context.Context
+	next UserRepository
+}
+
+func (r *contextUserRepository) GetByID(ctx context.Context, id string) (*User, error) {
+	ctx, cancel := mergeContext(ctx, r.ctx)
+	defer cancel()
+	return r.next.GetByID(ctx, id)
+}
+
+func (r *contextUserRepository) GetByAttributeIndex(ctx context.Context, attributeType, index string) (*User, error) {
+	ctx, cancel := mergeContext(ctx, r.ctx)
+	defer cancel()
+	return r.next.GetByAttributeIndex(ctx, attributeType, index)
+}
+
+func (r *contextUserRepository) Create(ctx context.Context, user *User) error {
+	ctx, cancel := mergeContext(ctx, r.ctx)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.next.Create(ctx, user)
+}
+
+func (r *contextUserRepository) Update(ctx context.Context, user *User) error {
+	ctx, cancel := mergeContext(ctx, r.ctx)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.next.Update(ctx, user)
+}
+
+func (r *contextUserRepository) CreateOrUpdate(ctx context.Context, user *User) error {
+	ctx, cancel := mergeContext(ctx, r.ctx)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.next.CreateOrUpdate(ctx, user)
+}
+
+func (r *contextUserRepository) CreateUserAttribute(ctx context.Context, attribute *UserAttribute) error {
+	ctx, cancel := mergeContext(ctx, r.ctx)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.next.CreateUserAttribute(ctx, attribute)
+}
+
+func (r *contextUserRepository) UpdateUserAttribute(ctx context.Context, attribute *UserAttribute) error {
+	ctx, cancel := mergeContext(ctx, r.ctx)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.next.UpdateUserAttribute(ctx, attribute)
+}
+
+func (r *contextUserRepository) UpdateUserAttributeIfUnchanged(ctx context.Context, attribute *UserAttribute, lastUpdatedAt time.Time) (bool, error) {
+	ctx, cancel := mergeContext(ctx, r.ctx)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return r.next.UpdateUserAttributeIfUnchanged(ctx, attribute, lastUpdatedAt)
+}
+
+func (r *contextUserRepository) DeleteUserAttribute(ctx context.Context, attributeID string) error {
+	ctx, cancel := mergeContext(ctx, r.ctx)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.next.DeleteUserAttribute(ctx, attributeID)
+}
+
+func (r *contextUserRepository) NewUserModel(state *AuthenticationSession) (*User, error) {
+	return r.next.NewUserModel(state)
+}
+
+type contextEmailSender struct {
+	ctx  context.Context
+	next EmailSender
+}
+
+func (s *contextEmailSender) SendEmail(email *SendEmailParams) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	return s.next.SendEmail(email)
+}
+
+type contextSMSSender struct {
+	ctx  context.Context
+	next SMSSender
+}
+
+func (s *contextSMSSender) SendSMS(sms *SendSMSParams) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	return s.next.SendSMS(sms)
+}
+
+type contextPasswordResetRepository struct {
+	ctx  context.Context
+	next PasswordResetRepository
+}
+
+func (r *contextPasswordResetRepository) CreateResetToken(ctx context.Context, request *PasswordResetRequest) (string, error) {
+	ctx, cancel := mergeContext(ctx, r.ctx)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return r.next.CreateResetToken(ctx, request)
+}
+
+func (r *contextPasswordResetRepository) CountResetRequests(ctx context.Context, identifier, requestIP string, since time.Time) (int, int, error) {
+	ctx, cancel := mergeContext(ctx, r.ctx)
+	defer cancel()
+	return r.next.CountResetRequests(ctx, identifier, requestIP, since)
+}
+
+func (r *contextPasswordResetRepository) ConsumeResetToken(ctx context.Context, token string) (*PasswordResetToken, error) {
+	ctx, cancel := mergeContext(ctx, r.ctx)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.next.ConsumeResetToken(ctx, token)
+}
+
+func (r *contextPasswordResetRepository) RevokeClientSessions(ctx context.Context, userID string) (int, error) {
+	ctx, cancel := mergeContext(ctx, r.ctx)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.next.RevokeClientSessions(ctx, userID)
+}
+
+type contextMagicLinkRepository struct {
+	ctx  context.Context
+	next MagicLinkRepository
+}
+
+func (r *contextMagicLinkRepository) ApproveMagicLink(ctx context.Context, sessionIdHash, linkID string, expiresAt time.Time) (bool, error) {
+	ctx, cancel := mergeContext(ctx, r.ctx)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return r.next.ApproveMagicLink(ctx, sessionIdHash, linkID, expiresAt)
+}
+
+func (r *contextMagicLinkRepository) ConsumeMagicLinkApproval(ctx context.Context, sessionIdHash, linkID string) (bool, error) {
+	ctx, cancel := mergeContext(ctx, r.ctx)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return r.next.ConsumeMagicLinkApproval(ctx, sessionIdHash, linkID)
+}
+
+type contextCache struct {
+	ctx  context.Context
+	next Cache
+}
+
+func (c *contextCache) Get(key string) (any, bool) {
+	return c.next.Get(key)
+}
+
+func (c *contextCache) Set(key string, value any, ttl time.Duration) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	return c.next.Set(key, value, ttl)
+}
+
+func (c *contextCache) Delete(key string) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	return c.next.Delete(key)
+}
+
+type contextHTTPClient struct {
+	ctx  context.Context
+	next HTTPClient
+}
+
+func (c *contextHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := mergeContext(req.Context(), c.ctx)
+	resp, err := c.next.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// The context must stay alive until the body was read
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+type contextAuditLogger struct {
+	ctx  context.Context
+	next AuditLogger
+}
+
+func (l *contextAuditLogger) LogEvent(ctx context.Context, event *AuditEvent) {
+	if l.ctx.Err() != nil {
+		return
+	}
+	l.next.LogEvent(ctx, event)
+}
@@ -0,0 +1,135 @@
+package model
+
+import (
+	"sync"
+)
+
+// RedactedValue replaces sensitive values in debug output
+const RedactedValue = "[redacted]"
+
+// Context keys that hold secrets. Ephemeral keys such as passwords are only needed within the request in which
+// they were entered and are never persisted. Sensitive keys such as OTP challenges need to survive between steps
+// of a flow, they are encrypted when the session is persisted. Both are redacted from debug output.
+var (
+	contextKeysMu        sync.RWMutex
+	ephemeralContextKeys = map[string]bool{
+		"password": true,
+	}
+	sensitiveContextKeys = map[string]bool{
+		"email_otp":         true,
+		"sms_otp":           true,
+		"totpSecret":        true,
+		"totpImageUrl":      true,
+		"magic_link":        true,
+		"magic_link_secret": true,
+		"recovery_codes":    true,
+	}
+)
+
+// RegisterEphemeralContextKeys marks context keys that must never be persisted, e.g. for custom nodes
+func RegisterEphemeralContextKeys(keys ...string) {
+	contextKeysMu.Lock()
+	defer contextKeysMu.Unlock()
+
+	for _, key := range keys {
+		ephemeralContextKeys[key] = true
+	}
+}
+
+// RegisterSensitiveContextKeys marks context keys that are encrypted when persisted, e.g. for custom nodes
+func RegisterSensitiveContextKeys(keys ...string) {
+	contextKeysMu.Lock()
+	defer contextKeysMu.Unlock()
+
+	for _, key := range keys {
+		sensitiveContextKeys[key] = true
+	}
+}
+
+// IsEphemeralContextKey returns true if the context key must not be persisted
+func IsEphemeralContextKey(key string) bool {
+	contextKeysMu.RLock()
+	defer contextKeysMu.RUnlock()
+
+	return ephemeralContextKeys[key]
+}
+
+// IsSensitiveContextKey returns true if the context key holds a secret, this includes ephemeral keys
+func IsSensitiveContextKey(key string) bool {
+	contextKeysMu.RLock()
+	defer contextKeysMu.RUnlock()
+
+	return ephemeralContextKeys[key] || sensitiveContextKeys[key]
+}
+
+// WithoutEphemeralContext returns a shallow copy of the session without ephemeral context values
+func (s *AuthenticationSession) WithoutEphemeralContext() *AuthenticationSession {
+	session := *s
+	session.Context = withoutEphemeralValues(s.Context)
+	session.Subflows = mapSubflowContexts(s.Subflows, withoutEphemeralValues)
+	return &session
+}
+
+// Redacted returns a shallow copy of the session where all secrets in the context and prompts are
+// replaced, it is used to render the session in debug output
+func (s *AuthenticationSession) Redacted() *AuthenticationSession {
+	if s == nil {
+		return nil
+	}
+
+	session := *s
+	session.Context = RedactSensitiveValues(s.Context)
+	session.Prompts = RedactSensitiveValues(s.Prompts)
+	session.Subflows = mapSubflowContexts(s.Subflows, RedactSensitiveValues)
+	return &session
+}
+
+// RedactSensitiveValues returns a copy of the map where the values of sensitive keys are replaced
+func RedactSensitiveValues(values map[string]string) map[string]string {
+	return filterMap(values, func(key, value string) (string, bool) {
+		if IsSensitiveContextKey(key) {
+			return RedactedValue, true
+		}
+		return value, true
+	})
+}
+
+func withoutSensitiveValues(values map[string]string) map[string]string {
+	return filterMap(values, func(key, value string) (string, bool) {
+		return value, !IsSensitiveContextKey(key)
+	})
+}
+
+func withoutEphemeralValues(values map[string]string) map[string]string {
+	return filterMap(values, func(key, value string) (string, bool) {
+		return value, !IsEphemeralContextKey(key)
+	})
+}
+
+// mapSubflowContexts returns a copy of the subflow frames where the saved parent contexts are replaced by fn
+func mapSubflowContexts(frames []SubflowFrame, fn func(map[string]string) map[string]string) []SubflowFrame {
+	if frames == nil {
+		return nil
+	}
+
+	result := make([]SubflowFrame, len(frames))
+	for i, frame := range frames {
+		frame.Context = fn(frame.Context)
+		result[i] = frame
+	}
+	return result
+}
+
+func filterMap(values map[string]string, fn func(key, value string) (string, bool)) map[string]string {
+	if values == nil {
+		return nil
+	}
+
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		if newValue, keep := fn(key, value); keep {
+			result[key] = newValue
+		}
+	}
+	return result
+}
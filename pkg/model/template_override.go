@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// TemplateOverride replaces the template of a node in the flows of a realm. FlowId is "*" for all flows of the realm.
+type TemplateOverride struct {
+	Tenant    string    `json:"tenant" db:"tenant"`
+	Realm     string    `json:"realm" db:"realm"`
+	FlowId    string    `json:"flow_id" db:"flow_id"`
+	NodeName  string    `json:"node_name" db:"node_name"`
+	Template  string    `json:"template" db:"template"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
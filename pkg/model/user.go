@@ -103,6 +103,13 @@ func GetAttributes[T any](u *User, attrType string) ([]T, []*UserAttribute, erro
 			continue
 		}
 
+		// Check if attr.Value is a pointer to T
+		if converted, ok := attr.Value.(*T); ok {
+			result = append(result, *converted)
+			attributes = append(attributes, attr)
+			continue
+		}
+
 		// If direct conversion fails, try to convert from map[string]interface{} (for database stored values)
 		if mapValue, ok := attr.Value.(map[string]interface{}); ok {
 			// Convert map to JSON and then to the target type
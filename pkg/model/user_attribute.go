@@ -2,6 +2,7 @@ package model
 
 import (
 	"encoding/json"
+	"reflect"
 	"time"
 )
 
@@ -125,6 +126,60 @@ func (ua *UserAttribute) Equals(other *UserAttribute) bool {
 	if err != nil {
 		return false
 	}
+	if string(json1) == string(json2) {
+		return true
+	}
+
+	// Values loaded from the database might be maps with a different key order than the struct fields
+	var value1, value2 any
+	if err := json.Unmarshal(json1, &value1); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(json2, &value2); err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(value1, value2)
+}
+
+// Clone returns a deep copy of the attribute. The value is copied with a JSON round trip into a value of the
+// same type, so that changes to values such as slices or pointers of the copy do not change the original.
+func (ua *UserAttribute) Clone() *UserAttribute {
+	if ua == nil {
+		return nil
+	}
+
+	cloned := *ua
+	if ua.Index != nil {
+		index := *ua.Index
+		cloned.Index = &index
+	}
+
+	if ua.Value != nil {
+		cloned.Value = cloneAttributeValue(ua.Value)
+	}
+
+	return &cloned
+}
+
+func cloneAttributeValue(value any) any {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+
+	valueType := reflect.TypeOf(value)
+	if valueType.Kind() == reflect.Pointer {
+		cloned := reflect.New(valueType.Elem())
+		if err := json.Unmarshal(data, cloned.Interface()); err != nil {
+			return value
+		}
+		return cloned.Interface()
+	}
 
-	return string(json1) == string(json2)
+	cloned := reflect.New(valueType)
+	if err := json.Unmarshal(data, cloned.Interface()); err != nil {
+		return value
+	}
+	return cloned.Elem().Interface()
 }
@@ -72,3 +72,66 @@ func TestUserAttributeWithEmailValue(t *testing.T) {
 func stringPtr(s string) *string {
 	return &s
 }
+
+func TestUserAttributeEqualsIgnoresKeyOrder(t *testing.T) {
+	attr := &UserAttribute{
+		ID:   "1",
+		Type: AttributeTypePhone,
+		Value: PhoneAttributeValue{
+			Phone:             "+41791234567",
+			OtpFailedAttempts: 1,
+		},
+	}
+
+	// Values of unknown attribute types are loaded as maps with sorted keys
+	var mapValue map[string]interface{}
+	data, _ := json.Marshal(attr.Value)
+	if err := json.Unmarshal(data, &mapValue); err != nil {
+		t.Fatalf("Failed to unmarshal value: %v", err)
+	}
+	loaded := &UserAttribute{ID: "1", Type: AttributeTypePhone, Value: mapValue}
+
+	if !attr.Equals(loaded) {
+		t.Error("Expected attributes with the same value to be equal")
+	}
+
+	mapValue["otp_failed_attempts"] = 2
+	if attr.Equals(loaded) {
+		t.Error("Expected attributes with different values not to be equal")
+	}
+}
+
+func TestUserAttributeClone(t *testing.T) {
+	attr := &UserAttribute{
+		ID:    "1",
+		Type:  AttributeTypeRecoveryCodes,
+		Index: stringPtr("index"),
+		Value: &RecoveryCodesAttributeValue{
+			Codes: []RecoveryCode{{Hash: "a"}, {Hash: "b"}},
+		},
+	}
+
+	cloned := attr.Clone()
+	if !attr.Equals(cloned) {
+		t.Fatal("Expected the clone to be equal")
+	}
+
+	value, ok := cloned.Value.(*RecoveryCodesAttributeValue)
+	if !ok {
+		t.Fatalf("Expected the clone to keep the type of the value, got %T", cloned.Value)
+	}
+	value.Codes[0].Hash = "changed"
+	*cloned.Index = "changed"
+
+	original := attr.Value.(*RecoveryCodesAttributeValue)
+	if original.Codes[0].Hash != "a" || *attr.Index != "index" {
+		t.Error("Expected changes to the clone not to change the original")
+	}
+
+	mapValue := map[string]interface{}{"phone": "+41791234567"}
+	loaded := (&UserAttribute{Type: AttributeTypePhone, Value: mapValue}).Clone()
+	loaded.Value.(map[string]interface{})["phone"] = "changed"
+	if mapValue["phone"] != "+41791234567" {
+		t.Error("Expected changes to a cloned map not to change the original")
+	}
+}
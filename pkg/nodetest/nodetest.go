@@ -0,0 +1,134 @@
+// Package nodetest helps authors of custom nodes to test their nodes the way the graph engine runs them.
+//
+//	func TestMyNode(t *testing.T) {
+//		nodetest.CheckDefinition(t, MyNode, templatesFS)
+//
+//		repos, recorder := nodetest.NewRepositories(t)
+//		state := nodetest.NewSession()
+//		node := &model.GraphNode{Name: "myNode", Use: MyNode.Name, CustomConfig: map[string]string{"option": "value"}}
+//
+//		result, err := nodetest.RunNode(t, MyNode, node, state, nil, repos)
+//		...
+//	}
+package nodetest
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/Identityplane/GoAM/internal/auth/graph"
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// CheckDefinition fails the test if the node cannot be registered, e.g. because it has no run function,
+// its name is taken by a built-in node, its config schema is invalid or its template is missing or invalid
+func CheckDefinition(t testing.TB, def *model.NodeDefinition, templates fs.FS) {
+	t.Helper()
+
+	if err := graph.ValidateNodeDefinition(def); err != nil {
+		t.Errorf("invalid node definition: %v", err)
+		return
+	}
+
+	if graph.IsBuiltinNode(def.Name) {
+		t.Errorf("node name '%s' is used by a built-in node", def.Name)
+	}
+
+	if _, err := graph.LoadNodeTemplate(def, templates); err != nil {
+		t.Errorf("invalid node template: %v", err)
+	}
+
+	for _, name := range def.ConfigOptionNames() {
+		if _, ok := def.ConfigSchema[name]; !ok && def.CustomConfigOptions[name] == "" {
+			t.Errorf("config option '%s' of node '%s' has no description", name, def.Name)
+		}
+	}
+}
+
+// NewSession returns an empty authentication session as it is created when a flow starts
+func NewSession() *model.AuthenticationSession {
+	return &model.AuthenticationSession{
+		RunID:   "test-run",
+		FlowId:  "test-flow",
+		Context: map[string]string{},
+		History: []string{},
+	}
+}
+
+// RunNode runs the node with the config, the input and the repositories like the graph engine does.
+// The defaults of the config schema are applied before the node runs and the sensitive context of the node
+// is removed once it returns a condition. The test fails if the node breaks the rules of the engine, e.g.
+// returns a condition that is not one of its result states. The error of the node is returned to the test.
+func RunNode(t testing.TB, def *model.NodeDefinition, node *model.GraphNode, state *model.AuthenticationSession, input map[string]string, repos *model.Repositories) (*model.NodeResult, error) {
+	t.Helper()
+
+	if state.Context == nil {
+		state.Context = map[string]string{}
+	}
+
+	// The engine runs the node with the resolved config, the flow definition is not changed
+	configured := *node
+	configured.CustomConfig = maps.Clone(node.CustomConfig)
+	if configured.CustomConfig == nil {
+		configured.CustomConfig = map[string]string{}
+	}
+	for name, option := range def.ConfigSchema {
+		if configured.CustomConfig[name] == "" && option.Default != "" {
+			configured.CustomConfig[name] = option.Default
+		}
+	}
+
+	if err := graph.CheckRequiredConfig(&configured, def); err != nil {
+		return nil, err
+	}
+
+	var result *model.NodeResult
+	var err error
+
+	switch def.Type {
+	case model.NodeTypeInit:
+		result, err = graph.ProcessInitTypeNode(state, &configured, def, input, repos)
+	case model.NodeTypeLogic:
+		result, err = graph.ProcessLogicTypeNode(state, &configured, def, input, repos)
+	case model.NodeTypeQuery:
+		result, err = graph.ProcessQueryTypeNode(state, &configured, def, input, repos)
+	case model.NodeTypeQueryWithLogic:
+		result, err = graph.ProcessQueryWithLogicTypeNode(state, &configured, def, input, repos)
+	case model.NodeTypeResult:
+		result, err = graph.ProcessResultTypeNode(state, &configured, def, input, repos)
+	default:
+		return nil, fmt.Errorf("unsupported node type: %s", def.Type)
+	}
+
+	if err != nil || def.Type == model.NodeTypeResult {
+		return result, err
+	}
+
+	if result == nil {
+		t.Errorf("node '%s' returned neither prompts nor condition", def.Name)
+		return result, nil
+	}
+
+	if result.Prompts != nil && result.Condition != "" {
+		t.Errorf("node '%s' returned prompts and the condition '%s', it must return one of them", def.Name, result.Condition)
+	}
+
+	if result.Prompts == nil && result.Condition == "" {
+		t.Errorf("node '%s' returned neither prompts nor condition", def.Name)
+	}
+
+	if result.Condition != "" {
+		if resultStates := def.ResultStatesFor(&configured); !slices.Contains(resultStates, result.Condition) {
+			t.Errorf("node '%s' returned the condition '%s' which is not one of its result states %v", def.Name, result.Condition, resultStates)
+		}
+
+		for _, key := range def.SensitiveContext {
+			delete(state.Context, key)
+		}
+	}
+
+	return result, nil
+}
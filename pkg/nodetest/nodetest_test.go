@@ -0,0 +1,145 @@
+package nodetest
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rateLimitNode is a custom node that counts the attempts of a user in the cache
+var rateLimitNode = &model.NodeDefinition{
+	Name:                 "rateLimit",
+	Type:                 model.NodeTypeLogic,
+	RequiredContext:      []string{"username"},
+	PossibleResultStates: []string{"allowed", "limited"},
+	ConfigSchema: map[string]model.ConfigOption{
+		"max_attempts": {Description: "Attempts per minute", Type: model.ConfigOptionInt, Default: "3"},
+	},
+	Run: func(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+		maxAttempts, _ := strconv.Atoi(node.CustomConfig["max_attempts"])
+
+		key := "attempts/" + state.Context["username"]
+		attempts, _ := services.Cache.Get(key)
+		count, _ := attempts.(int)
+		count++
+		if err := services.Cache.Set(key, count, time.Minute); err != nil {
+			return nil, err
+		}
+
+		if count > maxAttempts {
+			services.Audit.LogEvent(context.Background(), &model.AuditEvent{Type: "rate_limited", Details: map[string]string{"username": state.Context["username"]}})
+			return &model.NodeResult{Condition: "limited"}, nil
+		}
+		return &model.NodeResult{Condition: "allowed"}, nil
+	},
+}
+
+func TestRunNode_CustomNode(t *testing.T) {
+	CheckDefinition(t, rateLimitNode, nil)
+
+	repos, recorder := NewRepositories(t)
+	assert.True(t, repos.Supports(model.RepositoriesVersion))
+
+	node := &model.GraphNode{Name: "limit", Use: rateLimitNode.Name}
+	state := NewSession()
+	state.Context["username"] = "alice"
+
+	// The default of the schema applies
+	for i := 0; i < 3; i++ {
+		result, err := RunNode(t, rateLimitNode, node, state, nil, repos)
+		require.NoError(t, err)
+		assert.Equal(t, "allowed", result.Condition)
+	}
+
+	result, err := RunNode(t, rateLimitNode, node, state, nil, repos)
+	require.NoError(t, err)
+	assert.Equal(t, "limited", result.Condition)
+	require.Len(t, recorder.AuditEvents, 1)
+	assert.Equal(t, "rate_limited", recorder.AuditEvents[0].Type)
+
+	// The flow definition is not changed
+	assert.Nil(t, node.CustomConfig)
+}
+
+func TestRunNode_QueryNode(t *testing.T) {
+	def := &model.NodeDefinition{
+		Name:                 "askColor",
+		Type:                 model.NodeTypeQuery,
+		PossiblePrompts:      map[string]string{"color": "text"},
+		PossibleResultStates: []string{"submitted"},
+	}
+	CheckDefinition(t, def, fstest.MapFS{"askColor.html": {Data: []byte(`{{ define "content" }}<input name="color">{{ end }}`)}})
+
+	repos, _ := NewRepositories(t)
+	state := NewSession()
+	node := &model.GraphNode{Name: "color", Use: def.Name}
+
+	result, err := RunNode(t, def, node, state, nil, repos)
+	require.NoError(t, err)
+	assert.Equal(t, def.PossiblePrompts, result.Prompts)
+
+	result, err = RunNode(t, def, node, state, map[string]string{"color": "blue"}, repos)
+	require.NoError(t, err)
+	assert.Equal(t, "submitted", result.Condition)
+	assert.Equal(t, "blue", state.Context["color"])
+}
+
+func TestRunNode_RequiredConfig(t *testing.T) {
+	def := &model.NodeDefinition{
+		Name:                 "callService",
+		Type:                 model.NodeTypeLogic,
+		PossibleResultStates: []string{"done"},
+		ConfigSchema: map[string]model.ConfigOption{
+			"api_key": {Description: "Api key of the service", Required: true, Secret: true},
+		},
+		Run: func(state *model.AuthenticationSession, node *model.GraphNode, input map[string]string, services *model.Repositories) (*model.NodeResult, error) {
+			return &model.NodeResult{Condition: "done"}, nil
+		},
+	}
+
+	repos, _ := NewRepositories(t)
+	_, err := RunNode(t, def, &model.GraphNode{Name: "call", Use: def.Name}, NewSession(), nil, repos)
+	assert.ErrorContains(t, err, "missing the required config option 'api_key'")
+}
+
+func TestNewRepositories(t *testing.T) {
+	repos, recorder := NewRepositories(t)
+
+	recorder.Secrets["api_key"] = "secret"
+	secret, ok := repos.Secrets.GetSecret("api_key")
+	assert.True(t, ok)
+	assert.Equal(t, "secret", secret)
+
+	_, ok = repos.Settings.GetSetting("unknown")
+	assert.False(t, ok)
+
+	require.NoError(t, repos.EmailSender.SendEmail(&model.SendEmailParams{Template: "otp"}))
+	assert.Len(t, recorder.Emails, 1)
+
+	// Tokens can be verified with the public keys
+	token, err := repos.JWT.SignJWT(map[string]any{"sub": "alice"})
+	require.NoError(t, err)
+	jwks, err := repos.JWT.PublicKeys()
+	require.NoError(t, err)
+	assert.Contains(t, jwks, `"kid":"nodetest"`)
+
+	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		return &repos.JWT.(*testSigner).key.PublicKey, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", parsed.Claims.(jwt.MapClaims)["sub"])
+
+	// Users are stored in the database
+	user := &model.User{ID: "user-1", Status: "active"}
+	require.NoError(t, repos.UserRepo.Create(context.Background(), user))
+	loaded, err := repos.UserRepo.GetByID(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", loaded.ID)
+}
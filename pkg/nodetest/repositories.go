@@ -0,0 +1,197 @@
+package nodetest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/auth/repository"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/golang-jwt/jwt"
+)
+
+// Recorder holds what the nodes sent through the repositories. Secrets and settings can be changed by the test
+// before the node runs.
+type Recorder struct {
+	mu sync.Mutex
+
+	Emails      []*model.SendEmailParams
+	SMS         []*model.SendSMSParams
+	AuditEvents []*model.AuditEvent
+
+	Secrets  map[string]string
+	Settings map[string]string
+}
+
+// NewRepositories returns repositories for the realm acme/customers with the latest version. Users are stored
+// in an in-memory database, emails, sms and audit events are recorded, the cache is kept in memory and tokens are
+// signed with a key that is generated for the test. The http client can reach private networks so that nodes can
+// be tested against a local server. Magic link approvals are kept in memory, the password reset repository is not
+// available.
+func NewRepositories(t testing.TB) (*model.Repositories, *Recorder) {
+	t.Helper()
+
+	repos, recorder, closeRepos, err := NewRecordingRepositories("acme", "customers")
+	if err != nil {
+		t.Fatalf("failed to create repositories: %v", err)
+	}
+	t.Cleanup(closeRepos)
+
+	return repos, recorder
+}
+
+// NewRecordingRepositories returns the same repositories as NewRepositories for a realm outside of a go test,
+// e.g. to run flows in a tool. The returned function closes the in-memory database of the users.
+func NewRecordingRepositories(tenant, realm string) (*model.Repositories, *Recorder, func(), error) {
+	userRepo, err := repository.NewTestUserRepository(tenant, realm)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create user repository: %w", err)
+	}
+	closeRepos := func() { userRepo.Close() }
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		closeRepos()
+		return nil, nil, nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	recorder := &Recorder{
+		Secrets:  map[string]string{},
+		Settings: map[string]string{},
+	}
+
+	repos := &model.Repositories{
+		Version:     model.RepositoriesVersion,
+		UserRepo:    userRepo,
+		EmailSender: &emailRecorder{recorder},
+		SMSSender:   &smsRecorder{recorder},
+		Secrets:     &recorderSecrets{recorder},
+		Cache:       &memoryCache{values: map[string]cacheEntry{}},
+		HTTPClient:  repository.NewHTTPClient(true),
+		JWT:         &testSigner{key: key},
+		Audit:       &auditRecorder{recorder},
+		Settings:    &recorderSettings{recorder},
+		MagicLinks:  new(repository.MockMagicLinkRepository),
+	}
+
+	return repos, recorder, closeRepos, nil
+}
+
+type emailRecorder struct{ r *Recorder }
+
+func (e *emailRecorder) SendEmail(email *model.SendEmailParams) error {
+	e.r.mu.Lock()
+	defer e.r.mu.Unlock()
+	e.r.Emails = append(e.r.Emails, email)
+	return nil
+}
+
+type smsRecorder struct{ r *Recorder }
+
+func (s *smsRecorder) SendSMS(sms *model.SendSMSParams) error {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.r.SMS = append(s.r.SMS, sms)
+	return nil
+}
+
+type auditRecorder struct{ r *Recorder }
+
+func (a *auditRecorder) LogEvent(ctx context.Context, event *model.AuditEvent) {
+	a.r.mu.Lock()
+	defer a.r.mu.Unlock()
+	a.r.AuditEvents = append(a.r.AuditEvents, event)
+}
+
+type recorderSecrets struct{ r *Recorder }
+
+func (s *recorderSecrets) GetSecret(name string) (string, bool) {
+	secret, ok := s.r.Secrets[name]
+	return secret, ok
+}
+
+type recorderSettings struct{ r *Recorder }
+
+func (s *recorderSettings) GetSetting(name string) (string, bool) {
+	value, ok := s.r.Settings[name]
+	return value, ok && value != ""
+}
+
+type cacheEntry struct {
+	value   any
+	expires time.Time
+}
+
+type memoryCache struct {
+	mu     sync.Mutex
+	values map[string]cacheEntry
+}
+
+func (c *memoryCache) Get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.values[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *memoryCache) Set(key string, value any, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[key] = cacheEntry{value: value, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (c *memoryCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.values, key)
+	return nil
+}
+
+type testSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+const testSigningKeyID = "nodetest"
+
+func (s *testSigner) SignJWT(claims map[string]any) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims(claims))
+	token.Header["kid"] = testSigningKeyID
+	return token.SignedString(s.key)
+}
+
+func (s *testSigner) PublicKeys() (string, error) {
+	encode := func(b []byte) string {
+		padded := make([]byte, 32)
+		copy(padded[32-len(b):], b)
+		return base64.RawURLEncoding.EncodeToString(padded)
+	}
+
+	jwks := map[string]any{
+		"keys": []map[string]string{{
+			"kty": "EC",
+			"crv": "P-256",
+			"kid": testSigningKeyID,
+			"use": "sig",
+			"alg": "ES256",
+			"x":   encode(s.key.X.Bytes()),
+			"y":   encode(s.key.Y.Bytes()),
+		}},
+	}
+
+	data, err := json.Marshal(jwks)
+	return string(data), err
+}
@@ -86,5 +86,6 @@ func TestServerSettings_Init(t *testing.T) {
 
 		// Assert
 		assert.Equal(t, "test-from-file", settings.ExtensionSettings["test_setting"])
+		assert.Equal(t, "secret-from-file", settings.ExtensionSettings["acme/customers/crm_api_key"])
 	})
 }
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"context"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// FlowAnalyticsService aggregates how the runs of flows progress and provides the funnels of the flows
+type FlowAnalyticsService interface {
+	// RecordFlowEvent counts the event of a run of a flow in the realm, the counters are buffered in memory
+	RecordFlowEvent(tenant, realm string, state *model.AuthenticationSession, event *model.FlowEvent)
+
+	// Flush writes the buffered counters to the database
+	Flush(ctx context.Context) error
+
+	// Start flushes the buffered counters periodically until the context is done
+	Start(ctx context.Context) error
+
+	// GetFlowFunnels returns the funnels of the flows of the realm that match the filter, ordered by flow id
+	GetFlowFunnels(ctx context.Context, tenant, realm string, filter model.FlowStatsFilter) ([]*model.FlowFunnel, error)
+}
@@ -2,9 +2,12 @@ package init
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/Identityplane/GoAM/internal/config"
 	"github.com/Identityplane/GoAM/internal/service"
 	"github.com/Identityplane/GoAM/internal/service/email"
+	"github.com/Identityplane/GoAM/internal/service/sms"
 	"github.com/Identityplane/GoAM/pkg/db"
 	services_interface "github.com/Identityplane/GoAM/pkg/services"
 )
@@ -20,29 +23,122 @@ func NewDefaultServicesFactory(dbConnections *db.DatabaseConnections) ServicesFa
 func (f *DefaultServicesFactory) CreateServices() (*services_interface.Services, error) {
 
 	// Initialize cache service first
-	cacheService, err := service.NewCacheService()
+	cacheService, err := newCacheService()
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize cache service: %w", err)
 	}
 
+	smsService, err := newSMSService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize sms service: %w", err)
+	}
+
+	maintenanceService, err := f.newMaintenanceService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize maintenance service: %w", err)
+	}
+
 	services := &services_interface.Services{
 		UserService:                service.NewUserService(f.dbConnections.UserDB, f.dbConnections.UserAttributeDB),
 		UserAttributeService:       service.NewUserAttributeService(f.dbConnections.UserAttributeDB, f.dbConnections.UserDB),
 		RealmService:               service.NewCachedRealmService(service.NewRealmService(f.dbConnections.RealmDB, f.dbConnections.UserDB, f.dbConnections.UserAttributeDB), cacheService),
-		FlowService:                service.NewCachedFlowService(service.NewFlowService(f.dbConnections.FlowDB), cacheService),
-		ApplicationService:         service.NewApplicationService(f.dbConnections.ApplicationsDB),
+		FlowService:                service.NewCachedFlowService(service.NewFlowService(f.dbConnections.FlowDB, f.dbConnections.FlowVersionDB, f.dbConnections.FlowVariantDB), cacheService),
+		ApplicationService:         service.NewCachedApplicationService(service.NewApplicationService(f.dbConnections.ApplicationsDB), cacheService),
 		SessionsService:            service.NewCachedSessionsService(service.NewSessionsService(f.dbConnections.ClientSessionDB, f.dbConnections.AuthSessionDB), cacheService),
 		StaticConfigurationService: service.NewStaticConfigurationService(),
 		OAuth2Service:              service.NewOAuth2Service(),
 		JWTService:                 service.NewCachedJWTService(service.NewJWTService(f.dbConnections.SigningKeyDB), cacheService),
 		CacheService:               cacheService,
-		TemplatesService:           service.NewTemplatesService(),
+		TemplatesService:           service.NewTemplatesService(f.dbConnections.TemplateOverrideDB),
 		AdminAuthzService:          service.NewAdminAuthzService(),
 		SimpleAuthService:          service.NewSimpleAuthService(),
 		EmailService:               email.NewDefaultEmailService(),
+		SMSService:                 smsService,
 		UserClaimsService:          service.NewUserClaimsService(),
+		ConfigChangeService:        service.NewConfigChangeService(f.dbConnections.ConfigChangeDB),
+		MaintenanceService:         maintenanceService,
+		PasswordResetService:       service.NewPasswordResetService(f.dbConnections.PasswordResetTokenDB),
+		FlowAnalyticsService:       service.NewFlowAnalyticsService(f.dbConnections.FlowStatsDB, 0),
+		SamlService:                service.NewSamlService(f.dbConnections.SigningKeyDB),
 	}
 
+	// Evict and reload cached configuration when it changes on any instance
+	service.RegisterConfigChangeHandlers(services)
+
 	return services, nil
 
 }
+
+// newMaintenanceService creates the maintenance service with the schedules from the server settings
+func (f *DefaultServicesFactory) newMaintenanceService() (services_interface.MaintenanceService, error) {
+
+	var schedules map[string]string
+	otpRetention := service.DefaultOtpStateRetention
+
+	if settings := config.ServerSettings; settings != nil {
+		schedules = settings.MaintenanceSchedules
+
+		if settings.MaintenanceOtpRetention != "" {
+			retention, err := time.ParseDuration(settings.MaintenanceOtpRetention)
+			if err != nil {
+				return nil, fmt.Errorf("invalid maintenance_otp_retention: %w", err)
+			}
+			otpRetention = retention
+		}
+	}
+
+	return service.NewMaintenanceService(
+		f.dbConnections.RealmDB,
+		f.dbConnections.AuthSessionDB,
+		f.dbConnections.ClientSessionDB,
+		f.dbConnections.UserDB,
+		f.dbConnections.UserAttributeDB,
+		f.dbConnections.SigningKeyDB,
+		f.dbConnections.PasswordResetTokenDB,
+		f.dbConnections.JobLockDB,
+		schedules,
+		otpRetention,
+	)
+}
+
+// newCacheService creates the cache service for the configured cache backend, defaults to the in-memory cache
+func newCacheService() (services_interface.CacheService, error) {
+
+	settings := config.ServerSettings
+	if settings == nil {
+		return service.NewCacheService()
+	}
+
+	switch settings.CacheBackend {
+	case "", "memory":
+		return service.NewCacheService()
+	case "redis", "redis_tiered":
+		if settings.RedisUrl == "" {
+			return nil, fmt.Errorf("redis_url is required for cache backend %s", settings.CacheBackend)
+		}
+		return service.NewRedisCacheService(settings.RedisUrl, settings.CacheBackend == "redis_tiered")
+	}
+
+	return nil, fmt.Errorf("unknown cache backend: %s", settings.CacheBackend)
+}
+
+// newSMSService creates the sms service for the configured sms provider, defaults to logging the messages
+func newSMSService() (services_interface.SMSService, error) {
+
+	settings := config.ServerSettings
+	if settings == nil {
+		return sms.NewDefaultSMSService(), nil
+	}
+
+	switch settings.SMSProvider {
+	case "", "log":
+		return sms.NewDefaultSMSService(), nil
+	case "http":
+		if settings.SMSHttpUrl == "" {
+			return nil, fmt.Errorf("sms_http_url is required for sms provider http")
+		}
+		return sms.NewHttpSMSService(settings.SMSHttpUrl, settings.SMSHttpAuthorization, settings.SMSSender), nil
+	}
+
+	return nil, fmt.Errorf("unknown sms provider: %s", settings.SMSProvider)
+}
@@ -0,0 +1,23 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// PasswordResetService issues and verifies single-use password reset tokens
+type PasswordResetService interface {
+	// CreateResetToken records the request and returns the token that is delivered to the user
+	CreateResetToken(ctx context.Context, tenant, realm string, request *model.PasswordResetRequest) (string, error)
+
+	// CountResetRequests returns the number of requests for the identifier and from the ip since the given time
+	CountResetRequests(ctx context.Context, tenant, realm, identifier, requestIP string, since time.Time) (byIdentifier int, byIP int, err error)
+
+	// ConsumeResetToken marks the token as used and returns it, returns nil if the token is unknown, expired or was already used
+	ConsumeResetToken(ctx context.Context, tenant, realm, token string) (*model.PasswordResetToken, error)
+
+	// IsResetTokenValid returns true if the token can still be used, the token is not marked as used
+	IsResetTokenValid(ctx context.Context, tenant, realm, token string) (bool, error)
+}
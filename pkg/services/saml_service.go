@@ -0,0 +1,28 @@
+package services
+
+import (
+	"context"
+
+	"github.com/Identityplane/GoAM/pkg/model"
+)
+
+// SamlService implements the SAML 2.0 identity provider of the realms. The service providers are the applications
+// of type saml, the assertions are signed with an RSA key from the signing keys of the realm.
+type SamlService interface {
+	// GetMetadata returns the metadata of the identity provider of the realm, it creates a signing key if the realm has none
+	GetMetadata(ctx context.Context, tenant, realm, baseUrl string) (string, error)
+
+	// GetServiceProvider returns the saml application of the realm with the entity id
+	GetServiceProvider(tenant, realm, entityId string) (*model.Application, bool)
+
+	// CreateSamlSession validates a request of the service provider and returns the SAML information of the
+	// authentication session. The request id and the ACS URL are empty for IdP initiated SSO.
+	CreateSamlSession(application *model.Application, requestId, acsUrl, nameIdFormat, relayState string) (*model.SamlSession, error)
+
+	// CreateResponse creates the response to the service provider for a finished flow, which contains a signed
+	// assertion if the user authenticated and an error status otherwise
+	CreateResponse(ctx context.Context, tenant, realm, baseUrl string, session *model.AuthenticationSession) (string, error)
+
+	// CreateErrorResponse creates a response that tells the service provider why its request failed
+	CreateErrorResponse(baseUrl string, samlSession *model.SamlSession, statusCode, subStatusCode string) (string, error)
+}
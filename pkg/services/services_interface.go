@@ -26,7 +26,13 @@ type Services struct {
 	AdminAuthzService          AdminAuthzService
 	TemplatesService           TemplatesService
 	EmailService               EmailService
+	SMSService                 SMSService
 	UserClaimsService          UserClaimsService
+	ConfigChangeService        ConfigChangeService
+	MaintenanceService         MaintenanceService
+	PasswordResetService       PasswordResetService
+	FlowAnalyticsService       FlowAnalyticsService
+	SamlService                SamlService
 }
 
 // UserAdminService defines the business logic for user operations
@@ -100,11 +106,48 @@ type FlowService interface {
 	// UpdateFlow updates an existing flow
 	UpdateFlow(tenant, realm string, flow model.Flow) error
 
+	// ImportFlow creates or updates a flow from the configuration files. Unlike CreateFlow and UpdateFlow, errors of
+	// the lint checks are logged as warnings unless strict flow validation is enabled, so existing flows keep loading.
+	ImportFlow(tenant, realm string, flow model.Flow) error
+
 	// DeleteFlow deletes a flow by its ID
 	DeleteFlow(tenant, realm, id string) error
 
-	// ValidateFlowDefinition validates a YAML flow definition
+	// ValidateFlowDefinition validates a YAML flow definition with the same checks as CreateFlow and UpdateFlow
 	ValidateFlowDefinition(content string) ([]FlowLintError, error)
+
+	// GetFlowVersionForExecution returns a flow with the definition of a specific version, which is used
+	// for sessions pinned to an older version and for testing drafts in debug mode
+	GetFlowVersionForExecution(id string, version int, loadedRealm *LoadedRealm) (*model.Flow, bool)
+
+	// CreateFlowVersion validates and stores a new draft version of a flow definition without publishing it
+	CreateFlowVersion(tenant, realm, id, definitionYaml, comment string) (*model.FlowVersion, error)
+
+	// ListFlowVersions returns all versions of a flow, the newest version first
+	ListFlowVersions(tenant, realm, id string) ([]model.FlowVersion, error)
+
+	// GetFlowVersion returns a single version of a flow
+	GetFlowVersion(tenant, realm, id string, version int) (*model.FlowVersion, bool)
+
+	// PublishFlowVersion makes a version the active definition of a flow which is used for new sessions
+	PublishFlowVersion(tenant, realm, id string, version int) error
+
+	// RollbackFlow publishes the latest version before the active version and returns it
+	RollbackFlow(tenant, realm, id string) (*model.FlowVersion, error)
+
+	// DiffFlowVersions returns a unified diff between the definitions of two versions of a flow
+	DiffFlowVersions(tenant, realm, id string, from, to int) (string, error)
+
+	// SelectFlowVariant picks the rollout variant of a flow for a sticky key such as a device id and records that the
+	// session with the run id started on it. The key stays on the variant it was first assigned to, also if the weights
+	// change, until the variant is removed or its weight set to 0. Returns nil if the flow has no variants.
+	SelectFlowVariant(flow *model.Flow, stickyKey, runId string) *model.FlowVariant
+
+	// RecordFlowVariantResult records the result of a finished session on its variant, once per session
+	RecordFlowVariantResult(session *model.AuthenticationSession)
+
+	// GetFlowVariantMetrics returns the number of sessions per current variant of a flow
+	GetFlowVariantMetrics(tenant, realm, id string) ([]FlowVariantMetrics, error)
 }
 
 // ApplicationService defines the business logic for application operations
@@ -157,6 +200,19 @@ type SessionsService interface {
 	// DeleteAuthenticationSession removes an authentication session
 	DeleteAuthenticationSession(ctx context.Context, tenant, realm, sessionIDHash string) error
 
+	// ListAuthenticationSessions returns the sessions of a flow created since the given time, including expired sessions
+	// that were not deleted yet. Secrets in the context stay encrypted, the sessions are meant for statistics such as
+	// the traffic of a flow.
+	ListAuthenticationSessions(ctx context.Context, tenant, realm, flowId string, since time.Time) ([]*model.AuthenticationSession, error)
+
+	// ApproveMagicLink records the approval of a magic link opened on another device. The approval is stored
+	// separately from the session so that the waiting session cannot overwrite it. Returns false if the
+	// link was already approved.
+	ApproveMagicLink(ctx context.Context, tenant, realm, sessionIDHash, linkID string, expiresAt time.Time) (bool, error)
+
+	// ConsumeMagicLinkApproval deletes the approval of a magic link and returns true if the link was approved
+	ConsumeMagicLinkApproval(ctx context.Context, tenant, realm, sessionIDHash, linkID string) (bool, error)
+
 	// CreateAuthCodeSession creates a new client session with an auth code
 	CreateAuthCodeSession(ctx context.Context, tenant, realm, clientID, userID string, scope []string, grantType string, codeChallenge string, codeChallengeMethod string, loginSession *model.AuthenticationSession, claims map[string]interface{}) (string, *model.ClientSession, error)
 
@@ -174,6 +230,9 @@ type SessionsService interface {
 
 	// LoadAndDeleteRefreshTokenSession retrieves a client session by refresh token and deletes it
 	LoadAndDeleteRefreshTokenSession(ctx context.Context, tenant, realm, refreshToken string) (*model.ClientSession, error)
+
+	// RevokeUserClientSessions deletes all client sessions of a user and returns the number of deleted sessions
+	RevokeUserClientSessions(ctx context.Context, tenant, realm, userID string) (int, error)
 }
 
 type StaticConfigurationService interface {
@@ -200,7 +259,7 @@ type JWTService interface {
 }
 
 // CacheService defines the interface for cache operations
-// This is currently in memory only but can be extended to other cache backend such as Redis
+// Implementations are either in memory per instance or backed by Redis to share the cache between instances
 type CacheService interface {
 	// Cache stores a value in the cache with the specified TTL
 	Cache(key string, value interface{}, ttl time.Duration, cost int64) error
@@ -261,6 +320,9 @@ type OAuth2Service interface {
 
 	// Validate the redirect uri for an authorize request
 	ValidateRedirectUri(oauth2request *model.AuthorizeRequest, application *model.Application) *oauth2.OAuth2Error
+
+	// GetStepUpDevice returns the user and device of the device cookie if the request can step up the device session to the acr mapping
+	GetStepUpDevice(tenant, realm, deviceCookie string, mapping *model.AcrMapping, oauth2request *model.AuthorizeRequest) (*model.User, *model.DeviceAttributeValue, error)
 }
 
 // SimpleAuthService defines the business logic for Simple Auth operations
@@ -277,3 +339,33 @@ type UserClaimsService interface {
 	// GetUserClaims gets the user claims for a given client session
 	GetUserClaims(user model.User, scope string, oauth2Session *model.Oauth2Session) (map[string]interface{}, error)
 }
+
+// ConfigChangeService propagates changes of realms, flows, applications and templates to all instances
+// so that every instance evicts and reloads its cached configuration without a restart
+type ConfigChangeService interface {
+	// PublishChange records a configuration change and notifies all instances including this one
+	PublishChange(ctx context.Context, change *model.ConfigChange) error
+
+	// OnChange registers a handler that is called for every change, regardless of the instance that published it
+	OnChange(handler func(change model.ConfigChange))
+
+	// Start watches for changes in the background until the context is cancelled
+	Start(ctx context.Context) error
+
+	// GetConfigVersion returns the version of the latest change that has been applied on this instance
+	GetConfigVersion() int64
+}
+
+// MaintenanceService runs background jobs that clean up expired sessions and stale data in all realms.
+// Jobs take a lock in the database while they run so that no two instances run a job at the same time. There is no
+// leader election, each instance runs the jobs on its own schedule and skips a run if the job is locked.
+type MaintenanceService interface {
+	// Start runs all enabled jobs on their schedule in the background until the context is cancelled
+	Start(ctx context.Context) error
+
+	// RunJob runs a job right away. The job is skipped if it is already running on another instance.
+	RunJob(ctx context.Context, name string) (*MaintenanceJobStatus, error)
+
+	// ListJobs returns the status of all jobs as seen by this instance
+	ListJobs() []MaintenanceJobStatus
+}
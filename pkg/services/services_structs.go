@@ -19,6 +19,12 @@ type LoadedRealm struct {
 	Repositories *model.Repositories // services for this realm
 }
 
+// Severities of a FlowLintError, the values match the marker severities of the flow editor
+const (
+	FlowLintSeverityWarning = 4
+	FlowLintSeverityError   = 8
+)
+
 // FlowLintError represents a flow validation error
 type FlowLintError struct {
 	StartLineNumber int    `json:"startLineNumber"`
@@ -27,6 +33,7 @@ type FlowLintError struct {
 	EndColumn       int    `json:"endColumn"`
 	Message         string `json:"message"`
 	Severity        int    `json:"severity"`
+	Node            string `json:"node,omitempty"` // node the error belongs to, empty if it concerns the whole flow
 }
 
 // TimeProvider interface for time operations (useful for testing)
@@ -42,6 +49,16 @@ type CacheMetrics struct {
 	KeysAdded uint64
 }
 
+// FlowVariantMetrics counts the sessions of a rollout variant of a flow
+type FlowVariantMetrics struct {
+	Name      string `json:"name"`
+	Version   int    `json:"version"`
+	Weight    int    `json:"weight"`
+	Started   uint64 `json:"started"`
+	Succeeded uint64 `json:"succeeded"`
+	Failed    uint64 `json:"failed"`
+}
+
 // AuthzEntitlement represents an authorization entitlement
 type AuthzEntitlement struct {
 	Description string `json:"description"`
@@ -49,3 +66,26 @@ type AuthzEntitlement struct {
 	Action      string `json:"action"`
 	Effect      string `json:"effect"`
 }
+
+// Results of a maintenance job run
+const (
+	MaintenanceJobResultSuccess = "success"
+	MaintenanceJobResultFailed  = "failed"
+	MaintenanceJobResultSkipped = "skipped" // the job was running on another instance
+)
+
+// MaintenanceJobStatus is the status of a background maintenance job on this instance
+// @description Status of a background maintenance job
+type MaintenanceJobStatus struct {
+	Name         string     `json:"name" example:"expired_auth_sessions"`
+	Description  string     `json:"description"`
+	Enabled      bool       `json:"enabled"`
+	Interval     string     `json:"interval,omitempty" example:"5m0s"`
+	Running      bool       `json:"running"`
+	LastRun      *time.Time `json:"last_run,omitempty"`
+	LastDuration string     `json:"last_duration,omitempty" example:"12ms"`
+	LastResult   string     `json:"last_result,omitempty" example:"success"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastAffected int        `json:"last_affected"` // number of attributes changed or deleted, sessions are not counted
+	NextRun      *time.Time `json:"next_run,omitempty"`
+}
@@ -0,0 +1,7 @@
+package services
+
+import "github.com/Identityplane/GoAM/pkg/model"
+
+type SMSService interface {
+	SendSMS(tenant, realm string, sms *model.SendSMSParams) error
+}
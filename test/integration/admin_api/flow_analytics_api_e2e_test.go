@@ -0,0 +1,65 @@
+package integration_admin_api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Identityplane/GoAM/test/integration"
+)
+
+func TestFlowAnalyticsAPI(t *testing.T) {
+	e := integration.SetupIntegrationTest(t, "")
+
+	// One user registers, another one stops at the password
+	for _, username := range []string{"funnel-user-1", "funnel-user-2"} {
+		start := e.GET("/acme/customers/auth/username-password-register").Expect().Status(http.StatusOK)
+		sessionId := start.Cookie("session_id").Value().Raw()
+
+		e.POST("/acme/customers/auth/username-password-register/askUsername").
+			WithHeader("Content-Type", "application/x-www-form-urlencoded").
+			WithCookie("session_id", sessionId).
+			WithFormField("step", "askUsername").
+			WithFormField("username", username).
+			Expect().
+			Status(http.StatusOK)
+
+		if username == "funnel-user-1" {
+			e.POST("/acme/customers/auth/username-password-register/askPassword").
+				WithHeader("Content-Type", "application/x-www-form-urlencoded").
+				WithCookie("session_id", sessionId).
+				WithFormField("step", "askPassword").
+				WithFormField("password", "secret123").
+				Expect().
+				Status(http.StatusOK)
+		}
+	}
+
+	funnel := e.GET("/admin/acme/customers/dashboard/flows/username-password-register").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("flows").Array().Value(0).Object()
+
+	funnel.HasValue("flow_id", "username-password-register")
+	funnel.HasValue("started", 2)
+	funnel.HasValue("succeeded", 1)
+	funnel.HasValue("failed", 0)
+	funnel.HasValue("abandoned", 0)
+	funnel.HasValue("in_progress", 1)
+
+	steps := funnel.Value("steps").Array()
+	steps.Length().IsEqual(2)
+	steps.Value(0).Object().HasValue("node", "askUsername").HasValue("reached", 2).HasValue("submitted", 2).HasValue("in_progress", 0)
+	steps.Value(1).Object().HasValue("node", "askPassword").HasValue("reached", 2).HasValue("submitted", 1).HasValue("in_progress", 1)
+
+	// Filtered by a client that did not start the flow
+	e.GET("/admin/acme/customers/dashboard/flows").
+		WithQuery("client_id", "unknown-client").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("flows").Array().IsEmpty()
+
+	e.GET("/admin/acme/customers/dashboard/flows").
+		WithQuery("from", "yesterday").
+		Expect().
+		Status(http.StatusBadRequest)
+}
@@ -187,7 +187,7 @@ nodes:
   node1:
     use: init
     next:
-      success: node2
+      start: node2
   node2:
     use: successResult`
 
@@ -221,13 +221,22 @@ nodes:
 		HasValue("valid", false).
 		HasValue("errors", []interface{}{
 			map[string]interface{}{
-				"startLineNumber": 1,
+				"startLineNumber": 3,
 				"startColumn":     1,
-				"endLineNumber":   1,
-				"endColumn":       1,
+				"endLineNumber":   3,
+				"endColumn":       6,
 				"message":         "start node 'non_existent_node' not found in nodes",
 				"severity":        8,
 			},
+			map[string]interface{}{
+				"startLineNumber": 6,
+				"startColumn":     5,
+				"endLineNumber":   6,
+				"endColumn":       8,
+				"message":         "node 'node1' uses unknown node type 'auth'",
+				"severity":        8,
+				"node":            "node1",
+			},
 		})
 
 	// Unhappy case - invalid YAML syntax
@@ -290,7 +299,44 @@ nodes:
 				"message":         "start node '' not found in nodes",
 				"severity":        8,
 			},
+			map[string]interface{}{
+				"startLineNumber": 4,
+				"startColumn":     5,
+				"endLineNumber":   4,
+				"endColumn":       8,
+				"message":         "node 'node1' uses unknown node type 'auth'",
+				"severity":        8,
+				"node":            "node1",
+			},
+			map[string]interface{}{
+				"startLineNumber": 8,
+				"startColumn":     5,
+				"endLineNumber":   8,
+				"endColumn":       8,
+				"message":         "node 'node2' uses unknown node type 'success'",
+				"severity":        8,
+				"node":            "node2",
+			},
 		})
+
+	// Lint errors make the flow invalid, also without strict flow validation
+	lintFlow := `start: node1
+nodes:
+  node1:
+    use: init
+    next:
+      start: node2
+      unknown: node2
+  node2:
+    use: successResult`
+
+	e.POST("/admin/acme/test_realm/flows/validate").
+		WithText(lintFlow).
+		WithHeader("Content-Type", "text/yaml").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		HasValue("valid", false)
 }
 
 func TestFlowUpdate(t *testing.T) {
@@ -323,3 +369,171 @@ func TestFlowUpdate(t *testing.T) {
 
 	assert.Equal(t, updatedFlowDefYaml, flowDefinitionYaml2)
 }
+
+func TestFlowVersions(t *testing.T) {
+	e := integration.SetupIntegrationTest(t, "")
+
+	publishedYaml := e.GET("/admin/acme/customers/flows/login/definition").
+		Expect().
+		Status(http.StatusOK).
+		Body().Raw()
+
+	draftYaml := publishedYaml + "# draft change\n"
+
+	// Saving as draft creates a version which is not used for new logins
+	draftVersion := e.POST("/admin/acme/customers/flows/login/versions").
+		WithQuery("comment", "add a comment").
+		WithText(draftYaml).
+		WithHeader("Content-Type", "text/yaml").
+		Expect().
+		Status(http.StatusCreated).
+		JSON().Object().
+		HasValue("active", false).
+		HasValue("comment", "add a comment").
+		Value("version").Number().Raw()
+
+	e.GET("/admin/acme/customers/flows/login/definition").
+		WithQuery("version", "active").
+		Expect().
+		Status(http.StatusOK).
+		Body().IsEqual(publishedYaml)
+
+	e.GET("/admin/acme/customers/flows/login/versions").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().Length().IsEqual(2)
+
+	e.GET("/admin/acme/customers/flows/login/versions/diff").
+		WithQuery("from", 1).
+		WithQuery("to", int(draftVersion)).
+		Expect().
+		Status(http.StatusOK).
+		Body().Contains("+# draft change")
+
+	// Publish the draft
+	e.POST("/admin/acme/customers/flows/login/versions/{version}/publish", int(draftVersion)).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		HasValue("active", true)
+
+	e.GET("/admin/acme/customers/flows/login/definition").
+		WithQuery("version", "active").
+		Expect().
+		Status(http.StatusOK).
+		Body().IsEqual(draftYaml)
+
+	// An unpublished draft is skipped by the rollback
+	e.POST("/admin/acme/customers/flows/login/versions").
+		WithText(draftYaml+"# unpublished change\n").
+		WithHeader("Content-Type", "text/yaml").
+		Expect().
+		Status(http.StatusCreated).
+		JSON().Object().
+		HasValue("active", false)
+
+	// Saving the definition publishes it right away
+	e.PUT("/admin/acme/customers/flows/login/definition").
+		WithText(draftYaml+"# published change\n").
+		WithHeader("Content-Type", "text/yaml").
+		Expect().
+		Status(http.StatusOK).
+		Body().IsEmpty()
+
+	e.GET("/admin/acme/customers/flows/login/definition").
+		WithQuery("version", "active").
+		Expect().
+		Status(http.StatusOK).
+		Body().IsEqual(draftYaml + "# published change\n")
+
+	// Invalid definitions are rejected
+	e.PUT("/admin/acme/customers/flows/login/definition").
+		WithText("start: missing\nnodes: {}\n").
+		WithHeader("Content-Type", "text/yaml").
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.POST("/admin/acme/customers/flows/login/versions").
+		WithText("start: missing\nnodes: {}\n").
+		WithHeader("Content-Type", "text/yaml").
+		Expect().
+		Status(http.StatusBadRequest).
+		JSON().Object().
+		Value("error").String().IsEqual("flow definition is invalid: start node 'missing' not found in nodes")
+
+	// Roll back to the previously published versions
+	e.POST("/admin/acme/customers/flows/login/rollback").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		HasValue("version", int(draftVersion))
+
+	e.POST("/admin/acme/customers/flows/login/rollback").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		HasValue("version", 1)
+
+	e.GET("/admin/acme/customers/flows/login/definition").
+		WithQuery("version", "active").
+		Expect().
+		Status(http.StatusOK).
+		Body().IsEqual(publishedYaml)
+
+	e.POST("/admin/acme/customers/flows/login/rollback").
+		Expect().
+		Status(http.StatusConflict)
+}
+
+func TestFlowTests(t *testing.T) {
+	e := integration.SetupIntegrationTest(t, "")
+
+	// The tests in the flow definition pass
+	result := e.POST("/admin/acme/customers/flows/username-password-register/tests").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object()
+	result.HasValue("flow", "username-password-register")
+	result.HasValue("passed", true)
+	result.Value("suites").Array().Value(0).Object().Value("tests").Array().Length().IsEqual(3)
+
+	// A suite in the request runs in addition to the tests of the flow
+	suite := `
+name: request
+tests:
+  - name: expects the wrong result
+    steps:
+      - inputs: {username: carol}
+      - inputs: {password: secret}
+    expect:
+      result: failure
+`
+	result = e.POST("/admin/acme/customers/flows/username-password-register/tests").
+		WithText(suite).
+		WithHeader("Content-Type", "text/yaml").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object()
+	result.HasValue("passed", false)
+	failed := result.Value("suites").Array().Value(1).Object().Value("tests").Array().Value(0).Object()
+	failed.HasValue("passed", false)
+	failed.Value("failures").Array().ContainsAll("expected the result 'failure' but got 'success'")
+
+	e.POST("/admin/acme/customers/flows/username-password-register/tests").
+		WithText("tests:\n  - steps: []\n").
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.POST("/admin/acme/customers/flows/unknown/tests").
+		Expect().
+		Status(http.StatusNotFound)
+
+	// The realm runs the tests of all flows that have tests
+	realmResult := e.POST("/admin/acme/customers/flows/tests").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object()
+	realmResult.HasValue("passed", true)
+	realmResult.Value("flows").Array().Length().IsEqual(1)
+	realmResult.Value("flows").Array().Value(0).Object().HasValue("flow", "username-password-register")
+}
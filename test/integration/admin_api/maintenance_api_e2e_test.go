@@ -0,0 +1,38 @@
+package integration_admin_api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Identityplane/GoAM/test/integration"
+)
+
+// Lists the maintenance jobs and runs one of them through the admin api
+func TestMaintenanceAPI_E2E(t *testing.T) {
+	e := integration.SetupIntegrationTest(t, "")
+
+	jobs := e.GET("/admin/system/maintenance/jobs").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array()
+
+	jobs.Length().IsEqual(7)
+	jobs.Value(0).Object().
+		HasValue("name", "expired_auth_sessions").
+		HasValue("enabled", true).
+		HasValue("running", false)
+
+	e.POST("/admin/system/maintenance/jobs/expired_auth_sessions/run").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		HasValue("name", "expired_auth_sessions").
+		HasValue("last_result", "success").
+		ContainsKey("last_run")
+
+	e.POST("/admin/system/maintenance/jobs/unknown/run").
+		Expect().
+		Status(http.StatusNotFound).
+		JSON().Object().
+		HasValue("error", "maintenance job not found")
+}
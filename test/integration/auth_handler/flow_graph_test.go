@@ -0,0 +1,60 @@
+package authhandler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Identityplane/GoAM/test/integration"
+)
+
+func TestFlowGraph_Traffic(t *testing.T) {
+	e := integration.SetupIntegrationTest(t, "")
+
+	// One user stops at the password prompt
+	expect := e.GET("/acme/customers/auth/username-password-register").Expect().Status(http.StatusOK)
+	e.POST("/acme/customers/auth/username-password-register/askUsername").
+		WithHeader("Content-Type", "application/x-www-form-urlencoded").
+		WithCookie("session_id", expect.Cookie("session_id").Value().Raw()).
+		WithFormField("step", "askUsername").
+		WithFormField("username", "graph-user").
+		Expect().
+		Status(http.StatusOK)
+
+	graph := e.GET("/acme/customers/debug/username-password-register/graph.json").
+		WithQuery("window", "1h").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object()
+
+	graph.Value("traffic").Object().HasValue("sessions", 1)
+	checked := 0
+	for _, node := range graph.Value("nodes").Array().Iter() {
+		switch node.Object().Value("id").String().Raw() {
+		case "askUsername":
+			node.Object().Value("stats").Object().HasValue("executions", 1)
+			checked++
+		case "askPassword":
+			node.Object().Value("stats").Object().HasValue("waiting", 1)
+			checked++
+		}
+	}
+	for _, edge := range graph.Value("edges").Array().Iter() {
+		if edge.Object().Value("from").String().Raw() == "checkUsernameAvailable" && edge.Object().Value("condition").String().Raw() == "available" {
+			edge.Object().HasValue("count", 1)
+			checked++
+		}
+	}
+	if checked != 3 {
+		t.Fatalf("expected the stats of 2 nodes and 1 edge, checked %d", checked)
+	}
+
+	e.GET("/acme/customers/debug/username-password-register/graph.mmd").
+		Expect().
+		Status(http.StatusOK).
+		Body().Contains("flowchart LR").Contains(`-->|"submitted"|`)
+
+	e.GET("/acme/customers/debug/username-password-register/graph.json").
+		WithQuery("window", "yesterday").
+		Expect().
+		Status(http.StatusBadRequest)
+}
@@ -0,0 +1,120 @@
+package authhandler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Identityplane/GoAM/internal/service"
+	"github.com/Identityplane/GoAM/test/integration"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestJSONFlow_SessionsArePinnedToFlowVersion checks that a login started before a new version was published
+// finishes on the version it was started on, while new logins use the published version
+func TestJSONFlow_SessionsArePinnedToFlowVersion(t *testing.T) {
+	e := integration.SetupIntegrationTest(t, "")
+	flowService := service.GetServices().FlowService
+
+	startLogin := func() string {
+		return e.GET("/acme/customers/api/v1/login").
+			WithHeader("Accept", "application/json").
+			Expect().
+			Status(http.StatusOK).
+			JSON().Object().
+			HasValue("currentNode", "askUsername").
+			Value("sessionId").String().Raw()
+	}
+
+	submitUsername := func(sessionId string) string {
+		return e.POST("/acme/customers/api/v1/login").
+			WithHeader("Content-Type", "application/json").
+			WithJSON(map[string]interface{}{
+				"sessionId":   sessionId,
+				"currentNode": "askUsername",
+				"responses":   map[string]string{"username": "unknown-user"},
+			}).
+			Expect().
+			Status(http.StatusOK).
+			JSON().Object().
+			Value("currentNode").String().Raw()
+	}
+
+	oldSession := startLogin()
+
+	// Publish a version that skips the passkey check for unknown users
+	flow, ok := flowService.GetFlowById("acme", "customers", "login")
+	require.True(t, ok)
+	newYaml := strings.Replace(flow.DefinitionYaml, "submitted: checkPasskeyRegistered", "submitted: askPassword", 1)
+	version, err := flowService.CreateFlowVersion("acme", "customers", "login", newYaml, "skip passkey check")
+	require.NoError(t, err)
+	require.NoError(t, flowService.PublishFlowVersion("acme", "customers", "login", version.Version))
+
+	newSession := startLogin()
+
+	// The old session still runs the passkey check, which fails for unknown users
+	require.Equal(t, "authFailure", submitUsername(oldSession))
+	require.Equal(t, "askPassword", submitUsername(newSession))
+}
+
+// TestJSONFlow_WeightedRollout checks that devices are assigned to rollout variants and stay on them
+func TestJSONFlow_WeightedRollout(t *testing.T) {
+	e := integration.SetupIntegrationTest(t, "")
+	flowService := service.GetServices().FlowService
+
+	flow, ok := flowService.GetFlowById("acme", "customers", "login")
+	require.True(t, ok)
+	newYaml := strings.Replace(flow.DefinitionYaml, "submitted: checkPasskeyRegistered", "submitted: askPassword", 1)
+	version, err := flowService.CreateFlowVersion("acme", "customers", "login", newYaml, "skip passkey check")
+	require.NoError(t, err)
+
+	// Send all traffic to the new version through the flows API
+	e.PATCH("/admin/acme/customers/flows/login").
+		WithJSON(map[string]interface{}{
+			"variants": []map[string]interface{}{
+				{"name": "control", "version": flow.ActiveVersion, "weight": 0},
+				{"name": "redesign", "version": version.Version, "weight": 100},
+			},
+		}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		Value("variants").Array().Length().IsEqual(2)
+
+	resp := e.GET("/acme/customers/api/v1/login").
+		WithHeader("Accept", "application/json").
+		Expect().
+		Status(http.StatusOK)
+
+	resp.Cookie("device_id").Value().NotEmpty()
+	sessionId := resp.JSON().Object().Value("sessionId").String().Raw()
+
+	e.POST("/acme/customers/api/v1/login").
+		WithHeader("Content-Type", "application/json").
+		WithJSON(map[string]interface{}{
+			"sessionId":   sessionId,
+			"currentNode": "askUsername",
+			"responses":   map[string]string{"username": "unknown-user"},
+		}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		HasValue("currentNode", "askPassword")
+
+	e.GET("/admin/acme/customers/flows/login/variants").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().
+		Value(1).Object().
+		HasValue("name", "redesign").
+		HasValue("started", 1)
+
+	// Ending the rollout sends new sessions to the active version again
+	e.PATCH("/admin/acme/customers/flows/login").
+		WithJSON(map[string]interface{}{"variants": []interface{}{}}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		NotContainsKey("variants")
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/gavv/httpexpect/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHTMLFlow_SuccessLeadToSessionCookie(t *testing.T) {
@@ -150,6 +151,80 @@ func TestHTMLFlow_UserRegistration(t *testing.T) {
 	})
 }
 
+func TestHTMLFlow_Back(t *testing.T) {
+	e := integration.SetupIntegrationTest(t, "")
+
+	expect := e.GET("/acme/customers/auth/username-password-register").Expect().Status(http.StatusOK)
+	sessionCookie := expect.Cookie("session_id").Value().Raw()
+	doc := parseHTMLResponse(t, expect.Body())
+	assert.Equal(t, 0, doc.Find("input[name='action'][value='back']").Length())
+
+	resp := e.POST("/acme/customers/auth/username-password-register/askUsername").
+		WithHeader("Content-Type", "application/x-www-form-urlencoded").
+		WithCookie("session_id", sessionCookie).
+		WithFormField("step", "askUsername").
+		WithFormField("username", "typo").
+		Expect().
+		Status(http.StatusOK).
+		Body()
+
+	// The password page has a back button
+	doc = parseHTMLResponse(t, resp)
+	assertStepValue(t, doc, "askPassword")
+	assert.Equal(t, 1, doc.Find("input[name='action'][value='back']").Length())
+
+	resp = e.POST("/acme/customers/auth/username-password-register/askPassword").
+		WithHeader("Content-Type", "application/x-www-form-urlencoded").
+		WithCookie("session_id", sessionCookie).
+		WithFormField("step", "askPassword").
+		WithFormField("action", "back").
+		Expect().
+		Status(http.StatusOK).
+		Body()
+
+	doc = parseHTMLResponse(t, resp)
+	assertInputFieldExists(t, doc, "text", "username")
+	assertStepValue(t, doc, "askUsername")
+
+	resp = e.POST("/acme/customers/auth/username-password-register/askUsername").
+		WithHeader("Content-Type", "application/x-www-form-urlencoded").
+		WithCookie("session_id", sessionCookie).
+		WithFormField("step", "askUsername").
+		WithFormField("username", "typo2").
+		Expect().
+		Status(http.StatusOK).
+		Body()
+	assertStepValue(t, parseHTMLResponse(t, resp), "askPassword")
+
+	// The form of the username page can also be submitted again from the browser history
+	resp = e.POST("/acme/customers/auth/username-password-register/askUsername").
+		WithHeader("Content-Type", "application/x-www-form-urlencoded").
+		WithCookie("session_id", sessionCookie).
+		WithFormField("step", "askUsername").
+		WithFormField("username", "backuser").
+		Expect().
+		Status(http.StatusOK).
+		Body()
+	assertStepValue(t, parseHTMLResponse(t, resp), "askPassword")
+
+	resp = e.POST("/acme/customers/auth/username-password-register/askPassword").
+		WithHeader("Content-Type", "application/x-www-form-urlencoded").
+		WithCookie("session_id", sessionCookie).
+		WithFormField("step", "askPassword").
+		WithFormField("password", "backuser").
+		Expect().
+		Status(http.StatusOK).
+		Body()
+	assertSuccessMessage(t, parseHTMLResponse(t, resp), "Registration successful!")
+
+	// The user is registered with the corrected username
+	loadedRealm, ok := service.GetServices().RealmService.GetRealm("acme", "customers")
+	require.True(t, ok)
+	user, err := loadedRealm.Repositories.UserRepo.GetByAttributeIndex(context.Background(), model.AttributeTypeUsername, "backuser")
+	require.NoError(t, err)
+	require.NotNil(t, user)
+}
+
 // parseHTMLResponse parses the HTML response body and returns a goquery document
 func parseHTMLResponse(t *testing.T, resp *httpexpect.String) *goquery.Document {
 	htmlContent := resp.Raw()
@@ -140,6 +140,49 @@ func TestJSONFlow_UsernamePasswordRegisterFlow(t *testing.T) {
 
 }
 
+func TestJSONFlow_Back(t *testing.T) {
+	e := integration.SetupIntegrationTest(t, "")
+
+	resp := e.GET("/acme/customers/api/v1/username-password-register").
+		Expect().
+		Status(http.StatusOK).
+		JSON()
+	resp.Object().NotContainsKey("canGoBack")
+	sessionID := resp.Object().Value("sessionId").String().Raw()
+
+	e.POST("/acme/customers/api/v1/username-password-register").
+		WithJSON(FlowRequest{SessionID: sessionID, CurrentNode: "askUsername", Responses: map[string]string{"username": "typo"}}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		HasValue("currentNode", "askPassword").
+		HasValue("canGoBack", true)
+
+	e.POST("/acme/customers/api/v1/username-password-register").
+		WithJSON(FlowRequest{SessionID: sessionID, CurrentNode: "askPassword", Action: "back"}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		HasValue("currentNode", "askUsername").
+		NotContainsKey("canGoBack").
+		Value("prompts").Object().HasValue("username", "text")
+
+	// There is no step before the first one
+	e.POST("/acme/customers/api/v1/username-password-register").
+		WithJSON(FlowRequest{SessionID: sessionID, CurrentNode: "askUsername", Action: "back"}).
+		Expect().
+		Status(http.StatusBadRequest).
+		JSON().Object().
+		Value("error").Object().HasValue("error", "STEP_NOT_AVAILABLE")
+
+	e.POST("/acme/customers/api/v1/username-password-register").
+		WithJSON(FlowRequest{SessionID: sessionID, CurrentNode: "askUsername", Action: "forward"}).
+		Expect().
+		Status(http.StatusBadRequest).
+		JSON().Object().
+		Value("error").Object().HasValue("error", "INVALID_ACTION")
+}
+
 func TestJSONFlow_FlowWithoutApplication(t *testing.T) {
 	e := integration.SetupIntegrationTest(t, "")
 
@@ -180,6 +223,7 @@ type FlowRequest struct {
 	SessionID   string            `json:"sessionId"`
 	CurrentNode string            `json:"currentNode"`
 	Responses   map[string]string `json:"responses"`
+	Action      string            `json:"action,omitempty"`
 }
 
 type FlowResponse struct {
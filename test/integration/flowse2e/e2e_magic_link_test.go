@@ -0,0 +1,169 @@
+package flowse2e
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/Identityplane/GoAM/internal/auth/repository"
+	"github.com/Identityplane/GoAM/internal/service"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/Identityplane/GoAM/test/integration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const magicLinkFlow = `
+description: 'Magic link login'
+start: init
+nodes:
+  init:
+    name: init
+    use: init
+    next:
+      start: askEmail
+  askEmail:
+    name: askEmail
+    use: askEmail
+    next:
+      submitted: magicLink
+  magicLink:
+    name: magicLink
+    use: emailMagicLink
+    custom_config:
+      init_user: "true"
+      cross_device: approve
+    next:
+      success-registered-email: successResult
+      success-new-email-for-user: successResult
+      success-unkown-email: successResult
+  successResult:
+    name: successResult
+    use: successResult
+`
+
+// capturingEmailService keeps the sent emails so the test can open the link
+type capturingEmailService struct {
+	mu     sync.Mutex
+	emails []*model.SendEmailParams
+}
+
+func (c *capturingEmailService) SendEmail(tenant, realm string, email *model.SendEmailParams) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.emails = append(c.emails, email)
+	return nil
+}
+
+// Emails returns the emails that were sent so far, some nodes send them in the background
+func (c *capturingEmailService) Emails() []*model.SendEmailParams {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*model.SendEmailParams{}, c.emails...)
+}
+
+// captureEmails replaces the email sender of the realm
+func captureEmails(t *testing.T) *capturingEmailService {
+	loadedRealm, ok := service.GetServices().RealmService.GetRealm(integration.DefaultTenant, integration.DefaultRealm)
+	require.True(t, ok)
+
+	emailService := &capturingEmailService{}
+	loadedRealm.Repositories.EmailSender = repository.NewEmailSender(integration.DefaultTenant, integration.DefaultRealm, emailService)
+	return emailService
+}
+
+func TestMagicLink_ApproveFromOtherDevice(t *testing.T) {
+	e := integration.SetupIntegrationTest(t, magicLinkFlow)
+
+	emailService := captureEmails(t)
+
+	var sessionCookie string
+	var linkPath, token string
+
+	t.Run("Step 1: Enter email and receive link", func(t *testing.T) {
+		sessionCookie = e.GET("/acme/customers/auth/test_flow").
+			Expect().
+			Status(http.StatusOK).Cookie("session_id").Value().Raw()
+
+		e.POST("/acme/customers/auth/test_flow/askEmail").
+			WithFormField("email", "alice@example.com").
+			WithCookie("session_id", sessionCookie).
+			Expect().
+			Status(http.StatusOK).
+			Body().Contains("alice@example.com")
+
+		require.Len(t, emailService.Emails(), 1)
+		link, err := url.Parse(emailService.Emails()[0].Params["link"].(string))
+		require.NoError(t, err)
+
+		linkPath = link.Path
+		token = link.Query().Get("magic_link")
+		assert.NotEmpty(t, token)
+	})
+
+	t.Run("Step 2: Opening the link on another device asks for approval", func(t *testing.T) {
+		e.GET(linkPath).
+			WithQuery("magic_link", token).
+			Expect().
+			Status(http.StatusOK).
+			Body().Contains("Approve login").NotContains("alice@example.com")
+	})
+
+	t.Run("Step 3: The original device is still waiting", func(t *testing.T) {
+		e.GET(linkPath).
+			WithCookie("session_id", sessionCookie).
+			Expect().
+			Status(http.StatusOK).
+			Body().Contains("We sent a login link")
+	})
+
+	t.Run("Step 4: Approve on the other device", func(t *testing.T) {
+		e.POST(linkPath).
+			WithQuery("magic_link", token).
+			Expect().
+			Status(http.StatusOK).
+			Body().Contains("The login was approved")
+
+		// The link is single-use
+		e.POST(linkPath).
+			WithQuery("magic_link", token).
+			Expect().
+			Status(http.StatusBadRequest)
+	})
+
+	t.Run("Step 5: The original device continues", func(t *testing.T) {
+		e.GET(linkPath).
+			WithCookie("session_id", sessionCookie).
+			Expect().
+			Status(http.StatusOK).
+			Body().Contains("successResult")
+	})
+}
+
+func TestMagicLink_SameDevice(t *testing.T) {
+	e := integration.SetupIntegrationTest(t, magicLinkFlow)
+
+	emailService := captureEmails(t)
+
+	sessionCookie := e.GET("/acme/customers/auth/test_flow").
+		Expect().
+		Status(http.StatusOK).Cookie("session_id").Value().Raw()
+
+	e.POST("/acme/customers/auth/test_flow/askEmail").
+		WithFormField("email", "alice@example.com").
+		WithCookie("session_id", sessionCookie).
+		Expect().
+		Status(http.StatusOK)
+
+	require.Len(t, emailService.Emails(), 1)
+	link, err := url.Parse(emailService.Emails()[0].Params["link"].(string))
+	require.NoError(t, err)
+
+	e.GET(link.Path).
+		WithQuery("magic_link", link.Query().Get("magic_link")).
+		WithCookie("session_id", sessionCookie).
+		Expect().
+		Status(http.StatusOK).
+		Body().Contains("successResult")
+}
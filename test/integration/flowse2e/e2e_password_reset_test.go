@@ -0,0 +1,230 @@
+package flowse2e
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Identityplane/GoAM/internal/lib"
+	"github.com/Identityplane/GoAM/internal/service"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/Identityplane/GoAM/test/integration"
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const forgotPasswordFlow = `
+description: 'Request a password reset link'
+start: init
+nodes:
+  init:
+    name: init
+    use: init
+    next:
+      start: askEmail
+  askEmail:
+    name: askEmail
+    use: askEmail
+    next:
+      submitted: requestReset
+  requestReset:
+    name: requestReset
+    use: requestPasswordReset
+    custom_config:
+      link_uri: http://integration-test.com/acme/customers/auth/reset_password
+      max_requests_per_identifier: "2"
+    next:
+      sent: resetSent
+  resetSent:
+    name: resetSent
+    use: messageConfirmation
+    custom_config:
+      message: If an account exists for this email address we sent a link to reset the password
+    next:
+      submitted: failureResult
+  failureResult:
+    name: failureResult
+    use: failureResult
+`
+
+const resetPasswordFlow = `
+description: 'Reset the password with a reset link'
+start: init
+nodes:
+  init:
+    name: init
+    use: init
+    next:
+      start: verifyToken
+  verifyToken:
+    name: verifyToken
+    use: verifyPasswordResetToken
+    next:
+      valid: askPassword
+      invalid: failureResult
+  askPassword:
+    name: askPassword
+    use: askPassword
+    next:
+      submitted: updatePassword
+  updatePassword:
+    name: updatePassword
+    use: updatePassword
+    custom_config:
+      revoke_sessions: "true"
+    next:
+      success: successResult
+      fail: failureResult
+  successResult:
+    name: successResult
+    use: successResult
+  failureResult:
+    name: failureResult
+    use: failureResult
+`
+
+// requestPasswordReset submits the email address in the forgot password flow
+func requestPasswordReset(e *httpexpect.Expect, email string) {
+	sessionCookie := e.GET("/acme/customers/auth/test_flow").
+		Expect().
+		Status(http.StatusOK).Cookie("session_id").Value().Raw()
+
+	e.POST("/acme/customers/auth/test_flow/askEmail").
+		WithFormField("email", email).
+		WithCookie("session_id", sessionCookie).
+		Expect().
+		Status(http.StatusOK).
+		Body().Contains("If an account exists")
+}
+
+func TestPasswordReset_E2E(t *testing.T) {
+	e := integration.SetupIntegrationTest(t, forgotPasswordFlow)
+	ctx := context.Background()
+
+	err := service.GetServices().FlowService.CreateFlow(integration.DefaultTenant, integration.DefaultRealm, model.Flow{
+		Id:             "reset_password",
+		Route:          "reset_password",
+		Active:         true,
+		DefinitionYaml: resetPasswordFlow,
+	})
+	require.NoError(t, err)
+
+	loadedRealm, ok := service.GetServices().RealmService.GetRealm(integration.DefaultTenant, integration.DefaultRealm)
+	require.True(t, ok)
+
+	user := &model.User{ID: "reset-user", Tenant: integration.DefaultTenant, Realm: integration.DefaultRealm, Status: "active"}
+	user.AddAttribute(&model.UserAttribute{
+		Type:  model.AttributeTypeEmail,
+		Index: lib.StringPtr("alice@example.com"),
+		Value: model.EmailAttributeValue{Email: "alice@example.com", Verified: true},
+	})
+	require.NoError(t, loadedRealm.Repositories.UserRepo.Create(ctx, user))
+
+	accessToken := integration.CreateAccessTokenSession(t, *user)
+	emailService := captureEmails(t)
+
+	var token string
+
+	t.Run("Unknown email addresses get the same response", func(t *testing.T) {
+		requestPasswordReset(e, "mallory@example.com")
+		assert.Never(t, func() bool { return len(emailService.Emails()) > 0 }, 200*time.Millisecond, 10*time.Millisecond)
+	})
+
+	t.Run("Request a reset link", func(t *testing.T) {
+		requestPasswordReset(e, "alice@example.com")
+
+		// The link is sent in the background
+		require.Eventually(t, func() bool { return len(emailService.Emails()) == 1 }, time.Second, 10*time.Millisecond)
+		email := emailService.Emails()[0]
+		assert.Equal(t, "password-reset", email.Template)
+
+		link, err := url.Parse(email.Params["link"].(string))
+		require.NoError(t, err)
+		assert.Equal(t, "/acme/customers/auth/reset_password", link.Path)
+		token = link.Query().Get("reset_token")
+		require.NotEmpty(t, token)
+	})
+
+	t.Run("Requests are rate limited per email address", func(t *testing.T) {
+		requestPasswordReset(e, "alice@example.com")
+		requestPasswordReset(e, "alice@example.com")
+		require.Eventually(t, func() bool { return len(emailService.Emails()) == 2 }, time.Second, 10*time.Millisecond)
+		assert.Never(t, func() bool { return len(emailService.Emails()) > 2 }, 200*time.Millisecond, 10*time.Millisecond)
+	})
+
+	t.Run("Invalid links do not end a pending session", func(t *testing.T) {
+		sessionCookie := e.GET("/acme/customers/auth/reset_password").
+			Expect().
+			Status(http.StatusOK).Cookie("session_id").Value().Raw()
+
+		e.GET("/acme/customers/auth/reset_password").
+			WithQuery("reset_token", "invalid-token").
+			WithCookie("session_id", sessionCookie).
+			Expect().
+			Status(http.StatusOK)
+
+		_, ok := service.GetServices().SessionsService.GetAuthenticationSessionByID(ctx, integration.DefaultTenant, integration.DefaultRealm, sessionCookie)
+		assert.True(t, ok)
+	})
+
+	t.Run("Reset the password with the link", func(t *testing.T) {
+		// Opening the link only asks for a confirmation, e.g. when an email scanner prefetches it
+		for i := 0; i < 2; i++ {
+			e.GET("/acme/customers/auth/reset_password").
+				WithQuery("reset_token", token).
+				Expect().
+				Status(http.StatusOK).
+				Body().Contains("Reset password").NotContains(`name="password"`)
+		}
+
+		resp := e.GET("/acme/customers/auth/reset_password").
+			WithQuery("reset_token", token).
+			Expect().
+			Status(http.StatusOK)
+		sessionCookie := resp.Cookie("session_id").Value().Raw()
+
+		e.POST("/acme/customers/auth/reset_password/verifyToken").
+			WithFormField("step", "verifyToken").
+			WithFormField("reset_token", token).
+			WithCookie("session_id", sessionCookie).
+			Expect().
+			Status(http.StatusOK).
+			Body().Contains(`name="password"`)
+
+		e.POST("/acme/customers/auth/reset_password/askPassword").
+			WithFormField("password", "newSecurePassword123!").
+			WithCookie("session_id", sessionCookie).
+			Expect().
+			Status(http.StatusOK).
+			Body().Contains("The flow has completed")
+
+		updated, err := loadedRealm.Repositories.UserRepo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		password, _, err := model.GetAttribute[model.PasswordAttributeValue](updated, model.AttributeTypePassword)
+		require.NoError(t, err)
+		require.NotNil(t, password)
+		assert.NoError(t, lib.ComparePassword("newSecurePassword123!", password.PasswordHash))
+
+		// Existing tokens of the user were revoked
+		_, err = service.GetServices().SessionsService.GetClientSessionByAccessToken(ctx, integration.DefaultTenant, integration.DefaultRealm, accessToken)
+		assert.Error(t, err)
+	})
+
+	t.Run("The link can only be used once", func(t *testing.T) {
+		sessionCookie := e.GET("/acme/customers/auth/reset_password").
+			WithQuery("reset_token", token).
+			Expect().
+			Status(http.StatusOK).Cookie("session_id").Value().Raw()
+
+		e.POST("/acme/customers/auth/reset_password/verifyToken").
+			WithFormField("step", "verifyToken").
+			WithFormField("reset_token", token).
+			WithCookie("session_id", sessionCookie).
+			Expect().
+			Status(http.StatusOK).
+			Body().NotContains(`name="password"`)
+	})
+}
@@ -0,0 +1,113 @@
+package flowse2e
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Identityplane/GoAM/internal/service"
+	"github.com/Identityplane/GoAM/pkg/model"
+	"github.com/Identityplane/GoAM/test/integration"
+	"github.com/stretchr/testify/require"
+)
+
+const subflowParentFlow = `
+description: 'Login that collects the email with a shared flow'
+start: init
+nodes:
+  init:
+    name: init
+    use: init
+    next:
+      start: askUsername
+  askUsername:
+    name: askUsername
+    use: askUsername
+    next:
+      submitted: collectEmail
+  collectEmail:
+    name: collectEmail
+    use: subflow
+    custom_config:
+      flow: collect_email
+      inputs: username
+      outputs: email
+    next:
+      success: checkContext
+      failure: failureResult
+  checkContext:
+    name: checkContext
+    use: condition
+    custom_config:
+      outcomes: 'ok: context.username == "alice" && context.email == "alice@example.com" && !("confirmed" in context)'
+    next:
+      ok: done
+      default: failureResult
+  done:
+    name: done
+    use: messageConfirmation
+    custom_config:
+      message: The email was collected
+    next:
+      submitted: failureResult
+  failureResult:
+    name: failureResult
+    use: failureResult
+`
+
+const subflowChildFlow = `
+description: 'Shared flow that asks for the email'
+start: init
+nodes:
+  init:
+    name: init
+    use: init
+    next:
+      start: askEmail
+  askEmail:
+    name: askEmail
+    use: askEmail
+    next:
+      submitted: confirmed
+  confirmed:
+    name: confirmed
+    use: setVariable
+    custom_config:
+      key: confirmed
+      value: "true"
+    next:
+      done: successResult
+  successResult:
+    name: successResult
+    use: successResult
+`
+
+func TestSubflow_E2E(t *testing.T) {
+	e := integration.SetupIntegrationTest(t, subflowParentFlow)
+
+	err := service.GetServices().FlowService.CreateFlow(integration.DefaultTenant, integration.DefaultRealm, model.Flow{
+		Id:             "collect_email",
+		Route:          "collect_email",
+		DefinitionYaml: subflowChildFlow,
+	})
+	require.NoError(t, err)
+
+	sessionCookie := e.GET("/acme/customers/auth/test_flow").
+		Expect().
+		Status(http.StatusOK).Cookie("session_id").Value().Raw()
+
+	// The nodes of the child flow are rendered under the namespace of the subflow node
+	e.POST("/acme/customers/auth/test_flow/askUsername").
+		WithFormField("username", "alice").
+		WithCookie("session_id", sessionCookie).
+		Expect().
+		Status(http.StatusOK).
+		Body().Contains(`name="email"`)
+
+	// The child flow returns to the parent flow, only the mapped outputs are copied back
+	e.POST("/acme/customers/auth/test_flow/collectEmail.askEmail").
+		WithFormField("email", "alice@example.com").
+		WithCookie("session_id", sessionCookie).
+		Expect().
+		Status(http.StatusOK).
+		Body().Contains("The email was collected")
+}
@@ -0,0 +1,227 @@
+package integration_saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Identityplane/GoAM/test/integration"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gavv/httpexpect/v2"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	spEntityId = "https://sp.example.com"
+	spAcsUrl   = "https://sp.example.com/acs"
+)
+
+// TestSamlIdp_E2E performs an end-to-end test of the SAML identity provider of a realm.
+// It tests the following operations in sequence:
+// 1. Registering a service provider as application of type saml
+// 2. Loading the metadata of the identity provider
+// 3. SP initiated SSO with the HTTP-Redirect binding and a flow that does not prompt
+// 4. SP initiated SSO with the HTTP-POST binding and an interactive login
+// 5. Rejecting requests with an unregistered ACS URL and IdP initiated SSO that is not allowed
+func TestSamlIdp_E2E(t *testing.T) {
+	e := integration.SetupIntegrationTest(t, "")
+
+	t.Run("Create Service Provider", func(t *testing.T) {
+		e.POST("/admin/acme/customers/applications/saml-sp").
+			WithJSON(map[string]interface{}{
+				"client_id":                    "saml-sp",
+				"type":                         "saml",
+				"description":                  "SAML Service Provider",
+				"allowed_authentication_flows": []string{"login_or_register", "mock_success", "mock_failure"},
+				"settings": map[string]interface{}{
+					"saml_settings": map[string]interface{}{
+						"entity_id": spEntityId,
+						"acs_urls":  []string{spAcsUrl},
+					},
+				},
+			}).
+			Expect().
+			Status(http.StatusCreated).
+			JSON().Object().
+			HasValue("type", "saml")
+	})
+
+	t.Run("Get Metadata", func(t *testing.T) {
+		resp := e.GET("/acme/customers/saml/metadata").
+			Expect().
+			Status(http.StatusOK)
+
+		resp.Header("Content-Type").IsEqual("application/samlmetadata+xml")
+		body := resp.Body().Raw()
+		assert.Contains(t, body, `entityID="http://localhost:8080/acme/customers/saml/metadata"`)
+		assert.Contains(t, body, `Location="http://localhost:8080/acme/customers/saml/sso"`)
+		assert.Contains(t, body, "<ds:X509Certificate>")
+	})
+
+	t.Run("SP Initiated SSO with Redirect Binding", func(t *testing.T) {
+		body := e.GET("/acme/customers/saml/sso").
+			WithQuery("SAMLRequest", deflateRequest(t, authnRequest("_request1", spAcsUrl))).
+			WithQuery("RelayState", "state-1").
+			WithQuery("flow", "mock_success").
+			Expect().
+			Status(http.StatusOK).
+			Body().Raw()
+
+		action, response, relayState := parsePostForm(t, body)
+		assert.Equal(t, spAcsUrl, action)
+		assert.Equal(t, "state-1", relayState)
+		assert.Contains(t, response, `InResponseTo="_request1"`)
+		assert.Contains(t, response, `<samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success">`)
+		assert.Contains(t, response, "<saml:Audience>"+spEntityId+"</saml:Audience>")
+		assert.Contains(t, response, "<ds:SignatureValue>")
+	})
+
+	t.Run("Failed Flow Returns Error Status", func(t *testing.T) {
+		body := e.GET("/acme/customers/saml/sso").
+			WithQuery("SAMLRequest", deflateRequest(t, authnRequest("_request2", ""))).
+			WithQuery("flow", "mock_failure").
+			Expect().
+			Status(http.StatusOK).
+			Body().Raw()
+
+		action, response, _ := parsePostForm(t, body)
+		assert.Equal(t, spAcsUrl, action)
+		assert.Contains(t, response, "urn:oasis:names:tc:SAML:2.0:status:AuthnFailed")
+		assert.NotContains(t, response, "<saml:Assertion")
+	})
+
+	t.Run("SP Initiated SSO with POST Binding", func(t *testing.T) {
+		resp := e.POST("/acme/customers/saml/sso").
+			WithFormField("SAMLRequest", base64.StdEncoding.EncodeToString([]byte(authnRequest("_request3", spAcsUrl)))).
+			WithFormField("RelayState", "state-3").
+			Expect().
+			Status(http.StatusSeeOther)
+
+		resp.Header("Location").Contains("/acme/customers/auth/login-or-register")
+		sessionCookie := resp.Cookie("session_id").Value().Raw()
+
+		login(t, e, "/acme/customers/auth/login-or-register", sessionCookie)
+
+		body := e.GET("/acme/customers/saml/finish").
+			WithCookie("session_id", sessionCookie).
+			Expect().
+			Status(http.StatusOK).
+			Body().Raw()
+
+		action, response, relayState := parsePostForm(t, body)
+		assert.Equal(t, spAcsUrl, action)
+		assert.Equal(t, "state-3", relayState)
+		assert.Contains(t, response, `InResponseTo="_request3"`)
+		assert.Contains(t, response, "<saml:Assertion")
+
+		// The authentication session cannot be used for a second response
+		e.GET("/acme/customers/saml/finish").
+			WithCookie("session_id", sessionCookie).
+			Expect().
+			Status(http.StatusBadRequest)
+	})
+
+	t.Run("Reject Unregistered ACS URL", func(t *testing.T) {
+		e.GET("/acme/customers/saml/sso").
+			WithQuery("SAMLRequest", deflateRequest(t, authnRequest("_request4", "https://attacker.example.com/acs"))).
+			Expect().
+			Status(http.StatusBadRequest)
+	})
+
+	t.Run("Reject IdP Initiated SSO", func(t *testing.T) {
+		e.GET("/acme/customers/saml/sso/init").
+			WithQuery("sp", "saml-sp").
+			Expect().
+			Status(http.StatusBadRequest).
+			Body().Contains("IdP initiated SSO is not allowed")
+	})
+}
+
+func authnRequest(id, acsUrl string) string {
+	acs := ""
+	if acsUrl != "" {
+		acs = ` AssertionConsumerServiceURL="` + acsUrl + `"`
+	}
+
+	return `<samlp:AuthnRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="` + id +
+		`" Version="2.0" IssueInstant="2024-01-01T00:00:00Z"` + acs + `><saml:Issuer>` + spEntityId + `</saml:Issuer></samlp:AuthnRequest>`
+}
+
+// deflateRequest encodes a request for the HTTP-Redirect binding
+func deflateRequest(t *testing.T, request string) string {
+	var compressed bytes.Buffer
+	writer, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte(request))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	return base64.StdEncoding.EncodeToString(compressed.Bytes())
+}
+
+// parsePostForm returns the ACS URL, the decoded response and the relay state of the auto-submit form
+func parsePostForm(t *testing.T, htmlContent string) (string, string, string) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	require.NoError(t, err)
+
+	action, _ := doc.Find("form").Attr("action")
+	encoded, ok := doc.Find("input[name='SAMLResponse']").Attr("value")
+	require.True(t, ok, "Expected to find SAMLResponse field in HTML response")
+	relayState, _ := doc.Find("input[name='RelayState']").Attr("value")
+
+	response, err := base64.StdEncoding.DecodeString(encoded)
+	require.NoError(t, err)
+
+	return action, string(response), relayState
+}
+
+// login authenticates the user with the username and password form of the flow
+func login(t *testing.T, e *httpexpect.Expect, authURL, sessionCookie string) {
+	step := extractStep(t, e.GET(authURL).
+		WithCookie("session_id", sessionCookie).
+		Expect().
+		Status(http.StatusOK).
+		Body().Raw())
+
+	htmlContent := e.POST(authURL).
+		WithFormField("step", step).
+		WithFormField("username", "saml-user").
+		WithCookie("session_id", sessionCookie).
+		Expect().
+		Status(http.StatusOK).
+		Body().Raw()
+	step = extractStep(t, htmlContent)
+
+	// New users confirm the registration before they set a password
+	if strings.Contains(htmlContent, `name="confirmation"`) {
+		step = extractStep(t, e.POST(authURL).
+			WithFormField("step", step).
+			WithFormField("confirmation", "true").
+			WithCookie("session_id", sessionCookie).
+			Expect().
+			Status(http.StatusOK).
+			Body().Raw())
+	}
+
+	e.POST(authURL).
+		WithFormField("step", step).
+		WithFormField("password", "saml-user").
+		WithCookie("session_id", sessionCookie).
+		Expect().
+		Status(http.StatusSeeOther).
+		Header("Location").IsEqual("http://localhost:8080/acme/customers/saml/finish")
+}
+
+func extractStep(t *testing.T, htmlContent string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	require.NoError(t, err)
+
+	step, ok := doc.Find("input[type='hidden'][name='step']").Attr("value")
+	require.True(t, ok, "Expected to find hidden step field in HTML response")
+	return step
+}
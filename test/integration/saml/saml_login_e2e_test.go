@@ -0,0 +1,144 @@
+package integration_saml
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Identityplane/GoAM/test/integration"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const federationFlow = `description: Federated login with the SAML identity provider of the realm
+start: init
+nodes:
+  init:
+    name: init
+    use: init
+    next:
+      start: samlLogin
+  samlLogin:
+    name: samlLogin
+    use: samlLogin
+    custom_config:
+      idp_entity_id: http://localhost:8080/acme/customers/saml/metadata
+      idp_sso_url: http://localhost:8080/acme/customers/saml/sso?flow=mock_success
+      idp_certificate: CERTIFICATE
+      sp_entity_id: http://localhost:8080/acme/customers/federation
+    next:
+      saml_new_user: createUser
+      saml_existing_user: successResult
+      saml_failure: failureResult
+  createUser:
+    name: createUser
+    use: createUser
+    next:
+      success: successResult
+      existing: successResult
+  successResult:
+    name: successResult
+    use: successResult
+    next: {}
+  failureResult:
+    name: failureResult
+    use: failureResult
+    next: {}
+`
+
+// TestSamlLogin_E2E performs an end-to-end test of the samlLogin node with the SAML identity provider of the same
+// realm as federated identity provider.
+// It tests the following operations in sequence:
+// 1. Registering the node as service provider and creating a flow with the node
+// 2. Starting the flow, which redirects to the identity provider
+// 3. Posting the response of the identity provider to the assertion consumer service without the session cookie
+// 4. Posting it again from the realm with the session cookie, which redirects to the node
+// 5. Finishing the flow with the response
+func TestSamlLogin_E2E(t *testing.T) {
+	e := integration.SetupIntegrationTest(t, "")
+
+	e.POST("/admin/acme/customers/applications/federation-sp").
+		WithJSON(map[string]interface{}{
+			"client_id":                    "federation-sp",
+			"type":                         "saml",
+			"allowed_authentication_flows": []string{"mock_success"},
+			"settings": map[string]interface{}{
+				"saml_settings": map[string]interface{}{
+					"entity_id":      "http://localhost:8080/acme/customers/federation",
+					"acs_urls":       []string{"http://localhost:8080/acme/customers/saml/acs"},
+					"name_id_format": "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent",
+				},
+			},
+		}).
+		Expect().
+		Status(http.StatusCreated)
+
+	metadata := e.GET("/acme/customers/saml/metadata").Expect().Status(http.StatusOK).Body().Raw()
+	certificate := regexp.MustCompile(`<ds:X509Certificate>(.*?)</ds:X509Certificate>`).FindStringSubmatch(metadata)[1]
+
+	e.POST("/admin/acme/customers/flows/saml_federation").
+		WithJSON(map[string]interface{}{"id": "saml_federation", "route": "saml-federation", "active": true}).
+		Expect().
+		Status(http.StatusCreated)
+	version := e.POST("/admin/acme/customers/flows/saml_federation/versions").
+		WithText(strings.Replace(federationFlow, "CERTIFICATE", certificate, 1)).
+		WithHeader("Content-Type", "text/yaml").
+		Expect().
+		Status(http.StatusCreated).
+		JSON().Object().Value("version").Number().Raw()
+	e.POST("/admin/acme/customers/flows/saml_federation/versions/{version}/publish", int(version)).
+		Expect().
+		Status(http.StatusOK)
+
+	// The flow redirects to the identity provider
+	start := e.GET("/acme/customers/auth/saml-federation").
+		Expect().
+		Status(http.StatusSeeOther)
+	sessionCookie := start.Cookie("session_id").Value().Raw()
+
+	idpUrl, err := url.Parse(start.Header("Location").Raw())
+	require.NoError(t, err)
+	assert.Equal(t, "/acme/customers/saml/sso", idpUrl.Path)
+	assert.Equal(t, "mock_success", idpUrl.Query().Get("flow"))
+
+	// The identity provider authenticates the user and posts the response to the assertion consumer service
+	idpPage := e.GET(idpUrl.Path).
+		WithQueryString(idpUrl.RawQuery).
+		Expect().
+		Status(http.StatusOK).
+		Body().Raw()
+	action, response, relayState := parsePostForm(t, idpPage)
+	require.Equal(t, "http://localhost:8080/acme/customers/saml/acs", action)
+	encodedResponse := base64.StdEncoding.EncodeToString([]byte(response))
+
+	// Without the session cookie the response is posted again from the realm
+	e.POST("/acme/customers/saml/acs").
+		WithFormField("SAMLResponse", encodedResponse).
+		WithFormField("RelayState", relayState).
+		Expect().
+		Status(http.StatusOK).
+		Body().Contains(`name="resume"`).Contains(`action="/acme/customers/saml/acs"`)
+
+	loginUrl := e.POST("/acme/customers/saml/acs").
+		WithFormField("SAMLResponse", encodedResponse).
+		WithFormField("RelayState", relayState).
+		WithFormField("resume", "true").
+		WithCookie("session_id", sessionCookie).
+		Expect().
+		Status(http.StatusTemporaryRedirect).
+		Header("Location").Raw()
+	assert.Equal(t, "http://localhost:8080/acme/customers/auth/saml-federation/samlLogin", loginUrl)
+
+	// The node validates the response and the flow creates the user
+	e.POST(strings.TrimPrefix(loginUrl, "http://localhost:8080")).
+		WithFormField("SAMLResponse", encodedResponse).
+		WithFormField("RelayState", relayState).
+		WithCookie("session_id", sessionCookie).
+		Expect().
+		Status(http.StatusOK).
+		Body().Contains(`data-node="successResult"`)
+}